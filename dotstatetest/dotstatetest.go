@@ -0,0 +1,33 @@
+// Package dotstatetest exposes dotstate's test harness outside the module,
+// so authors of modules and integrations can build the same throwaway
+// dotfiles repos dotstate's own tests use.
+package dotstatetest
+
+import (
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+// Repo is a real temporary dotfiles repo: a git repo with dot.toml and a
+// chezmoi-style source state in a fake home, pushing to a local bare
+// remote. See NewRepo.
+type Repo = testutil.FakeRepo
+
+// NewRepo creates a Repo with an empty source state committed and pushed
+// on main. It skips the test when git is not installed.
+func NewRepo(t testing.TB) *Repo {
+	t.Helper()
+	return testutil.NewFakeRepo(t)
+}
+
+// RequireGit skips the test when git is not installed.
+func RequireGit(t testing.TB) {
+	t.Helper()
+	testutil.RequireGit(t)
+}
+
+// DotToml returns the dot.toml NewRepo writes for a repo cloned from url.
+func DotToml(url string) string {
+	return testutil.FakeRepoDotToml(url)
+}
@@ -0,0 +1,61 @@
+// Package agex provides age encryption operations for dotstate.
+package agex
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+// Age provides age operations using an external runner.
+type Age struct {
+	Bin string
+	R   runner.Runner
+}
+
+// New creates a new Age with the given binary path and runner.
+// If bin is empty, "age" is used. If r is nil, a default runner is created.
+func New(bin string, r runner.Runner) *Age {
+	if bin == "" {
+		bin = "age"
+	}
+	if r == nil {
+		r = runner.New()
+	}
+	return &Age{Bin: bin, R: r}
+}
+
+// Encrypt encrypts src to every recipient and writes the ciphertext to dst.
+func (a *Age) Encrypt(ctx context.Context, recipients []string, src, dst string) error {
+	if len(recipients) == 0 {
+		return fmt.Errorf("no age recipients configured")
+	}
+	args := []string{}
+	for _, recipient := range recipients {
+		args = append(args, "-r", recipient)
+	}
+	args = append(args, "-o", dst, src)
+	if _, err := a.R.Run(ctx, "", a.Bin, args...); err != nil {
+		return fmt.Errorf("age encrypt failed: %w", err)
+	}
+	return nil
+}
+
+// Decrypt decrypts src with the identity file and returns the plaintext.
+// Callers must never log or render the returned bytes.
+func (a *Age) Decrypt(ctx context.Context, identity, src string) ([]byte, error) {
+	res, err := runner.RunSensitive(ctx, a.R, "", a.Bin, "-d", "-i", identity, src)
+	if err != nil {
+		return nil, fmt.Errorf("age decrypt failed: %w", err)
+	}
+	return []byte(res.Stdout), nil
+}
+
+// DecryptTo decrypts src with the identity file and writes the plaintext to dst.
+func (a *Age) DecryptTo(ctx context.Context, identity, src, dst string) error {
+	if _, err := runner.RunSensitive(ctx, a.R, "", a.Bin, "-d", "-i", identity, "-o", dst, src); err != nil {
+		return fmt.Errorf("age decrypt failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package agex
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/runner"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestNew(t *testing.T) {
+	a := New("", nil)
+	if a.Bin != "age" {
+		t.Errorf("Bin = %v, want age", a.Bin)
+	}
+	if a.R == nil {
+		t.Error("Runner is nil")
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("age", "-r", "age1one", "-r", "age1two", "-o", "/repo/state/encrypted/vpn.conf.age", "/home/u/vpn.conf"), "")
+
+	a := New("age", mock)
+	if err := a.Encrypt(context.Background(), []string{"age1one", "age1two"}, "/home/u/vpn.conf", "/repo/state/encrypted/vpn.conf.age"); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	mock.AssertCalled(testutil.MatchExact("age", "-r", "age1one", "-r", "age1two", "-o", "/repo/state/encrypted/vpn.conf.age", "/home/u/vpn.conf"))
+}
+
+func TestEncryptRequiresRecipients(t *testing.T) {
+	a := New("age", testutil.NewMockRunner(t))
+	if err := a.Encrypt(context.Background(), nil, "src", "dst"); err == nil {
+		t.Fatal("expected error without recipients")
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("age", "-d", "-i", "/keys/age.txt", "/repo/state/encrypted/vpn.conf.age"), "plaintext\n")
+
+	a := New("age", mock)
+	got, err := a.Decrypt(context.Background(), "/keys/age.txt", "/repo/state/encrypted/vpn.conf.age")
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if string(got) != "plaintext\n" {
+		t.Fatalf("Decrypt() = %q", got)
+	}
+}
+
+func TestDecryptNeverLogsPlaintext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake age is a shell script")
+	}
+	fake := filepath.Join(t.TempDir(), "age")
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\nprintf 'PLAINTEXT-SENTINEL'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	r := runner.New()
+	r.Logger = slog.New(slog.NewJSONHandler(&log, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	got, err := New(fake, r).Decrypt(context.Background(), "/keys/age.txt", "vpn.conf.age")
+	if err != nil || string(got) != "PLAINTEXT-SENTINEL" {
+		t.Fatalf("Decrypt() = %q, %v", got, err)
+	}
+	if log.Len() == 0 || strings.Contains(log.String(), "PLAINTEXT-SENTINEL") {
+		t.Fatalf("log = %q; want the command recorded without its output", log.String())
+	}
+}
+
+func TestDecryptTo(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandFailure(testutil.MatchCommandPrefix("age", "-d"), "no identity matched any of the recipients", 1)
+
+	a := New("age", mock)
+	if err := a.DecryptTo(context.Background(), "/keys/age.txt", "src.age", "dst"); err == nil {
+		t.Fatal("expected decrypt error")
+	}
+}
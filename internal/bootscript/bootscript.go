@@ -0,0 +1,185 @@
+// Package bootscript renders standalone bootstrap scripts that install git
+// and chezmoi, clone the dotstate repo, and apply it without the dot binary.
+package bootscript
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Shell selects the script dialect.
+type Shell string
+
+const (
+	ShellBash       Shell = "bash"
+	ShellPowerShell Shell = "powershell"
+)
+
+// Options describes the repo the script bootstraps.
+type Options struct {
+	RepoURL string
+	Branch  string
+	// RepoDir is where the repo is cloned, relative to the user's home
+	// directory on the target machine.
+	RepoDir string
+	// SourceDir is the chezmoi source directory inside the repo.
+	SourceDir string
+}
+
+// ParseShell validates a --shell value.
+func ParseShell(value string) (Shell, error) {
+	switch strings.ToLower(value) {
+	case "bash", "sh":
+		return ShellBash, nil
+	case "powershell", "pwsh", "ps1":
+		return ShellPowerShell, nil
+	default:
+		return "", fmt.Errorf("unknown shell %q (want bash or powershell)", value)
+	}
+}
+
+// Render returns the script for shell.
+func Render(shell Shell, opts Options) (string, error) {
+	if opts.RepoURL == "" {
+		return "", fmt.Errorf("repo URL is required")
+	}
+	if opts.Branch == "" {
+		opts.Branch = "main"
+	}
+	if opts.RepoDir == "" {
+		opts.RepoDir = "dotstate"
+	}
+	if opts.SourceDir == "" {
+		opts.SourceDir = "home"
+	}
+	opts.RepoDir = path.Clean(strings.ReplaceAll(opts.RepoDir, `\`, "/"))
+	if path.IsAbs(opts.RepoDir) || strings.HasPrefix(opts.RepoDir, "..") {
+		return "", fmt.Errorf("repo dir must be relative to home: %s", opts.RepoDir)
+	}
+	switch shell {
+	case ShellBash:
+		return renderBash(opts), nil
+	case ShellPowerShell:
+		return renderPowerShell(opts), nil
+	default:
+		return "", fmt.Errorf("unknown shell %q", shell)
+	}
+}
+
+func renderBash(opts Options) string {
+	var b strings.Builder
+	b.WriteString("#!/usr/bin/env bash\n")
+	b.WriteString("# Generated by `dot export script`: installs git and chezmoi, clones the\n")
+	b.WriteString("# dotstate repo, and applies it. Safe to re-run.\n")
+	b.WriteString("set -euo pipefail\n\n")
+	fmt.Fprintf(&b, "REPO_URL=%s\n", bashQuote(opts.RepoURL))
+	fmt.Fprintf(&b, "BRANCH=%s\n", bashQuote(opts.Branch))
+	fmt.Fprintf(&b, "REPO_DIR=\"${DOTSTATE_REPO_PATH:-$HOME/%s}\"\n", bashDoubleQuoted(opts.RepoDir))
+	fmt.Fprintf(&b, "SOURCE_DIR=%s\n\n", bashQuote(opts.SourceDir))
+	b.WriteString(`have() { command -v "$1" >/dev/null 2>&1; }
+
+install_pkg() {
+  if have brew; then brew install "$1"
+  elif have apt-get; then sudo apt-get update -y && sudo apt-get install -y "$1"
+  elif have dnf; then sudo dnf install -y "$1"
+  elif have pacman; then sudo pacman -S --noconfirm "$1"
+  elif have zypper; then sudo zypper install -y "$1"
+  elif have apk; then sudo apk add "$1"
+  else return 1
+  fi
+}
+
+if ! have git; then
+  echo "==> installing git"
+  if [ "$(uname -s)" = "Darwin" ] && ! have brew; then
+    xcode-select --install || true
+    echo "Finish the Command Line Tools install, then re-run this script." >&2
+    exit 1
+  fi
+  install_pkg git || { echo "cannot install git: no supported package manager" >&2; exit 1; }
+fi
+
+CHEZMOI=chezmoi
+if ! have chezmoi; then
+  echo "==> installing chezmoi"
+  if ! install_pkg chezmoi 2>/dev/null || ! have chezmoi; then
+    mkdir -p "$HOME/.local/bin"
+    sh -c "$(curl -fsLS get.chezmoi.io)" -- -b "$HOME/.local/bin"
+    CHEZMOI="$HOME/.local/bin/chezmoi"
+  fi
+fi
+
+if [ -d "$REPO_DIR/.git" ]; then
+  echo "==> updating $REPO_DIR"
+  git -C "$REPO_DIR" pull --ff-only origin "$BRANCH"
+else
+  echo "==> cloning into $REPO_DIR"
+  mkdir -p "$(dirname "$REPO_DIR")"
+  git clone --branch "$BRANCH" "$REPO_URL" "$REPO_DIR"
+fi
+
+echo "==> applying"
+"$CHEZMOI" apply --source "$REPO_DIR/$SOURCE_DIR"
+echo "==> done. Install dot later and run: dot doctor"
+`)
+	return b.String()
+}
+
+func renderPowerShell(opts Options) string {
+	var b strings.Builder
+	b.WriteString("# Generated by `dot export script`: installs git and chezmoi, clones the\n")
+	b.WriteString("# dotstate repo, and applies it. Safe to re-run.\n")
+	b.WriteString("$ErrorActionPreference = 'Stop'\n\n")
+	fmt.Fprintf(&b, "$RepoUrl = %s\n", psQuote(opts.RepoURL))
+	fmt.Fprintf(&b, "$Branch = %s\n", psQuote(opts.Branch))
+	fmt.Fprintf(&b, "$RepoDir = if ($env:DOTSTATE_REPO_PATH) { $env:DOTSTATE_REPO_PATH } else { Join-Path $HOME %s }\n", psQuote(strings.ReplaceAll(opts.RepoDir, "/", `\`)))
+	fmt.Fprintf(&b, "$SourceDir = %s\n\n", psQuote(opts.SourceDir))
+	b.WriteString(`function Test-Command($Name) { [bool](Get-Command $Name -ErrorAction SilentlyContinue) }
+
+function Update-SessionPath {
+  $env:Path = [Environment]::GetEnvironmentVariable('Path', 'Machine') + ';' + [Environment]::GetEnvironmentVariable('Path', 'User')
+}
+
+if (-not (Test-Command git)) {
+  Write-Host '==> installing git'
+  winget install --id Git.Git -e --source winget --accept-package-agreements --accept-source-agreements
+  Update-SessionPath
+}
+
+if (-not (Test-Command chezmoi)) {
+  Write-Host '==> installing chezmoi'
+  winget install --id twpayne.chezmoi -e --source winget --accept-package-agreements --accept-source-agreements
+  Update-SessionPath
+}
+
+if (Test-Path (Join-Path $RepoDir '.git')) {
+  Write-Host "==> updating $RepoDir"
+  git -C $RepoDir pull --ff-only origin $Branch
+} else {
+  Write-Host "==> cloning into $RepoDir"
+  git clone --branch $Branch $RepoUrl $RepoDir
+}
+if ($LASTEXITCODE -ne 0) { throw 'git failed' }
+
+Write-Host '==> applying'
+chezmoi apply --source (Join-Path $RepoDir $SourceDir)
+if ($LASTEXITCODE -ne 0) { throw 'chezmoi apply failed' }
+Write-Host '==> done. Install dot later and run: dot doctor'
+`)
+	return b.String()
+}
+
+func bashQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// bashDoubleQuoted escapes s for use inside an existing double-quoted string.
+func bashDoubleQuoted(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return r.Replace(s)
+}
+
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,66 @@
+package bootscript
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderBashQuotesValuesAndParses(t *testing.T) {
+	script, err := Render(ShellBash, Options{RepoURL: "git@github.com:me/dot's.git", Branch: "main", RepoDir: "src/$dot"})
+	if err != nil {
+		t.Fatalf("Render error = %v", err)
+	}
+	for _, want := range []string{
+		`REPO_URL='git@github.com:me/dot'\''s.git'`,
+		`REPO_DIR="${DOTSTATE_REPO_PATH:-$HOME/src/\$dot}"`,
+		`SOURCE_DIR='home'`,
+		`apply --source "$REPO_DIR/$SOURCE_DIR"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("script missing %q:\n%s", want, script)
+		}
+	}
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+	path := filepath.Join(t.TempDir(), "bootstrap.sh")
+	if err := os.WriteFile(path, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(bash, "-n", path).CombinedOutput(); err != nil {
+		t.Fatalf("bash -n: %v\n%s", err, out)
+	}
+}
+
+func TestRenderPowerShellUsesWingetAndQuotes(t *testing.T) {
+	script, err := Render(ShellPowerShell, Options{RepoURL: "https://example.com/o'neil/dot.git", RepoDir: "code/dotstate", SourceDir: "home"})
+	if err != nil {
+		t.Fatalf("Render error = %v", err)
+	}
+	for _, want := range []string{
+		`$RepoUrl = 'https://example.com/o''neil/dot.git'`,
+		`$Branch = 'main'`,
+		`Join-Path $HOME 'code\dotstate'`,
+		"winget install --id twpayne.chezmoi",
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("script missing %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestRenderRejectsBadOptions(t *testing.T) {
+	if _, err := Render(ShellBash, Options{}); err == nil {
+		t.Fatal("expected missing repo URL error")
+	}
+	if _, err := Render(ShellBash, Options{RepoURL: "x", RepoDir: "../elsewhere"}); err == nil {
+		t.Fatal("expected repo dir outside home error")
+	}
+	if _, err := ParseShell("fish"); err == nil {
+		t.Fatal("expected unknown shell error")
+	}
+}
@@ -0,0 +1,330 @@
+// Package bundle moves a dotstate repo to a machine without network access.
+// An export is a gzipped tarball holding a git bundle of every ref, copies
+// of the committed state manifests, and a manifest.json that records the
+// branch, HEAD, origin URL, and a SHA-256 checksum for each manifest, so an
+// import can check the archive is intact and its clone is the repo that was
+// exported.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+)
+
+// Format identifies the archive layout in manifest.json.
+const Format = "dotstate.bundle.v1"
+
+// Archive member names.
+const (
+	ManifestName = "manifest.json"
+	RepoName     = "repo.bundle"
+	// StateDir holds the state manifests, as in the repo.
+	StateDir = "state"
+)
+
+// ErrDirty is returned by Export when the repo has uncommitted changes,
+// which a git bundle would leave behind.
+var ErrDirty = errors.New("the repo has uncommitted changes")
+
+// Manifest describes an exported bundle.
+type Manifest struct {
+	Format     string    `json:"format"`
+	CreatedAt  time.Time `json:"created_at"`
+	DotVersion string    `json:"dot_version,omitempty"`
+	Branch     string    `json:"branch"`
+	Head       string    `json:"head"`
+	// RepoURL is the origin the import points its clone at; empty leaves
+	// the clone without a remote.
+	RepoURL string `json:"repo_url,omitempty"`
+	State   []File `json:"state"`
+}
+
+// File is one state manifest in the bundle.
+type File struct {
+	// Path is slash-separated and relative to the repo root.
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	RepoPath string
+	// Output is the archive path to write.
+	Output     string
+	RepoURL    string
+	DotVersion string
+	// Now stamps the manifest; zero uses time.Now.
+	Now time.Time
+}
+
+// Export writes the repo at opts.RepoPath to a bundle archive. The repo
+// must have no uncommitted changes.
+func Export(ctx context.Context, g *gitx.Git, opts ExportOptions) (*Manifest, error) {
+	dirty, err := g.HasChanges(ctx, opts.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, ErrDirty
+	}
+	branch, err := g.CurrentBranch(ctx, opts.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+	if branch == "HEAD" {
+		return nil, fmt.Errorf("HEAD is detached; check out a branch before exporting")
+	}
+	head, err := g.RevParse(ctx, opts.RepoPath, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := g.TreeBlobs(ctx, opts.RepoPath, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	m := &Manifest{
+		Format:     Format,
+		CreatedAt:  now.UTC(),
+		DotVersion: opts.DotVersion,
+		Branch:     branch,
+		Head:       head,
+		RepoURL:    opts.RepoURL,
+		State:      []File{},
+	}
+	for _, blob := range blobs {
+		if !strings.HasPrefix(blob.Path, StateDir+"/") {
+			continue
+		}
+		sum, err := fileChecksum(filepath.Join(opts.RepoPath, filepath.FromSlash(blob.Path)))
+		if err != nil {
+			return nil, err
+		}
+		m.State = append(m.State, File{Path: blob.Path, SHA256: sum})
+	}
+
+	tmp, err := os.MkdirTemp("", "dotstate-bundle-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	repoBundle := filepath.Join(tmp, RepoName)
+	if err := g.BundleCreate(ctx, opts.RepoPath, repoBundle); err != nil {
+		return nil, fmt.Errorf("git bundle: %w", err)
+	}
+
+	if err := writeArchive(opts.Output, opts.RepoPath, repoBundle, m); err != nil {
+		_ = os.Remove(opts.Output)
+		return nil, err
+	}
+	return m, nil
+}
+
+func writeArchive(output, repoPath, repoBundle string, m *Manifest) error {
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	if err := addBytes(tw, ManifestName, append(manifest, '\n'), m.CreatedAt); err != nil {
+		return err
+	}
+	if err := addFile(tw, RepoName, repoBundle, m.CreatedAt); err != nil {
+		return err
+	}
+	for _, file := range m.State {
+		if err := addFile(tw, file.Path, filepath.Join(repoPath, filepath.FromSlash(file.Path)), m.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func addBytes(tw *tar.Writer, name string, b []byte, mtime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(b)), ModTime: mtime}); err != nil {
+		return err
+	}
+	_, err := tw.Write(b)
+	return err
+}
+
+func addFile(tw *tar.Writer, name, src string, mtime time.Time) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: info.Size(), ModTime: mtime}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Import clones the repo in the bundle archive at archive into repoPath,
+// which must not exist or be empty. origin is set to the manifest's
+// RepoURL, or removed when it has none. Import fails when a state manifest
+// copy does not match its checksum or the clone's HEAD is not the exported
+// one.
+func Import(ctx context.Context, g *gitx.Git, archive, repoPath string) (*Manifest, error) {
+	if entries, err := os.ReadDir(repoPath); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("repo path exists and is not empty: %s", repoPath)
+	}
+	tmp, err := os.MkdirTemp("", "dotstate-bundle-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	m, err := extract(archive, tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(repoPath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := g.CloneBundle(ctx, filepath.Join(tmp, RepoName), repoPath, m.Branch); err != nil {
+		return nil, fmt.Errorf("clone bundle: %w", err)
+	}
+	if m.RepoURL != "" {
+		err = g.SetRemoteURL(ctx, repoPath, "origin", m.RepoURL)
+	} else {
+		err = g.RemoveRemote(ctx, repoPath, "origin")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := g.RevParse(ctx, repoPath, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if head != m.Head {
+		return nil, fmt.Errorf("clone is at %s, but the bundle was exported at %s", head, m.Head)
+	}
+	return m, nil
+}
+
+// extract reads manifest.json, writes repo.bundle to dir, and checks each
+// state manifest copy against its checksum.
+func extract(archive, dir string) (*Manifest, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("read bundle %s: %w", archive, err)
+	}
+	tr := tar.NewReader(gz)
+
+	var m *Manifest
+	state := map[string]string{}
+	hasRepo := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read bundle %s: %w", archive, err)
+		}
+		name := path.Clean(hdr.Name)
+		switch {
+		case hdr.Typeflag != tar.TypeReg:
+			continue
+		case name == ManifestName:
+			m = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", ManifestName, err)
+			}
+		case name == RepoName:
+			if err := writeFile(filepath.Join(dir, RepoName), tr); err != nil {
+				return nil, err
+			}
+			hasRepo = true
+		case strings.HasPrefix(name, StateDir+"/"):
+			h := sha256.New()
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, err
+			}
+			state[name] = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+
+	switch {
+	case m == nil:
+		return nil, fmt.Errorf("%s is not a dotstate bundle: no %s", archive, ManifestName)
+	case m.Format != Format:
+		return nil, fmt.Errorf("%s has unsupported format %q, want %s", archive, m.Format, Format)
+	case !hasRepo:
+		return nil, fmt.Errorf("%s has no %s", archive, RepoName)
+	}
+	for _, file := range m.State {
+		if state[file.Path] != file.SHA256 {
+			return nil, fmt.Errorf("%s in %s does not match its checksum", file.Path, archive)
+		}
+	}
+	return m, nil
+}
+
+func writeFile(dest string, r io.Reader) error {
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
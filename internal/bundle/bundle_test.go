@@ -0,0 +1,59 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	repo := testutil.NewFakeRepo(t)
+	repo.WriteFile("state/packages/brew.txt", "git\njq\n")
+	repo.Commit("capture packages")
+	g := gitx.New("git", nil)
+
+	out := filepath.Join(t.TempDir(), "dotstate.tar.gz")
+	m, err := Export(ctx, g, ExportOptions{RepoPath: repo.Root, Output: out, RepoURL: "git@example.com:me/dotstate.git", Now: time.Unix(0, 0)})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if m.Branch != "main" || m.Head != repo.Head() || len(m.State) != 1 || m.State[0].Path != "state/packages/brew.txt" {
+		t.Fatalf("manifest = %+v", m)
+	}
+
+	dest := filepath.Join(t.TempDir(), "airgap", "dotstate")
+	imported, err := Import(ctx, g, out, dest)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if imported.Head != m.Head {
+		t.Errorf("imported head = %s, want %s", imported.Head, m.Head)
+	}
+	if b, err := os.ReadFile(filepath.Join(dest, "state", "packages", "brew.txt")); err != nil || string(b) != "git\njq\n" {
+		t.Errorf("imported manifest = %q, %v", b, err)
+	}
+	if url, _ := g.RemoteURL(ctx, dest); url != "git@example.com:me/dotstate.git" {
+		t.Errorf("origin = %q, want the exported repo URL", url)
+	}
+
+	if _, err := Import(ctx, g, out, dest); err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Errorf("Import() into a non-empty path error = %v", err)
+	}
+}
+
+func TestExportRefusesUncommittedChanges(t *testing.T) {
+	repo := testutil.NewFakeRepo(t)
+	repo.WriteFile("state/packages/brew.txt", "git\n")
+	_, err := Export(context.Background(), gitx.New("git", nil), ExportOptions{RepoPath: repo.Root, Output: filepath.Join(t.TempDir(), "out.tar.gz")})
+	if !errors.Is(err, ErrDirty) {
+		t.Fatalf("Export() error = %v, want ErrDirty", err)
+	}
+}
@@ -0,0 +1,82 @@
+package chez
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Attributes are the chezmoi source-state attributes dotstate can set when
+// adding a file, so discover does not leave users renaming source files by
+// hand afterwards.
+type Attributes struct {
+	// Private stores the file as private_ (no group/other permissions).
+	Private bool
+	// ReadOnly stores the file as readonly_ (no write permissions).
+	ReadOnly bool
+	// Create stores the file as create_, written only when missing.
+	Create bool
+	// Symlink keeps a symlinked target as a symlink_ entry instead of
+	// following it and adding the file it points to.
+	Symlink bool
+	// Template stores the file as a .tmpl template. It is set when discover
+	// rewrites secrets into placeholders, not from [discover.attributes].
+	Template bool
+}
+
+// AttributeNames lists the names accepted by ParseAttributes, in the order
+// String renders them.
+var AttributeNames = []string{"private", "readonly", "create", "symlink"}
+
+// ParseAttributes parses a comma-separated attribute list such as
+// "private,readonly". An empty string or "none" yields no attributes.
+func ParseAttributes(s string) (Attributes, error) {
+	var a Attributes
+	for _, name := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "", "none":
+		case "private":
+			a.Private = true
+		case "readonly":
+			a.ReadOnly = true
+		case "create":
+			a.Create = true
+		case "symlink":
+			a.Symlink = true
+		default:
+			return Attributes{}, fmt.Errorf("unknown attribute %q (expected: %s)", strings.TrimSpace(name), strings.Join(AttributeNames, ", "))
+		}
+	}
+	return a, nil
+}
+
+// IsZero reports whether no attribute is set.
+func (a Attributes) IsZero() bool {
+	return a == Attributes{}
+}
+
+// String returns the comma-separated attribute names, or "" when none are set.
+func (a Attributes) String() string {
+	var names []string
+	for i, set := range []bool{a.Private, a.ReadOnly, a.Create, a.Symlink} {
+		if set {
+			names = append(names, AttributeNames[i])
+		}
+	}
+	if a.Template {
+		names = append(names, "template")
+	}
+	return strings.Join(names, ",")
+}
+
+// chattrModifier returns the chezmoi chattr modifier for the attributes that
+// chezmoi add cannot set through flags, or "" when there are none.
+func (a Attributes) chattrModifier() string {
+	var mods []string
+	if a.Private {
+		mods = append(mods, "+private")
+	}
+	if a.ReadOnly {
+		mods = append(mods, "+readonly")
+	}
+	return strings.Join(mods, ",")
+}
@@ -0,0 +1,142 @@
+package chez
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Versions that introduced the flags dotstate shims around.
+var (
+	secretsSince      = [3]int{2, 33, 0}
+	overrideDataSince = [3]int{2, 41, 0}
+)
+
+// CapabilitiesCacheFile is the probe cache's file name under dotstate's
+// cache directory.
+const CapabilitiesCacheFile = "chezmoi-capabilities.json"
+
+var versionRE = regexp.MustCompile(`version v?(\d+)\.(\d+)\.(\d+)`)
+
+// Capabilities describes what the installed chezmoi supports, so dotstate
+// can drop flags older releases (as shipped by distro repos) reject instead
+// of failing.
+type Capabilities struct {
+	// Version is the release version, e.g. "2.40.0"; empty for development
+	// builds, which are assumed to support everything.
+	Version string `json:"version"`
+	// Secrets is support for add --secrets.
+	Secrets bool `json:"secrets"`
+	// OverrideData is support for --override-data, which injects dotstate's
+	// template data.
+	OverrideData bool `json:"override_data"`
+
+	warned map[string]bool
+}
+
+// Missing lists the flags this chezmoi lacks.
+func (c *Capabilities) Missing() []string {
+	var missing []string
+	if !c.Secrets {
+		missing = append(missing, "add --secrets")
+	}
+	if !c.OverrideData {
+		missing = append(missing, "--override-data")
+	}
+	return missing
+}
+
+// ParseCapabilities derives capabilities from chezmoi --version output.
+func ParseCapabilities(versionOutput string) *Capabilities {
+	match := versionRE.FindStringSubmatch(versionOutput)
+	if match == nil {
+		return &Capabilities{Secrets: true, OverrideData: true}
+	}
+	var v [3]int
+	for i := range v {
+		v[i], _ = strconv.Atoi(match[i+1])
+	}
+	return &Capabilities{
+		Version:      fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2]),
+		Secrets:      !versionBefore(v, secretsSince),
+		OverrideData: !versionBefore(v, overrideDataSince),
+	}
+}
+
+func versionBefore(v, since [3]int) bool {
+	for i := range v {
+		if v[i] != since[i] {
+			return v[i] < since[i]
+		}
+	}
+	return false
+}
+
+// capabilitiesCache is the on-disk probe result, valid while the binary
+// it was read from is unchanged.
+type capabilitiesCache struct {
+	Binary       string        `json:"binary"`
+	Size         int64         `json:"size"`
+	ModTime      time.Time     `json:"mod_time"`
+	Capabilities *Capabilities `json:"capabilities"`
+}
+
+// Probe runs chezmoi --version once and sets c.Caps. When cachePath is set
+// the result is stored there and reused until the chezmoi binary changes.
+func (c *Chezmoi) Probe(ctx context.Context, cachePath string) error {
+	var key capabilitiesCache
+	if cachePath != "" {
+		if path, err := exec.LookPath(c.Bin); err == nil {
+			if info, err := os.Stat(path); err == nil {
+				key = capabilitiesCache{Binary: path, Size: info.Size(), ModTime: info.ModTime().UTC()}
+			}
+		}
+	}
+	if key.Binary != "" {
+		var cached capabilitiesCache
+		if data, err := os.ReadFile(cachePath); err == nil && json.Unmarshal(data, &cached) == nil &&
+			cached.Capabilities != nil && cached.Binary == key.Binary && cached.Size == key.Size && cached.ModTime.Equal(key.ModTime) {
+			c.Caps = cached.Capabilities
+			return nil
+		}
+	}
+	version, err := c.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("probe chezmoi version: %w", err)
+	}
+	c.Caps = ParseCapabilities(version)
+	if key.Binary == "" {
+		return nil
+	}
+	key.Capabilities = c.Caps
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(cachePath, data, 0o644)
+}
+
+// supports reports whether chezmoi has a capability, warning once through
+// c.Warn when it does not. Without a probe every capability is assumed.
+func (c *Chezmoi) supports(has func(*Capabilities) bool, flag, consequence string) bool {
+	if c.Caps == nil || has(c.Caps) {
+		return true
+	}
+	if c.Caps.warned == nil {
+		c.Caps.warned = map[string]bool{}
+	}
+	if c.Warn != nil && !c.Caps.warned[flag] {
+		c.Caps.warned[flag] = true
+		c.Warn(fmt.Sprintf("chezmoi %s does not support %s; %s", c.Caps.Version, flag, consequence))
+	}
+	return false
+}
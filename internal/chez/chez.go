@@ -4,16 +4,76 @@ package chez
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/dnery/dotstate/dot/internal/diffstat"
 	"github.com/dnery/dotstate/dot/internal/runner"
 )
 
+// Engine is the source-state backend that the files module and discover
+// drive. *Chezmoi implements it; the native engine is a chezmoi-free
+// alternative selected with [chex] engine = "native".
+type Engine interface {
+	Managed(ctx context.Context, repoPath, sourceDir string) ([]string, error)
+	Apply(ctx context.Context, repoPath, sourceDir string, targets ...string) error
+	ReAdd(ctx context.Context, repoPath, sourceDir string, targets ...string) error
+	Diff(ctx context.Context, repoPath, sourceDir string, targets ...string) (string, error)
+	Add(ctx context.Context, repoPath, sourceDir string, files []string, secretsMode string) error
+	AddWithAttributes(ctx context.Context, repoPath, sourceDir string, files []string, secretsMode string, attrs Attributes) error
+	SourcePath(ctx context.Context, repoPath, sourceDir, target string) (string, error)
+	Forget(ctx context.Context, repoPath, sourceDir string, targets ...string) error
+}
+
+var _ Engine = (*Chezmoi)(nil)
+
 // Chezmoi provides chezmoi operations using an external runner.
 type Chezmoi struct {
 	Bin string
 	R   runner.Runner
+	// OverrideData is JSON template data passed via --override-data, used to
+	// inject dotstate's template vocabulary without editing chezmoi's config.
+	OverrideData string
+	// DestDir is the destination directory diff paths are relative to;
+	// empty means the user's home directory.
+	DestDir string
+	// Include and Exclude limit apply and diff to, or skip, chezmoi entry
+	// types (e.g. "scripts"), passed as --include and --exclude.
+	Include string
+	Exclude string
+	// Progress, when set, is called for each entry apply handles: apply
+	// lists the pending entries first and runs chezmoi --verbose to see
+	// each one as it is written.
+	Progress func(FileProgress)
+	// GlobalArgs are extra global flags for every source-state command,
+	// e.g. --destination and --config to sandbox chezmoi in a temp home.
+	GlobalArgs []string
+	// Caps is the probed chezmoi's capabilities (see Probe); nil assumes a
+	// current chezmoi. Flags it lacks are left out with a warning to Warn.
+	Caps *Capabilities
+	Warn func(string)
+}
+
+// File progress actions.
+const (
+	ProgressCreated  = "created"
+	ProgressModified = "modified"
+	ProgressRemoved  = "removed"
+	// ProgressSkipped is an entry apply left alone: pending but not written
+	// by chezmoi, or already up to date in the native engine.
+	ProgressSkipped = "skipped"
+)
+
+// FileProgress reports one destination entry handled by apply.
+type FileProgress struct {
+	// Path is relative to the destination directory.
+	Path   string
+	Action string
+	// Done counts the entries handled so far, this one included, of Total.
+	Done  int
+	Total int
 }
 
 // New creates a new Chezmoi with the given binary path and runner.
@@ -28,65 +88,264 @@ func New(bin string, r runner.Runner) *Chezmoi {
 	return &Chezmoi{Bin: bin, R: r}
 }
 
-// ReAdd re-adds all managed files that differ in destination.
+// ReAdd re-adds all managed files that differ in destination, limited to
+// targets when any are given.
 // This is the core of the "edit real files normally" workflow.
-func (c *Chezmoi) ReAdd(ctx context.Context, repoPath, sourceDir string) error {
-	args := []string{}
-	if sourceDir != "" {
-		args = append(args, "--source", filepath.Join(repoPath, sourceDir))
+func (c *Chezmoi) ReAdd(ctx context.Context, repoPath, sourceDir string, targets ...string) error {
+	if err := c.captureModes(ctx, repoPath, sourceDir, targets); err != nil {
+		return err
 	}
+	args := c.baseArgs(repoPath, sourceDir)
 	args = append(args, "re-add")
-	_, err := c.R.Run(ctx, repoPath, c.Bin, args...)
+	_, err := c.R.Run(ctx, repoPath, c.Bin, append(args, targets...)...)
 	return err
 }
 
-// Apply applies the source state to the destination.
-func (c *Chezmoi) Apply(ctx context.Context, repoPath, sourceDir string) error {
-	args := []string{}
-	if sourceDir != "" {
-		args = append(args, "--source", filepath.Join(repoPath, sourceDir))
+// captureModes copies executable-bit drift from the destination into the
+// source state. chezmoi re-add only compares contents, so a chmod +x alone
+// would otherwise be reverted by the next apply.
+func (c *Chezmoi) captureModes(ctx context.Context, repoPath, sourceDir string, targets []string) error {
+	diff, err := c.Diff(ctx, repoPath, sourceDir, targets...)
+	if err != nil {
+		return fmt.Errorf("chezmoi diff for mode changes: %w", err)
+	}
+	var executable, plain []string
+	for _, stat := range diffstat.Parse(diff) {
+		if !stat.ModeChanged() || !isFileMode(stat.OldMode) || !isFileMode(stat.NewMode) {
+			continue
+		}
+		target, err := c.destPath(stat.Path)
+		if err != nil {
+			return err
+		}
+		// chezmoi diff runs from the destination (old) to the source state
+		// (new), so the old mode is the one to keep.
+		if stat.OldMode == "100755" {
+			executable = append(executable, target)
+		} else {
+			plain = append(plain, target)
+		}
+	}
+	for _, group := range []struct {
+		modifier string
+		targets  []string
+	}{{"+executable", executable}, {"noexecutable", plain}} {
+		if len(group.targets) == 0 {
+			continue
+		}
+		args := append(c.baseArgs(repoPath, sourceDir), "chattr", group.modifier)
+		if _, err := c.R.Run(ctx, repoPath, c.Bin, append(args, group.targets...)...); err != nil {
+			return fmt.Errorf("chezmoi chattr %s: %w", group.modifier, err)
+		}
 	}
+	return nil
+}
+
+func isFileMode(mode string) bool {
+	return mode == "100644" || mode == "100755"
+}
+
+// destPath resolves a destination-relative diff path.
+func (c *Chezmoi) destPath(rel string) (string, error) {
+	dest := c.DestDir
+	if dest == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dest = home
+	}
+	return filepath.Join(dest, filepath.FromSlash(rel)), nil
+}
+
+// Apply applies the source state to the destination, limited to targets
+// (destination paths) when any are given.
+func (c *Chezmoi) Apply(ctx context.Context, repoPath, sourceDir string, targets ...string) error {
+	_, err := c.ApplyOutput(ctx, repoPath, sourceDir, targets...)
+	return err
+}
+
+// ApplyOutput is Apply that also returns what chezmoi and any scripts it
+// ran printed. The result is returned on failure too.
+func (c *Chezmoi) ApplyOutput(ctx context.Context, repoPath, sourceDir string, targets ...string) (*runner.CmdResult, error) {
+	if c.Progress != nil {
+		return c.applyWithProgress(ctx, repoPath, sourceDir, targets)
+	}
+	args := c.baseArgs(repoPath, sourceDir)
 	args = append(args, "apply")
-	_, err := c.R.Run(ctx, repoPath, c.Bin, args...)
+	args = append(args, c.filterArgs()...)
+	args = append(args, targets...)
+	res, err := c.R.Run(ctx, repoPath, c.Bin, args...)
 	if err != nil {
-		return fmt.Errorf("chezmoi apply failed: %w", err)
+		return res, fmt.Errorf("chezmoi apply failed: %w", err)
 	}
-	return nil
+	return res, nil
+}
+
+// applyWithProgress applies with --verbose and reports each entry when its
+// diff header appears in the output. Pending entries chezmoi did not write,
+// including those after a failure, are reported skipped at the end, so the
+// last report always has Done == Total.
+func (c *Chezmoi) applyWithProgress(ctx context.Context, repoPath, sourceDir string, targets []string) (*runner.CmdResult, error) {
+	entries, err := c.Status(ctx, repoPath, sourceDir, targets...)
+	if err != nil {
+		return nil, fmt.Errorf("chezmoi status: %w", err)
+	}
+	pending := map[string]byte{}
+	var order []string
+	for _, entry := range entries {
+		if entry.Pending == ' ' || entry.Pending == 'R' {
+			continue
+		}
+		pending[entry.Path] = entry.Pending
+		order = append(order, entry.Path)
+	}
+	total, done := len(order), 0
+	seen := map[string]bool{}
+	report := func(path, action string) {
+		seen[path] = true
+		done++
+		c.Progress(FileProgress{Path: path, Action: action, Done: done, Total: max(total, done)})
+	}
+
+	args := c.baseArgs(repoPath, sourceDir)
+	args = append(args, "apply", "--verbose")
+	args = append(args, c.filterArgs()...)
+	args = append(args, targets...)
+	res, err := runner.RunLines(ctx, c.R, repoPath, c.Bin, func(line string) {
+		if path, ok := diffstat.HeaderPath(line); ok && !seen[path] {
+			report(path, progressAction(pending[path]))
+		}
+	}, args...)
+	for _, path := range order {
+		if !seen[path] {
+			report(path, ProgressSkipped)
+		}
+	}
+	if err != nil {
+		return res, fmt.Errorf("chezmoi apply failed: %w", err)
+	}
+	return res, nil
+}
+
+func progressAction(pending byte) string {
+	switch pending {
+	case 'A':
+		return ProgressCreated
+	case 'D':
+		return ProgressRemoved
+	default:
+		return ProgressModified
+	}
+}
+
+// StatusEntry is one line of chezmoi status. Pending is the change apply
+// would make: 'A' add, 'D' delete, 'M' modify, 'R' run a script.
+type StatusEntry struct {
+	Pending byte
+	// Path is relative to the destination directory.
+	Path string
+}
+
+// Status lists the entries apply would change, limited to targets when any
+// are given and honoring Include and Exclude.
+func (c *Chezmoi) Status(ctx context.Context, repoPath, sourceDir string, targets ...string) ([]StatusEntry, error) {
+	args := c.baseArgs(repoPath, sourceDir)
+	args = append(args, "status")
+	args = append(args, c.filterArgs()...)
+	args = append(args, targets...)
+	res, err := c.R.Run(ctx, repoPath, c.Bin, args...)
+	if err != nil {
+		return nil, err
+	}
+	var entries []StatusEntry
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		// Two status columns, a space, then the path.
+		if len(line) < 4 || line[2] != ' ' {
+			continue
+		}
+		entries = append(entries, StatusEntry{Pending: line[1], Path: line[3:]})
+	}
+	return entries, nil
+}
+
+// TargetPath returns the destination path of a status or managed entry.
+func (c *Chezmoi) TargetPath(rel string) (string, error) {
+	return c.destPath(rel)
 }
 
 // Add adds files to the source state.
 // secretsMode can be "error", "warning", or "ignore".
 func (c *Chezmoi) Add(ctx context.Context, repoPath, sourceDir string, files []string, secretsMode string) error {
+	return c.AddWithAttributes(ctx, repoPath, sourceDir, files, secretsMode, Attributes{})
+}
+
+// AddWithAttributes adds files to the source state and sets attrs on the
+// resulting entries. Symlinked files are followed and added by content
+// unless attrs.Symlink is set, which requires every file to be a symlink.
+func (c *Chezmoi) AddWithAttributes(ctx context.Context, repoPath, sourceDir string, files []string, secretsMode string, attrs Attributes) error {
 	if len(files) == 0 {
 		return nil
 	}
 
-	args := []string{}
-	if sourceDir != "" {
-		args = append(args, "--source", filepath.Join(repoPath, sourceDir))
-	}
+	args := c.baseArgs(repoPath, sourceDir)
 	args = append(args, "add")
 
 	switch secretsMode {
 	case "", "ignore":
 		// No chezmoi flag for ignore mode.
 	case "error", "warning":
-		args = append(args, "--secrets="+secretsMode)
+		if c.supports(func(caps *Capabilities) bool { return caps.Secrets }, "add --secrets", "adding without chezmoi's secret check (dotstate's own scan still applies)") {
+			args = append(args, "--secrets="+secretsMode)
+		}
 	default:
 		return fmt.Errorf("invalid secrets mode: %s", secretsMode)
 	}
-	args = append(args, files...)
+	if attrs.Create {
+		args = append(args, "--create")
+	}
+	if attrs.Template {
+		args = append(args, "--template")
+	}
 
-	_, err := c.R.Run(ctx, repoPath, c.Bin, args...)
-	return err
+	var plain, follow []string
+	for _, file := range files {
+		info, err := os.Lstat(file)
+		isLink := err == nil && info.Mode()&os.ModeSymlink != 0
+		switch {
+		case attrs.Symlink && !isLink:
+			return fmt.Errorf("symlink attribute requires %s to be a symlink", file)
+		case isLink && !attrs.Symlink:
+			follow = append(follow, file)
+		default:
+			plain = append(plain, file)
+		}
+	}
+
+	if len(plain) > 0 {
+		if _, err := c.R.Run(ctx, repoPath, c.Bin, append(slices.Clone(args), plain...)...); err != nil {
+			return err
+		}
+	}
+	if len(follow) > 0 {
+		followArgs := append(slices.Clone(args), "--follow")
+		if _, err := c.R.Run(ctx, repoPath, c.Bin, append(followArgs, follow...)...); err != nil {
+			return err
+		}
+	}
+
+	if mod := attrs.chattrModifier(); mod != "" {
+		chattr := append(c.baseArgs(repoPath, sourceDir), "chattr", mod)
+		if _, err := c.R.Run(ctx, repoPath, c.Bin, append(chattr, files...)...); err != nil {
+			return fmt.Errorf("chezmoi chattr %s: %w", mod, err)
+		}
+	}
+	return nil
 }
 
 // Managed returns the list of files managed by chezmoi.
 func (c *Chezmoi) Managed(ctx context.Context, repoPath, sourceDir string) ([]string, error) {
-	args := []string{}
-	if sourceDir != "" {
-		args = append(args, "--source", filepath.Join(repoPath, sourceDir))
-	}
+	args := c.baseArgs(repoPath, sourceDir)
 	args = append(args, "managed")
 
 	res, err := c.R.Run(ctx, repoPath, c.Bin, args...)
@@ -104,6 +363,32 @@ func (c *Chezmoi) Managed(ctx context.Context, repoPath, sourceDir string) ([]st
 	return files, nil
 }
 
+// SourcePath returns the absolute source-state path managing target.
+func (c *Chezmoi) SourcePath(ctx context.Context, repoPath, sourceDir, target string) (string, error) {
+	args := c.baseArgs(repoPath, sourceDir)
+	args = append(args, "source-path", target)
+
+	res, err := c.R.Run(ctx, repoPath, c.Bin, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res.Stdout), nil
+}
+
+// Forget stops managing targets: chezmoi removes their source state
+// entries and leaves the destination files in place.
+func (c *Chezmoi) Forget(ctx context.Context, repoPath, sourceDir string, targets ...string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	args := c.baseArgs(repoPath, sourceDir)
+	args = append(args, "forget", "--force")
+	args = append(args, targets...)
+
+	_, err := c.R.Run(ctx, repoPath, c.Bin, args...)
+	return err
+}
+
 // Version returns the chezmoi version.
 func (c *Chezmoi) Version(ctx context.Context) (string, error) {
 	res, err := c.R.Run(ctx, "", c.Bin, "--version")
@@ -113,13 +398,13 @@ func (c *Chezmoi) Version(ctx context.Context) (string, error) {
 	return strings.TrimSpace(res.Stdout), nil
 }
 
-// Diff shows the diff between source and destination.
-func (c *Chezmoi) Diff(ctx context.Context, repoPath, sourceDir string) (string, error) {
-	args := []string{}
-	if sourceDir != "" {
-		args = append(args, "--source", filepath.Join(repoPath, sourceDir))
-	}
+// Diff shows the diff between source and destination, limited to targets
+// when any are given.
+func (c *Chezmoi) Diff(ctx context.Context, repoPath, sourceDir string, targets ...string) (string, error) {
+	args := c.baseArgs(repoPath, sourceDir)
 	args = append(args, "diff")
+	args = append(args, c.filterArgs()...)
+	args = append(args, targets...)
 
 	res, err := c.R.Run(ctx, repoPath, c.Bin, args...)
 	if err != nil {
@@ -127,3 +412,27 @@ func (c *Chezmoi) Diff(ctx context.Context, repoPath, sourceDir string) (string,
 	}
 	return res.Stdout, nil
 }
+
+// baseArgs returns the global flags shared by source-state commands.
+func (c *Chezmoi) baseArgs(repoPath, sourceDir string) []string {
+	args := slices.Clone(c.GlobalArgs)
+	if sourceDir != "" {
+		args = append(args, "--source", filepath.Join(repoPath, sourceDir))
+	}
+	if c.OverrideData != "" && c.supports(func(caps *Capabilities) bool { return caps.OverrideData }, "--override-data", "templates cannot use dotstate's template data") {
+		args = append(args, "--override-data", c.OverrideData)
+	}
+	return args
+}
+
+// filterArgs returns the entry type flags for apply and diff.
+func (c *Chezmoi) filterArgs() []string {
+	var args []string
+	if c.Include != "" {
+		args = append(args, "--include", c.Include)
+	}
+	if c.Exclude != "" {
+		args = append(args, "--exclude", c.Exclude)
+	}
+	return args
+}
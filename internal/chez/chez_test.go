@@ -2,6 +2,10 @@ package chez
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/dnery/dotstate/dot/internal/testutil"
@@ -44,6 +48,10 @@ func TestReAdd(t *testing.T) {
 		testutil.MatchCommandPrefix("chezmoi", "--source", "/repo/home", "re-add"),
 		"",
 	)
+	mock.OnCommandSuccess(
+		testutil.MatchCommandPrefix("chezmoi", "--source", "/repo/home", "diff"),
+		"",
+	)
 
 	c := New("chezmoi", mock)
 	ctx := context.Background()
@@ -56,10 +64,22 @@ func TestReAdd(t *testing.T) {
 	mock.AssertCalled(testutil.MatchCommandPrefix("chezmoi", "--source", "/repo/home", "re-add"))
 }
 
+func TestReAddPassesTargets(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", "/repo/home", "diff", "/home/u/.zshrc"), "")
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", "/repo/home", "re-add", "/home/u/.zshrc"), "")
+
+	if err := New("chezmoi", mock).ReAdd(context.Background(), "/repo", "home", "/home/u/.zshrc"); err != nil {
+		t.Fatalf("ReAdd() error = %v", err)
+	}
+	mock.AssertCalled(testutil.MatchExact("chezmoi", "--source", "/repo/home", "re-add", "/home/u/.zshrc"))
+}
+
 func TestApply(t *testing.T) {
 	tests := []struct {
 		name      string
 		sourceDir string
+		targets   []string
 		wantArgs  []string
 	}{
 		{
@@ -72,6 +92,12 @@ func TestApply(t *testing.T) {
 			sourceDir: "",
 			wantArgs:  []string{"apply"},
 		},
+		{
+			name:      "with targets",
+			sourceDir: "home",
+			targets:   []string{"/home/me/.config/nvim"},
+			wantArgs:  []string{"--source", "/repo/home", "apply", "/home/me/.config/nvim"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -82,7 +108,7 @@ func TestApply(t *testing.T) {
 			c := New("chezmoi", mock)
 			ctx := context.Background()
 
-			err := c.Apply(ctx, "/repo", tt.sourceDir)
+			err := c.Apply(ctx, "/repo", tt.sourceDir, tt.targets...)
 			if err != nil {
 				t.Fatalf("Apply() error = %v", err)
 			}
@@ -96,6 +122,8 @@ func TestApply(t *testing.T) {
 			call := calls[0]
 			if len(call.Args) != len(tt.wantArgs) {
 				t.Errorf("args count = %d, want %d", len(call.Args), len(tt.wantArgs))
+			} else if tt.targets != nil && call.Args[len(call.Args)-1] != tt.targets[0] {
+				t.Errorf("args = %v, want %v", call.Args, tt.wantArgs)
 			}
 		})
 	}
@@ -259,6 +287,25 @@ func TestManaged(t *testing.T) {
 	}
 }
 
+func TestForget(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchExact("chezmoi", "--source", "/repo/home", "forget", "--force", "/home/me/.zshrc", "/home/me/.config/nvim"),
+		"",
+	)
+
+	c := New("chezmoi", mock)
+	if err := c.Forget(context.Background(), "/repo", "home", "/home/me/.zshrc", "/home/me/.config/nvim"); err != nil {
+		t.Fatalf("Forget() error = %v", err)
+	}
+	if err := c.Forget(context.Background(), "/repo", "home"); err != nil {
+		t.Fatalf("Forget() with no targets error = %v", err)
+	}
+	if calls := mock.Calls(); len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+}
+
 func TestManagedEmpty(t *testing.T) {
 	mock := testutil.NewMockRunner(t)
 	mock.OnCommandSuccess(
@@ -321,6 +368,114 @@ func TestDiff(t *testing.T) {
 	}
 }
 
+func TestOverrideDataIsPassedToSourceCommands(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	data := `{"dotstate":{"profile":"work"}}`
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", "/repo/home", "--override-data", data, "apply"), "")
+
+	c := New("chezmoi", mock)
+	c.OverrideData = data
+	if err := c.Apply(context.Background(), "/repo", "home"); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	mock.AssertCalled(testutil.MatchExact("chezmoi", "--source", "/repo/home", "--override-data", data, "apply"))
+}
+
+func TestProbeShimsFlagsForOldChezmoi(t *testing.T) {
+	dir := testutil.TempDir(t)
+	bin := filepath.Join(dir, "chezmoi")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cachePath := filepath.Join(dir, "cache", CapabilitiesCacheFile)
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix(bin), "")
+	mock.OnCommandSuccess(testutil.MatchExact(bin, "--version"), "chezmoi version v2.30.1, commit 0123abc, built at 2023-02-20T00:00:00Z, built by debian\n")
+
+	c := New(bin, mock)
+	var warnings []string
+	c.Warn = func(msg string) { warnings = append(warnings, msg) }
+	c.OverrideData = `{"dotstate":{}}`
+	if err := c.Probe(context.Background(), cachePath); err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if c.Caps.Version != "2.30.1" || c.Caps.Secrets || c.Caps.OverrideData {
+		t.Fatalf("Caps = %+v; want 2.30.1 without --secrets or --override-data", c.Caps)
+	}
+	for range 2 {
+		if err := c.Add(context.Background(), "/repo", "home", []string{"/home/u/.zshrc"}, "error"); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	mock.AssertCalled(testutil.MatchExact(bin, "--source", "/repo/home", "add", "/home/u/.zshrc"))
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "--override-data") || !strings.Contains(warnings[1], "add --secrets") {
+		t.Fatalf("warnings = %q; want one per missing flag", warnings)
+	}
+
+	cached := New(bin, mock)
+	if err := cached.Probe(context.Background(), cachePath); err != nil || cached.Caps.Version != "2.30.1" {
+		t.Fatalf("cached Probe() = %+v, %v", cached.Caps, err)
+	}
+	mock.AssertCallCount(3)
+}
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		output        string
+		version       string
+		secrets, data bool
+	}{
+		{"chezmoi version v2.52.1, commit abc, built at 2024-08-01", "2.52.1", true, true},
+		{"chezmoi version 2.33.0, commit abc", "2.33.0", true, false},
+		{"chezmoi version dev, commit abc", "", true, true},
+	}
+	for _, tt := range tests {
+		caps := ParseCapabilities(tt.output)
+		if caps.Version != tt.version || caps.Secrets != tt.secrets || caps.OverrideData != tt.data {
+			t.Errorf("ParseCapabilities(%q) = %+v", tt.output, caps)
+		}
+	}
+}
+
+func TestIncludeExcludeLimitApplyAndDiff(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("chezmoi"), "")
+
+	c := New("chezmoi", mock)
+	c.Include = "scripts"
+	if err := c.Apply(context.Background(), "/repo", "home"); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	mock.AssertCalled(testutil.MatchExact("chezmoi", "--source", "/repo/home", "apply", "--include", "scripts"))
+
+	c.Include, c.Exclude = "", "scripts"
+	if _, err := c.Diff(context.Background(), "/repo", "home", "/home/u/.zshrc"); err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	mock.AssertCalled(testutil.MatchExact("chezmoi", "--source", "/repo/home", "diff", "--exclude", "scripts", "/home/u/.zshrc"))
+}
+
+func TestApplyReportsProgressFromVerboseOutput(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", "/repo/home", "status"), " A .vimrc\nMM .zshrc\n D .oldrc\n R setup.sh\n")
+	verbose := "diff --git a/.vimrc b/.vimrc\nnew file mode 100644\n--- /dev/null\n+++ b/.vimrc\n@@ -0,0 +1 @@\n+set nu\n" +
+		"diff --git a/.zshrc b/.zshrc\n--- a/.zshrc\n+++ b/.zshrc\n@@ -1 +1 @@\n-a\n+b\n"
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", "/repo/home", "apply", "--verbose"), verbose)
+
+	c := New("chezmoi", mock)
+	var got []string
+	c.Progress = func(p FileProgress) {
+		got = append(got, fmt.Sprintf("%d/%d %s %s", p.Done, p.Total, p.Action, p.Path))
+	}
+	if err := c.Apply(context.Background(), "/repo", "home"); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want := "1/3 created .vimrc,2/3 modified .zshrc,3/3 skipped .oldrc"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("progress = %q, want %q", got, want)
+	}
+}
+
 func containsString(s, substr string) bool {
 	for i := 0; i <= len(s)-len(substr); i++ {
 		if s[i:i+len(substr)] == substr {
@@ -329,3 +484,111 @@ func containsString(s, substr string) bool {
 	}
 	return false
 }
+
+func TestReAddCapturesModeOnlyChanges(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchCommandPrefix("chezmoi", "--source", "/repo/home", "diff"),
+		"diff --git a/bin/run b/bin/run\nold mode 100755\nnew mode 100644\n"+
+			"diff --git a/.zshrc b/.zshrc\nold mode 100644\nnew mode 100755\n"+
+			"diff --git a/.vimrc b/.vimrc\n--- a/.vimrc\n+++ b/.vimrc\n@@ -1 +1 @@\n-a\n+b\n",
+	)
+	mock.SetFallback("", "", 0)
+
+	c := New("chezmoi", mock)
+	c.DestDir = "/home/me"
+	if err := c.ReAdd(context.Background(), "/repo", "home"); err != nil {
+		t.Fatalf("ReAdd() error = %v", err)
+	}
+
+	var got []string
+	for _, call := range mock.Calls() {
+		got = append(got, strings.Join(call.Args, " "))
+	}
+	want := []string{
+		"--source /repo/home diff",
+		"--source /repo/home chattr +executable /home/me/bin/run",
+		"--source /repo/home chattr noexecutable /home/me/.zshrc",
+		"--source /repo/home re-add",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("calls =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAddWithAttributes(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.SetFallback("", "", 0)
+
+	dir := t.TempDir()
+	file := testutil.TempFile(t, dir, "dot_real", "x\n")
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(file, link); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	c := New("chezmoi", mock)
+	attrs := Attributes{Private: true, ReadOnly: true, Create: true}
+	if err := c.AddWithAttributes(context.Background(), "/repo", "home", []string{file, link}, "ignore", attrs); err != nil {
+		t.Fatalf("AddWithAttributes() error = %v", err)
+	}
+
+	calls := mock.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 calls, got %v", calls)
+	}
+	want := []string{
+		"--source /repo/home add --create " + file,
+		"--source /repo/home add --create --follow " + link,
+		"--source /repo/home chattr +private,+readonly " + file + " " + link,
+	}
+	for i, call := range calls {
+		if got := strings.Join(call.Args, " "); got != want[i] {
+			t.Errorf("call %d args = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestAddWithTemplateAttribute(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.SetFallback("", "", 0)
+
+	file := testutil.TempFile(t, t.TempDir(), "dot_netrc", "x\n")
+	c := New("chezmoi", mock)
+	if err := c.AddWithAttributes(context.Background(), "/repo", "home", []string{file}, "warning", Attributes{Template: true}); err != nil {
+		t.Fatalf("AddWithAttributes() error = %v", err)
+	}
+	want := "--source /repo/home add --secrets=warning --template " + file
+	if got := strings.Join(mock.LastCall().Args, " "); got != want {
+		t.Fatalf("args = %q, want %q", got, want)
+	}
+}
+
+func TestAddWithSymlinkAttributeRequiresSymlink(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.SetFallback("", "", 0)
+
+	file := testutil.TempFile(t, t.TempDir(), "plain", "x\n")
+	c := New("chezmoi", mock)
+	err := c.AddWithAttributes(context.Background(), "/repo", "home", []string{file}, "ignore", Attributes{Symlink: true})
+	if err == nil || !strings.Contains(err.Error(), "symlink") {
+		t.Fatalf("AddWithAttributes() error = %v, want symlink error", err)
+	}
+	mock.AssertCallCount(0)
+}
+
+func TestParseAttributes(t *testing.T) {
+	attrs, err := ParseAttributes(" readonly , private ")
+	if err != nil {
+		t.Fatalf("ParseAttributes() error = %v", err)
+	}
+	if attrs.String() != "private,readonly" {
+		t.Errorf("String() = %q, want private,readonly", attrs.String())
+	}
+	if attrs, _ := ParseAttributes("none"); !attrs.IsZero() {
+		t.Errorf("ParseAttributes(none) = %+v, want zero", attrs)
+	}
+	if _, err := ParseAttributes("exact"); err == nil {
+		t.Error("ParseAttributes(exact) should fail")
+	}
+}
@@ -0,0 +1,104 @@
+package chez
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Target entry types.
+const (
+	TargetFile    = "file"
+	TargetDir     = "dir"
+	TargetSymlink = "symlink"
+)
+
+// TargetEntry is one entry of the target state: what apply would leave in
+// the destination directory.
+type TargetEntry struct {
+	// Path is slash-separated and relative to the destination directory.
+	Path string
+	Type string
+	// Perm is a file's or directory's permissions after the umask.
+	Perm fs.FileMode
+	// Contents is a file's contents or a symlink's destination.
+	Contents []byte
+}
+
+// Verifier is implemented by engines that can describe their whole target
+// state, which dot verify checksums against the destination.
+type Verifier interface {
+	TargetState(ctx context.Context, repoPath, sourceDir string, targets ...string) ([]TargetEntry, error)
+}
+
+var _ Verifier = (*Chezmoi)(nil)
+
+// Verify runs chezmoi verify, limited to targets when any are given. It
+// reports false when the destination differs from the target state, which
+// chezmoi signals with exit code 1.
+func (c *Chezmoi) Verify(ctx context.Context, repoPath, sourceDir string, targets ...string) (bool, error) {
+	args := c.baseArgs(repoPath, sourceDir)
+	args = append(args, "verify")
+	args = append(args, c.filterArgs()...)
+	args = append(args, targets...)
+
+	res, err := c.R.Run(ctx, repoPath, c.Bin, args...)
+	if err != nil {
+		if res != nil && res.Code == 1 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// dumpEntry is one value of chezmoi dump --format json.
+type dumpEntry struct {
+	Type     string `json:"type"`
+	Contents string `json:"contents"`
+	Linkname string `json:"linkname"`
+	Perm     uint32 `json:"perm"`
+}
+
+// TargetState reads the target state from chezmoi dump, limited to targets
+// when any are given and honoring Include and Exclude. Scripts and other
+// entries without a destination are left out.
+func (c *Chezmoi) TargetState(ctx context.Context, repoPath, sourceDir string, targets ...string) ([]TargetEntry, error) {
+	args := c.baseArgs(repoPath, sourceDir)
+	args = append(args, "dump", "--format", "json")
+	args = append(args, c.filterArgs()...)
+	args = append(args, targets...)
+
+	res, err := c.R.Run(ctx, repoPath, c.Bin, args...)
+	if err != nil {
+		return nil, err
+	}
+	if res.StdoutSpill != "" {
+		return nil, fmt.Errorf("chezmoi dump output is larger than [tools] max_output")
+	}
+	var dump map[string]dumpEntry
+	if err := json.Unmarshal([]byte(res.Stdout), &dump); err != nil {
+		return nil, fmt.Errorf("parse chezmoi dump: %w", err)
+	}
+
+	entries := make([]TargetEntry, 0, len(dump))
+	for path, d := range dump {
+		ent := TargetEntry{Path: filepath.ToSlash(path), Type: d.Type, Perm: fs.FileMode(d.Perm).Perm()}
+		switch d.Type {
+		case TargetFile:
+			ent.Contents = []byte(d.Contents)
+		case TargetSymlink:
+			ent.Contents = []byte(d.Linkname)
+		case TargetDir:
+		default:
+			continue
+		}
+		entries = append(entries, ent)
+	}
+	slices.SortFunc(entries, func(a, b TargetEntry) int { return strings.Compare(a.Path, b.Path) })
+	return entries, nil
+}
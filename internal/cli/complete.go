@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/provision"
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+// managedCacheTTL bounds how long a cached `chezmoi managed` listing is
+// reused for shell completion.
+const managedCacheTTL = 5 * time.Minute
+
+// managedCompletionTimeout keeps a slow engine from stalling the shell.
+const managedCompletionTimeout = 5 * time.Second
+
+// cmdCompletion replaces cobra's default completion command with one that
+// takes the shell as an argument and documents how to install the script.
+func cmdCompletion() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate a shell completion script",
+		Long: `Print a completion script for the given shell. Besides commands and
+flags, it completes managed file paths for dot edit, dot forget, dot diff,
+and --only, from a listing cached for five minutes.
+
+  bash:       source <(dot completion bash)
+              (add to ~/.bashrc; needs the bash-completion package)
+  zsh:        dot completion zsh > "${fpath[1]}/_dot"
+  fish:       dot completion fish > ~/.config/fish/completions/dot.fish
+  powershell: dot completion powershell | Out-String | Invoke-Expression
+              (add to $PROFILE)`,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, out := cmd.Root(), cmd.OutOrStdout()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(out, true)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(out)
+			}
+			return fmt.Errorf("unsupported shell %q", args[0])
+		},
+	}
+}
+
+// completeManagedPaths completes home-relative managed paths, the form
+// --only and other path arguments accept. A "~/" prefix is preserved.
+func (a *app) completeManagedPaths(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, _, err := a.loadConfigSilent()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	paths, err := a.managedPaths(cmd.Context(), cfg)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	prefix := ""
+	if rest, ok := strings.CutPrefix(toComplete, "~/"); ok {
+		prefix, toComplete = "~/", rest
+	}
+	var out []string
+	for _, p := range paths {
+		if strings.HasPrefix(p, toComplete) {
+			out = append(out, prefix+p)
+		}
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp
+}
+
+// managedPaths returns the engine's managed paths, reusing a cached listing
+// while it is younger than managedCacheTTL and no entry has been added to
+// or removed from the top of the source dir since.
+func (a *app) managedPaths(ctx context.Context, cfg *config.Config) ([]string, error) {
+	sum := sha256.Sum256([]byte(cfg.SourcePath()))
+	cachePath := filepath.Join(a.plat.CacheDir, "dotstate", "managed-"+hex.EncodeToString(sum[:8])+".txt")
+	if paths, ok := readManagedCache(cachePath, cfg.SourcePath(), time.Now()); ok {
+		return paths, nil
+	}
+
+	if cfg.Chex.Engine != config.EngineNative {
+		// Completion must never download chezmoi; use whatever is present.
+		res, err := a.provisioner().ResolveChezmoi(ctx, provision.ResolveOptions{
+			Configured: cfg.Tools.Chezmoi,
+			Pinned:     cfg.Tools.ChezmoiVersion,
+			LookPath:   exec.LookPath,
+			Offline:    true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		cfg.Tools.Chezmoi = res.Path
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, managedCompletionTimeout)
+	defer cancel()
+	paths, err := newEngine(cfg, a.plat, runner.New()).Managed(ctx, cfg.Repo.Path, cfg.Chex.SourceDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o700); err == nil {
+		_ = os.WriteFile(cachePath, []byte(strings.Join(paths, "\n")+"\n"), 0o600)
+	}
+	return paths, nil
+}
+
+// readManagedCache returns the cached listing if it is fresh: younger than
+// managedCacheTTL at now and not older than sourceDir's last change.
+func readManagedCache(cachePath, sourceDir string, now time.Time) ([]string, bool) {
+	info, err := os.Stat(cachePath)
+	if err != nil || now.Sub(info.ModTime()) > managedCacheTTL {
+		return nil, false
+	}
+	if src, err := os.Stat(sourceDir); err == nil && src.ModTime().After(info.ModTime()) {
+		return nil, false
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, false
+	}
+	b, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, false
+	}
+	var paths []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, true
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+func TestCompleteManagedPathsUsesCache(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, "home"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfgPath := filepath.Join(repo, "dot.toml")
+	if err := os.WriteFile(cfgPath, []byte("[repo]\npath = \""+repo+"\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Age the source dir so the cache written below is newer.
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(repo, "home"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheDir := filepath.Join(dir, "cache")
+	sum := sha256.Sum256([]byte(filepath.Join(repo, "home")))
+	cachePath := filepath.Join(cacheDir, "dotstate", "managed-"+hex.EncodeToString(sum[:8])+".txt")
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cachePath, []byte(".zshrc\n.config/nvim/init.lua\n.config/git/config\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &app{cfgPath: cfgPath, plat: &platform.Platform{Home: dir, CacheDir: cacheDir}}
+	cmd := &cobra.Command{}
+
+	got, directive := a.completeManagedPaths(cmd, nil, ".config/")
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("directive = %v", directive)
+	}
+	if want := []string{".config/nvim/init.lua", ".config/git/config"}; !slices.Equal(got, want) {
+		t.Errorf("completions = %v, want %v", got, want)
+	}
+
+	got, _ = a.completeManagedPaths(cmd, nil, "~/.z")
+	if want := []string{"~/.zshrc"}; !slices.Equal(got, want) {
+		t.Errorf("completions = %v, want %v", got, want)
+	}
+}
+
+func TestReadManagedCacheExpires(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "managed.txt")
+	if err := os.WriteFile(cachePath, []byte(".zshrc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missingSource := filepath.Join(dir, "missing")
+
+	if paths, ok := readManagedCache(cachePath, missingSource, time.Now()); !ok || len(paths) != 1 {
+		t.Fatalf("fresh cache = %v, %v", paths, ok)
+	}
+	if _, ok := readManagedCache(cachePath, missingSource, time.Now().Add(managedCacheTTL+time.Minute)); ok {
+		t.Fatal("expired cache was reused")
+	}
+
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(dir, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readManagedCache(cachePath, dir, time.Now()); ok {
+		t.Fatal("cache older than the source dir was reused")
+	}
+}
+
+func TestCompletionGeneratesScriptsWithManagedPathCompletion(t *testing.T) {
+	a := &app{plat: &platform.Platform{}}
+	root := &cobra.Command{Use: "dot"}
+	root.AddCommand(cmdCompletion(), cmdDiff(a), cmdEdit(a), cmdForget(a))
+	for _, name := range []string{"diff", "edit", "forget"} {
+		sub, _, err := root.Find([]string{name})
+		if err != nil || sub.ValidArgsFunction == nil {
+			t.Errorf("dot %s has no path completion (err = %v)", name, err)
+		}
+	}
+
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		out := &bytes.Buffer{}
+		root.SetOut(out)
+		root.SetArgs([]string{"completion", shell})
+		if err := root.Execute(); err != nil {
+			t.Fatalf("completion %s error = %v", shell, err)
+		}
+		if !strings.Contains(out.String(), "__complete") {
+			t.Errorf("%s script does not call back into dot for dynamic completion", shell)
+		}
+	}
+
+	root.SetArgs([]string{"completion", "tcsh"})
+	root.SetErr(&bytes.Buffer{})
+	if err := root.Execute(); err == nil {
+		t.Error("completion accepted an unsupported shell")
+	}
+}
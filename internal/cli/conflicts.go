@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/redact"
+	"github.com/dnery/dotstate/dot/internal/sync"
+	"github.com/dnery/dotstate/dot/internal/ui"
+)
+
+// conflictPrompter walks the user through the conflicts of a stopped
+// rebase one file at a time. It speaks from this machine's point of view:
+// "ours" is the local commit being replayed, which git calls "theirs"
+// during a rebase, and "theirs" is the remote.
+type conflictPrompter struct {
+	git  *gitx.Git
+	repo string
+	in   *bufio.Scanner
+	out  io.Writer
+	// edit opens a file in the user's editor and waits for it to close.
+	edit func(ctx context.Context, path string) error
+}
+
+func newConflictPrompter(g *gitx.Git, repo string) *conflictPrompter {
+	return &conflictPrompter{git: g, repo: repo, in: bufio.NewScanner(os.Stdin), out: os.Stdout, edit: runEditor}
+}
+
+// resolve settles and stages every path, or returns sync.ErrConflictAborted
+// when the user aborts or input ends.
+func (p *conflictPrompter) resolve(ctx context.Context, paths []string) error {
+	conflicts, err := p.git.Conflicts(ctx, p.repo)
+	if err != nil {
+		return fmt.Errorf("list conflicts: %w", err)
+	}
+	codes := map[string]string{}
+	for _, c := range conflicts {
+		codes[c.Path] = c.Code
+	}
+	fmt.Fprintln(p.out, ui.Title("Sync conflicts"))
+	fmt.Fprintf(p.out, "  Pulling stopped on %d file(s) changed both here and on the remote:\n", len(paths))
+	for _, path := range paths {
+		fmt.Fprintf(p.out, "    %s (%s)\n", redact.Text(path), describeConflict(codes[path]))
+	}
+	for _, path := range paths {
+		if err := p.resolveFile(ctx, gitx.Conflict{Path: path, Code: codes[path]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *conflictPrompter) resolveFile(ctx context.Context, c gitx.Conflict) error {
+	for {
+		fmt.Fprintf(p.out, "%s: keep [o]urs (this machine), [t]heirs (remote), [e]dit, or [a]bort the sync? ", redact.Text(c.Path))
+		if !p.in.Scan() {
+			fmt.Fprintln(p.out)
+			return sync.ErrConflictAborted
+		}
+		switch strings.ToLower(strings.TrimSpace(p.in.Text())) {
+		case "o", "ours":
+			return p.take(ctx, c, "theirs")
+		case "t", "theirs":
+			return p.take(ctx, c, "ours")
+		case "e", "edit":
+			done, err := p.merge(ctx, c)
+			if err != nil {
+				fmt.Fprintf(p.out, "  %s\n", redact.Text(err.Error()))
+			}
+			if done {
+				return nil
+			}
+		case "a", "abort":
+			return sync.ErrConflictAborted
+		default:
+			fmt.Fprintln(p.out, "  Answer o, t, e, or a.")
+		}
+	}
+}
+
+// take resolves c with one side, in git's rebase terms; a side that
+// deleted the file resolves it as deleted.
+func (p *conflictPrompter) take(ctx context.Context, c gitx.Conflict, side string) error {
+	if c.Deleted(side) {
+		return p.git.RemoveConflicted(ctx, p.repo, c.Path)
+	}
+	return p.git.CheckoutConflictSide(ctx, p.repo, side, c.Path)
+}
+
+// merge opens the file, conflict markers and all, in the editor and stages
+// it once the markers are gone. It reports false, leaving the file
+// unstaged, while markers remain or on error, so the user can choose again.
+func (p *conflictPrompter) merge(ctx context.Context, c gitx.Conflict) (bool, error) {
+	full := filepath.Join(p.repo, filepath.FromSlash(c.Path))
+	if err := p.edit(ctx, full); err != nil {
+		return false, err
+	}
+	b, err := os.ReadFile(full)
+	if err != nil {
+		return false, err
+	}
+	if hasConflictMarkers(b) {
+		fmt.Fprintln(p.out, "  The file still has conflict markers.")
+		return false, nil
+	}
+	if err := p.git.Add(ctx, p.repo, "--", c.Path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func hasConflictMarkers(b []byte) bool {
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("<<<<<<< ")) || bytes.HasPrefix(line, []byte(">>>>>>> ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeConflict explains a porcelain conflict code from this machine's
+// point of view during a rebase, where git's "us" is the remote.
+func describeConflict(code string) string {
+	switch code {
+	case "DU":
+		return "deleted on the remote, changed here"
+	case "UD":
+		return "changed on the remote, deleted here"
+	case "AA":
+		return "added on both sides"
+	case "DD":
+		return "deleted on both sides"
+	case "AU", "UA":
+		return "added on one side, changed on the other"
+	}
+	return "changed on both sides"
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/sync"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestConflictPrompterResolvesFilesFromThisMachinesPointOfView(t *testing.T) {
+	ctx := context.Background()
+	local := testutil.NewFakeRepo(t)
+	other := local.Clone()
+	other.WriteFile("home/dot_zshrc", "remote zsh\n")
+	other.WriteFile("home/dot_vimrc", "remote vim\n")
+	other.Commit("remote edits")
+	other.Push()
+	local.WriteFile("home/dot_zshrc", "local zsh\n")
+	local.WriteFile("home/dot_vimrc", "local vim\n")
+	local.Commit("local edits")
+	g := gitx.New("git", nil)
+	if err := g.PullRebase(ctx, local.Root); err == nil {
+		t.Fatal("pull --rebase succeeded, want conflicts")
+	}
+
+	p := &conflictPrompter{
+		git:  g,
+		repo: local.Root,
+		in:   bufio.NewScanner(strings.NewReader("x\ne\ne\no\n")),
+		out:  io.Discard,
+	}
+	edits := 0
+	p.edit = func(_ context.Context, path string) error {
+		edits++
+		if edits == 1 {
+			return nil // left the markers in; the user is asked again
+		}
+		return os.WriteFile(path, []byte("merged vim\n"), 0o644)
+	}
+	if err := p.resolve(ctx, []string{"home/dot_vimrc", "home/dot_zshrc"}); err != nil {
+		t.Fatalf("resolve() error = %v", err)
+	}
+	if got := local.Git("show", ":home/dot_vimrc"); got != "merged vim" {
+		t.Errorf("staged vimrc = %q, want the edited merge", got)
+	}
+	if got := local.Git("show", ":home/dot_zshrc"); got != "local zsh" {
+		t.Errorf("staged zshrc = %q, want this machine's side", got)
+	}
+
+	p.in = bufio.NewScanner(strings.NewReader(""))
+	if err := p.resolve(ctx, []string{"home/dot_zshrc"}); !errors.Is(err, sync.ErrConflictAborted) {
+		t.Fatalf("resolve() at end of input error = %v, want ErrConflictAborted", err)
+	}
+}
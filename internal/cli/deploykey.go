@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	doterrors "github.com/dnery/dotstate/dot/internal/errors"
+	"github.com/dnery/dotstate/dot/internal/forge"
+	"github.com/dnery/dotstate/dot/internal/platform"
+	"github.com/dnery/dotstate/dot/internal/redact"
+	"github.com/dnery/dotstate/dot/internal/runner"
+	"github.com/dnery/dotstate/dot/internal/ui"
+)
+
+// deployKeyName is the key dot bootstrap --deploy-key keeps under ~/.ssh.
+const deployKeyName = "dotstate_deploy_ed25519"
+
+// setupDeployKey makes sure this machine has a deploy key and returns the
+// ssh command that authenticates with it. A new key is printed for the
+// user to add to the git host; an interactive bootstrap waits for that,
+// and a non-interactive one stops so it can be rerun once the key is added.
+func (a *app) setupDeployKey(ctx context.Context, cfg *config.Config) (string, error) {
+	if !isSSHRemote(cfg.Repo.URL) {
+		return "", doterrors.NewUserError("--deploy-key needs an SSH repo URL, e.g. git@github.com:you/dotfiles.git")
+	}
+	path := filepath.Join(a.plat.SSHDir(), deployKeyName)
+	pub, created, err := ensureDeployKey(ctx, runner.New(), path, "dotstate@"+platform.Hostname())
+	if err != nil {
+		return "", doterrors.Wrap(err, "generate deploy key")
+	}
+	command := sshCommand(path)
+	if !created {
+		ui.Out.Printf("Using deploy key %s\n", redact.Text(path))
+		return command, nil
+	}
+
+	ui.Out.Title("Deploy key")
+	ui.Out.Printf("  Generated %s. Add this public key to the repo as a deploy key with write access:\n\n", redact.Text(path))
+	ui.Out.Println(pub)
+	ui.Out.Println()
+	if page := deployKeysPage(cfg.Repo.URL); page != "" {
+		ui.Out.Printf("  Deploy keys: %s\n\n", redact.Text(page))
+	}
+	if !ui.IsTerminal(os.Stdin) {
+		return "", doterrors.NewUserError("add the deploy key to the git host, then rerun dot bootstrap --deploy-key")
+	}
+	ui.Out.Print("Press Enter once the key is added... ")
+	bufio.NewScanner(os.Stdin).Scan()
+	return command, nil
+}
+
+// ensureDeployKey generates a passphrase-less ed25519 key at path unless
+// one exists, and returns its public half.
+func ensureDeployKey(ctx context.Context, r runner.Runner, path, comment string) (pub string, created bool, err error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return "", false, err
+		}
+		if _, err := r.Run(ctx, "", "ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", comment, "-f", path); err != nil {
+			return "", false, err
+		}
+		created = true
+	} else if err != nil {
+		return "", false, err
+	}
+	b, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		return "", created, err
+	}
+	return strings.TrimSpace(string(b)), created, nil
+}
+
+// sshCommand is the core.sshCommand that makes git use only the key at
+// path.
+func sshCommand(path string) string {
+	path = filepath.ToSlash(path)
+	if strings.ContainsAny(path, " '") {
+		path = "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+	}
+	return "ssh -i " + path + " -o IdentitiesOnly=yes"
+}
+
+// isSSHRemote reports whether remote is an ssh:// or scp-like
+// (git@host:path) git URL.
+func isSSHRemote(remote string) bool {
+	if scheme, _, ok := strings.Cut(remote, "://"); ok {
+		return scheme == "ssh" || scheme == "git+ssh"
+	}
+	userHost, _, ok := strings.Cut(remote, ":")
+	return ok && strings.Contains(userHost, "@")
+}
+
+// deployKeysPage returns where GitHub and GitLab list a project's deploy
+// keys, or "" for other hosts.
+func deployKeysPage(remote string) string {
+	host, project, err := forge.ParseRemote(remote)
+	if err != nil || project == "" {
+		return ""
+	}
+	switch host {
+	case "github.com":
+		return fmt.Sprintf("https://github.com/%s/settings/keys", project)
+	case "gitlab.com":
+		return fmt.Sprintf("https://gitlab.com/%s/-/settings/repository#js-deploy-keys-settings", project)
+	}
+	return ""
+}
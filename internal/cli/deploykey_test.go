@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+func TestEnsureDeployKeyGeneratesOnce(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	path := filepath.Join(t.TempDir(), ".ssh", deployKeyName)
+	pub, created, err := ensureDeployKey(context.Background(), runner.New(), path, "dotstate@test-host")
+	if err != nil || !created {
+		t.Fatalf("ensureDeployKey() = %v, %v", created, err)
+	}
+	if !strings.HasPrefix(pub, "ssh-ed25519 ") || !strings.HasSuffix(pub, " dotstate@test-host") {
+		t.Fatalf("public key = %q", pub)
+	}
+	again, created, err := ensureDeployKey(context.Background(), runner.New(), path, "dotstate@test-host")
+	if err != nil || created || again != pub {
+		t.Fatalf("second ensureDeployKey() = %q, %v, %v; want the existing key", again, created, err)
+	}
+}
+
+func TestDeployKeyHelpers(t *testing.T) {
+	for remote, want := range map[string]bool{
+		"git@github.com:you/dotfiles.git":       true,
+		"ssh://git@example.com/you/dotfiles":    true,
+		"https://github.com/you/dotfiles.git":   false,
+		"/srv/git/dotfiles.git":                 false,
+		"https://user@example.com/dotfiles.git": false,
+	} {
+		if got := isSSHRemote(remote); got != want {
+			t.Errorf("isSSHRemote(%q) = %v, want %v", remote, got, want)
+		}
+	}
+	if got := sshCommand("/home/me/.ssh/key"); got != "ssh -i /home/me/.ssh/key -o IdentitiesOnly=yes" {
+		t.Errorf("sshCommand = %q", got)
+	}
+	if got := sshCommand("/Users/Me Too/.ssh/key"); got != "ssh -i '/Users/Me Too/.ssh/key' -o IdentitiesOnly=yes" {
+		t.Errorf("sshCommand with a space = %q", got)
+	}
+	if got := deployKeysPage("git@github.com:you/dotfiles.git"); got != "https://github.com/you/dotfiles/settings/keys" {
+		t.Errorf("deployKeysPage = %q", got)
+	}
+}
+
+func TestOnboardRunsStepsInOrderAndStopsOnFailure(t *testing.T) {
+	var ran []string
+	root := &cobra.Command{Use: "dot"}
+	step := func(use string, err error) *cobra.Command {
+		return &cobra.Command{Use: use, RunE: func(cmd *cobra.Command, args []string) error {
+			ran = append(ran, cmd.CommandPath())
+			return err
+		}}
+	}
+	packages := &cobra.Command{Use: "packages"}
+	packages.AddCommand(step("apply", errors.New("brew missing")))
+	schedule := &cobra.Command{Use: "schedule"}
+	schedule.AddCommand(step("install", nil))
+	root.AddCommand(step("doctor", nil), step("apply", nil), packages, schedule)
+
+	a := &app{cfgPath: filepath.Join(t.TempDir(), "dot.toml")}
+	if err := a.onboard(context.Background(), root, bootstrapOptions{apply: true}); err != nil {
+		t.Fatalf("onboard(--apply) error = %v", err)
+	}
+	if got := strings.Join(ran, ","); got != "dot doctor,dot apply" {
+		t.Fatalf("--apply ran %s", got)
+	}
+
+	ran = nil
+	err := a.onboard(context.Background(), root, bootstrapOptions{apply: true, full: true})
+	if got := strings.Join(ran, ","); got != "dot doctor,dot apply,dot packages apply" {
+		t.Fatalf("--full ran %s", got)
+	}
+	if err == nil || !strings.Contains(err.Error(), "run: dot packages apply, dot schedule install") {
+		t.Fatalf("onboard(--full) error = %v, want the remaining steps", err)
+	}
+}
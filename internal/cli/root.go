@@ -2,33 +2,63 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/dnery/dotstate/dot/internal/agex"
+	"github.com/dnery/dotstate/dot/internal/bootscript"
+	"github.com/dnery/dotstate/dot/internal/bundle"
 	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/compact"
 	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/daemon"
+	"github.com/dnery/dotstate/dot/internal/diffstat"
 	"github.com/dnery/dotstate/dot/internal/discover"
+	"github.com/dnery/dotstate/dot/internal/drift"
 	doterrors "github.com/dnery/dotstate/dot/internal/errors"
+	"github.com/dnery/dotstate/dot/internal/exporters"
+	"github.com/dnery/dotstate/dot/internal/forge"
 	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/health"
+	"github.com/dnery/dotstate/dot/internal/i18n"
 	"github.com/dnery/dotstate/dot/internal/logging"
+	"github.com/dnery/dotstate/dot/internal/machine"
 	"github.com/dnery/dotstate/dot/internal/macos"
+	"github.com/dnery/dotstate/dot/internal/migrate"
 	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/native"
+	"github.com/dnery/dotstate/dot/internal/packages"
 	"github.com/dnery/dotstate/dot/internal/platform"
+	"github.com/dnery/dotstate/dot/internal/provision"
+	"github.com/dnery/dotstate/dot/internal/purge"
 	"github.com/dnery/dotstate/dot/internal/redact"
+	"github.com/dnery/dotstate/dot/internal/reposize"
 	"github.com/dnery/dotstate/dot/internal/runner"
 	"github.com/dnery/dotstate/dot/internal/schedule"
+	"github.com/dnery/dotstate/dot/internal/secretaudit"
+	"github.com/dnery/dotstate/dot/internal/selftest"
+	"github.com/dnery/dotstate/dot/internal/supportbundle"
 	"github.com/dnery/dotstate/dot/internal/sync"
+	"github.com/dnery/dotstate/dot/internal/telemetry"
+	"github.com/dnery/dotstate/dot/internal/tmpldata"
 	"github.com/dnery/dotstate/dot/internal/ui"
+	"github.com/dnery/dotstate/dot/internal/watch"
 )
 
 var (
@@ -41,6 +71,14 @@ type app struct {
 	cfgPath string
 	repoDir string
 	verbose bool
+	// json and dryRun are the root --json and --dry-run flags. Commands
+	// that support either define their own flag of the same name, which
+	// shadows the root one, so these are only set for commands without.
+	json   bool
+	dryRun bool
+	// quiet and noColor are the root --quiet and --no-color flags.
+	quiet   bool
+	noColor bool
 	logger  *logging.Logger
 	plat    *platform.Platform
 }
@@ -62,11 +100,25 @@ func Execute() int {
 		Short: "dotstate orchestrator",
 		Long:  "Cross-platform OS state orchestration for config management.",
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			ui.Out.Quiet = a.quiet
+			ui.SetColor(ui.ColorEnabled(os.Stdout, a.noColor, os.Getenv))
+			if a.json {
+				return doterrors.NewUserError(cmd.CommandPath() + " has no JSON output")
+			}
+			if a.dryRun {
+				return doterrors.NewUserError(cmd.CommandPath() + " has no dry-run mode")
+			}
+
 			// Initialize logger based on verbose flag
 			logCfg := logging.Config{
 				Verbose:  a.verbose,
 				LogLevel: logging.LevelInfo,
 			}
+			// Verbose runs also keep debug records, including every
+			// external command's output, in the log file.
+			if a.verbose {
+				logCfg.LogLevel = logging.LevelDebug
+			}
 
 			// If we can load config, use its log path
 			if cfg, _, err := a.loadConfigSilent(); err == nil {
@@ -79,6 +131,9 @@ func Execute() int {
 				logger = logging.NewNoop()
 			}
 			a.logger = logger
+			if a.verbose {
+				runner.Logger = logger.Slog()
+			}
 
 			return nil
 		},
@@ -94,48 +149,180 @@ func Execute() int {
 	root.PersistentFlags().StringVar(&a.cfgPath, "config", "", "Path to dot.toml (defaults to searching upward from current dir)")
 	root.PersistentFlags().StringVar(&a.repoDir, "repo-dir", "", "Repo directory override (defaults to repo.path from config)")
 	root.PersistentFlags().BoolVarP(&a.verbose, "verbose", "v", false, "Enable verbose output")
+	root.PersistentFlags().BoolVarP(&a.quiet, "quiet", "q", false, "Print only results, warnings, and errors: no headings, hints, or progress")
+	root.PersistentFlags().BoolVar(&a.noColor, "no-color", false, "Disable styled output (also set by NO_COLOR or CLICOLOR=0)")
+	root.PersistentFlags().BoolVar(&a.json, "json", false, "Emit machine-readable JSON instead of text")
+	root.PersistentFlags().BoolVar(&a.dryRun, "dry-run", false, "Print what would change, and the commands that would run, without changing anything")
 
 	root.AddCommand(cmdVersion())
+	root.AddCommand(cmdSelfUpdate(a))
+	root.AddCommand(cmdCompletion())
 	root.AddCommand(cmdDoctor(a))
+	root.AddCommand(cmdConfig(a))
+	root.AddCommand(cmdSelftest(a))
+	root.AddCommand(cmdInit(a))
 	root.AddCommand(cmdBootstrap(a))
+	root.AddCommand(cmdImport(a))
 	root.AddCommand(cmdApply(a))
+	root.AddCommand(cmdDiff(a))
+	root.AddCommand(cmdEdit(a))
+	root.AddCommand(cmdForget(a))
+	root.AddCommand(cmdPrune(a))
+	root.AddCommand(cmdStatus(a))
+	root.AddCommand(cmdList(a))
+	root.AddCommand(cmdVerify(a))
 	root.AddCommand(cmdCapture(a))
 	root.AddCommand(cmdSync(a))
+	root.AddCommand(cmdUndo(a))
+	root.AddCommand(cmdRollback(a))
+	root.AddCommand(cmdLog(a))
+	root.AddCommand(cmdTemplates(a))
+	root.AddCommand(cmdExport(a))
 	root.AddCommand(cmdMacOS(a))
+	root.AddCommand(cmdPackages(a))
+	root.AddCommand(cmdMachine(a))
+	root.AddCommand(cmdDrift(a))
 	root.AddCommand(cmdSchedule(a))
+	root.AddCommand(cmdPurge(a))
+	root.AddCommand(cmdDaemon(a))
+	root.AddCommand(cmdWatch(a))
 	root.AddCommand(cmdDiscover(a))
+	root.AddCommand(cmdScan(a))
+	root.AddCommand(cmdSecrets(a))
 	root.AddCommand(cmdSubrepo(a))
+	root.AddCommand(cmdRepo(a))
+	root.AddCommand(cmdTelemetry(a))
+	root.AddCommand(cmdSupportBundle(a))
+	root.AddCommand(cmdExec(a))
+	root.AddCommand(cmdPath(a))
+	root.AddCommand(cmdForge(a))
 
-	if err := root.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return doterrors.Exit(err)
+	cmd, err := root.ExecuteC()
+	code := doterrors.Exit(err)
+	a.recordTelemetry(cmd, code)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, i18n.T("cli.error")+"\n", err)
+		return code
 	}
 	return doterrors.ExitOK
 }
 
+// recordTelemetry counts the invocation when the user has opted in. It is
+// best-effort: failures never affect the command's result.
+func (a *app) recordTelemetry(cmd *cobra.Command, code int) {
+	if cmd == nil {
+		return
+	}
+	path := telemetry.Path(a.plat)
+	state, err := telemetry.Load(path)
+	if err != nil {
+		return
+	}
+	command := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	if command == cmd.Root().Name() || strings.HasPrefix(command, "telemetry") {
+		return
+	}
+	if state.Record(telemetry.Event{Command: command, OS: a.plat.OS, ExitCode: code}) {
+		_ = state.Save(path)
+	}
+}
+
 func cmdVersion() *cobra.Command {
 	return &cobra.Command{
 		Use:   "version",
 		Short: "Print version info",
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Printf("dot %s (%s) built %s\n", version, commit, date)
-			fmt.Printf("  platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+			ui.Out.Printf("dot %s (%s) built %s\n", version, commit, date)
+			ui.Out.Printf("  platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
 		},
 	}
 }
 
-// loadConfigSilent loads config without logging errors.
-func (a *app) loadConfigSilent() (*config.Config, string, error) {
-	startDir := ""
-	if a.cfgPath == "" {
-		cwd, err := os.Getwd()
-		if err != nil {
-			return nil, "", err
-		}
-		startDir = cwd
+func cmdSelfUpdate(a *app) *cobra.Command {
+	var check, force, yes, jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Update dot to the latest release",
+		Long: `Look up the latest dot release on GitHub, download this platform's
+archive, verify it against the release's SHA256SUMS, and replace the running
+executable with the dot binary inside. --check only reports whether an
+update is available. Development builds, whose version is "dev", update only
+with --force.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if jsonOut && !check {
+				return doterrors.NewUserError("--json requires --check")
+			}
+			p := a.provisioner()
+			rel, err := p.LatestDot(cmd.Context())
+			if err != nil && (rel == nil || !check) {
+				return doterrors.Wrap(err, "check for updates")
+			}
+			available := version == "dev" || provision.NewerVersion(version, rel.Version)
+			if check {
+				if jsonOut {
+					out := map[string]any{
+						"current":   version,
+						"latest":    rel.Version,
+						"available": available,
+						"release":   rel,
+					}
+					if err != nil {
+						out["error"] = err.Error()
+					}
+					return ui.JSON(os.Stdout, out)
+				}
+				switch {
+				case !available:
+					ui.Out.Printf("dot %s is up to date\n", version)
+				case err != nil:
+					ui.Out.Printf("dot %s is available (current %s), but %v\n", rel.Version, version, err)
+				default:
+					ui.Out.Printf("dot %s is available (current %s); run `dot self-update`\n", rel.Version, version)
+				}
+				return nil
+			}
+			if version == "dev" && !force {
+				return doterrors.NewUserError(fmt.Sprintf("this is a development build; rerun with --force to replace it with dot %s", rel.Version))
+			}
+			if !available && !force {
+				ui.Out.Printf("dot %s is up to date\n", version)
+				return nil
+			}
+
+			exe, err := os.Executable()
+			if err != nil {
+				return doterrors.Wrap(err, "resolve dot executable")
+			}
+			if exe, err = filepath.EvalSymlinks(exe); err != nil {
+				return doterrors.Wrap(err, "resolve dot executable")
+			}
+			if !yes && !confirm(fmt.Sprintf("Replace %s (dot %s) with dot %s? [y/N] ", exe, version, rel.Version), false) {
+				return doterrors.NewUserError("self-update cancelled; pass --yes to update without a prompt")
+			}
+			ui.Out.Printf("%s %s\n", ui.Title("Downloading"), rel.Asset)
+			binary, err := p.DownloadDot(cmd.Context(), rel)
+			if err != nil {
+				return doterrors.Wrap(err, "download dot "+rel.Version)
+			}
+			_ = os.Remove(exe + ".old")
+			if err := provision.ReplaceExecutable(exe, binary); err != nil {
+				return doterrors.Wrap(err, "replace "+exe)
+			}
+			ui.Out.Printf("Updated dot %s -> %s (%s)\n", version, rel.Version, exe)
+			return nil
+		},
 	}
+	cmd.Flags().BoolVar(&check, "check", false, "Only report whether an update is available")
+	cmd.Flags().BoolVar(&force, "force", false, "Reinstall the latest release even if it is not newer, or replace a development build")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Replace the executable without prompting")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "With --check, print the result as JSON")
+	return cmd
+}
 
-	cfgPath, err := config.ResolveConfigPath(a.cfgPath, startDir)
+// loadConfigSilent loads config without logging errors.
+func (a *app) loadConfigSilent() (*config.Config, string, error) {
+	cfgPath, err := a.configFile()
 	if err != nil {
 		return nil, "", err
 	}
@@ -153,6 +340,19 @@ func (a *app) loadConfigSilent() (*config.Config, string, error) {
 	return cfg, repoRoot, nil
 }
 
+// configFile resolves the dot.toml to use without loading it.
+func (a *app) configFile() (string, error) {
+	startDir := ""
+	if a.cfgPath == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		startDir = cwd
+	}
+	return config.ResolveConfigPath(a.cfgPath, startDir)
+}
+
 func (a *app) loadConfig() (*config.Config, string, error) {
 	cfg, repoRoot, err := a.loadConfigSilent()
 	if err != nil {
@@ -169,75 +369,353 @@ func (a *app) loadConfig() (*config.Config, string, error) {
 		)
 	}
 
+	if cfg.Tools.MaxOutput > 0 {
+		runner.MaxOutput = cfg.Tools.MaxOutput
+	}
+	if err := a.provisionTools(cfg); err != nil {
+		return nil, "", err
+	}
+
 	return cfg, repoRoot, nil
 }
 
-func newSyncer(cfg *config.Config, home string) *sync.Syncer {
+func (a *app) provisioner() *provision.Provisioner {
+	return provision.New(filepath.Join(a.plat.Paths().CacheDir, "tools"), string(a.plat.OS), a.plat.Arch)
+}
+
+// provisionTools points tools.chezmoi at the resolved chezmoi binary,
+// downloading a pinned or bundled release into the cache on first use.
+func (a *app) provisionTools(cfg *config.Config) error {
+	if cfg.Chex.Engine == config.EngineNative {
+		return nil
+	}
+	opts := provision.ResolveOptions{
+		Configured: cfg.Tools.Chezmoi,
+		Pinned:     cfg.Tools.ChezmoiVersion,
+		LookPath:   exec.LookPath,
+		Offline:    true,
+	}
+	p := a.provisioner()
+	res, err := p.ResolveChezmoi(context.Background(), opts)
+	if errors.Is(err, provision.ErrNotProvisioned) {
+		fmt.Fprintf(os.Stderr, "Downloading chezmoi %s...\n", res.Version)
+		opts.Offline = false
+		res, err = p.ResolveChezmoi(context.Background(), opts)
+	}
+	if err != nil {
+		return doterrors.NewToolError("chezmoi", "provision "+string(res.Source)+" release", err)
+	}
+	if a.logger != nil {
+		a.logger.Debug("resolved chezmoi", "source", res.Source, "version", res.Version, "path", res.Path)
+	}
+	cfg.Tools.Chezmoi = res.Path
+	return nil
+}
+
+// driftSources reads the state dot drift compares: the managed files,
+// the package lists the enabled managers installed here captured, and the
+// versions of dot, git, and chezmoi.
+func driftSources(cfg *config.Config, plat *platform.Platform, r runner.Runner, eng chez.Engine) drift.Sources {
+	return drift.Sources{
+		Home: plat.Home,
+		Managed: func(ctx context.Context) ([]string, error) {
+			return eng.Managed(ctx, cfg.Repo.Path, cfg.Chex.SourceDir)
+		},
+		Source: func(ctx context.Context, target string) (string, error) {
+			src, err := eng.SourcePath(ctx, cfg.Repo.Path, cfg.Chex.SourceDir, target)
+			if err != nil {
+				return "", err
+			}
+			return filepath.Rel(cfg.SourcePath(), src)
+		},
+		Packages: func() (map[string][]string, error) {
+			manifests := packages.NewManifests(cfg, plat, r)
+			out := map[string][]string{}
+			for _, m := range manifests.Detected() {
+				if !cfg.Packages[m.Name] {
+					continue
+				}
+				list, err := manifests.Listed(m)
+				if err != nil {
+					return nil, err
+				}
+				out[m.Name] = list
+			}
+			return out, nil
+		},
+		Tools: func(ctx context.Context) map[string]string {
+			tools := map[string]string{"dot": version}
+			bins := map[string]string{"git": cfg.Tools.Git}
+			if _, ok := eng.(*chez.Chezmoi); ok {
+				bins["chezmoi"] = cfg.Tools.Chezmoi
+			}
+			for name, bin := range bins {
+				if res, err := r.Run(ctx, "", firstNonEmpty(bin, name), "--version"); err == nil {
+					line, _, _ := strings.Cut(strings.TrimSpace(res.Stdout), "\n")
+					tools[name] = line
+				}
+			}
+			return tools
+		},
+	}
+}
+
+func newSyncer(cfg *config.Config, plat *platform.Platform) *sync.Syncer {
 	r := runner.New()
+	home := plat.Home
 	g := gitx.New(cfg.Tools.Git, r)
-	ch := chez.New(cfg.Tools.Chezmoi, r)
-	files := modules.NewFilesModule(cfg, ch, home)
+	ch := newEngine(cfg, plat, r)
+	// chezmoi scripts run as their own apply step, so the files step
+	// applies everything else.
+	filesEngine := ch
+	var scripts modules.Module
+	if c, ok := ch.(*chez.Chezmoi); ok {
+		withoutScripts, onlyScripts := *c, *c
+		withoutScripts.Exclude, onlyScripts.Include = "scripts", "scripts"
+		filesEngine = &withoutScripts
+		scripts = modules.NewScriptsModule(cfg, &onlyScripts)
+	}
+	showApplyProgress(filesEngine)
+	files := modules.NewFilesModule(cfg, filesEngine, home)
 	mods := []modules.Module{files}
+	if len(cfg.Encryption.Files) > 0 {
+		mods = append(mods, modules.NewEncryptedFilesModule(cfg, agex.New(cfg.Tools.Age, r), home))
+	}
 	mods = append(mods, macos.NewStateModules(cfg, r, home)...)
-	return sync.NewWithModules(cfg, g, ch, modules.NewOrchestrator(mods...))
+	if scripts != nil {
+		mods = append(mods, scripts)
+	}
+	mods = append(mods, exporters.Modules(exporters.Env{Config: cfg, Platform: plat, Runner: r})...)
+	mods = append(mods, packages.Modules(cfg, plat, r)...)
+	id := machine.Current(plat)
+	mods = append(mods, machine.NewProfileModule(cfg.RepoRoot(), id, plat, driftSources(cfg, plat, r, ch).Collect))
+	orch := modules.NewOrchestrator(mods...)
+	orch.SetHost(id.Hostname)
+	if steps, err := cfg.ApplyPipeline(); err == nil {
+		orch.SetApplyPipeline(steps)
+	}
+	s := sync.NewWithModules(cfg, g, ch, orch)
+	s.Machine = id
+	s.Version = version
+	s.OpenPR = openPR(cfg, plat, r)
+	s.Journal = &sync.Journal{Path: cfg.JournalPath()}
+	if !ui.Out.Quiet {
+		s.HookOutput = os.Stderr
+	}
+	return s
+}
+
+// newFilesSyncer returns a syncer that runs only the files module, limited
+// to targets, for apply and capture of chosen paths.
+func newFilesSyncer(cfg *config.Config, plat *platform.Platform, targets []string) *sync.Syncer {
+	r := runner.New()
+	ch := newEngine(cfg, plat, r)
+	showApplyProgress(ch)
+	files := modules.NewFilesModule(cfg, ch, plat.Home)
+	files.Only = targets
+	id := machine.Current(plat)
+	orch := modules.NewOrchestrator(files)
+	orch.SetHost(id.Hostname)
+	s := sync.NewWithModules(cfg, gitx.New(cfg.Tools.Git, r), ch, orch)
+	s.Machine = id
+	s.Version = version
+	s.Journal = &sync.Journal{Path: cfg.JournalPath()}
+	return s
+}
+
+// showApplyProgress has ch report each file it applies on stderr, unless
+// output is quiet.
+func showApplyProgress(ch chez.Engine) {
+	if ui.Out.Quiet {
+		return
+	}
+	progress := ui.NewProgress(os.Stderr)
+	report := func(p chez.FileProgress) {
+		progress.File(p.Action, redact.Text(p.Path), p.Done, p.Total, p.Action == chez.ProgressSkipped)
+	}
+	switch e := ch.(type) {
+	case *chez.Chezmoi:
+		e.Progress = report
+	case *native.Engine:
+		e.Progress = report
+	}
+}
+
+// newEngine returns the configured apply engine with dotstate's template
+// data injected. Data that fails to build is left out so plain sources
+// still work.
+func newEngine(cfg *config.Config, plat *platform.Platform, r runner.Runner) chez.Engine {
+	env := tmpldata.NewEnv(cfg, plat, machine.Current(plat))
+	if cfg.Chex.Engine == config.EngineNative {
+		e := native.New(plat.Home, native.Mode(cfg.Chex.NativeMode))
+		if data, err := tmpldata.Default().Build(env); err == nil {
+			e.Data = data
+		}
+		return e
+	}
+	ch := chez.New(cfg.Tools.Chezmoi, r)
+	if data, err := tmpldata.Default().JSON(env); err == nil {
+		ch.OverrideData = data
+	}
+	// Without a probe chezmoi is assumed current; a missing binary fails
+	// the first real command with a clearer error.
+	ch.Warn = func(msg string) { fmt.Fprintf(os.Stderr, "warning: %s\n", msg) }
+	_ = ch.Probe(context.Background(), filepath.Join(plat.Paths().CacheDir, chez.CapabilitiesCacheFile))
+	return ch
 }
 
 func cmdDoctor(a *app) *cobra.Command {
-	return &cobra.Command{
+	var jsonOut, fix, yes bool
+
+	cmd := &cobra.Command{
 		Use:   "doctor",
 		Short: "Check prerequisites and system status",
+		Long: `Check the platform, config, and prerequisite tools, then run health checks
+on the repo: whether origin is reachable, the checked-out branch matches
+[repo] branch, no rebase or merge is in progress, no stale git lock files
+remain, the source dir is valid, the state dirs are writable, and the clock
+agrees with the forge. Each check passes, warns, or fails; any failure
+makes dot doctor exit non-zero. --fix offers to repair what it can: create
+missing state and source dirs, delete stale lock files, add the origin
+remote, and switch back to the configured branch.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			out := io.Writer(os.Stdout)
+			if jsonOut {
+				out = io.Discard
+			}
+			var checks []health.Check
+
 			// Platform info
-			fmt.Println(ui.Title("System"))
-			fmt.Printf("  Platform: %s/%s\n", a.plat.OS, a.plat.Arch)
-			fmt.Printf("  Home: %s\n", a.plat.Home)
+			fmt.Fprintln(out, ui.Title(i18n.T("doctor.system")))
+			fmt.Fprintf(out, "  "+i18n.T("doctor.platform")+"\n", a.plat.OS, a.plat.Arch)
+			fmt.Fprintf(out, "  "+i18n.T("doctor.home")+"\n", a.plat.Home)
 			if a.plat.IsWSL() {
-				fmt.Println("  WSL: detected")
+				fmt.Fprintln(out, "  "+i18n.T("doctor.wsl"))
+			}
+			if id, err := machine.Load(machine.Path(a.plat)); err == nil {
+				fmt.Fprintf(out, "  "+i18n.T("doctor.machine")+"\n", redact.Text(id.ID), redact.Text(machine.Path(a.plat)))
+				checks = append(checks, health.Check{ID: "machine.identity", Status: health.StatusPass, Message: redact.Text(id.ID)})
+			} else {
+				fmt.Fprintln(out, "  "+i18n.T("doctor.machine_missing"))
+				checks = append(checks, health.Check{ID: "machine.identity", Status: health.StatusWarn, Message: "no machine identity file", Hint: "run dot bootstrap to create one"})
 			}
-			fmt.Println()
+			fmt.Fprintln(out)
 
 			// Config
+			var identityErr, forgeErr error
 			cfg, repoRoot, err := a.loadConfigSilent()
 			if err != nil {
-				fmt.Println(ui.Err("Config"))
-				fmt.Printf("  Not found: %v\n", err)
-				fmt.Println("  Tip: run from the repo root, or pass --config path/to/dot.toml")
-				fmt.Println()
+				fmt.Fprintln(out, ui.Err(i18n.T("doctor.config")))
+				fmt.Fprintf(out, "  "+i18n.T("doctor.config_not_found")+"\n", err)
+				fmt.Fprintln(out, "  "+i18n.T("doctor.config_tip"))
+				fmt.Fprintln(out)
+				checks = append(checks, health.Check{ID: "config", Status: health.StatusFail, Message: redact.Text(err.Error()), Hint: i18n.T("doctor.config_tip")})
 			} else {
-				fmt.Println(ui.Title("Config"))
-				fmt.Printf("  Path: %s\n", cfg.ConfigPath())
-				fmt.Printf("  Repo root: %s\n", repoRoot)
-				fmt.Printf("  Repo URL: %s\n", cfg.Repo.URL)
-				fmt.Printf("  Branch: %s\n", cfg.Repo.Branch)
-				fmt.Println()
+				fmt.Fprintln(out, ui.Title(i18n.T("doctor.config")))
+				fmt.Fprintf(out, "  "+i18n.T("doctor.config_path")+"\n", cfg.ConfigPath())
+				fmt.Fprintf(out, "  "+i18n.T("doctor.repo_root")+"\n", repoRoot)
+				fmt.Fprintf(out, "  "+i18n.T("doctor.repo_url")+"\n", cfg.Repo.URL)
+				fmt.Fprintf(out, "  "+i18n.T("doctor.branch")+"\n", cfg.Repo.Branch)
+				checks = append(checks, health.Check{ID: "config", Status: health.StatusPass, Message: cfg.ConfigPath()})
+				if err := exporters.ValidateConfig(cfg); err != nil {
+					fmt.Fprintf(out, "  %s: %s\n", ui.Err(i18n.T("doctor.exports")), redact.Text(err.Error()))
+					checks = append(checks, health.Check{ID: "config.exports", Status: health.StatusWarn, Message: redact.Text(err.Error())})
+				}
+				if err := packages.ValidateConfig(cfg); err != nil {
+					fmt.Fprintf(out, "  %s: %s\n", ui.Err(i18n.T("doctor.packages")), redact.Text(err.Error()))
+					checks = append(checks, health.Check{ID: "config.packages", Status: health.StatusWarn, Message: redact.Text(err.Error())})
+				}
+				// Reported on every system: a repo authored on Linux is
+				// best fixed before a Mac or Windows machine applies it.
+				files := modules.NewFilesModule(cfg, newEngine(cfg, a.plat, runner.New()), a.plat.Home)
+				if collisions, err := files.CaseCollisions(); err == nil {
+					for _, c := range collisions {
+						fmt.Fprintf(out, "  %s: %s\n", ui.Err(i18n.T("doctor.case_collision")), redact.Text(strings.Join(c.Targets, ", ")))
+						fmt.Fprintf(out, "    %s\n", redact.Text(c.Suggestion()))
+						checks = append(checks, health.Check{ID: "source.case_collision", Status: health.StatusWarn, Message: redact.Text(strings.Join(c.Targets, ", ")), Hint: redact.Text(c.Suggestion())})
+					}
+				}
+				identity, err := gitx.New(cfg.Tools.Git, runner.New()).Identity(cmd.Context(), cfg.Repo.Path)
+				switch {
+				case err != nil:
+					fmt.Fprintf(out, "  %s: %s\n", ui.Key(i18n.T("doctor.git_identity")), redact.Text(err.Error()))
+					checks = append(checks, health.Check{ID: "git.identity", Status: health.StatusWarn, Message: redact.Text(err.Error())})
+				case identity.Complete():
+					fmt.Fprintf(out, "  %s: %s <%s>\n", ui.Key(i18n.T("doctor.git_identity")), redact.Text(identity.Name), redact.Text(identity.Email))
+					checks = append(checks, health.Check{ID: "git.identity", Status: health.StatusPass, Message: redact.Text(identity.Name) + " <" + redact.Text(identity.Email) + ">"})
+				default:
+					identityErr = errors.New(gitIdentityHint(cfg.Repo.Path, identity))
+					fmt.Fprintf(out, "  %s: %s\n", ui.Err(i18n.T("doctor.git_identity")), identityErr)
+					checks = append(checks, health.Check{ID: "git.identity", Status: health.StatusFail, Message: "git has no commit identity", Hint: identityErr.Error()})
+				}
+				if forgeErr = a.doctorForge(cmd.Context(), out, cfg); forgeErr != nil {
+					checks = append(checks, health.Check{ID: "forge.token", Status: health.StatusFail, Message: redact.Text(forgeErr.Error())})
+				}
+				fmt.Fprintln(out)
 			}
 
 			// Tools
-			fmt.Println(ui.Title("Prerequisites"))
+			fmt.Fprintln(out, ui.Title(i18n.T("doctor.prerequisites")))
 
 			type tool struct {
 				name        string
 				bin         string
 				required    bool
 				installHint string
+				note        string
 			}
 
 			tools := []tool{
-				{"git", "", true, "https://git-scm.com/downloads"},
-				{"chezmoi", "", true, "https://www.chezmoi.io/install/"},
-				{"op", "", false, "https://1password.com/downloads/command-line/"},
+				{"git", "", true, "https://git-scm.com/downloads", ""},
+				{"chezmoi", "", true, "https://www.chezmoi.io/install/", ""},
+				{"op", "", false, "https://1password.com/downloads/command-line/", ""},
+				{"age", "", false, "https://age-encryption.org", ""},
+			}
+
+			chezmoiOpts := provision.ResolveOptions{LookPath: exec.LookPath, Offline: true}
+			if cfg != nil {
+				chezmoiOpts.Configured = cfg.Tools.Chezmoi
+				chezmoiOpts.Pinned = cfg.Tools.ChezmoiVersion
+			}
+			chezmoiRes, chezmoiErr := a.provisioner().ResolveChezmoi(context.Background(), chezmoiOpts)
+			tools[1].bin = chezmoiRes.Path
+			tools[1].note = " (" + string(chezmoiRes.Source)
+			if chezmoiRes.Version != "" {
+				tools[1].note += " " + chezmoiRes.Version
+			}
+			tools[1].note += ")"
+			if chezmoiErr == nil {
+				probe := chez.New(chezmoiRes.Path, runner.New())
+				if err := probe.Probe(context.Background(), filepath.Join(a.plat.Paths().CacheDir, chez.CapabilitiesCacheFile)); err == nil {
+					if missing := probe.Caps.Missing(); len(missing) > 0 {
+						tools[1].note += " (lacks " + strings.Join(missing, ", ") + "; dotstate leaves these out)"
+					}
+				}
+			}
+			if errors.Is(chezmoiErr, provision.ErrNotProvisioned) {
+				tools[1].installHint = fmt.Sprintf("%s release %s not downloaded yet; any dot command that loads the config fetches it", chezmoiRes.Source, chezmoiRes.Version)
+			} else if chezmoiErr != nil {
+				tools[1].installHint = redact.Text(chezmoiErr.Error())
 			}
 
 			if cfg != nil {
 				if cfg.Tools.Git != "" {
 					tools[0].bin = cfg.Tools.Git
 				}
-				if cfg.Tools.Chezmoi != "" {
-					tools[1].bin = cfg.Tools.Chezmoi
-				}
 				if cfg.Tools.OP != "" {
 					tools[2].bin = cfg.Tools.OP
 				}
+				if cfg.Tools.Age != "" {
+					tools[3].bin = cfg.Tools.Age
+				}
+				if len(cfg.Encryption.Files) > 0 {
+					tools[3].required = true
+				}
+				if cfg.Chex.Engine == config.EngineNative {
+					tools[1].required = false
+					tools[1].note += " (unused: native engine)"
+				}
 			}
 
 			allOk := true
@@ -249,564 +727,4370 @@ func cmdDoctor(a *app) *cobra.Command {
 				path, err := exec.LookPath(bin)
 				if err != nil {
 					if t.required {
-						fmt.Printf("  %s: %s (MISSING)\n", ui.Err(t.name), t.installHint)
+						fmt.Fprintf(out, "  %s: %s %s\n", ui.Err(t.name), t.installHint, i18n.T("doctor.tool_missing"))
+						checks = append(checks, health.Check{ID: "tool." + t.name, Status: health.StatusFail, Message: t.name + " not found", Hint: t.installHint})
 						allOk = false
 					} else {
-						fmt.Printf("  %s: not found (optional)\n", ui.Key(t.name))
+						fmt.Fprintf(out, "  %s: %s\n", ui.Key(t.name), i18n.T("doctor.tool_optional"))
+						checks = append(checks, health.Check{ID: "tool." + t.name, Status: health.StatusSkip, Message: t.name + " not found (optional)"})
 					}
 				} else {
-					fmt.Printf("  %s: %s\n", ui.Key(t.name), path)
+					fmt.Fprintf(out, "  %s: %s%s\n", ui.Key(t.name), redact.Text(path), t.note)
+					checks = append(checks, health.Check{ID: "tool." + t.name, Status: health.StatusPass, Message: redact.Text(path) + t.note})
+				}
+			}
+			fmt.Fprintln(out)
+
+			// Health
+			var healthFailed bool
+			if cfg != nil {
+				fmt.Fprintln(out, ui.Title(i18n.T("doctor.health")))
+				env := health.Env{Config: cfg, Git: gitx.New(cfg.Tools.Git, runner.New())}
+				deep := health.Run(cmd.Context(), env)
+				for _, c := range deep {
+					printHealthCheck(out, c)
+				}
+				fmt.Fprintln(out)
+				if fix && applyHealthFixes(cmd.Context(), deep, yes) > 0 {
+					fmt.Fprintln(out)
+					fmt.Fprintln(out, ui.Title(i18n.T("doctor.health")))
+					deep = health.Run(cmd.Context(), env)
+					for _, c := range deep {
+						printHealthCheck(out, c)
+					}
+					fmt.Fprintln(out)
 				}
+				checks = append(checks, deep...)
+				healthFailed = health.Failed(deep)
 			}
 
-			fmt.Println()
+			if jsonOut {
+				if err := ui.JSON(os.Stdout, struct {
+					OK     bool           `json:"ok"`
+					Checks []health.Check `json:"checks"`
+				}{OK: !health.Failed(checks), Checks: checks}); err != nil {
+					return err
+				}
+			}
 
 			if !allOk {
 				return doterrors.NewToolNotFoundError("required tool", "see above for install hints")
 			}
-
-			fmt.Println(ui.Title("Status: OK"))
-			return nil
-		},
-	}
-}
-
-func cmdBootstrap(a *app) *cobra.Command {
-	var (
-		repoURL          string
-		skipOPCheckpoint bool
-	)
-
-	cmd := &cobra.Command{
-		Use:   "bootstrap",
-		Short: "Clone repo (if needed) and prepare this machine",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := a.bootstrapConfig(repoURL)
-			if err != nil {
-				return err
+			if identityErr != nil {
+				return doterrors.NewConfigError("git identity missing", identityErr)
 			}
-
-			printBootstrapPrerequisites(cfg, skipOPCheckpoint)
-
-			if a.logger != nil {
-				a.logger.Info("bootstrapping",
-					"url", cfg.Repo.URL,
-					"path", cfg.Repo.Path,
-					"branch", cfg.Repo.Branch,
-				)
+			if forgeErr != nil {
+				return doterrors.NewConfigError("forge token check failed", forgeErr)
 			}
-
-			if cfg.Repo.URL != "" {
-				r := runner.New()
-				g := gitx.New(cfg.Tools.Git, r)
-				if err := g.EnsureCloned(context.Background(), cfg.Repo.URL, cfg.Repo.Path, cfg.Repo.Branch); err != nil {
-					return doterrors.Wrap(err, "clone failed")
-				}
-			} else {
-				fmt.Println("Repo URL is empty; skipping clone and treating repo.path as an existing local checkout.")
+			if healthFailed {
+				return doterrors.WithCode(errors.New("health checks failed; see the hints above"), doterrors.ExitError)
 			}
 
-			printBootstrapComplete(cfg)
-
+			fmt.Fprintln(out, ui.Title(i18n.T("doctor.status_ok")))
 			return nil
 		},
 	}
-
-	cmd.Flags().StringVar(&repoURL, "repo", "", "Git URL of your dotstate repo (required if not running inside the repo)")
-	cmd.Flags().BoolVar(&skipOPCheckpoint, "skip-op-checkpoint", false, "Do not print the 1Password/op manual checkpoint")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Emit every check as JSON with its pass/warn/fail/skip status")
+	cmd.Flags().BoolVar(&fix, "fix", false, "Offer to repair failing health checks")
+	cmd.Flags().BoolVar(&yes, "yes", false, "With --fix, make every repair without asking")
+	cmd.MarkFlagsMutuallyExclusive("fix", "json")
 	return cmd
 }
 
-func (a *app) bootstrapConfig(repoURL string) (*config.Config, error) {
-	cfg, _, err := a.loadConfigSilent()
-	if err == nil {
-		if repoURL != "" {
-			cfg.Repo.URL = repoURL
+// applyHealthFixes offers each check's fix, or makes it when yes is set,
+// and returns how many fixes succeeded.
+func applyHealthFixes(ctx context.Context, checks []health.Check, yes bool) int {
+	fixed := 0
+	for _, c := range checks {
+		if c.Fix == nil || c.Status == health.StatusPass {
+			continue
 		}
-		return cfg, nil
-	}
-	if repoURL == "" {
-		return nil, doterrors.NewUserError("bootstrap requires --repo, or run from a repo that contains dot.toml")
-	}
-	cfg = config.Default()
-	cfg.Repo.URL = repoURL
-	return cfg, nil
-}
-
-func printBootstrapComplete(cfg *config.Config) {
-	fmt.Println(ui.Title("Bootstrap complete"))
-	fmt.Printf("  Repo: %s\n", redact.Text(cfg.Repo.Path))
-	fmt.Println()
-	fmt.Println("Next steps:")
-	fmt.Println("  1. cd", redact.Text(cfg.Repo.Path))
-	fmt.Println("  2. dot doctor")
-	fmt.Println("  3. dot apply --dry-run")
-	fmt.Println("  4. dot sync --dry-run")
-	fmt.Println("  5. dot macos audit --json")
-	fmt.Println("  6. dot schedule install")
-}
-
-func printBootstrapPrerequisites(cfg *config.Config, skipOPCheckpoint bool) {
-	fmt.Println(ui.Title("Bootstrap checks"))
-	if runtime.GOOS == "darwin" {
-		if err := exec.Command("xcode-select", "-p").Run(); err != nil {
-			fmt.Println("  Xcode Command Line Tools: manual checkpoint required")
-			fmt.Println("    Run: xcode-select --install")
-		} else {
-			fmt.Println("  Xcode Command Line Tools: detected")
+		description := redact.Text(c.Fix.Description)
+		if !yes && !confirm(fmt.Sprintf("Fix %s: %s? [y/N] ", c.ID, description), false) {
+			continue
 		}
-		if path, err := exec.LookPath("brew"); err != nil {
-			fmt.Println("  Homebrew: not found")
-			fmt.Println("    Install from https://brew.sh, then run: brew install git chezmoi")
-		} else {
-			fmt.Printf("  Homebrew: %s\n", redact.Text(path))
+		if err := c.Fix.Run(ctx); err != nil {
+			ui.Out.Printf("  %s %s: %s\n", ui.Err("fix failed:"), c.ID, redact.Text(err.Error()))
+			continue
 		}
-	} else {
-		fmt.Printf("  Platform: %s/%s (macOS bootstrap checks skipped)\n", runtime.GOOS, runtime.GOARCH)
-	}
-
-	if skipOPCheckpoint {
-		fmt.Println("  1Password/op checkpoint: skipped by flag")
-	} else if path, err := exec.LookPath(firstNonEmpty(cfg.Tools.OP, "op")); err != nil {
-		fmt.Println("  1Password/op checkpoint: op not found")
-		fmt.Println("    Install 1Password CLI, sign in to the desktop app, and enable CLI integration before applying secrets-backed state.")
-	} else {
-		fmt.Printf("  1Password/op checkpoint: %s\n", redact.Text(path))
-		fmt.Println("    Unlock 1Password and verify with: op account list")
+		ui.Out.Printf("  fixed %s: %s\n", c.ID, description)
+		fixed++
 	}
-	fmt.Println()
+	return fixed
 }
 
-func firstNonEmpty(values ...string) string {
-	for _, value := range values {
-		if value != "" {
-			return value
-		}
+// printHealthCheck prints one check as a status-labelled line with its
+// hint below.
+func printHealthCheck(out io.Writer, c health.Check) {
+	label := string(c.Status)
+	switch c.Status {
+	case health.StatusPass:
+		label = ui.Key(label)
+	case health.StatusWarn, health.StatusFail:
+		label = ui.Err(strings.ToUpper(label))
+	}
+	fmt.Fprintf(out, "  %s %-15s %s\n", label, c.ID, redact.Text(c.Message))
+	if c.Hint != "" && c.Status != health.StatusPass {
+		fmt.Fprintf(out, "       %s\n", redact.Text(c.Hint))
 	}
-	return ""
 }
 
-func cmdApply(a *app) *cobra.Command {
-	var dryRun bool
+func cmdConfig(a *app) *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Read, change, and check dot.toml",
+	}
 
-	cmd := &cobra.Command{
-		Use:   "apply",
-		Short: "Apply desired state to this machine",
+	var jsonOut bool
+	getCmd := &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print the effective value of a dotted key, e.g. repo.branch",
+		Long: `Print a dot.toml value after defaults, environment overrides, and this
+OS's override tables are applied. Strings print as they are; lists and
+tables print as TOML. Map entries are named after the map, as in
+sync.conflicts.*.json. op:// and env:// references print as written; they
+are not resolved.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, _, err := a.loadConfig()
+			cfgPath, err := a.configFile()
 			if err != nil {
-				return err
+				return doterrors.NewConfigError("failed to load config", err)
 			}
-
-			if a.logger != nil {
-				a.logger.Info("applying configuration", "source", cfg.SourcePath())
+			cfg, err := config.LoadUnresolved(cfgPath)
+			if err != nil {
+				return doterrors.NewConfigError("failed to load config", err)
 			}
-
-			s := newSyncer(cfg, a.plat.Home)
-			report, err := s.ApplyWithOptions(context.Background(), sync.RunOptions{DryRun: dryRun})
+			if a.repoDir != "" {
+				cfg.Repo.Path = a.repoDir
+			}
+			v, err := config.Get(cfg, args[0])
 			if err != nil {
-				return doterrors.Wrap(err, "apply failed")
+				return doterrors.NewUserError(err.Error())
 			}
-			if dryRun {
-				printRunReport("Apply plan", report)
-				return nil
+			if jsonOut {
+				return ui.JSON(os.Stdout, map[string]any{"key": args[0], "value": v})
 			}
-
-			fmt.Println(ui.Title("Apply complete"))
-			printRunReport("Apply result", report)
+			out, err := config.FormatValue(args[0], v)
+			if err != nil {
+				return doterrors.Wrap(err, "format "+args[0])
+			}
+			ui.Out.Println(redact.Text(out))
 			return nil
 		},
 	}
+	getCmd.Flags().BoolVar(&jsonOut, "json", false, "Print the key and value as JSON")
 
-	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the module plan without applying changes")
-	return cmd
-}
-
-func cmdCapture(a *app) *cobra.Command {
-	var dryRun bool
-
-	cmd := &cobra.Command{
-		Use:   "capture",
-		Short: "Capture local changes back into the repo",
+	setCmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Change one dot.toml value, keeping comments and formatting",
+		Long: `Set a dotted key in dot.toml, adding it to its table (or adding the table)
+when it is not there yet. The value is read as the key's type: strings as
+they are, true or false, integers, and lists as a TOML array such as
+'["a", "b"]' or a single string. Only the value is rewritten; comments and
+layout stay. The file is not changed if the result would not load.`,
+		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, _, err := a.loadConfig()
+			path, err := a.configFile()
 			if err != nil {
-				return err
+				return doterrors.NewConfigError("failed to find config", err)
 			}
-
-			if a.logger != nil {
-				a.logger.Info("capturing changes", "source", cfg.SourcePath())
+			if err := config.SetFile(path, args[0], args[1]); err != nil {
+				var verr *config.ValidationError
+				if errors.As(err, &verr) {
+					return doterrors.NewConfigError("refusing to write "+path, err)
+				}
+				return doterrors.NewUserError(err.Error())
 			}
+			ui.Out.Printf("Set %s in %s\n", args[0], redact.Text(path))
+			return nil
+		},
+	}
 
-			s := newSyncer(cfg, a.plat.Home)
-			report, err := s.CaptureWithOptions(context.Background(), sync.RunOptions{DryRun: dryRun})
+	var validateJSON bool
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check dot.toml and report every problem with its line number",
+		Long: `Parse and validate dot.toml the way every command loads it, without
+resolving op:// or env:// secret references, and list every problem as
+path:line: message. Unknown keys are warnings; everything else fails.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := a.configFile()
 			if err != nil {
-				return doterrors.Wrap(err, "capture failed")
+				return doterrors.NewConfigError("failed to find config", err)
 			}
-			if dryRun {
-				printRunReport("Capture plan", report)
-				return nil
+			issues, err := config.ValidateFile(path)
+			if err != nil {
+				return doterrors.NewConfigError("failed to read config", err)
+			}
+			failed := false
+			for _, issue := range issues {
+				failed = failed || !issue.Warning
+			}
+			if validateJSON {
+				if issues == nil {
+					issues = []config.Issue{}
+				}
+				if err := ui.JSON(os.Stdout, map[string]any{"ok": !failed, "path": path, "issues": issues}); err != nil {
+					return err
+				}
+			} else {
+				for _, issue := range issues {
+					where := path
+					if issue.Line > 0 {
+						where = fmt.Sprintf("%s:%d", path, issue.Line)
+					}
+					if issue.Warning {
+						ui.Out.Printf("%s: warning: %s\n", redact.Text(where), redact.Text(issue.Message))
+					} else {
+						ui.Out.Printf("%s: %s\n", redact.Text(where), ui.Err(redact.Text(issue.Message)))
+					}
+				}
+				if !failed {
+					ui.Out.Printf("%s is valid\n", redact.Text(path))
+				}
+			}
+			if failed {
+				return doterrors.WithCode(fmt.Errorf("%s has errors", path), doterrors.ExitConfig)
+			}
+			return nil
+		},
+	}
+	validateCmd.Flags().BoolVar(&validateJSON, "json", false, "Print {ok, path, issues} as JSON")
+
+	configCmd.AddCommand(getCmd, setCmd, validateCmd)
+	return configCmd
+}
+
+func cmdSelftest(a *app) *cobra.Command {
+	var keep bool
+	cmd := &cobra.Command{
+		Use:   "selftest",
+		Short: "Run init, add, capture, commit, and apply against a temp repo and home",
+		Long: `Exercise the whole file pipeline with the installed git and the configured
+engine, in a disposable repo and home under the temp directory, and report
+pass or fail for each stage. The real repo and home are never touched.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The config only picks the tools and engine; selftest runs
+			// without one.
+			cfg, _, err := a.loadConfigSilent()
+			if err != nil {
+				cfg = &config.Config{}
+				cfg.Tools.Git, cfg.Tools.Chezmoi = "git", "chezmoi"
+			} else if err := a.provisionTools(cfg); err != nil {
+				return err
 			}
 
-			fmt.Println(ui.Title("Capture complete"))
-			printRunReport("Capture result", report)
+			dir, err := os.MkdirTemp("", "dotstate-selftest-")
+			if err != nil {
+				return doterrors.Wrap(err, "create selftest directory")
+			}
+			if keep {
+				ui.Out.Printf("Keeping %s\n", dir)
+			} else {
+				defer os.RemoveAll(dir)
+			}
+
+			r := runner.New()
+			env := selftest.Env{Dir: dir, Git: gitx.New(cfg.Tools.Git, r)}
+			env.Engine, err = selftestEngine(cmd.Context(), cfg, env, r)
+			if err != nil {
+				return err
+			}
+
+			engine := cfg.Chex.Engine
+			if engine == "" {
+				engine = config.EngineChezmoi
+			}
+			ui.Out.Title("Selftest (" + engine + " engine)")
+			report := selftest.Run(cmd.Context(), env)
+			for _, stage := range report.Stages {
+				switch stage.Status {
+				case selftest.StatusPass:
+					ui.Out.Printf("  %s %-8s %s (%s)\n", ui.Key("pass"), stage.Name, redact.Text(stage.Detail), stage.Duration.Round(time.Millisecond))
+				case selftest.StatusFail:
+					ui.Out.Printf("  %s %-8s %s\n", ui.Err("FAIL"), stage.Name, redact.Text(stage.Detail))
+				default:
+					ui.Out.Printf("  skip %s\n", stage.Name)
+				}
+			}
+			if !report.OK() {
+				return fmt.Errorf("selftest failed; rerun with --keep to inspect %s", dir)
+			}
+			ui.Out.Title("All stages passed")
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&keep, "keep", false, "Keep the temp repo and home for inspection")
+	return cmd
+}
 
-	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the module plan without capturing changes")
+// selftestEngine returns the configured engine aimed at env's home. chezmoi
+// also gets its own config, cache, and state files, so neither the user's
+// chezmoi.toml nor their persistent state leaks in or is written.
+func selftestEngine(ctx context.Context, cfg *config.Config, env selftest.Env, r runner.Runner) (chez.Engine, error) {
+	if cfg.Chex.Engine == config.EngineNative {
+		return native.New(env.Home(), native.Mode(cfg.Chex.NativeMode)), nil
+	}
+	chezmoiConfig := filepath.Join(env.Dir, "chezmoi.toml")
+	if err := os.WriteFile(chezmoiConfig, nil, 0o644); err != nil {
+		return nil, doterrors.Wrap(err, "write selftest chezmoi config")
+	}
+	ch := chez.New(cfg.Tools.Chezmoi, r)
+	ch.DestDir = env.Home()
+	ch.GlobalArgs = []string{
+		"--destination", env.Home(),
+		"--config", chezmoiConfig,
+		"--cache", filepath.Join(env.Dir, "chezmoi-cache"),
+		"--persistent-state", filepath.Join(env.Dir, "chezmoistate.boltdb"),
+	}
+	ch.Warn = func(msg string) { fmt.Fprintf(os.Stderr, "warning: %s\n", msg) }
+	_ = ch.Probe(ctx, "")
+	return ch, nil
+}
+
+func cmdInit(a *app) *cobra.Command {
+	var repoURL string
+
+	cmd := &cobra.Command{
+		Use:   "init [dir]",
+		Short: "Create a new dotstate repo with a commented dot.toml",
+		Long: `Create the repo directory (default ~/.dotstate), write a commented dot.toml
+with the default settings, create the home/ source directory and state/
+layout, and run git init. With --repo, the URL is recorded as [repo] url
+and added as the origin remote.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.Default()
+			cfg.Repo.URL = repoURL
+			if len(args) == 1 {
+				cfg.Repo.Path = expandTargets(args, a.plat.Home)[0]
+			}
+			if err := initRepo(cmd.Context(), cfg, a.plat.Home); err != nil {
+				return err
+			}
+			ui.Out.Title("Repo initialized")
+			ui.Out.Printf("  Repo: %s\n", redact.Text(cfg.Repo.Path))
+			if cfg.Repo.URL != "" {
+				ui.Out.Printf("  Origin: %s\n", redact.Text(cfg.Repo.URL))
+			}
+			ui.Out.Infoln()
+			ui.Out.Infoln("Next steps:")
+			ui.Out.Infoln("  1. cd", redact.Text(cfg.Repo.Path))
+			ui.Out.Infoln("  2. Review dot.toml")
+			ui.Out.Infoln("  3. dot discover")
+			ui.Out.Infoln("  4. dot sync")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&repoURL, "repo", "", "Git URL of the remote to record in dot.toml and add as origin")
 	return cmd
 }
 
-func cmdSync(a *app) *cobra.Command {
-	var noApply bool
-	var noPush bool
-	var dryRun bool
+// initScaffold lists the files init writes besides dot.toml, relative to
+// the repo. Git does not track empty directories, so the source directory
+// gets a .keep file as well.
+var initScaffold = map[string]string{
+	".gitignore":      "# Local-only state; never committed.\n/state/backups/\n/state/audit/\n/state/logs/\n",
+	"state/README.md": "Captured exports (packages, registry, defaults dumps, etc.) go here.\n",
+}
 
-	syncCmd := &cobra.Command{
-		Use:   "sync",
-		Short: "Capture, commit, pull/rebase, apply, push",
+// initRepo scaffolds a new repo at cfg.Repo.Path. It refuses to touch a
+// directory that already has a dot.toml.
+func initRepo(ctx context.Context, cfg *config.Config, home string) error {
+	repoPath := cfg.Repo.Path
+	cfgPath := filepath.Join(repoPath, config.ConfigFileName)
+	if _, err := os.Stat(cfgPath); err == nil {
+		return doterrors.NewUserError(fmt.Sprintf("%s already exists; use dot bootstrap for an existing repo", redact.Text(cfgPath)))
 	}
 
-	syncCmd.PersistentFlags().BoolVar(&noApply, "no-apply", false, "Do not apply after pulling")
-	syncCmd.PersistentFlags().BoolVar(&noPush, "no-push", false, "Do not push after syncing")
-	syncCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Show module plans without capture, git, apply, or push mutations")
+	// A home-relative path keeps dot.toml valid on machines with a
+	// different home directory.
+	written := *cfg
+	written.Repo.Path = tildePath(repoPath, home)
+	content, err := config.Scaffold(&written)
+	if err != nil {
+		return doterrors.Wrap(err, "render dot.toml")
+	}
 
-	run := func(cmd *cobra.Command, args []string) error {
-		cfg, _, err := a.loadConfig()
-		if err != nil {
-			return err
+	files := map[string]string{
+		config.ConfigFileName:         string(content),
+		cfg.Chex.SourceDir + "/.keep": "",
+	}
+	for name, content := range initScaffold {
+		files[name] = content
+	}
+	for name, content := range files {
+		path := filepath.Join(repoPath, filepath.FromSlash(name))
+		if _, err := os.Stat(path); err == nil {
+			continue
 		}
-
-		if a.logger != nil {
-			a.logger.Info("syncing",
-				"noApply", noApply,
-				"noPush", noPush,
-			)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return doterrors.Wrap(err, "create repo layout")
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return doterrors.Wrap(err, "create repo layout")
 		}
+	}
+	if _, err := config.Load(cfgPath); err != nil {
+		return doterrors.NewConfigError("generated dot.toml does not load", err)
+	}
 
-		s := newSyncer(cfg, a.plat.Home)
-		report, err := s.SyncWithReport(context.Background(), sync.Options{NoApply: noApply, NoPush: noPush, DryRun: dryRun})
-		if err != nil {
-			return doterrors.Wrap(err, "sync failed")
+	g := gitx.New(cfg.Tools.Git, runner.New())
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); err != nil {
+		if err := g.Init(ctx, repoPath, cfg.Repo.Branch); err != nil {
+			return doterrors.Wrap(err, "git init")
 		}
-		if dryRun {
-			printSyncReport("Sync plan", report)
-			return nil
+	}
+	if cfg.Repo.URL != "" {
+		if origin, _ := g.RemoteURL(ctx, repoPath); origin == "" {
+			if err := g.AddRemote(ctx, repoPath, "origin", cfg.Repo.URL); err != nil {
+				return doterrors.Wrap(err, "add origin remote")
+			}
 		}
+	}
+	return nil
+}
 
-		fmt.Println(ui.Title("Sync complete"))
-		printSyncReport("Sync result", report)
-		return nil
+func cmdBootstrap(a *app) *cobra.Command {
+	var opts bootstrapOptions
+
+	cmd := &cobra.Command{
+		Use:   "bootstrap",
+		Short: "Clone repo (if needed) and prepare this machine",
+		Long: `Clone the repo (if needed), create the machine identity, and make sure git
+can commit. --apply then runs dot doctor and dot apply; --full also runs dot
+packages apply and dot schedule install, so a new machine is set up with one
+command. The chain stops at the first step that fails.
+
+--deploy-key generates an SSH key for this machine at
+~/.ssh/dotstate_deploy_ed25519 (unless it exists), prints the public key to
+add as a deploy key with write access on the git host, and clones and syncs
+with it through the repo's core.sshCommand.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.bundlePath != "" && opts.repoURL != "" {
+				return doterrors.NewUserError("--bundle and --repo cannot be combined")
+			}
+			if opts.bundlePath != "" && opts.deployKey {
+				return doterrors.NewUserError("--deploy-key cannot be combined with --bundle")
+			}
+			opts.apply = opts.apply || opts.full
+			if err := a.bootstrap(cmd.Context(), opts); err != nil {
+				return err
+			}
+			return a.onboard(cmd.Context(), cmd.Root(), opts)
+		},
 	}
 
-	syncCmd.RunE = run
+	cmd.Flags().StringVar(&opts.repoURL, "repo", "", "Git URL of your dotstate repo (required if not running inside the repo)")
+	cmd.Flags().StringVar(&opts.bundlePath, "bundle", "", "Clone from a dot export bundle archive instead of a URL")
+	cmd.Flags().BoolVar(&opts.skipOPCheckpoint, "skip-op-checkpoint", false, "Do not print the 1Password/op manual checkpoint")
+	cmd.Flags().BoolVar(&opts.apply, "apply", false, "Then run dot doctor and dot apply")
+	cmd.Flags().BoolVar(&opts.full, "full", false, "Then run dot doctor, dot apply, dot packages apply, and dot schedule install")
+	cmd.Flags().BoolVar(&opts.deployKey, "deploy-key", false, "Generate an SSH deploy key for this machine and clone with it")
+	return cmd
+}
 
-	syncCmd.AddCommand(&cobra.Command{
-		Use:   "now",
-		Short: "Alias for dot sync",
-		RunE:  run,
-	})
+// bootstrapOptions are the dot bootstrap flags.
+type bootstrapOptions struct {
+	repoURL          string
+	bundlePath       string
+	skipOPCheckpoint bool
+	// apply and full chain the onboarding steps after the clone.
+	apply, full bool
+	deployKey   bool
+}
 
-	return syncCmd
+func cmdImport(a *app) *cobra.Command {
+	var (
+		from             string
+		dryRun, yes      bool
+		jsonOut          bool
+		skipOPCheckpoint bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "import <bundle> | --from <manager> <path>",
+		Short: "Bootstrap from a bundle archive, or migrate from another dotfile manager",
+		Long: `Without --from, clone the repo from an archive written by dot export
+bundle, without network access, then prepare this machine as dot bootstrap
+does. Same as dot bootstrap --bundle <bundle>.
+
+With --from, add the dotfiles another manager keeps in home to the source
+state of this repo and commit the migration. <path> is yadm's repo
+(~/.local/share/yadm/repo.git), the git directory of a bare-repo setup, or
+the stow directory holding your packages. File modes carry over, yadm
+templates are converted where their syntax allows, and targets dotstate
+already manages are left alone.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if from == "" {
+				return a.bootstrap(cmd.Context(), bootstrapOptions{bundlePath: args[0], skipOPCheckpoint: skipOPCheckpoint})
+			}
+			return a.migrate(cmd.Context(), from, args[0], dryRun, yes, jsonOut)
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Migrate from another manager: "+strings.Join(migrate.Sources, ", "))
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "With --from, list what would be imported without changing anything")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "With --from, import and commit without asking")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "With --from and --dry-run, emit the import plan as JSON")
+	cmd.Flags().BoolVar(&skipOPCheckpoint, "skip-op-checkpoint", false, "Do not print the 1Password/op manual checkpoint")
+	return cmd
 }
 
-func printSyncReport(title string, report *sync.SyncReport) {
-	fmt.Println(ui.Title(title))
-	if report == nil || len(report.Operations) == 0 {
-		fmt.Println("  No module operations recorded.")
-		return
+// migrate imports the dotfiles another manager keeps at path into the
+// source state and commits them.
+func (a *app) migrate(ctx context.Context, from, path string, dryRun, yes, jsonOut bool) error {
+	if !slices.Contains(migrate.Sources, from) {
+		return doterrors.NewUserError(fmt.Sprintf("--from must be one of %s", strings.Join(migrate.Sources, ", ")))
 	}
-	for _, operation := range report.Operations {
-		printRunReport("", operation)
+	if jsonOut && !dryRun {
+		return doterrors.NewUserError("--json requires --dry-run")
+	}
+	cfg, _, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	g := gitx.New(cfg.Tools.Git, runner.New())
+	if !dryRun {
+		if err := requireCleanRepo(ctx, g, cfg.Repo.Path, "importing"); err != nil {
+			return err
+		}
 	}
+	plan, err := migrate.Scan(ctx, migrate.Options{From: from, Path: expandTargets([]string{path}, a.plat.Home)[0], Home: a.plat.Home, Git: g})
+	if err != nil {
+		return doterrors.Wrap(err, "read "+from+" layout")
+	}
+	eng := newEngine(cfg, a.plat, runner.New())
+	managed, err := eng.Managed(ctx, cfg.Repo.Path, cfg.Chex.SourceDir)
+	if err != nil {
+		return doterrors.Wrap(err, "list managed files")
+	}
+	plan.SkipManaged(managed)
+
+	if jsonOut {
+		return ui.JSON(os.Stdout, plan)
+	}
+	printMigratePlan(plan)
+	if dryRun || len(plan.Files) == 0 {
+		return nil
+	}
+	if !yes && !confirm(fmt.Sprintf("Import %d file(s) and commit? [y/N] ", len(plan.Files)), false) {
+		return doterrors.NewUserError("import cancelled; pass --yes to import without a prompt")
+	}
+
+	if err := plan.Add(ctx, eng, cfg.Repo.Path, cfg.Chex.SourceDir, a.plat.Home, "warning"); err != nil {
+		return doterrors.Wrap(err, "import failed")
+	}
+	id := machine.Current(a.plat)
+	message := gitx.WithMachineTrailer(fmt.Sprintf("import: migrate %d file(s) from %s", len(plan.Files), from), id.ID)
+	if _, err := g.Commit(ctx, cfg.Repo.Path, message); err != nil {
+		return doterrors.Wrap(err, "commit import")
+	}
+	ui.Out.Printf("Imported and committed %d file(s). Stop %s from managing them, then run dot diff and dot sync.\n", len(plan.Files), from)
+	return nil
 }
 
-func printRunReport(title string, report *modules.RunReport) {
-	if title != "" {
-		fmt.Println(ui.Title(title))
+func printMigratePlan(plan *migrate.Plan) {
+	ui.Out.Title("Import from " + plan.From)
+	for _, f := range plan.Files {
+		line := "  ~/" + f.Target
+		switch {
+		case f.Template != "":
+			line += " (template)"
+		case f.Symlink:
+			line += " (symlink)"
+		}
+		if f.Note != "" {
+			line += ": " + f.Note
+		}
+		ui.Out.Println(redact.Text(line))
 	}
-	if report == nil || report.Plan == nil {
-		fmt.Println("  No module plan recorded.")
-		return
+	if len(plan.Skipped) > 0 {
+		ui.Out.Printf("Skipped %d:\n", len(plan.Skipped))
+		for _, skip := range plan.Skipped {
+			ui.Out.Println(redact.Text(fmt.Sprintf("  %s: %s", skip.Path, skip.Reason)))
+		}
 	}
-	plan := report.Plan
-	fmt.Printf("  Operation: %s\n", redact.Text(string(plan.Operation)))
-	fmt.Printf("  Plan: %s\n", redact.Text(plan.PlanID))
-	fmt.Printf("  Summary: create=%d update=%d delete=%d noop=%d manual=%d blocked=%d\n",
-		plan.Summary.Create,
-		plan.Summary.Update,
-		plan.Summary.Delete,
-		plan.Summary.Noop,
-		plan.Summary.Manual,
-		plan.Summary.Blocked,
-	)
-	for _, change := range plan.Changes {
-		fmt.Printf("  - %s %s", humanAction(change.Action), redact.Text(change.ID))
-		if len(change.Capability) > 0 {
-			fmt.Printf(" [%s]", joinCapabilities(change.Capability))
+	if len(plan.Files) == 0 {
+		ui.Out.Println("Nothing to import.")
+	}
+}
+
+// bootstrap clones the repo from opts.repoURL, or from the bundle archive
+// at opts.bundlePath when set, and prepares this machine.
+func (a *app) bootstrap(ctx context.Context, opts bootstrapOptions) error {
+	var cfg *config.Config
+	var err error
+	if opts.bundlePath != "" {
+		if cfg, _, err = a.loadConfigSilent(); err != nil {
+			cfg = config.Default()
 		}
-		if change.BackupRequired {
-			fmt.Print(" backup-required")
+	} else if cfg, err = a.bootstrapConfig(opts.repoURL); err != nil {
+		return err
+	}
+
+	printBootstrapPrerequisites(cfg, opts.skipOPCheckpoint)
+
+	if a.logger != nil {
+		a.logger.Info("bootstrapping",
+			"url", cfg.Repo.URL,
+			"bundle", opts.bundlePath,
+			"path", cfg.Repo.Path,
+			"branch", cfg.Repo.Branch,
+		)
+	}
+
+	var sshCommand string
+	if opts.deployKey {
+		if sshCommand, err = a.setupDeployKey(ctx, cfg); err != nil {
+			return err
 		}
-		fmt.Println()
-		for _, diag := range change.Diagnostics {
-			fmt.Printf("      %s: %s\n", redact.Text(diag.Code), redact.Text(diag.Message))
+		// Clone, and the steps chained after it, authenticate with the key.
+		os.Setenv("GIT_SSH_COMMAND", sshCommand)
+	}
+
+	g := gitx.New(cfg.Tools.Git, runner.New())
+	switch {
+	case opts.bundlePath != "":
+		m, err := bundle.Import(ctx, g, opts.bundlePath, cfg.Repo.Path)
+		if err != nil {
+			return doterrors.Wrap(err, "import bundle failed")
+		}
+		cfg.Repo.URL, cfg.Repo.Branch = m.RepoURL, m.Branch
+		ui.Out.Printf("Imported %s at %.12s, exported %s\n", m.Branch, m.Head, m.CreatedAt.Local().Format(time.DateTime))
+		if m.RepoURL == "" {
+			ui.Out.Println("The bundle has no repo URL; add an origin remote before syncing.")
+		}
+	case cfg.Repo.URL != "":
+		if err := g.EnsureCloned(ctx, cfg.Repo.URL, cfg.Repo.Path, cfg.Repo.Branch); err != nil {
+			return doterrors.Wrap(err, "clone failed")
+		}
+	default:
+		ui.Out.Println("Repo URL is empty; skipping clone and treating repo.path as an existing local checkout.")
+	}
+	if sshCommand != "" {
+		if err := g.ConfigSetLocal(ctx, cfg.Repo.Path, "core.sshCommand", sshCommand); err != nil {
+			return doterrors.Wrap(err, "configure deploy key")
 		}
 	}
-	for _, diag := range plan.Diagnostics {
-		fmt.Printf("  diagnostic %s: %s\n", redact.Text(diag.Code), redact.Text(diag.Message))
+
+	id, created, err := machine.Ensure(machine.Path(a.plat), platform.Hostname(), cfg.Templates.Profile)
+	if err != nil {
+		return doterrors.Wrap(err, "create machine identity")
 	}
-	if len(report.Backups) > 0 {
-		fmt.Printf("  Backups: %d\n", len(report.Backups))
+	if created {
+		ui.Out.Printf("Created machine identity %s in %s\n", redact.Text(id.ID), redact.Text(machine.Path(a.plat)))
 	}
-	if len(report.Results) > 0 {
-		fmt.Println("  Results:")
-		for _, result := range report.Results {
-			fmt.Printf("    - %s %s %s\n", redact.Text(string(result.Phase)), redact.Text(result.ID), redact.Text(string(result.Status)))
+
+	if err := ensureGitIdentity(ctx, cfg); err != nil {
+		return err
+	}
+
+	if !opts.apply {
+		printBootstrapComplete(cfg)
+	}
+
+	return nil
+}
+
+// onboard runs the steps --apply and --full chain after bootstrap, each as
+// if invoked on its own with no flags, against the freshly cloned repo's
+// dot.toml.
+func (a *app) onboard(ctx context.Context, root *cobra.Command, opts bootstrapOptions) error {
+	if !opts.apply {
+		return nil
+	}
+	if a.cfgPath == "" && opts.bundlePath == "" {
+		if cfg, err := a.bootstrapConfig(opts.repoURL); err == nil {
+			path := filepath.Join(cfg.Repo.Path, config.ConfigFileName)
+			if _, err := os.Stat(path); err == nil {
+				a.cfgPath = path
+			}
 		}
 	}
-	for _, diag := range report.Diagnostics {
-		fmt.Printf("  diagnostic %s: %s\n", redact.Text(diag.Code), redact.Text(diag.Message))
+	steps := [][]string{{"doctor"}, {"apply"}}
+	if opts.full {
+		steps = append(steps, []string{"packages", "apply"}, []string{"schedule", "install"})
+	}
+	for i, step := range steps {
+		name := "dot " + strings.Join(step, " ")
+		c, _, err := root.Find(step)
+		if err != nil || c.RunE == nil {
+			return fmt.Errorf("find %s: %w", name, err)
+		}
+		ui.Out.Println()
+		ui.Out.Title(fmt.Sprintf("Onboarding %d/%d: %s", i+1, len(steps), name))
+		c.SetContext(ctx)
+		if err := c.RunE(c, nil); err != nil {
+			var rest []string
+			for _, next := range steps[i:] {
+				rest = append(rest, "dot "+strings.Join(next, " "))
+			}
+			return doterrors.Wrap(err, fmt.Sprintf("%s failed; fix it, then run: %s", name, strings.Join(rest, ", ")))
+		}
+	}
+	ui.Out.Println()
+	ui.Out.Title("Onboarding complete")
+	if !opts.full {
+		ui.Out.Infoln("Next steps:")
+		ui.Out.Infoln("  1. dot packages apply")
+		ui.Out.Infoln("  2. dot schedule install")
 	}
+	return nil
 }
 
-func humanAction(action modules.ChangeAction) string {
-	switch action {
-	case modules.ActionCreate:
-		return "Would create"
-	case modules.ActionUpdate:
-		return "Would update"
-	case modules.ActionDelete:
-		return "Would remove"
-	case modules.ActionNoop, modules.ActionReport:
-		return "No change"
-	case modules.ActionManual:
-		return "Manual step"
-	case modules.ActionBlocked:
-		return "Blocked"
-	default:
-		return string(action)
+func (a *app) bootstrapConfig(repoURL string) (*config.Config, error) {
+	cfg, _, err := a.loadConfigSilent()
+	if err == nil {
+		if repoURL != "" {
+			cfg.Repo.URL = repoURL
+		}
+		return cfg, nil
+	}
+	if repoURL == "" {
+		return nil, doterrors.NewUserError("bootstrap requires --repo, or run from a repo that contains dot.toml")
+	}
+	cfg = config.Default()
+	cfg.Repo.URL = repoURL
+	return cfg, nil
+}
+
+// ensureGitIdentity makes sure git can author commits in the repo, setting
+// repo-local user.name/user.email from [repo] user_name/user_email (read
+// from the cloned dot.toml when bootstrap started without one) for
+// whichever git cannot resolve. Without an identity the first sync commit
+// would fail, so bootstrap stops with instructions instead.
+func ensureGitIdentity(ctx context.Context, cfg *config.Config) error {
+	want := gitx.Identity{Name: cfg.Repo.UserName, Email: cfg.Repo.UserEmail}
+	if !want.Complete() {
+		if repoCfg, err := config.Load(filepath.Join(cfg.Repo.Path, config.ConfigFileName)); err == nil {
+			want.Name = firstNonEmpty(want.Name, repoCfg.Repo.UserName)
+			want.Email = firstNonEmpty(want.Email, repoCfg.Repo.UserEmail)
+		}
+	}
+
+	g := gitx.New(cfg.Tools.Git, runner.New())
+	have, changed, err := g.EnsureIdentity(ctx, cfg.Repo.Path, want)
+	if err != nil {
+		return doterrors.Wrap(err, "configure git identity")
+	}
+	if changed {
+		ui.Out.Printf("Set repo-local git identity: %s <%s>\n", redact.Text(have.Name), redact.Text(have.Email))
+	}
+	if !have.Complete() {
+		return doterrors.NewUserError(gitIdentityHint(cfg.Repo.Path, have))
+	}
+	return nil
+}
+
+// gitIdentityHint explains how to fix a missing git identity.
+func gitIdentityHint(repoPath string, have gitx.Identity) string {
+	var missing []string
+	if have.Name == "" {
+		missing = append(missing, "user.name")
+	}
+	if have.Email == "" {
+		missing = append(missing, "user.email")
+	}
+	return fmt.Sprintf("git %s not set for %s; sync commits would fail. Set [repo] user_name and user_email in dot.toml and rerun dot bootstrap, or run: git -C %s config %s <value>",
+		strings.Join(missing, " and "), redact.Text(repoPath), redact.Text(repoPath), missing[0])
+}
+
+func printBootstrapComplete(cfg *config.Config) {
+	ui.Out.Title("Bootstrap complete")
+	ui.Out.Printf("  Repo: %s\n", redact.Text(cfg.Repo.Path))
+	ui.Out.Infoln()
+	ui.Out.Infoln("Next steps:")
+	ui.Out.Infoln("  1. cd", redact.Text(cfg.Repo.Path))
+	ui.Out.Infoln("  2. dot doctor")
+	ui.Out.Infoln("  3. dot apply --dry-run")
+	ui.Out.Infoln("  4. dot sync --dry-run")
+	ui.Out.Infoln("  5. dot macos audit --json")
+	ui.Out.Infoln("  6. dot schedule install")
+}
+
+func printBootstrapPrerequisites(cfg *config.Config, skipOPCheckpoint bool) {
+	ui.Out.Title("Bootstrap checks")
+	if runtime.GOOS == "darwin" {
+		if err := exec.Command("xcode-select", "-p").Run(); err != nil {
+			ui.Out.Println("  Xcode Command Line Tools: manual checkpoint required")
+			ui.Out.Println("    Run: xcode-select --install")
+		} else {
+			ui.Out.Println("  Xcode Command Line Tools: detected")
+		}
+		if path, err := exec.LookPath("brew"); err != nil {
+			ui.Out.Println("  Homebrew: not found")
+			ui.Out.Println("    Install from https://brew.sh, then run: brew install git chezmoi")
+		} else {
+			ui.Out.Printf("  Homebrew: %s\n", redact.Text(path))
+		}
+	} else {
+		ui.Out.Printf("  Platform: %s/%s (macOS bootstrap checks skipped)\n", runtime.GOOS, runtime.GOARCH)
+	}
+
+	if skipOPCheckpoint {
+		ui.Out.Println("  1Password/op checkpoint: skipped by flag")
+	} else if path, err := exec.LookPath(firstNonEmpty(cfg.Tools.OP, "op")); err != nil {
+		ui.Out.Println("  1Password/op checkpoint: op not found")
+		ui.Out.Println("    Install 1Password CLI, sign in to the desktop app, and enable CLI integration before applying secrets-backed state.")
+	} else {
+		ui.Out.Printf("  1Password/op checkpoint: %s\n", redact.Text(path))
+		ui.Out.Println("    Unlock 1Password and verify with: op account list")
+	}
+	ui.Out.Println()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func cmdApply(a *app) *cobra.Command {
+	var (
+		dryRun      bool
+		only        []string
+		skipScripts bool
+		jsonOut     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "apply [target...]",
+		Short: "Apply desired state to this machine",
+		Long: `Apply the desired state to this machine through the module pipeline.
+Targets, like --only, limit the run to those managed paths and everything
+below them, e.g. dot apply ~/.config/nvim.`,
+		ValidArgsFunction: a.completeManagedPaths,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			if skipScripts {
+				cfg.DisableApplyStep(config.ApplyStepScripts)
+			}
+
+			if a.logger != nil {
+				a.logger.Info("applying configuration", "source", cfg.SourcePath())
+			}
+
+			s := newSyncer(cfg, a.plat)
+			if targets := slices.Concat(only, args); len(targets) > 0 {
+				s = newFilesSyncer(cfg, a.plat, expandTargets(targets, a.plat.Home))
+			}
+			report, err := s.ApplyWithOptions(context.Background(), sync.RunOptions{DryRun: dryRun})
+			a.logScriptResults(report)
+			if jsonOut && report != nil {
+				if err := ui.JSON(os.Stdout, report); err != nil {
+					return err
+				}
+			}
+			if err != nil {
+				if !jsonOut && !dryRun && (hasScriptResults(report) || hasFailedResults(report)) {
+					printRunReport("Apply result", report)
+				}
+				return doterrors.Wrap(err, "apply failed")
+			}
+			if jsonOut {
+				return nil
+			}
+			if dryRun {
+				printRunReport("Apply plan", report)
+				return nil
+			}
+
+			ui.Out.Title("Apply complete")
+			printRunReport("Apply result", report)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the module plan without applying changes")
+	cmd.Flags().BoolVar(&skipScripts, "skip-scripts", false, "Do not run chezmoi scripts (the scripts apply step)")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the module plan and results as JSON")
+	cmd.Flags().StringSliceVar(&only, "only", nil, "Apply only these managed paths and everything below them (comma-separated or repeated; relative paths are under home)")
+	_ = cmd.RegisterFlagCompletionFunc("only", a.completeManagedPaths)
+	return cmd
+}
+
+// expandTargets resolves --only paths to absolute destination paths; "~/"
+// and relative paths are taken from home.
+func expandTargets(paths []string, home string) []string {
+	targets := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			path = filepath.Join(home, rest)
+		} else if !filepath.IsAbs(path) {
+			path = filepath.Join(home, path)
+		}
+		targets = append(targets, filepath.Clean(path))
+	}
+	return targets
+}
+
+func cmdDiff(a *app) *cobra.Command {
+	var stat bool
+
+	cmd := &cobra.Command{
+		Use:   "diff [path...]",
+		Short: "Show what apply would change on this machine",
+		Long: `Show what apply would change on this machine. Path arguments limit the
+diff to those managed files or directories. Relative paths are under home.`,
+		ValidArgsFunction: a.completeManagedPaths,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			ch := newEngine(cfg, a.plat, runner.New())
+			diff, err := ch.Diff(cmd.Context(), cfg.Repo.Path, cfg.Chex.SourceDir, expandTargets(args, a.plat.Home)...)
+			if err != nil {
+				return doterrors.Wrap(err, "diff failed")
+			}
+			if strings.TrimSpace(diff) == "" {
+				ui.Out.Println("No differences.")
+				return nil
+			}
+			if stat {
+				printDiffStat(diffstat.Parse(diff))
+				return nil
+			}
+			ui.Out.Print(redact.Text(diff))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&stat, "stat", false, "Show per-file added/removed counts instead of the full diff")
+	return cmd
+}
+
+func printDiffStat(stats []diffstat.FileStat) {
+	for _, line := range diffstat.Lines(stats, 40) {
+		ui.Out.Printf("  %s\n", redact.Text(line))
+	}
+}
+
+func cmdEdit(a *app) *cobra.Command {
+	var apply, commit bool
+
+	cmd := &cobra.Command{
+		Use:   "edit <path>",
+		Short: "Edit a managed file's source in $EDITOR, then apply and commit it",
+		Long: `Open the source state file behind a managed target in $VISUAL or $EDITOR.
+When the file changed, offer to apply it to the target and to commit it;
+--apply and --commit do so without asking. Relative paths are under home.`,
+		Args: cobra.ExactArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return a.completeManagedPaths(cmd, args, toComplete)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			target := expandTargets(args, a.plat.Home)[0]
+			ch := newEngine(cfg, a.plat, runner.New())
+			src, err := ch.SourcePath(ctx, cfg.Repo.Path, cfg.Chex.SourceDir, target)
+			if err != nil {
+				return doterrors.Wrap(err, "resolve source path")
+			}
+			if strings.HasPrefix(filepath.Base(src), "encrypted_") {
+				return doterrors.NewUserError(fmt.Sprintf("%s is stored encrypted; edit it with chezmoi edit", redact.Text(args[0])))
+			}
+
+			before, err := os.ReadFile(src)
+			if err != nil {
+				return doterrors.Wrap(err, "read source file")
+			}
+			if err := runEditor(ctx, src); err != nil {
+				return err
+			}
+			after, err := os.ReadFile(src)
+			if err != nil {
+				return doterrors.Wrap(err, "read source file")
+			}
+			if bytes.Equal(before, after) {
+				ui.Out.Println("No changes.")
+				return nil
+			}
+			rel, _ := filepath.Rel(cfg.Repo.Path, src)
+			ui.Out.Printf("Edited %s\n", redact.Text(filepath.ToSlash(rel)))
+
+			if apply || confirm(fmt.Sprintf("Apply to %s? [Y/n] ", redact.Text(args[0])), true) {
+				report, err := newFilesSyncer(cfg, a.plat, []string{target}).ApplyWithOptions(ctx, sync.RunOptions{})
+				a.logScriptResults(report)
+				if err != nil {
+					return doterrors.Wrap(err, "apply failed")
+				}
+				ui.Out.Printf("Applied %s\n", redact.Text(args[0]))
+			}
+			if commit || confirm("Commit the change? [y/N] ", false) {
+				g := gitx.New(cfg.Tools.Git, runner.New())
+				if err := g.Add(ctx, cfg.Repo.Path, src); err != nil {
+					return doterrors.Wrap(err, "stage source file")
+				}
+				id := machine.Current(a.plat)
+				message := gitx.WithMachineTrailer("edit: update "+filepath.ToSlash(rel), id.ID)
+				if _, err := g.Commit(ctx, cfg.Repo.Path, message); err != nil {
+					return doterrors.Wrap(err, "commit edit")
+				}
+				ui.Out.Println("Committed. Run dot sync to push it.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&apply, "apply", false, "Apply the edited file without asking")
+	cmd.Flags().BoolVar(&commit, "commit", false, "Commit the edited file without asking")
+	return cmd
+}
+
+func cmdForget(a *app) *cobra.Command {
+	var commit bool
+
+	cmd := &cobra.Command{
+		Use:   "forget <path>...",
+		Short: "Stop tracking files, removing them from the source state",
+		Long: `Remove the source state entries for managed targets so apply and capture
+no longer touch them. The files in home are left as they are. Offers to
+commit the removal; --commit does so without asking. Relative paths are
+under home.`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: a.completeManagedPaths,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			targets := expandTargets(args, a.plat.Home)
+			ch := newEngine(cfg, a.plat, runner.New())
+			if err := ch.Forget(ctx, cfg.Repo.Path, cfg.Chex.SourceDir, targets...); err != nil {
+				return doterrors.Wrap(err, "forget failed")
+			}
+			names := make([]string, len(targets))
+			for i, target := range targets {
+				names[i] = tildePath(target, a.plat.Home)
+				ui.Out.Printf("Forgot %s (left in place)\n", redact.Text(names[i]))
+			}
+
+			if commit || confirm("Commit the removal? [y/N] ", false) {
+				g := gitx.New(cfg.Tools.Git, runner.New())
+				id := machine.Current(a.plat)
+				message := gitx.WithMachineTrailer("forget: stop tracking "+strings.Join(names, ", "), id.ID)
+				if _, err := g.Commit(ctx, cfg.Repo.Path, message); err != nil {
+					return doterrors.Wrap(err, "commit removal")
+				}
+				ui.Out.Println("Committed. Run dot sync to push it.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&commit, "commit", false, "Commit the removal without asking")
+	return cmd
+}
+
+func cmdPrune(a *app) *cobra.Command {
+	var yes, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Stop tracking managed files that no longer exist in home",
+		Long: `Find managed targets whose file, symlink, or directory is gone from home,
+e.g. the config of an uninstalled application, and forget them from the
+source state, then commit the cleanup. Each target is confirmed in turn;
+--yes forgets them all without asking.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			ch := newEngine(cfg, a.plat, runner.New())
+			g := gitx.New(cfg.Tools.Git, runner.New())
+			stale, err := sync.NewWithModules(cfg, g, ch, nil).Stale(ctx, a.plat.Home)
+			if err != nil {
+				return doterrors.Wrap(err, "prune failed")
+			}
+			if len(stale) == 0 {
+				ui.Out.Println("Nothing to prune.")
+				return nil
+			}
+
+			ui.Out.Printf("%d managed target(s) no longer exist in home:\n", len(stale))
+			for _, rel := range stale {
+				ui.Out.Printf("  ~/%s\n", redact.Text(rel))
+			}
+			if dryRun {
+				return nil
+			}
+			if !yes && !ui.IsTerminal(os.Stdin) {
+				return doterrors.NewUserError("nothing pruned; run dot prune in a terminal to confirm each target, or pass --yes")
+			}
+
+			var targets, names []string
+			for _, rel := range stale {
+				name := "~/" + rel
+				if !yes && !confirm(fmt.Sprintf("Forget %s? [y/N] ", redact.Text(name)), false) {
+					continue
+				}
+				targets = append(targets, filepath.Join(a.plat.Home, filepath.FromSlash(rel)))
+				names = append(names, name)
+			}
+			if len(targets) == 0 {
+				ui.Out.Println("Nothing pruned.")
+				return nil
+			}
+			if err := ch.Forget(ctx, cfg.Repo.Path, cfg.Chex.SourceDir, targets...); err != nil {
+				return doterrors.Wrap(err, "forget failed")
+			}
+			for _, name := range names {
+				ui.Out.Printf("Forgot %s\n", redact.Text(name))
+			}
+
+			id := machine.Current(a.plat)
+			message := gitx.WithMachineTrailer("prune: stop tracking "+strings.Join(names, ", "), id.ID)
+			if _, err := g.Commit(ctx, cfg.Repo.Path, message); err != nil {
+				return doterrors.Wrap(err, "commit removal")
+			}
+			ui.Out.Println("Committed. Run dot sync to push it.")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Forget every stale target without asking")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List stale targets without forgetting anything")
+	return cmd
+}
+
+// tildePath shows a path under home as ~/..., and any other path as is.
+func tildePath(path, home string) string {
+	if rel, err := filepath.Rel(home, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		return "~/" + filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// runEditor opens path in $VISUAL or $EDITOR, falling back to vi (notepad on
+// Windows), and waits for it to exit. The variable may carry arguments,
+// e.g. "code --wait".
+func runEditor(ctx context.Context, path string) error {
+	editor := strings.Fields(firstNonEmpty(os.Getenv("VISUAL"), os.Getenv("EDITOR")))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+		if runtime.GOOS == "windows" {
+			editor = []string{"notepad"}
+		}
+	}
+	child := exec.CommandContext(ctx, editor[0], append(editor[1:], path)...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	if err := child.Run(); err != nil {
+		return doterrors.Wrap(err, "editor "+editor[0]+" failed")
+	}
+	return nil
+}
+
+// confirm asks question on stdout and reads a yes/no answer from stdin. An
+// empty answer gives def; a closed or non-terminal stdin answers no.
+func confirm(question string, def bool) bool {
+	if !ui.IsTerminal(os.Stdin) {
+		return false
+	}
+	ui.Out.Print(question)
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(scanner.Text())) {
+	case "":
+		return def
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func cmdStatus(a *app) *cobra.Command {
+	var fetch bool
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Summarize uncommitted, unapplied, unpushed, and unpulled changes",
+		Long: `Combine git status, dot diff --stat, ahead/behind counts against the
+remote, and subrepo drift into one summary of whether a sync is needed.
+Ahead/behind counts are as of the last fetch unless --fetch is given.
+Exits 1 when anything is out of sync, so scripts can key off it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			subrepos, err := subrepoDrift(ctx, cfg, a.plat.Home)
+			if err != nil {
+				return err
+			}
+			report, err := newSyncer(cfg, a.plat).Status(ctx, sync.StatusOptions{Fetch: fetch, Subrepos: subrepos})
+			if err != nil {
+				return doterrors.Wrap(err, "status failed")
+			}
+			if jsonOut {
+				if err := ui.JSON(os.Stdout, report); err != nil {
+					return err
+				}
+			} else {
+				printStatusReport(report)
+			}
+			if !report.InSync {
+				return doterrors.WithCode(fmt.Errorf("out of sync"), doterrors.ExitError)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&fetch, "fetch", false, "Fetch from the remote before counting ahead/behind commits")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the status report as JSON")
+	return cmd
+}
+
+func cmdList(a *app) *cobra.Command {
+	var modifiedOnly bool
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "list [glob...]",
+		Short: "List managed files and whether each matches the source state",
+		Long: `List every managed target with its state: in_sync, modified (home differs
+from the source state), or missing (not in home). Glob arguments keep only
+matching targets; "**" spans directories and a pattern without a slash also
+matches the base name, e.g. dot list '.config/**' '*.toml'.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			globs := make([]string, len(args))
+			for i, arg := range args {
+				globs[i] = strings.TrimPrefix(arg, "~/")
+			}
+			s := sync.NewWithModules(cfg, gitx.New(cfg.Tools.Git, runner.New()), newEngine(cfg, a.plat, runner.New()), nil)
+			files, err := s.List(cmd.Context(), sync.ListOptions{Home: a.plat.Home, Globs: globs, ModifiedOnly: modifiedOnly})
+			if err != nil {
+				return doterrors.Wrap(err, "list failed")
+			}
+			if jsonOut {
+				return ui.JSON(os.Stdout, files)
+			}
+			for _, file := range files {
+				line := fmt.Sprintf("%-8s  %s", strings.ReplaceAll(file.State, "_", "-"), file.Path)
+				if file.State == sync.FileModified {
+					line += fmt.Sprintf(" (+%d -%d)", file.Added, file.Removed)
+				}
+				ui.Out.Println(redact.Text(line))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&modifiedOnly, "modified-only", false, "List only files whose home copy differs from the source state")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the list as JSON")
+	return cmd
+}
+
+func cmdVerify(a *app) *cobra.Command {
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "verify [path...]",
+		Short: "Check that home matches the source state",
+		Long: `Check that home matches the source state without changing anything. With
+the chezmoi engine this runs chezmoi verify; dot then compares each target's
+type, permissions, and SHA-256 checksum with home and lists every mismatch.
+Path arguments limit the check to those managed files or directories.
+Exits 1 when anything differs, so it can gate scripts and cron jobs.`,
+		ValidArgsFunction: a.completeManagedPaths,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			s := sync.NewWithModules(cfg, gitx.New(cfg.Tools.Git, runner.New()), newEngine(cfg, a.plat, runner.New()), nil)
+			report, err := s.Verify(cmd.Context(), sync.VerifyOptions{Home: a.plat.Home, Targets: expandTargets(args, a.plat.Home)})
+			if err != nil {
+				return doterrors.Wrap(err, "verify failed")
+			}
+			if jsonOut {
+				if err := ui.JSON(os.Stdout, report); err != nil {
+					return err
+				}
+			} else {
+				printVerifyReport(report)
+			}
+			if !report.OK {
+				return doterrors.WithCode(fmt.Errorf("verification failed"), doterrors.ExitError)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the verification report as JSON")
+	return cmd
+}
+
+func printVerifyReport(report *sync.VerifyReport) {
+	ui.Out.Title("Verify")
+	ui.Out.Printf("  Checked: %d target(s)\n", report.Checked)
+	switch report.Engine {
+	case sync.EngineVerified:
+		ui.Out.Println("  chezmoi verify: ok")
+	case sync.EngineDiffers:
+		ui.Out.Println("  chezmoi verify: differences found")
+	}
+	for _, m := range report.Mismatches {
+		line := fmt.Sprintf("  %-8s  %s", m.Kind, m.Path)
+		if m.Want != "" || m.Have != "" {
+			line += fmt.Sprintf(" (want %s, have %s)", shortChecksum(m.Want), shortChecksum(m.Have))
+		}
+		ui.Out.Println(redact.Text(line))
+	}
+	ui.Out.Println()
+	if report.OK {
+		ui.Out.Println("Verified.")
+	} else {
+		ui.Out.Println("Home does not match the source state; run dot diff to see how.")
+	}
+}
+
+// shortChecksum abbreviates a sha256: checksum for display, as git does
+// commit hashes.
+func shortChecksum(s string) string {
+	if hex, ok := strings.CutPrefix(s, "sha256:"); ok && len(hex) > 12 {
+		return "sha256:" + hex[:12]
+	}
+	return s
+}
+
+// subrepoDrift inspects each present subrepo declared in
+// state/subrepos.toml. Missing clones count as drift; apply clones them.
+func subrepoDrift(ctx context.Context, cfg *config.Config, home string) ([]sync.SubrepoDrift, error) {
+	statuses, err := macos.SubrepoStatuses(cfg, home)
+	if err != nil {
+		return nil, err
+	}
+	g := gitx.New(cfg.Tools.Git, runner.New())
+	drift := make([]sync.SubrepoDrift, 0, len(statuses))
+	for _, status := range statuses {
+		if !status.IsGitRepo {
+			drift = append(drift, sync.SubrepoDrift{Path: status.Path, Drift: []string{status.Status}})
+			continue
+		}
+		if err := status.Inspect(ctx, g); err != nil {
+			drift = append(drift, sync.SubrepoDrift{Path: status.Path, Drift: []string{"could not read git state"}})
+			continue
+		}
+		drift = append(drift, sync.SubrepoDrift{Path: status.Path, Drift: status.Drift()})
+	}
+	return drift, nil
+}
+
+func printStatusReport(report *sync.StatusReport) {
+	ui.Out.Title("Status")
+	ui.Out.Printf("  Branch: %s\n", report.Branch)
+
+	if len(report.Uncommitted) == 0 {
+		ui.Out.Println("  Repo: clean")
+	} else {
+		ui.Out.Printf("  Repo: %d uncommitted change(s)\n", len(report.Uncommitted))
+		for _, line := range report.Uncommitted {
+			ui.Out.Printf("    %s\n", redact.Text(line))
+		}
+	}
+
+	if len(report.Pending) == 0 {
+		ui.Out.Println("  Home: matches the source state")
+	} else {
+		ui.Out.Printf("  Home: %d file(s) differ from the source state\n", len(report.Pending))
+		for _, line := range diffstat.Lines(report.Pending, 40) {
+			ui.Out.Printf("    %s\n", redact.Text(line))
+		}
+	}
+
+	asOf := "as of the last fetch"
+	if report.Fetched {
+		asOf = "just fetched"
+	}
+	switch {
+	case !report.HasUpstream:
+		ui.Out.Println("  Remote: no upstream branch")
+	case report.Ahead == 0 && report.Behind == 0:
+		ui.Out.Printf("  Remote: up to date (%s)\n", asOf)
+	default:
+		ui.Out.Printf("  Remote: %d ahead, %d behind (%s)\n", report.Ahead, report.Behind, asOf)
+	}
+
+	for _, sub := range report.Subrepos {
+		ui.Out.Printf("  Subrepo %s: %s\n", redact.Text(sub.Path), strings.Join(sub.Drift, ", "))
+	}
+
+	ui.Out.Println()
+	if report.InSync {
+		ui.Out.Println("In sync.")
+		return
+	}
+	ui.Out.Println("Sync needed:")
+	for _, action := range report.Actions() {
+		ui.Out.Printf("  - %s\n", action)
+	}
+}
+
+func cmdTemplates(a *app) *cobra.Command {
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "templates",
+		Short: "Show the template data dotstate injects under .dotstate",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			registry := tmpldata.Default()
+			env := tmpldata.NewEnv(cfg, a.plat, machine.Current(a.plat))
+			if jsonOut {
+				data, err := registry.Build(env)
+				if err != nil {
+					return doterrors.Wrap(err, "build template data")
+				}
+				return ui.JSON(os.Stdout, data)
+			}
+
+			ui.Out.Title("Template helpers")
+			for _, h := range registry.Helpers() {
+				ui.Out.Printf("  .%s.%s: %s\n", tmpldata.Namespace, h.Name, h.Description)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Print the resolved template data as JSON")
+	return cmd
+}
+
+func cmdExport(a *app) *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the repo in forms usable without the dot binary",
+	}
+
+	var (
+		shell   string
+		output  string
+		repoDir string
+	)
+	scriptCmd := &cobra.Command{
+		Use:   "script",
+		Short: "Print a standalone bootstrap script (bash or PowerShell)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			sh, err := bootscript.ParseShell(shell)
+			if err != nil {
+				return doterrors.NewUserError(err.Error())
+			}
+			if repoDir == "" {
+				repoDir = homeRelative(a.plat.Home, cfg.Repo.Path)
+			}
+			script, err := bootscript.Render(sh, bootscript.Options{
+				RepoURL:   cfg.Repo.URL,
+				Branch:    cfg.Repo.Branch,
+				RepoDir:   repoDir,
+				SourceDir: cfg.Chex.SourceDir,
+			})
+			if err != nil {
+				return doterrors.NewUserError(err.Error())
+			}
+			// A redacted script would not run, and an unredacted one would
+			// leak the credential, so refuse instead.
+			if redact.Text(script) != script {
+				return doterrors.NewUserError("repo.url embeds credentials; use an SSH URL or a git credential helper before exporting a script")
+			}
+			if output == "" {
+				ui.Out.Print(script)
+				return nil
+			}
+			if err := os.WriteFile(output, []byte(script), 0o755); err != nil {
+				return doterrors.Wrap(err, "write script")
+			}
+			ui.Out.Printf("Wrote %s bootstrap script to %s\n", sh, redact.Text(output))
+			return nil
+		},
+	}
+	scriptCmd.Flags().StringVar(&shell, "shell", "bash", "Script dialect: bash or powershell")
+	scriptCmd.Flags().StringVarP(&output, "output", "o", "", "Write the script to this file instead of stdout")
+	scriptCmd.Flags().StringVar(&repoDir, "repo-dir", "", "Clone location relative to home on the target machine (defaults to repo.path)")
+
+	var bundleOutput string
+	bundleCmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Write the repo and its state manifests to a portable tarball",
+		Long: `Write a gzipped tarball holding a git bundle of every branch and its
+history, copies of the committed state manifests, and a manifest.json with
+their checksums. Carry it to a machine without network access and run
+dot import (or dot bootstrap --bundle) there. Uncommitted changes are not
+bundled, so the repo must be clean.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfigSilent()
+			if err != nil {
+				return err
+			}
+			if bundleOutput == "" {
+				bundleOutput = "dotstate-" + time.Now().Format("20060102") + ".tar.gz"
+			}
+			repoURL := cfg.Repo.URL
+			// The URL would be written in the clear, so leave it out and let
+			// the import run without a remote instead.
+			if redact.Text(repoURL) != repoURL {
+				fmt.Fprintln(os.Stderr, "warning: repo.url embeds credentials and is left out of the bundle; set origin after importing")
+				repoURL = ""
+			}
+			m, err := bundle.Export(cmd.Context(), gitx.New(cfg.Tools.Git, runner.New()), bundle.ExportOptions{
+				RepoPath:   cfg.Repo.Path,
+				Output:     bundleOutput,
+				RepoURL:    repoURL,
+				DotVersion: version,
+			})
+			if errors.Is(err, bundle.ErrDirty) {
+				return doterrors.NewUserError("the repo has uncommitted changes; run dot sync or commit them before exporting a bundle")
+			}
+			if err != nil {
+				return doterrors.Wrap(err, "export bundle")
+			}
+			ui.Out.Printf("Wrote %s (%s at %.12s, %d state manifest(s))\n", redact.Text(bundleOutput), m.Branch, m.Head, len(m.State))
+			return nil
+		},
+	}
+	bundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "Archive path (defaults to dotstate-<date>.tar.gz in the current directory)")
+
+	exportCmd.AddCommand(scriptCmd, bundleCmd)
+	return exportCmd
+}
+
+// homeRelative returns path relative to home, or its base name when path is
+// outside home, so generated scripts stay portable across machines.
+func homeRelative(home, path string) string {
+	if rel, err := filepath.Rel(home, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.Base(path)
+}
+
+func cmdCapture(a *app) *cobra.Command {
+	var dryRun, jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "capture [target...]",
+		Short: "Capture local changes back into the repo",
+		Long: `Capture local changes to managed files back into the source state.
+Targets limit the capture to those managed paths and everything below them,
+e.g. dot capture ~/.zshrc; only the files module runs then.`,
+		ValidArgsFunction: a.completeManagedPaths,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if a.logger != nil {
+				a.logger.Info("capturing changes", "source", cfg.SourcePath())
+			}
+
+			s := newSyncer(cfg, a.plat)
+			if len(args) > 0 {
+				s = newFilesSyncer(cfg, a.plat, expandTargets(args, a.plat.Home))
+			}
+			report, err := s.CaptureWithOptions(context.Background(), sync.RunOptions{DryRun: dryRun})
+			if err != nil {
+				return doterrors.Wrap(err, "capture failed")
+			}
+			if jsonOut {
+				return ui.JSON(os.Stdout, report)
+			}
+			if dryRun {
+				printRunReport("Capture plan", report)
+				return nil
+			}
+
+			ui.Out.Title(i18n.T("capture.complete"))
+			printRunReport("Capture result", report)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the module plan without capturing changes")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the module plan and results as JSON")
+	return cmd
+}
+
+func cmdSync(a *app) *cobra.Command {
+	var noApply bool
+	var noPush bool
+	var dryRun bool
+	var skipScripts bool
+	var jsonOut bool
+	var message string
+
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Capture, commit, pull/rebase, apply, push",
+	}
+
+	syncCmd.PersistentFlags().BoolVar(&noApply, "no-apply", false, "Do not apply after pulling")
+	syncCmd.PersistentFlags().BoolVar(&noPush, "no-push", false, "Do not push after syncing")
+	syncCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Show module plans without capture, git, apply, or push mutations")
+	syncCmd.PersistentFlags().BoolVar(&skipScripts, "skip-scripts", false, "Do not run chezmoi scripts during the apply step")
+	syncCmd.PersistentFlags().BoolVar(&jsonOut, "json", false, "Emit the sync summary as JSON; conflicts are not resolved interactively")
+	syncCmd.PersistentFlags().StringVarP(&message, "message", "m", "", "Commit subject for this sync, overriding [sync] commit_template; placeholders like {{hostname}} expand")
+
+	run := func(cmd *cobra.Command, args []string) error {
+		cfg, _, err := a.loadConfig()
+		if err != nil {
+			return err
+		}
+
+		if a.logger != nil {
+			a.logger.Info("syncing",
+				"noApply", noApply,
+				"noPush", noPush,
+			)
+		}
+
+		if skipScripts {
+			cfg.DisableApplyStep(config.ApplyStepScripts)
+		}
+		s := newSyncer(cfg, a.plat)
+		if !dryRun && !jsonOut && ui.IsTerminal(os.Stdin) && ui.IsTerminal(os.Stdout) && os.Getenv(schedule.EnvScheduled) != "1" {
+			s.ResolveConflicts = newConflictPrompter(s.Git, cfg.Repo.Path).resolve
+		}
+		report, err := s.SyncWithReport(context.Background(), sync.Options{NoApply: noApply, NoPush: noPush, DryRun: dryRun, Message: message})
+		if report != nil {
+			for _, operation := range report.Operations {
+				a.logScriptResults(operation)
+			}
+		}
+		if err != nil {
+			if a.logger != nil {
+				a.logger.Error(supportbundle.SyncFailedMessage, "error", redact.Text(err.Error()))
+			}
+			return doterrors.Wrap(err, "sync failed")
+		}
+		if report.FallbackBranch != "" && a.logger != nil {
+			a.logger.Warn("push rejected; pushed to fallback branch", "branch", report.FallbackBranch, "pull_request", report.PullRequestURL)
+		}
+		switch {
+		case jsonOut:
+			if err := ui.JSON(os.Stdout, report); err != nil {
+				return err
+			}
+		case dryRun:
+			printSyncReport("Sync plan", report)
+		default:
+			ui.Out.Title(i18n.T("sync.complete"))
+			printSyncReport("Sync result", report)
+		}
+		if !dryRun && os.Getenv(schedule.EnvScheduled) == "1" {
+			a.runScheduledAudit(cmd.Context(), cfg)
+			a.runScheduledDiscover(cmd.Context(), cfg)
+		}
+		return nil
+	}
+
+	syncCmd.RunE = run
+
+	syncCmd.AddCommand(&cobra.Command{
+		Use:   "now",
+		Short: "Alias for dot sync",
+		RunE:  run,
+	})
+
+	return syncCmd
+}
+
+func printSyncReport(title string, report *sync.SyncReport) {
+	ui.Out.Title(title)
+	if report == nil || len(report.Operations) == 0 {
+		ui.Out.Println("  " + i18n.T("sync.no_operations"))
+		return
+	}
+	for _, operation := range report.Operations {
+		printRunReport("", operation)
+	}
+	if len(report.ResolvedConflicts) > 0 {
+		ui.Out.Println("  Conflicts resolved:")
+		for _, resolved := range report.ResolvedConflicts {
+			ui.Out.Printf("    - %s (%s)\n", redact.Text(resolved.Path), resolved.Policy)
+		}
+	}
+	if len(report.Planned) > 0 {
+		ui.Out.Println("  Would run:")
+		for _, p := range report.Planned {
+			ui.Out.Printf("    %s\n", redact.Text(p.String()))
+		}
+	}
+	if report.Committed {
+		ui.Out.Println("  Committed:")
+		if len(report.CommitStat) == 0 {
+			ui.Out.Println("    (no file statistics available)")
+		}
+		for _, line := range diffstat.Lines(report.CommitStat, 40) {
+			ui.Out.Printf("    %s\n", redact.Text(line))
+		}
+	}
+	if report.FallbackBranch != "" {
+		ui.Out.Printf("  %s: the branch refused the push; pushed to %s instead\n", ui.Err("Push fallback"), redact.Text(report.FallbackBranch))
+		switch {
+		case report.PullRequestURL != "":
+			ui.Out.Printf("    Pull request: %s\n", redact.Text(report.PullRequestURL))
+		case report.PullRequestError != nil:
+			ui.Out.Printf("    Could not open a pull request: %s\n", redact.Text(report.PullRequestError.Error()))
+		default:
+			ui.Out.Println("    Merge it into the protected branch, or set [sync] push_fallback_pr = true to open a pull request.")
+		}
+	}
+}
+
+// openPR opens fallback pull requests through the forge API, or with the
+// GitHub CLI when no forge token is configured.
+func openPR(cfg *config.Config, plat *platform.Platform, r runner.Runner) func(ctx context.Context, head, base, title string) (string, error) {
+	gh := ghOpenPR(r, cfg.Repo.Path)
+	return func(ctx context.Context, head, base, title string) (string, error) {
+		f, err := newForge(ctx, cfg, plat, r)
+		if errors.Is(err, forge.ErrNoToken) {
+			return gh(ctx, head, base, title)
+		}
+		if err != nil {
+			return "", err
+		}
+		return f.OpenPullRequest(ctx, head, base, title, fallbackPRBody(base))
+	}
+}
+
+func fallbackPRBody(base string) string {
+	return "Opened by dot sync because " + base + " rejected a direct push."
+}
+
+// newForge returns the forge API client for the repo, identified by
+// repo.url or the origin remote.
+func newForge(ctx context.Context, cfg *config.Config, plat *platform.Platform, r runner.Runner) (forge.Forge, error) {
+	remote := cfg.Repo.URL
+	if remote == "" {
+		remote, _ = gitx.New(cfg.Tools.Git, r).RemoteURL(ctx, cfg.Repo.Path)
+	}
+	return forge.FromConfig(cfg, tmpldata.NewEnv(cfg, plat, nil).Secrets, remote)
+}
+
+// doctorForge prints the [forge] token check. It runs only when [forge] is
+// configured and returns an error when the token is missing or rejected;
+// missing scopes are only warned about.
+func (a *app) doctorForge(ctx context.Context, out io.Writer, cfg *config.Config) error {
+	if cfg.Forge.Provider == "" && cfg.Forge.TokenSecret == "" {
+		return nil
+	}
+	label := i18n.T("doctor.forge")
+	f, err := newForge(ctx, cfg, a.plat, runner.New())
+	if err == nil {
+		var info *forge.TokenInfo
+		if info, err = f.CurrentUser(ctx); err == nil {
+			fmt.Fprintf(out, "  %s: %s as %s\n", ui.Key(label), f.Provider(), redact.Text(info.User))
+			switch missing := forge.MissingScopes(info, forge.RequiredScopes(f.Provider())); {
+			case !info.ScopesKnown:
+				fmt.Fprintf(out, "    %s\n", i18n.T("doctor.forge_scopes_unknown"))
+			case len(missing) > 0:
+				fmt.Fprintf(out, "    %s: %s\n", ui.Err(i18n.T("doctor.forge_scopes_missing")), strings.Join(missing, ", "))
+			}
+			return nil
+		}
+	}
+	fmt.Fprintf(out, "  %s: %s\n", ui.Err(label), redact.Text(err.Error()))
+	return err
+}
+
+// ghOpenPR opens pull requests with the GitHub CLI, reusing an open one for
+// the same head branch.
+func ghOpenPR(r runner.Runner, repoPath string) func(ctx context.Context, head, base, title string) (string, error) {
+	return func(ctx context.Context, head, base, title string) (string, error) {
+		if _, err := exec.LookPath("gh"); err != nil {
+			return "", fmt.Errorf("gh not found on PATH")
+		}
+		res, err := r.Run(ctx, repoPath, "gh", "pr", "create", "--head", head, "--base", base, "--title", title,
+			"--body", fallbackPRBody(base))
+		if err == nil {
+			return strings.TrimSpace(res.Stdout), nil
+		}
+		if res == nil || !strings.Contains(res.Stderr, "already exists") {
+			return "", err
+		}
+		view, viewErr := r.Run(ctx, repoPath, "gh", "pr", "view", head, "--json", "url", "--jq", ".url")
+		if viewErr != nil {
+			return "", err
+		}
+		return strings.TrimSpace(view.Stdout), nil
+	}
+}
+
+func cmdLog(a *app) *cobra.Command {
+	var limit int
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "log",
+		Short: "Show sync history: each machine's last sync, dotstate commits, and this machine's runs",
+		Long: `Show when each machine last synced, the latest dotstate-generated commits
+(sync commits and any commit with a Machine-Id trailer) with the files they
+changed, and this machine's journal of sync, capture, apply, undo, and rollback runs,
+including failed ones.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			s := sync.NewWithModules(cfg, gitx.New(cfg.Tools.Git, runner.New()), nil, nil)
+			s.Journal = &sync.Journal{Path: cfg.JournalPath()}
+			history, err := s.History(cmd.Context(), limit)
+			if err != nil {
+				return doterrors.Wrap(err, "log failed")
+			}
+			if jsonOut {
+				return ui.JSON(os.Stdout, history)
+			}
+			printHistory(history)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 10, "Number of commits and journal entries to show")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the history as JSON")
+	return cmd
+}
+
+func printHistory(history *sync.History) {
+	const stamp = "2006-01-02 15:04"
+	ui.Out.Title("Last sync per machine")
+	if len(history.Machines) == 0 {
+		ui.Out.Println("  No sync commits yet")
+	}
+	for _, m := range history.Machines {
+		ui.Out.Printf("  %s  %s  %s\n", m.Time.Local().Format(stamp), shortCommit(m.Commit), redact.Text(m.Machine))
+	}
+
+	ui.Out.Println()
+	ui.Out.Title("Commits")
+	if len(history.Commits) == 0 {
+		ui.Out.Println("  No dotstate commits yet")
+	}
+	for _, c := range history.Commits {
+		ui.Out.Printf("  %s  %s  %s\n", c.Time.Local().Format(stamp), shortCommit(c.Hash), redact.Text(c.Subject))
+		if len(c.Files) > 0 {
+			ui.Out.Printf("    %s\n", diffstat.Sum(c.Files))
+		}
+	}
+
+	ui.Out.Println()
+	ui.Out.Title("This machine's runs")
+	if len(history.Journal) == 0 {
+		ui.Out.Println("  No runs recorded yet")
+	}
+	for _, e := range history.Journal {
+		line := fmt.Sprintf("  %s  %-7s", e.Time.Local().Format(stamp), e.Operation)
+		switch {
+		case e.Error != "":
+			line += "  failed: " + e.Error
+		case len(e.Files) > 0:
+			line += "  " + diffstat.Sum(e.Files).String()
+		default:
+			line += "  no changes"
+		}
+		if e.Commit != "" {
+			line += "  (" + shortCommit(e.Commit) + ")"
+		}
+		ui.Out.Println(redact.Text(line))
+	}
+}
+
+func cmdUndo(a *app) *cobra.Command {
+	var apply bool
+	var noPush bool
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "undo",
+		Short: "Revert this machine's most recent sync commit",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if a.logger != nil {
+				a.logger.Info("undoing last sync", "apply", apply, "noPush", noPush)
+			}
+
+			s := newSyncer(cfg, a.plat)
+			report, err := s.Undo(context.Background(), sync.UndoOptions{Apply: apply, NoPush: noPush, DryRun: dryRun})
+			if err != nil {
+				return doterrors.Wrap(err, "undo failed")
+			}
+
+			if dryRun {
+				ui.Out.Title("Undo plan")
+				ui.Out.Printf("  Would revert %s %s\n", shortCommit(report.Commit.Hash), redact.Text(report.Commit.Subject))
+			} else {
+				ui.Out.Title("Undo complete")
+				ui.Out.Printf("  Reverted %s %s\n", shortCommit(report.Commit.Hash), redact.Text(report.Commit.Subject))
+				if report.Pushed {
+					ui.Out.Println("  Pushed revert commit.")
+				}
+			}
+			if report.ApplyReport != nil {
+				printRunReport("", report.ApplyReport)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&apply, "apply", false, "Apply the reverted state to this machine after reverting")
+	cmd.Flags().BoolVar(&noPush, "no-push", false, "Do not push the revert commit")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show which commit would be reverted without changing anything")
+	return cmd
+}
+
+func cmdRollback(a *app) *cobra.Command {
+	var noPush bool
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "rollback [commit]",
+		Short: "Restore the files the last apply overwrote, or roll the source state back to a commit",
+		Long: `Without a commit, restore the destination files saved in the newest
+state/backups set, which apply writes before changing anything.
+
+With a commit, make the source state match that commit in a new commit,
+apply it to this machine, then push.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			opts := sync.RollbackOptions{NoPush: noPush, DryRun: dryRun}
+			if len(args) == 1 {
+				opts.Commit = args[0]
+			}
+
+			if a.logger != nil {
+				a.logger.Info("rolling back", "commit", opts.Commit, "noPush", noPush)
+			}
+
+			s := newSyncer(cfg, a.plat)
+			report, err := s.Rollback(cmd.Context(), opts)
+			if err != nil {
+				return doterrors.Wrap(err, "rollback failed")
+			}
+
+			if opts.Commit == "" {
+				printBackupRollback(report, dryRun)
+				return nil
+			}
+			if dryRun {
+				ui.Out.Title("Rollback plan")
+				ui.Out.Printf("  Would restore %s from %s and apply it\n", cfg.Chex.SourceDir, shortCommit(report.Commit))
+				return nil
+			}
+			ui.Out.Title("Rollback complete")
+			if report.Committed {
+				ui.Out.Printf("  Restored %s from %s\n", cfg.Chex.SourceDir, shortCommit(report.Commit))
+			} else {
+				ui.Out.Printf("  %s already matches %s\n", cfg.Chex.SourceDir, shortCommit(report.Commit))
+			}
+			if report.Pushed {
+				ui.Out.Println("  Pushed rollback commit.")
+			}
+			if report.ApplyReport != nil {
+				printRunReport("", report.ApplyReport)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&noPush, "no-push", false, "Do not push the rollback commit")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be restored without changing anything")
+	return cmd
+}
+
+func printBackupRollback(report *sync.RollbackReport, dryRun bool) {
+	if dryRun {
+		ui.Out.Title("Rollback plan")
+		ui.Out.Printf("  Would restore backup set %s:\n", report.BackupID)
+		for _, backup := range report.Backups {
+			action := "restore"
+			if exists, _ := backup.Current["exists"].(bool); !exists {
+				action = "remove"
+			}
+			if !backup.Restore.Supported {
+				action = "skip"
+			}
+			ui.Out.Printf("    %-7s %s\n", action, redact.Text(backup.Source.Value))
+		}
+		return
+	}
+	ui.Out.Title("Rollback complete")
+	ui.Out.Printf("  Restored backup set %s:\n", report.BackupID)
+	if report.RestoreReport != nil {
+		for _, result := range report.RestoreReport.Results {
+			ui.Out.Printf("    %-8s %s\n", result.Status, redact.Text(result.Source.Value))
+		}
+	}
+	ui.Out.Println("  The source state is unchanged; run dot capture to keep the restored files.")
+}
+
+func shortCommit(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func printRunReport(title string, report *modules.RunReport) {
+	if title != "" {
+		ui.Out.Title(title)
+	}
+	if report == nil || report.Plan == nil {
+		ui.Out.Println("  No module plan recorded.")
+		return
+	}
+	plan := report.Plan
+	ui.Out.Printf("  Operation: %s\n", redact.Text(string(plan.Operation)))
+	ui.Out.Printf("  Plan: %s\n", redact.Text(plan.PlanID))
+	ui.Out.Printf("  Summary: create=%d update=%d delete=%d noop=%d manual=%d blocked=%d\n",
+		plan.Summary.Create,
+		plan.Summary.Update,
+		plan.Summary.Delete,
+		plan.Summary.Noop,
+		plan.Summary.Manual,
+		plan.Summary.Blocked,
+	)
+	for _, change := range plan.Changes {
+		ui.Out.Printf("  - %s %s", humanAction(change.Action), redact.Text(change.ID))
+		if len(change.Capability) > 0 {
+			ui.Out.Printf(" [%s]", joinCapabilities(change.Capability))
+		}
+		if change.BackupRequired {
+			ui.Out.Print(" backup-required")
+		}
+		ui.Out.Println()
+		for _, line := range diffstat.Lines(diffstat.FromRecords(change.Current["diff_stat"]), 40) {
+			ui.Out.Printf("      %s\n", redact.Text(line))
+		}
+		for _, diag := range change.Diagnostics {
+			ui.Out.Printf("      %s: %s\n", redact.Text(diag.Code), redact.Text(diag.Message))
+			if diag.Remediation != "" {
+				ui.Out.Printf("        fix: %s\n", redact.Text(diag.Remediation))
+			}
+		}
+	}
+	for _, diag := range plan.Diagnostics {
+		ui.Out.Printf("  diagnostic %s: %s\n", redact.Text(diag.Code), redact.Text(diag.Message))
+	}
+	if len(report.Planned) > 0 {
+		ui.Out.Println("  Would run:")
+		for _, p := range report.Planned {
+			ui.Out.Printf("    %s\n", redact.Text(p.String()))
+		}
+	}
+	if len(report.Backups) > 0 {
+		ui.Out.Printf("  Backups: %d\n", len(report.Backups))
+		for _, dir := range backupDirs(report.Backups) {
+			ui.Out.Printf("    saved under %s\n", redact.Text(dir))
+		}
+	}
+	if len(report.Results) > 0 {
+		ui.Out.Println("  Results:")
+		for _, result := range report.Results {
+			ui.Out.Printf("    - %s %s %s", redact.Text(string(result.Phase)), redact.Text(result.ID), redact.Text(string(result.Status)))
+			if code, ok := result.Current["exit_code"]; ok {
+				ui.Out.Printf(" (exit %v)", code)
+			}
+			ui.Out.Println()
+			if output, _ := result.Current["output"].(string); output != "" {
+				for _, line := range strings.Split(output, "\n") {
+					ui.Out.Printf("        %s\n", redact.Text(line))
+				}
+			}
+			if result.Status == modules.StatusFailed || result.Status == modules.StatusSkipped {
+				for _, diag := range result.Diagnostics {
+					ui.Out.Printf("        %s: %s\n", redact.Text(diag.Code), redact.Text(diag.Message))
+				}
+			}
+		}
+	}
+	for _, diag := range report.Diagnostics {
+		ui.Out.Printf("  diagnostic %s: %s\n", redact.Text(diag.Code), redact.Text(diag.Message))
+	}
+}
+
+// hasScriptResults reports whether report ran any chezmoi script.
+func hasScriptResults(report *modules.RunReport) bool {
+	if report == nil {
+		return false
+	}
+	for _, result := range report.Results {
+		if _, ok := result.Current["exit_code"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFailedResults reports whether any result in report failed, as one
+// subrepo can while the rest of the apply goes on.
+func hasFailedResults(report *modules.RunReport) bool {
+	if report == nil {
+		return false
+	}
+	for _, result := range report.Results {
+		if result.Status == modules.StatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// logScriptResults logs each chezmoi script run in report with its exit
+// status and output.
+func (a *app) logScriptResults(report *modules.RunReport) {
+	if a.logger == nil || report == nil {
+		return
+	}
+	for _, result := range report.Results {
+		code, ok := result.Current["exit_code"]
+		if !ok {
+			continue
+		}
+		args := []any{"script", result.Source.Value, "status", result.Status, "exit_code", code, "output", result.Current["output"]}
+		if result.Status == modules.StatusFailed {
+			a.logger.Error("script failed", args...)
+		} else {
+			a.logger.Info("script ran", args...)
+		}
+	}
+}
+
+// backupDirs returns the distinct dated backup directories referenced by
+// backup payloads, in first-seen order.
+func backupDirs(backups []modules.Backup) []string {
+	var dirs []string
+	seen := map[string]bool{}
+	for _, backup := range backups {
+		p := backup.PayloadRef.Path
+		idx := strings.Index(p, backup.BackupID)
+		if p == "" || backup.BackupID == "" || idx < 0 {
+			continue
+		}
+		dir := p[:idx+len(backup.BackupID)]
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func humanAction(action modules.ChangeAction) string {
+	switch action {
+	case modules.ActionCreate:
+		return "Would create"
+	case modules.ActionUpdate:
+		return "Would update"
+	case modules.ActionDelete:
+		return "Would remove"
+	case modules.ActionNoop, modules.ActionReport:
+		return "No change"
+	case modules.ActionManual:
+		return "Manual step"
+	case modules.ActionBlocked:
+		return "Blocked"
+	default:
+		return string(action)
+	}
+}
+
+func joinCapabilities(capabilities []modules.Capability) string {
+	parts := make([]string, 0, len(capabilities))
+	for _, capability := range capabilities {
+		parts = append(parts, string(capability))
+	}
+	return strings.Join(parts, ",")
+}
+
+func cmdMacOS(a *app) *cobra.Command {
+	macosCmd := &cobra.Command{
+		Use:   "macos",
+		Short: "macOS-specific state commands",
+	}
+
+	var jsonOut bool
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Audit macOS state without mutating it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !jsonOut {
+				return doterrors.NewUserError("dot macos audit currently requires --json")
+			}
+			r := runner.New()
+			opts := macos.AuditOptions{
+				GOOS:        runtime.GOOS,
+				Arch:        runtime.GOARCH,
+				Host:        machine.Current(a.plat).Hostname,
+				GeneratedAt: time.Now(),
+				Runner:      r,
+				HomeDir:     a.plat.Home,
+			}
+			if cfg, _, err := a.loadConfigSilent(); err == nil {
+				opts.RepoRoot = cfg.RepoRoot()
+				opts.BrewfilePath = filepath.Join(cfg.StatePath(), "macos", "brew", "Brewfile")
+				opts.ExtraModules = []modules.Module{
+					modules.NewFilesModule(cfg, newEngine(cfg, a.plat, r), a.plat.Home),
+				}
+			}
+			envelope := macos.NewAudit(cmd.Context(), opts)
+			return ui.JSON(os.Stdout, envelope)
+		},
+	}
+	auditCmd.Flags().BoolVar(&jsonOut, "json", false, "Emit dotstate.audit.v1 JSON")
+
+	macosCmd.AddCommand(auditCmd)
+	return macosCmd
+}
+
+func cmdPackages(a *app) *cobra.Command {
+	packagesCmd := &cobra.Command{
+		Use:   "packages",
+		Short: "Capture installed package lists into state/packages and install from them",
+	}
+
+	var jsonOut bool
+	captureCmd := &cobra.Command{
+		Use:   "capture [manager...]",
+		Short: "Write a sorted package manifest for each enabled package manager",
+		Long: `List the packages installed through each package manager switched on in
+[packages] and write them, sorted, to state/packages/<manager>.txt. Naming
+managers captures those instead, whether or not they are enabled. dot
+capture and dot sync capture the enabled managers too.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := packages.ValidateConfig(cfg); err != nil {
+				return doterrors.NewUserError(err.Error())
+			}
+			c := packages.NewManifests(cfg, a.plat, runner.New())
+			managers := c.Enabled(cfg)
+			if len(args) > 0 {
+				managers = nil
+				for _, name := range args {
+					m, ok := packages.Lookup(name)
+					if !ok {
+						return doterrors.NewUserError(fmt.Sprintf("unknown package manager %q (available: %s)", name, strings.Join(packages.Names(), ", ")))
+					}
+					if !m.Supported(a.plat) {
+						return doterrors.NewUserError(fmt.Sprintf("%s is not supported on %s", name, a.plat.OS))
+					}
+					managers = append(managers, m)
+				}
+			}
+			if len(managers) == 0 && !jsonOut {
+				var detected []string
+				for _, m := range c.Detected() {
+					detected = append(detected, m.Name)
+				}
+				if len(detected) == 0 {
+					ui.Out.Println("No package managers enabled or detected.")
+					return nil
+				}
+				ui.Out.Printf("No package managers enabled. Detected: %s\n", strings.Join(detected, ", "))
+				ui.Out.Printf("Enable them under [packages] in dot.toml (e.g. %s = true), or name them: dot packages capture %s\n", detected[0], detected[0])
+				return nil
+			}
+
+			results := []packages.Result{}
+			for _, m := range managers {
+				res, err := c.Capture(cmd.Context(), m)
+				if err != nil {
+					return err
+				}
+				results = append(results, res)
+			}
+			if jsonOut {
+				return ui.JSON(os.Stdout, results)
+			}
+			for _, res := range results {
+				switch {
+				case res.Missing:
+					ui.Out.Printf("%s: %s\n", res.Manager, ui.Err("not installed"))
+				case res.Changed:
+					ui.Out.Printf("%s: wrote %d packages to %s\n", res.Manager, res.Packages, res.Path)
+				default:
+					ui.Out.Printf("%s: %d packages, unchanged\n", res.Manager, res.Packages)
+				}
+			}
+			return nil
+		},
+	}
+	captureCmd.Flags().BoolVar(&jsonOut, "json", false, "Emit capture results as JSON")
+
+	var applyJSON, dryRun bool
+	applyCmd := &cobra.Command{
+		Use:   "apply [manager...]",
+		Short: "Install packages the captured manifests list but this machine lacks",
+		Long: `Read each state/packages manifest for a package manager that runs on this
+OS, compare it with what the manager reports installed, and install the
+rest. Naming managers limits the run to those. --dry-run prints the plan
+without installing. dot apply does the same when [apply] install_packages
+is set.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			c := packages.NewManifests(cfg, a.plat, runner.New())
+			managers := c.Captured()
+			if len(args) > 0 {
+				managers = nil
+				for _, name := range args {
+					m, ok := packages.Lookup(name)
+					if !ok {
+						return doterrors.NewUserError(fmt.Sprintf("unknown package manager %q (available: %s)", name, strings.Join(packages.Names(), ", ")))
+					}
+					managers = append(managers, m)
+				}
+			}
+
+			plans := []packages.InstallPlan{}
+			for _, m := range managers {
+				plan, err := c.Plan(cmd.Context(), m)
+				if err != nil {
+					return err
+				}
+				if dryRun {
+					if err := c.PlanCommands(cmd.Context(), m, &plan); err != nil {
+						return err
+					}
+				}
+				plans = append(plans, plan)
+			}
+			if applyJSON {
+				if err := ui.JSON(os.Stdout, plans); err != nil {
+					return err
+				}
+			} else if len(plans) == 0 {
+				ui.Out.Println("No package manifests for this OS in state/packages.")
+			}
+			for i, plan := range plans {
+				if !applyJSON {
+					switch {
+					case plan.Missing:
+						ui.Out.Printf("%s: %s\n", plan.Manager, ui.Err("not installed"))
+					case len(plan.Install) == 0:
+						ui.Out.Printf("%s: up to date\n", plan.Manager)
+					default:
+						ui.Out.Printf("%s: install %s\n", plan.Manager, strings.Join(plan.Install, ", "))
+					}
+					if len(plan.Skipped) > 0 {
+						ui.Out.Printf("  skipped on %s: %s\n", a.plat.OS, strings.Join(plan.Skipped, ", "))
+					}
+					for _, command := range plan.Commands {
+						ui.Out.Printf("  would run: %s\n", redact.Text(command))
+					}
+				}
+				if dryRun {
+					continue
+				}
+				if err := c.Install(cmd.Context(), managers[i], plan); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	applyCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print what would be installed, and the install commands, without installing")
+	applyCmd.Flags().BoolVar(&applyJSON, "json", false, "Emit the install plan as JSON")
+
+	packagesCmd.AddCommand(captureCmd)
+	packagesCmd.AddCommand(applyCmd)
+	return packagesCmd
+}
+
+func cmdMachine(a *app) *cobra.Command {
+	machineCmd := &cobra.Command{
+		Use:   "machine",
+		Short: "List the machines that sync this repo and show their profiles",
+		Long: `Every dot capture and dot sync records this machine's profile (ID,
+hostname, profile, tags, OS, architecture, and the state dot drift
+compares) in state/machines/<id>.toml, so each machine can see the others.`,
+	}
+
+	var jsonOut bool
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the machine profiles recorded in the repo",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			profiles, err := machine.LoadProfiles(cfg.RepoRoot())
+			if err != nil {
+				return doterrors.Wrap(err, "list machines")
+			}
+			if jsonOut {
+				if profiles == nil {
+					profiles = []*machine.Profile{}
+				}
+				return ui.JSON(os.Stdout, profiles)
+			}
+			if len(profiles) == 0 {
+				ui.Out.Println("No machine profiles yet; dot capture or dot sync records this one.")
+				return nil
+			}
+			current := machine.Current(a.plat).ID
+			ui.Out.Title("Machines")
+			for _, p := range profiles {
+				marker := " "
+				if p.ID == current {
+					marker = "*"
+				}
+				line := fmt.Sprintf("%s %s  %s  %s/%s", marker, p.ID, p.Hostname, p.OS, p.Arch)
+				if p.Profile != "" {
+					line += "  profile:" + p.Profile
+				}
+				if len(p.Tags) > 0 {
+					line += "  tags:" + strings.Join(p.Tags, ",")
+				}
+				ui.Out.Println(redact.Text(line))
+			}
+			return nil
+		},
+	}
+	listCmd.Flags().BoolVar(&jsonOut, "json", false, "Print the profiles as JSON")
+
+	var showJSON bool
+	showCmd := &cobra.Command{
+		Use:   "show [id]",
+		Short: "Show one machine's profile, this machine's by default",
+		Long: `Print a machine's recorded profile. For this machine, also compare the
+recorded profile with the live identity and platform, and say when the next
+capture will update it.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			live := machine.NewProfile(machine.Current(a.plat), a.plat)
+			id := live.ID
+			if len(args) == 1 {
+				id = args[0]
+				if err := machine.ValidateID(id); err != nil {
+					return doterrors.NewUserError(err.Error())
+				}
+			}
+			p, err := machine.LoadProfile(cfg.RepoRoot(), id)
+			if errors.Is(err, os.ErrNotExist) {
+				if id != live.ID {
+					return doterrors.NewUserError(fmt.Sprintf("no profile for machine %q in %s; see dot machine list", id, machine.ProfilesDir))
+				}
+				p = nil
+			} else if err != nil {
+				return doterrors.Wrap(err, "show machine")
+			}
+			var drift []string
+			if id == live.ID {
+				drift = profileDrift(p, live)
+			}
+			if showJSON {
+				return ui.JSON(os.Stdout, map[string]any{"profile": p, "current": id == live.ID, "drift": drift})
+			}
+			shown := p
+			if shown == nil {
+				shown = live
+			}
+			ui.Out.Title("Machine " + redact.Text(id))
+			ui.Out.Printf("  Hostname: %s\n", redact.Text(shown.Hostname))
+			ui.Out.Printf("  Platform: %s/%s\n", shown.OS, shown.Arch)
+			if shown.Profile != "" {
+				ui.Out.Printf("  Profile: %s\n", redact.Text(shown.Profile))
+			}
+			if len(shown.Tags) > 0 {
+				ui.Out.Printf("  Tags: %s\n", redact.Text(strings.Join(shown.Tags, ", ")))
+			}
+			ui.Out.Printf("  File: %s\n", machine.ProfilePath(id))
+			switch {
+			case p == nil:
+				ui.Out.Println("  Not recorded yet; the next dot capture or dot sync writes it.")
+			case len(drift) > 0:
+				ui.Out.Printf("  Out of date (%s); the next dot capture or dot sync updates it.\n", strings.Join(drift, ", "))
+			}
+			return nil
+		},
+	}
+	showCmd.Flags().BoolVar(&showJSON, "json", false, "Print {profile, current, drift} as JSON")
+
+	machineCmd.AddCommand(listCmd, showCmd)
+	return machineCmd
+}
+
+// profileDrift names the fields where the recorded profile no longer
+// matches this machine; a missing profile has none to compare.
+func profileDrift(recorded, live *machine.Profile) []string {
+	drift := []string{}
+	if recorded == nil {
+		return drift
+	}
+	if recorded.Hostname != live.Hostname {
+		drift = append(drift, "hostname")
+	}
+	if recorded.Profile != live.Profile {
+		drift = append(drift, "profile")
+	}
+	if !slices.Equal(recorded.Tags, live.Tags) {
+		drift = append(drift, "tags")
+	}
+	if recorded.OS != live.OS || recorded.Arch != live.Arch {
+		drift = append(drift, "platform")
+	}
+	return drift
+}
+
+func cmdDrift(a *app) *cobra.Command {
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "drift <machine> [other]",
+		Short: "Compare this machine's captured state with another machine's",
+		Long: `Every dot capture and dot sync records this machine's state in its
+profile, state/machines/<id>.toml: the package lists of the enabled package
+managers, a hash of each managed file as it is in home (leaving out
+templates, private, and encrypted files), and the versions of dot, git,
+and chezmoi. dot drift compares this machine's profile with <machine>'s, or
+<machine>'s with [other]'s, and prints what differs. Pull first (dot sync)
+to compare against the other machine's latest capture.`,
+		Args: cobra.RangeArgs(1, 2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			cfg, _, err := a.loadConfigSilent()
+			if err != nil {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			profiles, _ := machine.LoadProfiles(cfg.RepoRoot())
+			var ids []string
+			for _, p := range profiles {
+				ids = append(ids, p.ID)
+			}
+			return ids, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			for _, id := range args {
+				if err := machine.ValidateID(id); err != nil {
+					return doterrors.NewUserError(err.Error())
+				}
+			}
+			ids := args
+			if len(ids) == 1 {
+				ids = []string{machine.Current(a.plat).ID, args[0]}
+			}
+			var profiles []*machine.Profile
+			for _, id := range ids {
+				p, err := machine.LoadProfile(cfg.RepoRoot(), id)
+				if errors.Is(err, os.ErrNotExist) {
+					return doterrors.NewUserError(fmt.Sprintf("no profile for machine %q in %s; dot capture or dot sync on that machine records one", id, machine.ProfilesDir))
+				}
+				if err != nil {
+					return doterrors.Wrap(err, "load machine profile")
+				}
+				profiles = append(profiles, p)
+			}
+			report := drift.Compare(profiles[0], profiles[1])
+			if jsonOut {
+				return ui.JSON(os.Stdout, report)
+			}
+			printDriftReport(report)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the differences as JSON")
+	return cmd
+}
+
+func printDriftReport(r *drift.Report) {
+	ui.Out.Title(redact.Text(fmt.Sprintf("Drift: %s vs %s", r.A, r.B)))
+	if r.Empty() {
+		ui.Out.Println("  No differences.")
+		return
+	}
+	orNone := func(v string) string { return firstNonEmpty(v, "(none)") }
+	if len(r.Tools) > 0 {
+		ui.Out.Println("Tools:")
+		for _, t := range r.Tools {
+			ui.Out.Println(redact.Text(fmt.Sprintf("  %s: %s | %s", t.Tool, orNone(t.A), orNone(t.B))))
+		}
+	}
+	if len(r.Packages) > 0 {
+		ui.Out.Println("Packages:")
+		for _, p := range r.Packages {
+			if p.OnlyOn != "" {
+				ui.Out.Println(redact.Text(fmt.Sprintf("  %s: captured only on %s", p.Manager, p.OnlyOn)))
+				continue
+			}
+			ui.Out.Printf("  %s:\n", p.Manager)
+			if len(p.OnlyA) > 0 {
+				ui.Out.Println(redact.Text(fmt.Sprintf("    only on %s: %s", r.A, strings.Join(p.OnlyA, ", "))))
+			}
+			if len(p.OnlyB) > 0 {
+				ui.Out.Println(redact.Text(fmt.Sprintf("    only on %s: %s", r.B, strings.Join(p.OnlyB, ", "))))
+			}
+		}
+	}
+	if len(r.Files) > 0 {
+		ui.Out.Println("Files:")
+		for _, f := range r.Files {
+			note := "differs"
+			switch {
+			case f.B == "":
+				note = "only on " + r.A
+			case f.A == "":
+				note = "only on " + r.B
+			}
+			ui.Out.Println(redact.Text(fmt.Sprintf("  ~/%s (%s)", f.Path, note)))
+		}
+	}
+}
+
+func cmdSchedule(a *app) *cobra.Command {
+	scheduleCmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Manage the OS-native scheduled sync: launchd, systemd user timer, or Scheduled Task",
+	}
+
+	var (
+		dotBin   string
+		interval int
+		noLoad   bool
+		dryRun   bool
+	)
+	installCmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install and enable scheduled dot sync every [sync].interval_minutes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			if dotBin == "" {
+				dotBin, err = os.Executable()
+				if err != nil {
+					return doterrors.Wrap(err, "resolve dot executable")
+				}
+			}
+			opts, err := schedule.OptionsFromConfig(cfg, dotBin)
+			if err != nil {
+				return doterrors.Wrap(err, "build schedule options")
+			}
+			if interval > 0 {
+				opts.IntervalMinutes = interval
+			}
+			opts.NoLoad = noLoad
+			mgr := schedule.NewManager(a.plat.Home, runner.New())
+			if dryRun {
+				status, err := mgr.Plan(opts)
+				if err != nil {
+					return wrapScheduleError(err)
+				}
+				printScheduleStatus("Schedule install plan", status)
+				return nil
+			}
+			status, err := mgr.Install(context.Background(), opts)
+			if err != nil {
+				return wrapScheduleError(err)
+			}
+			printScheduleStatus("Schedule installed", status)
+			return nil
+		},
+	}
+	installCmd.Flags().StringVar(&dotBin, "dot-bin", "", "Path to the dot binary the scheduler runs (defaults to current executable)")
+	installCmd.Flags().IntVar(&interval, "interval", 0, "Sync interval in minutes (defaults to sync.interval_minutes)")
+	installCmd.Flags().BoolVar(&noLoad, "no-load", false, "Write the job definition without registering it with the scheduler")
+	installCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the schedule plan without writing or registering anything")
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether scheduled sync is installed and registered",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr := schedule.NewManager(a.plat.Home, runner.New())
+			status, err := mgr.Inspect(context.Background())
+			if err != nil {
+				return wrapScheduleError(err)
+			}
+			printScheduleStatus("Schedule status", status)
+			return nil
+		},
+	}
+
+	removeCmd := &cobra.Command{
+		Use:     "uninstall",
+		Aliases: []string{"remove"},
+		Short:   "Unregister scheduled sync and remove its job files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr := schedule.NewManager(a.plat.Home, runner.New())
+			status, err := mgr.Remove(context.Background())
+			if err != nil {
+				return wrapScheduleError(err)
+			}
+			printScheduleStatus("Schedule removed", status)
+			return nil
+		},
+	}
+
+	scheduleCmd.AddCommand(installCmd, statusCmd, removeCmd)
+	return scheduleCmd
+}
+
+func cmdPurge(a *app) *cobra.Command {
+	var keepFiles, keepState, dryRun, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Uninstall dotstate from this machine, leaving the repo intact",
+		Long: `Remove the scheduled sync job, delete the files dot manages in home (and
+the managed directories that leaves empty), and delete local-only state:
+state/logs, state/backups, state/audit, and dotstate's cache. The repo and
+everything tracked in it stay, so dot apply restores the files. Nothing is
+removed without confirmation unless --yes is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			if status, err := (&daemon.Control{Dir: cfg.DaemonPath()}).Status(); err == nil && status.Running {
+				return doterrors.NewUserError(fmt.Sprintf("dot daemon is running (pid %d); stop it with dot daemon stop first", status.State.PID))
+			}
+
+			var managed []string
+			if !keepFiles {
+				managed, err = newEngine(cfg, a.plat, runner.New()).Managed(ctx, cfg.Repo.Path, cfg.Chex.SourceDir)
+				if err != nil {
+					return doterrors.Wrap(err, "list managed files")
+				}
+			}
+			var local []string
+			if !keepState {
+				local = purge.LocalDirs(cfg, a.plat)
+			}
+			plan, err := purge.NewPlan(a.plat.Home, cfg.RepoRoot(), managed, local)
+			if err != nil {
+				return doterrors.Wrap(err, "plan purge")
+			}
+			mgr := schedule.NewManager(a.plat.Home, runner.New())
+			sched, err := mgr.Inspect(ctx)
+			if err != nil && !errors.Is(err, schedule.ErrUnsupported) {
+				return wrapScheduleError(err)
+			}
+			hasSchedule := sched != nil && (sched.Installed || sched.Loaded)
+
+			ui.Out.Title("Purge plan")
+			if hasSchedule {
+				ui.Out.Printf("  Unregister scheduled sync %s\n", redact.Text(sched.Label))
+			}
+			for _, path := range append(plan.Files, plan.Dirs...) {
+				ui.Out.Printf("  Remove %s\n", redact.Text(tildePath(path, a.plat.Home)))
+			}
+			for _, dir := range plan.Local {
+				ui.Out.Printf("  Delete %s\n", redact.Text(tildePath(dir, a.plat.Home)))
+			}
+			if plan.Empty() && !hasSchedule {
+				ui.Out.Println("  Nothing to remove.")
+				return nil
+			}
+			ui.Out.Printf("  Keep %s\n", redact.Text(tildePath(cfg.RepoRoot(), a.plat.Home)))
+			if dryRun {
+				return nil
+			}
+			if !yes && !confirm(fmt.Sprintf("Remove the schedule and %d managed file(s) from home? [y/N] ", len(plan.Files)), false) {
+				return doterrors.NewUserError("purge cancelled")
+			}
+			if len(plan.Local) > 0 && !yes && !confirm("Delete local logs, backups, and caches? Backups cannot be recovered. [y/N] ", false) {
+				plan.Local = nil
+				ui.Out.Println("Keeping local state.")
+			}
+
+			if hasSchedule {
+				if _, err := mgr.Remove(ctx); err != nil {
+					return doterrors.Wrap(wrapScheduleError(err), "remove scheduled sync")
+				}
+				ui.Out.Println("Removed scheduled sync.")
+			}
+			if len(plan.Local) > 0 && a.logger != nil {
+				// The log file is in state/logs, and Windows cannot delete
+				// an open file.
+				a.logger.Close()
+				a.logger = nil
+			}
+			res, err := plan.Remove()
+			if res != nil {
+				ui.Out.Printf("Removed %d path(s).\n", len(res.Removed))
+				for _, dir := range res.Kept {
+					ui.Out.Printf("  Kept %s: it holds unmanaged files\n", redact.Text(tildePath(dir, a.plat.Home)))
+				}
+			}
+			if err != nil {
+				return doterrors.Wrap(err, "purge")
+			}
+			ui.Out.Printf("dotstate is removed from this machine; the repo at %s is untouched.\n", redact.Text(tildePath(cfg.RepoRoot(), a.plat.Home)))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&keepFiles, "keep-files", false, "Leave managed files in home")
+	cmd.Flags().BoolVar(&keepState, "keep-state", false, "Leave local logs, backups, audit state, and caches")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be removed without changing anything")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Remove everything without prompting")
+	return cmd
+}
+
+func cmdDaemon(a *app) *cobra.Command {
+	var interval int
+	var detach bool
+
+	daemonCmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run dot sync every [sync].interval_minutes from a long-running process",
+		Long: `Run in the foreground, syncing right away and then every
+[sync].interval_minutes. With [sync].enable_idle on macOS it also syncs once
+the machine has been idle for five minutes, and with enable_shutdown it
+syncs one last time when stopped by SIGINT or SIGTERM. Progress goes to the
+dot log; use dot daemon status, pause, resume, and stop to control it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			minutes := cfg.Sync.IntervalMinutes
+			if interval > 0 {
+				minutes = interval
+			}
+			if minutes <= 0 {
+				minutes = config.DefaultSyncInterval
+			}
+			control := &daemon.Control{Dir: cfg.DaemonPath()}
+
+			if detach {
+				return detachDaemon(cfg, control, interval)
+			}
+
+			d := &daemon.Daemon{
+				Control:        control,
+				Interval:       time.Duration(minutes) * time.Minute,
+				Sync:           a.daemonSync,
+				SyncOnShutdown: cfg.Sync.EnableShutdown,
+			}
+			if a.logger != nil {
+				d.Logger = a.logger.Slog()
+			}
+			if cfg.Sync.EnableIdle && a.plat.OS == platform.Darwin {
+				d.Idle = daemon.DarwinIdle(runner.New())
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			ui.Out.Printf("dot daemon running (pid %d), syncing every %d minutes; Ctrl-C to stop\n", os.Getpid(), minutes)
+			return d.Run(ctx)
+		},
+	}
+	daemonCmd.Flags().IntVar(&interval, "interval", 0, "Sync interval in minutes (defaults to sync.interval_minutes)")
+	daemonCmd.Flags().BoolVar(&detach, "detach", false, "Start the daemon in the background and return")
+
+	var jsonOut bool
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the daemon is running, paused, and when it last synced",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			status, err := (&daemon.Control{Dir: cfg.DaemonPath()}).Status()
+			if err != nil {
+				return doterrors.Wrap(err, "read daemon status")
+			}
+			if jsonOut {
+				return ui.JSON(os.Stdout, status)
+			}
+			printDaemonStatus(status)
+			return nil
+		},
+	}
+	statusCmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the status as JSON")
+
+	control := func(use, short, done string, fn func(*daemon.Control) error) *cobra.Command {
+		return &cobra.Command{
+			Use:   use,
+			Short: short,
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, _, err := a.loadConfig()
+				if err != nil {
+					return err
+				}
+				if err := fn(&daemon.Control{Dir: cfg.DaemonPath()}); err != nil {
+					return doterrors.Wrap(err, use+" daemon")
+				}
+				ui.Out.Println(done)
+				return nil
+			},
+		}
+	}
+	daemonCmd.AddCommand(
+		statusCmd,
+		control("pause", "Skip scheduled syncs until resumed", "Daemon paused; scheduled syncs are skipped until dot daemon resume.", (*daemon.Control).Pause),
+		control("resume", "Resume scheduled syncs", "Daemon resumed.", (*daemon.Control).Resume),
+		control("stop", "Ask the running daemon to exit", "Stop requested; the daemon exits within 15 seconds, after any sync in progress.", (*daemon.Control).Stop),
+	)
+	return daemonCmd
+}
+
+// daemonSync runs one dot sync for the daemon, reloading the config so
+// edits to dot.toml take effect without a restart.
+func (a *app) daemonSync(ctx context.Context, trigger string) error {
+	cfg, _, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+	report, err := newSyncer(cfg, a.plat).SyncWithReport(ctx, sync.Options{})
+	if report != nil {
+		for _, operation := range report.Operations {
+			a.logScriptResults(operation)
+		}
+	}
+	if err != nil {
+		if a.logger != nil {
+			a.logger.Error(supportbundle.SyncFailedMessage, "error", redact.Text(err.Error()), "trigger", trigger)
+		}
+		return err
+	}
+	if report.FallbackBranch != "" && a.logger != nil {
+		a.logger.Warn("push rejected; pushed to fallback branch", "branch", report.FallbackBranch, "pull_request", report.PullRequestURL)
+	}
+	a.runScheduledAudit(ctx, cfg)
+	a.runScheduledDiscover(ctx, cfg)
+	return nil
+}
+
+func cmdWatch(a *app) *cobra.Command {
+	var syncChanges bool
+	var debounce time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Capture edits to managed files as they happen",
+		Long: `Watch every managed file and run dot capture once edits settle, so the
+source state follows home within seconds. With --sync each batch runs a
+full dot sync instead, committing and pushing the edit for other machines.
+Runs in the foreground until interrupted.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			files := newFilesSyncer(cfg, a.plat, nil)
+			w := &watch.Watcher{
+				Debounce: debounce,
+				Targets: func(ctx context.Context) ([]string, error) {
+					return a.managedDestinations(ctx, cfg)
+				},
+				OnChange: func(ctx context.Context, changed []string) error {
+					names := make([]string, len(changed))
+					for i, path := range changed {
+						names[i] = redact.Text(tildePath(path, a.plat.Home))
+					}
+					ui.Out.Printf("%s changed: %s\n", time.Now().Format("15:04:05"), strings.Join(names, ", "))
+					if syncChanges {
+						if _, err := newSyncer(cfg, a.plat).SyncWithReport(ctx, sync.Options{}); err != nil {
+							ui.Out.Printf("  %s %s\n", ui.Err("sync failed:"), redact.Text(err.Error()))
+							return err
+						}
+						ui.Out.Println("  synced")
+						return nil
+					}
+					if _, err := files.CaptureWithOptions(ctx, sync.RunOptions{}); err != nil {
+						ui.Out.Printf("  %s %s\n", ui.Err("capture failed:"), redact.Text(err.Error()))
+						return err
+					}
+					ui.Out.Println("  captured")
+					return nil
+				},
+			}
+			if a.logger != nil {
+				w.Logger = a.logger.Slog()
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			action := "capturing"
+			if syncChanges {
+				action = "syncing"
+			}
+			ui.Out.Printf("Watching managed files, %s edits after %s of quiet; Ctrl-C to stop\n", action, w.Debounce)
+			return w.Run(ctx)
+		},
+	}
+	cmd.Flags().BoolVar(&syncChanges, "sync", false, "Run a full dot sync for each batch of edits instead of only capturing")
+	cmd.Flags().DurationVar(&debounce, "debounce", watch.DefaultDebounce, "Quiet period after the last edit before acting")
+	return cmd
+}
+
+// managedDestinations returns the absolute destination path of every file
+// chezmoi manages.
+func (a *app) managedDestinations(ctx context.Context, cfg *config.Config) ([]string, error) {
+	managed, err := newFilesSyncer(cfg, a.plat, nil).Chez.Managed(ctx, cfg.Repo.Path, cfg.Chex.SourceDir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(managed))
+	for i, target := range managed {
+		paths[i] = filepath.Join(a.plat.Home, filepath.FromSlash(target))
+	}
+	return paths, nil
+}
+
+func detachDaemon(cfg *config.Config, control *daemon.Control, interval int) error {
+	status, err := control.Status()
+	if err != nil {
+		return doterrors.Wrap(err, "read daemon status")
+	}
+	if status.Running {
+		return doterrors.NewUserError(fmt.Sprintf("dot daemon is already running (pid %d)", status.State.PID))
+	}
+	bin, err := os.Executable()
+	if err != nil {
+		return doterrors.Wrap(err, "resolve dot executable")
+	}
+	configPath, err := filepath.Abs(cfg.ConfigPath())
+	if err != nil {
+		return doterrors.Wrap(err, "resolve config path")
+	}
+	args := []string{"--config", configPath, "daemon"}
+	if interval > 0 {
+		args = append(args, "--interval", strconv.Itoa(interval))
+	}
+	logPath := filepath.Join(cfg.DaemonPath(), "daemon.out")
+	pid, err := daemon.Detach(bin, args, logPath)
+	if err != nil {
+		return doterrors.Wrap(err, "detach daemon")
+	}
+	ui.Out.Printf("dot daemon started in the background (pid %d); output goes to %s\n", pid, redact.Text(logPath))
+	return nil
+}
+
+func printDaemonStatus(status *daemon.Status) {
+	const stamp = "2006-01-02 15:04:05"
+	ui.Out.Title("Daemon status")
+	state := status.State
+	switch {
+	case status.Running:
+		ui.Out.Printf("  Running: yes (pid %d since %s)\n", state.PID, state.StartedAt.Local().Format(stamp))
+	case state != nil && !state.StoppedAt.IsZero():
+		ui.Out.Printf("  Running: no (stopped %s)\n", state.StoppedAt.Local().Format(stamp))
+	case state != nil:
+		ui.Out.Printf("  Running: no (pid %d exited without stopping cleanly)\n", state.PID)
+	default:
+		ui.Out.Println("  Running: no (never started)")
+	}
+	ui.Out.Printf("  Paused: %t\n", status.Paused)
+	if state == nil {
+		return
+	}
+	ui.Out.Printf("  Interval: %d minutes\n", state.IntervalMinutes)
+	if !state.LastSync.IsZero() {
+		result := "ok"
+		if state.LastError != "" {
+			result = "failed: " + state.LastError
+		}
+		ui.Out.Printf("  Last sync: %s (%s) %s\n", state.LastSync.Local().Format(stamp), state.LastTrigger, redact.Text(result))
+	}
+	if status.Running && !status.Paused && !state.NextSync.IsZero() {
+		ui.Out.Printf("  Next sync: %s\n", state.NextSync.Local().Format(stamp))
+	}
+}
+
+func wrapScheduleError(err error) error {
+	if errors.Is(err, schedule.ErrUnsupported) {
+		return doterrors.WithCode(err, doterrors.ExitUnavailable)
+	}
+	return err
+}
+
+func printScheduleStatus(title string, status *schedule.Status) {
+	ui.Out.Title(title)
+	if status == nil {
+		ui.Out.Println("  No schedule status available.")
+		return
+	}
+	ui.Out.Printf("  Label: %s\n", redact.Text(status.Label))
+	ui.Out.Printf("  Path: %s\n", redact.Text(status.Path))
+	ui.Out.Printf("  Installed: %t\n", status.Installed)
+	ui.Out.Printf("  Loaded: %t\n", status.Loaded)
+	if status.IntervalMinutes > 0 {
+		ui.Out.Printf("  Interval: %d minutes\n", status.IntervalMinutes)
+	}
+	if len(status.ProgramArgs) > 0 {
+		ui.Out.Printf("  Command: %s\n", strings.Join(redactStrings(status.ProgramArgs), " "))
+	}
+	if status.Message != "" {
+		ui.Out.Printf("  Note: %s\n", redact.Text(status.Message))
+	}
+}
+
+func redactStrings(values []string) []string {
+	out := make([]string, len(values))
+	for i, value := range values {
+		out[i] = redact.Text(value)
+	}
+	return out
+}
+
+func cmdSecrets(a *app) *cobra.Command {
+	secretsCmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Check the repo and managed files for secrets",
+	}
+	scanCmd := cmdScan(a)
+	scanCmd.Long = `Scan the repo source tree for secrets with the built-in patterns, plus
+gitleaks when it is installed, and print findings grouped by confidence.
+--destinations also scans the live files chezmoi manages in home. Exits 1
+when a finding meets [secrets] fail_on, so CI can gate on it. Same as dot
+scan.`
+	secretsCmd.AddCommand(scanCmd)
+	return secretsCmd
+}
+
+// scanExcludes are local-only or ciphertext directories skipped by dot scan.
+var scanExcludes = []string{"state/backups", "state/logs", "state/encrypted", "state/e2e-runs"}
+
+func cmdScan(a *app) *cobra.Command {
+	var history bool
+	var revRange string
+	var destinations bool
+	var jsonOut bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "scan",
+		Short: "Audit the whole repo (and optionally git history) for secrets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if jsonOut {
+				format = "json"
+			}
+			switch format {
+			case "text", "json", "sarif":
+			default:
+				return doterrors.NewUserError(fmt.Sprintf("invalid --format %q (expected: text, json, sarif)", format))
+			}
+
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			opts := discover.RepoScanOptions{History: history || revRange != "", Range: revRange}
+			if destinations {
+				if opts.Destinations, err = a.managedDestinations(cmd.Context(), cfg); err != nil {
+					return doterrors.Wrap(err, "list managed files")
+				}
+				opts.Home = a.plat.Home
+			}
+			report, err := scanRepo(cmd.Context(), cfg, opts)
+			if err != nil {
+				return doterrors.Wrap(err, "scan failed")
+			}
+
+			switch format {
+			case "json":
+				if err := ui.JSON(os.Stdout, report); err != nil {
+					return err
+				}
+			case "sarif":
+				b, err := report.SARIF(version)
+				if err != nil {
+					return err
+				}
+				ui.Out.Println(redact.Text(string(b)))
+			default:
+				printScanReport(report)
+			}
+			failing := 0
+			for _, f := range report.Findings {
+				if discover.MeetsThreshold(f.Confidence, cfg.Secrets.FailOn) {
+					failing++
+				}
+			}
+			if failing > 0 {
+				return doterrors.WithCode(fmt.Errorf("%d potential secret(s) found", failing), doterrors.ExitError)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&history, "history", false, "Also scan lines added by every commit reachable from HEAD")
+	cmd.Flags().StringVar(&revRange, "range", "", "Scan only commits in this git revision range (implies --history)")
+	cmd.Flags().BoolVar(&destinations, "destinations", false, "Also scan the live destination files chezmoi manages")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the findings report as JSON (same as --format json)")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format: text, json, sarif")
+	return cmd
+}
+
+// scanRepo runs the secret scan over the repo with opts, filling in the
+// root, excludes, and git.
+func scanRepo(ctx context.Context, cfg *config.Config, opts discover.RepoScanOptions) (*discover.ScanReport, error) {
+	r := runner.New()
+	detector := discover.NewSecretDetector(r)
+	if err := detector.UseGitleaksConfig(filepath.Join(cfg.Repo.Path, discover.GitleaksConfigFile)); err != nil {
+		return nil, err
+	}
+	opts.Root = cfg.Repo.Path
+	opts.Exclude = scanExcludes
+	opts.Git = gitx.New(cfg.Tools.Git, r)
+	return detector.ScanRepo(ctx, opts)
+}
+
+// runScheduledAudit runs the [audit] secret scan from a scheduled sync when
+// it is due. Failures are logged, never returned, so they cannot fail sync.
+func (a *app) runScheduledAudit(ctx context.Context, cfg *config.Config) {
+	if cfg.Audit.IntervalHours <= 0 {
+		return
+	}
+	result, err := secretaudit.Run(ctx, secretaudit.Options{
+		StatePath: cfg.AuditStatePath(),
+		Interval:  time.Duration(cfg.Audit.IntervalHours) * time.Hour,
+		Scan: func(ctx context.Context) (*discover.ScanReport, error) {
+			return scanRepo(ctx, cfg, discover.RepoScanOptions{History: true})
+		},
+		Notifiers: notifiers(cfg.Audit.WebhookURL, cfg.Audit.Notify),
+	})
+	if a.logger == nil {
+		return
+	}
+	if err != nil {
+		a.logger.Error("scheduled secret audit failed", "error", redact.Text(err.Error()))
+		return
+	}
+	for _, notifyErr := range result.NotifyErrors {
+		a.logger.Error("secret audit notification failed", "error", redact.Text(notifyErr.Error()))
+	}
+	if result.Ran {
+		a.logger.Info("scheduled secret audit complete", "findings", len(result.Report.Findings), "new", len(result.NewFindings))
+	}
+}
+
+// notifiers returns the webhook and desktop channels a scheduled job
+// alerts through.
+func notifiers(webhookURL string, desktop bool) []secretaudit.Notifier {
+	var out []secretaudit.Notifier
+	if webhookURL != "" {
+		out = append(out, &secretaudit.WebhookNotifier{URL: webhookURL})
+	}
+	if desktop {
+		out = append(out, &secretaudit.DesktopNotifier{OS: runtime.GOOS, Runner: runner.New()})
+	}
+	return out
+}
+
+// runScheduledDiscover runs the [discover] quiet discovery pass from a
+// scheduled sync when it is due, recording recommended files for
+// dot discover --pending. Failures are logged, never returned.
+func (a *app) runScheduledDiscover(ctx context.Context, cfg *config.Config) {
+	if cfg.Discover.IntervalHours <= 0 {
+		return
+	}
+	opts := discover.DefaultOptions()
+	opts.Platform = a.plat
+	opts.LargeFileSize = cfg.Discover.LargeFileSize
+	scheduled := discover.ScheduledOptions{
+		StatePath: cfg.DiscoverPendingPath(),
+		Interval:  time.Duration(cfg.Discover.IntervalHours) * time.Hour,
+		Host:      machine.Current(a.plat).Hostname,
+		Scan: func(ctx context.Context) (discover.CandidateList, error) {
+			disc, err := discover.NewDiscoverer(cfg, opts)
+			if err != nil {
+				return nil, err
+			}
+			return disc.ScanRecommended(ctx, opts)
+		},
+	}
+	if channels := notifiers(cfg.Discover.WebhookURL, cfg.Discover.Notify); len(channels) > 0 {
+		scheduled.Notify = func(ctx context.Context, title, message string, candidates []discover.PendingCandidate) []error {
+			redacted := make([]discover.PendingCandidate, len(candidates))
+			for i, c := range candidates {
+				c.RelPath = redact.Text(c.RelPath)
+				c.Reasons = redactStrings(c.Reasons)
+				redacted[i] = c
+			}
+			alert := secretaudit.Alert{Title: title, Message: redact.Text(message), Candidates: redacted}
+			var errs []error
+			for _, n := range channels {
+				if err := n.Notify(ctx, alert); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			return errs
+		}
+	}
+	result, err := discover.RunScheduled(ctx, scheduled)
+	if a.logger == nil {
+		return
+	}
+	if err != nil {
+		a.logger.Error("scheduled discovery failed", "error", redact.Text(err.Error()))
+		return
+	}
+	for _, notifyErr := range result.NotifyErrors {
+		a.logger.Error("discovery notification failed", "error", redact.Text(notifyErr.Error()))
+	}
+	if result.Ran {
+		a.logger.Info("scheduled discovery complete", "pending", len(result.Pending.Candidates), "new", len(result.New))
+	}
+}
+
+func printScanReport(report *discover.ScanReport) {
+	ui.Out.Title("Secret scan")
+	ui.Out.Printf("  Scanners: %s\n", strings.Join(report.Scanners, ", "))
+	ui.Out.Printf("  Files scanned: %d\n", report.FilesScanned)
+	if report.CommitsScanned > 0 {
+		ui.Out.Printf("  Commits scanned: %d\n", report.CommitsScanned)
+	}
+	if report.DestinationsScanned > 0 {
+		ui.Out.Printf("  Destination files scanned: %d\n", report.DestinationsScanned)
+	}
+	if len(report.Findings) == 0 {
+		ui.Out.Println("  No findings.")
+	}
+	// Group findings strongest first; a confidence outside the known
+	// levels sorts last under its own heading.
+	findings := slices.Clone(report.Findings)
+	slices.SortStableFunc(findings, func(x, y discover.SecretFinding) int {
+		return discover.ConfidenceRank(y.Confidence) - discover.ConfidenceRank(x.Confidence)
+	})
+	for i, f := range findings {
+		if i == 0 || f.Confidence != findings[i-1].Confidence {
+			count := 0
+			for _, other := range findings[i:] {
+				if other.Confidence == f.Confidence {
+					count++
+				}
+			}
+			heading := "Unknown"
+			if f.Confidence != "" {
+				heading = strings.ToUpper(f.Confidence[:1]) + f.Confidence[1:]
+			}
+			ui.Out.Printf("  %s confidence (%d):\n", redact.Text(heading), count)
+		}
+		location := fmt.Sprintf("%s:%d", f.File, f.Line)
+		if f.Commit != "" {
+			location = shortCommit(f.Commit) + " " + location
+		}
+		ui.Out.Printf("    - %s %s\n", redact.Text(location), redact.Text(f.PatternID))
+		for _, line := range f.FormatContext() {
+			ui.Out.Printf("        %s\n", redact.Text(line))
+		}
+	}
+	for _, diag := range report.Diagnostics {
+		ui.Out.Printf("  diagnostic %s: %s\n", redact.Text(diag.Code), redact.Text(diag.Message))
+	}
+}
+
+func cmdSubrepo(a *app) *cobra.Command {
+	subrepoCmd := &cobra.Command{
+		Use:   "subrepo",
+		Short: "Manage sub-repositories tracked by dotstate",
+	}
+	var listJSON bool
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the sub-repositories declared in state/subrepos.toml",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfigSilent()
+			if err != nil {
+				return err
+			}
+			statuses, err := macos.SubrepoStatuses(cfg, a.plat.Home)
+			if err != nil {
+				return err
+			}
+			if listJSON {
+				entries := make([]subrepoListEntry, 0, len(statuses))
+				for _, status := range statuses {
+					entries = append(entries, subrepoListEntry{
+						Path:        status.Path,
+						URL:         status.URL,
+						Branch:      status.Branch,
+						Depth:       status.Entry.CloneDepth(),
+						Description: status.Entry.Description,
+						Status:      status.Status,
+					})
+				}
+				return ui.JSON(os.Stdout, entries)
+			}
+			ui.Out.Title("Subrepos")
+			if len(statuses) == 0 {
+				ui.Out.Println("  No subrepos declared in state/subrepos.toml")
+				ui.Out.Println("  Declare one with 'dot subrepo add <path>'.")
+				return nil
+			}
+			for _, status := range statuses {
+				branch := status.Branch
+				if branch == "" {
+					branch = "default"
+				}
+				depth := "full history"
+				if d := status.Entry.CloneDepth(); d > 0 {
+					depth = fmt.Sprintf("depth %d", d)
+				}
+				ui.Out.Printf("  %s -> %s [%s, %s] %s\n", redact.Text(status.Path), redact.Text(status.URL), branch, depth, status.Status)
+				if status.Entry.Description != "" {
+					ui.Out.Printf("    %s\n", redact.Text(status.Entry.Description))
+				}
+			}
+			return nil
+		},
+	}
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "Emit the declared subrepos as JSON")
+
+	var addURL, addBranch, addDescription string
+	var addDepth int
+	var addFull bool
+	addCmd := &cobra.Command{
+		Use:   "add <path>",
+		Short: "Declare a sub-repository in state/subrepos.toml",
+		Long: `Declare the git repository at <path> under home as a subrepo, so dot apply
+clones it on machines where it is missing and keeps it up to date. When
+<path> is already a clone, its origin URL and current branch are used unless
+--url or --branch say otherwise; --branch pins the entry to that branch.
+Declaring a path again replaces its entry. The manifest change is committed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if addFull && cmd.Flags().Changed("depth") {
+				return doterrors.NewUserError("--full and --depth cannot be used together")
+			}
+			if addDepth < 0 {
+				return doterrors.NewUserError("--depth must be at least 1")
+			}
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			g := gitx.New(cfg.Tools.Git, runner.New())
+			if err := requireCleanRepo(ctx, g, cfg.RepoRoot(), "changing subrepos"); err != nil {
+				return err
+			}
+			entry := discover.SubRepoManifest{Path: args[0], URL: addURL, Branch: addBranch, Description: addDescription, Depth: addDepth}
+			if addFull {
+				shallow := false
+				entry.Shallow = &shallow
+			}
+			dest := expandTargets(args, a.plat.Home)[0]
+			cloned := false
+			if _, err := os.Stat(filepath.Join(dest, ".git")); err == nil {
+				cloned = true
+				if entry.URL == "" {
+					if entry.URL, err = g.RemoteURL(ctx, dest); err != nil {
+						return doterrors.NewUserError(fmt.Sprintf("%s has no origin remote; pass --url", args[0]))
+					}
+				}
+				if entry.Branch == "" {
+					if branch, err := g.CurrentBranch(ctx, dest); err == nil && branch != "HEAD" {
+						entry.Branch = branch
+					}
+				}
+			} else if entry.URL == "" {
+				return doterrors.NewUserError(fmt.Sprintf("%s is not a git clone; pass --url to declare it", args[0]))
+			}
+			manifestPath := filepath.Join(cfg.StatePath(), "subrepos.toml")
+			stored, replaced, err := discover.AddSubRepo(manifestPath, a.plat.Home, entry)
+			if err != nil {
+				return doterrors.Wrap(err, "declare subrepo")
+			}
+			verb := "track"
+			if replaced {
+				verb = "update"
+			}
+			id := machine.Current(a.plat)
+			message := gitx.WithMachineTrailer(fmt.Sprintf("subrepo: %s %s", verb, stored.Path), id.ID)
+			if _, err := g.Commit(ctx, cfg.RepoRoot(), message); err != nil {
+				return doterrors.Wrap(err, "commit subrepo manifest")
+			}
+			branch := stored.Branch
+			if branch == "" {
+				branch = "default"
+			}
+			ui.Out.Printf("Declared %s -> %s [%s].\n", redact.Text(stored.Path), redact.Text(stored.URL), branch)
+			if stored.URL != strings.TrimSpace(entry.URL) {
+				ui.Out.Println("Credentials were removed from the remote URL.")
+			}
+			if !cloned {
+				ui.Out.Println("Run 'dot subrepo update' to clone it here.")
+			}
+			return nil
+		},
+	}
+	addCmd.Flags().StringVar(&addURL, "url", "", "Remote to clone from (default: the clone's origin)")
+	addCmd.Flags().StringVar(&addBranch, "branch", "", "Branch to pin (default: the clone's current branch, else the remote default)")
+	addCmd.Flags().StringVar(&addDescription, "description", "", "Note stored with the entry")
+	addCmd.Flags().IntVar(&addDepth, "depth", 0, "Commits a shallow clone fetches (default 1)")
+	addCmd.Flags().BoolVar(&addFull, "full", false, "Clone with full history instead of shallow")
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <path>",
+		Short: "Stop tracking a sub-repository",
+		Long: `Remove a subrepo's entry from state/subrepos.toml and commit the change.
+The clone itself is left in place.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			statuses, err := macos.SubrepoStatuses(cfg, a.plat.Home)
+			if err != nil {
+				return err
+			}
+			found, err := a.findSubrepo(statuses, args[0])
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			g := gitx.New(cfg.Tools.Git, runner.New())
+			if err := requireCleanRepo(ctx, g, cfg.RepoRoot(), "changing subrepos"); err != nil {
+				return err
+			}
+			if err := discover.RemoveSubRepo(filepath.Join(cfg.StatePath(), "subrepos.toml"), found.Path); err != nil {
+				return doterrors.Wrap(err, "remove subrepo")
+			}
+			id := machine.Current(a.plat)
+			message := gitx.WithMachineTrailer(fmt.Sprintf("subrepo: stop tracking %s", found.Path), id.ID)
+			if _, err := g.Commit(ctx, cfg.RepoRoot(), message); err != nil {
+				return doterrors.Wrap(err, "commit subrepo manifest")
+			}
+			ui.Out.Printf("Stopped tracking %s.\n", redact.Text(found.Path))
+			if found.Exists {
+				ui.Out.Printf("The clone at %s was left in place.\n", redact.Text(tildePath(found.Dest, a.plat.Home)))
+			}
+			return nil
+		},
+	}
+
+	var updateJSON bool
+	updateCmd := &cobra.Command{
+		Use:   "update [path...]",
+		Short: "Clone missing subrepos and fast-forward present ones",
+		Long: `Bring each subrepo, or only those named, in line with its entry in
+state/subrepos.toml, as dot apply does: missing ones are cloned, and present
+ones are fetched, switched to their pinned branch, and fast-forwarded.
+Subrepos with uncommitted changes, no upstream, or diverged history are
+skipped and reported. Exits 1 if any update failed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			statuses, err := macos.SubrepoStatuses(cfg, a.plat.Home)
+			if err != nil {
+				return err
+			}
+			selected := statuses
+			if len(args) > 0 {
+				selected = nil
+				for _, arg := range args {
+					found, err := a.findSubrepo(statuses, arg)
+					if err != nil {
+						return err
+					}
+					selected = append(selected, *found)
+				}
+			}
+			g := gitx.New(cfg.Tools.Git, runner.New())
+			updates := make([]macos.SubrepoUpdate, 0, len(selected))
+			failed := 0
+			for i := range selected {
+				u := selected[i].Update(cmd.Context(), g)
+				if u.Outcome == macos.SubrepoFailed {
+					failed++
+				}
+				updates = append(updates, u)
+			}
+			if updateJSON {
+				if err := ui.JSON(os.Stdout, updates); err != nil {
+					return err
+				}
+			} else {
+				ui.Out.Title("Subrepo update")
+				if len(updates) == 0 {
+					ui.Out.Println("  No subrepos declared in state/subrepos.toml")
+				}
+				for _, u := range updates {
+					line := fmt.Sprintf("  %s: %s", redact.Text(u.Path), u.Outcome)
+					if u.Detail != "" {
+						line += " (" + redact.Text(u.Detail) + ")"
+					}
+					ui.Out.Println(line)
+				}
+			}
+			if failed > 0 {
+				return doterrors.WithCode(fmt.Errorf("%d subrepo update(s) failed", failed), doterrors.ExitError)
+			}
+			return nil
+		},
+	}
+	updateCmd.Flags().BoolVar(&updateJSON, "json", false, "Emit the per-subrepo outcomes as JSON")
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Report state/subrepos.toml clone status and git drift",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			statuses, err := macos.SubrepoStatuses(cfg, a.plat.Home)
+			if err != nil {
+				return err
+			}
+			ui.Out.Title("Subrepo status")
+			if len(statuses) == 0 {
+				ui.Out.Println("  No subrepos declared in state/subrepos.toml")
+				return nil
+			}
+			g := gitx.New(cfg.Tools.Git, runner.New())
+			for _, status := range statuses {
+				url := redact.Text(status.URL)
+				if url == "" {
+					url = "(no remote)"
+				}
+				branch := status.Branch
+				if branch == "" {
+					branch = "default"
+				}
+				ui.Out.Printf("  %s: %s [%s] %s\n", redact.Text(status.Path), status.Status, branch, url)
+				if err := status.Inspect(cmd.Context(), g); err != nil {
+					ui.Out.Printf("    could not read git state: %s\n", redact.Text(err.Error()))
+					continue
+				}
+				if drift := status.Drift(); len(drift) > 0 {
+					ui.Out.Printf("    drift: %s\n", strings.Join(drift, ", "))
+				}
+			}
+			return nil
+		},
+	}
+	unshallowCmd := &cobra.Command{
+		Use:   "unshallow <path>",
+		Short: "Fetch the full history of a shallow-cloned subrepo",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			statuses, err := macos.SubrepoStatuses(cfg, a.plat.Home)
+			if err != nil {
+				return err
+			}
+			found, err := a.findSubrepo(statuses, args[0])
+			if err != nil {
+				return err
+			}
+			if !found.IsGitRepo {
+				return doterrors.NewUserError(fmt.Sprintf("%s is not cloned yet; run dot apply first", found.Path))
+			}
+			g := gitx.New(cfg.Tools.Git, runner.New())
+			ctx := cmd.Context()
+			shallow, err := g.IsShallow(ctx, found.Dest)
+			if err != nil {
+				return doterrors.Wrap(err, "check subrepo history")
+			}
+			if !shallow {
+				ui.Out.Printf("%s already has its full history.\n", redact.Text(found.Path))
+				return nil
+			}
+			if err := g.Unshallow(ctx, found.Dest); err != nil {
+				return doterrors.Wrap(err, "unshallow subrepo")
+			}
+			ui.Out.Printf("Fetched the full history of %s.\n", redact.Text(found.Path))
+			ui.Out.Println("Set shallow = false on its state/subrepos.toml entry to clone it in full on other machines.")
+			return nil
+		},
+	}
+	var force bool
+	convertCmd := &cobra.Command{
+		Use:   "convert <path>",
+		Short: "Track a subrepo as a git submodule of the dotfiles repo",
+		Long: `Replace a state/subrepos.toml entry with a git submodule of the dotfiles
+repo, placed at the source state path for the subrepo's target so apply
+writes its files in place. The submodule is added, .gitmodules updated, the
+manifest entry removed, and the result committed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			statuses, err := macos.SubrepoStatuses(cfg, a.plat.Home)
+			if err != nil {
+				return err
+			}
+			found, err := a.findSubrepo(statuses, args[0])
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			g := gitx.New(cfg.Tools.Git, runner.New())
+			if err := requireCleanRepo(ctx, g, cfg.RepoRoot(), "converting a subrepo"); err != nil {
+				return err
+			}
+			if err := found.Inspect(ctx, g); err != nil {
+				return doterrors.Wrap(err, "check subrepo state")
+			}
+			// The submodule is cloned from the remote; local commits and
+			// edits would be overwritten by the next apply.
+			if (found.Dirty || found.Ahead > 0) && !force {
+				return doterrors.NewUserError(fmt.Sprintf("%s has work that is not on its remote (%s); push it first or pass --force",
+					found.Path, strings.Join(found.Drift(), ", ")))
+			}
+			subPath, err := discover.ConvertToSubmodule(ctx, cfg, g, a.plat.Home, found.Entry)
+			if err != nil {
+				return doterrors.Wrap(err, "convert subrepo")
+			}
+			id := machine.Current(a.plat)
+			message := gitx.WithMachineTrailer(fmt.Sprintf("subrepo: track %s as a git submodule", found.Path), id.ID)
+			if _, err := g.Commit(ctx, cfg.RepoRoot(), message); err != nil {
+				return doterrors.Wrap(err, "commit submodule")
+			}
+			ui.Out.Printf("Tracked %s as a git submodule at %s.\n", redact.Text(found.Path), redact.Text(subPath))
+			ui.Out.Println("Other clones of the dotfiles repo need 'git submodule update --init' to fetch it.")
+			return nil
+		},
 	}
+	convertCmd.Flags().BoolVar(&force, "force", false, "Convert even if the subrepo has uncommitted or unpushed work")
+	subrepoCmd.AddCommand(listCmd, addCmd, removeCmd, updateCmd, statusCmd, unshallowCmd, convertCmd)
+	return subrepoCmd
 }
 
-func joinCapabilities(capabilities []modules.Capability) string {
-	parts := make([]string, 0, len(capabilities))
-	for _, capability := range capabilities {
-		parts = append(parts, string(capability))
+// subrepoListEntry is one manifest entry as dot subrepo list --json prints
+// it; Depth is 0 for a full clone.
+type subrepoListEntry struct {
+	Path        string `json:"path"`
+	URL         string `json:"url"`
+	Branch      string `json:"branch,omitempty"`
+	Depth       int    `json:"depth"`
+	Description string `json:"description,omitempty"`
+	Status      string `json:"status"`
+}
+
+// requireCleanRepo refuses to go on while the dotfiles repo has uncommitted
+// changes, since the commit that follows would sweep them in.
+func requireCleanRepo(ctx context.Context, g *gitx.Git, repoPath, doing string) error {
+	dirty, err := g.HasChanges(ctx, repoPath)
+	if err != nil {
+		return doterrors.Wrap(err, "check repo status")
 	}
-	return strings.Join(parts, ",")
+	if dirty {
+		return doterrors.NewUserError("the dotfiles repo has uncommitted changes; commit or stash them before " + doing)
+	}
+	return nil
 }
 
-func cmdMacOS(a *app) *cobra.Command {
-	macosCmd := &cobra.Command{
-		Use:   "macos",
-		Short: "macOS-specific state commands",
+// findSubrepo returns the status of the subrepo declared as arg, matching
+// either its manifest path or the directory it expands to.
+func (a *app) findSubrepo(statuses []macos.SubrepoStatus, arg string) (*macos.SubrepoStatus, error) {
+	dest := expandTargets([]string{arg}, a.plat.Home)[0]
+	for i := range statuses {
+		if statuses[i].Path == arg || filepath.Clean(statuses[i].Dest) == dest {
+			return &statuses[i], nil
+		}
 	}
+	return nil, doterrors.NewUserError(fmt.Sprintf("%s is not declared in state/subrepos.toml", arg))
+}
 
-	var jsonOut bool
-	auditCmd := &cobra.Command{
-		Use:   "audit",
-		Short: "Audit macOS state without mutating it",
+func cmdRepo(a *app) *cobra.Command {
+	repoCmd := &cobra.Command{
+		Use:   "repo",
+		Short: "Inspect and maintain the dotfiles repo",
+	}
+
+	var (
+		top     int
+		months  int
+		jsonOut bool
+	)
+	sizeCmd := &cobra.Command{
+		Use:   "size",
+		Short: "Report the largest files, growth over time, and state/ contributors",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if !jsonOut {
-				return doterrors.NewUserError("dot macos audit currently requires --json")
+			cfg, _, err := a.loadConfig()
+			if err != nil {
+				return err
+			}
+			report, err := reposize.Analyze(cmd.Context(), gitx.New(cfg.Tools.Git, runner.New()), cfg.Repo.Path, reposize.Options{
+				Top:          top,
+				Months:       months,
+				LFSThreshold: cfg.Discover.LargeFileSize,
+			})
+			if err != nil {
+				return doterrors.Wrap(err, "repo size analysis failed")
 			}
-			host, _ := os.Hostname()
+			if jsonOut {
+				return ui.JSON(os.Stdout, report)
+			}
+			printRepoSize(report)
+			return nil
+		},
+	}
+	sizeCmd.Flags().IntVar(&top, "top", reposize.DefaultTop, "Number of files to list in each ranking")
+	sizeCmd.Flags().IntVar(&months, "months", reposize.DefaultMonths, "Number of months of growth to show")
+	sizeCmd.Flags().BoolVar(&jsonOut, "json", false, "Emit the report as JSON")
+	repoCmd.AddCommand(sizeCmd)
+	repoCmd.AddCommand(cmdRepoCompact(a))
+	repoCmd.AddCommand(cmdRepoCreate(a))
+	return repoCmd
+}
+
+func cmdRepoCreate(a *app) *cobra.Command {
+	var public bool
+	cmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create the remote repository on GitHub or GitLab",
+		Long: "Create a repository owned by the [forge] token's account and, when the local repo has no " +
+			"origin remote, add the new repository as origin.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfigSilent()
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
 			r := runner.New()
-			opts := macos.AuditOptions{
-				GOOS:        runtime.GOOS,
-				Arch:        runtime.GOARCH,
-				Host:        host,
-				GeneratedAt: time.Now(),
-				Runner:      r,
-				HomeDir:     a.plat.Home,
+			f, err := newForge(ctx, cfg, a.plat, r)
+			if err != nil {
+				return doterrors.NewConfigError("forge not configured", err)
 			}
-			if cfg, _, err := a.loadConfigSilent(); err == nil {
-				opts.RepoRoot = cfg.RepoRoot()
-				opts.BrewfilePath = filepath.Join(cfg.StatePath(), "macos", "brew", "Brewfile")
-				opts.ExtraModules = []modules.Module{
-					modules.NewFilesModule(cfg, chez.New(cfg.Tools.Chezmoi, r), a.plat.Home),
+			repo, err := f.CreateRepo(ctx, args[0], !public)
+			if err != nil {
+				return doterrors.Wrap(err, "create repository")
+			}
+			ui.Out.Printf("Created %s: %s\n", redact.Text(repo.Project), redact.Text(repo.WebURL))
+
+			g := gitx.New(cfg.Tools.Git, r)
+			if origin, _ := g.RemoteURL(ctx, cfg.Repo.Path); origin == "" {
+				if err := g.AddRemote(ctx, cfg.Repo.Path, "origin", repo.SSHURL); err != nil {
+					return doterrors.Wrap(err, "add origin remote")
 				}
+				ui.Out.Printf("Added origin %s\n", redact.Text(repo.SSHURL))
 			}
-			envelope := macos.NewAudit(cmd.Context(), opts)
-			enc := json.NewEncoder(os.Stdout)
-			enc.SetIndent("", "  ")
-			return enc.Encode(envelope)
+			if cfg.Repo.URL == "" {
+				ui.Out.Printf("Set [repo] url = %q in dot.toml so other machines can bootstrap from it.\n", repo.SSHURL)
+			}
+			return nil
 		},
 	}
-	auditCmd.Flags().BoolVar(&jsonOut, "json", false, "Emit dotstate.audit.v1 JSON")
-
-	macosCmd.AddCommand(auditCmd)
-	return macosCmd
+	cmd.Flags().BoolVar(&public, "public", false, "Create a public repository (default private)")
+	return cmd
 }
 
-func cmdSchedule(a *app) *cobra.Command {
-	scheduleCmd := &cobra.Command{
-		Use:   "schedule",
-		Short: "Manage the dotstate macOS user LaunchAgent",
+func cmdForge(a *app) *cobra.Command {
+	forgeCmd := &cobra.Command{
+		Use:   "forge",
+		Short: "Use the GitHub or GitLab API configured in [forge]",
+	}
+	var title string
+	sshKeyCmd := &cobra.Command{
+		Use:   "ssh-key [public-key-file]",
+		Short: "Upload an SSH public key to the forge account",
+		Long:  "Upload an SSH public key (default ~/.ssh/id_ed25519.pub) to the account of the [forge] token.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfigSilent()
+			if err != nil {
+				return err
+			}
+			path := filepath.Join(a.plat.Home, ".ssh", "id_ed25519.pub")
+			if len(args) == 1 {
+				path = args[0]
+			}
+			key, err := os.ReadFile(path)
+			if err != nil {
+				return doterrors.NewUserError(fmt.Sprintf("read public key: %v", err))
+			}
+			if !strings.HasPrefix(string(key), "ssh-") && !strings.HasPrefix(string(key), "ecdsa-") && !strings.HasPrefix(string(key), "sk-") {
+				return doterrors.NewUserError(fmt.Sprintf("%s does not look like an SSH public key", path))
+			}
+			if title == "" {
+				title = "dotstate " + machine.Current(a.plat).ID
+			}
+			f, err := newForge(cmd.Context(), cfg, a.plat, runner.New())
+			if err != nil {
+				return doterrors.NewConfigError("forge not configured", err)
+			}
+			err = f.AddSSHKey(cmd.Context(), title, strings.TrimSpace(string(key)))
+			switch {
+			case errors.Is(err, forge.ErrKeyExists):
+				ui.Out.Printf("%s is already registered with %s\n", redact.Text(path), f.Provider())
+			case err != nil:
+				return doterrors.Wrap(err, "upload SSH key")
+			default:
+				ui.Out.Printf("Uploaded %s to %s as %q\n", redact.Text(path), f.Provider(), title)
+			}
+			return nil
+		},
 	}
+	sshKeyCmd.Flags().StringVar(&title, "title", "", "Key title (default \"dotstate <machine id>\")")
+	forgeCmd.AddCommand(sshKeyCmd)
+	return forgeCmd
+}
 
+func cmdRepoCompact(a *app) *cobra.Command {
 	var (
-		dotBin   string
-		interval int
-		noLoad   bool
-		dryRun   bool
+		days   int
+		branch string
+		dryRun bool
 	)
-	installCmd := &cobra.Command{
-		Use:   "install",
-		Short: "Install and load the dotstate sync LaunchAgent",
+	cmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Squash old automated sync commits into daily rollups on a new branch",
+		Long: "Squash runs of consecutive automated sync commits older than --older-than days into one " +
+			"commit per day. The compacted history is written to --branch with the same final tree; the " +
+			"current branch is left untouched until you adopt the result yourself.",
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, _, err := a.loadConfig()
+			if days < 1 {
+				return doterrors.WithCode(fmt.Errorf("--older-than must be at least 1 day"), doterrors.ExitUsage)
+			}
+			cfg, _, err := a.loadConfigSilent()
 			if err != nil {
 				return err
 			}
-			if dotBin == "" {
-				dotBin, err = os.Executable()
-				if err != nil {
-					return doterrors.Wrap(err, "resolve dot executable")
-				}
+			ctx := cmd.Context()
+			g := gitx.New(cfg.Tools.Git, runner.New())
+			tip, err := g.RevParse(ctx, cfg.Repo.Path, "HEAD")
+			if err != nil {
+				return doterrors.Wrap(err, "resolve HEAD")
 			}
-			opts, err := schedule.OptionsFromConfig(cfg, dotBin)
+			history, err := g.FirstParentHistory(ctx, cfg.Repo.Path, tip)
 			if err != nil {
-				return doterrors.Wrap(err, "build schedule options")
+				return doterrors.Wrap(err, "read history")
 			}
-			if interval > 0 {
-				opts.IntervalMinutes = interval
+			plan := compact.NewPlan(history, compact.Options{OlderThan: time.Duration(days) * 24 * time.Hour})
+			if plan.Empty() {
+				ui.Out.Printf("No runs of sync commits older than %s to compact.\n", plan.Cutoff.Format("2006-01-02"))
+				return nil
 			}
-			opts.NoLoad = noLoad
+
+			ui.Out.Title("Compaction plan")
+			for _, s := range plan.Rollups() {
+				ui.Out.Printf("  %s  %d sync commits -> 1\n", s.Day, len(s.Commits))
+			}
+			ui.Out.Printf("  %d -> %d commits, rewriting from %s\n", plan.Original, plan.Compacted(), shortCommit(plan.Base))
 			if dryRun {
-				printScheduleStatus("Schedule install plan", &schedule.Status{
-					Label:           schedule.Label,
-					Path:            schedule.LaunchAgentPath(a.plat.Home),
-					Installed:       false,
-					Loaded:          false,
-					IntervalMinutes: opts.IntervalMinutes,
-					ProgramArgs:     []string{opts.DotBin, "--config", opts.ConfigPath, "sync"},
-					Message:         "Dry run only: would write the LaunchAgent plist and load it with launchctl unless --no-load is set. No shutdown hook would be installed.",
-				})
 				return nil
 			}
-			mgr := schedule.NewManager(a.plat.Home, runner.New())
-			status, err := mgr.Install(context.Background(), opts)
+
+			newTip, err := compact.Apply(ctx, g, cfg.Repo.Path, tip, branch, plan)
 			if err != nil {
-				return wrapScheduleError(err)
+				return doterrors.Wrap(err, "compact history")
 			}
-			printScheduleStatus("Schedule installed", status)
+			current, _ := g.CurrentBranch(ctx, cfg.Repo.Path)
+			if current == "" {
+				current = cfg.Repo.Branch
+			}
+			ui.Out.Printf("Wrote %s at %s (same tree as %s).\n", branch, shortCommit(newTip), shortCommit(tip))
+			ui.Out.Println("Review it, then adopt it on every machine only after all have synced:")
+			ui.Out.Printf("  git -C %s log --stat %s\n", redact.Text(cfg.Repo.Path), branch)
+			ui.Out.Printf("  git -C %s reset --keep %s && git -C %s push --force-with-lease\n",
+				redact.Text(cfg.Repo.Path), branch, redact.Text(cfg.Repo.Path))
+			ui.Out.Printf("Other machines then run: git fetch && git reset --keep origin/%s\n", current)
 			return nil
 		},
 	}
-	installCmd.Flags().StringVar(&dotBin, "dot-bin", "", "Path to dot binary for launchd (defaults to current executable)")
-	installCmd.Flags().IntVar(&interval, "interval", 0, "Sync interval in minutes (defaults to sync.interval_minutes)")
-	installCmd.Flags().BoolVar(&noLoad, "no-load", false, "Write the LaunchAgent without loading it into launchd")
-	installCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the LaunchAgent plan without writing or loading it")
+	cmd.Flags().IntVar(&days, "older-than", compact.DefaultOlderThanDays, "Only roll up sync commits older than this many days")
+	cmd.Flags().StringVar(&branch, "branch", compact.DefaultBranch, "New branch to write the compacted history to")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the rollups without writing a branch")
+	return cmd
+}
+
+func printRepoSize(report *reposize.Report) {
+	ui.Out.Title("Repo size")
+	ui.Out.Printf("  Object database: %s\n", humanBytes(report.PackBytes))
+	ui.Out.Printf("  Tracked: %d file(s), %s\n", report.TrackedFiles, humanBytes(report.TrackedBytes))
+
+	ui.Out.Title("Largest tracked files")
+	for _, f := range report.Largest {
+		ui.Out.Printf("  %10s  %s\n", humanBytes(f.Size), redact.Text(f.Path))
+	}
+	if len(report.HistoryOnly) > 0 {
+		ui.Out.Title("Largest blobs only in history")
+		for _, f := range report.HistoryOnly {
+			ui.Out.Printf("  %10s  %s\n", humanBytes(f.Size), redact.Text(f.Path))
+		}
+	}
+	if len(report.StateAreas) > 0 {
+		ui.Out.Title("state/ contributors")
+		for _, area := range report.StateAreas {
+			ui.Out.Printf("  %10s  state/%s (%d file(s))\n", humanBytes(area.Bytes), redact.Text(area.Name), area.Files)
+		}
+	}
+	if len(report.Growth) > 0 {
+		ui.Out.Title("Growth")
+		var prev int64
+		for i, p := range report.Growth {
+			delta := ""
+			if i > 0 {
+				sign := "+"
+				diff := p.Bytes - prev
+				if diff < 0 {
+					sign, diff = "-", -diff
+				}
+				delta = fmt.Sprintf(" (%s%s)", sign, humanBytes(diff))
+			}
+			ui.Out.Printf("  %s  %10s  %d file(s)%s\n", p.Month, humanBytes(p.Bytes), p.Files, delta)
+			prev = p.Bytes
+		}
+	}
+	if len(report.Suggestions) > 0 {
+		ui.Out.Title("Suggestions")
+		for _, s := range report.Suggestions {
+			ui.Out.Printf("  - [%s] %s: %s\n", s.Kind, redact.Text(s.Path), s.Message)
+		}
+	}
+}
+
+// humanBytes formats a byte count with binary units.
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
 
+func cmdTelemetry(a *app) *cobra.Command {
+	telemetryCmd := &cobra.Command{
+		Use:   "telemetry",
+		Short: "Manage opt-in anonymous usage counters",
+	}
 	statusCmd := &cobra.Command{
 		Use:   "status",
-		Short: "Show dotstate sync LaunchAgent status",
+		Short: "Show whether telemetry is enabled and what is queued",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			mgr := schedule.NewManager(a.plat.Home, runner.New())
-			status, err := mgr.Inspect(context.Background())
+			path := telemetry.Path(a.plat)
+			state, err := telemetry.Load(path)
 			if err != nil {
-				return wrapScheduleError(err)
+				return err
+			}
+			ui.Out.Title("Telemetry")
+			if !state.Enabled {
+				ui.Out.Println("  Disabled. Enable with: dot telemetry enable")
+				return nil
+			}
+			ui.Out.Printf("  Enabled since %s\n", state.EnabledAt.Format(time.RFC3339))
+			if telemetry.EnvVetoed() {
+				ui.Out.Printf("  Recording paused by %s or %s\n", telemetry.EnvDisable, telemetry.EnvDNT)
+			}
+			ui.Out.Printf("  Queue: %s\n", path)
+			if len(state.Counters) == 0 {
+				ui.Out.Println("  No counters queued.")
+			}
+			for _, key := range state.Keys() {
+				ui.Out.Printf("  %s: %d\n", key, state.Counters[key])
 			}
-			printScheduleStatus("Schedule status", status)
 			return nil
 		},
 	}
-
-	removeCmd := &cobra.Command{
-		Use:   "remove",
-		Short: "Unload and remove the dotstate sync LaunchAgent",
+	enableCmd := &cobra.Command{
+		Use:   "enable",
+		Short: "Opt in to anonymous usage counters on this machine",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			mgr := schedule.NewManager(a.plat.Home, runner.New())
-			status, err := mgr.Remove(context.Background())
+			path := telemetry.Path(a.plat)
+			state, err := telemetry.Load(path)
 			if err != nil {
-				return wrapScheduleError(err)
+				return err
 			}
-			printScheduleStatus("Schedule removed", status)
+			state.Enable(time.Now())
+			if err := state.Save(path); err != nil {
+				return err
+			}
+			ui.Out.Println("Telemetry enabled. Only command names, OS, and error categories are counted.")
 			return nil
 		},
 	}
-
-	scheduleCmd.AddCommand(installCmd, statusCmd, removeCmd)
-	return scheduleCmd
+	disableCmd := &cobra.Command{
+		Use:   "disable",
+		Short: "Opt out and discard queued counters",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := telemetry.Path(a.plat)
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("remove telemetry queue: %w", err)
+			}
+			ui.Out.Println("Telemetry disabled; queued counters discarded.")
+			return nil
+		},
+	}
+	telemetryCmd.AddCommand(statusCmd, enableCmd, disableCmd)
+	return telemetryCmd
 }
 
-func wrapScheduleError(err error) error {
-	if errors.Is(err, schedule.ErrUnsupported) {
-		return doterrors.WithCode(err, doterrors.ExitUnavailable)
+func cmdSupportBundle(a *app) *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "support-bundle",
+		Short: "Write a redacted diagnostic archive for bug reports",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" {
+				output = fmt.Sprintf("dotstate-support-%s.zip", time.Now().Format("20060102-150405"))
+			}
+			opts := supportbundle.Options{
+				Output:  output,
+				Version: fmt.Sprintf("dot %s (%s) built %s\nplatform: %s/%s\n", version, commit, date, runtime.GOOS, runtime.GOARCH),
+				Doctor:  a.doctorOutput(cmd.Context()),
+			}
+			if cfgPath, err := config.ResolveConfigPath(a.cfgPath, ""); err == nil {
+				if _, err := os.Stat(cfgPath); err == nil {
+					opts.ConfigPath = cfgPath
+					opts.LogDir = filepath.Join(filepath.Dir(cfgPath), "state", "logs")
+				}
+			}
+
+			result, err := supportbundle.Write(opts)
+			if err != nil {
+				return doterrors.Wrap(err, "support bundle failed")
+			}
+			ui.Out.Title("Support bundle")
+			ui.Out.Printf("  Wrote %s\n", redact.Text(result.Path))
+			for _, name := range result.Files {
+				ui.Out.Printf("  - %s\n", name)
+			}
+			ui.Out.Println("  Review the contents before attaching it to a bug report.")
+			return nil
+		},
 	}
-	return err
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Archive path (default dotstate-support-<timestamp>.zip)")
+	return cmd
 }
 
-func printScheduleStatus(title string, status *schedule.Status) {
-	fmt.Println(ui.Title(title))
-	if status == nil {
-		fmt.Println("  No schedule status available.")
-		return
+// doctorOutput runs `dot doctor` in a child process so its output can be
+// captured; a failing doctor still yields whatever it printed.
+func (a *app) doctorOutput(ctx context.Context) string {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Sprintf("doctor unavailable: %v\n", err)
 	}
-	fmt.Printf("  Label: %s\n", redact.Text(status.Label))
-	fmt.Printf("  Path: %s\n", redact.Text(status.Path))
-	fmt.Printf("  Installed: %t\n", status.Installed)
-	fmt.Printf("  Loaded: %t\n", status.Loaded)
-	if status.IntervalMinutes > 0 {
-		fmt.Printf("  Interval: %d minutes\n", status.IntervalMinutes)
+	args := []string{"doctor"}
+	if a.cfgPath != "" {
+		args = append(args, "--config", a.cfgPath)
 	}
-	if len(status.ProgramArgs) > 0 {
-		fmt.Printf("  Command: %s\n", strings.Join(redactStrings(status.ProgramArgs), " "))
+	if a.repoDir != "" {
+		args = append(args, "--repo-dir", a.repoDir)
 	}
-	if status.Message != "" {
-		fmt.Printf("  Note: %s\n", redact.Text(status.Message))
+	res, err := runner.New().Run(ctx, "", exe, args...)
+	if res == nil {
+		return fmt.Sprintf("doctor unavailable: %v\n", err)
 	}
-}
-
-func redactStrings(values []string) []string {
-	out := make([]string, len(values))
-	for i, value := range values {
-		out[i] = redact.Text(value)
+	out := res.Stdout + res.Stderr
+	if err != nil {
+		out += fmt.Sprintf("\n(doctor exited with code %d)\n", res.Code)
 	}
 	return out
 }
 
-func cmdSubrepo(a *app) *cobra.Command {
-	subrepoCmd := &cobra.Command{
-		Use:   "subrepo",
-		Short: "Inspect sub-repositories tracked by dotstate",
-	}
-	statusCmd := &cobra.Command{
-		Use:   "status",
-		Short: "Report state/subrepos.toml clone status",
+// Environment variables exported to programs run by dot exec.
+const (
+	EnvDotRepoRoot  = sync.EnvRepoRoot
+	EnvDotSourceDir = sync.EnvSourceDir
+	EnvDotProfile   = "DOT_PROFILE"
+)
+
+func cmdExec(a *app) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec -- <program> [args...]",
+		Short: "Run a program in the repo root with dotstate context exported",
+		Long: "Run a program with its working directory set to the repo root and " +
+			EnvDotRepoRoot + ", " + EnvDotSourceDir + ", and " + EnvDotProfile + " exported, " +
+			"so ad-hoc git or chezmoi invocations use the right context.",
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, _, err := a.loadConfig()
 			if err != nil {
 				return err
 			}
-			statuses, err := macos.SubrepoStatuses(cfg, a.plat.Home)
+
+			child := exec.CommandContext(cmd.Context(), args[0], args[1:]...)
+			child.Dir = cfg.Repo.Path
+			child.Env = append(os.Environ(), execEnv(cfg, a.plat)...)
+			child.Stdin = os.Stdin
+			child.Stdout = os.Stdout
+			child.Stderr = os.Stderr
+			if err := child.Run(); err != nil {
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					return doterrors.WithCode(fmt.Errorf("%s exited with code %d", args[0], exitErr.ExitCode()), exitErr.ExitCode())
+				}
+				return doterrors.WithCode(fmt.Errorf("run %s: %w", args[0], err), doterrors.ExitUnavailable)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().SetInterspersed(false)
+	return cmd
+}
+
+// execEnv returns the KEY=value pairs dot exec exports.
+func execEnv(cfg *config.Config, plat *platform.Platform) []string {
+	profile := cfg.Templates.Profile
+	if id := machine.Current(plat); id != nil && id.Profile != "" {
+		profile = id.Profile
+	}
+	return []string{
+		EnvDotRepoRoot + "=" + cfg.Repo.Path,
+		EnvDotSourceDir + "=" + filepath.Join(cfg.Repo.Path, cfg.Chex.SourceDir),
+		EnvDotProfile + "=" + profile,
+	}
+}
+
+// pathKinds are the directories dot path prints, in help order.
+var pathKinds = []string{"repo", "source", "state", "log"}
+
+func cmdPath(a *app) *cobra.Command {
+	pathCmd := &cobra.Command{
+		Use:       "path <repo|source|state|log>",
+		Short:     "Print a dotstate directory, e.g. cd \"$(dot path repo)\"",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: pathKinds,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := a.loadConfigSilent()
 			if err != nil {
-				return err
+				return doterrors.NewConfigError("failed to load config", err)
 			}
-			fmt.Println(ui.Title("Subrepo status"))
-			if len(statuses) == 0 {
-				fmt.Println("  No subrepos declared in state/subrepos.toml")
-				return nil
+			dir, ok := dotPath(cfg, args[0])
+			if !ok {
+				return doterrors.NewUserError(fmt.Sprintf("unknown path %q (expected: %s)", args[0], strings.Join(pathKinds, ", ")))
 			}
-			for _, status := range statuses {
-				url := redact.Text(status.URL)
-				if url == "" {
-					url = "(no remote)"
-				}
-				branch := status.Branch
-				if branch == "" {
-					branch = "default"
-				}
-				fmt.Printf("  %s: %s [%s] %s\n", redact.Text(status.Path), status.Status, branch, url)
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
 			}
+			ui.Out.Println(dir)
 			return nil
 		},
 	}
-	subrepoCmd.AddCommand(statusCmd)
-	return subrepoCmd
+
+	shellCmd := &cobra.Command{
+		Use:       "shell <bash|zsh|fish>",
+		Short:     "Print a dotcd shell function that cds into a dotstate directory",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snippet, ok := pathShellSnippet(args[0])
+			if !ok {
+				return doterrors.NewUserError(fmt.Sprintf("unsupported shell %q (expected: bash, zsh, fish)", args[0]))
+			}
+			ui.Out.Print(snippet)
+			return nil
+		},
+	}
+	pathCmd.AddCommand(shellCmd)
+	return pathCmd
+}
+
+// dotPath resolves a dot path kind to its directory.
+func dotPath(cfg *config.Config, kind string) (string, bool) {
+	switch kind {
+	case "repo":
+		return cfg.Repo.Path, true
+	case "source":
+		return cfg.SourcePath(), true
+	case "state":
+		return cfg.StatePath(), true
+	case "log":
+		return cfg.LogPath(), true
+	}
+	return "", false
+}
+
+// pathShellSnippet returns a dotcd function for shell: `dotcd` goes to the
+// repo root and `dotcd source|state|log` to the other directories.
+func pathShellSnippet(shell string) (string, bool) {
+	switch shell {
+	case "bash", "zsh":
+		return `# dotstate: add to your shell rc, e.g. eval "$(dot path shell ` + shell + `)"
+dotcd() {
+  local dir
+  dir="$(dot path "${1:-repo}")" && cd "$dir"
+}
+`, true
+	case "fish":
+		return `# dotstate: add to config.fish, e.g. dot path shell fish | source
+function dotcd
+  set -l kind repo
+  if test (count $argv) -gt 0
+    set kind $argv[1]
+  end
+  set -l dir (dot path $kind); and cd $dir
+end
+`, true
+	}
+	return "", false
 }
 
 func cmdDiscover(a *app) *cobra.Command {
@@ -816,9 +5100,16 @@ func cmdDiscover(a *app) *cobra.Command {
 		noCommit    bool
 		deep        bool
 		reportOnly  bool
+		missing     bool
+		submodules  bool
+		profile     bool
+		pending     bool
+		jsonOut     bool
 		secretsMode string
+		nonTTY      string
 		roots       []string
 		maxFileSize int64
+		largeFile   int64
 	)
 
 	cmd := &cobra.Command{
@@ -835,6 +5126,11 @@ Examples:
   dot discover --yes        # Auto-accept recommended files
   dot discover --report     # Show what would be discovered (no changes)
   dot discover --deep       # Scan additional directories
+  dot discover --missing    # Suggest applying managed configs for installed apps
+  dot discover --pending    # Show files found by scheduled discovery passes
+  dot discover --submodules # Track found sub-repos as git submodules
+  dot discover --report --profile # Show where a slow scan spends its time
+  dot discover --json       # Emit the report as JSON
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, _, err := a.loadConfig()
@@ -842,15 +5138,41 @@ Examples:
 				return err
 			}
 
+			if pending {
+				report, err := discover.LoadPending(cfg.DiscoverPendingPath())
+				if err != nil {
+					return doterrors.Wrap(err, "discover pending")
+				}
+				if jsonOut {
+					return ui.JSON(os.Stdout, report)
+				}
+				discover.NewPrompter(false).PrintPending(report)
+				return nil
+			}
+
+			if jsonOut && (missing || autoYes) {
+				return doterrors.NewUserError("--json prints the report; it cannot be combined with --missing or --yes")
+			}
+
 			opts := discover.DefaultOptions()
 			opts.AutoYes = autoYes
 			opts.DryRun = dryRun
 			opts.NoCommit = noCommit
 			opts.Deep = deep
-			opts.ReportOnly = reportOnly
+			opts.ReportOnly = reportOnly || jsonOut
+			opts.JSON = jsonOut
+			opts.Missing = missing
+			opts.Submodules = submodules
+			opts.Profile = profile
 			opts.SecretsMode = secretsMode
+			opts.FailOn = cfg.Secrets.FailOn
+			opts.NonInteractive = nonTTY
 			opts.Roots = roots
 			opts.MaxFileSize = maxFileSize
+			opts.LargeFileSize = cfg.Discover.LargeFileSize
+			if cmd.Flags().Changed("large-file-size") {
+				opts.LargeFileSize = largeFile
+			}
 
 			if a.logger != nil {
 				a.logger.Info("starting discovery",
@@ -880,9 +5202,16 @@ Examples:
 	cmd.Flags().BoolVar(&noCommit, "no-commit", false, "Skip the commit step")
 	cmd.Flags().BoolVar(&deep, "deep", false, "Scan additional directories (AppData, Library)")
 	cmd.Flags().BoolVar(&reportOnly, "report", false, "Print report only (no prompts, no changes)")
-	cmd.Flags().StringVar(&secretsMode, "secrets", discover.SecretsModeError, "How to handle secrets: error, warning, ignore")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Print the report (or the --pending list) as JSON; implies --report")
+	cmd.Flags().BoolVar(&pending, "pending", false, "Show recommended files recorded by scheduled discovery passes")
+	cmd.Flags().BoolVar(&missing, "missing", false, "List installed apps whose managed configs are missing or not applied here")
+	cmd.Flags().BoolVar(&profile, "profile", false, "Report time per root, stage, and secret pattern, and paths skipped per exclusion rule")
+	cmd.Flags().BoolVar(&submodules, "submodules", false, "Track selected sub-repositories as git submodules instead of state/subrepos.toml entries")
+	cmd.Flags().StringVar(&secretsMode, "secrets", discover.SecretsModeError, "How to handle secrets: error, warning, ignore, prompt")
+	cmd.Flags().StringVar(&nonTTY, "non-interactive", discover.NonInteractiveReport, "What to do when not attached to a terminal: report, yes")
 	cmd.Flags().StringSliceVar(&roots, "roots", nil, "Override discovery roots (comma-separated or repeated; advanced)")
 	cmd.Flags().Int64Var(&maxFileSize, "max-file-size", discover.DefaultMaxFileSize, "Maximum candidate file size in bytes")
+	cmd.Flags().Int64Var(&largeFile, "large-file-size", discover.DefaultLargeFileSize, "Selected files larger than this many bytes must be routed through git-lfs, skipped, or kept explicitly")
 
 	return cmd
 }
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
 	"os/exec"
@@ -12,8 +13,11 @@ import (
 	"testing"
 
 	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/diffstat"
 	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/platform"
 	"github.com/dnery/dotstate/dot/internal/schedule"
+	"github.com/dnery/dotstate/dot/internal/sync"
 )
 
 func TestBootstrapOutputRedactsSentinelValues(t *testing.T) {
@@ -104,6 +108,30 @@ func TestRunReportOutputRedactsSentinelValues(t *testing.T) {
 	}
 }
 
+func TestSyncReportOutputShowsDiffStat(t *testing.T) {
+	const sentinel = "DOTSTATE_TEST_SECRET_DO_NOT_PRINT"
+	report := &sync.SyncReport{
+		Operations: []*modules.RunReport{{
+			Plan: &modules.Plan{
+				Operation: modules.OperationApply,
+				Changes: []modules.Change{{
+					ID:      "files:source/home",
+					Action:  modules.ActionUpdate,
+					Current: map[string]any{"diff_stat": diffstat.Records([]diffstat.FileStat{{Path: ".zshrc", Added: 2, Removed: 1}})},
+				}},
+			},
+		}},
+		Committed:  true,
+		CommitStat: []diffstat.FileStat{{Path: "home/" + sentinel, Added: 5}},
+	}
+
+	out := captureStdout(t, func() { printSyncReport("Sync result", report) })
+	assertNoSentinel(t, out, sentinel)
+	if !strings.Contains(out, ".zshrc | 3 ++-") || !strings.Contains(out, "Committed:") || !strings.Contains(out, "1 file(s) changed, 5 insertion(s)(+)") {
+		t.Fatalf("sync output missing diff stat:\n%s", out)
+	}
+}
+
 func TestLoadConfigSilentUsesEnvConfig(t *testing.T) {
 	repoRoot := t.TempDir()
 	cfgPath := writeCLITestConfig(t, repoRoot, filepath.Join(repoRoot, "repo"))
@@ -184,3 +212,124 @@ func assertNoSentinel(t *testing.T, out, sentinel string) {
 		t.Fatalf("output leaked sentinel:\n%s", out)
 	}
 }
+
+func TestExecEnvExportsRepoContext(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Repo.Path = filepath.Join(dir, "dotstate")
+	cfg.Templates.Profile = "work"
+
+	env := execEnv(cfg, &platform.Platform{StateDir: filepath.Join(dir, "state")})
+	want := []string{
+		EnvDotRepoRoot + "=" + cfg.Repo.Path,
+		EnvDotSourceDir + "=" + filepath.Join(cfg.Repo.Path, "home"),
+		EnvDotProfile + "=work",
+	}
+	if strings.Join(env, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("execEnv() = %v, want %v", env, want)
+	}
+}
+
+func TestDotPathKinds(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "dot.toml")
+	if err := os.WriteFile(cfgPath, []byte("[repo]\npath = \""+dir+"\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"repo":   dir,
+		"source": filepath.Join(dir, "home"),
+		"state":  filepath.Join(dir, "state"),
+		"log":    filepath.Join(dir, "state", "logs"),
+	}
+	for _, kind := range pathKinds {
+		got, ok := dotPath(cfg, kind)
+		if !ok || got != want[kind] {
+			t.Errorf("dotPath(%q) = %q, %v; want %q", kind, got, ok, want[kind])
+		}
+	}
+	if _, ok := dotPath(cfg, "bogus"); ok {
+		t.Error("dotPath(bogus) should fail")
+	}
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		if snippet, ok := pathShellSnippet(shell); !ok || !strings.Contains(snippet, "dotcd") {
+			t.Errorf("pathShellSnippet(%q) = %q, %v", shell, snippet, ok)
+		}
+	}
+}
+
+func TestInitRepoScaffoldsLayoutAndRemote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	home := t.TempDir()
+	cfg := config.Default()
+	cfg.Repo.Path = filepath.Join(home, "dots")
+	cfg.Repo.URL = "git@example.com:me/dots.git"
+	ctx := context.Background()
+	if err := initRepo(ctx, cfg, home); err != nil {
+		t.Fatalf("initRepo() error = %v", err)
+	}
+	for _, name := range []string{"dot.toml", ".gitignore", "home/.keep", "state/README.md", ".git"} {
+		if _, err := os.Stat(filepath.Join(cfg.Repo.Path, name)); err != nil {
+			t.Errorf("missing %s: %v", name, err)
+		}
+	}
+	loaded, err := config.Load(filepath.Join(cfg.Repo.Path, config.ConfigFileName))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Repo.URL != cfg.Repo.URL {
+		t.Fatalf("repo.url = %q, want %q", loaded.Repo.URL, cfg.Repo.URL)
+	}
+	origin, err := exec.Command("git", "-C", cfg.Repo.Path, "remote", "get-url", "origin").Output()
+	if err != nil || strings.TrimSpace(string(origin)) != cfg.Repo.URL {
+		t.Fatalf("origin = %q, %v", origin, err)
+	}
+
+	if err := initRepo(ctx, cfg, home); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("second initRepo() error = %v, want already exists", err)
+	}
+}
+
+func TestRunEditorPassesEditorArguments(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sed")
+	}
+	path := filepath.Join(t.TempDir(), "dot_zshrc")
+	if err := os.WriteFile(path, []byte("export A=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "sed -i.bak s/A=1/A=2/")
+	if err := runEditor(context.Background(), path); err != nil {
+		t.Fatalf("runEditor() error = %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "export A=2\n" {
+		t.Fatalf("file = %q, want edited", got)
+	}
+}
+
+func TestMigrateRefusesDirtyRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repoRoot := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", repoRoot).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	// The untracked config is an unrelated change the import commit
+	// would otherwise sweep in.
+	cfgPath := writeCLITestConfig(t, repoRoot, repoRoot)
+	home := t.TempDir()
+	a := &app{cfgPath: cfgPath, plat: &platform.Platform{Home: home}}
+
+	err := a.migrate(context.Background(), "stow", filepath.Join(home, "stow"), false, true, false)
+	if err == nil || !strings.Contains(err.Error(), "uncommitted changes") {
+		t.Fatalf("migrate() error = %v, want uncommitted changes refusal", err)
+	}
+}
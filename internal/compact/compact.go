@@ -0,0 +1,225 @@
+// Package compact squashes runs of automated sync commits into daily
+// rollups. The compacted history is written to a separate branch whose tip
+// has exactly the original tree; the synced branch is never rewritten, so
+// adopting the result (and force-pushing it) stays an explicit user step.
+package compact
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+)
+
+// Defaults for Options.
+const (
+	DefaultOlderThanDays = 30
+	DefaultBranch        = "dotstate/compacted"
+)
+
+// RollupTrailer counts the sync commits a rollup replaces.
+const RollupTrailer = "Rollup-Commits"
+
+// dayLayout names a rollup's calendar day.
+const dayLayout = "2006-01-02"
+
+// Options configures Plan.
+type Options struct {
+	// OlderThan is the age a sync commit must exceed to be rolled up.
+	OlderThan time.Duration
+	// Now anchors the cutoff; zero uses time.Now.
+	Now time.Time
+	// Location decides calendar days; nil uses time.Local.
+	Location *time.Location
+}
+
+// Step is one commit of the compacted history: a single kept commit, or a
+// rollup of consecutive sync commits from the same day.
+type Step struct {
+	Day     string
+	Commits []gitx.HistoryEntry
+}
+
+// Rollup reports whether the step replaces several commits.
+func (s Step) Rollup() bool {
+	return len(s.Commits) > 1
+}
+
+// Plan is the compacted history: Base and everything before it are kept
+// with their hashes, and Steps are recreated on top of Base.
+type Plan struct {
+	Base     string
+	Cutoff   time.Time
+	Original int
+	Steps    []Step
+}
+
+// Empty reports whether there is nothing to roll up.
+func (p *Plan) Empty() bool {
+	return len(p.Steps) == 0
+}
+
+// Rollups returns the steps that replace several commits.
+func (p *Plan) Rollups() []Step {
+	var out []Step
+	for _, s := range p.Steps {
+		if s.Rollup() {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Compacted is the number of commits the history has after compaction.
+func (p *Plan) Compacted() int {
+	return p.Original - p.replaced() + len(p.Steps)
+}
+
+func (p *Plan) replaced() int {
+	n := 0
+	for _, s := range p.Steps {
+		n += len(s.Commits)
+	}
+	return n
+}
+
+// NewPlan groups history (oldest first, first-parent) into steps. Only the
+// linear stretch after the last merge is considered, and the root commit is
+// always kept. Rewriting starts at the first run that actually rolls up.
+func NewPlan(history []gitx.HistoryEntry, opts Options) *Plan {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	plan := &Plan{Cutoff: opts.Now.Add(-opts.OlderThan), Original: len(history)}
+
+	start := 1
+	for i, c := range history {
+		if len(c.Parents) > 1 {
+			start = i + 1
+		}
+	}
+
+	var steps []Step
+	for i := start; i < len(history); i++ {
+		c := history[i]
+		day := c.AuthorDate.In(opts.Location).Format(dayLayout)
+		eligible := c.IsSync() && c.AuthorDate.Before(plan.Cutoff)
+		if eligible && len(steps) > 0 {
+			last := &steps[len(steps)-1]
+			prev := last.Commits[len(last.Commits)-1]
+			if last.Day == day && prev.IsSync() && prev.AuthorDate.Before(plan.Cutoff) {
+				last.Commits = append(last.Commits, c)
+				continue
+			}
+		}
+		steps = append(steps, Step{Day: day, Commits: []gitx.HistoryEntry{c}})
+	}
+
+	for i, s := range steps {
+		if s.Rollup() {
+			plan.Base = history[indexOf(history, s.Commits[0].Hash)-1].Hash
+			plan.Steps = steps[i:]
+			break
+		}
+	}
+	return plan
+}
+
+func indexOf(history []gitx.HistoryEntry, hash string) int {
+	for i, c := range history {
+		if c.Hash == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// Message returns the commit message for a step: the original message for
+// a kept commit, or a rollup subject with the machines involved.
+func (s Step) Message() string {
+	if !s.Rollup() {
+		return strings.TrimRight(s.Commits[0].Message, "\n")
+	}
+	trailers := []gitx.Trailer{{Key: RollupTrailer, Value: fmt.Sprint(len(s.Commits))}}
+	seen := map[string]bool{}
+	for _, c := range s.Commits {
+		for _, id := range c.Machines {
+			if !seen[id] {
+				seen[id] = true
+				trailers = append(trailers, gitx.Trailer{Key: gitx.TrailerMachineID, Value: id})
+			}
+		}
+	}
+	first, last := s.Commits[0], s.Commits[len(s.Commits)-1]
+	subject := fmt.Sprintf("dot sync rollup %s (%d commits)", s.Day, len(s.Commits))
+	body := fmt.Sprintf("First: %s\nLast:  %s", first.Subject, last.Subject)
+	return gitx.WithTrailers(subject+"\n\n"+body, trailers...)
+}
+
+// Apply recreates plan's steps on top of plan.Base in a temporary worktree
+// and creates branch at the result. The branch must not exist, and the new
+// tip must have the same tree as tip, or the branch is not created.
+func Apply(ctx context.Context, g *gitx.Git, repoPath, tip, branch string, plan *Plan) (string, error) {
+	if plan.Empty() {
+		return "", fmt.Errorf("nothing to compact")
+	}
+	exists, err := g.BranchExists(ctx, repoPath, branch)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("branch %s already exists; delete it or choose another with --branch", branch)
+	}
+
+	dir, err := os.MkdirTemp("", "dot-compact-")
+	if err != nil {
+		return "", err
+	}
+	// git worktree add wants to create the directory itself.
+	if err := os.Remove(dir); err != nil {
+		return "", err
+	}
+	if err := g.WorktreeAdd(ctx, repoPath, dir, plan.Base); err != nil {
+		return "", fmt.Errorf("create worktree: %w", err)
+	}
+	defer func() {
+		_ = g.WorktreeRemove(context.WithoutCancel(ctx), repoPath, dir)
+	}()
+
+	for _, s := range plan.Steps {
+		last := s.Commits[len(s.Commits)-1]
+		if err := g.ResetTree(ctx, dir, last.Hash); err != nil {
+			return "", fmt.Errorf("check out %s: %w", last.Hash, err)
+		}
+		author := fmt.Sprintf("%s <%s>", last.AuthorName, last.AuthorEmail)
+		if err := g.CommitIndex(ctx, dir, s.Message(), author, last.AuthorDate); err != nil {
+			return "", fmt.Errorf("recreate %s: %w", last.Hash, err)
+		}
+	}
+
+	newTip, err := g.RevParse(ctx, dir, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	wantTree, err := g.RevParse(ctx, repoPath, tip+"^{tree}")
+	if err != nil {
+		return "", err
+	}
+	gotTree, err := g.RevParse(ctx, repoPath, newTip+"^{tree}")
+	if err != nil {
+		return "", err
+	}
+	if gotTree != wantTree {
+		return "", fmt.Errorf("compacted tree %s does not match %s tree %s", gotTree, tip, wantTree)
+	}
+	if err := g.CreateBranch(ctx, repoPath, branch, newTip); err != nil {
+		return "", err
+	}
+	return newTip, nil
+}
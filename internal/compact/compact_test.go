@@ -0,0 +1,94 @@
+package compact
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+)
+
+func entry(hash, subject, date string, machines ...string) gitx.HistoryEntry {
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		panic(err)
+	}
+	return gitx.HistoryEntry{Hash: hash, Parents: []string{"p"}, Subject: subject, Message: subject + "\n", AuthorDate: t, Machines: machines}
+}
+
+func TestNewPlanGroupsOldSyncRunsByDay(t *testing.T) {
+	history := []gitx.HistoryEntry{
+		entry("a", "init", "2026-01-01T10:00:00Z"),
+		entry("b", "dot sync from box at 1", "2026-01-02T10:00:00Z", "m1"),
+		entry("c", "dot sync from box at 2", "2026-01-02T11:00:00Z", "m2"),
+		entry("d", "dot sync from box at 3", "2026-01-03T10:00:00Z"),
+		entry("e", "manual edit", "2026-01-03T11:00:00Z"),
+		entry("f", "dot sync from box at 4", "2026-01-03T12:00:00Z"),
+		entry("g", "dot sync from box at 5", "2026-03-01T10:00:00Z"),
+		entry("h", "dot sync from box at 6", "2026-03-01T11:00:00Z"),
+	}
+	plan := NewPlan(history, Options{
+		OlderThan: 30 * 24 * time.Hour,
+		Now:       time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+		Location:  time.UTC,
+	})
+
+	if plan.Base != "a" {
+		t.Fatalf("Base = %q, want a", plan.Base)
+	}
+	var got []string
+	for _, s := range plan.Steps {
+		var hashes []string
+		for _, c := range s.Commits {
+			hashes = append(hashes, c.Hash)
+		}
+		got = append(got, strings.Join(hashes, "+"))
+	}
+	if want := "b+c d e f g h"; strings.Join(got, " ") != want {
+		t.Fatalf("steps = %v, want %s", got, want)
+	}
+	if plan.Compacted() != 7 || len(plan.Rollups()) != 1 {
+		t.Fatalf("Compacted() = %d, Rollups() = %d", plan.Compacted(), len(plan.Rollups()))
+	}
+
+	msg := plan.Steps[0].Message()
+	for _, want := range []string{"dot sync rollup 2026-01-02 (2 commits)", "Rollup-Commits: 2", "Machine-Id: m1\nMachine-Id: m2"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("rollup message missing %q:\n%s", want, msg)
+		}
+	}
+	if gitx.IsSyncCommit(msg) {
+		t.Error("rollup subject must not look like a sync commit")
+	}
+	if got := plan.Steps[2].Message(); got != "manual edit" {
+		t.Errorf("kept message = %q", got)
+	}
+}
+
+func TestNewPlanStartsAfterLastMerge(t *testing.T) {
+	merge := entry("c", "Merge branch", "2026-01-02T12:00:00Z")
+	merge.Parents = []string{"b", "x"}
+	history := []gitx.HistoryEntry{
+		entry("a", "init", "2026-01-01T10:00:00Z"),
+		entry("b", "dot sync from box at 1", "2026-01-02T10:00:00Z"),
+		merge,
+		entry("d", "dot sync from box at 2", "2026-01-02T13:00:00Z"),
+		entry("e", "dot sync from box at 3", "2026-01-02T14:00:00Z"),
+	}
+	plan := NewPlan(history, Options{OlderThan: time.Hour, Now: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), Location: time.UTC})
+	if plan.Base != "c" || len(plan.Steps) != 1 || len(plan.Steps[0].Commits) != 2 {
+		t.Fatalf("plan = %+v, want d+e rolled up on c", plan)
+	}
+}
+
+func TestNewPlanNothingToDo(t *testing.T) {
+	history := []gitx.HistoryEntry{
+		entry("a", "dot sync from box at 0", "2026-01-01T10:00:00Z"),
+		entry("b", "dot sync from box at 1", "2026-01-01T11:00:00Z"),
+		entry("c", "dot sync from box at 2", "2026-01-02T10:00:00Z"),
+	}
+	plan := NewPlan(history, Options{OlderThan: time.Hour, Now: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), Location: time.UTC})
+	if !plan.Empty() {
+		t.Fatalf("plan = %+v, want empty: the root is kept and b, c are on different days", plan)
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Apply pipeline steps, in their default order. Each step groups the module
+// surfaces it applies; see modules.ApplyStepOf.
+const (
+	ApplyStepFiles    = "files"
+	ApplyStepPackages = "packages"
+	ApplyStepSubrepos = "subrepos"
+	ApplyStepScripts  = "scripts"
+	ApplyStepOS       = "os"
+)
+
+// ApplySteps lists every apply step in default order.
+var ApplySteps = []string{ApplyStepFiles, ApplyStepPackages, ApplyStepSubrepos, ApplyStepScripts, ApplyStepOS}
+
+// defaultApplyAfter is each step's dependencies when [apply.steps.<name>]
+// does not set after.
+var defaultApplyAfter = map[string][]string{
+	ApplyStepFiles:    nil,
+	ApplyStepPackages: {ApplyStepFiles},
+	ApplyStepSubrepos: {ApplyStepFiles},
+	ApplyStepScripts:  {ApplyStepFiles, ApplyStepPackages, ApplyStepSubrepos},
+	ApplyStepOS:       {ApplyStepPackages},
+}
+
+// ApplyConfig configures the order and selection of apply steps.
+type ApplyConfig struct {
+	Steps map[string]ApplyStepConfig `toml:"steps"`
+	// InstallPackages installs what the state/packages manifests list but
+	// this machine lacks, in the packages step.
+	InstallPackages bool `toml:"install_packages"`
+}
+
+// ApplyStepConfig overrides one step.
+type ApplyStepConfig struct {
+	// Enabled defaults to true.
+	Enabled *bool `toml:"enabled"`
+	// After lists the steps that must apply first; nil keeps the default.
+	After []string `toml:"after"`
+}
+
+// ApplyStepEnabled reports whether step runs during apply.
+func (c *Config) ApplyStepEnabled(step string) bool {
+	enabled := c.Apply.Steps[step].Enabled
+	return enabled == nil || *enabled
+}
+
+// DisableApplyStep turns step off for this run, as if dot.toml set
+// enabled = false.
+func (c *Config) DisableApplyStep(step string) {
+	if c.Apply.Steps == nil {
+		c.Apply.Steps = map[string]ApplyStepConfig{}
+	}
+	override := c.Apply.Steps[step]
+	disabled := false
+	override.Enabled = &disabled
+	c.Apply.Steps[step] = override
+}
+
+// ApplyStepAfter returns the steps that must apply before step.
+func (c *Config) ApplyStepAfter(step string) []string {
+	if after := c.Apply.Steps[step].After; after != nil {
+		return after
+	}
+	return defaultApplyAfter[step]
+}
+
+// ApplyPipeline returns the enabled apply steps in dependency order. Steps
+// without an ordering constraint between them keep their default order.
+// Dependencies on disabled steps still order the remaining ones.
+func (c *Config) ApplyPipeline() ([]string, error) {
+	remaining := map[string][]string{}
+	for _, step := range ApplySteps {
+		remaining[step] = c.ApplyStepAfter(step)
+	}
+	done := map[string]bool{}
+	var order []string
+	for len(order) < len(ApplySteps) {
+		progressed := false
+		for _, step := range ApplySteps {
+			if done[step] {
+				continue
+			}
+			ready := true
+			for _, dep := range remaining[step] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[step] = true
+				order = append(order, step)
+				progressed = true
+				break
+			}
+		}
+		if !progressed {
+			var stuck []string
+			for _, step := range ApplySteps {
+				if !done[step] {
+					stuck = append(stuck, step)
+				}
+			}
+			return nil, fmt.Errorf("apply.steps dependencies form a cycle among %s", strings.Join(stuck, ", "))
+		}
+	}
+	enabled := order[:0]
+	for _, step := range order {
+		if c.ApplyStepEnabled(step) {
+			enabled = append(enabled, step)
+		}
+	}
+	return enabled, nil
+}
+
+// validateApply checks [apply.steps] names and dependencies.
+func (c *Config) validateApply() []string {
+	var errs []string
+	names := make([]string, 0, len(c.Apply.Steps))
+	for name := range c.Apply.Steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	known := strings.Join(ApplySteps, ", ")
+	for _, name := range names {
+		if !slices.Contains(ApplySteps, name) {
+			errs = append(errs, fmt.Sprintf("apply.steps.%s is not a known step (%s)", name, known))
+			continue
+		}
+		for _, dep := range c.Apply.Steps[name].After {
+			switch {
+			case dep == name:
+				errs = append(errs, fmt.Sprintf("apply.steps.%s cannot run after itself", name))
+			case !slices.Contains(ApplySteps, dep):
+				errs = append(errs, fmt.Sprintf("apply.steps.%s.after: unknown step %q (%s)", name, dep, known))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		if _, err := c.ApplyPipeline(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	return errs
+}
@@ -4,10 +4,17 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 
 	toml "github.com/pelletier/go-toml/v2"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/platform"
 )
 
 // ConfigFileName is the name of the dotstate configuration file.
@@ -15,11 +22,27 @@ const ConfigFileName = "dot.toml"
 
 // Config is the root configuration structure.
 type Config struct {
-	Repo  RepoConfig  `toml:"repo"`
-	Sync  SyncConfig  `toml:"sync"`
-	Tools ToolsConfig `toml:"tools"`
-	Chex  ChexConfig  `toml:"chex"`
-	WSL   WSLConfig   `toml:"wsl"`
+	Repo   RepoConfig   `toml:"repo"`
+	Sync   SyncConfig   `toml:"sync"`
+	Tools  ToolsConfig  `toml:"tools"`
+	Chex   ChexConfig   `toml:"chex"`
+	WSL    WSLConfig    `toml:"wsl"`
+	Backup BackupConfig `toml:"backup"`
+
+	Encryption EncryptionConfig `toml:"encryption"`
+	Templates  TemplatesConfig  `toml:"templates"`
+	Audit      AuditConfig      `toml:"audit"`
+	Discover   DiscoverConfig   `toml:"discover"`
+	Secrets    SecretsConfig    `toml:"secrets"`
+	Forge      ForgeConfig      `toml:"forge"`
+	Apply      ApplyConfig      `toml:"apply"`
+	Hooks      HooksConfig      `toml:"hooks"`
+
+	// Exports switches registered OS-state exporters on or off by name.
+	Exports map[string]bool `toml:"exports"`
+
+	// Packages switches package-list capture on or off by manager name.
+	Packages map[string]bool `toml:"packages"`
 
 	// Runtime fields (not persisted)
 	configPath string // Path to the config file
@@ -31,6 +54,12 @@ type RepoConfig struct {
 	URL    string `toml:"url"`
 	Path   string `toml:"path"`
 	Branch string `toml:"branch"`
+
+	// UserName and UserEmail are the git identity bootstrap sets as
+	// repo-local config when the repo has none, so sync commits work on
+	// machines without a global git identity.
+	UserName  string `toml:"user_name"`
+	UserEmail string `toml:"user_email"`
 }
 
 // SyncConfig configures sync behavior.
@@ -38,20 +67,72 @@ type SyncConfig struct {
 	IntervalMinutes int  `toml:"interval_minutes"`
 	EnableIdle      bool `toml:"enable_idle"`
 	EnableShutdown  bool `toml:"enable_shutdown"`
+
+	// Conflicts maps repo-relative path globs to a rebase conflict policy:
+	// "ours" (keep this machine's version), "theirs" (take the remote
+	// version), or "manual" (stop for human resolution).
+	Conflicts map[string]string `toml:"conflicts"`
+
+	// PushFallbackBranch is where sync pushes when the configured branch
+	// rejects the push as protected or forbidden; "{machine}" expands to the
+	// machine ID. Empty disables the fallback.
+	PushFallbackBranch string `toml:"push_fallback_branch"`
+	// PushFallbackPR opens a pull request from the fallback branch into
+	// repo.branch after a fallback push.
+	PushFallbackPR bool `toml:"push_fallback_pr"`
+
+	// CommitTemplate replaces the default sync commit subject. It may use
+	// the CommitTemplateFields placeholders, e.g. "{{hostname}}: {{date}}".
+	CommitTemplate string `toml:"commit_template"`
 }
 
+// CommitTemplateFields are the placeholders sync.commit_template and
+// dot sync -m expand: {{hostname}}, {{machine}} (the machine ID), {{profile}},
+// {{date}} (RFC 3339), and {{changed_files}} (the changed repo paths,
+// comma-separated).
+var CommitTemplateFields = []string{"hostname", "machine", "profile", "date", "changed_files"}
+
+// commitTemplatePlaceholder matches one {{name}} in a commit template.
+var commitTemplatePlaceholder = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+
+// Conflict policies accepted in [sync.conflicts].
+const (
+	ConflictOurs   = "ours"
+	ConflictTheirs = "theirs"
+	ConflictManual = "manual"
+)
+
 // ToolsConfig configures external tool paths.
 type ToolsConfig struct {
 	Git     string `toml:"git"`
 	Chezmoi string `toml:"chezmoi"`
 	OP      string `toml:"op"`
+	Age     string `toml:"age"`
+
+	// ChezmoiVersion pins a chezmoi release that dotstate downloads into
+	// its cache and uses instead of whatever chezmoi is on PATH.
+	ChezmoiVersion string `toml:"chezmoi_version"`
+
+	// MaxOutput bounds how many bytes of each external command's stdout
+	// and stderr dotstate keeps in memory; 0 uses the built-in default.
+	MaxOutput int64 `toml:"max_output"`
 }
 
 // ChexConfig configures chezmoi settings.
 type ChexConfig struct {
 	SourceDir string `toml:"source_dir"`
+	// Engine selects the apply backend: "chezmoi" (default) or "native".
+	Engine string `toml:"engine"`
+	// NativeMode is "copy" (default) or "symlink" for the native engine.
+	NativeMode string `toml:"native_mode"`
 }
 
+// Apply engines for [chex].engine.
+const (
+	EngineChezmoi = "chezmoi"
+	EngineNative  = "native"
+)
+
 // WSLConfig configures WSL integration.
 type WSLConfig struct {
 	Enable     bool   `toml:"enable"`
@@ -59,6 +140,122 @@ type WSLConfig struct {
 	FlakeRef   string `toml:"flake_ref"`
 }
 
+// BackupConfig configures destination backups taken before apply.
+type BackupConfig struct {
+	// Keep is the number of dated backup sets retained under state/backups;
+	// 0 keeps every set. An absent key means DefaultBackupKeep.
+	Keep int `toml:"keep"`
+	// MaxAgeDays prunes backup sets older than this many days; 0 disables
+	// age-based pruning.
+	MaxAgeDays int `toml:"max_age_days"`
+}
+
+// EncryptionConfig configures age encryption for selected tracked files.
+type EncryptionConfig struct {
+	// Recipients are the age public keys every captured file is encrypted to.
+	Recipients []string `toml:"recipients"`
+	// Identity is the local age identity file used to decrypt on apply.
+	Identity string `toml:"identity"`
+	// Files are home-relative destination paths stored encrypted under
+	// state/encrypted instead of in the chezmoi source dir.
+	Files []string `toml:"files"`
+}
+
+// TemplatesConfig configures the data dotstate injects into chezmoi
+// templates under .dotstate.
+type TemplatesConfig struct {
+	// Profile names this machine's role (e.g. "work", "personal").
+	Profile string `toml:"profile"`
+	// Data is exposed verbatim as .dotstate.data.
+	Data map[string]any `toml:"data"`
+	// Secrets maps logical names to op:// references, exposed as
+	// .dotstate.secrets.refs for use with onepasswordRead.
+	Secrets map[string]string `toml:"secrets"`
+}
+
+// ForgeConfig configures the GitHub or GitLab API used to create the
+// repo, open fallback pull requests, and upload SSH keys.
+type ForgeConfig struct {
+	// Provider is "github" or "gitlab"; empty infers it from repo.url.
+	Provider string `toml:"provider"`
+	// APIURL overrides the API base for GitHub Enterprise or self-hosted
+	// GitLab.
+	APIURL string `toml:"api_url"`
+	// TokenSecret names the [templates.secrets] entry holding the API
+	// token. Empty falls back to GITHUB_TOKEN/GH_TOKEN or GITLAB_TOKEN.
+	TokenSecret string `toml:"token_secret"`
+}
+
+// Forge providers accepted in [forge].
+const (
+	ForgeGitHub = "github"
+	ForgeGitLab = "gitlab"
+)
+
+// AuditConfig configures scheduled secret audits run by the sync daemon.
+type AuditConfig struct {
+	// IntervalHours is how often a scheduled sync also runs the repo secret
+	// audit; 0 disables scheduled audits.
+	IntervalHours int `toml:"interval_hours"`
+	// WebhookURL receives a JSON POST when new findings appear. It may be
+	// an op:// or env:// reference, resolved at load time.
+	WebhookURL string `toml:"webhook_url"`
+	// Notify shows a desktop notification when new findings appear.
+	Notify bool `toml:"notify"`
+}
+
+// SecretsConfig configures how secret findings are enforced.
+type SecretsConfig struct {
+	// FailOn is the lowest finding confidence ("low", "medium", or "high")
+	// that blocks dot discover in error mode and fails dot scan; weaker
+	// findings only warn. Empty blocks on every finding.
+	FailOn string `toml:"fail_on"`
+}
+
+// DiscoverConfig configures dot discover.
+type DiscoverConfig struct {
+	// Attributes maps home-relative path globs to comma-separated chezmoi
+	// attributes (private, readonly, create, symlink) that discover sets
+	// when adding matching files.
+	Attributes map[string]string `toml:"attributes"`
+	// LargeFileSize is the size in bytes above which a selected file is
+	// flagged for git-lfs or skipping; 0 uses the built-in default.
+	LargeFileSize int64 `toml:"large_file_size"`
+	// IntervalHours is how often a scheduled sync also runs a quiet
+	// discovery pass that records new recommended files for dot discover
+	// --pending; 0 disables it. Nothing is added automatically.
+	IntervalHours int `toml:"interval_hours"`
+	// WebhookURL receives a JSON POST when a scheduled pass finds new
+	// recommended files. It may be an op:// or env:// reference.
+	WebhookURL string `toml:"webhook_url"`
+	// Notify shows a desktop notification when a scheduled pass finds new
+	// recommended files.
+	Notify bool `toml:"notify"`
+}
+
+// HooksConfig lists shell commands run before and after apply, capture,
+// and sync. Each runs through sh -c (cmd /C on Windows) in the repo root
+// with DOTSTATE_HOOK, DOTSTATE_OPERATION, DOT_REPO_ROOT, and
+// DOT_SOURCE_DIR set. A failing pre hook stops the operation.
+type HooksConfig struct {
+	PreApply    []string `toml:"pre_apply"`
+	PostApply   []string `toml:"post_apply"`
+	PreCapture  []string `toml:"pre_capture"`
+	PostCapture []string `toml:"post_capture"`
+	PreSync     []string `toml:"pre_sync"`
+	PostSync    []string `toml:"post_sync"`
+}
+
+// Hook stages, as named in [hooks].
+const (
+	HookPreApply    = "pre_apply"
+	HookPostApply   = "post_apply"
+	HookPreCapture  = "pre_capture"
+	HookPostCapture = "post_capture"
+	HookPreSync     = "pre_sync"
+	HookPostSync    = "post_sync"
+)
+
 // Default values.
 const (
 	DefaultBranch         = "main"
@@ -66,6 +263,9 @@ const (
 	DefaultSourceDir      = "home"
 	DefaultEnableIdle     = true
 	DefaultEnableShutdown = true
+	DefaultBackupKeep     = 10
+
+	DefaultPushFallbackBranch = "dotstate/{machine}"
 )
 
 // Environment variable names.
@@ -76,16 +276,52 @@ const (
 	EnvRepoBranch = "DOTSTATE_REPO_BRANCH"
 	EnvVerbose    = "DOTSTATE_VERBOSE"
 	EnvLogLevel   = "DOTSTATE_LOG_LEVEL"
+
+	EnvAuditWebhookURL    = "DOTSTATE_AUDIT_WEBHOOK_URL"
+	EnvDiscoverWebhookURL = "DOTSTATE_DISCOVER_WEBHOOK_URL"
 )
 
 // Load loads configuration from a file path.
 func Load(path string) (*Config, error) {
+	cfg, err := decode(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve op:// and env:// references in secret fields
+	if err := cfg.resolveSecretRefs(); err != nil {
+		return nil, err
+	}
+
+	// Validate
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validate config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// LoadUnresolved loads the config at path like Load, but leaves op:// and
+// env:// references as written and skips validation, which needs them
+// resolved. It is for callers that show the config rather than use it.
+func LoadUnresolved(path string) (*Config, error) {
+	return decode(path)
+}
+
+// decode reads the config at path with defaults, OS overrides, environment
+// overrides, and expanded paths applied.
+func decode(path string) (*Config, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read config file: %w", err)
 	}
 
-	var cfg Config
+	b, err = applyOSOverrides(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse config file: %w", err)
+	}
+
+	cfg := decodeDefaults()
 	if err := toml.Unmarshal(b, &cfg); err != nil {
 		return nil, fmt.Errorf("parse config file: %w", err)
 	}
@@ -104,13 +340,73 @@ func Load(path string) (*Config, error) {
 	if err := cfg.expandPaths(); err != nil {
 		return nil, err
 	}
+	return &cfg, nil
+}
 
-	// Validate
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("validate config: %w", err)
+// osOverrideKeys are the subtables, like [tools.darwin], that override their
+// parent section on the matching OS.
+var osOverrideKeys = []string{string(platform.Darwin), string(platform.Linux), string(platform.Windows)}
+
+// applyOSOverrides merges each section's subtable for the current OS over
+// the section and drops the subtables for every OS, returning the rewritten
+// TOML document.
+func applyOSOverrides(b []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := toml.Unmarshal(b, &doc); err != nil {
+		return nil, err
 	}
 
-	return &cfg, nil
+	goos := ""
+	if plat, err := currentPlatform(); err == nil {
+		goos = string(plat.OS)
+	}
+
+	changed := false
+	for _, section := range doc {
+		table, ok := section.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, name := range osOverrideKeys {
+			override, ok := table[name].(map[string]any)
+			if !ok {
+				continue
+			}
+			delete(table, name)
+			changed = true
+			if name == goos {
+				mergeTables(table, override)
+			}
+		}
+	}
+	if !changed {
+		return b, nil
+	}
+	return toml.Marshal(doc)
+}
+
+// mergeTables deep-merges src into dst; src wins for non-table values.
+func mergeTables(dst, src map[string]any) {
+	for key, value := range src {
+		srcTable, srcOK := value.(map[string]any)
+		dstTable, dstOK := dst[key].(map[string]any)
+		if srcOK && dstOK {
+			mergeTables(dstTable, srcTable)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// decodeDefaults returns the Config a file is decoded into. It holds the
+// defaults of fields whose zero value a user may set on purpose, such as an
+// empty sync.push_fallback_branch to disable the fallback or backup.keep = 0
+// to keep every backup set, so that only an absent key gets the default.
+func decodeDefaults() Config {
+	return Config{
+		Sync:   SyncConfig{PushFallbackBranch: DefaultPushFallbackBranch},
+		Backup: BackupConfig{Keep: DefaultBackupKeep},
+	}
 }
 
 // applyDefaults sets default values for unset fields.
@@ -124,6 +420,9 @@ func (c *Config) applyDefaults() {
 	if c.Chex.SourceDir == "" {
 		c.Chex.SourceDir = DefaultSourceDir
 	}
+	if c.Chex.Engine == "" {
+		c.Chex.Engine = EngineChezmoi
+	}
 	// Note: EnableIdle and EnableShutdown default to false (zero value)
 	// so we can't distinguish "not set" from "set to false"
 	// The toml file should explicitly set these
@@ -140,6 +439,12 @@ func (c *Config) applyEnvOverrides() {
 	if branch := os.Getenv(EnvRepoBranch); branch != "" {
 		c.Repo.Branch = branch
 	}
+	if webhook := os.Getenv(EnvAuditWebhookURL); webhook != "" {
+		c.Audit.WebhookURL = webhook
+	}
+	if webhook := os.Getenv(EnvDiscoverWebhookURL); webhook != "" {
+		c.Discover.WebhookURL = webhook
+	}
 }
 
 // expandPaths expands ~ and environment variables in path fields.
@@ -166,6 +471,16 @@ func (c *Config) expandPaths() error {
 		return fmt.Errorf("expand tools.op: %w", err)
 	}
 
+	c.Tools.Age, err = ExpandPath(c.Tools.Age)
+	if err != nil {
+		return fmt.Errorf("expand tools.age: %w", err)
+	}
+
+	c.Encryption.Identity, err = ExpandPath(c.Encryption.Identity)
+	if err != nil {
+		return fmt.Errorf("expand encryption.identity: %w", err)
+	}
+
 	return nil
 }
 
@@ -189,11 +504,141 @@ func (c *Config) Validate() error {
 		errs = append(errs, "sync.interval_minutes must be non-negative")
 	}
 
+	for _, pattern := range c.ConflictPatterns() {
+		policy := c.Sync.Conflicts[pattern]
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("sync.conflicts pattern %q is invalid: %v", pattern, err))
+		}
+		switch policy {
+		case ConflictOurs, ConflictTheirs, ConflictManual:
+		default:
+			errs = append(errs, fmt.Sprintf("sync.conflicts[%q] must be one of ours, theirs, manual (got %q)", pattern, policy))
+		}
+	}
+
+	if b := c.Sync.PushFallbackBranch; b != "" && (strings.TrimSpace(b) != b || strings.ContainsAny(b, " ~^:?*[\\")) {
+		errs = append(errs, fmt.Sprintf("sync.push_fallback_branch %q is not a valid branch name", b))
+	}
+	if c.Sync.PushFallbackPR && c.Sync.PushFallbackBranch == "" {
+		errs = append(errs, "sync.push_fallback_pr requires sync.push_fallback_branch")
+	}
+	for _, m := range commitTemplatePlaceholder.FindAllStringSubmatch(c.Sync.CommitTemplate, -1) {
+		if !slices.Contains(CommitTemplateFields, m[1]) {
+			errs = append(errs, fmt.Sprintf("sync.commit_template placeholder %s is unknown; use {{%s}}", m[0], strings.Join(CommitTemplateFields, "}}, {{")))
+		}
+	}
+	if t := c.Sync.CommitTemplate; t != "" && strings.TrimSpace(t) == "" {
+		errs = append(errs, "sync.commit_template cannot be empty whitespace")
+	}
+
 	// Source dir must be set
 	if c.Chex.SourceDir == "" {
 		errs = append(errs, "chex.source_dir is required")
 	}
 
+	switch c.Chex.Engine {
+	case "", EngineChezmoi:
+		if c.Chex.NativeMode != "" {
+			errs = append(errs, "chex.native_mode requires chex.engine = \"native\"")
+		}
+	case EngineNative:
+		switch c.Chex.NativeMode {
+		case "", "copy", "symlink":
+		default:
+			errs = append(errs, fmt.Sprintf("chex.native_mode must be copy or symlink (got %q)", c.Chex.NativeMode))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("chex.engine must be chezmoi or native (got %q)", c.Chex.Engine))
+	}
+
+	if c.Tools.ChezmoiVersion != "" && c.Tools.Chezmoi != "" {
+		errs = append(errs, "tools.chezmoi and tools.chezmoi_version are mutually exclusive")
+	}
+	if c.Tools.MaxOutput < 0 {
+		errs = append(errs, "tools.max_output must be non-negative")
+	}
+
+	if c.Backup.Keep < 0 {
+		errs = append(errs, "backup.keep must be non-negative")
+	}
+	if c.Backup.MaxAgeDays < 0 {
+		errs = append(errs, "backup.max_age_days must be non-negative")
+	}
+
+	if len(c.Encryption.Files) > 0 {
+		if len(c.Encryption.Recipients) == 0 {
+			errs = append(errs, "encryption.recipients is required when encryption.files is set")
+		}
+		if c.Encryption.Identity == "" {
+			errs = append(errs, "encryption.identity is required when encryption.files is set")
+		}
+	}
+	for _, file := range c.Encryption.Files {
+		clean := filepath.ToSlash(filepath.Clean(file))
+		if file == "" || filepath.IsAbs(file) || strings.HasPrefix(file, "~") || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			errs = append(errs, fmt.Sprintf("encryption.files entry %q must be a path relative to the home directory", file))
+		}
+	}
+
+	for _, name := range sortedKeys(c.Templates.Secrets) {
+		if !strings.HasPrefix(c.Templates.Secrets[name], "op://") {
+			errs = append(errs, fmt.Sprintf("templates.secrets[%q] must be an op:// reference", name))
+		}
+	}
+
+	errs = append(errs, c.validateApply()...)
+
+	for _, stage := range []string{HookPreApply, HookPostApply, HookPreCapture, HookPostCapture, HookPreSync, HookPostSync} {
+		for i, command := range c.HookCommands(stage) {
+			if strings.TrimSpace(command) == "" {
+				errs = append(errs, fmt.Sprintf("hooks.%s[%d] is empty", stage, i))
+			}
+		}
+	}
+
+	switch c.Forge.Provider {
+	case "", ForgeGitHub, ForgeGitLab:
+	default:
+		errs = append(errs, fmt.Sprintf("forge.provider must be github or gitlab (got %q)", c.Forge.Provider))
+	}
+	if name := c.Forge.TokenSecret; name != "" {
+		if _, ok := c.Templates.Secrets[name]; !ok {
+			errs = append(errs, fmt.Sprintf("forge.token_secret %q is not defined in [templates.secrets]", name))
+		}
+	}
+
+	for _, pattern := range c.AttributePatterns() {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("discover.attributes pattern %q is invalid: %v", pattern, err))
+		}
+		if _, err := chez.ParseAttributes(c.Discover.Attributes[pattern]); err != nil {
+			errs = append(errs, fmt.Sprintf("discover.attributes[%q]: %v", pattern, err))
+		}
+	}
+
+	if c.Discover.LargeFileSize < 0 {
+		errs = append(errs, "discover.large_file_size must be non-negative")
+	}
+	if c.Discover.IntervalHours < 0 {
+		errs = append(errs, "discover.interval_hours must be non-negative")
+	}
+	if c.Discover.WebhookURL != "" && !strings.HasPrefix(c.Discover.WebhookURL, "https://") && !strings.HasPrefix(c.Discover.WebhookURL, "http://") {
+		errs = append(errs, "discover.webhook_url must be an http(s) URL")
+	}
+
+	switch c.Secrets.FailOn {
+	case "", "low", "medium", "high":
+	default:
+		errs = append(errs, fmt.Sprintf("secrets.fail_on %q must be low, medium, or high", c.Secrets.FailOn))
+	}
+
+	if c.Audit.IntervalHours < 0 {
+		errs = append(errs, "audit.interval_hours must be non-negative")
+	}
+	if c.Audit.WebhookURL != "" && !strings.HasPrefix(c.Audit.WebhookURL, "https://") && !strings.HasPrefix(c.Audit.WebhookURL, "http://") {
+		errs = append(errs, "audit.webhook_url must be an http(s) URL")
+	}
+
 	// WSL validation
 	if c.WSL.Enable {
 		if c.WSL.DistroName == "" {
@@ -219,6 +664,61 @@ func (e *ValidationError) Error() string {
 	return fmt.Sprintf("config validation errors:\n  - %s", strings.Join(e.Errors, "\n  - "))
 }
 
+// ConflictPatterns returns the [sync.conflicts] globs ordered from most to
+// least specific (longest first, then lexically), which is also the order in
+// which they are matched.
+func (c *Config) ConflictPatterns() []string {
+	return bySpecificity(c.Sync.Conflicts)
+}
+
+// AttributePatterns returns the [discover.attributes] globs in the same
+// most-specific-first order as ConflictPatterns.
+func (c *Config) AttributePatterns() []string {
+	return bySpecificity(c.Discover.Attributes)
+}
+
+// HookCommands returns the commands configured for stage.
+func (c *Config) HookCommands(stage string) []string {
+	switch stage {
+	case HookPreApply:
+		return c.Hooks.PreApply
+	case HookPostApply:
+		return c.Hooks.PostApply
+	case HookPreCapture:
+		return c.Hooks.PreCapture
+	case HookPostCapture:
+		return c.Hooks.PostCapture
+	case HookPreSync:
+		return c.Hooks.PreSync
+	case HookPostSync:
+		return c.Hooks.PostSync
+	}
+	return nil
+}
+
+func bySpecificity(m map[string]string) []string {
+	patterns := make([]string, 0, len(m))
+	for pattern := range m {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	return patterns
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // ConfigPath returns the path to the config file.
 func (c *Config) ConfigPath() string {
 	return c.configPath
@@ -244,11 +744,45 @@ func (c *Config) PrivatePath() string {
 	return filepath.Join(c.repoRoot, "state", "private")
 }
 
+// BackupPath returns the full path to the local backup directory.
+func (c *Config) BackupPath() string {
+	return filepath.Join(c.Repo.Path, "state", "backups")
+}
+
+// EncryptedPath returns the full path to the tracked age ciphertext directory.
+func (c *Config) EncryptedPath() string {
+	return filepath.Join(c.Repo.Path, "state", "encrypted")
+}
+
+// AuditStatePath returns the local file recording scheduled secret audit
+// state.
+func (c *Config) AuditStatePath() string {
+	return filepath.Join(c.Repo.Path, "state", "audit", "secrets.json")
+}
+
+// DiscoverPendingPath returns the local file holding candidates found by
+// scheduled discovery passes.
+func (c *Config) DiscoverPendingPath() string {
+	return filepath.Join(c.Repo.Path, "state", "audit", "discover.json")
+}
+
 // LogPath returns the full path to the log directory.
 func (c *Config) LogPath() string {
 	return filepath.Join(c.repoRoot, "state", "logs")
 }
 
+// JournalPath returns the local file recording this machine's sync,
+// capture, apply, and undo runs.
+func (c *Config) JournalPath() string {
+	return filepath.Join(c.LogPath(), "journal.jsonl")
+}
+
+// DaemonPath returns the directory holding dot daemon's state and its
+// pause and stop requests.
+func (c *Config) DaemonPath() string {
+	return filepath.Join(c.LogPath(), "daemon")
+}
+
 // FindRepoConfig searches for dot.toml starting from startDir and walking upward.
 func FindRepoConfig(startDir string) (string, error) {
 	dir := startDir
@@ -325,12 +859,30 @@ func (e *NotFoundError) Error() string {
 	return fmt.Sprintf("could not find %s starting from %s", ConfigFileName, e.StartDir)
 }
 
-// ExpandPath expands ~ and environment variables in a path.
+// currentPlatform resolves {placeholders}; tests substitute a fixed platform.
+var currentPlatform = platform.Current
+
+// ExpandPath expands {placeholders}, ~, and environment variables in a path.
 func ExpandPath(p string) (string, error) {
 	if p == "" {
 		return "", nil
 	}
 
+	// Expand platform placeholders such as {home} and {configdir}
+	if strings.Contains(p, "{") {
+		plat, err := currentPlatform()
+		if err != nil {
+			return "", err
+		}
+		expanded, err := plat.ExpandPlaceholders(p)
+		if err != nil {
+			return "", err
+		}
+		if expanded != p {
+			p = filepath.Clean(expanded)
+		}
+	}
+
 	// Expand ~
 	if strings.HasPrefix(p, "~") {
 		home, err := os.UserHomeDir()
@@ -368,9 +920,14 @@ func Default() *Config {
 			IntervalMinutes: DefaultSyncInterval,
 			EnableIdle:      DefaultEnableIdle,
 			EnableShutdown:  DefaultEnableShutdown,
+
+			PushFallbackBranch: DefaultPushFallbackBranch,
 		},
 		Chex: ChexConfig{
 			SourceDir: DefaultSourceDir,
 		},
+		Backup: BackupConfig{
+			Keep: DefaultBackupKeep,
+		},
 	}
 }
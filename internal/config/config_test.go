@@ -3,7 +3,10 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/platform"
 )
 
 func TestExpandPath(t *testing.T) {
@@ -323,6 +326,29 @@ path = "` + tmpDir + `/repo"
 	if cfg.Chex.SourceDir != DefaultSourceDir {
 		t.Errorf("Chex.SourceDir = %v, want default %v", cfg.Chex.SourceDir, DefaultSourceDir)
 	}
+	if cfg.Backup.Keep != DefaultBackupKeep {
+		t.Errorf("Backup.Keep = %v, want default %v", cfg.Backup.Keep, DefaultBackupKeep)
+	}
+	if cfg.Sync.PushFallbackBranch != DefaultPushFallbackBranch {
+		t.Errorf("Sync.PushFallbackBranch = %q, want default %q", cfg.Sync.PushFallbackBranch, DefaultPushFallbackBranch)
+	}
+
+	// An explicit empty value disables the fallback, and keep = 0 keeps
+	// every backup set.
+	configContent += "\n[sync]\npush_fallback_branch = \"\"\n\n[backup]\nkeep = 0\n"
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Sync.PushFallbackBranch != "" {
+		t.Errorf("Sync.PushFallbackBranch = %q, want empty when set to \"\"", cfg.Sync.PushFallbackBranch)
+	}
+	if cfg.Backup.Keep != 0 {
+		t.Errorf("Backup.Keep = %d, want 0 when set to 0", cfg.Backup.Keep)
+	}
 }
 
 func TestLoadWithEnvOverride(t *testing.T) {
@@ -386,6 +412,365 @@ url = "test"
 	}
 }
 
+func TestLoadSyncConflicts(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `[repo]
+path = "` + tmpDir + `/repo"
+
+[sync.conflicts]
+"home/dot_cache/**" = "theirs"
+"home/dot_zshrc" = "manual"
+"*.lock" = "ours"
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Sync.Conflicts["home/dot_cache/**"] != ConflictTheirs {
+		t.Errorf("Sync.Conflicts = %#v", cfg.Sync.Conflicts)
+	}
+	patterns := cfg.ConflictPatterns()
+	want := []string{"home/dot_cache/**", "home/dot_zshrc", "*.lock"}
+	for i := range want {
+		if patterns[i] != want[i] {
+			t.Fatalf("ConflictPatterns() = %v, want %v", patterns, want)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownConflictPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `[repo]
+path = "` + tmpDir + `/repo"
+
+[sync.conflicts]
+"home/**" = "mine"
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	_, err := Load(configPath)
+	if err == nil || !contains(err.Error(), "sync.conflicts") {
+		t.Fatalf("Load() error = %v, want sync.conflicts validation error", err)
+	}
+}
+
+func TestLoadDiscoverAttributes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `[repo]
+path = "` + tmpDir + `/repo"
+
+[discover.attributes]
+".ssh/*" = "private"
+"*.key" = "bogus"
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	_, err := Load(configPath)
+	if err == nil || !contains(err.Error(), `discover.attributes["*.key"]`) {
+		t.Fatalf("Load() error = %v, want discover.attributes validation error", err)
+	}
+}
+
+func TestLoadEncryption(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `[repo]
+path = "` + tmpDir + `/repo"
+
+[encryption]
+recipients = ["age1example"]
+identity = "` + tmpDir + `/age.txt"
+files = [".config/vpn/work.conf"]
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Encryption.Files) != 1 || cfg.Encryption.Files[0] != ".config/vpn/work.conf" {
+		t.Errorf("Encryption.Files = %v", cfg.Encryption.Files)
+	}
+	if cfg.EncryptedPath() != filepath.Join(tmpDir, "repo", "state", "encrypted") {
+		t.Errorf("EncryptedPath() = %v", cfg.EncryptedPath())
+	}
+}
+
+func TestValidateEncryption(t *testing.T) {
+	cfg := Default()
+	cfg.Repo.Path = "/repo"
+	cfg.Encryption.Files = []string{"/etc/hosts", "../outside", ".ssh/config"}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() expected error")
+	}
+	for _, want := range []string{"encryption.recipients", "encryption.identity", `"/etc/hosts"`, `"../outside"`} {
+		if !contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want mention of %s", err, want)
+		}
+	}
+	if contains(err.Error(), `".ssh/config"`) {
+		t.Errorf("Validate() rejected valid entry: %v", err)
+	}
+}
+
+func TestValidateRejectsChezmoiPathWithPinnedVersion(t *testing.T) {
+	cfg := Default()
+	cfg.Repo.Path = "/repo"
+	cfg.Tools.Chezmoi = "/usr/local/bin/chezmoi"
+	cfg.Tools.ChezmoiVersion = "2.52.1"
+
+	err := cfg.Validate()
+	if err == nil || !contains(err.Error(), "mutually exclusive") {
+		t.Fatalf("Validate() error = %v, want mutually exclusive", err)
+	}
+}
+
+func TestValidateChexEngine(t *testing.T) {
+	cfg := Default()
+	cfg.Repo.Path = "/repo"
+	cfg.Chex.Engine = EngineNative
+	cfg.Chex.NativeMode = "symlink"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	cfg.Chex.NativeMode = "hardlink"
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "chex.native_mode") {
+		t.Fatalf("Validate() error = %v, want native_mode error", err)
+	}
+
+	cfg.Chex.Engine = "stow"
+	cfg.Chex.NativeMode = ""
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "chex.engine") {
+		t.Fatalf("Validate() error = %v, want engine error", err)
+	}
+}
+
+func TestValidatePushFallback(t *testing.T) {
+	cfg := Default()
+	cfg.Repo.Path = "/repo"
+	cfg.Sync.PushFallbackPR = true
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	cfg.Sync.PushFallbackBranch = "dot sync/{machine}"
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "sync.push_fallback_branch") {
+		t.Fatalf("Validate() error = %v, want branch name error", err)
+	}
+
+	cfg.Sync.PushFallbackBranch = ""
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "sync.push_fallback_pr requires") {
+		t.Fatalf("Validate() error = %v, want push_fallback_pr error", err)
+	}
+}
+
+func TestValidateCommitTemplate(t *testing.T) {
+	cfg := Default()
+	cfg.Repo.Path = "/repo"
+	cfg.Sync.CommitTemplate = "{{hostname}} ({{machine}}, {{profile}}) at {{date}}: {{changed_files}}"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	cfg.Sync.CommitTemplate = "sync {{host}}"
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "placeholder {{host}} is unknown") {
+		t.Fatalf("Validate() error = %v, want unknown placeholder error", err)
+	}
+}
+
+func TestApplyPipeline(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `[repo]
+path = "` + tmpDir + `/repo"
+
+[apply.steps.os]
+after = []
+
+[apply.steps.packages]
+enabled = false
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	steps, err := cfg.ApplyPipeline()
+	if err != nil {
+		t.Fatalf("ApplyPipeline() error = %v", err)
+	}
+	if got := strings.Join(steps, ","); got != "files,subrepos,scripts,os" {
+		t.Fatalf("ApplyPipeline() = %s", got)
+	}
+
+	steps, _ = Default().ApplyPipeline()
+	if got := strings.Join(steps, ","); got != "files,packages,subrepos,scripts,os" {
+		t.Fatalf("default ApplyPipeline() = %s", got)
+	}
+
+	cfg.Apply.Steps = map[string]ApplyStepConfig{ApplyStepFiles: {After: []string{ApplyStepScripts}}}
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "cycle among") {
+		t.Fatalf("Validate() error = %v, want cycle error", err)
+	}
+
+	cfg.Apply.Steps = map[string]ApplyStepConfig{"dotfiles": {}, ApplyStepOS: {After: []string{"os", "brew"}}}
+	err = cfg.Validate()
+	for _, want := range []string{"apply.steps.dotfiles is not a known step", "apply.steps.os cannot run after itself", `unknown step "brew"`} {
+		if err == nil || !contains(err.Error(), want) {
+			t.Fatalf("Validate() error = %v, want %q", err, want)
+		}
+	}
+}
+
+func TestValidateRejectsEmptyHook(t *testing.T) {
+	cfg := Default()
+	cfg.Repo.Path = "/repo"
+	cfg.Hooks.PostApply = []string{"brew bundle", " "}
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "hooks.post_apply[1] is empty") {
+		t.Fatalf("Validate() error = %v, want empty hook error", err)
+	}
+}
+
+func TestValidateSecretsFailOn(t *testing.T) {
+	cfg := Default()
+	cfg.Repo.Path = "/repo"
+	cfg.Secrets.FailOn = "high"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	cfg.Secrets.FailOn = "critical"
+	if err := cfg.Validate(); err == nil || !contains(err.Error(), "secrets.fail_on") {
+		t.Fatalf("Validate() error = %v, want fail_on error", err)
+	}
+}
+
+func TestLoadAuditWebhookFromEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `[repo]
+path = "` + tmpDir + `/repo"
+
+[audit]
+interval_hours = 24
+notify = true
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	t.Setenv(EnvAuditWebhookURL, "https://hooks.example.com/dotstate")
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Audit.IntervalHours != 24 || !cfg.Audit.Notify || cfg.Audit.WebhookURL != "https://hooks.example.com/dotstate" {
+		t.Errorf("Audit = %#v", cfg.Audit)
+	}
+}
+
+func TestLoadExpandsPlatformPlaceholders(t *testing.T) {
+	tmpDir := t.TempDir()
+	stubPlatform(t, &platform.Platform{OS: platform.Linux, Arch: "arm64", Home: tmpDir, ConfigDir: filepath.Join(tmpDir, ".config")})
+	configContent := `[repo]
+path = "{home}/dotstate-{os}"
+
+[tools]
+chezmoi = "{configdir}/bin/chezmoi-{arch}"
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Repo.Path != filepath.Join(tmpDir, "dotstate-linux") {
+		t.Errorf("Repo.Path = %v", cfg.Repo.Path)
+	}
+	if cfg.Tools.Chezmoi != filepath.Join(tmpDir, ".config", "bin", "chezmoi-arm64") {
+		t.Errorf("Tools.Chezmoi = %v", cfg.Tools.Chezmoi)
+	}
+}
+
+func TestExpandPathRejectsUnknownPlaceholder(t *testing.T) {
+	stubPlatform(t, &platform.Platform{OS: platform.Linux, Home: "/home/u"})
+	if _, err := ExpandPath("{hom}/repo"); err == nil || !contains(err.Error(), "{hom}") {
+		t.Fatalf("ExpandPath() error = %v, want unknown placeholder", err)
+	}
+}
+
+func TestLoadMergesOSOverrideSections(t *testing.T) {
+	tmpDir := t.TempDir()
+	stubPlatform(t, &platform.Platform{OS: platform.Windows, Home: tmpDir})
+	configContent := `[repo]
+path = "` + filepath.ToSlash(tmpDir) + `/repo"
+branch = "main"
+
+[repo.darwin]
+branch = "mac"
+
+[tools]
+git = "/usr/bin/git"
+chezmoi = "/usr/local/bin/chezmoi"
+
+[tools.windows]
+chezmoi = "C:/tools/chezmoi.exe"
+
+[templates.windows.data]
+shell = "pwsh"
+
+[templates.data]
+shell = "zsh"
+editor = "nvim"
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Repo.Branch != "main" {
+		t.Errorf("Repo.Branch = %v, want darwin override ignored", cfg.Repo.Branch)
+	}
+	if cfg.Tools.Git != "/usr/bin/git" || cfg.Tools.Chezmoi != "C:/tools/chezmoi.exe" {
+		t.Errorf("Tools = %#v", cfg.Tools)
+	}
+	if cfg.Templates.Data["shell"] != "pwsh" || cfg.Templates.Data["editor"] != "nvim" {
+		t.Errorf("Templates.Data = %v", cfg.Templates.Data)
+	}
+}
+
+func stubPlatform(t *testing.T, plat *platform.Platform) {
+	t.Helper()
+	old := currentPlatform
+	currentPlatform = func() (*platform.Platform, error) { return plat, nil }
+	t.Cleanup(func() { currentPlatform = old })
+}
+
 func TestDefault(t *testing.T) {
 	cfg := Default()
 
@@ -438,3 +823,88 @@ func containsAt(s, substr string, start int) bool {
 	}
 	return false
 }
+
+func TestLoadResolvesSecretRefs(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `[repo]
+path = "` + tmpDir + `/repo"
+
+[audit]
+webhook_url = "op://Private/Slack/url"
+
+[discover]
+webhook_url = "env://DOTSTATE_TEST_DISCOVER_HOOK"
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	t.Setenv("DOTSTATE_TEST_DISCOVER_HOOK", "https://hooks.example.com/discover")
+
+	old := resolveSecretRef
+	resolveSecretRef = func(opBin, ref string) (string, error) {
+		if ref == "op://Private/Slack/url" {
+			return "https://hooks.example.com/audit", nil
+		}
+		return old(opBin, ref)
+	}
+	t.Cleanup(func() { resolveSecretRef = old })
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Audit.WebhookURL != "https://hooks.example.com/audit" {
+		t.Errorf("Audit.WebhookURL = %q", cfg.Audit.WebhookURL)
+	}
+	if cfg.Discover.WebhookURL != "https://hooks.example.com/discover" {
+		t.Errorf("Discover.WebhookURL = %q", cfg.Discover.WebhookURL)
+	}
+}
+
+func TestLoadUnresolvedSecretRefFails(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `[repo]
+path = "` + tmpDir + `/repo"
+
+[audit]
+webhook_url = "env://DOTSTATE_TEST_UNSET_HOOK"
+`
+	configPath := filepath.Join(tmpDir, "dot.toml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	_, err := Load(configPath)
+	if err == nil || !contains(err.Error(), "audit.webhook_url") {
+		t.Fatalf("Load() error = %v, want audit.webhook_url resolution error", err)
+	}
+}
+
+func TestScaffoldLoadsAndIsCommented(t *testing.T) {
+	cfg := Default()
+	cfg.Repo.URL = "git@example.com:me/dots.git"
+	cfg.Repo.Path = "~/dots"
+	b, err := Scaffold(cfg)
+	if err != nil {
+		t.Fatalf("Scaffold() error = %v", err)
+	}
+	for _, want := range []string{"[repo]\n# Remote git URL", "url = 'git@example.com:me/dots.git'", "# Apply engine"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("Scaffold() output missing %q:\n%s", want, b)
+		}
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, ConfigFileName)
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load(scaffolded) error = %v", err)
+	}
+	if loaded.Repo.URL != cfg.Repo.URL || loaded.Chex.SourceDir != DefaultSourceDir || loaded.Backup.Keep != DefaultBackupKeep || !loaded.Sync.EnableIdle {
+		t.Fatalf("scaffolded config lost defaults: %+v", loaded)
+	}
+}
@@ -0,0 +1,554 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// Issue is one problem in a dot.toml, as dot config validate reports it.
+type Issue struct {
+	// Line is 1-based; 0 when the problem has no single place in the file.
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+	// Warning marks problems Load tolerates, such as unknown keys.
+	Warning bool `json:"warning,omitempty"`
+}
+
+func (i Issue) String() string {
+	if i.Line == 0 {
+		return i.Message
+	}
+	return fmt.Sprintf("line %d: %s", i.Line, i.Message)
+}
+
+// ValidateFile checks the config at path the way Load does, without
+// resolving op:// and env:// references, and returns every problem with
+// the line it is on. The error is only for a file that cannot be read.
+func ValidateFile(path string) ([]Issue, error) {
+	doc, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	return check(doc, path), nil
+}
+
+func check(doc []byte, path string) []Issue {
+	if err := toml.Unmarshal(doc, &Config{}); err != nil {
+		return []Issue{decodeIssue(err)}
+	}
+
+	var issues []Issue
+	var strict *toml.StrictMissingError
+	if err := toml.NewDecoder(bytes.NewReader(doc)).DisallowUnknownFields().Decode(&Config{}); errors.As(err, &strict) {
+		for _, e := range strict.Errors {
+			key := e.Key()
+			// [tools.darwin] and friends are merged away before decoding.
+			if len(key) > 1 && slices.Contains(osOverrideKeys, key[1]) {
+				continue
+			}
+			row, _ := e.Position()
+			issues = append(issues, Issue{Line: row, Message: "unknown key " + strings.Join(key, "."), Warning: true})
+		}
+	}
+
+	b, err := applyOSOverrides(doc)
+	if err != nil {
+		return append(issues, Issue{Message: err.Error()})
+	}
+	cfg := decodeDefaults()
+	if err := toml.Unmarshal(b, &cfg); err != nil {
+		return append(issues, Issue{Message: err.Error()})
+	}
+	cfg.configPath = path
+	cfg.repoRoot = filepath.Dir(path)
+	cfg.applyDefaults()
+	cfg.applyEnvOverrides()
+
+	keys := indexKeys(doc)
+	if err := cfg.expandPaths(); err != nil {
+		issues = append(issues, Issue{Line: keys.lineFor(err.Error()), Message: err.Error()})
+	}
+	var verr *ValidationError
+	if errors.As(cfg.Validate(), &verr) {
+		for _, msg := range verr.Errors {
+			issues = append(issues, Issue{Line: keys.lineFor(msg), Message: msg})
+		}
+	}
+	return issues
+}
+
+func decodeIssue(err error) Issue {
+	var derr *toml.DecodeError
+	if errors.As(err, &derr) {
+		row, _ := derr.Position()
+		return Issue{Line: row, Message: derr.Error()}
+	}
+	return Issue{Message: err.Error()}
+}
+
+// keyIndex maps each key and table path in a document, joined with dots,
+// to the line it is first written on.
+type keyIndex map[string]int
+
+func indexKeys(doc []byte) keyIndex {
+	idx := keyIndex{}
+	var p unstable.Parser
+	p.Reset(doc)
+	var table []string
+	for p.NextExpression() {
+		e := p.Expression()
+		switch e.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			key, first, _ := nodeKey(e)
+			table = key
+			idx.add(key, p.Shape(first).Start.Line)
+		case unstable.KeyValue:
+			key, first, _ := nodeKey(e)
+			full := append(slices.Clone(table), key...)
+			line := p.Shape(first).Start.Line
+			// Dotted keys also define their parents, e.g. conflicts."*.json".
+			for n := len(table) + 1; n <= len(full); n++ {
+				idx.add(full[:n], line)
+			}
+		}
+	}
+	return idx
+}
+
+func (idx keyIndex) add(path []string, line int) {
+	key := strings.Join(path, ".")
+	if _, ok := idx[key]; !ok {
+		idx[key] = line
+	}
+}
+
+// issueKey finds the key a Validate message is about, with the map key in
+// forms like sync.conflicts["*.json"] or sync.conflicts pattern "*.json".
+var issueKey = regexp.MustCompile(`([a-z_]+(?:\.[A-Za-z0-9_-]+)+)(?:\[("(?:[^"\\]|\\.)*")\]| pattern ("(?:[^"\\]|\\.)*"))?`)
+
+// lineFor returns the line of the most specific key msg names that is in
+// the document, or 0.
+func (idx keyIndex) lineFor(msg string) int {
+	m := issueKey.FindStringSubmatch(msg)
+	if m == nil {
+		return 0
+	}
+	path := strings.Split(m[1], ".")
+	for _, quoted := range m[2:] {
+		if name, err := strconv.Unquote(quoted); err == nil {
+			path = append(path, name)
+		}
+	}
+	for n := len(path); n > 0; n-- {
+		if line, ok := idx[strings.Join(path[:n], ".")]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+// nodeKey returns the dotted key of a table or key/value expression and the
+// ranges of its first and last parts.
+func nodeKey(e *unstable.Node) (key []string, first, last unstable.Range) {
+	it := e.Key()
+	for it.Next() {
+		n := it.Node()
+		if len(key) == 0 {
+			first = n.Raw
+		}
+		last = n.Raw
+		key = append(key, string(n.Data))
+	}
+	return key, first, last
+}
+
+// Get returns the effective value of the dotted key in c: defaults
+// applied, OS overrides merged, and paths expanded. Tables come back as
+// maps. Load c with LoadUnresolved, so secret fields show their op:// or
+// env:// reference rather than the secret.
+func Get(c *Config, key string) (any, error) {
+	path, _, err := resolveKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) > 1 && slices.Contains(osOverrideKeys, path[1]) {
+		return nil, fmt.Errorf("%s is merged into [%s] when dot.toml is loaded; get %s.%s for the effective value", key, path[0], path[0], strings.Join(path[2:], "."))
+	}
+	b, err := toml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := toml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	for _, name := range path {
+		table, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s is not set", key)
+		}
+		if v, ok = table[name]; !ok {
+			return nil, fmt.Errorf("%s is not set", key)
+		}
+	}
+	return v, nil
+}
+
+// FormatValue renders the value Get returned for key: strings as they
+// are, tables as TOML with their subtables under full [key.name] headers,
+// and anything else as a TOML value.
+func FormatValue(key string, v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case map[string]any:
+		var b strings.Builder
+		if err := writeTable(&b, strings.Split(key, "."), v); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(b.String()), nil
+	}
+	return encodeValue(v)
+}
+
+func writeTable(b *strings.Builder, path []string, table map[string]any) error {
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var subtables []string
+	for _, name := range names {
+		if _, ok := table[name].(map[string]any); ok {
+			subtables = append(subtables, name)
+			continue
+		}
+		enc, err := encodeValue(table[name])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "%s = %s\n", formatKey([]string{name}), enc)
+	}
+	for _, name := range subtables {
+		sub := append(slices.Clone(path), name)
+		fmt.Fprintf(b, "\n[%s]\n", formatKey(sub))
+		if err := writeTable(b, sub, table[name].(map[string]any)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set returns doc with the dotted key set to value, which is parsed for
+// the key's type: strings are taken as they are, booleans and integers
+// must parse, and lists take a TOML array or a single string. Everything
+// else in doc, comments included, is kept as written. A missing key is
+// added at the end of its table, and a missing table at the end of doc.
+func Set(doc []byte, key, value string) ([]byte, error) {
+	path, typ, err := resolveKey(key)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseValue(key, typ, value)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := encodeValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var p unstable.Parser
+	p.Reset(doc)
+	var table, parent []string
+	inArray := false
+	insertAt := -1
+	for p.NextExpression() {
+		e := p.Expression()
+		switch e.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			var last unstable.Range
+			table, _, last = nodeKey(e)
+			inArray = e.Kind == unstable.ArrayTable
+			if !inArray && len(table) < len(path) && len(table) > len(parent) && slices.Equal(table, path[:len(table)]) {
+				parent = table
+				insertAt = lineEnd(doc, int(last.Offset+last.Length))
+			}
+		case unstable.KeyValue:
+			if inArray {
+				continue
+			}
+			rel, _, last := nodeKey(e)
+			full := append(slices.Clone(table), rel...)
+			end := int(e.Raw.Offset + e.Raw.Length)
+			switch {
+			case slices.Equal(full, path):
+				start := int(last.Offset + last.Length)
+				start += bytes.IndexByte(doc[start:end], '=') + 1
+				for start < end && (doc[start] == ' ' || doc[start] == '\t') {
+					start++
+				}
+				return slices.Concat(doc[:start], []byte(enc), doc[end:]), nil
+			case len(full) < len(path) && slices.Equal(full, path[:len(full)]):
+				return nil, fmt.Errorf("%s is set inline as %s; edit dot.toml directly", key, strings.Join(full, "."))
+			}
+			if parent != nil && slices.Equal(table, parent) {
+				insertAt = lineEnd(doc, end)
+			}
+		}
+	}
+	if err := p.Error(); err != nil {
+		return nil, fmt.Errorf("parse config file: %w", err)
+	}
+
+	if parent != nil {
+		line := formatKey(path[len(parent):]) + " = " + enc + "\n"
+		if insertAt == len(doc) && !bytes.HasSuffix(doc, []byte("\n")) {
+			line = "\n" + line
+		}
+		return slices.Concat(doc[:insertAt], []byte(line), doc[insertAt:]), nil
+	}
+	out := slices.Clone(doc)
+	if len(out) > 0 {
+		if !bytes.HasSuffix(out, []byte("\n")) {
+			out = append(out, '\n')
+		}
+		out = append(out, '\n')
+	}
+	out = fmt.Appendf(out, "[%s]\n%s = %s\n", formatKey(path[:len(path)-1]), formatKey(path[len(path)-1:]), enc)
+	return out, nil
+}
+
+// SetFile sets key to value in the config file at path with Set. The file
+// is left alone if the edit would make it fail to load.
+func SetFile(path, key, value string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	doc, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	out, err := Set(doc, key, value)
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	for _, issue := range check(doc, path) {
+		known[issue.Message] = true
+	}
+	var errs []string
+	for _, issue := range check(out, path) {
+		if !issue.Warning && !known[issue.Message] {
+			errs = append(errs, issue.Message)
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".dot.toml-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// resolveKey splits a dotted key into its TOML path using Config's
+// schema and returns the type of the value it names. Map keys may contain
+// dots when the map holds plain values, as in sync.conflicts.*.json, and
+// a section may name an OS override table, as in tools.darwin.git.
+func resolveKey(key string) ([]string, reflect.Type, error) {
+	segs := strings.Split(key, ".")
+	t := reflect.TypeOf(Config{})
+	var path []string
+	for i := 0; i < len(segs); i++ {
+		seg := segs[i]
+		switch t.Kind() {
+		case reflect.Struct:
+			if len(path) == 1 && slices.Contains(osOverrideKeys, seg) {
+				path = append(path, seg)
+				continue
+			}
+			field, ok := fieldByTag(t, seg)
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown config key %q", key)
+			}
+			path = append(path, seg)
+			t = field.Type
+		case reflect.Map:
+			if elem := t.Elem().Kind(); elem != reflect.Struct && elem != reflect.Interface {
+				return append(path, strings.Join(segs[i:], ".")), t.Elem(), nil
+			}
+			if seg == "" {
+				return nil, nil, fmt.Errorf("unknown config key %q", key)
+			}
+			path = append(path, seg)
+			t = t.Elem()
+		case reflect.Interface:
+			path = append(path, seg)
+		default:
+			return nil, nil, fmt.Errorf("%s is not a table", strings.Join(path, "."))
+		}
+	}
+	return path, t, nil
+}
+
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if f.IsExported() && tag == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func parseValue(key string, t reflect.Type, raw string) (any, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s takes true or false (got %q)", key, raw)
+		}
+		return v, nil
+	case reflect.Int, reflect.Int64:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s takes an integer (got %q)", key, raw)
+		}
+		return v, nil
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.String {
+			break
+		}
+		if !strings.HasPrefix(strings.TrimSpace(raw), "[") {
+			return []string{raw}, nil
+		}
+		var doc struct {
+			V []string `toml:"v"`
+		}
+		if err := toml.Unmarshal([]byte("v = "+raw), &doc); err != nil {
+			return nil, fmt.Errorf("%s takes a TOML array of strings: %w", key, err)
+		}
+		return doc.V, nil
+	case reflect.Interface:
+		// Free-form data: a TOML value when it parses as one, else a string.
+		var doc map[string]any
+		if err := toml.Unmarshal([]byte("v = "+raw), &doc); err == nil {
+			return doc["v"], nil
+		}
+		return raw, nil
+	}
+	return nil, fmt.Errorf("%s is a table; set one of its keys instead", key)
+}
+
+// encodeValue renders v as a TOML value, with strings in double quotes
+// like the rest of dot.toml.
+func encodeValue(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return quoteString(v), nil
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = quoteString(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]", nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, elem := range v {
+			part, err := encodeValue(elem)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = part
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	}
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf).SetTablesInline(true)
+	if err := enc.Encode(map[string]any{"v": v}); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(buf.String(), "v = "), "\n"), nil
+}
+
+// quoteString returns s as a TOML basic string.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func formatKey(path []string) string {
+	parts := make([]string, len(path))
+	for i, name := range path {
+		parts[i] = name
+		if !bareKey.MatchString(name) {
+			parts[i] = quoteString(name)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// lineEnd returns the offset just past the newline ending the line that
+// holds offset, or len(doc) on the last line.
+func lineEnd(doc []byte, offset int) int {
+	if i := bytes.IndexByte(doc[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(doc)
+}
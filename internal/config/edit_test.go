@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const editDoc = `# dotstate config
+[repo]
+url = "https://github.com/test/dotstate" # origin
+path = "~/dotstate"
+
+[sync]
+interval_minutes = 30 # minutes between syncs
+conflicts."*.json" = "ours"
+
+# Hooks run in the repo root.
+[hooks]
+pre_apply = [
+  "echo one",
+]
+`
+
+func TestSetKeepsCommentsAndLayout(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       string
+	}{
+		{"sync.interval_minutes", "15", `interval_minutes = 15 # minutes between syncs`},
+		{"repo.branch", "trunk", "path = \"~/dotstate\"\nbranch = \"trunk\"\n\n[sync]"},
+		{"sync.conflicts.*.json", "theirs", `conflicts."*.json" = "theirs"`},
+		{"sync.conflicts.state/*.txt", "manual", "conflicts.\"*.json\" = \"ours\"\nconflicts.\"state/*.txt\" = \"manual\"\n"},
+		{"hooks.pre_apply", `["a", "b"]`, "pre_apply = [\"a\", \"b\"]\n"},
+		{"backup.keep", "5", "  \"echo one\",\n]\n\n[backup]\nkeep = 5\n"},
+		{"tools.darwin.git", "/opt/git", "\n[tools.darwin]\ngit = \"/opt/git\"\n"},
+		{"exports.macos-defaults", "true", "\n[exports]\nmacos-defaults = true\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			out, err := Set([]byte(editDoc), tt.key, tt.value)
+			if err != nil {
+				t.Fatalf("Set error = %v", err)
+			}
+			got := string(out)
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Set(%s) =\n%s\nwant it to contain %q", tt.key, got, tt.want)
+			}
+			for _, keep := range []string{"# dotstate config", "# origin", "# Hooks run in the repo root."} {
+				if !strings.Contains(got, keep) {
+					t.Errorf("comment %q was lost", keep)
+				}
+			}
+		})
+	}
+}
+
+func TestSetRejectsBadKeysAndValues(t *testing.T) {
+	for key, value := range map[string]string{
+		"repo.nope":             "x",
+		"repo":                  "x",
+		"sync.interval_minutes": "soon",
+		"sync.enable_idle":      "maybe",
+		"sync.conflicts":        "ours",
+	} {
+		if _, err := Set([]byte(editDoc), key, value); err == nil {
+			t.Errorf("Set(%s, %s) succeeded", key, value)
+		}
+	}
+	inline := "[sync]\nconflicts = { \"*.json\" = \"ours\" }\n"
+	if _, err := Set([]byte(inline), "sync.conflicts.*.json", "theirs"); err == nil || !strings.Contains(err.Error(), "inline") {
+		t.Errorf("Set into inline table error = %v", err)
+	}
+}
+
+func TestSetFileRefusesInvalidResult(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	if err := os.WriteFile(path, []byte(editDoc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetFile(path, "chex.engine", "rsync"); err == nil || !strings.Contains(err.Error(), "chex.engine") {
+		t.Fatalf("SetFile error = %v, want a chex.engine validation error", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != editDoc {
+		t.Fatal("invalid edit was written")
+	}
+	if err := SetFile(path, "sync.interval_minutes", "15"); err != nil {
+		t.Fatalf("SetFile error = %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Sync.IntervalMinutes != 15 {
+		t.Errorf("interval = %d, want 15", cfg.Sync.IntervalMinutes)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600 kept", info.Mode().Perm())
+	}
+}
+
+func TestValidateFileReportsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	doc := `[repo]
+path = "~/dotstate"
+branch = "main"
+
+[sync]
+interval_minutes = -1
+conflicts."*.json" = "mine"
+typo = true
+
+[chex]
+engine = "rsync"
+`
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	issues, err := ValidateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{
+		"unknown key sync.typo":          8,
+		"sync.interval_minutes":          6,
+		`sync.conflicts["*.json"]`:       7,
+		`chex.engine must be chezmoi or`: 11,
+	}
+	for prefix, line := range want {
+		found := false
+		for _, issue := range issues {
+			if strings.HasPrefix(issue.Message, prefix) {
+				found = true
+				if issue.Line != line {
+					t.Errorf("%q on line %d, want %d", issue.Message, issue.Line, line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no issue starting %q in %v", prefix, issues)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("[repo]\npath = \"~/dotstate\"\n\n[sync\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	issues, _ = ValidateFile(path)
+	if len(issues) != 1 || issues[0].Line != 4 {
+		t.Errorf("syntax error issues = %v, want one on line 4", issues)
+	}
+}
+
+func TestGetReturnsEffectiveValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	if err := os.WriteFile(path, []byte(editDoc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"repo.branch":           DefaultBranch,
+		"sync.interval_minutes": "30",
+		"sync.conflicts.*.json": "ours",
+		"hooks.pre_apply":       `["echo one"]`,
+	} {
+		v, err := Get(cfg, key)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", key, err)
+		}
+		if got, _ := FormatValue(key, v); got != want {
+			t.Errorf("Get(%s) = %s, want %s", key, got, want)
+		}
+	}
+	v, err := Get(cfg, "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := FormatValue("sync", v); !strings.Contains(got, "interval_minutes = 30\n") || !strings.Contains(got, "\n[sync.conflicts]\n\"*.json\" = \"ours\"") {
+		t.Errorf("Get(sync) =\n%s", got)
+	}
+	if _, err := Get(cfg, "sync.conflicts.*.yaml"); err == nil {
+		t.Error("Get of an unset map key succeeded")
+	}
+}
+
+func TestGetShowsSecretReferencesUnresolved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	if err := os.WriteFile(path, []byte("[audit]\nwebhook_url = \"env://DOTSTATE_TEST_GET_HOOK\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOTSTATE_TEST_GET_HOOK", "https://hooks.example.com/secret")
+	cfg, err := LoadUnresolved(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Get(cfg, "audit.webhook_url")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "env://DOTSTATE_TEST_GET_HOOK" {
+		t.Errorf("Get(audit.webhook_url) = %v, want the reference", v)
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// scaffoldComments annotates the dot.toml written by Scaffold, keyed by
+// section ("repo") or section and key ("repo.url").
+var scaffoldComments = map[string]string{
+	"repo":                      "The dotfiles repo this machine syncs with.",
+	"repo.url":                  "Remote git URL; dot bootstrap clones it on new machines.",
+	"repo.path":                 "Where the repo lives on this machine.",
+	"repo.user_name":            "Git identity set repo-locally by bootstrap when git has none.",
+	"sync":                      "Scheduled sync (dot schedule install).",
+	"sync.interval_minutes":     "Minutes between scheduled syncs.",
+	"sync.enable_idle":          "Also sync when the machine goes idle.",
+	"sync.enable_shutdown":      "Also sync before shutdown.",
+	"sync.push_fallback_branch": "Where to push when the branch is protected; {machine} is the machine ID. Empty disables it.",
+	"sync.push_fallback_pr":     "Open a pull request from the fallback branch.",
+	"sync.commit_template":      "Sync commit subject; {{hostname}}, {{machine}}, {{profile}}, {{date}}, and {{changed_files}} expand. Empty uses the default.",
+	"tools":                     "External tools; empty values use PATH.",
+	"tools.chezmoi_version":     "Pin a chezmoi release to download instead of using PATH.",
+	"tools.max_output":          "Bytes of each command's output to keep; 0 uses the default.",
+	"chex":                      "Source state settings.",
+	"chex.source_dir":           "Directory inside the repo holding the source state.",
+	"chex.engine":               `Apply engine: "chezmoi" (default) or "native".`,
+	"chex.native_mode":          `Native engine mode: "copy" (default) or "symlink".`,
+	"wsl":                       "WSL integration (Windows only).",
+	"wsl.flake_ref":             "Flake ref applied inside the WSL distro.",
+	"backup":                    "Backups of destination files taken before apply, under state/backups.",
+	"backup.keep":               "Number of backup sets to keep; 0 keeps them all.",
+	"backup.max_age_days":       "Prune backup sets older than this; 0 keeps them regardless of age.",
+	"encryption":                "age encryption for selected files, stored under state/encrypted.",
+	"encryption.recipients":     "age public keys every encrypted file is encrypted to.",
+	"encryption.identity":       "Local age identity file used to decrypt on apply.",
+	"encryption.files":          "Home-relative paths to store encrypted.",
+	"templates":                 "Template data exposed to chezmoi templates as .dotstate.",
+	"templates.profile":         `This machine's role, e.g. "work" or "personal".`,
+	"audit":                     "Scheduled secret audits.",
+	"audit.interval_hours":      "Hours between audits during scheduled syncs; 0 disables them.",
+	"audit.webhook_url":         "Receives a JSON POST on new findings; may be an op:// or env:// reference.",
+	"discover":                  "dot discover settings.",
+	"discover.large_file_size":  "Bytes above which a file is flagged for git-lfs; 0 uses the default.",
+	"discover.interval_hours":   "Hours between quiet discovery passes during scheduled syncs; 0 disables them.",
+	"discover.webhook_url":      "Receives a JSON POST on new recommended files.",
+	"secrets":                   "Secret finding enforcement.",
+	"secrets.fail_on":           `Lowest confidence that blocks: "low", "medium", or "high". Empty blocks on all.`,
+	"forge":                     "GitHub or GitLab API for dot repo create and fallback pull requests.",
+	"forge.provider":            `"github" or "gitlab"; empty infers it from repo.url.`,
+	"forge.token_secret":        "[templates.secrets] entry holding the API token.",
+	"apply":                     "Apply step order and selection, e.g. [apply.steps.scripts] enabled = false.",
+}
+
+// Scaffold renders cfg as a dot.toml for a new repo, with a comment above
+// each section and the settings that need one.
+func Scaffold(cfg *Config) ([]byte, error) {
+	b, err := toml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.WriteString("# dotstate configuration. See docs/reference/configuration.md.\n\n")
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		key := ""
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[]")
+			key = section
+		} else if name, _, ok := strings.Cut(line, " = "); ok {
+			key = section + "." + strings.TrimSpace(name)
+		}
+		if comment := scaffoldComments[key]; comment != "" {
+			out.WriteString("# " + comment + "\n")
+		}
+		out.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Secret reference schemes accepted by fields that may hold sensitive
+// values, so dot.toml never needs a committed plaintext secret.
+const (
+	SecretRefOP  = "op://"
+	SecretRefEnv = "env://"
+)
+
+// opReadTimeout bounds a single `op read` at load time.
+const opReadTimeout = 30 * time.Second
+
+// IsSecretRef reports whether value is an op:// or env:// reference.
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretRefOP) || strings.HasPrefix(value, SecretRefEnv)
+}
+
+// secretField is a config field that may hold a secret reference.
+type secretField struct {
+	name  string // dot.toml key, for errors
+	value *string
+}
+
+// secretFields returns the fields that may hold a secret reference.
+func (c *Config) secretFields() []secretField {
+	return []secretField{
+		{"audit.webhook_url", &c.Audit.WebhookURL},
+		{"discover.webhook_url", &c.Discover.WebhookURL},
+	}
+}
+
+// resolveSecretRefs replaces op:// and env:// references in secret fields
+// with their values. References are resolved only when present, so configs
+// without them never invoke op.
+func (c *Config) resolveSecretRefs() error {
+	for _, field := range c.secretFields() {
+		ref := *field.value
+		if !IsSecretRef(ref) {
+			continue
+		}
+		value, err := resolveSecretRef(c.Tools.OP, ref)
+		if err != nil {
+			return fmt.Errorf("resolve %s: %w", field.name, err)
+		}
+		*field.value = value
+	}
+	return nil
+}
+
+// ResolveSecretRef resolves an op:// or env:// reference on demand, for
+// secrets that are only needed by some commands.
+func ResolveSecretRef(opBin, ref string) (string, error) {
+	if !IsSecretRef(ref) {
+		return "", fmt.Errorf("%q is not an op:// or env:// reference", ref)
+	}
+	return resolveSecretRef(opBin, ref)
+}
+
+// resolveSecretRef resolves a single reference; tests substitute it.
+var resolveSecretRef = func(opBin, ref string) (string, error) {
+	if name, ok := strings.CutPrefix(ref, SecretRefEnv); ok {
+		value, set := os.LookupEnv(name)
+		if !set || value == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	}
+	return readOPRef(opBin, ref)
+}
+
+// readOPRef reads an op:// reference with the 1Password CLI.
+func readOPRef(opBin, ref string) (string, error) {
+	if opBin == "" {
+		opBin = "op"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opReadTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, opBin, "read", "--no-newline", ref)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("op read %s: %s", ref, msg)
+		}
+		return "", fmt.Errorf("op read %s: %w", ref, err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,273 @@
+// Package daemon runs dot sync on a schedule from a long-lived process,
+// controlled through files in its state directory.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+const (
+	stateFile  = "state.json"
+	pausedFile = "paused"
+	stopFile   = "stop"
+
+	// defaultPoll is how often the daemon checks its control files, the
+	// clock, and idle time between syncs.
+	defaultPoll = 15 * time.Second
+	// IdleThreshold is how long the machine must be idle before an idle
+	// sync runs.
+	IdleThreshold = 5 * time.Minute
+	// shutdownTimeout bounds the final sync run when the daemon is
+	// signalled to exit.
+	shutdownTimeout = 2 * time.Minute
+)
+
+// State is what a running daemon reports about itself.
+type State struct {
+	PID             int       `json:"pid"`
+	StartedAt       time.Time `json:"started_at"`
+	IntervalMinutes int       `json:"interval_minutes"`
+	LastSync        time.Time `json:"last_sync,omitzero"`
+	LastTrigger     string    `json:"last_trigger,omitempty"`
+	LastError       string    `json:"last_error,omitempty"`
+	NextSync        time.Time `json:"next_sync,omitzero"`
+	// StoppedAt is set when the daemon exits cleanly.
+	StoppedAt time.Time `json:"stopped_at,omitzero"`
+}
+
+// Status combines the last recorded state with the control files.
+type Status struct {
+	State   *State `json:"state,omitempty"`
+	Running bool   `json:"running"`
+	Paused  bool   `json:"paused"`
+}
+
+// Control reads and writes the daemon's files in Dir: the state the
+// daemon records, and the pause and stop requests other dot commands make.
+type Control struct {
+	Dir string
+}
+
+// Status reports the daemon's last state and whether it is still running.
+func (c *Control) Status() (*Status, error) {
+	status := &Status{Paused: exists(filepath.Join(c.Dir, pausedFile))}
+	b, err := os.ReadFile(filepath.Join(c.Dir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("parse daemon state: %w", err)
+	}
+	status.State = &state
+	status.Running = state.StoppedAt.IsZero() && processAlive(state.PID)
+	return status, nil
+}
+
+// Pause stops scheduled syncs until Resume. It persists across restarts.
+func (c *Control) Pause() error {
+	return c.touch(pausedFile)
+}
+
+// Resume undoes Pause.
+func (c *Control) Resume() error {
+	return remove(filepath.Join(c.Dir, pausedFile))
+}
+
+// Stop asks a running daemon to exit after any sync in progress.
+func (c *Control) Stop() error {
+	return c.touch(stopFile)
+}
+
+func (c *Control) paused() bool {
+	return exists(filepath.Join(c.Dir, pausedFile))
+}
+
+func (c *Control) stopRequested() bool {
+	return exists(filepath.Join(c.Dir, stopFile))
+}
+
+func (c *Control) touch(name string) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.Dir, name), nil, 0o644)
+}
+
+func (c *Control) writeState(state State) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(c.Dir, stateFile+".tmp")
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(c.Dir, stateFile))
+}
+
+// IdleFunc reports how long the machine has had no user input.
+type IdleFunc func(ctx context.Context) (time.Duration, error)
+
+// Daemon runs Sync every Interval until its context ends or a stop is
+// requested.
+type Daemon struct {
+	Control  *Control
+	Interval time.Duration
+	// Sync performs one sync; trigger is "interval", "idle", or "shutdown".
+	Sync func(ctx context.Context, trigger string) error
+	// Idle, when set, also syncs once the machine has been idle for
+	// IdleThreshold since the last sync.
+	Idle IdleFunc
+	// SyncOnShutdown runs a final sync when the context is cancelled, as on
+	// SIGTERM at logout or shutdown.
+	SyncOnShutdown bool
+	Logger         *slog.Logger
+
+	poll time.Duration
+	now  func() time.Time
+}
+
+// Run blocks until ctx is done or dot daemon stop is requested. The first
+// sync runs right away unless the daemon is paused.
+func (d *Daemon) Run(ctx context.Context) error {
+	if d.Interval <= 0 {
+		return fmt.Errorf("daemon interval must be positive, got %s", d.Interval)
+	}
+	if status, err := d.Control.Status(); err == nil && status.Running && status.State.PID != os.Getpid() {
+		return fmt.Errorf("daemon already running as pid %d", status.State.PID)
+	}
+	if err := remove(filepath.Join(d.Control.Dir, stopFile)); err != nil {
+		return err
+	}
+	poll, now := d.poll, d.now
+	if poll <= 0 {
+		poll = defaultPoll
+	}
+	if now == nil {
+		now = time.Now
+	}
+
+	state := State{
+		PID:             os.Getpid(),
+		StartedAt:       now().UTC(),
+		IntervalMinutes: int(d.Interval / time.Minute),
+		NextSync:        now().UTC(),
+	}
+	if err := d.Control.writeState(state); err != nil {
+		return fmt.Errorf("write daemon state: %w", err)
+	}
+	d.log().Info("daemon started", "pid", state.PID, "interval", d.Interval.String())
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	wasPaused := false
+	for {
+		paused := d.Control.paused()
+		if paused != wasPaused {
+			d.log().Info("daemon paused state changed", "paused", paused)
+			wasPaused = paused
+		}
+		if d.Control.stopRequested() {
+			d.log().Info("daemon stop requested")
+			_ = remove(filepath.Join(d.Control.Dir, stopFile))
+			return d.exit(state, now)
+		}
+		if !paused {
+			if trigger := d.due(ctx, state, now()); trigger != "" {
+				state = d.runSync(ctx, state, trigger, now)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if d.SyncOnShutdown && !d.Control.paused() {
+				shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+				state = d.runSync(shutdownCtx, state, "shutdown", now)
+				cancel()
+			}
+			return d.exit(state, now)
+		case <-ticker.C:
+		}
+	}
+}
+
+// due returns the trigger for a sync that should run at t, or "".
+func (d *Daemon) due(ctx context.Context, state State, t time.Time) string {
+	if !t.Before(state.NextSync) {
+		return "interval"
+	}
+	if d.Idle == nil {
+		return ""
+	}
+	idle, err := d.Idle(ctx)
+	if err != nil {
+		d.log().Debug("daemon idle check failed", "error", redact.Text(err.Error()))
+		return ""
+	}
+	// Sync once per idle stretch: only when the last sync predates it.
+	if idle >= IdleThreshold && state.LastSync.Before(t.Add(-idle)) {
+		return "idle"
+	}
+	return ""
+}
+
+func (d *Daemon) runSync(ctx context.Context, state State, trigger string, now func() time.Time) State {
+	d.log().Info("daemon sync starting", "trigger", trigger)
+	err := d.Sync(ctx, trigger)
+	state.LastSync = now().UTC()
+	state.LastTrigger = trigger
+	state.LastError = ""
+	state.NextSync = state.LastSync.Add(d.Interval)
+	if err != nil {
+		state.LastError = redact.Text(err.Error())
+		d.log().Error("daemon sync failed", "trigger", trigger, "error", state.LastError)
+	} else {
+		d.log().Info("daemon sync complete", "trigger", trigger)
+	}
+	if err := d.Control.writeState(state); err != nil {
+		d.log().Warn("could not write daemon state", "error", redact.Text(err.Error()))
+	}
+	return state
+}
+
+func (d *Daemon) exit(state State, now func() time.Time) error {
+	state.StoppedAt = now().UTC()
+	state.NextSync = time.Time{}
+	d.log().Info("daemon stopped")
+	return d.Control.writeState(state)
+}
+
+func (d *Daemon) log() *slog.Logger {
+	if d.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return d.Logger
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
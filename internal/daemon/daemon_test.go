@@ -0,0 +1,142 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+type syncRecorder struct {
+	mu       sync.Mutex
+	triggers []string
+	err      error
+}
+
+func (r *syncRecorder) sync(ctx context.Context, trigger string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.triggers = append(r.triggers, trigger)
+	return r.err
+}
+
+func (r *syncRecorder) calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.triggers...)
+}
+
+func runDaemon(t *testing.T, ctx context.Context, d *Daemon) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+	return done
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDaemonSyncsImmediatelyAndStopsOnRequest(t *testing.T) {
+	control := &Control{Dir: testutil.TempDir(t)}
+	recorder := &syncRecorder{err: errors.New("push rejected")}
+	d := &Daemon{Control: control, Interval: time.Hour, Sync: recorder.sync, poll: 5 * time.Millisecond}
+	done := runDaemon(t, context.Background(), d)
+
+	waitFor(t, "first sync", func() bool { return len(recorder.calls()) == 1 })
+	waitFor(t, "running status", func() bool {
+		status, err := control.Status()
+		return err == nil && status.Running && status.State.LastError == "push rejected"
+	})
+	if err := control.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	status, err := control.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.Running || status.State.StoppedAt.IsZero() || status.State.LastTrigger != "interval" || status.State.IntervalMinutes != 60 {
+		t.Fatalf("status after stop = %#v", status.State)
+	}
+	if got := recorder.calls(); len(got) != 1 {
+		t.Fatalf("syncs = %v, want one before the interval elapsed", got)
+	}
+	if _, err := os.Stat(filepath.Join(control.Dir, stopFile)); !os.IsNotExist(err) {
+		t.Fatalf("stop request left behind: %v", err)
+	}
+}
+
+func TestDaemonPausedSkipsSyncsUntilResumed(t *testing.T) {
+	control := &Control{Dir: testutil.TempDir(t)}
+	if err := control.Pause(); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	recorder := &syncRecorder{}
+	d := &Daemon{Control: control, Interval: time.Hour, Sync: recorder.sync, poll: 5 * time.Millisecond}
+	done := runDaemon(t, context.Background(), d)
+
+	time.Sleep(50 * time.Millisecond)
+	if got := recorder.calls(); len(got) != 0 {
+		t.Fatalf("paused daemon synced: %v", got)
+	}
+	if err := control.Resume(); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	waitFor(t, "sync after resume", func() bool { return len(recorder.calls()) == 1 })
+	if err := control.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestDaemonSyncsOnShutdownWhenEnabled(t *testing.T) {
+	control := &Control{Dir: testutil.TempDir(t)}
+	recorder := &syncRecorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Daemon{Control: control, Interval: time.Hour, Sync: recorder.sync, SyncOnShutdown: true, poll: 5 * time.Millisecond}
+	done := runDaemon(t, ctx, d)
+
+	waitFor(t, "first sync", func() bool { return len(recorder.calls()) == 1 })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := recorder.calls(); len(got) != 2 || got[1] != "shutdown" {
+		t.Fatalf("syncs = %v, want a final shutdown sync", got)
+	}
+}
+
+func TestDaemonIdleSyncRunsOncePerIdleStretch(t *testing.T) {
+	now := time.Date(2026, 5, 13, 12, 0, 0, 0, time.UTC)
+	d := &Daemon{Idle: func(context.Context) (time.Duration, error) { return 10 * time.Minute, nil }}
+	state := State{NextSync: now.Add(time.Hour), LastSync: now.Add(-30 * time.Minute)}
+	if got := d.due(context.Background(), state, now); got != "idle" {
+		t.Fatalf("due() = %q, want idle", got)
+	}
+	state.LastSync = now.Add(-5 * time.Minute)
+	if got := d.due(context.Background(), state, now); got != "" {
+		t.Fatalf("due() = %q after syncing during this idle stretch, want none", got)
+	}
+	state.NextSync = now
+	if got := d.due(context.Background(), state, now); got != "interval" {
+		t.Fatalf("due() = %q, want interval", got)
+	}
+}
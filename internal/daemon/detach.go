@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+// Detach starts bin with args as a background process whose output is
+// appended to logPath, and returns its pid.
+func Detach(bin string, args []string, logPath string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = detachAttr()
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("start daemon: %w", err)
+	}
+	pid := cmd.Process.Pid
+	return pid, cmd.Process.Release()
+}
+
+var hidIdleTime = regexp.MustCompile(`"HIDIdleTime"\s*=\s*(\d+)`)
+
+// DarwinIdle reads the time since the last keyboard or mouse input from
+// IOKit on macOS.
+func DarwinIdle(r runner.Runner) IdleFunc {
+	return func(ctx context.Context) (time.Duration, error) {
+		res, err := r.Run(ctx, "", "ioreg", "-c", "IOHIDSystem", "-d", "4")
+		if err != nil {
+			return 0, err
+		}
+		match := hidIdleTime.FindStringSubmatch(res.Stdout)
+		if match == nil {
+			return 0, fmt.Errorf("HIDIdleTime not found in ioreg output")
+		}
+		ns, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(ns), nil
+	}
+}
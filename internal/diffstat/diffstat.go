@@ -0,0 +1,275 @@
+// Package diffstat summarizes unified diffs and git numstat output into
+// per-file added/removed line counts and mode changes.
+package diffstat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FileStat holds line counts for a single changed path.
+type FileStat struct {
+	Path    string `json:"path"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Binary  bool   `json:"binary"`
+	// OldMode and NewMode are git file modes such as "100755", set when
+	// the diff changes only or also the file mode.
+	OldMode string `json:"old_mode,omitempty"`
+	NewMode string `json:"new_mode,omitempty"`
+}
+
+// ModeChanged reports whether the diff changes the file's mode.
+func (s FileStat) ModeChanged() bool {
+	return s.OldMode != "" && s.NewMode != "" && s.OldMode != s.NewMode
+}
+
+// Totals aggregates a set of file stats.
+type Totals struct {
+	Files   int
+	Added   int
+	Removed int
+}
+
+// Parse reads unified diff output (as emitted by git diff or chezmoi diff)
+// and returns one FileStat per "diff --git" section, in input order.
+func Parse(diff string) []FileStat {
+	var stats []FileStat
+	var current *FileStat
+	inHunk := false
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			stats = append(stats, FileStat{Path: pathFromDiffHeader(line)})
+			current = &stats[len(stats)-1]
+			inHunk = false
+		case current == nil:
+			continue
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case !inHunk && strings.HasPrefix(line, "old mode "):
+			current.OldMode = strings.TrimSpace(strings.TrimPrefix(line, "old mode "))
+		case !inHunk && strings.HasPrefix(line, "new mode "):
+			current.NewMode = strings.TrimSpace(strings.TrimPrefix(line, "new mode "))
+		case !inHunk && strings.HasPrefix(line, "Binary files "):
+			current.Binary = true
+		case !inHunk && strings.HasPrefix(line, "+++ "):
+			if p := stripDiffPrefix(strings.TrimPrefix(line, "+++ "), "b/"); p != "/dev/null" {
+				current.Path = p
+			}
+		case !inHunk:
+			continue
+		case strings.HasPrefix(line, "+"):
+			current.Added++
+		case strings.HasPrefix(line, "-"):
+			current.Removed++
+		}
+	}
+	return stats
+}
+
+// Split cuts unified diff output into one section per "diff --git" header,
+// keyed by the path Parse reports for that section.
+func Split(diff string) map[string]string {
+	sections := make(map[string]string)
+	var b strings.Builder
+	flush := func() {
+		if stats := Parse(b.String()); len(stats) == 1 {
+			sections[stats[0].Path] = b.String()
+		}
+		b.Reset()
+	}
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			flush()
+		}
+		b.WriteString(line)
+	}
+	flush()
+	return sections
+}
+
+// ParseNumstat reads `git diff --numstat` / `git show --numstat` output.
+// Binary files, reported as "-\t-\tpath", are flagged with Binary=true.
+func ParseNumstat(out string) []FileStat {
+	var stats []FileStat
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(strings.TrimRight(line, "\r"), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		stat := FileStat{Path: fields[2]}
+		if fields[0] == "-" && fields[1] == "-" {
+			stat.Binary = true
+		} else {
+			added, errA := strconv.Atoi(fields[0])
+			removed, errR := strconv.Atoi(fields[1])
+			if errA != nil || errR != nil {
+				continue
+			}
+			stat.Added, stat.Removed = added, removed
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// Sum returns aggregate counts across stats.
+func Sum(stats []FileStat) Totals {
+	totals := Totals{Files: len(stats)}
+	for _, stat := range stats {
+		totals.Added += stat.Added
+		totals.Removed += stat.Removed
+	}
+	return totals
+}
+
+// String renders totals in the familiar git shortstat style.
+func (t Totals) String() string {
+	return fmt.Sprintf("%d file(s) changed, %d insertion(s)(+), %d deletion(s)(-)", t.Files, t.Added, t.Removed)
+}
+
+// Records converts stats into JSON-like values suitable for module record
+// Current/Desired maps.
+func Records(stats []FileStat) []any {
+	out := make([]any, 0, len(stats))
+	for _, stat := range stats {
+		record := map[string]any{
+			"path":    stat.Path,
+			"added":   stat.Added,
+			"removed": stat.Removed,
+			"binary":  stat.Binary,
+		}
+		if stat.ModeChanged() {
+			record["old_mode"] = stat.OldMode
+			record["new_mode"] = stat.NewMode
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+// FromRecords is the inverse of Records. Unknown shapes are skipped so
+// sanitized or hand-written records never cause a render failure.
+func FromRecords(v any) []FileStat {
+	items, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	stats := make([]FileStat, 0, len(items))
+	for _, item := range items {
+		record, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		stat := FileStat{}
+		stat.Path, _ = record["path"].(string)
+		stat.Added = toInt(record["added"])
+		stat.Removed = toInt(record["removed"])
+		stat.Binary, _ = record["binary"].(bool)
+		stat.OldMode, _ = record["old_mode"].(string)
+		stat.NewMode, _ = record["new_mode"].(string)
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// Lines renders a compact stat table, one line per file plus a totals line.
+// Bars are scaled so the widest change fits in width columns.
+func Lines(stats []FileStat, width int) []string {
+	if len(stats) == 0 {
+		return nil
+	}
+	if width <= 0 {
+		width = 40
+	}
+	pathWidth, maxChanges := 0, 0
+	for _, stat := range stats {
+		if len(stat.Path) > pathWidth {
+			pathWidth = len(stat.Path)
+		}
+		if n := stat.Added + stat.Removed; n > maxChanges {
+			maxChanges = n
+		}
+	}
+	countWidth := len(strconv.Itoa(maxChanges))
+
+	lines := make([]string, 0, len(stats)+1)
+	for _, stat := range stats {
+		mode := ""
+		if stat.ModeChanged() {
+			mode = fmt.Sprintf(" (mode %s => %s)", stat.OldMode, stat.NewMode)
+		}
+		if stat.Binary {
+			lines = append(lines, fmt.Sprintf("%-*s | %*s%s", pathWidth, stat.Path, countWidth, "Bin", mode))
+			continue
+		}
+		plus, minus := stat.Added, stat.Removed
+		if maxChanges > width {
+			plus = scale(plus, maxChanges, width)
+			minus = scale(minus, maxChanges, width)
+		}
+		line := fmt.Sprintf("%-*s | %*d %s%s", pathWidth, stat.Path, countWidth, stat.Added+stat.Removed,
+			strings.Repeat("+", plus), strings.Repeat("-", minus))
+		if mode != "" {
+			line = strings.TrimRight(line, " ") + mode
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, Sum(stats).String())
+	return lines
+}
+
+func scale(n, maxChanges, width int) int {
+	if n == 0 {
+		return 0
+	}
+	scaled := n * width / maxChanges
+	if scaled == 0 {
+		return 1
+	}
+	return scaled
+}
+
+func toInt(v any) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	default:
+		return 0
+	}
+}
+
+// HeaderPath returns the path of a "diff --git" header line, and false for
+// any other line.
+func HeaderPath(line string) (string, bool) {
+	if !strings.HasPrefix(line, "diff --git ") {
+		return "", false
+	}
+	return pathFromDiffHeader(line), true
+}
+
+func pathFromDiffHeader(line string) string {
+	rest := strings.TrimPrefix(line, "diff --git ")
+	if idx := strings.LastIndex(rest, " b/"); idx >= 0 {
+		return rest[idx+3:]
+	}
+	parts := strings.Fields(rest)
+	if len(parts) == 0 {
+		return ""
+	}
+	return stripDiffPrefix(parts[len(parts)-1], "b/")
+}
+
+func stripDiffPrefix(p, prefix string) string {
+	p = strings.TrimSpace(p)
+	if i := strings.IndexByte(p, '\t'); i >= 0 {
+		p = p[:i]
+	}
+	return strings.TrimPrefix(p, prefix)
+}
@@ -0,0 +1,127 @@
+package diffstat
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleDiff = `diff --git a/.zshrc b/.zshrc
+index 1111111..2222222 100644
+--- a/.zshrc
++++ b/.zshrc
+@@ -1,3 +1,4 @@
+ export EDITOR=vim
+-alias ll='ls -l'
++alias ll='ls -la'
++alias gs='git status'
+ # end
+diff --git a/.config/git/config b/.config/git/config
+new file mode 100644
+--- /dev/null
++++ b/.config/git/config
+@@ -0,0 +1,2 @@
++[user]
++	name = test
+diff --git a/bin/tool b/bin/tool
+Binary files a/bin/tool and b/bin/tool differ
+`
+
+func TestParseCountsPerFile(t *testing.T) {
+	stats := Parse(sampleDiff)
+	want := []FileStat{
+		{Path: ".zshrc", Added: 2, Removed: 1},
+		{Path: ".config/git/config", Added: 2, Removed: 0},
+		{Path: "bin/tool", Binary: true},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("Parse() = %#v, want %d stats", stats, len(want))
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("stats[%d] = %#v, want %#v", i, stats[i], want[i])
+		}
+	}
+}
+
+func TestParseIgnoresDiffWithoutGitHeaders(t *testing.T) {
+	if stats := Parse("--- old\n+++ new\n"); len(stats) != 0 {
+		t.Fatalf("Parse() = %#v, want none", stats)
+	}
+}
+
+func TestSplitSectionsByPath(t *testing.T) {
+	sections := Split("preamble\n" + sampleDiff)
+	if len(sections) != 3 {
+		t.Fatalf("Split() = %d sections, want 3: %#v", len(sections), sections)
+	}
+	zshrc := sections[".zshrc"]
+	if !strings.HasPrefix(zshrc, "diff --git a/.zshrc") || strings.Contains(zshrc, ".config/git/config") {
+		t.Fatalf(".zshrc section = %q", zshrc)
+	}
+	if !strings.Contains(sections[".config/git/config"], "+\tname = test\n") {
+		t.Fatalf("git config section = %q", sections[".config/git/config"])
+	}
+}
+
+func TestParseNumstat(t *testing.T) {
+	stats := ParseNumstat("3\t1\thome/dot_zshrc\n-\t-\thome/bin/tool\nbogus line\n")
+	if len(stats) != 2 {
+		t.Fatalf("ParseNumstat() = %#v, want 2 stats", stats)
+	}
+	if stats[0] != (FileStat{Path: "home/dot_zshrc", Added: 3, Removed: 1}) {
+		t.Errorf("stats[0] = %#v", stats[0])
+	}
+	if !stats[1].Binary {
+		t.Errorf("stats[1] = %#v, want binary", stats[1])
+	}
+}
+
+func TestRecordsRoundTrip(t *testing.T) {
+	stats := Parse(sampleDiff)
+	got := FromRecords(Records(stats))
+	if len(got) != len(stats) {
+		t.Fatalf("FromRecords() = %#v", got)
+	}
+	for i := range stats {
+		if got[i] != stats[i] {
+			t.Errorf("got[%d] = %#v, want %#v", i, got[i], stats[i])
+		}
+	}
+}
+
+func TestLinesRendersTableAndTotals(t *testing.T) {
+	lines := Lines(Parse(sampleDiff), 40)
+	if len(lines) != 4 {
+		t.Fatalf("Lines() = %q, want 4 lines", lines)
+	}
+	if !strings.HasPrefix(lines[0], ".zshrc ") || !strings.HasSuffix(lines[0], "3 ++-") {
+		t.Errorf("lines[0] = %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[2], "Bin") {
+		t.Errorf("lines[2] = %q, want binary marker", lines[2])
+	}
+	if lines[3] != "3 file(s) changed, 4 insertion(s)(+), 1 deletion(s)(-)" {
+		t.Errorf("totals = %q", lines[3])
+	}
+}
+
+func TestLinesScalesWideChanges(t *testing.T) {
+	lines := Lines([]FileStat{{Path: "big", Added: 400, Removed: 100}}, 10)
+	if !strings.HasSuffix(lines[0], "500 ++++++++--") {
+		t.Fatalf("lines[0] = %q", lines[0])
+	}
+}
+
+func TestParseRecordsModeOnlyChanges(t *testing.T) {
+	stats := Parse("diff --git a/bin/run b/bin/run\nold mode 100644\nnew mode 100755\n")
+	if len(stats) != 1 || !stats[0].ModeChanged() || stats[0].OldMode != "100644" || stats[0].NewMode != "100755" {
+		t.Fatalf("Parse() = %#v", stats)
+	}
+	if got := FromRecords(Records(stats)); len(got) != 1 || got[0] != stats[0] {
+		t.Fatalf("FromRecords(Records()) = %#v", got)
+	}
+	lines := Lines(stats, 40)
+	if lines[0] != "bin/run | 0 (mode 100644 => 100755)" {
+		t.Fatalf("lines[0] = %q", lines[0])
+	}
+}
@@ -0,0 +1,67 @@
+package discover
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// SecretAllowlistFile is the registry under state/discover that records
+// secret findings accepted during a --secrets prompt review.
+const SecretAllowlistFile = "secrets-allow.txt"
+
+// SecretAllowlist holds accepted findings as "<pattern> <home-relative
+// path>" entries. Pattern IDs never contain spaces, so the path may.
+type SecretAllowlist map[string]bool
+
+// allowlistEntry formats the allowlist entry for a finding in relPath.
+func allowlistEntry(patternID, relPath string) string {
+	return patternID + " " + platform.NormalizeUnicode(relPath)
+}
+
+// LoadSecretAllowlist reads an allowlist registry; a missing file yields an
+// empty allowlist.
+func LoadSecretAllowlist(path string) SecretAllowlist {
+	allow := SecretAllowlist{}
+	for _, line := range readRegistryLines(path) {
+		allow[platform.NormalizeUnicode(line)] = true
+	}
+	return allow
+}
+
+// Allows reports whether the finding in relPath was accepted.
+func (a SecretAllowlist) Allows(f SecretFinding, relPath string) bool {
+	return a[allowlistEntry(f.PatternID, relPath)]
+}
+
+// AppendSecretAllowlist adds entries to the allowlist registry at path,
+// creating it with an explanatory header.
+func AppendSecretAllowlist(path string, entries []string) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create secret allowlist directory: %w", err)
+	}
+	_, statErr := os.Stat(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open secret allowlist: %w", err)
+	}
+	var b strings.Builder
+	if os.IsNotExist(statErr) {
+		b.WriteString("# Secret findings accepted by dot discover --secrets prompt.\n")
+		b.WriteString("# One \"<pattern> <path>\" per line; delete a line to be asked again.\n")
+	}
+	for _, entry := range entries {
+		b.WriteString(entry + "\n")
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return fmt.Errorf("write secret allowlist: %w", err)
+	}
+	return f.Close()
+}
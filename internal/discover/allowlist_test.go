@@ -0,0 +1,76 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReviewSecretsRecordsAllowlistDecisions(t *testing.T) {
+	db := &Candidate{RelPath: "~/.config/app/db.conf", SecretFindings: []SecretFinding{
+		{PatternID: "password-assignment", Confidence: ConfidenceLow, Line: 3},
+		{PatternID: "postgres-uri", Confidence: ConfidenceMedium, Line: 7},
+	}}
+	netrc := &Candidate{RelPath: "~/.netrc", SecretFindings: []SecretFinding{{PatternID: "auth-assignment", Confidence: ConfidenceLow, Line: 1}}}
+	clean := &Candidate{RelPath: "~/.zshrc"}
+	out := &bytes.Buffer{}
+	p := NewPrompterWithIO(strings.NewReader("l\na\n\n"), out, false)
+
+	kept, allow := p.ReviewSecrets([]*Candidate{db, netrc, clean})
+
+	if len(kept) != 2 || kept[0] != db || kept[1] != clean || !db.SecretsAllowed {
+		t.Fatalf("kept = %v (db allowed %v), want db and the clean file", kept, db.SecretsAllowed)
+	}
+	if len(allow) != 1 || allow[0] != "password-assignment ~/.config/app/db.conf" {
+		t.Fatalf("allow = %q", allow)
+	}
+
+	path := filepath.Join(t.TempDir(), "discover", SecretAllowlistFile)
+	if err := AppendSecretAllowlist(path, allow); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendSecretAllowlist(path, []string{"auth-assignment ~/.netrc"}); err != nil {
+		t.Fatal(err)
+	}
+	list := LoadSecretAllowlist(path)
+	if len(list) != 2 || !list.Allows(SecretFinding{PatternID: "password-assignment"}, "~/.config/app/db.conf") {
+		t.Fatalf("allowlist = %v", list)
+	}
+	if b, _ := os.ReadFile(path); strings.Count(string(b), "# Secret findings") != 1 {
+		t.Fatalf("allowlist header written more than once:\n%s", b)
+	}
+}
+
+func TestReviewSecretsSkipsInAutoYesMode(t *testing.T) {
+	flagged := &Candidate{RelPath: "~/.netrc", SecretFindings: []SecretFinding{{PatternID: "auth-assignment"}}}
+	clean := &Candidate{RelPath: "~/.zshrc"}
+	p := NewPrompterWithIO(strings.NewReader(""), &bytes.Buffer{}, true)
+
+	kept, allow := p.ReviewSecrets([]*Candidate{flagged, clean})
+	if len(kept) != 1 || kept[0] != clean || len(allow) != 0 {
+		t.Fatalf("kept = %v, allow = %q", kept, allow)
+	}
+}
+
+func TestUpdateCandidatesDropsAllowlistedFindings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.conf")
+	if err := os.WriteFile(path, []byte("password = hunter2hunter2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Candidate{Path: path, RelPath: "~/db.conf", Category: CategoryRecommended}
+	d := NewSecretDetector(nil)
+	d.SetAllowlist(SecretAllowlist{"password-assignment ~/db.conf": true})
+
+	if err := d.UpdateCandidates(context.Background(), CandidateList{c}); err != nil {
+		t.Fatal(err)
+	}
+	if c.Category != CategoryRecommended || len(c.SecretWarnings) != 0 || !c.SecretsAllowed {
+		t.Fatalf("candidate = %+v, want allowlisted finding ignored", c)
+	}
+	if got := (Options{SecretsMode: SecretsModeError}).secretsModeFor(c); got != SecretsModeWarning {
+		t.Fatalf("secrets mode = %q, want warning for an allowlisted file", got)
+	}
+}
@@ -0,0 +1,42 @@
+package discover
+
+import (
+	"path"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// attributesFor returns the chezmoi attributes [discover.attributes] assigns
+// to a home-relative path. The most specific matching pattern wins; patterns
+// without a slash also match the file name alone.
+func attributesFor(cfg *config.Config, rel string) chez.Attributes {
+	if cfg == nil || len(cfg.Discover.Attributes) == 0 {
+		return chez.Attributes{}
+	}
+	rel = strings.TrimPrefix(strings.ReplaceAll(platform.NormalizeUnicode(rel), `\`, "/"), "~/")
+	for _, pattern := range cfg.AttributePatterns() {
+		glob := strings.TrimPrefix(strings.TrimPrefix(platform.NormalizeUnicode(pattern), "~/"), "./")
+		matched, _ := path.Match(glob, rel)
+		if !matched && !strings.Contains(glob, "/") {
+			matched, _ = path.Match(glob, path.Base(rel))
+		}
+		if matched {
+			attrs, _ := chez.ParseAttributes(cfg.Discover.Attributes[pattern])
+			return attrs
+		}
+	}
+	return chez.Attributes{}
+}
+
+// applyAttributeRules sets each file candidate's attributes from config.
+func applyAttributeRules(cfg *config.Config, candidates CandidateList) {
+	for _, c := range candidates {
+		if c.IsSubRepo {
+			continue
+		}
+		c.Attributes = attributesFor(cfg, c.RelPath)
+	}
+}
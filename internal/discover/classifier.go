@@ -19,6 +19,9 @@ type Classifier struct {
 
 	// Risky basenames
 	riskyNames []string
+
+	// profile, when set, times the risky check and scoring.
+	profile *Profile
 }
 
 // NewClassifier creates a new classifier with default rules.
@@ -157,11 +160,15 @@ func (c *Classifier) Classify(path string, info os.FileInfo, home string) *Candi
 	ext := fileExt(path)
 
 	// Check if it's risky first
-	if c.isRisky(path, name) {
+	start := c.profile.start()
+	risky := c.isRisky(path, name)
+	c.profile.stage(ProfileStageRisky, start)
+	if risky {
 		candidate.Category = CategoryRisky
 		candidate.Reasons = append(candidate.Reasons, "potentially contains secrets")
 		return candidate
 	}
+	defer c.profile.stage(ProfileStageScore, c.profile.start())
 
 	// Check for known config names (highest priority)
 	if boost, ok := c.knownConfigs[name]; ok {
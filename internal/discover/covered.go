@@ -0,0 +1,95 @@
+package discover
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rawSourcePrefixes mark source files whose bytes are not the deployed
+// content, so hashing them says nothing about a destination file.
+var rawSourcePrefixes = []string{"encrypted_", "modify_", "run_", "symlink_", "remove_"}
+
+// SourceHashes hashes the plain files in a chezmoi source directory and
+// returns a map from SHA-256 to the first source-relative path with that
+// content. Templates, scripts, encrypted and empty files are skipped, as are
+// dot-prefixed entries such as .chezmoiignore and .git.
+func SourceHashes(sourceDir string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := filepath.WalkDir(sourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == sourceDir {
+			return nil
+		}
+		name := d.Name()
+		if strings.HasPrefix(name, ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || strings.HasSuffix(name, ".tmpl") {
+			return nil
+		}
+		for _, prefix := range rawSourcePrefixes {
+			if strings.Contains(name, prefix) {
+				return nil
+			}
+		}
+		sum, err := hashFile(path)
+		if err != nil || sum == "" {
+			return nil
+		}
+		if _, ok := hashes[sum]; !ok {
+			rel, _ := filepath.Rel(sourceDir, path)
+			hashes[sum] = filepath.ToSlash(rel)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return hashes, nil
+	}
+	return hashes, err
+}
+
+// markCovered moves file candidates whose contents are byte-identical to
+// already-managed source files from result.Candidates to result.Covered.
+func markCovered(result *Result, hashes map[string]string) {
+	if len(hashes) == 0 {
+		return
+	}
+	kept := result.Candidates[:0]
+	for _, c := range result.Candidates {
+		if !c.IsSubRepo && !c.IsDir {
+			if sum, err := hashFile(c.Path); err == nil && hashes[sum] != "" {
+				c.CoveredBy = hashes[sum]
+				result.Covered = append(result.Covered, c)
+				continue
+			}
+		}
+		kept = append(kept, c)
+	}
+	result.Candidates = kept
+}
+
+// hashFile returns the hex SHA-256 of a file, or "" when it is empty.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil || n == 0 {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,88 @@
+package discover
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSourceHashesSkipsNonLiteralSources(t *testing.T) {
+	source := t.TempDir()
+	writeTestFiles(t, source, map[string]string{
+		"dot_config/app/config.toml":     "theme = \"dark\"\n",
+		"dot_gitconfig.tmpl":             "[user]\n",
+		"private_encrypted_dot_netrc":    "ciphertext",
+		"run_once_install.sh":            "#!/bin/sh\n",
+		".chezmoiignore":                 "README.md\n",
+		".git/config":                    "[core]\n",
+		"dot_config/app/empty_dot_empty": "",
+	})
+
+	hashes, err := SourceHashes(source)
+	if err != nil {
+		t.Fatalf("SourceHashes: %v", err)
+	}
+	if len(hashes) != 1 {
+		t.Fatalf("hashes = %#v, want only the plain config", hashes)
+	}
+	for _, rel := range hashes {
+		if rel != "dot_config/app/config.toml" {
+			t.Fatalf("hashed %q, want dot_config/app/config.toml", rel)
+		}
+	}
+
+	missing, err := SourceHashes(filepath.Join(source, "missing"))
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("missing source = %#v, %v; want empty, nil", missing, err)
+	}
+}
+
+func TestMarkCoveredSetsAsideIdenticalFiles(t *testing.T) {
+	source := t.TempDir()
+	home := t.TempDir()
+	writeTestFiles(t, source, map[string]string{
+		"dot_config/app/config.toml": "theme = \"dark\"\n",
+	})
+	writeTestFiles(t, home, map[string]string{
+		".config/other/config.toml": "theme = \"dark\"\n",
+		".config/app/settings.toml": "theme = \"light\"\n",
+	})
+
+	hashes, err := SourceHashes(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &Result{Candidates: CandidateList{
+		{Path: filepath.Join(home, ".config/other/config.toml"), RelPath: "~/.config/other/config.toml"},
+		{Path: filepath.Join(home, ".config/app/settings.toml"), RelPath: "~/.config/app/settings.toml"},
+	}}
+	markCovered(result, hashes)
+
+	if len(result.Candidates) != 1 || result.Candidates[0].RelPath != "~/.config/app/settings.toml" {
+		t.Fatalf("candidates = %#v, want only settings.toml", result.Candidates)
+	}
+	if len(result.Covered) != 1 || result.Covered[0].CoveredBy != "dot_config/app/config.toml" {
+		t.Fatalf("covered = %#v, want config.toml covered by dot_config/app/config.toml", result.Covered)
+	}
+
+	var out bytes.Buffer
+	NewPrompterWithIO(strings.NewReader(""), &out, false).PrintReport(result)
+	if !strings.Contains(out.String(), "Already covered (1):\n  ~/.config/other/config.toml = dot_config/app/config.toml") {
+		t.Fatalf("report missing covered section:\n%s", out.String())
+	}
+}
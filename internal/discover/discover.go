@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dnery/dotstate/dot/internal/chez"
 	"github.com/dnery/dotstate/dot/internal/modules"
 	"github.com/dnery/dotstate/dot/internal/platform"
 )
@@ -80,6 +81,37 @@ type Candidate struct {
 	// SecretWarnings contains any secret detection warnings.
 	SecretWarnings []string
 
+	// SecretFindings are the built-in findings behind SecretWarnings,
+	// without allowlisted ones.
+	SecretFindings []SecretFinding
+
+	// SecretsAllowed records that findings in this file were accepted,
+	// through the allowlist or a --secrets prompt review.
+	SecretsAllowed bool
+
+	// SecretConfidence is the highest confidence among the built-in secret
+	// findings, or empty when there are none.
+	SecretConfidence string
+
+	// Templatable marks a new file whose findings can all be rewritten into
+	// template placeholders, so the secret review offers to.
+	Templatable bool
+
+	// Attributes are the chezmoi attributes set when the file is added,
+	// from [discover.attributes] rules or the review prompt.
+	Attributes chez.Attributes
+
+	// LFS routes the file through git-lfs when it is added.
+	LFS bool
+
+	// Drift is the diff from this already-managed file to its managed
+	// version, set on Result.Drifted candidates.
+	Drift string
+
+	// CoveredBy is the source-relative path of managed content that is
+	// byte-identical to this file, when there is one.
+	CoveredBy string
+
 	// ModTime is the last modification time.
 	ModTime time.Time
 }
@@ -137,11 +169,21 @@ type ScanOptions struct {
 
 	// IgnorePatterns are user-maintained glob/substring patterns to exclude.
 	IgnorePatterns []string
+
+	// DotIgnore holds gitignore-syntax rules from .dotignore files, matched
+	// against home-relative paths.
+	DotIgnore *IgnoreMatcher
+
+	// Profile, when set, records where the scan spends its time.
+	Profile *Profile
 }
 
 // DefaultMaxFileSize is 2 MiB.
 const DefaultMaxFileSize = 2 * 1024 * 1024
 
+// DefaultLargeFileSize is 512 KiB.
+const DefaultLargeFileSize = 512 * 1024
+
 // DefaultScanOptions returns default scan options for the given home directory.
 func DefaultScanOptions(home string) ScanOptions {
 	return ScanOptions{
@@ -178,6 +220,20 @@ type Result struct {
 
 	// Ignored summarizes why candidates were filtered before classification.
 	Ignored map[string]int
+
+	// Managed lists the already-managed files the scan passed over.
+	Managed []string
+
+	// Drifted lists managed files whose contents differ from the source
+	// state; each can update the managed version or keep it.
+	Drifted []*Candidate
+
+	// Covered lists files whose contents are already in the source state
+	// under another path; they are reported instead of offered as new.
+	Covered []*Candidate
+
+	// Profile is the scan's timing profile when ScanOptions.Profile was set.
+	Profile *Profile
 }
 
 // Summary returns counts by category.
@@ -190,11 +246,14 @@ func (r *Result) Summary() map[Category]int {
 }
 
 // relPath returns the path relative to home, or the original path if not under home.
+// relPath returns path relative to home as "~/...", in NFC so the same
+// name read back decomposed on macOS gives the same key.
 func relPath(path, home string) string {
+	path = platform.NormalizeUnicode(path)
 	if home == "" {
 		return path
 	}
-	rel, err := filepath.Rel(home, path)
+	rel, err := filepath.Rel(platform.NormalizeUnicode(home), path)
 	if err != nil {
 		return path
 	}
@@ -49,6 +49,10 @@ func TestDiscoverThenCaptureReAdd(t *testing.T) {
 		testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "re-add"),
 		"",
 	)
+	mock.OnCommandSuccess(
+		testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "diff"),
+		"",
+	)
 
 	scanOpts := ScanOptions{
 		Roots:         []string{homeDir},
@@ -10,11 +10,15 @@ import (
 
 	"github.com/dnery/dotstate/dot/internal/chez"
 	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/diffstat"
 	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/machine"
 	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/native"
 	"github.com/dnery/dotstate/dot/internal/platform"
 	"github.com/dnery/dotstate/dot/internal/redact"
 	"github.com/dnery/dotstate/dot/internal/runner"
+	"github.com/dnery/dotstate/dot/internal/ui"
 	toml "github.com/pelletier/go-toml/v2"
 )
 
@@ -23,11 +27,13 @@ type Discoverer struct {
 	cfg      *config.Config
 	plat     *platform.Platform
 	runner   runner.Runner
-	chezmoi  *chez.Chezmoi
+	chezmoi  chez.Engine
 	git      *gitx.Git
 	scanner  *Scanner
 	secrets  *SecretDetector
 	prompter *Prompter
+	// installed reports whether an app is present, for Options.Missing.
+	installed func(app string) bool
 }
 
 // Options configures the discovery process.
@@ -47,15 +53,46 @@ type Options struct {
 	// ReportOnly prints a report without any prompts.
 	ReportOnly bool
 
-	// SecretsMode controls how secrets are handled: "error", "warning", "ignore".
+	// JSON prints the report-only output as a Report in JSON.
+	JSON bool
+
+	// NonInteractive is what to do when stdin or stdout is not a terminal
+	// and neither AutoYes nor ReportOnly is set: NonInteractiveReport (the
+	// default) prints the report, NonInteractiveYes behaves like AutoYes.
+	NonInteractive string
+
+	// Missing reverses discovery: it lists installed apps whose managed
+	// configs are missing or not applied here, with the apply command for
+	// each, instead of scanning for new files.
+	Missing bool
+
+	// SecretsMode controls how secrets are handled: "error", "warning",
+	// "ignore", or "prompt" to review each finding in the selection.
 	SecretsMode string
 
+	// FailOn is the lowest finding confidence that blocks a file in error
+	// mode; files whose findings are all weaker are added with a warning.
+	// Empty blocks on every finding.
+	FailOn string
+
 	// MaxFileSize is the maximum file size to consider.
 	MaxFileSize int64
 
+	// LargeFileSize is the size above which a selected file must be routed
+	// through git-lfs, skipped, or explicitly kept.
+	LargeFileSize int64
+
+	// Submodules tracks selected sub-repositories as git submodules of the
+	// repo instead of entries in state/subrepos.toml.
+	Submodules bool
+
 	// Roots overrides the default scan roots.
 	Roots []string
 
+	// Profile reports the time spent per scan root, pipeline stage, and
+	// secret pattern, and the paths each exclusion rule skipped.
+	Profile bool
+
 	// Platform overrides the detected platform for discovery.
 	Platform *platform.Platform
 }
@@ -64,13 +101,21 @@ const (
 	SecretsModeError   = "error"
 	SecretsModeWarning = "warning"
 	SecretsModeIgnore  = "ignore"
+	SecretsModePrompt  = "prompt"
+)
+
+const (
+	NonInteractiveReport = "report"
+	NonInteractiveYes    = "yes"
 )
 
 // DefaultOptions returns default discovery options.
 func DefaultOptions() Options {
 	return Options{
-		SecretsMode: SecretsModeError,
-		MaxFileSize: DefaultMaxFileSize,
+		SecretsMode:    SecretsModeError,
+		NonInteractive: NonInteractiveReport,
+		MaxFileSize:    DefaultMaxFileSize,
+		LargeFileSize:  DefaultLargeFileSize,
 	}
 }
 
@@ -83,15 +128,34 @@ func normalizeOptions(opts Options) (Options, error) {
 	opts.SecretsMode = strings.ToLower(strings.TrimSpace(opts.SecretsMode))
 
 	switch opts.SecretsMode {
-	case SecretsModeError, SecretsModeWarning, SecretsModeIgnore:
+	case SecretsModeError, SecretsModeWarning, SecretsModeIgnore, SecretsModePrompt:
 		// valid
 	default:
-		return Options{}, fmt.Errorf("invalid secrets mode %q (expected: error, warning, ignore)", opts.SecretsMode)
+		return Options{}, fmt.Errorf("invalid secrets mode %q (expected: error, warning, ignore, prompt)", opts.SecretsMode)
+	}
+
+	switch opts.FailOn = strings.ToLower(strings.TrimSpace(opts.FailOn)); opts.FailOn {
+	case "", ConfidenceLow, ConfidenceMedium, ConfidenceHigh:
+		// valid
+	default:
+		return Options{}, fmt.Errorf("invalid secrets fail_on %q (expected: low, medium, high)", opts.FailOn)
+	}
+
+	switch opts.NonInteractive = strings.ToLower(strings.TrimSpace(opts.NonInteractive)); opts.NonInteractive {
+	case "":
+		opts.NonInteractive = defaults.NonInteractive
+	case NonInteractiveReport, NonInteractiveYes:
+		// valid
+	default:
+		return Options{}, fmt.Errorf("invalid non-interactive policy %q (expected: report, yes)", opts.NonInteractive)
 	}
 
 	if opts.MaxFileSize <= 0 {
 		opts.MaxFileSize = defaults.MaxFileSize
 	}
+	if opts.LargeFileSize <= 0 {
+		opts.LargeFileSize = defaults.LargeFileSize
+	}
 
 	return opts, nil
 }
@@ -108,7 +172,7 @@ func normalizeManagedPaths(paths []string, home string) map[string]bool {
 		} else if !filepath.IsAbs(path) {
 			path = filepath.Join(home, path)
 		}
-		managed[filepath.Clean(path)] = true
+		managed[platform.NormalizeUnicode(filepath.Clean(path))] = true
 	}
 	return managed
 }
@@ -139,6 +203,19 @@ func readRegistryLines(path string) []string {
 	return lines
 }
 
+// loadDotIgnore reads the repo's .dotignore followed by the user's
+// ~/.config/dotstate/ignore, so personal rules can override shared ones.
+func loadDotIgnore(cfg *config.Config, home string) *IgnoreMatcher {
+	var paths []string
+	if cfg != nil {
+		paths = append(paths, filepath.Join(cfg.RepoRoot(), DotIgnoreFile))
+	}
+	if home != "" {
+		paths = append(paths, filepath.Join(home, ".config", "dotstate", "ignore"))
+	}
+	return LoadIgnoreFiles(paths...)
+}
+
 func expandDiscoverRoots(paths []string, home string) []string {
 	roots := make([]string, 0, len(paths))
 	for _, path := range paths {
@@ -200,25 +277,45 @@ func NewDiscoverer(cfg *config.Config, opts Options) (*Discoverer, error) {
 		Roots:          expandDiscoverRoots(opts.Roots, plat.Home),
 		CuratedRoots:   curatedRoots,
 		IgnorePatterns: ignorePatterns,
+		DotIgnore:      loadDotIgnore(cfg, plat.Home),
 		Platform:       plat,
 	}
+	if opts.Profile {
+		scanOpts.Profile = NewProfile()
+	}
 
 	// Get managed paths from chezmoi to exclude
-	ch := chez.New(cfg.Tools.Chezmoi, r)
+	var ch chez.Engine
+	if cfg.Chex.Engine == config.EngineNative {
+		ch = native.New(plat.Home, native.Mode(cfg.Chex.NativeMode))
+	} else {
+		c := chez.New(cfg.Tools.Chezmoi, r)
+		c.Warn = func(msg string) { fmt.Fprintf(os.Stderr, "warning: %s\n", msg) }
+		_ = c.Probe(context.Background(), filepath.Join(plat.Paths().CacheDir, chez.CapabilitiesCacheFile))
+		ch = c
+	}
 	managed, err := ch.Managed(context.Background(), cfg.RepoRoot(), cfg.Chex.SourceDir)
 	if err == nil {
 		scanOpts.ManagedPaths = normalizeManagedPaths(managed, plat.Home)
 	}
 
+	secrets := NewSecretDetector(r)
+	secrets.SetAllowlist(LoadSecretAllowlist(filepath.Join(cfg.StatePath(), "discover", SecretAllowlistFile)))
+	if err := secrets.UseGitleaksConfig(filepath.Join(cfg.RepoRoot(), GitleaksConfigFile)); err != nil {
+		return nil, err
+	}
+	secrets.profile = scanOpts.Profile
+
 	return &Discoverer{
-		cfg:      cfg,
-		plat:     plat,
-		runner:   r,
-		chezmoi:  ch,
-		git:      gitx.New(cfg.Tools.Git, r),
-		scanner:  NewScanner(scanOpts),
-		secrets:  NewSecretDetector(r),
-		prompter: NewPrompter(opts.AutoYes),
+		cfg:       cfg,
+		plat:      plat,
+		runner:    r,
+		chezmoi:   ch,
+		git:       gitx.New(cfg.Tools.Git, r),
+		scanner:   NewScanner(scanOpts),
+		secrets:   secrets,
+		prompter:  NewPrompter(opts.AutoYes),
+		installed: AppInstalled(plat.Home),
 	}, nil
 }
 
@@ -229,19 +326,42 @@ func (d *Discoverer) Run(ctx context.Context, opts Options) error {
 		return err
 	}
 
+	if !opts.AutoYes && !opts.ReportOnly && !d.prompter.Interactive() {
+		opts = d.prompter.nonInteractiveFallback(opts)
+	}
+
+	if opts.Missing {
+		apps, err := FindMissingApps(ctx, d.chezmoi, d.cfg.RepoRoot(), d.cfg.Chex.SourceDir, d.plat.Home, d.installed)
+		if err != nil {
+			return fmt.Errorf("list managed files: %w", err)
+		}
+		d.prompter.PrintMissingApps(apps)
+		return nil
+	}
+
 	// Scan for candidates
 	result, err := d.scanner.Scan(ctx)
 	if err != nil {
 		return fmt.Errorf("scan failed: %w", err)
 	}
 
+	start := result.Profile.start()
+	d.markCovered(result)
+	result.Profile.stage(ProfileStageCovered, start)
+	start = result.Profile.start()
+	d.markDrifted(ctx, result)
+	result.Profile.stage(ProfileStageDrift, start)
 	d.addTypedModuleGuidance(result)
+	applyAttributeRules(d.cfg, result.Candidates)
 
 	// Run secret detection on candidates
 	if opts.SecretsMode != SecretsModeIgnore {
 		if err := d.secrets.UpdateCandidates(ctx, result.Candidates); err != nil {
 			return fmt.Errorf("secret scan failed: %w", err)
 		}
+		if err := d.secrets.UpdateCandidates(ctx, result.Drifted); err != nil {
+			return fmt.Errorf("secret scan failed: %w", err)
+		}
 		if opts.ReportOnly {
 			if diag := d.secrets.GitleaksUnavailableDiagnostic(ctx); diag != nil {
 				result.Diagnostics = append(result.Diagnostics, *diag)
@@ -249,8 +369,15 @@ func (d *Discoverer) Run(ctx context.Context, opts Options) error {
 		}
 	}
 
+	if result.Profile != nil && !opts.JSON {
+		d.prompter.PrintProfile(result, d.plat.Home)
+	}
+
 	// Report-only mode
 	if opts.ReportOnly {
+		if opts.JSON {
+			return d.prompter.PrintReportJSON(result)
+		}
 		d.prompter.PrintReport(result)
 		return nil
 	}
@@ -261,22 +388,79 @@ func (d *Discoverer) Run(ctx context.Context, opts Options) error {
 		return fmt.Errorf("selection failed: %w", err)
 	}
 
-	if len(selected) == 0 {
-		fmt.Println("No files selected.")
+	// Review files large enough to bloat the repo
+	if large := largeCandidates(selected, opts.LargeFileSize); len(large) > 0 {
+		selected = d.prompter.ReviewLargeFiles(selected, opts.LargeFileSize, d.git.LFSAvailable(ctx))
+	}
+
+	// Review managed files that drifted from the repo
+	updates := d.prompter.ReviewDrifted(result.Drifted)
+
+	if len(selected) == 0 && len(updates) == 0 {
+		ui.Out.Infoln("No files selected.")
 		return nil
 	}
 
+	// Review each finding in prompt mode
+	if opts.SecretsMode == SecretsModePrompt {
+		// The native engine has no onepasswordRead to render placeholders.
+		if d.cfg.Chex.Engine != config.EngineNative {
+			for _, c := range selected {
+				c.Templatable = d.secrets.CanTemplate(c.SecretFindings)
+			}
+		}
+		var allowSelected, allowUpdates []string
+		selected, allowSelected = d.prompter.ReviewSecrets(selected)
+		updates, allowUpdates = d.prompter.ReviewSecrets(updates)
+		if allow := append(allowSelected, allowUpdates...); len(allow) > 0 && !opts.DryRun {
+			if err := AppendSecretAllowlist(d.secretAllowlistPath(), allow); err != nil {
+				return err
+			}
+		}
+		if len(selected) == 0 && len(updates) == 0 {
+			ui.Out.Infoln("No files selected.")
+			return nil
+		}
+	}
+
+	// Refuse files whose findings meet the fail_on threshold
+	if blocked := append(opts.blockedBySecrets(selected), opts.blockedBySecrets(updates)...); len(blocked) > 0 {
+		paths := make([]string, 0, len(blocked))
+		for _, c := range blocked {
+			paths = append(paths, redact.Text(c.RelPath))
+		}
+		return fmt.Errorf("%d selected file(s) have %s-confidence secret findings: %s (use --secrets warning to add anyway)",
+			len(blocked), opts.FailOn, strings.Join(paths, ", "))
+	}
+
 	// Confirm addition
-	if !d.prompter.ConfirmAdd(selected) {
-		fmt.Println("Cancelled.")
+	if len(selected) > 0 && !d.prompter.ConfirmAdd(selected) {
+		ui.Out.Infoln("Cancelled.")
 		return nil
 	}
 
 	// Dry run mode
 	if opts.DryRun {
-		fmt.Printf("Would add %d files (dry run).\n", len(selected))
+		if len(updates) > 0 {
+			ui.Out.Printf("Would update %d managed files (dry run).\n", len(updates))
+			for _, c := range updates {
+				ui.Out.Printf("  %s\n", redact.Text(c.RelPath))
+			}
+		}
+		ui.Out.Printf("Would add %d files (dry run).\n", len(selected))
 		for _, c := range selected {
-			fmt.Printf("  %s\n", redact.Text(c.RelPath))
+			var marks []string
+			if !c.Attributes.IsZero() {
+				marks = append(marks, c.Attributes.String())
+			}
+			if c.LFS {
+				marks = append(marks, "git-lfs")
+			}
+			if len(marks) == 0 {
+				ui.Out.Printf("  %s\n", redact.Text(c.RelPath))
+			} else {
+				ui.Out.Printf("  %s [%s]\n", redact.Text(c.RelPath), strings.Join(marks, ", "))
+			}
 		}
 		return nil
 	}
@@ -294,11 +478,14 @@ func (d *Discoverer) Run(ctx context.Context, opts Options) error {
 	if err := d.addCandidates(ctx, selected, opts); err != nil {
 		return err
 	}
+	if err := d.updateManaged(ctx, updates, opts); err != nil {
+		return err
+	}
 
 	// Commit if enabled
 	if !opts.NoCommit {
 		if repoAlreadyDirty {
-			fmt.Println("Skipping automatic commit because the repo had pre-existing changes.")
+			ui.Out.Println("Skipping automatic commit because the repo had pre-existing changes.")
 		} else if d.prompter.ConfirmCommit() {
 			if err := d.commit(ctx); err != nil {
 				return fmt.Errorf("commit failed: %w", err)
@@ -307,37 +494,147 @@ func (d *Discoverer) Run(ctx context.Context, opts Options) error {
 	}
 
 	// Print next steps
-	fmt.Println("\nNext steps:")
-	fmt.Println("  dot apply    - Apply the repository state to this machine")
-	fmt.Println("  dot sync now - Sync changes to other machines")
+	ui.Out.Infoln("\nNext steps:")
+	ui.Out.Infoln("  dot apply    - Apply the repository state to this machine")
+	ui.Out.Infoln("  dot sync now - Sync changes to other machines")
+
+	return nil
+}
+
+// secretAllowlistPath is the registry of findings accepted in prompt mode.
+func (d *Discoverer) secretAllowlistPath() string {
+	return filepath.Join(d.cfg.StatePath(), "discover", SecretAllowlistFile)
+}
+
+// markCovered sets aside candidates identical to already-managed content.
+func (d *Discoverer) markCovered(result *Result) {
+	hashes, err := SourceHashes(d.cfg.SourcePath())
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("hash source state: %w", err))
+		return
+	}
+	markCovered(result, hashes)
+}
+
+// markDrifted turns scanned managed files whose contents differ from the
+// source state into result.Drifted, so local edits do not drift silently.
+// Template-backed files are left alone: adding them would replace the
+// template with its rendered output.
+func (d *Discoverer) markDrifted(ctx context.Context, result *Result) {
+	if len(result.Managed) == 0 {
+		return
+	}
+	diff, err := d.chezmoi.Diff(ctx, d.cfg.RepoRoot(), d.cfg.Chex.SourceDir, result.Managed...)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("diff managed files: %w", err))
+		return
+	}
+	sections := map[string]string{}
+	for target, text := range diffstat.Split(diff) {
+		sections[platform.NormalizeUnicode(target)] = text
+	}
+	for _, path := range result.Managed {
+		rel := relPath(path, d.plat.Home)
+		text, ok := sections[strings.TrimPrefix(filepath.ToSlash(rel), "~/")]
+		if !ok {
+			continue
+		}
+		if src, err := d.chezmoi.SourcePath(ctx, d.cfg.RepoRoot(), d.cfg.Chex.SourceDir, path); err != nil || strings.HasSuffix(src, ".tmpl") {
+			continue
+		}
+		c := &Candidate{Path: path, RelPath: rel, Category: CategoryMaybe, Drift: text, Reasons: []string{"differs from managed version"}}
+		if info, err := os.Stat(path); err == nil {
+			c.Size, c.ModTime = info.Size(), info.ModTime()
+		}
+		result.Drifted = append(result.Drifted, c)
+	}
+}
 
+// updateManaged copies drifted files chosen for update over their managed
+// versions.
+func (d *Discoverer) updateManaged(ctx context.Context, updates []*Candidate, opts Options) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	byMode := map[string][]string{}
+	for _, c := range updates {
+		mode := opts.secretsModeFor(c)
+		byMode[mode] = append(byMode[mode], c.Path)
+	}
+	for _, mode := range []string{SecretsModeError, SecretsModeWarning, SecretsModeIgnore} {
+		if len(byMode[mode]) == 0 {
+			continue
+		}
+		if err := d.chezmoi.Add(ctx, d.cfg.RepoRoot(), d.cfg.Chex.SourceDir, byMode[mode], mode); err != nil {
+			return fmt.Errorf("update managed files: %w", err)
+		}
+	}
+	ui.Out.Printf("Updated %d managed files.\n", len(updates))
 	return nil
 }
 
 // addCandidates adds the selected candidates to the repository.
 func (d *Discoverer) addCandidates(ctx context.Context, candidates []*Candidate, opts Options) error {
-	// Separate files from sub-repos
-	var files []string
+	// Separate files from sub-repos, grouping files by attribute set and
+	// secrets mode
+	type addGroup struct {
+		attrs chez.Attributes
+		mode  string
+	}
+	files := map[addGroup][]string{}
 	var subRepos []*Candidate
+	count := 0
 
 	for _, c := range candidates {
 		if c.IsSubRepo {
 			subRepos = append(subRepos, c)
 		} else {
-			files = append(files, c.Path)
+			g := addGroup{c.Attributes, opts.secretsModeFor(c)}
+			files[g] = append(files[g], c.Path)
+			count++
 		}
 	}
 
-	// Add files with chezmoi
-	if len(files) > 0 {
-		if err := d.chezmoi.Add(ctx, d.cfg.RepoRoot(), d.cfg.Chex.SourceDir, files, opts.SecretsMode); err != nil {
-			return fmt.Errorf("chezmoi add failed: %w", err)
+	// Add files with chezmoi, one call per group
+	if count > 0 {
+		// Source names grow with dot_/private_ prefixes, so a source path
+		// can pass MAX_PATH where its target did not; git for Windows
+		// refuses to stage such paths without core.longpaths.
+		if d.plat.IsWindows() {
+			if err := d.git.ConfigSetLocal(ctx, d.cfg.RepoRoot(), "core.longpaths", "true"); err != nil {
+				return fmt.Errorf("enable git core.longpaths: %w", err)
+			}
+		}
+		groups := make([]addGroup, 0, len(files))
+		for g := range files {
+			groups = append(groups, g)
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			if groups[i].attrs != groups[j].attrs {
+				return groups[i].attrs.String() < groups[j].attrs.String()
+			}
+			return groups[i].mode < groups[j].mode
+		})
+		for _, g := range groups {
+			if err := d.chezmoi.AddWithAttributes(ctx, d.cfg.RepoRoot(), d.cfg.Chex.SourceDir, files[g], g.mode, g.attrs); err != nil {
+				return fmt.Errorf("chezmoi add failed: %w", err)
+			}
+		}
+		ui.Out.Printf("Added %d files.\n", count)
+		if err := d.templatizeSecrets(ctx, candidates); err != nil {
+			return err
+		}
+		if err := d.trackLFS(ctx, candidates); err != nil {
+			return err
 		}
-		fmt.Printf("Added %d files.\n", len(files))
 	}
 
 	// Handle sub-repos
-	if len(subRepos) > 0 {
+	if len(subRepos) > 0 && opts.Submodules {
+		if err := d.addSubmodules(ctx, subRepos); err != nil {
+			return err
+		}
+	} else if len(subRepos) > 0 {
 		if err := d.handleSubRepos(ctx, subRepos); err != nil {
 			return err
 		}
@@ -346,6 +643,104 @@ func (d *Discoverer) addCandidates(ctx context.Context, candidates []*Candidate,
 	return nil
 }
 
+// templatizeSecrets rewrites the source files of candidates added as
+// templates so each secret value becomes a onepasswordRead placeholder, then
+// prints the [templates.secrets] entries the placeholders need. A file that
+// cannot be rewritten is forgotten again so its secrets never stay in the
+// source state.
+func (d *Discoverer) templatizeSecrets(ctx context.Context, candidates []*Candidate) error {
+	used := map[string]bool{}
+	for name := range d.cfg.Templates.Secrets {
+		used[name] = true
+	}
+	type entry struct {
+		candidate   *Candidate
+		placeholder SecretPlaceholder
+	}
+	var entries []entry
+	for _, c := range candidates {
+		if !c.Attributes.Template || c.IsSubRepo {
+			continue
+		}
+		placeholders, err := d.templatizeFile(ctx, c, used)
+		if err != nil {
+			if forgetErr := d.chezmoi.Forget(ctx, d.cfg.RepoRoot(), d.cfg.Chex.SourceDir, c.Path); forgetErr != nil {
+				return fmt.Errorf("template secrets in %s: %w (and removing it from the source state failed: %v)", redact.Text(c.RelPath), err, forgetErr)
+			}
+			return fmt.Errorf("template secrets in %s: %w (removed it from the source state)", redact.Text(c.RelPath), err)
+		}
+		for _, p := range placeholders {
+			entries = append(entries, entry{c, p})
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	ui.Out.Printf("Templated %d secret(s). Add their references to dot.toml before applying:\n\n", len(entries))
+	ui.Out.Println("[templates.secrets]")
+	for _, e := range entries {
+		ui.Out.Printf("%s = \"op://<vault>/<item>/<field>\"  # %s line %d (%s)\n",
+			e.placeholder.Name, redact.Text(e.candidate.RelPath), e.placeholder.Line, e.placeholder.PatternID)
+	}
+	ui.Out.Println()
+	return nil
+}
+
+// templatizeFile rewrites the source file managing c from c's current
+// contents, naming each secret after the file and pattern.
+func (d *Discoverer) templatizeFile(ctx context.Context, c *Candidate, used map[string]bool) ([]SecretPlaceholder, error) {
+	src, err := d.chezmoi.SourcePath(ctx, d.cfg.RepoRoot(), d.cfg.Chex.SourceDir, c.Path)
+	if err != nil {
+		return nil, fmt.Errorf("find source file: %w", err)
+	}
+	content, err := os.ReadFile(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("stat source file: %w", err)
+	}
+	text, placeholders, err := d.secrets.TemplatizeSecrets(c.Path, string(content), func(patternID string) string {
+		return uniqueSecretName(secretName(c.RelPath, patternID), used)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(src, []byte(text), info.Mode().Perm()); err != nil {
+		return nil, fmt.Errorf("write template: %w", err)
+	}
+	return placeholders, nil
+}
+
+// trackLFS routes the source files of candidates marked for git-lfs
+// through .gitattributes so the discover commit stores them as LFS objects.
+func (d *Discoverer) trackLFS(ctx context.Context, candidates []*Candidate) error {
+	var paths []string
+	for _, c := range candidates {
+		if !c.LFS || c.IsSubRepo {
+			continue
+		}
+		src, err := d.chezmoi.SourcePath(ctx, d.cfg.RepoRoot(), d.cfg.Chex.SourceDir, c.Path)
+		if err != nil {
+			return fmt.Errorf("locate source for %s: %w", redact.Text(c.RelPath), err)
+		}
+		rel, err := filepath.Rel(d.cfg.RepoRoot(), src)
+		if err != nil {
+			return fmt.Errorf("locate source for %s: %w", redact.Text(c.RelPath), err)
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	if err := d.git.LFSTrack(ctx, d.cfg.RepoRoot(), paths...); err != nil {
+		return fmt.Errorf("git lfs track failed: %w", err)
+	}
+	ui.Out.Printf("Tracked %d files with git-lfs.\n", len(paths))
+	return nil
+}
+
 // handleSubRepos writes sub-repository references to a manifest file.
 func (d *Discoverer) handleSubRepos(ctx context.Context, subRepos []*Candidate) error {
 	if len(subRepos) == 0 {
@@ -356,7 +751,7 @@ func (d *Discoverer) handleSubRepos(ctx context.Context, subRepos []*Candidate)
 		return err
 	}
 
-	fmt.Printf("\nFound %d sub-repositories:\n", len(subRepos))
+	ui.Out.Printf("\nFound %d sub-repositories:\n", len(subRepos))
 	var discovered []SubRepoManifest
 	for _, r := range subRepos {
 		url := r.SubRepoURL
@@ -367,14 +762,14 @@ func (d *Discoverer) handleSubRepos(ctx context.Context, subRepos []*Candidate)
 		}
 
 		if url == "" {
-			fmt.Printf("  SKIP: %s (local only - will be skipped)\n", redact.Text(r.RelPath))
+			ui.Out.Printf("  SKIP: %s (local only - will be skipped)\n", redact.Text(r.RelPath))
 			continue
 		}
 
 		if redacted {
-			fmt.Printf("  OK: %s -> %s (credentials redacted)\n", redact.Text(r.RelPath), redact.Text(url))
+			ui.Out.Printf("  OK: %s -> %s (credentials redacted)\n", redact.Text(r.RelPath), redact.Text(url))
 		} else {
-			fmt.Printf("  OK: %s -> %s\n", redact.Text(r.RelPath), redact.Text(url))
+			ui.Out.Printf("  OK: %s -> %s\n", redact.Text(r.RelPath), redact.Text(url))
 		}
 		discovered = append(discovered, SubRepoManifest{
 			Path:   r.RelPath,
@@ -384,7 +779,7 @@ func (d *Discoverer) handleSubRepos(ctx context.Context, subRepos []*Candidate)
 	}
 
 	if len(discovered) == 0 {
-		fmt.Println("No sub-repositories with remotes to track.")
+		ui.Out.Infoln("No sub-repositories with remotes to track.")
 		return nil
 	}
 
@@ -394,32 +789,44 @@ func (d *Discoverer) handleSubRepos(ctx context.Context, subRepos []*Candidate)
 		return err
 	}
 
-	fmt.Printf("\nSub-repository manifest (%d repos):\n", len(manifest.SubRepos))
+	ui.Out.Printf("\nSub-repository manifest (%d repos):\n", len(manifest.SubRepos))
 	for _, m := range manifest.SubRepos {
-		fmt.Printf("  [[subrepo]]\n")
-		fmt.Printf("  path = %q\n", redact.Text(m.Path))
-		fmt.Printf("  url = %q\n", redact.Text(m.URL))
+		ui.Out.Printf("  [[subrepo]]\n")
+		ui.Out.Printf("  path = %q\n", redact.Text(m.Path))
+		ui.Out.Printf("  url = %q\n", redact.Text(m.URL))
 		if m.Branch != "" {
-			fmt.Printf("  branch = %q\n", redact.Text(m.Branch))
+			ui.Out.Printf("  branch = %q\n", redact.Text(m.Branch))
 		}
-		fmt.Println()
+		ui.Out.Println()
 	}
 
-	data, err := toml.Marshal(manifest)
-	if err != nil {
-		return fmt.Errorf("marshal sub-repo manifest: %w", err)
+	if err := writeSubRepoManifest(manifestPath, manifest); err != nil {
+		return err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(manifestPath), 0o755); err != nil {
-		return fmt.Errorf("create state directory: %w", err)
-	}
-	if err := os.WriteFile(manifestPath, data, 0o644); err != nil {
-		return fmt.Errorf("write sub-repo manifest: %w", err)
-	}
+	ui.Out.Infof("Note: Sub-repo manifest saved to %s\n", redact.Text(manifestPath))
+	ui.Out.Infoln("      During 'dot apply', these repos will be cloned/updated.")
+	ui.Out.Infoln("      To track one as a git submodule instead, run 'dot subrepo convert <path>'.")
 
-	fmt.Printf("Note: Sub-repo manifest saved to %s\n", redact.Text(manifestPath))
-	fmt.Println("      During 'dot apply', these repos will be cloned/updated.")
+	return nil
+}
 
+// addSubmodules tracks sub-repositories as git submodules of the repo
+// instead of manifest entries. Local-only repos are skipped.
+func (d *Discoverer) addSubmodules(ctx context.Context, subRepos []*Candidate) error {
+	ui.Out.Printf("\nAdding %d sub-repositories as git submodules:\n", len(subRepos))
+	for _, r := range subRepos {
+		if r.SubRepoURL == "" {
+			ui.Out.Printf("  SKIP: %s (local only - will be skipped)\n", redact.Text(r.RelPath))
+			continue
+		}
+		entry := SubRepoManifest{Path: r.RelPath, URL: r.SubRepoURL, Branch: r.SubRepoBranch}
+		subPath, err := ConvertToSubmodule(ctx, d.cfg, d.git, d.plat.Home, entry)
+		if err != nil {
+			return err
+		}
+		ui.Out.Printf("  OK: %s -> %s\n", redact.Text(r.RelPath), redact.Text(subPath))
+	}
 	return nil
 }
 
@@ -475,9 +882,9 @@ func readSubRepoManifest(path string) (SubReposManifest, error) {
 
 // commit commits the added files.
 func (d *Discoverer) commit(ctx context.Context) error {
-	hostname := platform.Hostname()
-	message := gitx.DefaultCommitMessage(hostname)
-	message = "discover: " + message
+	id := machine.Current(d.plat)
+	message := gitx.DefaultCommitMessage(id.Hostname)
+	message = gitx.WithMachineTrailer("discover: "+message, id.ID)
 
 	committed, err := d.git.Commit(ctx, d.cfg.RepoRoot(), message)
 	if err != nil {
@@ -485,9 +892,9 @@ func (d *Discoverer) commit(ctx context.Context) error {
 	}
 
 	if committed {
-		fmt.Println("Changes committed.")
+		ui.Out.Println("Changes committed.")
 	} else {
-		fmt.Println("No changes to commit.")
+		ui.Out.Println("No changes to commit.")
 	}
 
 	return nil
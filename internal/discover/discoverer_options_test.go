@@ -29,6 +29,52 @@ func TestNormalizeOptionsValidatesSecretsMode(t *testing.T) {
 	}
 }
 
+func TestNormalizeOptionsValidatesNonInteractivePolicy(t *testing.T) {
+	opts, err := normalizeOptions(Options{NonInteractive: " YES "})
+	if err != nil || opts.NonInteractive != NonInteractiveYes {
+		t.Fatalf("normalizeOptions = %q, %v; want yes", opts.NonInteractive, err)
+	}
+	if opts, _ := normalizeOptions(Options{}); opts.NonInteractive != NonInteractiveReport {
+		t.Fatalf("default NonInteractive = %q, want report", opts.NonInteractive)
+	}
+	if _, err := normalizeOptions(Options{NonInteractive: "prompt"}); err == nil {
+		t.Fatal("expected error for invalid non-interactive policy")
+	}
+}
+
+func TestFailOnSplitsBlockedAndWarnedFiles(t *testing.T) {
+	if _, err := normalizeOptions(Options{FailOn: "critical"}); err == nil {
+		t.Fatal("expected error for invalid fail_on")
+	}
+	opts, err := normalizeOptions(Options{FailOn: "High"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := &Candidate{RelPath: "~/.ssh/id_ed25519", SecretConfidence: ConfidenceHigh}
+	assignment := &Candidate{RelPath: "~/.config/app/db.conf", SecretConfidence: ConfidenceLow}
+	clean := &Candidate{RelPath: "~/.zshrc"}
+
+	blocked := opts.blockedBySecrets([]*Candidate{key, assignment, clean})
+	if len(blocked) != 1 || blocked[0] != key {
+		t.Fatalf("blocked = %v, want only the high-confidence file", blocked)
+	}
+	if got := opts.secretsModeFor(assignment); got != SecretsModeWarning {
+		t.Fatalf("low-confidence file mode = %q, want warning", got)
+	}
+	if got := opts.secretsModeFor(clean); got != SecretsModeError {
+		t.Fatalf("clean file mode = %q, want error", got)
+	}
+
+	opts.FailOn = ""
+	if blocked := opts.blockedBySecrets([]*Candidate{key}); len(blocked) != 0 {
+		t.Fatalf("blocked without fail_on = %v, want chezmoi to decide", blocked)
+	}
+	if got := opts.secretsModeFor(assignment); got != SecretsModeError {
+		t.Fatalf("mode without fail_on = %q, want error", got)
+	}
+}
+
 func TestNormalizeOptionsLowercasesMode(t *testing.T) {
 	opts, err := normalizeOptions(Options{SecretsMode: "WARNING", MaxFileSize: DefaultMaxFileSize})
 	if err != nil {
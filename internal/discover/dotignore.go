@@ -0,0 +1,108 @@
+package discover
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/glob"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// DotIgnoreFile is the gitignore-syntax exclusion file read from the repo
+// root and from ~/.config/dotstate/ignore.
+const DotIgnoreFile = ".dotignore"
+
+// ignoreRule is one parsed .dotignore line.
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// IgnoreMatcher applies gitignore-syntax rules to home-relative paths. Later
+// rules override earlier ones, "!" re-includes, a trailing "/" matches only
+// directories, and patterns without a slash match at any depth.
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+// ParseIgnore parses gitignore-syntax content.
+func ParseIgnore(content string) *IgnoreMatcher {
+	m := &IgnoreMatcher{}
+	for _, line := range strings.Split(platform.NormalizeUnicode(content), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			line, rule.negate = rest, true
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		if rest, ok := strings.CutSuffix(line, "/"); ok {
+			line, rule.dirOnly = rest, true
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+		rule.segments = strings.Split(line, "/")
+		if !anchored {
+			rule.segments = append([]string{"**"}, rule.segments...)
+		}
+		m.rules = append(m.rules, rule)
+	}
+	return m
+}
+
+// LoadIgnoreFiles reads and concatenates the given ignore files in order;
+// missing files are skipped.
+func LoadIgnoreFiles(paths ...string) *IgnoreMatcher {
+	m := &IgnoreMatcher{}
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		m.rules = append(m.rules, ParseIgnore(string(data)).rules...)
+	}
+	return m
+}
+
+// Empty reports whether the matcher has no rules.
+func (m *IgnoreMatcher) Empty() bool {
+	return m == nil || len(m.rules) == 0
+}
+
+// Match reports whether rel, a slash-separated path relative to home, is
+// excluded. A path inside an excluded directory is excluded too.
+func (m *IgnoreMatcher) Match(rel string, isDir bool) bool {
+	if m.Empty() {
+		return false
+	}
+	rel = strings.Trim(path.Clean(filepath.ToSlash(rel)), "/")
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.matchOne(parts[:i], true) {
+			return true
+		}
+	}
+	return m.matchOne(parts, isDir)
+}
+
+func (m *IgnoreMatcher) matchOne(parts []string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if glob.MatchSegments(rule.segments, parts) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,102 @@
+package discover
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcherFollowsGitignoreSyntax(t *testing.T) {
+	m := ParseIgnore(`
+# comments and blank lines are skipped
+
+*.log
+.config/nvim/
+/.npmrc
+.config/app/**/cache
+.config/fish/*.fish
+!.config/fish/config.fish
+\#notes
+`)
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"debug.log", false, true},
+		{".config/tool/debug.log", false, true},
+		{".config/nvim", true, true},
+		{".config/nvim/init.lua", false, true},
+		{".config/nvim", false, false},
+		{".npmrc", false, true},
+		{".config/other/.npmrc", false, false},
+		{".config/app/cache", true, true},
+		{".config/app/a/b/cache/blob", false, true},
+		{".config/fish/aliases.fish", false, true},
+		{".config/fish/config.fish", false, false},
+		{"#notes", false, true},
+		{".zshrc", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestLoadIgnoreFilesLetsLaterFilesOverride(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, DotIgnoreFile)
+	personal := filepath.Join(dir, "ignore")
+	if err := os.WriteFile(shared, []byte("*.toml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(personal, []byte("!starship.toml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := LoadIgnoreFiles(shared, filepath.Join(dir, "missing"), personal)
+	if !m.Match(".config/app/config.toml", false) || m.Match(".config/starship.toml", false) {
+		t.Fatalf("unexpected matcher result: %#v", m.rules)
+	}
+}
+
+func TestScanHonorsDotIgnore(t *testing.T) {
+	home := t.TempDir()
+	for rel, content := range map[string]string{
+		".config/keep/settings.json": "{}",
+		".config/skip/settings.json": "{}",
+		".config/keep/local.json":    "{}",
+	} {
+		path := filepath.Join(home, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanner := NewScanner(ScanOptions{
+		Home:         home,
+		Roots:        []string{filepath.Join(home, ".config")},
+		ManagedPaths: make(map[string]bool),
+		DotIgnore:    ParseIgnore(".config/skip/\nlocal.json\n"),
+	})
+	result, err := scanner.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if len(result.Candidates) != 1 || result.Candidates[0].RelPath != "~/.config/keep/settings.json" {
+		var rels []string
+		for _, c := range result.Candidates {
+			rels = append(rels, c.RelPath)
+		}
+		t.Fatalf("candidates = %v, want only ~/.config/keep/settings.json", rels)
+	}
+	if result.Ignored[".dotignore"] != 2 {
+		t.Fatalf("ignored summary = %#v, want 2 .dotignore entries", result.Ignored)
+	}
+}
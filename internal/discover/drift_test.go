@@ -0,0 +1,66 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/native"
+	"github.com/dnery/dotstate/dot/internal/platform"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestRunOffersUpdateForDriftedManagedFiles(t *testing.T) {
+	repo, home := t.TempDir(), t.TempDir()
+	testutil.TempDotToml(t, repo, testutil.MinimalDotToml())
+	writeTestFiles(t, repo, map[string]string{
+		"home/dot_zshrc":          "export EDITOR=vim\n",
+		"home/dot_gitconfig.tmpl": "[user]\n",
+		"home/dot_vimrc":          "set number\n",
+	})
+	writeTestFiles(t, home, map[string]string{
+		".zshrc":     "export EDITOR=nvim\n",
+		".gitconfig": "[user]\n\tname = local\n",
+		".vimrc":     "set number\n",
+	})
+	cfg, err := config.Load(filepath.Join(repo, "dot.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	managed := map[string]bool{}
+	for _, name := range []string{".zshrc", ".gitconfig", ".vimrc"} {
+		managed[filepath.Join(home, name)] = true
+	}
+	mock := testutil.NewMockRunner(t)
+	var out bytes.Buffer
+	d := &Discoverer{
+		cfg:      cfg,
+		plat:     &platform.Platform{OS: platform.Linux, Home: home},
+		runner:   mock,
+		chezmoi:  native.New(home, native.ModeCopy),
+		git:      gitx.New(cfg.Tools.Git, mock),
+		scanner:  NewScanner(ScanOptions{Roots: []string{home}, Home: home, IncludeHidden: true, ManagedPaths: managed}),
+		secrets:  NewSecretDetector(mock),
+		prompter: NewPrompterWithIO(strings.NewReader("u\n"), &out, false),
+	}
+
+	if err := d.Run(context.Background(), Options{NoCommit: true, SecretsMode: SecretsModeIgnore}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(out.String(), "-export EDITOR=nvim\n+export EDITOR=vim\n") {
+		t.Fatalf("prompt did not show the drift diff:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), ".gitconfig") || strings.Contains(out.String(), ".vimrc") {
+		t.Fatalf("template-backed or unchanged files offered for update:\n%s", out.String())
+	}
+	got, err := os.ReadFile(filepath.Join(repo, "home", "dot_zshrc"))
+	if err != nil || string(got) != "export EDITOR=nvim\n" {
+		t.Fatalf("managed .zshrc = %q, %v; want the local version", got, err)
+	}
+}
@@ -0,0 +1,196 @@
+package discover
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// GitleaksConfigFile is the gitleaks configuration read from the repo root.
+const GitleaksConfigFile = ".gitleaks.toml"
+
+// gitleaksConfigFile is the subset of the gitleaks v8 configuration the
+// built-in detector understands. Allowlists may be a single table or an
+// array of tables, so they are decoded loosely.
+type gitleaksConfigFile struct {
+	Extend struct {
+		UseDefault bool `toml:"useDefault"`
+	} `toml:"extend"`
+	Allowlist  any `toml:"allowlist"`
+	Allowlists any `toml:"allowlists"`
+	Rules      []struct {
+		ID         string   `toml:"id"`
+		Regex      string   `toml:"regex"`
+		Path       string   `toml:"path"`
+		Keywords   []string `toml:"keywords"`
+		Allowlist  any      `toml:"allowlist"`
+		Allowlists any      `toml:"allowlists"`
+	} `toml:"rules"`
+}
+
+// secretAllowlist suppresses findings whose match (or line), or whose
+// file path, matches one of its expressions.
+type secretAllowlist struct {
+	regexes    []*regexp.Regexp
+	paths      []*regexp.Regexp
+	stopwords  []string
+	targetLine bool
+}
+
+// allows reports whether a finding of match in line of path is allowed.
+func (a secretAllowlist) allows(path, match, line string) bool {
+	for _, re := range a.paths {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	target := match
+	if a.targetLine {
+		target = line
+	}
+	for _, re := range a.regexes {
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	lower := strings.ToLower(match)
+	for _, word := range a.stopwords {
+		if strings.Contains(lower, strings.ToLower(word)) {
+			return true
+		}
+	}
+	return false
+}
+
+// UseGitleaksConfig applies a gitleaks configuration so the built-in
+// patterns and any gitleaks run share one rule set: its rules are added
+// (replacing built-in patterns with the same ID, or all of them unless
+// [extend] useDefault is set), its allowlists suppress findings, and
+// gitleaks is run with --config. A missing file changes nothing.
+func (d *SecretDetector) UseGitleaksConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read gitleaks config: %w", err)
+	}
+	var file gitleaksConfigFile
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse gitleaks config %s: %w", path, err)
+	}
+
+	allow, err := parseAllowlists(file.Allowlist, file.Allowlists)
+	if err != nil {
+		return fmt.Errorf("gitleaks config %s: %w", path, err)
+	}
+
+	var rules []*secretPattern
+	for _, rule := range file.Rules {
+		if rule.Regex == "" {
+			// Path-only rules flag files by name; the detector scans contents.
+			continue
+		}
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return fmt.Errorf("gitleaks config %s: rule %q: %w", path, rule.ID, err)
+		}
+		pattern := &secretPattern{Name: rule.ID, Regex: re, Keywords: rule.Keywords}
+		if rule.Path != "" {
+			if pattern.Path, err = regexp.Compile(rule.Path); err != nil {
+				return fmt.Errorf("gitleaks config %s: rule %q path: %w", path, rule.ID, err)
+			}
+		}
+		if pattern.Allow, err = parseAllowlists(rule.Allowlist, rule.Allowlists); err != nil {
+			return fmt.Errorf("gitleaks config %s: rule %q: %w", path, rule.ID, err)
+		}
+		rules = append(rules, pattern)
+	}
+
+	if len(rules) > 0 {
+		patterns := d.patterns
+		if !file.Extend.UseDefault {
+			patterns = nil
+		}
+		byName := make(map[string]int, len(patterns))
+		for i, p := range patterns {
+			byName[p.Name] = i
+		}
+		for _, rule := range rules {
+			if i, ok := byName[rule.Name]; ok {
+				patterns[i] = rule
+				continue
+			}
+			patterns = append(patterns, rule)
+		}
+		d.patterns = patterns
+	}
+	d.allowlists = allow
+	d.gitleaksConfig = path
+	return nil
+}
+
+// parseAllowlists decodes allowlist values given as one table or an array
+// of tables.
+func parseAllowlists(values ...any) ([]secretAllowlist, error) {
+	var tables []map[string]any
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case map[string]any:
+			tables = append(tables, v)
+		case []any:
+			for _, item := range v {
+				table, ok := item.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("allowlist entries must be tables")
+				}
+				tables = append(tables, table)
+			}
+		default:
+			return nil, fmt.Errorf("allowlist must be a table")
+		}
+	}
+
+	var out []secretAllowlist
+	for _, table := range tables {
+		var a secretAllowlist
+		var err error
+		if a.regexes, err = compileList(table["regexes"]); err != nil {
+			return nil, fmt.Errorf("allowlist regexes: %w", err)
+		}
+		if a.paths, err = compileList(table["paths"]); err != nil {
+			return nil, fmt.Errorf("allowlist paths: %w", err)
+		}
+		a.stopwords = stringList(table["stopwords"])
+		a.targetLine = table["regexTarget"] == "line"
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func compileList(v any) ([]*regexp.Regexp, error) {
+	var out []*regexp.Regexp
+	for _, expr := range stringList(v) {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+func stringList(v any) []string {
+	items, _ := v.([]any)
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,157 @@
+package discover
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/diffstat"
+)
+
+// MissingApp is an installed application whose managed configs are absent
+// from this machine or differ from the source state.
+type MissingApp struct {
+	// App is the application name derived from the config path.
+	App string
+
+	// Root is the home-relative config file or directory for the app, in
+	// the "~/" form `dot apply --only` accepts.
+	Root string
+
+	// Missing lists home-relative managed files that do not exist.
+	Missing []string
+
+	// Unapplied lists home-relative managed files that exist but differ.
+	Unapplied []string
+}
+
+// ApplyCommand returns the command that applies just this app's configs.
+func (m MissingApp) ApplyCommand() string {
+	root := m.Root
+	if strings.ContainsAny(root, " '\"") {
+		root = "'" + strings.ReplaceAll(root, "'", `'\''`) + "'"
+	}
+	return "dot apply --only " + root
+}
+
+// FindMissingApps groups managed targets by application and returns the
+// groups whose app is installed but whose configs are missing or not
+// applied. A diff failure, such as a template that cannot render yet, only
+// hides the "not applied" half.
+func FindMissingApps(ctx context.Context, engine chez.Engine, repoPath, sourceDir, home string, installed func(app string) bool) ([]MissingApp, error) {
+	managed, err := engine.Managed(ctx, repoPath, sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	differs := map[string]bool{}
+	if diff, err := engine.Diff(ctx, repoPath, sourceDir); err == nil {
+		for _, stat := range diffstat.Parse(diff) {
+			differs[stat.Path] = true
+		}
+	}
+
+	groups := map[string]*MissingApp{}
+	for _, target := range managed {
+		rel := filepath.ToSlash(target)
+		if filepath.IsAbs(target) {
+			r, err := filepath.Rel(home, target)
+			if err != nil || strings.HasPrefix(r, "..") {
+				continue
+			}
+			rel = filepath.ToSlash(r)
+		}
+		app, root := appForTarget(rel)
+		if app == "" {
+			continue
+		}
+		var missing, unapplied bool
+		if _, err := os.Lstat(filepath.Join(home, filepath.FromSlash(rel))); os.IsNotExist(err) {
+			missing = true
+		} else if differs[rel] {
+			unapplied = true
+		}
+		if !missing && !unapplied {
+			continue
+		}
+		g := groups[root]
+		if g == nil {
+			g = &MissingApp{App: app, Root: "~/" + root}
+			groups[root] = g
+		}
+		if missing {
+			g.Missing = append(g.Missing, "~/"+rel)
+		} else {
+			g.Unapplied = append(g.Unapplied, "~/"+rel)
+		}
+	}
+
+	var apps []MissingApp
+	for _, g := range groups {
+		if installed(g.App) {
+			apps = append(apps, *g)
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Root < apps[j].Root })
+	return apps, nil
+}
+
+// appForTarget derives an application name and its config root from a
+// home-relative managed path: ".config/nvim/init.lua" is nvim under
+// ".config/nvim", "Library/Application Support/Code/User/settings.json" is
+// Code, and ".tmux.conf" or ".zshrc" name tmux and zsh.
+func appForTarget(rel string) (app, root string) {
+	parts := strings.Split(rel, "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == ".config":
+		name := parts[1]
+		if len(parts) == 2 {
+			name = strings.TrimSuffix(name, path.Ext(name))
+		}
+		return name, path.Join(parts[:2]...)
+	case len(parts) >= 4 && parts[0] == "Library" && parts[1] == "Application Support":
+		return parts[2], path.Join(parts[:3]...)
+	case len(parts) >= 2 && strings.HasPrefix(parts[0], "."):
+		// Tool directories such as ~/.ssh or ~/.vim.
+		return strings.TrimPrefix(parts[0], "."), parts[0]
+	case len(parts) == 1 && strings.HasPrefix(parts[0], "."):
+		name := strings.TrimPrefix(parts[0], ".")
+		if i := strings.IndexAny(name, "._"); i > 0 {
+			name = name[:i]
+		}
+		for _, suffix := range []string{"rc", "config"} {
+			if strings.HasSuffix(name, suffix) && name != suffix {
+				name = strings.TrimSuffix(name, suffix)
+				break
+			}
+		}
+		return name, parts[0]
+	}
+	return "", ""
+}
+
+// AppInstalled reports whether app is on PATH or, on macOS, present as an
+// application bundle in /Applications or ~/Applications.
+func AppInstalled(home string) func(app string) bool {
+	return func(app string) bool {
+		for _, name := range []string{app, strings.ToLower(app)} {
+			if _, err := exec.LookPath(name); err == nil {
+				return true
+			}
+		}
+		if runtime.GOOS != "darwin" {
+			return false
+		}
+		for _, dir := range []string{"/Applications", filepath.Join(home, "Applications")} {
+			if _, err := os.Stat(filepath.Join(dir, app+".app")); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+}
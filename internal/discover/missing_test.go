@@ -0,0 +1,80 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/native"
+)
+
+func TestAppForTarget(t *testing.T) {
+	tests := []struct {
+		rel, app, root string
+	}{
+		{".config/nvim/init.lua", "nvim", ".config/nvim"},
+		{".config/starship.toml", "starship", ".config/starship.toml"},
+		{"Library/Application Support/Code/User/settings.json", "Code", "Library/Application Support/Code"},
+		{".ssh/config", "ssh", ".ssh"},
+		{".tmux.conf", "tmux", ".tmux.conf"},
+		{".zshrc", "zsh", ".zshrc"},
+		{".gitconfig", "git", ".gitconfig"},
+		{".bash_profile", "bash", ".bash_profile"},
+		{"notes.txt", "", ""},
+	}
+	for _, tt := range tests {
+		app, root := appForTarget(tt.rel)
+		if app != tt.app || root != tt.root {
+			t.Errorf("appForTarget(%q) = %q, %q; want %q, %q", tt.rel, app, root, tt.app, tt.root)
+		}
+	}
+}
+
+func TestFindMissingAppsSuggestsApplyOnly(t *testing.T) {
+	repo, home := t.TempDir(), t.TempDir()
+	writeTestFiles(t, repo, map[string]string{
+		"home/dot_config/nvim/init.lua":      "vim.o.number = true\n",
+		"home/dot_config/nvim/lua/keys.lua":  "return {}\n",
+		"home/dot_config/kitty/kitty.conf":   "font_size 12\n",
+		"home/dot_config/helix/config.toml":  "theme = \"base16\"\n",
+		"home/dot_tmux.conf":                 "set -g mouse on\n",
+		"home/dot_config/unknown/config.ini": "x = 1\n",
+	})
+	writeTestFiles(t, home, map[string]string{
+		".config/nvim/lua/keys.lua":  "return {}\n",
+		".config/kitty/kitty.conf":   "font_size 14\n",
+		".config/helix/config.toml":  "theme = \"base16\"\n",
+		".config/unknown/config.ini": "x = 1\n",
+	})
+	installed := map[string]bool{"nvim": true, "kitty": true, "helix": true, "tmux": true}
+
+	apps, err := FindMissingApps(context.Background(), native.New(home, native.ModeCopy), repo, "home", home,
+		func(app string) bool { return installed[app] })
+	if err != nil {
+		t.Fatalf("FindMissingApps: %v", err)
+	}
+	var got []string
+	for _, app := range apps {
+		got = append(got, app.App+":"+strings.Join(app.Missing, ",")+"|"+strings.Join(app.Unapplied, ","))
+	}
+	want := []string{
+		"kitty:|~/.config/kitty/kitty.conf",
+		"nvim:~/.config/nvim/init.lua|",
+		"tmux:~/.tmux.conf|",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("apps = %v, want %v", got, want)
+	}
+
+	var out bytes.Buffer
+	NewPrompterWithIO(strings.NewReader(""), &out, false).PrintMissingApps(apps)
+	if !strings.Contains(out.String(), "run: dot apply --only ~/.config/nvim\n") {
+		t.Fatalf("output missing apply suggestion:\n%s", out.String())
+	}
+
+	spaced := MissingApp{Root: "~/Library/Application Support/Code"}
+	if got := spaced.ApplyCommand(); got != "dot apply --only '~/Library/Application Support/Code'" {
+		t.Fatalf("ApplyCommand = %q", got)
+	}
+}
@@ -0,0 +1,202 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// Pending is the machine-local record of scheduled discovery passes: the
+// high-confidence candidates the last pass found, awaiting triage with
+// dot discover. Scheduled passes never add files themselves.
+type Pending struct {
+	LastRun    time.Time          `json:"last_run"`
+	Candidates []PendingCandidate `json:"candidates"`
+}
+
+// PendingCandidate is one recommended file found by a scheduled pass.
+type PendingCandidate struct {
+	RelPath string    `json:"rel_path"`
+	Score   int       `json:"score"`
+	Reasons []string  `json:"reasons,omitempty"`
+	FoundAt time.Time `json:"found_at"`
+	// Announced records that a notification already covered this file.
+	Announced bool `json:"announced,omitempty"`
+}
+
+// LoadPending reads the pending report; a missing file yields an empty one.
+func LoadPending(path string) (*Pending, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Pending{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read pending discovery report: %w", err)
+	}
+	var pending Pending
+	if err := json.Unmarshal(b, &pending); err != nil {
+		return nil, fmt.Errorf("parse pending discovery report: %w", err)
+	}
+	return &pending, nil
+}
+
+// Save writes the pending report, creating its directory.
+func (p *Pending) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create pending discovery directory: %w", err)
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// Due reports whether a scheduled pass should run at now for interval.
+func (p *Pending) Due(interval time.Duration, now time.Time) bool {
+	if interval <= 0 {
+		return false
+	}
+	return p.LastRun.IsZero() || !now.Before(p.LastRun.Add(interval))
+}
+
+// Record replaces the pending candidates with the recommended ones in
+// candidates, keeping the first-seen time of any already pending, and
+// returns those that were not pending before.
+func (p *Pending) Record(candidates CandidateList, now time.Time) []PendingCandidate {
+	known := make(map[string]PendingCandidate, len(p.Candidates))
+	for _, c := range p.Candidates {
+		known[platform.NormalizeUnicode(c.RelPath)] = c
+	}
+	var current, found []PendingCandidate
+	for _, c := range candidates.ByCategory(CategoryRecommended) {
+		if c.IsSubRepo {
+			continue
+		}
+		pc := PendingCandidate{RelPath: c.RelPath, Score: c.Score, Reasons: c.Reasons, FoundAt: now}
+		if prev, ok := known[c.RelPath]; ok {
+			pc.FoundAt, pc.Announced = prev.FoundAt, prev.Announced
+		} else {
+			found = append(found, pc)
+		}
+		current = append(current, pc)
+	}
+	sort.Slice(current, func(i, j int) bool { return current[i].RelPath < current[j].RelPath })
+	p.Candidates = current
+	p.LastRun = now
+	return found
+}
+
+// Notify delivers a scheduled discovery summary, returning any per-channel
+// delivery failures.
+type Notify func(ctx context.Context, title, message string, candidates []PendingCandidate) []error
+
+// ScheduledOptions configures RunScheduled.
+type ScheduledOptions struct {
+	StatePath string
+	Interval  time.Duration
+	// Host names this machine in notification messages.
+	Host string
+	// Scan runs one quiet discovery pass.
+	Scan func(ctx context.Context) (CandidateList, error)
+	// Notify, when set, is sent the pending candidates no earlier
+	// notification covered.
+	Notify Notify
+	Now    func() time.Time
+}
+
+// ScheduledResult reports what a scheduled discovery pass did.
+type ScheduledResult struct {
+	Ran     bool
+	Pending *Pending
+	// New lists candidates the previous pass had not recorded.
+	New []PendingCandidate
+	// NotifyErrors holds delivery failures; they do not fail the pass.
+	NotifyErrors []error
+}
+
+// RunScheduled runs a discovery pass when due and records its recommended
+// candidates in the pending report.
+func RunScheduled(ctx context.Context, opts ScheduledOptions) (*ScheduledResult, error) {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	result := &ScheduledResult{}
+	pending, err := LoadPending(opts.StatePath)
+	if err != nil {
+		return result, err
+	}
+	result.Pending = pending
+	if !pending.Due(opts.Interval, now()) {
+		return result, nil
+	}
+
+	candidates, err := opts.Scan(ctx)
+	if err != nil {
+		return result, fmt.Errorf("scheduled discovery: %w", err)
+	}
+	result.Ran = true
+	result.New = pending.Record(candidates, now().UTC())
+	if opts.Notify != nil {
+		result.NotifyErrors = announce(ctx, pending, opts)
+	}
+	if err := pending.Save(opts.StatePath); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// announce notifies about pending candidates that no earlier notification
+// covered. They are only marked announced once every channel delivered, so
+// a failed webhook is retried on the next pass.
+func announce(ctx context.Context, pending *Pending, opts ScheduledOptions) []error {
+	var fresh []PendingCandidate
+	for _, c := range pending.Candidates {
+		if !c.Announced {
+			fresh = append(fresh, c)
+		}
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+	host := opts.Host
+	if host == "" {
+		host = "this machine"
+	}
+	message := fmt.Sprintf("%d new recommended config(s) found on %s; run dot discover --pending to triage.", len(fresh), host)
+	if errs := opts.Notify(ctx, "dotstate discovery", message, fresh); len(errs) > 0 {
+		return errs
+	}
+	for i := range pending.Candidates {
+		pending.Candidates[i].Announced = true
+	}
+	return nil
+}
+
+// ScanRecommended runs a quiet scan for RunScheduled: covered files are
+// set aside and secret-bearing files are downgraded, so only candidates an
+// interactive run would pre-select remain recommended.
+func (d *Discoverer) ScanRecommended(ctx context.Context, opts Options) (CandidateList, error) {
+	opts, err := normalizeOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	result, err := d.scanner.Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+	d.markCovered(result)
+	if opts.SecretsMode != SecretsModeIgnore {
+		if err := d.secrets.UpdateCandidates(ctx, result.Candidates); err != nil {
+			return nil, fmt.Errorf("secret scan failed: %w", err)
+		}
+	}
+	return result.Candidates.ByCategory(CategoryRecommended), nil
+}
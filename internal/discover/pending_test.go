@@ -0,0 +1,115 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunScheduledRecordsRecommendedCandidates(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "audit", "discover.json")
+	now := time.Date(2026, 5, 13, 9, 0, 0, 0, time.UTC)
+	found := CandidateList{
+		{RelPath: "~/.config/ghostty/config", Category: CategoryRecommended, Score: 80},
+		{RelPath: "~/.config/app/state.json", Category: CategoryMaybe, Score: 20},
+		{RelPath: "~/.netrc", Category: CategoryRisky, Score: 60},
+	}
+	scans := 0
+	opts := ScheduledOptions{
+		StatePath: statePath,
+		Interval:  24 * time.Hour,
+		Scan: func(context.Context) (CandidateList, error) {
+			scans++
+			return found, nil
+		},
+		Now: func() time.Time { return now },
+	}
+
+	result, err := RunScheduled(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("RunScheduled: %v", err)
+	}
+	if !result.Ran || len(result.New) != 1 || result.New[0].RelPath != "~/.config/ghostty/config" {
+		t.Fatalf("first pass = %#v", result)
+	}
+
+	now = now.Add(time.Hour)
+	if result, err = RunScheduled(context.Background(), opts); err != nil || result.Ran || scans != 1 {
+		t.Fatalf("pass before interval ran: %#v, %v (scans %d)", result, err, scans)
+	}
+
+	now = now.Add(24 * time.Hour)
+	found = append(found, &Candidate{RelPath: "~/.config/kitty/kitty.conf", Category: CategoryRecommended, Score: 70})
+	result, err = RunScheduled(context.Background(), opts)
+	if err != nil || !result.Ran || len(result.New) != 1 || result.New[0].RelPath != "~/.config/kitty/kitty.conf" {
+		t.Fatalf("second pass = %#v, %v", result, err)
+	}
+
+	pending, err := LoadPending(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending.Candidates) != 2 || !pending.Candidates[0].FoundAt.Equal(time.Date(2026, 5, 13, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("pending = %#v, want both with the first-seen time kept", pending.Candidates)
+	}
+
+	var out bytes.Buffer
+	NewPrompterWithIO(strings.NewReader(""), &out, false).PrintPending(pending)
+	if !strings.Contains(out.String(), "=== Pending recommended (2) ===") || !strings.Contains(out.String(), "~/.config/kitty/kitty.conf") {
+		t.Fatalf("pending report:\n%s", out.String())
+	}
+}
+
+func TestRunScheduledNotifiesUntilDelivered(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "discover.json")
+	now := time.Date(2026, 5, 13, 9, 0, 0, 0, time.UTC)
+	var messages []string
+	var fail error
+	opts := ScheduledOptions{
+		StatePath: statePath,
+		Interval:  time.Hour,
+		Host:      "studio",
+		Scan: func(context.Context) (CandidateList, error) {
+			return CandidateList{
+				{RelPath: "~/.config/ghostty/config", Category: CategoryRecommended},
+				{RelPath: "~/.config/kitty/kitty.conf", Category: CategoryRecommended},
+				{RelPath: "~/.config/helix/config.toml", Category: CategoryRecommended},
+			}, nil
+		},
+		Notify: func(_ context.Context, title, message string, candidates []PendingCandidate) []error {
+			messages = append(messages, message)
+			if fail != nil {
+				return []error{fail}
+			}
+			return nil
+		},
+		Now: func() time.Time { return now },
+	}
+
+	fail = errors.New("webhook returned 500")
+	result, err := RunScheduled(context.Background(), opts)
+	if err != nil || len(result.NotifyErrors) != 1 {
+		t.Fatalf("failing pass = %#v, %v", result, err)
+	}
+
+	fail = nil
+	now = now.Add(time.Hour)
+	if result, err = RunScheduled(context.Background(), opts); err != nil || len(result.NotifyErrors) != 0 {
+		t.Fatalf("retry pass = %#v, %v", result, err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := RunScheduled(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("notifications = %q, want the failed one and its retry only", messages)
+	}
+	if messages[1] != "3 new recommended config(s) found on studio; run dot discover --pending to triage." {
+		t.Fatalf("message = %q", messages[1])
+	}
+}
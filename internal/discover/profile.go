@@ -0,0 +1,152 @@
+package discover
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+// Profile stages, in pipeline order.
+const (
+	ProfileStageExclude  = "exclusion rules"
+	ProfileStageSubRepo  = "sub-repo detection"
+	ProfileStageRisky    = "classify: risky check"
+	ProfileStageScore    = "classify: scoring"
+	ProfileStageCovered  = "covered check"
+	ProfileStageDrift    = "drift check"
+	ProfileStageSecrets  = "secret scan"
+	profileTopExclusions = 20
+)
+
+var profileStageOrder = []string{
+	ProfileStageExclude,
+	ProfileStageSubRepo,
+	ProfileStageRisky,
+	ProfileStageScore,
+	ProfileStageCovered,
+	ProfileStageDrift,
+	ProfileStageSecrets,
+}
+
+// Profile records where a discover pass spends its time: per scan root,
+// per pipeline stage, and per secret pattern, plus how many paths each
+// exclusion rule skipped. A nil *Profile records nothing, so the scanner
+// calls it unconditionally.
+type Profile struct {
+	// Roots holds each scanned root's wall time, in scan order.
+	Roots []RootTiming
+	// Stages is the total time spent in each stage.
+	Stages map[string]time.Duration
+	// Patterns is the time each secret pattern spent matching and masking.
+	Patterns map[string]time.Duration
+	// Excluded counts paths each exclusion rule skipped, e.g.
+	// "dir node_modules" or "ignore *.bak".
+	Excluded map[string]int
+}
+
+// RootTiming is one scan root's wall time.
+type RootTiming struct {
+	Root     string
+	Duration time.Duration
+}
+
+// NewProfile returns an empty profile.
+func NewProfile() *Profile {
+	return &Profile{
+		Stages:   make(map[string]time.Duration),
+		Patterns: make(map[string]time.Duration),
+		Excluded: make(map[string]int),
+	}
+}
+
+// start returns the time a measurement begins, or the zero time when
+// profiling is off.
+func (p *Profile) start() time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (p *Profile) stage(name string, since time.Time) {
+	if p != nil {
+		p.Stages[name] += time.Since(since)
+	}
+}
+
+func (p *Profile) pattern(name string, since time.Time) {
+	if p != nil {
+		p.Patterns[name] += time.Since(since)
+	}
+}
+
+func (p *Profile) root(root string, since time.Time) {
+	if p != nil {
+		p.Roots = append(p.Roots, RootTiming{Root: root, Duration: time.Since(since)})
+	}
+}
+
+func (p *Profile) exclude(rule string) {
+	if p != nil {
+		p.Excluded[rule]++
+	}
+}
+
+// Write prints the profile: roots in scan order, stages in pipeline order,
+// and the slowest patterns and busiest exclusion rules first.
+func (p *Profile) Write(w io.Writer, home string) {
+	fmt.Fprintln(w, "=== Profile ===")
+	fmt.Fprintln(w, "Roots:")
+	for _, r := range p.Roots {
+		fmt.Fprintf(w, "  %10s  %s\n", roundDuration(r.Duration), redact.Text(relPath(r.Root, home)))
+	}
+	fmt.Fprintln(w, "Stages:")
+	for _, name := range profileStageOrder {
+		if d, ok := p.Stages[name]; ok {
+			fmt.Fprintf(w, "  %10s  %s\n", roundDuration(d), name)
+		}
+	}
+	if len(p.Patterns) > 0 {
+		fmt.Fprintln(w, "Secret patterns:")
+		for _, name := range sortedByValue(p.Patterns) {
+			fmt.Fprintf(w, "  %10s  %s\n", roundDuration(p.Patterns[name]), name)
+		}
+	}
+	if len(p.Excluded) > 0 {
+		fmt.Fprintln(w, "Exclusions (paths skipped per rule):")
+		rules := sortedByValue(p.Excluded)
+		for i, rule := range rules {
+			if i == profileTopExclusions {
+				fmt.Fprintf(w, "  ... and %d more rules\n", len(rules)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %10d  %s\n", p.Excluded[rule], redact.Text(rule))
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// sortedByValue returns m's keys, largest value first, ties by key.
+func sortedByValue[V int | time.Duration](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -10,110 +10,114 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/diffstat"
+	"github.com/dnery/dotstate/dot/internal/i18n"
 	"github.com/dnery/dotstate/dot/internal/redact"
+	"github.com/dnery/dotstate/dot/internal/ui"
 )
 
 // Prompter handles user interaction for file selection.
 type Prompter struct {
-	in      io.Reader
-	out     io.Writer
-	autoYes bool
+	in          io.Reader
+	out         io.Writer
+	autoYes     bool
+	interactive bool
 }
 
-// NewPrompter creates a new prompter.
+// NewPrompter creates a new prompter on stdin and stdout. It is interactive
+// only when both are terminals.
 func NewPrompter(autoYes bool) *Prompter {
 	return &Prompter{
-		in:      os.Stdin,
-		out:     os.Stdout,
-		autoYes: autoYes,
+		in:          os.Stdin,
+		out:         os.Stdout,
+		autoYes:     autoYes,
+		interactive: isTerminal(os.Stdin) && isTerminal(os.Stdout),
 	}
 }
 
-// NewPrompterWithIO creates a prompter with custom I/O (for testing).
+// NewPrompterWithIO creates a prompter with custom I/O (for testing). It is
+// always treated as interactive.
 func NewPrompterWithIO(in io.Reader, out io.Writer, autoYes bool) *Prompter {
 	return &Prompter{
-		in:      in,
-		out:     out,
-		autoYes: autoYes,
+		in:          in,
+		out:         out,
+		autoYes:     autoYes,
+		interactive: true,
 	}
 }
 
+// Interactive reports whether prompts can be answered; reading from a
+// pipe, /dev/null, or a cron job's closed stdin cannot.
+func (p *Prompter) Interactive() bool {
+	return p.interactive
+}
+
+// nonInteractiveFallback applies opts.NonInteractive when nobody can answer
+// prompts, so discover never blocks waiting on input under cron.
+func (p *Prompter) nonInteractiveFallback(opts Options) Options {
+	if opts.NonInteractive == NonInteractiveYes {
+		fmt.Fprintln(p.out, i18n.T("discover.nontty_yes"))
+		opts.AutoYes = true
+		p.autoYes = true
+		return opts
+	}
+	fmt.Fprintln(p.out, i18n.T("discover.nontty_report"))
+	opts.ReportOnly = true
+	return opts
+}
+
+// isTerminal reports whether f is a character device such as a TTY.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // SelectCandidates prompts the user to select candidates to add.
 // Returns the list of selected candidates.
 func (p *Prompter) SelectCandidates(ctx context.Context, result *Result) ([]*Candidate, error) {
 	if len(result.Candidates) == 0 {
-		fmt.Fprintln(p.out, "No candidates found.")
+		p.printCoveredSummary(result)
+		fmt.Fprintln(p.out, i18n.T("discover.no_candidates"))
 		return nil, nil
 	}
 
 	// Print summary
 	summary := result.Summary()
-	fmt.Fprintln(p.out, "\nDiscovery Review TUI")
-	fmt.Fprintln(p.out, "Recommended items are pre-selected; Maybe items need review; Risky items may contain secrets; ignored items are summarized below.")
-	fmt.Fprintln(p.out, "Non-file macOS state is better handled by dot macos audit --json and future module capture flows.")
-	fmt.Fprintf(p.out, "\nDiscovered %d candidates:\n", len(result.Candidates))
+	fmt.Fprintln(p.out, "\n"+i18n.T("discover.review_title"))
+	fmt.Fprintln(p.out, i18n.T("discover.review_intro"))
+	fmt.Fprintln(p.out, i18n.T("discover.review_modules"))
+	fmt.Fprintf(p.out, "\n"+i18n.T("discover.discovered")+"\n", len(result.Candidates))
 	if count := summary[CategoryRecommended]; count > 0 {
-		fmt.Fprintf(p.out, "  Recommended: %d\n", count)
+		fmt.Fprintln(p.out, i18n.T("discover.count_recommended", count))
 	}
 	if count := summary[CategoryMaybe]; count > 0 {
-		fmt.Fprintf(p.out, "  Maybe: %d\n", count)
+		fmt.Fprintln(p.out, i18n.T("discover.count_maybe", count))
 	}
 	if count := summary[CategoryRisky]; count > 0 {
-		fmt.Fprintf(p.out, "  Risky: %d\n", count)
+		fmt.Fprintln(p.out, i18n.T("discover.count_risky", count))
 	}
 	if len(result.SubRepos) > 0 {
-		fmt.Fprintf(p.out, "  Sub-repos: %d\n", len(result.SubRepos))
+		fmt.Fprintln(p.out, i18n.T("discover.count_subrepos", len(result.SubRepos)))
 	}
 	fmt.Fprintln(p.out)
 	p.printIgnoredSummary(result)
+	p.printCoveredSummary(result)
 
 	// Group candidates by category
 	recommended := result.Candidates.ByCategory(CategoryRecommended)
 	maybe := result.Candidates.ByCategory(CategoryMaybe)
 	risky := result.Candidates.ByCategory(CategoryRisky)
 
-	// Build selection
+	// Pre-select recommended; Maybe and Risky items need review.
 	selected := make(map[int]*Candidate)
-	index := 1
-
-	// Print and pre-select recommended
-	if len(recommended) > 0 {
-		fmt.Fprintln(p.out, "=== Recommended (pre-selected) ===")
-		for _, c := range recommended {
-			prefix := "[x]"
-			selected[index] = c
-			p.printCandidate(index, c, prefix)
-			index++
-		}
-		fmt.Fprintln(p.out)
-	}
-
-	// Print maybe (not pre-selected)
-	maybeStart := index
-	if len(maybe) > 0 {
-		fmt.Fprintln(p.out, "=== Maybe ===")
-		for _, c := range maybe {
-			p.printCandidate(index, c, "[ ]")
-			index++
-		}
-		fmt.Fprintln(p.out)
-	}
-
-	// Print risky (not pre-selected, with warnings)
-	riskyStart := index
-	if len(risky) > 0 {
-		fmt.Fprintln(p.out, "=== Risky (may contain secrets) ===")
-		for _, c := range risky {
-			p.printCandidate(index, c, "[ ]")
-			if len(c.SecretWarnings) > 0 {
-				for _, w := range c.SecretWarnings {
-					fmt.Fprintf(p.out, "       WARNING: %s\n", redact.Text(w))
-				}
-			}
-			index++
-		}
-		fmt.Fprintln(p.out)
+	for i, c := range recommended {
+		selected[i+1] = c
 	}
+	maybeStart := len(recommended) + 1
+	riskyStart := maybeStart + len(maybe)
+	var view reviewView
+	p.printSections(view, selected, recommended, maybe, risky)
 
 	// Auto-yes mode: return pre-selected (recommended) items
 	if p.autoYes {
@@ -121,26 +125,19 @@ func (p *Prompter) SelectCandidates(ctx context.Context, result *Result) ([]*Can
 		for _, c := range selected {
 			items = append(items, c)
 		}
-		fmt.Fprintf(p.out, "Auto-selecting %d recommended items.\n", len(items))
+		fmt.Fprintf(p.out, i18n.T("discover.auto_selecting")+"\n", len(items))
 		return items, nil
 	}
 
 	// Interactive selection
-	fmt.Fprintln(p.out, "Discovery review commands:")
-	fmt.Fprintln(p.out, "  Enter  - Accept current selection")
-	fmt.Fprintln(p.out, "  a      - Select all")
-	fmt.Fprintln(p.out, "  n      - Select none")
-	fmt.Fprintln(p.out, "  1,2,3  - Toggle specific items")
-	fmt.Fprintln(p.out, "  +5     - Add item 5")
-	fmt.Fprintln(p.out, "  -5     - Remove item 5")
-	fmt.Fprintln(p.out, "  q      - Quit without adding")
+	fmt.Fprintln(p.out, i18n.T("discover.commands_help"))
 	fmt.Fprintln(p.out)
 
 	scanner := bufio.NewScanner(p.in)
 
 	for {
 		// Show current selection count
-		fmt.Fprintf(p.out, "Selected: %d items. Command: ", len(selected))
+		fmt.Fprintf(p.out, i18n.T("discover.command_prompt"), len(selected))
 
 		if !scanner.Scan() {
 			break
@@ -158,7 +155,7 @@ func (p *Prompter) SelectCandidates(ctx context.Context, result *Result) ([]*Can
 			return items, nil
 
 		case "q", "quit", "exit":
-			fmt.Fprintln(p.out, "Cancelled.")
+			fmt.Fprintln(p.out, i18n.T("discover.cancelled"))
 			return nil, nil
 
 		case "a", "all":
@@ -176,14 +173,36 @@ func (p *Prompter) SelectCandidates(ctx context.Context, result *Result) ([]*Can
 				selected[idx] = c
 				idx++
 			}
-			fmt.Fprintf(p.out, "Selected all %d items.\n", len(selected))
+			fmt.Fprintf(p.out, i18n.T("discover.selected_all")+"\n", len(selected))
+
+		case "collapse", "expand":
+			view.collapsed = strings.ToLower(input) == "collapse"
+			selected = p.relist(view, selected, recommended, maybe, risky)
 
 		case "n", "none":
 			// Select none
 			selected = make(map[int]*Candidate)
-			fmt.Fprintln(p.out, "Cleared selection.")
+			fmt.Fprintln(p.out, i18n.T("discover.cleared"))
 
 		default:
+			if list, start, add, ok := categoryCommand(strings.ToLower(input), recommended, maybe, risky, maybeStart, riskyStart); ok {
+				p.selectCategory(selected, list, start, add)
+				continue
+			}
+			if key, ok := strings.CutPrefix(strings.ToLower(input), "sort "); ok {
+				key = strings.TrimSpace(key)
+				if sortOrders[key] == nil {
+					fmt.Fprintln(p.out, i18n.T("discover.sort_usage"))
+					continue
+				}
+				view.sortBy = key
+				selected = p.relist(view, selected, recommended, maybe, risky)
+				continue
+			}
+			if rest, ok := strings.CutPrefix(strings.ToLower(input), "attr "); ok {
+				p.parseAttributes(rest, recommended, maybe, risky, maybeStart, riskyStart)
+				continue
+			}
 			// Parse number-based commands
 			p.parseSelection(input, selected, recommended, maybe, risky, maybeStart, riskyStart)
 		}
@@ -192,12 +211,37 @@ func (p *Prompter) SelectCandidates(ctx context.Context, result *Result) ([]*Can
 	return nil, scanner.Err()
 }
 
+// printWarning prints a secret warning; continuation lines, such as the
+// masked context around a match, are indented beneath it.
+func (p *Prompter) printWarning(w string) {
+	first, rest, _ := strings.Cut(w, "\n")
+	fmt.Fprintln(p.out, i18n.T("discover.warning", redact.Text(first)))
+	if rest == "" {
+		return
+	}
+	for _, line := range strings.Split(rest, "\n") {
+		fmt.Fprintf(p.out, "         %s\n", redact.Text(line))
+	}
+}
+
+// printCoveredSummary lists files whose contents are already managed.
+func (p *Prompter) printCoveredSummary(result *Result) {
+	if result == nil || len(result.Covered) == 0 {
+		return
+	}
+	fmt.Fprintln(p.out, i18n.T("discover.covered", len(result.Covered)))
+	for _, c := range result.Covered {
+		fmt.Fprintf(p.out, "  %s = %s\n", redact.Text(c.RelPath), redact.Text(c.CoveredBy))
+	}
+	fmt.Fprintln(p.out)
+}
+
 // printCandidate prints a single candidate line.
 func (p *Prompter) printIgnoredSummary(result *Result) {
 	if result == nil || len(result.Ignored) == 0 {
 		return
 	}
-	fmt.Fprintln(p.out, "Ignored by default:")
+	fmt.Fprintln(p.out, i18n.T("discover.ignored"))
 	reasons := make([]string, 0, len(result.Ignored))
 	for reason := range result.Ignored {
 		reasons = append(reasons, reason)
@@ -206,14 +250,14 @@ func (p *Prompter) printIgnoredSummary(result *Result) {
 	for _, reason := range reasons {
 		fmt.Fprintf(p.out, "  %s: %d\n", redact.Text(reason), result.Ignored[reason])
 	}
-	fmt.Fprintln(p.out, "  Tip: use --deep or --roots for explicit broad scans; non-file macOS state is better handled by dot macos audit --json.")
+	fmt.Fprintln(p.out, i18n.T("discover.ignored_tip"))
 	fmt.Fprintln(p.out)
 }
 
 func (p *Prompter) printCandidate(index int, c *Candidate, prefix string) {
 	typeStr := ""
 	if c.IsSubRepo {
-		typeStr = " [repo]"
+		typeStr = " [" + i18n.T("discover.kind_repo") + "]"
 	}
 
 	sizeStr := ""
@@ -226,7 +270,12 @@ func (p *Prompter) printCandidate(index int, c *Candidate, prefix string) {
 		reasons = " - " + redact.Text(strings.Join(c.Reasons, ", "))
 	}
 
-	fmt.Fprintf(p.out, "  %s %3d. %s%s%s%s\n", prefix, index, redact.Text(c.RelPath), typeStr, sizeStr, reasons)
+	attrStr := ""
+	if !c.Attributes.IsZero() {
+		attrStr = fmt.Sprintf(" [%s]", c.Attributes)
+	}
+
+	fmt.Fprintf(p.out, "  %s %3d. %s%s%s%s%s\n", prefix, index, redact.Text(c.RelPath), typeStr, attrStr, sizeStr, reasons)
 }
 
 // parseSelection parses a selection input and updates the selected map.
@@ -241,7 +290,8 @@ func (p *Prompter) parseSelection(input string, selected map[int]*Candidate,
 			continue
 		}
 
-		// Handle +N (add), -N (remove), or bare N (toggle) syntax.
+		// Handle +N (add), -N (remove), or bare N (toggle) syntax; N may
+		// also be an inclusive range such as 3-12.
 		add := true
 		explicitAction := false
 		if strings.HasPrefix(part, "+") {
@@ -253,39 +303,144 @@ func (p *Prompter) parseSelection(input string, selected map[int]*Candidate,
 			explicitAction = true
 		}
 
-		num, err := strconv.Atoi(part)
-		if err != nil {
+		lo, hi, ok := parseItemRange(part)
+		if !ok {
 			continue
 		}
-
-		// Find the candidate by index
-		var candidate *Candidate
-		if num >= 1 && num < maybeStart && num <= len(recommended) {
-			candidate = recommended[num-1]
-		} else if num >= maybeStart && num < riskyStart && num-maybeStart < len(maybe) {
-			candidate = maybe[num-maybeStart]
-		} else if num >= riskyStart && num-riskyStart < len(risky) {
-			candidate = risky[num-riskyStart]
+		if lo > hi {
+			fmt.Fprintf(p.out, i18n.T("discover.invalid_range")+"\n", lo, hi)
+			continue
 		}
-
-		if candidate == nil {
-			fmt.Fprintf(p.out, "Invalid item number: %d\n", num)
+		if lo != hi && (candidateAt(lo, recommended, maybe, risky, maybeStart, riskyStart) == nil ||
+			candidateAt(hi, recommended, maybe, risky, maybeStart, riskyStart) == nil) {
+			fmt.Fprintf(p.out, i18n.T("discover.invalid_range")+"\n", lo, hi)
 			continue
 		}
 
-		if !explicitAction {
-			_, alreadySelected := selected[num]
-			add = !alreadySelected
+		for num := lo; num <= hi; num++ {
+			candidate := candidateAt(num, recommended, maybe, risky, maybeStart, riskyStart)
+			if candidate == nil {
+				fmt.Fprintf(p.out, i18n.T("discover.invalid_item")+"\n", num)
+				continue
+			}
+
+			include := add
+			if !explicitAction {
+				_, alreadySelected := selected[num]
+				include = !alreadySelected
+			}
+
+			if include {
+				selected[num] = candidate
+				fmt.Fprintln(p.out, i18n.T("discover.added", redact.Text(candidate.RelPath)))
+			} else {
+				delete(selected, num)
+				fmt.Fprintln(p.out, i18n.T("discover.removed", redact.Text(candidate.RelPath)))
+			}
 		}
+	}
+}
+
+// categoryCommand resolves "rec", "maybe", or "risky", optionally prefixed
+// with + (select) or - (deselect), to that category's items and the item
+// number of its first entry.
+func categoryCommand(input string, recommended, maybe, risky CandidateList, maybeStart, riskyStart int) (CandidateList, int, bool, bool) {
+	add := true
+	if rest, ok := strings.CutPrefix(input, "-"); ok {
+		input, add = rest, false
+	} else {
+		input = strings.TrimPrefix(input, "+")
+	}
+	switch input {
+	case "rec", "recommended":
+		return recommended, 1, add, true
+	case "maybe":
+		return maybe, maybeStart, add, true
+	case "risky":
+		return risky, riskyStart, add, true
+	}
+	return nil, 0, false, false
+}
 
+// selectCategory adds or removes every item of one category, leaving the
+// other categories' selections alone.
+func (p *Prompter) selectCategory(selected map[int]*Candidate, list CandidateList, start int, add bool) {
+	for i, c := range list {
 		if add {
-			selected[num] = candidate
-			fmt.Fprintf(p.out, "Added: %s\n", redact.Text(candidate.RelPath))
+			selected[start+i] = c
 		} else {
-			delete(selected, num)
-			fmt.Fprintf(p.out, "Removed: %s\n", redact.Text(candidate.RelPath))
+			delete(selected, start+i)
 		}
 	}
+	if add {
+		fmt.Fprintln(p.out, i18n.T("discover.selected_category", len(list)))
+	} else {
+		fmt.Fprintln(p.out, i18n.T("discover.deselected_category", len(list)))
+	}
+}
+
+// parseItemRange parses an item number "N" or an inclusive range "N-M".
+func parseItemRange(s string) (lo, hi int, ok bool) {
+	first, last, isRange := strings.Cut(s, "-")
+	lo, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return 0, 0, false
+	}
+	if !isRange {
+		return lo, lo, true
+	}
+	hi, err = strconv.Atoi(strings.TrimSpace(last))
+	if err != nil {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// parseAttributes handles "attr <items> <attributes>", setting the chezmoi
+// attributes used when the listed items are added.
+func (p *Prompter) parseAttributes(input string,
+	recommended, maybe, risky CandidateList, maybeStart, riskyStart int) {
+
+	fields := strings.Fields(input)
+	if len(fields) != 2 {
+		fmt.Fprintln(p.out, i18n.T("discover.attr_usage"))
+		return
+	}
+	attrs, err := chez.ParseAttributes(fields[1])
+	if err != nil {
+		fmt.Fprintln(p.out, i18n.T("discover.attr_invalid", err))
+		return
+	}
+	for _, part := range strings.Split(fields[0], ",") {
+		num, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		candidate := candidateAt(num, recommended, maybe, risky, maybeStart, riskyStart)
+		if candidate == nil || candidate.IsSubRepo {
+			fmt.Fprintf(p.out, i18n.T("discover.invalid_item")+"\n", num)
+			continue
+		}
+		candidate.Attributes = attrs
+		if attrs.IsZero() {
+			fmt.Fprintln(p.out, i18n.T("discover.attr_cleared", redact.Text(candidate.RelPath)))
+		} else {
+			fmt.Fprintln(p.out, i18n.T("discover.attr_set", attrs, redact.Text(candidate.RelPath)))
+		}
+	}
+}
+
+// candidateAt returns the candidate shown with item number num, or nil.
+func candidateAt(num int, recommended, maybe, risky CandidateList, maybeStart, riskyStart int) *Candidate {
+	switch {
+	case num >= 1 && num < maybeStart && num <= len(recommended):
+		return recommended[num-1]
+	case num >= maybeStart && num < riskyStart && num-maybeStart < len(maybe):
+		return maybe[num-maybeStart]
+	case num >= riskyStart && num-riskyStart < len(risky):
+		return risky[num-riskyStart]
+	}
+	return nil
 }
 
 // humanSize converts bytes to human-readable format.
@@ -302,13 +457,208 @@ func humanSize(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
+// largeCandidates returns the file candidates larger than threshold.
+func largeCandidates(candidates []*Candidate, threshold int64) []*Candidate {
+	var large []*Candidate
+	for _, c := range candidates {
+		if !c.IsSubRepo && threshold > 0 && c.Size > threshold {
+			large = append(large, c)
+		}
+	}
+	return large
+}
+
+// selectionSize returns the total size of the selected files.
+func selectionSize(candidates []*Candidate) int64 {
+	var total int64
+	for _, c := range candidates {
+		total += c.Size
+	}
+	return total
+}
+
+// ReviewLargeFiles asks what to do with each selected file over threshold:
+// route it through git-lfs, skip it, or keep it as a regular file. It
+// returns the selection without skipped files; auto-yes mode skips them.
+func (p *Prompter) ReviewLargeFiles(candidates []*Candidate, threshold int64, lfsAvailable bool) []*Candidate {
+	large := largeCandidates(candidates, threshold)
+	if len(large) == 0 {
+		return candidates
+	}
+
+	fmt.Fprintln(p.out, "\n"+i18n.T("discover.large_header",
+		len(large), humanSize(threshold), humanSize(selectionSize(large)), humanSize(selectionSize(candidates))))
+	for _, c := range large {
+		fmt.Fprintf(p.out, "  %s (%s)\n", redact.Text(c.RelPath), humanSize(c.Size))
+	}
+
+	skip := make(map[*Candidate]bool, len(large))
+	if p.autoYes {
+		for _, c := range large {
+			skip[c] = true
+		}
+		fmt.Fprintln(p.out, i18n.T("discover.large_auto_yes"))
+	} else {
+		choices := i18n.T("discover.large_choices")
+		if lfsAvailable {
+			choices = i18n.T("discover.large_choices_lfs")
+		} else {
+			fmt.Fprintln(p.out, i18n.T("discover.lfs_missing"))
+		}
+		scanner := bufio.NewScanner(p.in)
+		for _, c := range large {
+			fmt.Fprint(p.out, i18n.T("discover.large_prompt", redact.Text(c.RelPath), humanSize(c.Size), choices))
+			input := ""
+			if scanner.Scan() {
+				input = strings.ToLower(strings.TrimSpace(scanner.Text()))
+			}
+			switch {
+			case input == "l" || input == "lfs":
+				if lfsAvailable {
+					c.LFS = true
+					continue
+				}
+				skip[c] = true
+			case input == "k" || input == "keep":
+			default:
+				skip[c] = true
+			}
+		}
+	}
+
+	kept := make([]*Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if !skip[c] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// ReviewDrifted shows how each already-managed file differs from its
+// managed version and asks whether to update the managed version or keep
+// the repo version. Keeping is the default, and the only choice in
+// auto-yes mode. It returns the candidates to update.
+func (p *Prompter) ReviewDrifted(drifted []*Candidate) []*Candidate {
+	if len(drifted) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(p.out, "\n"+i18n.T("discover.drift_header", len(drifted)))
+	if p.autoYes {
+		for _, c := range drifted {
+			fmt.Fprintf(p.out, "  %s\n", redact.Text(c.RelPath))
+		}
+		fmt.Fprintln(p.out, i18n.T("discover.drift_auto_yes"))
+		return nil
+	}
+
+	fmt.Fprintln(p.out, i18n.T("discover.drift_legend"))
+	scanner := bufio.NewScanner(p.in)
+	var updates []*Candidate
+	for _, c := range drifted {
+		fmt.Fprintf(p.out, "\n%s\n", redact.Text(c.RelPath))
+		for _, w := range c.SecretWarnings {
+			p.printWarning(w)
+		}
+		fmt.Fprint(p.out, redact.Text(c.Drift))
+		fmt.Fprint(p.out, i18n.T("discover.drift_prompt"))
+		input := ""
+		if scanner.Scan() {
+			input = strings.ToLower(strings.TrimSpace(scanner.Text()))
+		}
+		if input == "u" || input == "update" {
+			updates = append(updates, c)
+		}
+	}
+	return updates
+}
+
+// ReviewSecrets shows each secret finding in the selected files and asks
+// whether to add the file anyway, skip it, or allowlist the finding so
+// later runs stop flagging it. Skipping is the default, and the only
+// choice in auto-yes mode. It returns the files to add and the allowlist
+// entries to record.
+func (p *Prompter) ReviewSecrets(candidates []*Candidate) ([]*Candidate, []string) {
+	var flagged []*Candidate
+	for _, c := range candidates {
+		if len(c.SecretFindings) > 0 {
+			flagged = append(flagged, c)
+		}
+	}
+	if len(flagged) == 0 {
+		return candidates, nil
+	}
+
+	fmt.Fprintln(p.out, "\n"+i18n.T("discover.secret_header", len(flagged)))
+	skip := make(map[*Candidate]bool, len(flagged))
+	var allow []string
+	if p.autoYes {
+		for _, c := range flagged {
+			skip[c] = true
+			fmt.Fprintf(p.out, "  %s\n", redact.Text(c.RelPath))
+		}
+		fmt.Fprintln(p.out, i18n.T("discover.secret_auto_yes"))
+	} else {
+		scanner := bufio.NewScanner(p.in)
+		for _, c := range flagged {
+			fmt.Fprintf(p.out, "\n%s\n", redact.Text(c.RelPath))
+			for _, f := range c.SecretFindings {
+				fmt.Fprintln(p.out, i18n.T("discover.secret_finding", redact.Text(f.PatternID), f.Confidence, f.Line))
+				for _, line := range f.FormatContext() {
+					fmt.Fprintf(p.out, "    %s\n", redact.Text(line))
+				}
+				if c.Templatable {
+					fmt.Fprint(p.out, i18n.T("discover.secret_prompt_template"))
+				} else {
+					fmt.Fprint(p.out, i18n.T("discover.secret_prompt"))
+				}
+				input := ""
+				if scanner.Scan() {
+					input = strings.ToLower(strings.TrimSpace(scanner.Text()))
+				}
+				if input == "a" || input == "add" {
+					continue
+				}
+				if c.Templatable && (input == "t" || input == "template") {
+					// Templating replaces every finding in the file, so
+					// the rest need no review.
+					c.Attributes.Template = true
+					break
+				}
+				if input == "l" || input == "allow" || input == "allowlist" {
+					allow = append(allow, allowlistEntry(f.PatternID, c.RelPath))
+					continue
+				}
+				skip[c] = true
+				break
+			}
+			if !skip[c] {
+				c.SecretsAllowed = true
+			}
+		}
+	}
+	return withoutSkipped(candidates, skip), allow
+}
+
+// withoutSkipped returns candidates minus those marked in skip.
+func withoutSkipped(candidates []*Candidate, skip map[*Candidate]bool) []*Candidate {
+	kept := make([]*Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if !skip[c] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
 // ConfirmAdd asks for confirmation before adding files.
 func (p *Prompter) ConfirmAdd(candidates []*Candidate) bool {
 	if p.autoYes {
 		return true
 	}
 
-	fmt.Fprintf(p.out, "\nAdd %d files to the repository? [Y/n] ", len(candidates))
+	fmt.Fprintf(p.out, "\n"+i18n.T("discover.confirm_add"), len(candidates), humanSize(selectionSize(candidates)))
 
 	scanner := bufio.NewScanner(p.in)
 	if !scanner.Scan() {
@@ -325,7 +675,7 @@ func (p *Prompter) ConfirmCommit() bool {
 		return true
 	}
 
-	fmt.Fprint(p.out, "Commit the changes? [Y/n] ")
+	fmt.Fprint(p.out, i18n.T("discover.confirm_commit"))
 
 	scanner := bufio.NewScanner(p.in)
 	if !scanner.Scan() {
@@ -336,23 +686,41 @@ func (p *Prompter) ConfirmCommit() bool {
 	return input == "" || input == "y" || input == "yes"
 }
 
+// PrintProfile prints the scan's timing profile.
+func (p *Prompter) PrintProfile(result *Result, home string) {
+	result.Profile.Write(p.out, home)
+}
+
 // PrintReport prints a non-interactive report of discovered candidates.
 func (p *Prompter) PrintReport(result *Result) {
-	fmt.Fprintf(p.out, "Scan completed in %v\n", result.ScanDuration)
-	fmt.Fprintf(p.out, "Scanned: %d directories, %d files\n", result.ScannedDirs, result.ScannedFiles)
+	fmt.Fprintf(p.out, i18n.T("discover.scan_completed")+"\n", result.ScanDuration)
+	fmt.Fprintln(p.out, i18n.T("discover.scanned", result.ScannedDirs, result.ScannedFiles))
 	fmt.Fprintln(p.out)
+	p.printCoveredSummary(result)
+
+	if len(result.Drifted) > 0 {
+		fmt.Fprintln(p.out, i18n.T("discover.drift_header", len(result.Drifted)))
+		for _, c := range result.Drifted {
+			totals := diffstat.Sum(diffstat.Parse(c.Drift))
+			fmt.Fprintf(p.out, "[%s] %s (+%d/-%d)\n", i18n.T("discover.kind_file"), redact.Text(c.RelPath), totals.Added, totals.Removed)
+			for _, w := range c.SecretWarnings {
+				p.printWarning(w)
+			}
+		}
+		fmt.Fprintln(p.out)
+	}
 
 	if len(result.Candidates) == 0 {
-		fmt.Fprintln(p.out, "No candidates found.")
+		fmt.Fprintln(p.out, i18n.T("discover.no_candidates"))
 		return
 	}
 
 	if len(result.Diagnostics) > 0 {
-		fmt.Fprintf(p.out, "=== Diagnostics (%d) ===\n", len(result.Diagnostics))
+		fmt.Fprintln(p.out, i18n.T("discover.diagnostics", len(result.Diagnostics)))
 		for _, diag := range result.Diagnostics {
 			fmt.Fprintf(p.out, "[%s] %s: %s\n", diag.Severity, redact.Text(diag.Code), redact.Text(diag.Message))
 			if diag.Remediation != "" {
-				fmt.Fprintf(p.out, "       remediation: %s\n", redact.Text(diag.Remediation))
+				fmt.Fprintln(p.out, i18n.T("discover.remediation", redact.Text(diag.Remediation)))
 			}
 		}
 		fmt.Fprintln(p.out)
@@ -366,29 +734,32 @@ func (p *Prompter) PrintReport(result *Result) {
 			continue
 		}
 
-		fmt.Fprintf(p.out, "=== %s (%d) ===\n", cat.String(), len(candidates))
+		fmt.Fprintln(p.out, i18n.T("discover.report_section", categoryName(cat), len(candidates)))
 		for _, c := range candidates {
-			typeStr := "file"
+			typeStr := i18n.T("discover.kind_file")
 			if c.IsSubRepo {
-				typeStr = "repo"
+				typeStr = i18n.T("discover.kind_repo")
 			} else if c.IsDir {
-				typeStr = "dir"
+				typeStr = i18n.T("discover.kind_dir")
 			}
 
-			fmt.Fprintf(p.out, "[%s] %s (score=%d, %s)\n",
-				typeStr, redact.Text(c.RelPath), c.Score, humanSize(c.Size))
+			fmt.Fprintln(p.out, i18n.T("discover.report_candidate",
+				typeStr, redact.Text(c.RelPath), c.Score, humanSize(c.Size)))
 
 			if len(c.Reasons) > 0 {
-				fmt.Fprintf(p.out, "       reasons: %s\n", redact.Text(strings.Join(c.Reasons, ", ")))
+				fmt.Fprintln(p.out, i18n.T("discover.reasons", redact.Text(strings.Join(c.Reasons, ", "))))
+			}
+			if !c.Attributes.IsZero() {
+				fmt.Fprintln(p.out, i18n.T("discover.attributes", c.Attributes))
 			}
 			if len(c.SecretWarnings) > 0 {
 				for _, w := range c.SecretWarnings {
-					fmt.Fprintf(p.out, "       WARNING: %s\n", redact.Text(w))
+					p.printWarning(w)
 				}
 			}
 			if c.IsSubRepo && c.SubRepoURL != "" {
 				url, _ := sanitizeGitRemoteURL(c.SubRepoURL)
-				fmt.Fprintf(p.out, "       remote: %s\n", redact.Text(url))
+				fmt.Fprintln(p.out, i18n.T("discover.remote", redact.Text(url)))
 			}
 		}
 		fmt.Fprintln(p.out)
@@ -396,11 +767,11 @@ func (p *Prompter) PrintReport(result *Result) {
 
 	// Print sub-repos summary
 	if len(result.SubRepos) > 0 {
-		fmt.Fprintf(p.out, "=== Sub-repositories (%d) ===\n", len(result.SubRepos))
+		fmt.Fprintln(p.out, i18n.T("discover.subrepos", len(result.SubRepos)))
 		for _, r := range result.SubRepos {
 			url := r.SubRepoURL
 			if url == "" {
-				url = "(local only)"
+				url = i18n.T("discover.local_only")
 			} else {
 				url, _ = sanitizeGitRemoteURL(url)
 			}
@@ -409,3 +780,71 @@ func (p *Prompter) PrintReport(result *Result) {
 		fmt.Fprintln(p.out)
 	}
 }
+
+// categoryName is the localized report heading for a category.
+func categoryName(c Category) string {
+	switch c {
+	case CategoryRecommended:
+		return i18n.T("discover.category_recommended")
+	case CategoryMaybe:
+		return i18n.T("discover.category_maybe")
+	case CategoryRisky:
+		return i18n.T("discover.category_risky")
+	}
+	return c.String()
+}
+
+// PrintReportJSON prints the report-only output as a JSON Report.
+func (p *Prompter) PrintReportJSON(result *Result) error {
+	return ui.JSON(p.out, NewReport(result))
+}
+
+// PrintMissingApps lists installed apps whose managed configs are missing
+// or not applied on this machine, with the command that applies each.
+func (p *Prompter) PrintMissingApps(apps []MissingApp) {
+	if len(apps) == 0 {
+		fmt.Fprintln(p.out, i18n.T("discover.apps_applied"))
+		return
+	}
+	fmt.Fprintln(p.out, i18n.T("discover.apps_header", len(apps)))
+	for _, app := range apps {
+		var counts []string
+		if n := len(app.Missing); n > 0 {
+			counts = append(counts, i18n.T("discover.apps_missing_count", n))
+		}
+		if n := len(app.Unapplied); n > 0 {
+			counts = append(counts, i18n.T("discover.apps_unapplied_count", n))
+		}
+		fmt.Fprintf(p.out, "%s (%s)\n", redact.Text(app.App), strings.Join(counts, ", "))
+		for _, rel := range app.Missing {
+			fmt.Fprintln(p.out, i18n.T("discover.apps_missing", redact.Text(rel)))
+		}
+		for _, rel := range app.Unapplied {
+			fmt.Fprintln(p.out, i18n.T("discover.apps_unapplied", redact.Text(rel)))
+		}
+		fmt.Fprintln(p.out, i18n.T("discover.apps_run", redact.Text(app.ApplyCommand())))
+	}
+	fmt.Fprintln(p.out)
+}
+
+// PrintPending lists the recommended candidates recorded by scheduled
+// discovery passes.
+func (p *Prompter) PrintPending(pending *Pending) {
+	if pending == nil || pending.LastRun.IsZero() {
+		fmt.Fprintln(p.out, i18n.T("discover.pending_never"))
+		return
+	}
+	fmt.Fprintln(p.out, i18n.T("discover.pending_last_run", pending.LastRun.Local().Format("2006-01-02 15:04")))
+	if len(pending.Candidates) == 0 {
+		fmt.Fprintln(p.out, i18n.T("discover.pending_empty"))
+		return
+	}
+	fmt.Fprintln(p.out, "\n"+i18n.T("discover.pending_header", len(pending.Candidates)))
+	for _, c := range pending.Candidates {
+		fmt.Fprintln(p.out, i18n.T("discover.pending_candidate", i18n.T("discover.kind_file"), redact.Text(c.RelPath), c.Score, c.FoundAt.Local().Format("2006-01-02")))
+		if len(c.Reasons) > 0 {
+			fmt.Fprintln(p.out, i18n.T("discover.reasons", redact.Text(strings.Join(c.Reasons, ", "))))
+		}
+	}
+	fmt.Fprintln(p.out, "\n"+i18n.T("discover.pending_run"))
+}
@@ -2,9 +2,16 @@ package discover
 
 import (
 	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/i18n"
 	"github.com/dnery/dotstate/dot/internal/modules"
 )
 
@@ -118,6 +125,21 @@ func TestPrintReportRedactsSentinelValues(t *testing.T) {
 	if !strings.Contains(out.String(), "<redacted:secret>") || !strings.Contains(out.String(), "secrets.gitleaks.unavailable") {
 		t.Fatalf("report missing redaction marker or diagnostic:\n%s", out.String())
 	}
+
+	out.Reset()
+	if err := p.PrintReportJSON(result); err != nil {
+		t.Fatalf("PrintReportJSON() error = %v", err)
+	}
+	if strings.Contains(out.String(), sentinel) {
+		t.Fatalf("JSON report leaked sentinel:\n%s", out.String())
+	}
+	var report Report
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("JSON report does not parse: %v\n%s", err, out.String())
+	}
+	if len(report.Candidates) != 2 || report.Candidates[0].Category != "risky" || report.Candidates[1].Kind != "repo" || len(report.Diagnostics) != 1 {
+		t.Fatalf("JSON report = %+v", report)
+	}
 }
 
 func TestSelectCandidatesExplainsClassificationTUI(t *testing.T) {
@@ -161,3 +183,287 @@ func TestPrintReportExplainsIgnoredAndTypedModuleGuidance(t *testing.T) {
 		t.Fatalf("report did not explain ignored items/module guidance:\n%s", got)
 	}
 }
+
+func TestParseAttributesSetsCandidateAttributes(t *testing.T) {
+	recommended := CandidateList{{RelPath: "~/.gitconfig"}}
+	maybe := CandidateList{{RelPath: "~/.netrc"}}
+	out := &bytes.Buffer{}
+	p := NewPrompterWithIO(strings.NewReader(""), out, false)
+
+	p.parseAttributes("1,2 private,readonly", recommended, maybe, nil, 2, 3)
+	if got := maybe[0].Attributes.String(); got != "private,readonly" {
+		t.Fatalf("attributes = %q, want private,readonly", got)
+	}
+
+	p.parseAttributes("1 none", recommended, maybe, nil, 2, 3)
+	if !recommended[0].Attributes.IsZero() {
+		t.Fatalf("attributes = %+v, want cleared", recommended[0].Attributes)
+	}
+
+	p.parseAttributes("2 exact", recommended, maybe, nil, 2, 3)
+	if !strings.Contains(out.String(), "Invalid attributes") {
+		t.Fatalf("expected invalid attribute message, got %q", out.String())
+	}
+}
+
+func TestAttributesForPrefersMostSpecificRule(t *testing.T) {
+	cfg := &config.Config{Discover: config.DiscoverConfig{Attributes: map[string]string{
+		".ssh/*":        "private",
+		".ssh/config":   "private,readonly",
+		"*.local":       "create",
+		"~/.config/a/*": "readonly",
+	}}}
+
+	tests := map[string]string{
+		"~/.ssh/config":       "private,readonly",
+		"~/.ssh/known_hosts":  "private",
+		"~/.config/x/a.local": "create",
+		"~/.config/a/b.toml":  "readonly",
+		"~/.zshrc":            "",
+	}
+	for rel, want := range tests {
+		if got := attributesFor(cfg, rel).String(); got != want {
+			t.Errorf("attributesFor(%q) = %q, want %q", rel, got, want)
+		}
+	}
+}
+
+func TestReviewLargeFilesRoutesSkipsAndKeeps(t *testing.T) {
+	small := &Candidate{RelPath: "~/.zshrc", Size: 100}
+	lfs := &Candidate{RelPath: "~/.local/share/app.db", Size: 4 << 20}
+	skip := &Candidate{RelPath: "~/.cache-ish/blob", Size: 2 << 20}
+	keep := &Candidate{RelPath: "~/.config/app/big.json", Size: 1 << 20}
+	out := &bytes.Buffer{}
+	p := NewPrompterWithIO(strings.NewReader("l\n\nk\n"), out, false)
+
+	got := p.ReviewLargeFiles([]*Candidate{small, lfs, skip, keep}, DefaultLargeFileSize, true)
+
+	if len(got) != 3 || got[0] != small || got[1] != lfs || got[2] != keep {
+		t.Fatalf("ReviewLargeFiles() = %v", got)
+	}
+	if !lfs.LFS || keep.LFS {
+		t.Fatalf("LFS flags: lfs=%v keep=%v", lfs.LFS, keep.LFS)
+	}
+	if !strings.Contains(out.String(), "3 selected files are over 512.0 KB (7.0 MB of 7.0 MB selected)") {
+		t.Fatalf("expected cumulative size summary, got %q", out.String())
+	}
+}
+
+func TestReviewLargeFilesSkipsInAutoYesMode(t *testing.T) {
+	small := &Candidate{RelPath: "~/.zshrc", Size: 100}
+	big := &Candidate{RelPath: "~/.local/share/app.db", Size: 4 << 20}
+	p := NewPrompterWithIO(strings.NewReader(""), &bytes.Buffer{}, true)
+
+	got := p.ReviewLargeFiles([]*Candidate{small, big}, DefaultLargeFileSize, true)
+	if len(got) != 1 || got[0] != small || big.LFS {
+		t.Fatalf("ReviewLargeFiles() = %v", got)
+	}
+}
+
+func TestNonInteractiveFallbackNeverPrompts(t *testing.T) {
+	var out bytes.Buffer
+	p := &Prompter{in: strings.NewReader(""), out: &out}
+	if p.Interactive() {
+		t.Fatal("prompter without a terminal reported interactive")
+	}
+
+	opts := p.nonInteractiveFallback(Options{NonInteractive: NonInteractiveReport})
+	if !opts.ReportOnly || opts.AutoYes {
+		t.Fatalf("report policy = %#v, want report-only", opts)
+	}
+
+	opts = p.nonInteractiveFallback(Options{NonInteractive: NonInteractiveYes})
+	if !opts.AutoYes || opts.ReportOnly || !p.autoYes {
+		t.Fatalf("yes policy = %#v (prompter autoYes %v), want auto-yes", opts, p.autoYes)
+	}
+	if !p.ConfirmAdd([]*Candidate{{RelPath: "~/.zshrc"}}) {
+		t.Fatal("ConfirmAdd blocked or declined after the yes fallback")
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Fatal("regular file detected as a terminal")
+	}
+}
+
+func TestParseSelectionRanges(t *testing.T) {
+	var maybe CandidateList
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		maybe = append(maybe, &Candidate{RelPath: "~/.config/" + name})
+	}
+	recommended := CandidateList{{RelPath: "~/.zshrc"}}
+	selected := map[int]*Candidate{1: recommended[0], 3: maybe[1]}
+	out := &bytes.Buffer{}
+	p := NewPrompterWithIO(strings.NewReader(""), out, false)
+
+	p.parseSelection("2-4", selected, recommended, maybe, nil, 2, 7)
+	if _, ok := selected[3]; ok || selected[2] != maybe[0] || selected[4] != maybe[2] {
+		t.Fatalf("toggle range: selected = %v", selected)
+	}
+
+	p.parseSelection("+1-6", selected, recommended, maybe, nil, 2, 7)
+	if len(selected) != 6 {
+		t.Fatalf("add range: selected %d, want 6", len(selected))
+	}
+
+	p.parseSelection("-3-6, 1", selected, recommended, maybe, nil, 2, 7)
+	if len(selected) != 1 || selected[2] != maybe[0] {
+		t.Fatalf("remove range: selected = %v", selected)
+	}
+
+	p.parseSelection("5-9,4-2", selected, recommended, maybe, nil, 2, 7)
+	if len(selected) != 1 {
+		t.Fatalf("invalid ranges changed selection: %v", selected)
+	}
+	for _, want := range []string{"Invalid item range: 5-9", "Invalid item range: 4-2"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCategoryCommandsToggleWholeCategory(t *testing.T) {
+	recommended := CandidateList{{RelPath: "~/.zshrc"}}
+	maybe := CandidateList{{RelPath: "~/.config/a"}, {RelPath: "~/.config/b"}}
+	risky := CandidateList{{RelPath: "~/.netrc"}}
+	selected := map[int]*Candidate{1: recommended[0]}
+	p := NewPrompterWithIO(strings.NewReader(""), &bytes.Buffer{}, false)
+
+	for _, step := range []struct {
+		input string
+		want  int
+	}{
+		{"maybe", 3},
+		{"+risky", 4},
+		{"-rec", 3},
+		{"-maybe", 1},
+	} {
+		list, start, add, ok := categoryCommand(step.input, recommended, maybe, risky, 2, 4)
+		if !ok {
+			t.Fatalf("categoryCommand(%q) not recognized", step.input)
+		}
+		p.selectCategory(selected, list, start, add)
+		if len(selected) != step.want {
+			t.Fatalf("after %q selected %d, want %d", step.input, len(selected), step.want)
+		}
+	}
+	if selected[4] != risky[0] {
+		t.Fatalf("selected = %v, want only the risky item", selected)
+	}
+	if _, _, _, ok := categoryCommand("3", recommended, maybe, risky, 2, 4); ok {
+		t.Fatal("item number parsed as a category command")
+	}
+}
+
+// echoReader answers one prompt per read and echoes the answer the way a
+// terminal would, so each prompt ends its own output line.
+type echoReader struct {
+	out   *bytes.Buffer
+	lines []string
+}
+
+func (r *echoReader) Read(b []byte) (int, error) {
+	if len(r.lines) == 0 {
+		return 0, io.EOF
+	}
+	line := r.lines[0] + "\n"
+	r.lines = r.lines[1:]
+	r.out.WriteString(line)
+	return copy(b, line), nil
+}
+
+// promptScenario drives every Prompter method through each of its messages.
+// Test data avoids runs of three or more letters so that any word left in
+// output identical across locales came from a hard-coded string.
+func promptScenario() string {
+	out := &bytes.Buffer{}
+	candidates := func() CandidateList {
+		return CandidateList{
+			{RelPath: "~/.zz", Category: CategoryRecommended, Size: 2 << 20, Reasons: []string{"r1"}},
+			{RelPath: "~/.yy/q1", Category: CategoryMaybe, IsDir: true},
+			{RelPath: "~/.yy/q2", Category: CategoryMaybe, SecretWarnings: []string{"w1"}},
+			{RelPath: "~/.vv", Category: CategoryRisky, SecretWarnings: []string{"w2\nc2"},
+				SecretFindings: []SecretFinding{{PatternID: "p1", Confidence: "high", Line: 1}}},
+			{RelPath: "~/.xx", Category: CategoryRisky, IsSubRepo: true, SubRepoURL: "https://x.io/r"},
+			{RelPath: "~/.uu", Category: CategoryRisky, IsSubRepo: true},
+		}
+	}
+	result := &Result{
+		Candidates:  candidates(),
+		Covered:     []*Candidate{{RelPath: "~/.ww", CoveredBy: "d_ww"}},
+		Drifted:     []*Candidate{{RelPath: "~/.tt", Drift: "-a\n+b\n", SecretWarnings: []string{"w3"}}},
+		Ignored:     map[string]int{"r2": 1},
+		Diagnostics: []modules.Diagnostic{{Severity: modules.SeverityWarning, Code: "c1", Message: "m1", Remediation: "f1"}},
+	}
+	for _, c := range result.Candidates {
+		if c.IsSubRepo {
+			result.SubRepos = append(result.SubRepos, c)
+		}
+	}
+
+	p := NewPrompterWithIO(&echoReader{out: out, lines: []string{
+		"1", "+1", "-1", "9", "3-1", "maybe", "-maybe", "sort xx", "collapse", "expand",
+		"attr 1 private", "attr 1 none", "attr 1", "attr 1 zz", "a", "n", "q",
+	}}, out, false)
+	p.SelectCandidates(nil, result)
+	p.nonInteractiveFallback(Options{NonInteractive: NonInteractiveYes})
+	p.nonInteractiveFallback(Options{})
+	NewPrompterWithIO(strings.NewReader(""), out, false).SelectCandidates(nil, &Result{})
+	NewPrompterWithIO(strings.NewReader(""), out, true).SelectCandidates(nil, &Result{Candidates: candidates()})
+
+	secrets := candidates()
+	secrets[0].SecretFindings = secrets[3].SecretFindings
+	secrets[0].Templatable = true
+	for _, autoYes := range []bool{false, true} {
+		p := NewPrompterWithIO(&echoReader{out: out, lines: []string{"k", "k", "u", "s", "s", "y", "y"}}, out, autoYes)
+		p.ReviewLargeFiles(candidates(), 1<<20, false)
+		p.ReviewLargeFiles(candidates(), 1<<20, true)
+		p.ReviewDrifted(result.Drifted)
+		p.ReviewSecrets(secrets)
+		p.ConfirmAdd(candidates())
+		p.ConfirmCommit()
+	}
+
+	result.Candidates[0].Attributes.Private = true
+	p.PrintReport(result)
+	p.PrintReport(&Result{})
+	p.PrintMissingApps(nil)
+	p.PrintMissingApps([]MissingApp{{App: "a1", Root: "~/.ss", Missing: []string{"~/.ss/m"}, Unapplied: []string{"~/.ss/u"}}})
+	p.PrintPending(nil)
+	p.PrintPending(&Pending{LastRun: time.Unix(1, 0)})
+	p.PrintPending(&Pending{LastRun: time.Unix(1, 0), Candidates: []PendingCandidate{{RelPath: "~/.zz", Reasons: []string{"r1"}}}})
+	return out.String()
+}
+
+func TestPrompterOutputComesFromCatalog(t *testing.T) {
+	t.Cleanup(func() { i18n.SetLocale("") })
+	output := map[string]string{}
+	for _, locale := range i18n.Locales() {
+		i18n.SetLocale(locale)
+		output[locale] = promptScenario()
+	}
+
+	word := regexp.MustCompile(`[A-Za-z]{3,}`)
+	data := strings.NewReplacer("https://x.io/r", "", "private", "", string(modules.SeverityWarning), "")
+	for _, locale := range i18n.Locales() {
+		if locale == i18n.DefaultLocale {
+			continue
+		}
+		localized := map[string]bool{}
+		for _, line := range strings.Split(output[locale], "\n") {
+			localized[line] = true
+			if strings.Contains(line, "discover.") {
+				t.Errorf("%s: output shows a message ID: %q", locale, line)
+			}
+		}
+		for _, line := range strings.Split(output[i18n.DefaultLocale], "\n") {
+			if localized[line] && word.MatchString(data.Replace(line)) {
+				t.Errorf("%s: %q is not in the %s catalog", locale, line, locale)
+			}
+		}
+	}
+}
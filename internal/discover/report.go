@@ -0,0 +1,100 @@
+package discover
+
+import (
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/diffstat"
+	"github.com/dnery/dotstate/dot/internal/modules"
+)
+
+// Report is the machine-readable form of the report-only output, emitted
+// by dot discover --report --json.
+type Report struct {
+	ScanDurationMS int64             `json:"scan_duration_ms"`
+	ScannedDirs    int               `json:"scanned_dirs"`
+	ScannedFiles   int               `json:"scanned_files"`
+	Candidates     []ReportCandidate `json:"candidates"`
+	Drifted        []ReportCandidate `json:"drifted"`
+	Covered        []ReportCandidate `json:"covered"`
+	SubRepos       []ReportCandidate `json:"subrepos"`
+	// Ignored counts candidates filtered out, by reason.
+	Ignored     map[string]int       `json:"ignored,omitempty"`
+	Diagnostics []modules.Diagnostic `json:"diagnostics"`
+}
+
+// ReportCandidate is one entry of a Report. Secret findings are reported
+// as their warnings only, so matched text never reaches the output.
+type ReportCandidate struct {
+	Path string `json:"path"`
+	// Kind is "file", "dir", or "repo".
+	Kind     string   `json:"kind"`
+	Category string   `json:"category,omitempty"`
+	Score    int      `json:"score"`
+	Size     int64    `json:"size"`
+	Reasons  []string `json:"reasons,omitempty"`
+	// Attributes are the chezmoi attributes the file would be added with.
+	Attributes       string   `json:"attributes,omitempty"`
+	SecretWarnings   []string `json:"secret_warnings,omitempty"`
+	SecretConfidence string   `json:"secret_confidence,omitempty"`
+	Remote           string   `json:"remote,omitempty"`
+	CoveredBy        string   `json:"covered_by,omitempty"`
+	// Added and Removed count the lines a drifted file changed.
+	Added   int `json:"added,omitempty"`
+	Removed int `json:"removed,omitempty"`
+}
+
+// NewReport converts result for JSON output.
+func NewReport(result *Result) *Report {
+	report := &Report{
+		ScanDurationMS: result.ScanDuration.Milliseconds(),
+		ScannedDirs:    result.ScannedDirs,
+		ScannedFiles:   result.ScannedFiles,
+		Candidates:     reportCandidates(result.Candidates),
+		Drifted:        reportCandidates(result.Drifted),
+		Covered:        reportCandidates(result.Covered),
+		SubRepos:       reportCandidates(result.SubRepos),
+		Ignored:        result.Ignored,
+		Diagnostics:    result.Diagnostics,
+	}
+	if report.Diagnostics == nil {
+		report.Diagnostics = []modules.Diagnostic{}
+	}
+	return report
+}
+
+func reportCandidates(candidates []*Candidate) []ReportCandidate {
+	out := make([]ReportCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		rc := ReportCandidate{
+			Path:             c.RelPath,
+			Kind:             "file",
+			Score:            c.Score,
+			Size:             c.Size,
+			Reasons:          c.Reasons,
+			SecretWarnings:   c.SecretWarnings,
+			SecretConfidence: c.SecretConfidence,
+			CoveredBy:        c.CoveredBy,
+		}
+		switch {
+		case c.IsSubRepo:
+			rc.Kind = "repo"
+		case c.IsDir:
+			rc.Kind = "dir"
+		}
+		if c.Category != CategoryIgnored {
+			rc.Category = strings.ToLower(c.Category.String())
+		}
+		if !c.Attributes.IsZero() {
+			rc.Attributes = c.Attributes.String()
+		}
+		if c.SubRepoURL != "" {
+			rc.Remote, _ = sanitizeGitRemoteURL(c.SubRepoURL)
+		}
+		if c.Drift != "" {
+			totals := diffstat.Sum(diffstat.Parse(c.Drift))
+			rc.Added, rc.Removed = totals.Added, totals.Removed
+		}
+		out = append(out, rc)
+	}
+	return out
+}
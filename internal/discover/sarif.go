@@ -0,0 +1,135 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// SARIF output follows the 2.1.0 schema accepted by GitHub code scanning.
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Version        string      `json:"version,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Properties          map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// SARIF renders the report as a SARIF log. Findings keep their redacted
+// matches; history findings carry their commit as a result property.
+func (r *ScanReport) SARIF(toolVersion string) ([]byte, error) {
+	ruleIDs := map[string]bool{}
+	results := make([]sarifResult, 0, len(r.Findings))
+	for _, f := range r.Findings {
+		ruleIDs[f.PatternID] = true
+		location := sarifPhysicalLocation{ArtifactLocation: sarifArtifact{URI: filepath.ToSlash(f.File)}}
+		if f.Line > 0 {
+			location.Region = &sarifRegion{StartLine: f.Line}
+		}
+		fingerprint := f.File + ":" + f.PatternID
+		result := sarifResult{
+			RuleID:              f.PatternID,
+			Level:               sarifLevel(f.Confidence),
+			Message:             sarifMessage{Text: fmt.Sprintf("Potential secret (%s, %s confidence)", f.PatternID, f.Confidence)},
+			Locations:           []sarifLocation{{PhysicalLocation: location}},
+			PartialFingerprints: map[string]string{},
+		}
+		if f.Commit != "" {
+			fingerprint = f.Commit + ":" + fingerprint
+			result.Properties = map[string]string{"commit": f.Commit}
+		}
+		result.PartialFingerprints["dotstateSecret/v1"] = fingerprint
+		results = append(results, result)
+	}
+
+	ids := make([]string, 0, len(ruleIDs))
+	for id := range ruleIDs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	rules := make([]sarifRule, 0, len(ids))
+	for _, id := range ids {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: "Potential secret matching " + id}})
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "dotstate",
+				InformationURI: "https://github.com/dnery/dotstate",
+				Version:        toolVersion,
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+	return json.MarshalIndent(log, "", "  ")
+}
+
+// sarifLevel maps finding confidence to a SARIF result level.
+func sarifLevel(confidence string) string {
+	switch confidence {
+	case ConfidenceHigh:
+		return "error"
+	case ConfidenceLow:
+		return "note"
+	}
+	return "warning"
+}
@@ -0,0 +1,40 @@
+package discover
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestScanReportSARIF(t *testing.T) {
+	report := &ScanReport{Findings: []SecretFinding{
+		{File: "home/dot_netrc", Line: 3, PatternID: "github-token", Confidence: ConfidenceHigh, Match: "<redacted:secret>"},
+		{File: "home/dot_zshrc", Line: 9, PatternID: "password-assignment", Confidence: ConfidenceLow, Commit: "abc123"},
+	}}
+
+	b, err := report.SARIF("1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(b, &log); err != nil {
+		t.Fatalf("invalid SARIF JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("log = %+v", log)
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Version != "1.2.3" || len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != "github-token" {
+		t.Fatalf("driver = %+v", run.Tool.Driver)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("results = %+v", run.Results)
+	}
+	first, second := run.Results[0], run.Results[1]
+	loc := first.Locations[0].PhysicalLocation
+	if first.Level != "error" || loc.ArtifactLocation.URI != "home/dot_netrc" || loc.Region.StartLine != 3 {
+		t.Fatalf("first result = %+v", first)
+	}
+	if second.Level != "note" || second.Properties["commit"] != "abc123" || second.PartialFingerprints["dotstateSecret/v1"] != "abc123:home/dot_zshrc:password-assignment" {
+		t.Fatalf("second result = %+v", second)
+	}
+}
@@ -0,0 +1,303 @@
+package discover
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/modules"
+)
+
+// RepoScanOptions configures ScanRepo.
+type RepoScanOptions struct {
+	// Root is the repository root whose working tree is scanned.
+	Root string
+	// Exclude lists repo-relative directories skipped in the working tree.
+	Exclude []string
+	// History also scans lines added by commits in Range.
+	History bool
+	// Range is a git revision range; empty means all of HEAD's history.
+	Range string
+	Git   *gitx.Git
+	// Destinations are absolute paths of live destination files, such as
+	// those chezmoi manages, scanned with the built-in patterns alongside
+	// the tree. Their findings name the file relative to Home as "~/...".
+	Destinations []string
+	Home         string
+}
+
+// ScanReport summarizes a full-repo secret audit. Findings never carry the
+// matched text.
+type ScanReport struct {
+	Findings       []SecretFinding `json:"findings"`
+	FilesScanned   int             `json:"files_scanned"`
+	CommitsScanned int             `json:"commits_scanned"`
+	// DestinationsScanned counts the Destinations that existed and were
+	// scanned.
+	DestinationsScanned int                  `json:"destinations_scanned,omitempty"`
+	Scanners            []string             `json:"scanners"`
+	Diagnostics         []modules.Diagnostic `json:"diagnostics"`
+}
+
+// ScanRepo runs the built-in patterns over the working tree (and optionally
+// git history), adding gitleaks findings when the binary is available.
+func (d *SecretDetector) ScanRepo(ctx context.Context, opts RepoScanOptions) (*ScanReport, error) {
+	report := &ScanReport{Scanners: []string{"builtin"}}
+
+	if err := d.scanTree(ctx, opts, report); err != nil {
+		return report, err
+	}
+	if err := d.scanDestinations(ctx, opts, report); err != nil {
+		return report, err
+	}
+
+	if opts.History {
+		if opts.Git == nil {
+			return report, fmt.Errorf("history scan requires git")
+		}
+		patch, err := opts.Git.LogPatch(ctx, opts.Root, opts.Range)
+		if err != nil {
+			return report, fmt.Errorf("read git history: %w", err)
+		}
+		findings, commits, err := d.ScanPatch(ctx, patch)
+		if err != nil {
+			return report, err
+		}
+		report.Findings = append(report.Findings, findings...)
+		report.CommitsScanned = commits
+	}
+
+	if diag := d.GitleaksUnavailableDiagnostic(ctx); diag != nil {
+		report.Diagnostics = append(report.Diagnostics, *diag)
+	} else {
+		report.Scanners = append(report.Scanners, "gitleaks")
+		findings, err := d.runGitleaks(ctx, "", "--no-git", "--source", opts.Root)
+		if err != nil {
+			return report, fmt.Errorf("gitleaks scan: %w", err)
+		}
+		if opts.History {
+			args := []string{"--source", opts.Root}
+			if opts.Range != "" {
+				args = append(args, "--log-opts", opts.Range)
+			}
+			historyFindings, err := d.runGitleaks(ctx, "", args...)
+			if err != nil {
+				return report, fmt.Errorf("gitleaks history scan: %w", err)
+			}
+			findings = append(findings, historyFindings...)
+		}
+		for i := range findings {
+			findings[i].File = relativeTo(opts.Root, findings[i].File)
+		}
+		report.Findings = append(report.Findings, findings...)
+	}
+
+	report.Findings = dedupeFindings(report.Findings)
+	return report, nil
+}
+
+func (d *SecretDetector) scanTree(ctx context.Context, opts RepoScanOptions, report *ScanReport) error {
+	return filepath.WalkDir(opts.Root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rel := relativeTo(opts.Root, path)
+		if entry.IsDir() {
+			if entry.Name() == ".git" || excludedDir(rel, opts.Exclude) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		binary, err := isBinaryFile(path)
+		if err != nil {
+			return fmt.Errorf("scan %s: %w", rel, err)
+		}
+		if binary {
+			return nil
+		}
+		findings, err := d.ScanFile(ctx, path)
+		if err != nil {
+			return fmt.Errorf("scan %s: %w", rel, err)
+		}
+		for i := range findings {
+			findings[i].File = rel
+		}
+		report.FilesScanned++
+		report.Findings = append(report.Findings, findings...)
+		return nil
+	})
+}
+
+// scanDestinations scans opts.Destinations, skipping files that are
+// missing, not regular, or binary.
+func (d *SecretDetector) scanDestinations(ctx context.Context, opts RepoScanOptions, report *ScanReport) error {
+	for _, path := range opts.Destinations {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := relativeTo(opts.Home, path)
+		if name != filepath.ToSlash(path) {
+			name = "~/" + name
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("scan %s: %w", name, err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		binary, err := isBinaryFile(path)
+		if err != nil {
+			return fmt.Errorf("scan %s: %w", name, err)
+		}
+		if binary {
+			continue
+		}
+		findings, err := d.ScanFile(ctx, path)
+		if err != nil {
+			return fmt.Errorf("scan %s: %w", name, err)
+		}
+		for i := range findings {
+			findings[i].File = name
+		}
+		report.DestinationsScanned++
+		report.Findings = append(report.Findings, findings...)
+	}
+	return nil
+}
+
+// ScanPatch scans the lines added in git log -p output produced by
+// gitx.LogPatch and returns findings plus the number of commits seen.
+func (d *SecretDetector) ScanPatch(ctx context.Context, patch string) ([]SecretFinding, int, error) {
+	var findings []SecretFinding
+	var commit, file string
+	commits, newLine, inHunk := 0, 0, false
+
+	scanner := bufio.NewScanner(strings.NewReader(patch))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return findings, commits, ctx.Err()
+		}
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, gitx.HistoryCommitMarker):
+			commit = strings.TrimPrefix(line, gitx.HistoryCommitMarker)
+			commits++
+			file, inHunk = "", false
+		case strings.HasPrefix(line, "diff --git "):
+			file, inHunk = "", false
+		case !inHunk && strings.HasPrefix(line, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+		case strings.HasPrefix(line, "@@"):
+			newLine, inHunk = hunkNewStart(line), true
+		case inHunk && strings.HasPrefix(line, "+"):
+			if file != "" {
+				for _, finding := range d.scanLine(file, newLine, line[1:]) {
+					finding.Commit = commit
+					findings = append(findings, finding)
+				}
+			}
+			newLine++
+		case inHunk && strings.HasPrefix(line, " "):
+			newLine++
+		}
+	}
+	return findings, commits, scanner.Err()
+}
+
+// hunkNewStart returns c from a "@@ -a,b +c,d @@" header.
+func hunkNewStart(header string) int {
+	for _, field := range strings.Fields(header) {
+		if strings.HasPrefix(field, "+") {
+			start, _, _ := strings.Cut(field[1:], ",")
+			n, err := strconv.Atoi(start)
+			if err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+func isBinaryFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	buf := make([]byte, 8000)
+	n, err := f.Read(buf)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
+
+func excludedDir(rel string, exclude []string) bool {
+	for _, dir := range exclude {
+		dir = strings.Trim(filepath.ToSlash(dir), "/")
+		if rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func relativeTo(root, path string) string {
+	if path == "" || !filepath.IsAbs(path) {
+		return filepath.ToSlash(path)
+	}
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
+
+func dedupeFindings(findings []SecretFinding) []SecretFinding {
+	seen := make(map[string]bool, len(findings))
+	out := make([]SecretFinding, 0, len(findings))
+	for _, f := range findings {
+		key := fmt.Sprintf("%s\x00%s\x00%d\x00%s", f.Commit, f.File, f.Line, f.PatternID)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, f)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Commit != out[j].Commit {
+			return out[i].Commit < out[j].Commit
+		}
+		if out[i].File != out[j].File {
+			return out[i].File < out[j].File
+		}
+		if out[i].Line != out[j].Line {
+			return out[i].Line < out[j].Line
+		}
+		return out[i].PatternID < out[j].PatternID
+	})
+	return out
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"time"
@@ -20,9 +21,11 @@ type Scanner struct {
 
 // NewScanner creates a new scanner with the given options.
 func NewScanner(opts ScanOptions) *Scanner {
+	classifier := NewClassifier()
+	classifier.profile = opts.Profile
 	return &Scanner{
 		opts:       opts,
-		classifier: NewClassifier(),
+		classifier: classifier,
 		subrepo:    NewSubRepoDetector(),
 	}
 }
@@ -34,6 +37,7 @@ func (s *Scanner) Scan(ctx context.Context) (*Result, error) {
 		Candidates: make(CandidateList, 0),
 		SubRepos:   make([]*Candidate, 0),
 		Ignored:    make(map[string]int),
+		Profile:    s.opts.Profile,
 	}
 
 	// Get roots to scan
@@ -49,9 +53,15 @@ func (s *Scanner) Scan(ctx context.Context) (*Result, error) {
 		}
 
 		expanded := os.ExpandEnv(root)
+		// Go extends only absolute paths past MAX_PATH on Windows.
+		if abs, err := filepath.Abs(expanded); err == nil {
+			expanded = abs
+		}
+		rootStart := s.opts.Profile.start()
 		if err := s.scanRoot(ctx, expanded, result); err != nil {
 			result.Errors = append(result.Errors, err)
 		}
+		s.opts.Profile.root(expanded, rootStart)
 	}
 
 	// Sort candidates
@@ -214,8 +224,11 @@ func (s *Scanner) scanRoot(ctx context.Context, root string, result *Result) err
 		return s.processFile(ctx, root, info, result)
 	}
 
-	// Walk the directory tree
-	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+	// Walk the directory tree. On Windows the walk runs on the
+	// extended-length form of root so deep AppData trees do not fail at
+	// MAX_PATH; candidates keep the plain path.
+	return filepath.WalkDir(platform.LongPath(root), func(path string, d os.DirEntry, err error) error {
+		path = platform.StripLongPath(path)
 		if err != nil {
 			result.Errors = append(result.Errors, err)
 			return nil // Continue walking
@@ -237,18 +250,13 @@ func (s *Scanner) scanRoot(ctx context.Context, root string, result *Result) err
 		if d.IsDir() {
 			result.ScannedDirs++
 
-			if s.matchesIgnore(path) {
-				result.recordIgnored("user ignore registry")
-				return filepath.SkipDir
-			}
-
-			// Check if this directory should be excluded
-			if s.shouldExcludeDir(path, d.Name()) {
-				result.recordIgnored("cache/vendor/browser/generated directory")
+			if s.excludedDir(path, d.Name(), result) {
 				return filepath.SkipDir
 			}
 
 			// Check for sub-repo (has .git directory)
+			start := s.opts.Profile.start()
+			defer s.opts.Profile.stage(ProfileStageSubRepo, start)
 			if s.subrepo.IsSubRepo(path) {
 				candidate, err := s.subrepo.Analyze(ctx, path, s.opts.Home)
 				if err == nil && candidate != nil {
@@ -275,20 +283,83 @@ func (s *Scanner) processFile(ctx context.Context, path string, info os.FileInfo
 		return nil
 	}
 
+	if s.excludedFile(path, info, result) {
+		return nil
+	}
+
+	// Classify the file
+	candidate := s.classifier.Classify(path, info, s.opts.Home)
+	if candidate.Category == CategoryIgnored {
+		return nil
+	}
+
+	result.Candidates = append(result.Candidates, candidate)
+	return nil
+}
+
+// excludedDir reports whether the walk should skip the directory,
+// recording the reason and, when profiling, the rule that matched.
+func (s *Scanner) excludedDir(path, name string, result *Result) bool {
+	start := s.opts.Profile.start()
+	defer s.opts.Profile.stage(ProfileStageExclude, start)
+
+	if s.reservedName(name, result) {
+		return true
+	}
+	if pattern, ok := s.ignoreRule(path); ok {
+		result.recordIgnored("user ignore registry")
+		s.opts.Profile.exclude("ignore " + pattern)
+		return true
+	}
+	if s.matchesDotIgnore(path, true) {
+		result.recordIgnored(".dotignore")
+		s.opts.Profile.exclude(".dotignore")
+		return true
+	}
+	// Check if this directory should be excluded
+	if rule := s.excludeDirRule(path, name); rule != "" {
+		result.recordIgnored("cache/vendor/browser/generated directory")
+		s.opts.Profile.exclude("dir " + rule)
+		return true
+	}
+	return false
+}
+
+// excludedFile reports whether the file is filtered out before
+// classification, recording the reason and, when profiling, the rule that
+// matched.
+func (s *Scanner) excludedFile(path string, info os.FileInfo, result *Result) bool {
+	start := s.opts.Profile.start()
+	defer s.opts.Profile.stage(ProfileStageExclude, start)
+
+	if s.reservedName(filepath.Base(path), result) {
+		return true
+	}
+
 	// Skip if already managed
-	if s.opts.ManagedPaths[path] {
+	if s.opts.ManagedPaths[platform.NormalizeUnicode(path)] {
 		result.recordIgnored("already managed")
-		return nil
+		s.opts.Profile.exclude("already managed")
+		result.Managed = append(result.Managed, path)
+		return true
 	}
 
-	if s.matchesIgnore(path) {
+	if pattern, ok := s.ignoreRule(path); ok {
 		result.recordIgnored("user ignore registry")
-		return nil
+		s.opts.Profile.exclude("ignore " + pattern)
+		return true
 	}
 
-	if s.shouldExcludeFile(path, filepath.Base(path)) {
+	if s.matchesDotIgnore(path, false) {
+		result.recordIgnored(".dotignore")
+		s.opts.Profile.exclude(".dotignore")
+		return true
+	}
+
+	if rule := s.excludeFileRule(path, filepath.Base(path)); rule != "" {
 		result.recordIgnored("generated/cache/browser file")
-		return nil
+		s.opts.Profile.exclude("file " + rule)
+		return true
 	}
 
 	// Skip very large files when a max is configured.
@@ -296,24 +367,38 @@ func (s *Scanner) processFile(ctx context.Context, path string, info os.FileInfo
 		// Unless it's a config-ish extension
 		if !s.classifier.IsConfigExtension(path) {
 			result.recordIgnored("over max file size")
-			return nil
+			s.opts.Profile.exclude("over max file size")
+			return true
 		}
 	}
+	return false
+}
 
-	// Classify the file
-	candidate := s.classifier.Classify(path, info, s.opts.Home)
-	if candidate.Category == CategoryIgnored {
-		return nil
+// reservedName reports whether name is a Windows device name when
+// scanning for Windows. Such entries cannot be read or added: opening
+// "nul" or "con.txt" opens the device instead of the file.
+func (s *Scanner) reservedName(name string, result *Result) bool {
+	if !s.windows() || !platform.IsReservedName(name) {
+		return false
 	}
+	result.recordIgnored("reserved device name")
+	s.opts.Profile.exclude("reserved name " + name)
+	return true
+}
 
-	result.Candidates = append(result.Candidates, candidate)
-	return nil
+// windows reports whether the scan targets Windows.
+func (s *Scanner) windows() bool {
+	if s.opts.Platform != nil {
+		return s.opts.Platform.IsWindows()
+	}
+	return runtime.GOOS == string(platform.Windows)
 }
 
-// shouldExcludeDir returns true if the directory should be skipped entirely.
-func (s *Scanner) shouldExcludeDir(path, name string) bool {
+// excludeDirRule returns the built-in rule that excludes the directory, or
+// "" when none does.
+func (s *Scanner) excludeDirRule(path, name string) string {
 	if strings.HasSuffix(name, ".app") {
-		return true
+		return "*.app"
 	}
 
 	// Always skip these directories
@@ -383,7 +468,7 @@ func (s *Scanner) shouldExcludeDir(path, name string) bool {
 
 	for _, exclude := range excludeNames {
 		if name == exclude {
-			return true
+			return exclude
 		}
 	}
 
@@ -404,42 +489,59 @@ func (s *Scanner) shouldExcludeDir(path, name string) bool {
 	// Only exclude browser dirs if they're the profile root
 	for _, browser := range browserDirs {
 		if name == browser && containsAny(path, "Profiles", "User Data", "Application Support") {
-			return true
+			return browser + " profile"
 		}
 	}
 
-	return false
+	return ""
 }
 
-func (s *Scanner) shouldExcludeFile(path, name string) bool {
+// excludeFileRule returns the built-in rule that excludes the file, or ""
+// when none does.
+func (s *Scanner) excludeFileRule(path, name string) string {
 	lowerName := strings.ToLower(name)
-	if strings.HasSuffix(lowerName, ".map") || strings.HasSuffix(lowerName, ".app") {
-		return true
+	for _, ext := range []string{".map", ".app"} {
+		if strings.HasSuffix(lowerName, ext) {
+			return "*" + ext
+		}
 	}
 	if matchesAny(lowerName, "history", "cookies", "login data", "web data") && containsAny(path, "Chrome", "Chromium", "BraveSoftware", "Edge", "Safari", "Firefox") {
-		return true
+		return "browser history/cookies"
 	}
-	switch filepath.Ext(lowerName) {
+	switch ext := filepath.Ext(lowerName); ext {
 	case ".sqlite", ".sqlite3", ".db", ".ldb", ".log":
 		if containsAny(path, "Application Support", "User Data", "Profiles", "IndexedDB", "Local Storage", "Session Storage") {
-			return true
+			return "app data *" + ext
 		}
 	}
-	return false
+	return ""
 }
 
-func (s *Scanner) matchesIgnore(path string) bool {
+// ignoreRule returns the user ignore registry pattern that matches path.
+func (s *Scanner) ignoreRule(path string) (string, bool) {
 	if len(s.opts.IgnorePatterns) == 0 {
-		return false
+		return "", false
 	}
 	rel := relPath(path, s.opts.Home)
 	base := filepath.Base(path)
 	for _, pattern := range s.opts.IgnorePatterns {
 		if pathMatchesPattern(pattern, path, rel, base) {
-			return true
+			return strings.TrimSpace(pattern), true
 		}
 	}
-	return false
+	return "", false
+}
+
+// matchesDotIgnore applies .dotignore rules to paths under home.
+func (s *Scanner) matchesDotIgnore(path string, isDir bool) bool {
+	if s.opts.DotIgnore.Empty() || s.opts.Home == "" {
+		return false
+	}
+	rel, err := filepath.Rel(s.opts.Home, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return s.opts.DotIgnore.Match(platform.NormalizeUnicode(rel), isDir)
 }
 
 func pathMatchesPattern(pattern, path, rel, base string) bool {
@@ -447,7 +549,8 @@ func pathMatchesPattern(pattern, path, rel, base string) bool {
 	if pattern == "" {
 		return false
 	}
-	pattern = filepath.Clean(os.ExpandEnv(pattern))
+	pattern = platform.NormalizeUnicode(filepath.Clean(os.ExpandEnv(pattern)))
+	path, base = platform.NormalizeUnicode(path), platform.NormalizeUnicode(base)
 	candidates := []string{path, rel, strings.TrimPrefix(rel, "~/"), base}
 	for _, candidate := range candidates {
 		if matched, err := filepath.Match(pattern, candidate); err == nil && matched {
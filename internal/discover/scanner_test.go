@@ -184,3 +184,89 @@ func containsString(values []string, target string) bool {
 func ensureDir(path string) error {
 	return os.MkdirAll(path, 0o755)
 }
+
+func TestScanSkipsWindowsReservedNames(t *testing.T) {
+	home := t.TempDir()
+	root := filepath.Join(home, "AppData", "Roaming", "app")
+	for _, rel := range []string{"settings.json", "nul", "con.txt", filepath.Join("aux", "settings.json")} {
+		path := filepath.Join(root, rel)
+		if err := ensureDir(filepath.Dir(path)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := NewScanner(ScanOptions{
+		Home:     home,
+		Roots:    []string{root},
+		Platform: &platform.Platform{OS: platform.Windows, Home: home},
+	}).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := result.Ignored["reserved device name"]; got != 3 {
+		t.Fatalf("Ignored[reserved device name] = %d, want 3 (all: %v)", got, result.Ignored)
+	}
+	for _, c := range result.Candidates {
+		if strings.Contains(c.Path, "aux") || strings.Contains(c.Path, "nul") || strings.Contains(c.Path, "con.txt") {
+			t.Errorf("candidate %s has a reserved name", c.Path)
+		}
+	}
+
+	// The same tree scanned for Linux keeps every file.
+	result, err = NewScanner(ScanOptions{
+		Home:     home,
+		Roots:    []string{root},
+		Platform: &platform.Platform{OS: platform.Linux, Home: home},
+	}).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := result.Ignored["reserved device name"]; got != 0 {
+		t.Fatalf("Linux scan ignored %d reserved names, want 0", got)
+	}
+}
+
+func TestScanMatchesManagedPathsAcrossUnicodeForms(t *testing.T) {
+	home := t.TempDir()
+	nfc := "caf\u00e9.toml"
+	nfd := "cafe\u0301.toml"
+	root := filepath.Join(home, ".config", "app")
+	if err := ensureDir(root); err != nil {
+		t.Fatal(err)
+	}
+	// macOS reads the name back decomposed; the repo recorded it composed.
+	if err := os.WriteFile(filepath.Join(root, nfd), []byte("x = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := NewScanner(ScanOptions{
+		Home:         home,
+		Roots:        []string{root},
+		ManagedPaths: normalizeManagedPaths([]string{"~/.config/app/" + nfc}, home),
+	}).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(result.Managed) != 1 {
+		t.Fatalf("Managed = %v, want the decomposed file treated as managed", result.Managed)
+	}
+	for _, c := range result.Candidates {
+		if strings.Contains(c.Path, "cafe") {
+			t.Fatalf("managed file %q offered again as a candidate", c.Path)
+		}
+	}
+
+	result, err = NewScanner(ScanOptions{Home: home, Roots: []string{root}, IgnorePatterns: []string{nfc}}).Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := result.Ignored["user ignore registry"]; got != 1 {
+		t.Fatalf("composed ignore pattern skipped %d files, want 1", got)
+	}
+	if rel := relPath(filepath.Join(root, nfd), home); rel != "~/.config/app/"+nfc {
+		t.Fatalf("relPath() = %q, want the composed form", rel)
+	}
+}
@@ -25,6 +25,14 @@ import (
 type SecretDetector struct {
 	patterns []*secretPattern
 	runner   runner.Runner
+	allow    SecretAllowlist
+
+	// allowlists and gitleaksConfig come from the repo's .gitleaks.toml.
+	allowlists     []secretAllowlist
+	gitleaksConfig string
+
+	// profile, when set, times each pattern and the scan as a whole.
+	profile *Profile
 }
 
 // secretPattern defines a pattern to match potential secrets.
@@ -32,17 +40,84 @@ type secretPattern struct {
 	Name    string
 	Regex   *regexp.Regexp
 	Entropy float64 // Minimum entropy threshold (0 = disabled)
+
+	// Path, Keywords, and Allow come from gitleaks rules: the rule only
+	// applies to matching paths and lines containing a keyword, and its
+	// allowlists suppress matches.
+	Path     *regexp.Regexp
+	Keywords []string
+	Allow    []secretAllowlist
+}
+
+// applies reports whether the pattern's path and keyword filters admit line.
+func (p *secretPattern) applies(path, line string) bool {
+	if p.Path != nil && !p.Path.MatchString(path) {
+		return false
+	}
+	if len(p.Keywords) == 0 {
+		return true
+	}
+	lower := strings.ToLower(line)
+	for _, kw := range p.Keywords {
+		if strings.Contains(lower, strings.ToLower(kw)) {
+			return true
+		}
+	}
+	return false
 }
 
 // SecretFinding represents a potential secret found in a file.
 type SecretFinding struct {
-	File       string
-	Line       int
-	Match      string
-	PatternID  string
-	Confidence string // "high", "medium", "low"
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Match      string `json:"match"`
+	PatternID  string `json:"pattern"`
+	Confidence string `json:"confidence"`       // "high", "medium", "low"
+	Commit     string `json:"commit,omitempty"` // set for findings from git history
+	// Context holds the lines around the match with secrets masked, so a
+	// finding can be judged without opening the file.
+	Context []ContextLine `json:"context,omitempty"`
+}
+
+// ContextLine is one masked line of a finding's surrounding context.
+type ContextLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// Finding confidence levels, weakest first.
+const (
+	ConfidenceLow    = "low"
+	ConfidenceMedium = "medium"
+	ConfidenceHigh   = "high"
+)
+
+// ConfidenceRank orders confidence levels; unknown levels rank 0.
+func ConfidenceRank(level string) int {
+	switch level {
+	case ConfidenceLow:
+		return 1
+	case ConfidenceMedium:
+		return 2
+	case ConfidenceHigh:
+		return 3
+	}
+	return 0
+}
+
+// MeetsThreshold reports whether a finding with confidence level fails a
+// fail_on threshold; an empty threshold fails every finding.
+func MeetsThreshold(level, failOn string) bool {
+	return failOn == "" || ConfidenceRank(level) >= ConfidenceRank(failOn)
 }
 
+// secretContextLines is how many lines before and after a match are kept
+// as context.
+const secretContextLines = 2
+
+// maxContextLineLen truncates long context lines, such as minified JSON.
+const maxContextLineLen = 160
+
 var ErrGitleaksUnavailable = errors.New("gitleaks unavailable")
 
 // NewSecretDetector creates a new secret detector.
@@ -57,6 +132,11 @@ func NewSecretDetector(r runner.Runner) *SecretDetector {
 	}
 }
 
+// SetAllowlist makes UpdateCandidates drop findings accepted earlier.
+func (d *SecretDetector) SetAllowlist(allow SecretAllowlist) {
+	d.allow = allow
+}
+
 // defaultSecretPatterns returns the built-in secret detection patterns.
 // These are similar to gitleaks patterns but simplified for quick scanning.
 func defaultSecretPatterns() []*secretPattern {
@@ -143,6 +223,7 @@ func (d *SecretDetector) ScanFile(ctx context.Context, path string) ([]SecretFin
 	defer file.Close()
 
 	var findings []SecretFinding
+	var masked []string
 	scanner := bufio.NewScanner(file)
 	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
 	lineNum := 0
@@ -151,25 +232,98 @@ func (d *SecretDetector) ScanFile(ctx context.Context, path string) ([]SecretFin
 		lineNum++
 		line := scanner.Text()
 
-		// Check against all patterns
-		for _, pattern := range d.patterns {
-			if ctx.Err() != nil {
-				return findings, ctx.Err()
-			}
+		if ctx.Err() != nil {
+			return findings, ctx.Err()
+		}
+		findings = append(findings, d.scanLine(path, lineNum, line)...)
+		masked = append(masked, d.maskLine(line))
+	}
+
+	for i := range findings {
+		findings[i].Context = contextAround(masked, findings[i].Line)
+	}
+	return findings, scanner.Err()
+}
+
+// maskLine replaces every pattern match in line, then applies the shared
+// redaction rules, so context lines never carry the secret itself.
+func (d *SecretDetector) maskLine(line string) string {
+	for _, pattern := range d.patterns {
+		start := d.profile.start()
+		line = pattern.Regex.ReplaceAllString(line, redactedSecretMatch(""))
+		d.profile.pattern(pattern.Name, start)
+	}
+	line = redact.Text(line)
+	if len(line) > maxContextLineLen {
+		line = line[:maxContextLineLen] + "..."
+	}
+	return line
+}
 
-			if match := pattern.Regex.FindString(line); match != "" {
-				findings = append(findings, SecretFinding{
-					File:       path,
-					Line:       lineNum,
-					Match:      redactedSecretMatch(match),
-					PatternID:  pattern.Name,
-					Confidence: d.confidenceLevel(pattern.Name),
-				})
+// contextAround returns the masked lines within secretContextLines of the
+// 1-based line number.
+func contextAround(masked []string, line int) []ContextLine {
+	first := max(line-secretContextLines, 1)
+	last := min(line+secretContextLines, len(masked))
+	lines := make([]ContextLine, 0, last-first+1)
+	for n := first; n <= last; n++ {
+		lines = append(lines, ContextLine{Line: n, Text: masked[n-1]})
+	}
+	return lines
+}
+
+// FormatContext renders a finding's context lines, marking the matched line
+// with ">".
+func (f SecretFinding) FormatContext() []string {
+	lines := make([]string, 0, len(f.Context))
+	for _, c := range f.Context {
+		marker := " "
+		if c.Line == f.Line {
+			marker = ">"
+		}
+		lines = append(lines, fmt.Sprintf("%s %4d | %s", marker, c.Line, c.Text))
+	}
+	return lines
+}
+
+// scanLine checks one line against all patterns.
+func (d *SecretDetector) scanLine(path string, lineNum int, line string) []SecretFinding {
+	var findings []SecretFinding
+	for _, pattern := range d.patterns {
+		start := d.profile.start()
+		if !pattern.applies(path, line) {
+			d.profile.pattern(pattern.Name, start)
+			continue
+		}
+		match := pattern.Regex.FindString(line)
+		d.profile.pattern(pattern.Name, start)
+		if match != "" {
+			if d.allowed(pattern, path, match, line) {
+				continue
 			}
+			findings = append(findings, SecretFinding{
+				File:       path,
+				Line:       lineNum,
+				Match:      redactedSecretMatch(match),
+				PatternID:  pattern.Name,
+				Confidence: d.confidenceLevel(pattern.Name),
+			})
 		}
 	}
+	return findings
+}
 
-	return findings, scanner.Err()
+// allowed reports whether a gitleaks allowlist, global or the pattern's
+// own, suppresses a match.
+func (d *SecretDetector) allowed(pattern *secretPattern, path, match, line string) bool {
+	for _, list := range [][]secretAllowlist{d.allowlists, pattern.Allow} {
+		for _, a := range list {
+			if a.allows(path, match, line) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func redactedSecretMatch(_ string) string {
@@ -240,6 +394,12 @@ func (d *SecretDetector) ScanWithGitleaks(ctx context.Context, paths []string) (
 }
 
 func (d *SecretDetector) scanPathWithGitleaks(ctx context.Context, path string) ([]SecretFinding, error) {
+	return d.runGitleaks(ctx, path, "--no-git", "--source", path)
+}
+
+// runGitleaks runs gitleaks detect with the given source args and parses its
+// redacted JSON report.
+func (d *SecretDetector) runGitleaks(ctx context.Context, fallbackFile string, sourceArgs ...string) ([]SecretFinding, error) {
 	report, err := os.CreateTemp("", "dotstate-gitleaks-*.json")
 	if err != nil {
 		return nil, err
@@ -250,15 +410,17 @@ func (d *SecretDetector) scanPathWithGitleaks(ctx context.Context, path string)
 	}
 	defer os.Remove(reportPath)
 
-	result, runErr := d.runner.Run(ctx, "", "gitleaks",
-		"detect",
-		"--no-git",
-		"--source", path,
+	args := append([]string{"detect"}, sourceArgs...)
+	if d.gitleaksConfig != "" {
+		args = append(args, "--config", d.gitleaksConfig)
+	}
+	args = append(args,
 		"--report-format", "json",
 		"--report-path", reportPath,
 		"--redact",
 		"--exit-code", "1",
 	)
+	result, runErr := d.runner.Run(ctx, "", "gitleaks", args...)
 	if runErr != nil && runner.ExitCode(runErr) != 1 {
 		return nil, runErr
 	}
@@ -270,7 +432,7 @@ func (d *SecretDetector) scanPathWithGitleaks(ctx context.Context, path string)
 	if strings.TrimSpace(string(data)) == "" && result != nil {
 		data = []byte(result.Stdout)
 	}
-	return parseGitleaksJSON(data, path)
+	return parseGitleaksJSON(data, fallbackFile)
 }
 
 type gitleaksJSONFinding struct {
@@ -280,6 +442,7 @@ type gitleaksJSONFinding struct {
 	FileAlt   string `json:"file"`
 	StartLine int    `json:"StartLine"`
 	Line      int    `json:"Line"`
+	Commit    string `json:"Commit"`
 }
 
 func parseGitleaksJSON(data []byte, fallbackFile string) ([]SecretFinding, error) {
@@ -303,7 +466,8 @@ func parseGitleaksJSON(data []byte, fallbackFile string) ([]SecretFinding, error
 			Line:       line,
 			Match:      redactedSecretMatch(""),
 			PatternID:  redact.Text(patternID),
-			Confidence: "high",
+			Confidence: ConfidenceHigh,
+			Commit:     item.Commit,
 		})
 	}
 	return findings, nil
@@ -338,7 +502,7 @@ func (d *SecretDetector) confidenceLevel(patternID string) string {
 	}
 
 	if highConfidence[patternID] {
-		return "high"
+		return ConfidenceHigh
 	}
 
 	lowConfidence := map[string]bool{
@@ -349,14 +513,15 @@ func (d *SecretDetector) confidenceLevel(patternID string) string {
 	}
 
 	if lowConfidence[patternID] {
-		return "low"
+		return ConfidenceLow
 	}
 
-	return "medium"
+	return ConfidenceMedium
 }
 
 // UpdateCandidates updates candidates with secret scan findings.
 func (d *SecretDetector) UpdateCandidates(ctx context.Context, candidates CandidateList) error {
+	defer d.profile.stage(ProfileStageSecrets, d.profile.start())
 	for _, c := range candidates {
 		if c.IsDir || c.IsSubRepo {
 			continue
@@ -375,6 +540,17 @@ func (d *SecretDetector) UpdateCandidates(ctx context.Context, candidates Candid
 			continue
 		}
 
+		kept := findings[:0]
+		for _, f := range findings {
+			if d.allow.Allows(f, c.RelPath) {
+				c.SecretsAllowed = true
+				continue
+			}
+			kept = append(kept, f)
+		}
+		findings = kept
+		c.SecretFindings = findings
+
 		if len(findings) > 0 {
 			// Downgrade to Risky if secrets found
 			if c.Category == CategoryRecommended || c.Category == CategoryMaybe {
@@ -382,8 +558,14 @@ func (d *SecretDetector) UpdateCandidates(ctx context.Context, candidates Candid
 			}
 
 			for _, f := range findings {
-				c.SecretWarnings = append(c.SecretWarnings,
-					f.PatternID+": "+f.Match+" (line "+strconv.Itoa(f.Line)+")")
+				if ConfidenceRank(f.Confidence) > ConfidenceRank(c.SecretConfidence) {
+					c.SecretConfidence = f.Confidence
+				}
+				warning := f.PatternID + ": " + f.Match + " (line " + strconv.Itoa(f.Line) + ")"
+				for _, line := range f.FormatContext() {
+					warning += "\n" + line
+				}
+				c.SecretWarnings = append(c.SecretWarnings, warning)
 			}
 			c.Reasons = append(c.Reasons, "potential secrets detected")
 		}
@@ -391,3 +573,44 @@ func (d *SecretDetector) UpdateCandidates(ctx context.Context, candidates Candid
 
 	return nil
 }
+
+// secretsModeFor returns the chezmoi secrets mode to add c with. Files
+// whose findings were accepted, in a prompt review or through the
+// allowlist, and, with a fail_on threshold in error mode, files whose
+// findings are all below it are added with a warning instead of failing
+// chezmoi's own scan.
+func (o Options) secretsModeFor(c *Candidate) string {
+	switch {
+	case o.SecretsMode == SecretsModePrompt:
+		if c.SecretsAllowed || len(c.SecretFindings) > 0 {
+			return SecretsModeWarning
+		}
+		return SecretsModeError
+	case o.SecretsMode != SecretsModeError:
+		return o.SecretsMode
+	case c.SecretConfidence == "":
+		if c.SecretsAllowed {
+			return SecretsModeWarning
+		}
+		return SecretsModeError
+	case o.FailOn == "" || MeetsThreshold(c.SecretConfidence, o.FailOn):
+		return SecretsModeError
+	}
+	return SecretsModeWarning
+}
+
+// blockedBySecrets returns the candidates whose findings meet the fail_on
+// threshold in error mode. Without a threshold nothing is blocked here and
+// chezmoi's --secrets=error remains the guardrail.
+func (o Options) blockedBySecrets(candidates []*Candidate) []*Candidate {
+	if o.SecretsMode != SecretsModeError || o.FailOn == "" {
+		return nil
+	}
+	var blocked []*Candidate
+	for _, c := range candidates {
+		if c.SecretConfidence != "" && MeetsThreshold(c.SecretConfidence, o.FailOn) {
+			blocked = append(blocked, c)
+		}
+	}
+	return blocked
+}
@@ -196,6 +196,41 @@ func TestSecretDetector_RedactsDisplayedMatches(t *testing.T) {
 	}
 }
 
+func TestSecretDetectorScanFileCapturesMaskedContext(t *testing.T) {
+	const secret = "hunter2hunter2"
+	path := filepath.Join(t.TempDir(), "db.conf")
+	content := "[server]\nhost = db.internal\npassword = " + secret + "\nport = 5432\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := NewSecretDetector(nil).ScanFile(context.Background(), path)
+	if err != nil || len(findings) != 1 {
+		t.Fatalf("ScanFile() = %v, %v; want one finding", findings, err)
+	}
+	got := strings.Join(findings[0].FormatContext(), "\n")
+	want := strings.Join([]string{
+		"     1 | [server]",
+		"     2 | host = db.internal",
+		">    3 | <redacted:secret>",
+		"     4 | port = 5432",
+	}, "\n")
+	if got != want {
+		t.Fatalf("context =\n%s\nwant\n%s", got, want)
+	}
+
+	candidate := &Candidate{Path: path, RelPath: "~/db.conf", Category: CategoryMaybe}
+	if err := NewSecretDetector(nil).UpdateCandidates(context.Background(), CandidateList{candidate}); err != nil {
+		t.Fatal(err)
+	}
+	if len(candidate.SecretWarnings) != 1 || !strings.Contains(candidate.SecretWarnings[0], "\n>    3 | <redacted:secret>") {
+		t.Fatalf("warnings = %q, want context appended", candidate.SecretWarnings)
+	}
+	if strings.Contains(candidate.SecretWarnings[0], secret) {
+		t.Fatalf("warning leaked the secret: %q", candidate.SecretWarnings[0])
+	}
+}
+
 func TestSecretDetectorScanFileRejectsNonRegularFiles(t *testing.T) {
 	d := NewSecretDetector(nil)
 	_, err := d.ScanFile(context.Background(), t.TempDir())
@@ -0,0 +1,146 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/native"
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+// ConvertToSubmodule tracks a sub-repository as a git submodule of the
+// dotfiles repo instead of a state/subrepos.toml entry. The submodule lives
+// at the source state path for the entry's target (home/dot_config/nvim for
+// ~/.config/nvim), so applying the source state writes its files in place.
+// The entry is removed from the manifest if present. It returns the
+// submodule path relative to the repo root; committing is left to the
+// caller.
+func ConvertToSubmodule(ctx context.Context, cfg *config.Config, g *gitx.Git, home string, entry SubRepoManifest) (string, error) {
+	url, _ := sanitizeGitRemoteURL(entry.URL)
+	if url == "" {
+		return "", fmt.Errorf("sub-repo %s has no remote to add as a submodule", redact.Text(entry.Path))
+	}
+	rel, err := subRepoTarget(entry.Path, home)
+	if err != nil {
+		return "", err
+	}
+	dir, err := native.SourceDirPath(cfg.SourcePath(), home, rel)
+	if err != nil {
+		return "", fmt.Errorf("locate source path for %s: %w", redact.Text(entry.Path), err)
+	}
+	if _, err := os.Lstat(dir); err == nil {
+		return "", fmt.Errorf("%s is already part of the source state at %s", redact.Text(entry.Path), redact.Text(dir))
+	}
+	subPath, err := filepath.Rel(cfg.RepoRoot(), dir)
+	if err != nil {
+		return "", err
+	}
+	subPath = filepath.ToSlash(subPath)
+	if err := g.SubmoduleAdd(ctx, cfg.RepoRoot(), url, subPath, entry.Branch, entry.CloneDepth()); err != nil {
+		return "", fmt.Errorf("add submodule %s: %w", redact.Text(subPath), err)
+	}
+	if err := RemoveSubRepo(filepath.Join(cfg.StatePath(), "subrepos.toml"), entry.Path); err != nil {
+		return "", err
+	}
+	return subPath, nil
+}
+
+// subRepoTarget returns a manifest path relative to home, slash-separated.
+func subRepoTarget(path, home string) (string, error) {
+	path = strings.TrimSpace(path)
+	if rest, ok := strings.CutPrefix(filepath.ToSlash(path), "~/"); ok {
+		path = rest
+	} else if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(home, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return "", fmt.Errorf("sub-repo %s is not under the home directory", redact.Text(path))
+		}
+		path = rel
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+	if path == "." || strings.HasPrefix(path, "../") {
+		return "", fmt.Errorf("sub-repo %s is not under the home directory", redact.Text(path))
+	}
+	return path, nil
+}
+
+// AddSubRepo declares entry in the manifest at manifestPath. The path is
+// stored relative to home like dot discover stores it, and credentials are
+// stripped from the URL. An entry for the same target is replaced, keeping
+// its description unless entry has one. It returns the stored entry and
+// whether it replaced another.
+func AddSubRepo(manifestPath, home string, entry SubRepoManifest) (SubRepoManifest, bool, error) {
+	rel, err := subRepoTarget(entry.Path, home)
+	if err != nil {
+		return entry, false, err
+	}
+	entry.Path = rel
+	entry.URL, _ = sanitizeGitRemoteURL(entry.URL)
+	if entry.URL == "" {
+		return entry, false, fmt.Errorf("sub-repo %s has no remote URL", redact.Text(rel))
+	}
+	manifest, err := readSubRepoManifest(manifestPath)
+	if err != nil {
+		return entry, false, err
+	}
+	replaced := false
+	for i, existing := range manifest.SubRepos {
+		if target, err := subRepoTarget(existing.Path, home); err != nil || target != rel {
+			continue
+		}
+		if entry.Description == "" {
+			entry.Description = existing.Description
+		}
+		manifest.SubRepos[i], replaced = entry, true
+		break
+	}
+	if !replaced {
+		manifest.SubRepos = append(manifest.SubRepos, entry)
+		sort.Slice(manifest.SubRepos, func(i, j int) bool {
+			return manifest.SubRepos[i].Path < manifest.SubRepos[j].Path
+		})
+	}
+	return entry, replaced, writeSubRepoManifest(manifestPath, manifest)
+}
+
+// RemoveSubRepo drops the entry for path from the manifest at
+// manifestPath, leaving the file untouched when there is none.
+func RemoveSubRepo(manifestPath, path string) error {
+	manifest, err := readSubRepoManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	kept := manifest.SubRepos[:0]
+	for _, entry := range manifest.SubRepos {
+		if entry.Path != path {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(manifest.SubRepos) {
+		return nil
+	}
+	manifest.SubRepos = kept
+	return writeSubRepoManifest(manifestPath, manifest)
+}
+
+func writeSubRepoManifest(path string, manifest SubReposManifest) error {
+	data, err := toml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("marshal sub-repo manifest: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write sub-repo manifest: %w", err)
+	}
+	return nil
+}
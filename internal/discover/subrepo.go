@@ -340,6 +340,21 @@ type SubRepoManifest struct {
 
 	// Description is an optional description.
 	Description string `toml:"description,omitempty"`
+
+	// Shallow clones only recent history; nil means true.
+	Shallow *bool `toml:"shallow,omitempty"`
+
+	// Depth is how many commits a shallow clone fetches; 0 means 1.
+	Depth int `toml:"depth,omitempty"`
+}
+
+// CloneDepth returns the --depth for cloning the entry, or 0 for a full
+// clone.
+func (m SubRepoManifest) CloneDepth() int {
+	if m.Shallow != nil && !*m.Shallow {
+		return 0
+	}
+	return max(m.Depth, 1)
 }
 
 // ToManifest converts a Candidate to a SubRepoManifest.
@@ -0,0 +1,151 @@
+package discover
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/dnery/dotstate/dot/internal/i18n"
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+// sortOrders are the orderings the review prompt's "sort" command accepts.
+var sortOrders = map[string]func(a, b *Candidate) bool{
+	"size":  func(a, b *Candidate) bool { return a.Size > b.Size },
+	"path":  func(a, b *Candidate) bool { return a.RelPath < b.RelPath },
+	"score": func(a, b *Candidate) bool { return a.Score > b.Score },
+	"mtime": func(a, b *Candidate) bool { return a.ModTime.After(b.ModTime) },
+}
+
+// reviewView is how the review prompt lists candidates: the order within
+// each category, and whether files sharing a directory are collapsed into
+// one line.
+type reviewView struct {
+	sortBy    string
+	collapsed bool
+}
+
+// arrange reorders list in place. Collapsing keeps each directory's files
+// contiguous, ordered by the directory's first file, so a collapsed line
+// covers one item range.
+func (v reviewView) arrange(list CandidateList) {
+	if less := sortOrders[v.sortBy]; less != nil {
+		sort.SliceStable(list, func(i, j int) bool { return less(list[i], list[j]) })
+	}
+	if !v.collapsed {
+		return
+	}
+	rank := map[string]int{}
+	for _, c := range list {
+		if _, ok := rank[candidateDir(c)]; !ok {
+			rank[candidateDir(c)] = len(rank)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return rank[candidateDir(list[i])] < rank[candidateDir(list[j])] })
+}
+
+// candidateDir is the directory a candidate collapses into.
+func candidateDir(c *Candidate) string {
+	return path.Dir(c.RelPath)
+}
+
+// relist applies view to the category lists and prints them again. Item
+// numbers change with the order, so the selection is carried over by
+// candidate and returned under the new numbers.
+func (p *Prompter) relist(view reviewView, selected map[int]*Candidate, recommended, maybe, risky CandidateList) map[int]*Candidate {
+	chosen := make(map[*Candidate]bool, len(selected))
+	for _, c := range selected {
+		chosen[c] = true
+	}
+	renumbered := make(map[int]*Candidate, len(selected))
+	index := 1
+	for _, list := range []CandidateList{recommended, maybe, risky} {
+		view.arrange(list)
+		for _, c := range list {
+			if chosen[c] {
+				renumbered[index] = c
+			}
+			index++
+		}
+	}
+	p.printSections(view, renumbered, recommended, maybe, risky)
+	return renumbered
+}
+
+// printSections lists the Recommended, Maybe, and Risky candidates with
+// their item numbers and selection marks.
+func (p *Prompter) printSections(view reviewView, selected map[int]*Candidate, recommended, maybe, risky CandidateList) {
+	index := 1
+	for _, section := range []struct {
+		title    string
+		list     CandidateList
+		warnings bool
+	}{
+		{i18n.T("discover.section_recommended"), recommended, false},
+		{i18n.T("discover.section_maybe"), maybe, false},
+		{i18n.T("discover.section_risky"), risky, true},
+	} {
+		if len(section.list) == 0 {
+			continue
+		}
+		fmt.Fprintf(p.out, "=== %s ===\n", section.title)
+		for i := 0; i < len(section.list); {
+			n := 1
+			if view.collapsed {
+				for i+n < len(section.list) && candidateDir(section.list[i+n]) == candidateDir(section.list[i]) {
+					n++
+				}
+			}
+			if n > 1 {
+				p.printCollapsed(index, section.list[i:i+n], selected)
+			} else {
+				c := section.list[i]
+				p.printCandidate(index, c, selectionMark(selected, index, index))
+				if section.warnings {
+					for _, w := range c.SecretWarnings {
+						p.printWarning(w)
+					}
+				}
+			}
+			i += n
+			index += n
+		}
+		fmt.Fprintln(p.out)
+	}
+}
+
+// printCollapsed prints one line for a directory's contiguous items,
+// starting at item number first.
+func (p *Prompter) printCollapsed(first int, items CandidateList, selected map[int]*Candidate) {
+	last := first + len(items) - 1
+	var size int64
+	warnings := 0
+	for _, c := range items {
+		size += c.Size
+		warnings += len(c.SecretWarnings)
+	}
+	detail := i18n.T("discover.collapsed_detail", len(items), humanSize(size))
+	if warnings > 0 {
+		detail += i18n.T("discover.collapsed_warnings", warnings)
+	}
+	fmt.Fprintf(p.out, "  %s %3s. %s/ (%s)\n", selectionMark(selected, first, last), fmt.Sprintf("%d-%d", first, last),
+		redact.Text(candidateDir(items[0])), detail)
+}
+
+// selectionMark is [x] when every item from first to last is selected,
+// [~] when some are, and [ ] otherwise.
+func selectionMark(selected map[int]*Candidate, first, last int) string {
+	count := 0
+	for i := first; i <= last; i++ {
+		if _, ok := selected[i]; ok {
+			count++
+		}
+	}
+	switch count {
+	case 0:
+		return "[ ]"
+	case last - first + 1:
+		return "[x]"
+	}
+	return "[~]"
+}
@@ -0,0 +1,56 @@
+package discover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelistSortsAndKeepsSelection(t *testing.T) {
+	now := time.Now()
+	small := &Candidate{RelPath: "~/.config/b/small", Size: 10, Score: 30, ModTime: now}
+	big := &Candidate{RelPath: "~/.config/a/big", Size: 900, Score: 10, ModTime: now.Add(-time.Hour)}
+	mid := &Candidate{RelPath: "~/.config/b/mid", Size: 100, Score: 20, ModTime: now.Add(-2 * time.Hour)}
+	maybe := CandidateList{small, big, mid}
+	selected := map[int]*Candidate{1: small}
+	p := NewPrompterWithIO(strings.NewReader(""), &bytes.Buffer{}, false)
+
+	selected = p.relist(reviewView{sortBy: "size"}, selected, nil, maybe, nil)
+	if maybe[0] != big || maybe[2] != small || selected[3] != small || len(selected) != 1 {
+		t.Fatalf("size order = %v, selected = %v", maybe, selected)
+	}
+	p.relist(reviewView{sortBy: "mtime"}, selected, nil, maybe, nil)
+	if maybe[0] != small || maybe[2] != mid {
+		t.Fatalf("mtime order = %v", maybe)
+	}
+}
+
+func TestCollapsedListShowsDirectoryRanges(t *testing.T) {
+	maybe := CandidateList{
+		{RelPath: "~/.config/app/a.json", Size: 1024},
+		{RelPath: "~/.gitconfig"},
+		{RelPath: "~/.config/app/b.json", Size: 1024},
+	}
+	recommended := CandidateList{{RelPath: "~/.zshrc"}}
+	selected := map[int]*Candidate{1: recommended[0], 2: maybe[0]}
+	out := &bytes.Buffer{}
+	p := NewPrompterWithIO(strings.NewReader(""), out, false)
+
+	selected = p.relist(reviewView{collapsed: true}, selected, recommended, maybe, nil)
+
+	got := out.String()
+	for _, want := range []string{
+		"[x]   1. ~/.zshrc",
+		"[~] 2-3. ~/.config/app/ (2 items, 2.0 KB)",
+		"[ ]   4. ~/.gitconfig",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("collapsed list missing %q:\n%s", want, got)
+		}
+	}
+	p.parseSelection("+2-3", selected, recommended, maybe, nil, 2, 5)
+	if len(selected) != 3 {
+		t.Fatalf("selecting the collapsed range selected %d items, want 3", len(selected))
+	}
+}
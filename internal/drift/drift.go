@@ -0,0 +1,228 @@
+// Package drift fills in the captured state each machine profile records
+// (its package lists, the hashes of its managed files, and its tool
+// versions), and compares two machines' profiles to explain why they
+// behave differently.
+package drift
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/machine"
+)
+
+// Sources is where Collect reads this machine's state from.
+type Sources struct {
+	Home string
+	// Managed lists the managed targets relative to Home.
+	Managed func(ctx context.Context) ([]string, error)
+	// Source returns the source-state entry managing a target, relative
+	// to the source directory.
+	Source func(ctx context.Context, target string) (string, error)
+	// Packages returns each package manager's captured list.
+	Packages func() (map[string][]string, error)
+	// Tools returns each tool's version.
+	Tools func(ctx context.Context) map[string]string
+}
+
+// Collect records this machine's state in p. Managed targets missing from
+// home, directories, and targets whose source entry is a template, private,
+// or encrypted are left out.
+func (src Sources) Collect(ctx context.Context, p *machine.Profile) error {
+	if src.Tools != nil {
+		p.Tools = src.Tools(ctx)
+	}
+	if src.Packages != nil {
+		pkgs, err := src.Packages()
+		if err != nil {
+			return err
+		}
+		for name, list := range pkgs {
+			if p.Packages == nil {
+				p.Packages = map[string][]string{}
+			}
+			p.Packages[name] = slices.Compact(slices.Sorted(slices.Values(list)))
+		}
+	}
+	if src.Managed != nil {
+		targets, err := src.Managed(ctx)
+		if err != nil {
+			return fmt.Errorf("list managed files: %w", err)
+		}
+		for _, target := range targets {
+			if src.Source != nil {
+				entry, err := src.Source(ctx, target)
+				if err != nil {
+					return fmt.Errorf("find source of %s: %w", target, err)
+				}
+				if sensitive(entry) {
+					continue
+				}
+			}
+			sum, err := fileSum(filepath.Join(src.Home, filepath.FromSlash(target)))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("hash %s: %w", target, err)
+			}
+			if sum == "" {
+				continue
+			}
+			if p.Files == nil {
+				p.Files = map[string]string{}
+			}
+			p.Files[filepath.ToSlash(target)] = sum
+		}
+	}
+	return nil
+}
+
+// sensitive reports whether a source entry, or a directory above it, is a
+// template, private, or encrypted: its rendered content may hold a secret
+// that a committed hash would give away.
+func sensitive(entry string) bool {
+	for _, name := range strings.Split(filepath.ToSlash(entry), "/") {
+		if strings.HasSuffix(name, ".tmpl") || strings.Contains(name, "private_") || strings.Contains(name, "encrypted_") {
+			return true
+		}
+	}
+	return false
+}
+
+// fileSum describes a regular file by its content hash and a symlink by
+// its destination; it returns "" for anything else.
+func fileSum(p string) (string, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		dest, err := os.Readlink(p)
+		if err != nil {
+			return "", err
+		}
+		return "symlink:" + filepath.ToSlash(dest), nil
+	case !info.Mode().IsRegular():
+		return "", nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Report is what differs between machines A and B.
+type Report struct {
+	A        string        `json:"a"`
+	B        string        `json:"b"`
+	Tools    []ToolDiff    `json:"tools"`
+	Packages []PackageDiff `json:"packages"`
+	Files    []FileDiff    `json:"files"`
+}
+
+// ToolDiff is a tool whose version differs; a side without it is "".
+type ToolDiff struct {
+	Tool string `json:"tool"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+// PackageDiff lists one manager's packages found on only one machine.
+// OnlyOn is set instead when only that machine captured the manager.
+type PackageDiff struct {
+	Manager string   `json:"manager"`
+	OnlyA   []string `json:"only_a,omitempty"`
+	OnlyB   []string `json:"only_b,omitempty"`
+	OnlyOn  string   `json:"only_on,omitempty"`
+}
+
+// FileDiff is a managed file whose content differs; a side without it is
+// "".
+type FileDiff struct {
+	Path string `json:"path"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+// Empty reports whether the machines match.
+func (r *Report) Empty() bool {
+	return len(r.Tools) == 0 && len(r.Packages) == 0 && len(r.Files) == 0
+}
+
+// Compare reports what differs between machines a and b.
+func Compare(a, b *machine.Profile) *Report {
+	r := &Report{A: a.ID, B: b.ID, Tools: []ToolDiff{}, Packages: []PackageDiff{}, Files: []FileDiff{}}
+	for _, tool := range keys(a.Tools, b.Tools) {
+		if a.Tools[tool] != b.Tools[tool] {
+			r.Tools = append(r.Tools, ToolDiff{Tool: tool, A: a.Tools[tool], B: b.Tools[tool]})
+		}
+	}
+	for _, manager := range keys(a.Packages, b.Packages) {
+		listA, okA := a.Packages[manager]
+		listB, okB := b.Packages[manager]
+		switch {
+		case !okB:
+			r.Packages = append(r.Packages, PackageDiff{Manager: manager, OnlyOn: a.ID})
+		case !okA:
+			r.Packages = append(r.Packages, PackageDiff{Manager: manager, OnlyOn: b.ID})
+		default:
+			d := PackageDiff{Manager: manager, OnlyA: missing(listA, listB), OnlyB: missing(listB, listA)}
+			if len(d.OnlyA)+len(d.OnlyB) > 0 {
+				r.Packages = append(r.Packages, d)
+			}
+		}
+	}
+	for _, file := range keys(a.Files, b.Files) {
+		if a.Files[file] != b.Files[file] {
+			r.Files = append(r.Files, FileDiff{Path: file, A: a.Files[file], B: b.Files[file]})
+		}
+	}
+	return r
+}
+
+// keys returns the keys of both maps, sorted and deduplicated.
+func keys[V any](a, b map[string]V) []string {
+	var out []string
+	for k := range a {
+		out = append(out, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// missing returns the items of list absent from other.
+func missing(list, other []string) []string {
+	have := map[string]bool{}
+	for _, item := range other {
+		have[item] = true
+	}
+	var out []string
+	for _, item := range list {
+		if !have[item] {
+			out = append(out, item)
+		}
+	}
+	return out
+}
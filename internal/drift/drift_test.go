@@ -0,0 +1,111 @@
+package drift
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/machine"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestCollect(t *testing.T) {
+	home := testutil.TempDir(t)
+	testutil.TempFile(t, home, ".zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, home, ".config/nvim/init.lua", "vim.o.number = true\n")
+	testutil.TempFile(t, home, ".gitconfig", "[user]\n\tsigningkey = hunter2\n")
+	testutil.TempFile(t, home, ".ssh/config", "Host *\n")
+	testutil.TempFile(t, home, ".netrc", "password hunter2\n")
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink(".zshrc", filepath.Join(home, ".bashrc")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sources := map[string]string{
+		".gitconfig":  "dot_gitconfig.tmpl",
+		".ssh/config": "private_dot_ssh/config",
+		".netrc":      "encrypted_private_dot_netrc.age",
+	}
+	src := Sources{
+		Home: home,
+		Managed: func(context.Context) ([]string, error) {
+			return []string{".zshrc", ".bashrc", ".config/nvim", ".config/nvim/init.lua", ".gone", ".gitconfig", ".ssh/config", ".netrc"}, nil
+		},
+		Source: func(_ context.Context, target string) (string, error) {
+			if entry, ok := sources[target]; ok {
+				return entry, nil
+			}
+			return "dot_" + strings.TrimPrefix(target, "."), nil
+		},
+		Packages: func() (map[string][]string, error) {
+			return map[string][]string{"brew": {"ripgrep", "fd", "fd"}}, nil
+		},
+		Tools: func(context.Context) map[string]string { return map[string]string{"git": "git version 2.43.0"} },
+	}
+	p := &machine.Profile{ID: "laptop"}
+	if err := src.Collect(context.Background(), p); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if !strings.HasPrefix(p.Files[".zshrc"], "sha256:") || p.Files[".config/nvim/init.lua"] == "" {
+		t.Errorf("Files = %v", p.Files)
+	}
+	if _, ok := p.Files[".config/nvim"]; ok {
+		t.Error("directory recorded as a file")
+	}
+	if _, ok := p.Files[".gone"]; ok {
+		t.Error("file missing from home recorded")
+	}
+	for _, target := range []string{".gitconfig", ".ssh/config", ".netrc"} {
+		if _, ok := p.Files[target]; ok {
+			t.Errorf("%s (%s) recorded", target, sources[target])
+		}
+	}
+	if runtime.GOOS != "windows" && p.Files[".bashrc"] != "symlink:.zshrc" {
+		t.Errorf("symlink = %q", p.Files[".bashrc"])
+	}
+	if got := strings.Join(p.Packages["brew"], ","); got != "fd,ripgrep" {
+		t.Errorf("brew packages = %s, want sorted and deduplicated", got)
+	}
+	if p.Tools["git"] != "git version 2.43.0" {
+		t.Errorf("Tools = %v", p.Tools)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a := &machine.Profile{
+		ID:       "laptop",
+		Tools:    map[string]string{"dot": "1.2.0", "git": "2.43.0", "chezmoi": "2.50.0"},
+		Packages: map[string][]string{"brew": {"fd", "ripgrep"}, "apt": {"htop"}},
+		Files:    map[string]string{".zshrc": "sha256:aa", ".vimrc": "sha256:bb", ".laptop": "sha256:cc"},
+	}
+	b := &machine.Profile{
+		ID:       "desktop",
+		Tools:    map[string]string{"dot": "1.2.0", "git": "2.39.2"},
+		Packages: map[string][]string{"brew": {"fd", "htop"}},
+		Files:    map[string]string{".zshrc": "sha256:aa", ".vimrc": "sha256:dd", ".desktop": "sha256:ee"},
+	}
+	r := Compare(a, b)
+	if len(r.Tools) != 2 || r.Tools[0].Tool != "chezmoi" || r.Tools[0].B != "" || r.Tools[1].Tool != "git" {
+		t.Errorf("Tools = %+v", r.Tools)
+	}
+	if len(r.Packages) != 2 || r.Packages[0].Manager != "apt" || r.Packages[0].OnlyOn != "laptop" {
+		t.Fatalf("Packages = %+v", r.Packages)
+	}
+	if brew := r.Packages[1]; strings.Join(brew.OnlyA, ",") != "ripgrep" || strings.Join(brew.OnlyB, ",") != "htop" {
+		t.Errorf("brew = %+v", brew)
+	}
+	var files []string
+	for _, f := range r.Files {
+		files = append(files, f.Path)
+	}
+	if got := strings.Join(files, ","); got != ".desktop,.laptop,.vimrc" {
+		t.Errorf("Files = %s", got)
+	}
+	if r.Empty() || !Compare(a, a).Empty() {
+		t.Error("Empty() is wrong")
+	}
+}
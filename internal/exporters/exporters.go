@@ -0,0 +1,117 @@
+// Package exporters is the plug-in point for OS-state exporters (package
+// lists, registry dumps, defaults, ...). Each enabled exporter runs inside
+// the module orchestrator, so capture and apply report one structured result
+// per exporter.
+package exporters
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	gosync "sync"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/platform"
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+// Exporter captures one slice of OS state into the repo and applies it back.
+type Exporter interface {
+	Name() string
+	Supported(p *platform.Platform) bool
+	Capture(ctx context.Context) (Result, error)
+	Apply(ctx context.Context) (Result, error)
+}
+
+// CaptureDiffer is an Exporter that can tell, without writing anything,
+// whether Capture would change the repo. Its module plans an unchanged
+// capture as a no-op; other exporters always plan an update.
+type CaptureDiffer interface {
+	CaptureChanged(ctx context.Context) (bool, error)
+}
+
+// Result describes what an exporter did. Paths are repo-relative artifacts
+// written on capture or local targets touched on apply.
+type Result struct {
+	Changed bool
+	Paths   []string
+	Message string
+}
+
+// Env is what factories receive when building an exporter.
+type Env struct {
+	Config   *config.Config
+	Platform *platform.Platform
+	Runner   runner.Runner
+}
+
+// Factory builds an exporter for env.
+type Factory func(env Env) Exporter
+
+var (
+	registryMu gosync.Mutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes an exporter available under name. It panics on duplicate
+// names, like the standard library's driver registries.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("exporters: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("exporters: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// Names returns the registered exporter names in sorted order.
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enabled builds every registered exporter switched on in [exports] that
+// supports env.Platform, in name order.
+func Enabled(env Env) []Exporter {
+	var out []Exporter
+	for _, name := range Names() {
+		if env.Config == nil || !env.Config.Exports[name] {
+			continue
+		}
+		registryMu.Lock()
+		factory := registry[name]
+		registryMu.Unlock()
+		exp := factory(env)
+		if exp.Supported(env.Platform) {
+			out = append(out, exp)
+		}
+	}
+	return out
+}
+
+// ValidateConfig reports [exports] keys that name no registered exporter.
+func ValidateConfig(cfg *config.Config) error {
+	var unknown []string
+	for name := range cfg.Exports {
+		registryMu.Lock()
+		_, ok := registry[name]
+		registryMu.Unlock()
+		if !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown exporter(s) in [exports]: %v (available: %v)", unknown, Names())
+}
@@ -0,0 +1,143 @@
+package exporters
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+type fakeExporter struct {
+	name      string
+	supported bool
+	capture   Result
+	err       error
+	calls     []string
+}
+
+func (f *fakeExporter) Name() string                      { return f.name }
+func (f *fakeExporter) Supported(*platform.Platform) bool { return f.supported }
+
+func (f *fakeExporter) Capture(context.Context) (Result, error) {
+	f.calls = append(f.calls, "capture")
+	return f.capture, f.err
+}
+
+func (f *fakeExporter) Apply(context.Context) (Result, error) {
+	f.calls = append(f.calls, "apply")
+	return Result{}, f.err
+}
+
+func register(t *testing.T, exp *fakeExporter) {
+	t.Helper()
+	Register(exp.name, func(Env) Exporter { return exp })
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, exp.name)
+		registryMu.Unlock()
+	})
+}
+
+func TestEnabledHonorsConfigAndPlatform(t *testing.T) {
+	on := &fakeExporter{name: "test-on", supported: true}
+	off := &fakeExporter{name: "test-off", supported: true}
+	unsupported := &fakeExporter{name: "test-unsupported"}
+	register(t, on)
+	register(t, off)
+	register(t, unsupported)
+
+	cfg := &config.Config{Exports: map[string]bool{"test-on": true, "test-off": false, "test-unsupported": true}}
+	got := Enabled(Env{Config: cfg, Platform: &platform.Platform{OS: "linux"}})
+	if len(got) != 1 || got[0].Name() != "test-on" {
+		t.Fatalf("Enabled = %#v, want only test-on", got)
+	}
+}
+
+func TestValidateConfigRejectsUnknownExporters(t *testing.T) {
+	register(t, &fakeExporter{name: "test-known"})
+	if err := ValidateConfig(&config.Config{Exports: map[string]bool{"test-known": true}}); err != nil {
+		t.Fatalf("ValidateConfig error = %v", err)
+	}
+	if err := ValidateConfig(&config.Config{Exports: map[string]bool{"nope": true}}); err == nil {
+		t.Fatal("expected unknown exporter error")
+	}
+}
+
+func TestModuleReportsPerExporterResults(t *testing.T) {
+	changed := &fakeExporter{name: "test-changed", capture: Result{Changed: true, Paths: []string{"state/test/list.txt"}}}
+	unchanged := &fakeExporter{name: "test-unchanged"}
+	orch := modules.NewOrchestrator(NewModule(changed), NewModule(unchanged))
+
+	report, err := orch.Run(context.Background(), modules.OperationCapture, modules.RunOptions{})
+	if err != nil {
+		t.Fatalf("capture error = %v", err)
+	}
+	statuses := map[string]modules.ResultStatus{}
+	for _, res := range report.Results {
+		if res.Phase == modules.PhaseCapture {
+			statuses[res.Surface] = res.Status
+		}
+	}
+	if statuses["export:test-changed"] != modules.StatusCaptured || statuses["export:test-unchanged"] != modules.StatusNoop {
+		t.Fatalf("statuses = %#v", statuses)
+	}
+	if len(changed.calls) != 1 || changed.calls[0] != "capture" {
+		t.Fatalf("calls = %v, want one capture", changed.calls)
+	}
+}
+
+func TestModuleSurfacesExporterFailure(t *testing.T) {
+	exp := &fakeExporter{name: "test-broken", err: errors.New("boom")}
+	orch := modules.NewOrchestrator(NewModule(exp))
+	if _, err := orch.Run(context.Background(), modules.OperationApply, modules.RunOptions{}); err == nil {
+		t.Fatal("expected exporter failure to fail the run")
+	}
+}
+
+func TestCaptureModuleSkipsApply(t *testing.T) {
+	exp := &fakeExporter{name: "test-capture-only", capture: Result{Changed: true}}
+	orch := modules.NewOrchestrator(NewCaptureModule(exp))
+
+	plan, err := orch.Plan(context.Background(), modules.OperationApply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range plan.Changes {
+		if change.Action != modules.ActionNoop {
+			t.Errorf("apply plans %s for %s", change.Action, change.ID)
+		}
+	}
+	if _, err := orch.Run(context.Background(), modules.OperationCapture, modules.RunOptions{}); err != nil {
+		t.Fatalf("capture error = %v", err)
+	}
+	if len(exp.calls) != 1 || exp.calls[0] != "capture" {
+		t.Fatalf("calls = %v, want one capture", exp.calls)
+	}
+}
+
+type differExporter struct {
+	fakeExporter
+	changed bool
+}
+
+func (d *differExporter) CaptureChanged(context.Context) (bool, error) { return d.changed, nil }
+
+func TestModulePlansCaptureFromChangeDetection(t *testing.T) {
+	for _, changed := range []bool{false, true} {
+		exp := &differExporter{fakeExporter: fakeExporter{name: "test-differ"}, changed: changed}
+		changes, _, err := NewModule(exp).Plan(context.Background(), modules.OperationCapture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := modules.ActionNoop
+		if changed {
+			want = modules.ActionUpdate
+		}
+		if changes[0].Action != want {
+			t.Errorf("changed=%v: action = %s, want %s", changed, changes[0].Action, want)
+		}
+	}
+}
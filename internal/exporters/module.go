@@ -0,0 +1,157 @@
+package exporters
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/modules"
+)
+
+// SurfacePrefix prefixes the module surface of every exporter.
+const SurfacePrefix = "export:"
+
+// Module adapts an Exporter to the module lifecycle.
+type Module struct {
+	Exporter Exporter
+	// captureOnly plans apply as a no-op, for exporters that only record
+	// this machine's state.
+	captureOnly bool
+	now         func() time.Time
+}
+
+// NewModule wraps exp as an orchestrator module.
+func NewModule(exp Exporter) *Module {
+	return &Module{Exporter: exp, now: time.Now}
+}
+
+// NewCaptureModule wraps exp as an orchestrator module that has nothing to
+// apply.
+func NewCaptureModule(exp Exporter) *Module {
+	m := NewModule(exp)
+	m.captureOnly = true
+	return m
+}
+
+// Modules wraps every enabled exporter for env.
+func Modules(env Env) []modules.Module {
+	var mods []modules.Module
+	for _, exp := range Enabled(env) {
+		mods = append(mods, NewModule(exp))
+	}
+	return mods
+}
+
+func (m *Module) Surface() string { return SurfacePrefix + m.Exporter.Name() }
+
+func (m *Module) Plan(ctx context.Context, operation modules.Operation) ([]modules.Change, []modules.Diagnostic, error) {
+	change := m.baseChange(operation)
+	switch {
+	case operation == modules.OperationApply && m.captureOnly:
+		change.Action = modules.ActionNoop
+	case operation == modules.OperationApply, operation == modules.OperationCapture:
+		change.Action = modules.ActionUpdate
+	default:
+		change.Action = modules.ActionBlocked
+		change.Capability = []modules.Capability{modules.CapabilityUnsupported}
+		change.Diagnostics = []modules.Diagnostic{modules.NewDiagnostic(modules.SeverityError, "exports.operation_unsupported", "Exporters do not support this operation.", m.Surface(), change.ID)}
+	}
+	if d, ok := m.Exporter.(CaptureDiffer); ok && operation == modules.OperationCapture {
+		changed, err := d.CaptureChanged(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("exporter %s plan: %w", m.Exporter.Name(), err)
+		}
+		if !changed {
+			change.Action = modules.ActionNoop
+		}
+	}
+	return []modules.Change{change}, nil, nil
+}
+
+func (m *Module) Backup(context.Context, []modules.Change, *modules.Plan) ([]modules.Backup, []modules.Diagnostic, error) {
+	return nil, nil, nil
+}
+
+func (m *Module) Apply(ctx context.Context, changes []modules.Change, plan *modules.Plan) ([]modules.Result, []modules.Diagnostic, error) {
+	return m.run(ctx, changes, plan, modules.PhaseApply, modules.StatusApplied, m.Exporter.Apply)
+}
+
+func (m *Module) Capture(ctx context.Context, changes []modules.Change, plan *modules.Plan) ([]modules.Result, []modules.Diagnostic, error) {
+	return m.run(ctx, changes, plan, modules.PhaseCapture, modules.StatusCaptured, m.Exporter.Capture)
+}
+
+// Verify is a no-op: exporters own their own consistency checks.
+func (m *Module) Verify(context.Context, modules.Operation, []modules.Change, *modules.Plan) ([]modules.Result, []modules.Diagnostic, error) {
+	return nil, nil, nil
+}
+
+func (m *Module) Restore(context.Context, []modules.Backup) ([]modules.Result, []modules.Diagnostic, error) {
+	return nil, nil, nil
+}
+
+func (m *Module) run(ctx context.Context, changes []modules.Change, plan *modules.Plan, phase modules.Phase, changed modules.ResultStatus, fn func(context.Context) (Result, error)) ([]modules.Result, []modules.Diagnostic, error) {
+	results := make([]modules.Result, 0, len(changes))
+	for _, change := range changes {
+		started := m.now().UTC()
+		res, err := fn(ctx)
+		status := changed
+		if err != nil {
+			status = modules.StatusFailed
+		} else if !res.Changed {
+			status = modules.StatusNoop
+		}
+		paths := make([]any, 0, len(res.Paths))
+		for _, p := range res.Paths {
+			paths = append(paths, p)
+		}
+		current := map[string]any{"changed": res.Changed, "paths": paths}
+		if res.Message != "" {
+			current["message"] = res.Message
+		}
+		results = append(results, modules.Result{
+			SchemaVersion: modules.SchemaResultV1,
+			RunID:         modules.Timestamp(started) + "-" + string(phase) + "-" + m.Exporter.Name(),
+			PlanID:        plan.PlanID,
+			Phase:         phase,
+			Surface:       change.Surface,
+			ID:            change.ID,
+			ChangeID:      change.ChangeID,
+			Source:        change.Source,
+			Current:       current,
+			Desired:       change.Desired,
+			ManagedBy:     change.ManagedBy,
+			Sensitivity:   change.Sensitivity,
+			Confidence:    change.Confidence,
+			Capability:    change.Capability,
+			Risk:          change.Risk,
+			Status:        status,
+			StartedAt:     modules.Timestamp(started),
+			EndedAt:       modules.Timestamp(m.now().UTC()),
+			Diagnostics:   change.Diagnostics,
+		})
+		if err != nil {
+			return results, nil, fmt.Errorf("exporter %s %s: %w", m.Exporter.Name(), phase, err)
+		}
+	}
+	return results, nil, nil
+}
+
+func (m *Module) baseChange(operation modules.Operation) modules.Change {
+	id := m.Surface()
+	return modules.Change{
+		ChangeID:       fmt.Sprintf("%s:%s", id, operation),
+		Surface:        m.Surface(),
+		ID:             id,
+		Action:         modules.ActionNoop,
+		Source:         modules.Source{Kind: "exporter", Value: m.Exporter.Name()},
+		Desired:        map[string]any{"exporter": m.Exporter.Name()},
+		ManagedBy:      []string{"dotstate"},
+		Sensitivity:    modules.SensitivityLocalPath,
+		Confidence:     modules.ConfidenceHigh,
+		Capability:     []modules.Capability{modules.CapabilityAutoApply},
+		Risk:           modules.LowRisk(true),
+		BackupRequired: false,
+		DependsOn:      []string{},
+		Diagnostics:    []modules.Diagnostic{},
+	}
+}
@@ -0,0 +1,333 @@
+// Package forge talks to the GitHub and GitLab APIs on the user's behalf:
+// creating the dotfiles repo, opening pull requests when a sync push falls
+// back to a machine branch, and uploading SSH keys. The API token comes from
+// the secret provider ([forge] token_secret) or the provider's usual
+// environment variable, and is never written to disk or logs.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/redact"
+	"github.com/dnery/dotstate/dot/internal/tmpldata"
+)
+
+// ErrNoToken means no API token is configured for the provider.
+var ErrNoToken = errors.New("no forge API token configured")
+
+// ErrKeyExists means the SSH key is already registered with the account.
+var ErrKeyExists = errors.New("SSH key is already registered")
+
+// requestTimeout bounds a single API call.
+const requestTimeout = 30 * time.Second
+
+// Forge is a hosted git service API.
+type Forge interface {
+	// Provider is config.ForgeGitHub or config.ForgeGitLab.
+	Provider() string
+	// CurrentUser checks the token and reports its account and scopes.
+	CurrentUser(ctx context.Context) (*TokenInfo, error)
+	// CreateRepo creates a repository owned by the token's account.
+	CreateRepo(ctx context.Context, name string, private bool) (*Repo, error)
+	// OpenPullRequest opens a pull (merge) request from head into base in
+	// the project, or returns the open one for head.
+	OpenPullRequest(ctx context.Context, head, base, title, body string) (string, error)
+	// AddSSHKey registers a public key with the account.
+	AddSSHKey(ctx context.Context, title, key string) error
+}
+
+// TokenInfo describes the account behind a token.
+type TokenInfo struct {
+	User string
+	// Scopes lists the token's scopes; ScopesKnown is false when the
+	// service does not report them (e.g. GitHub fine-grained tokens).
+	Scopes      []string
+	ScopesKnown bool
+}
+
+// Repo is a created repository.
+type Repo struct {
+	Project  string
+	WebURL   string
+	CloneURL string
+	SSHURL   string
+}
+
+// Options configures New.
+type Options struct {
+	Provider string
+	// APIURL is the API base; empty uses the public service, or the
+	// self-hosted API on Host.
+	APIURL string
+	// Host is the git host, used to derive APIURL for self-hosted services.
+	Host  string
+	Token string
+	// Project is "owner/name" (GitLab: the full namespace path) for
+	// pull requests.
+	Project string
+	Client  *http.Client
+}
+
+// New returns the API client for opts.Provider.
+func New(opts Options) (Forge, error) {
+	if opts.Token == "" {
+		return nil, ErrNoToken
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: requestTimeout}
+	}
+	switch opts.Provider {
+	case config.ForgeGitHub:
+		if opts.APIURL == "" {
+			opts.APIURL = "https://api.github.com"
+			if opts.Host != "" && opts.Host != "github.com" {
+				opts.APIURL = "https://" + opts.Host + "/api/v3"
+			}
+		}
+		return &gitHub{opts: opts}, nil
+	case config.ForgeGitLab:
+		if opts.APIURL == "" {
+			host := opts.Host
+			if host == "" {
+				host = "gitlab.com"
+			}
+			opts.APIURL = "https://" + host + "/api/v4"
+		}
+		return &gitLab{opts: opts}, nil
+	default:
+		return nil, fmt.Errorf("unknown forge provider %q; set [forge] provider to github or gitlab", opts.Provider)
+	}
+}
+
+// FromConfig builds the client for the repo. remoteURL is the repo's remote
+// (repo.url or origin) and decides the provider and project when [forge]
+// does not.
+func FromConfig(cfg *config.Config, secrets tmpldata.SecretProvider, remoteURL string) (Forge, error) {
+	host, project, _ := ParseRemote(remoteURL)
+	provider := cfg.Forge.Provider
+	if provider == "" {
+		provider = ProviderForHost(host)
+		if provider == "" {
+			return nil, fmt.Errorf("cannot tell the forge for %q; set [forge] provider", host)
+		}
+	}
+	token, err := Token(cfg, secrets, provider)
+	if err != nil {
+		return nil, err
+	}
+	return New(Options{Provider: provider, APIURL: cfg.Forge.APIURL, Host: host, Token: token, Project: project})
+}
+
+// ProviderForHost infers the provider from a public host name.
+func ProviderForHost(host string) string {
+	switch {
+	case host == "github.com":
+		return config.ForgeGitHub
+	case host == "gitlab.com":
+		return config.ForgeGitLab
+	default:
+		return ""
+	}
+}
+
+// tokenEnv lists the environment variables each provider's CLI tools use.
+var tokenEnv = map[string][]string{
+	config.ForgeGitHub: {"GITHUB_TOKEN", "GH_TOKEN"},
+	config.ForgeGitLab: {"GITLAB_TOKEN"},
+}
+
+// resolveRef resolves a secret reference; tests substitute it.
+var resolveRef = config.ResolveSecretRef
+
+// Token returns the API token: the [forge] token_secret entry of the
+// secret provider when set, else the provider's environment variable.
+func Token(cfg *config.Config, secrets tmpldata.SecretProvider, provider string) (string, error) {
+	if name := cfg.Forge.TokenSecret; name != "" {
+		if secrets == nil {
+			return "", fmt.Errorf("forge.token_secret %q: no secret provider configured", name)
+		}
+		ref, ok := secrets.Reference(name)
+		if !ok {
+			return "", fmt.Errorf("forge.token_secret %q is not a known secret", name)
+		}
+		token, err := resolveRef(cfg.Tools.OP, ref)
+		if err != nil {
+			return "", fmt.Errorf("forge token: %w", err)
+		}
+		return token, nil
+	}
+	for _, name := range tokenEnv[provider] {
+		if token := os.Getenv(name); token != "" {
+			return token, nil
+		}
+	}
+	return "", ErrNoToken
+}
+
+// ParseRemote splits a git remote URL (https, ssh://, or scp-like
+// git@host:path) into its host and project path without ".git".
+func ParseRemote(remote string) (host, project string, err error) {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return "", "", fmt.Errorf("empty remote URL")
+	}
+	if !strings.Contains(remote, "://") {
+		userHost, path, ok := strings.Cut(remote, ":")
+		if !ok {
+			return "", "", fmt.Errorf("unrecognized remote URL %q", remote)
+		}
+		_, host, found := strings.Cut(userHost, "@")
+		if !found {
+			host = userHost
+		}
+		return host, trimProject(path), nil
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		return "", "", fmt.Errorf("parse remote URL: %w", err)
+	}
+	return u.Hostname(), trimProject(u.Path), nil
+}
+
+func trimProject(path string) string {
+	return strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+// MissingScopes returns the scopes in need that info lacks. Unknown scopes
+// are never reported missing. GitHub's admin:, write:, and read: prefixes
+// imply the weaker ones.
+func MissingScopes(info *TokenInfo, need []string) []string {
+	if info == nil || !info.ScopesKnown {
+		return nil
+	}
+	have := map[string]bool{}
+	for _, s := range info.Scopes {
+		have[s] = true
+		if rest, ok := strings.CutPrefix(s, "admin:"); ok {
+			have["write:"+rest], have["read:"+rest] = true, true
+		}
+		if rest, ok := strings.CutPrefix(s, "write:"); ok {
+			have["read:"+rest] = true
+		}
+	}
+	var missing []string
+	for _, s := range need {
+		if !have[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// RequiredScopes are the token scopes dotstate uses per provider: creating
+// private repos and pull requests, and uploading SSH keys.
+func RequiredScopes(provider string) []string {
+	switch provider {
+	case config.ForgeGitHub:
+		return []string{"repo", "write:public_key"}
+	case config.ForgeGitLab:
+		return []string{"api"}
+	default:
+		return nil
+	}
+}
+
+// APIError is a non-2xx API response.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("forge API returned %d", e.Status)
+	}
+	return fmt.Sprintf("forge API returned %d: %s", e.Status, e.Message)
+}
+
+// call sends a JSON request and decodes a JSON response into out (when
+// non-nil). Non-2xx responses become *APIError.
+func call(ctx context.Context, client *http.Client, method, endpoint string, header http.Header, in, out any) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("build forge request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("forge request: %s", redact.Text(err.Error()))
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("read forge response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.Header, &APIError{Status: resp.StatusCode, Message: apiMessage(b)}
+	}
+	if out != nil {
+		if err := json.Unmarshal(b, out); err != nil {
+			return resp.Header, fmt.Errorf("parse forge response: %w", err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// apiMessage extracts the human-readable error from a GitHub or GitLab
+// error body.
+func apiMessage(body []byte) string {
+	var e struct {
+		Message any `json:"message"`
+		Error   any `json:"error"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &e) != nil {
+		return redact.Text(strings.TrimSpace(string(body)))
+	}
+	var parts []string
+	for _, v := range []any{e.Message, e.Error} {
+		if v != nil {
+			parts = append(parts, fmt.Sprint(v))
+		}
+	}
+	for _, sub := range e.Errors {
+		if sub.Message != "" {
+			parts = append(parts, sub.Message)
+		}
+	}
+	return redact.Text(strings.Join(parts, "; "))
+}
+
+// statusIs reports whether err is an APIError with the given status whose
+// message contains substr (case-insensitive).
+func statusIs(err error, status int, substr string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == status &&
+		strings.Contains(strings.ToLower(apiErr.Message), strings.ToLower(substr))
+}
@@ -0,0 +1,152 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/tmpldata"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		remote, host, project string
+	}{
+		{"git@github.com:dnery/dotfiles.git", "github.com", "dnery/dotfiles"},
+		{"https://github.com/dnery/dotfiles", "github.com", "dnery/dotfiles"},
+		{"ssh://git@gitlab.example.com:2222/team/sub/dotfiles.git", "gitlab.example.com", "team/sub/dotfiles"},
+	}
+	for _, tt := range tests {
+		host, project, err := ParseRemote(tt.remote)
+		if err != nil || host != tt.host || project != tt.project {
+			t.Errorf("ParseRemote(%q) = %q, %q, %v; want %q, %q", tt.remote, host, project, err, tt.host, tt.project)
+		}
+	}
+	if _, _, err := ParseRemote("not a remote"); err == nil {
+		t.Error("ParseRemote accepted a bare word")
+	}
+}
+
+func TestTokenFromSecretProvider(t *testing.T) {
+	old := resolveRef
+	resolveRef = func(opBin, ref string) (string, error) {
+		if ref != "op://vault/github/token" {
+			t.Fatalf("resolved %q", ref)
+		}
+		return "from-op", nil
+	}
+	t.Cleanup(func() { resolveRef = old })
+	t.Setenv("GITHUB_TOKEN", "from-env")
+
+	cfg := config.Default()
+	cfg.Forge.TokenSecret = "github_token"
+	secrets := &tmpldata.OnePassword{Refs: map[string]string{"github_token": "op://vault/github/token"}}
+	if got, err := Token(cfg, secrets, config.ForgeGitHub); err != nil || got != "from-op" {
+		t.Fatalf("Token() = %q, %v; want from-op", got, err)
+	}
+
+	cfg.Forge.TokenSecret = ""
+	if got, err := Token(cfg, secrets, config.ForgeGitHub); err != nil || got != "from-env" {
+		t.Fatalf("Token() = %q, %v; want from-env", got, err)
+	}
+	t.Setenv("GITLAB_TOKEN", "")
+	if _, err := Token(cfg, secrets, config.ForgeGitLab); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("Token() error = %v, want ErrNoToken", err)
+	}
+}
+
+func TestGitHubCurrentUserScopes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Bad credentials"}`))
+			return
+		}
+		w.Header().Set("X-OAuth-Scopes", "repo, admin:public_key")
+		_, _ = w.Write([]byte(`{"login":"octo"}`))
+	}))
+	defer srv.Close()
+
+	f, err := New(Options{Provider: config.ForgeGitHub, APIURL: srv.URL, Token: "tok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.CurrentUser(context.Background())
+	if err != nil {
+		t.Fatalf("CurrentUser() error = %v", err)
+	}
+	if info.User != "octo" || !info.ScopesKnown {
+		t.Fatalf("CurrentUser() = %+v", info)
+	}
+	if missing := MissingScopes(info, RequiredScopes(config.ForgeGitHub)); len(missing) != 0 {
+		t.Fatalf("MissingScopes() = %v; admin:public_key implies write:public_key", missing)
+	}
+
+	bad, _ := New(Options{Provider: config.ForgeGitHub, APIURL: srv.URL, Token: "wrong"})
+	_, err = bad.CurrentUser(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized || !strings.Contains(err.Error(), "Bad credentials") {
+		t.Fatalf("CurrentUser() error = %v, want 401 Bad credentials", err)
+	}
+}
+
+func TestGitHubOpenPullRequestReusesOpenOne(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/dnery/dotfiles/pulls":
+			var in map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&in)
+			if in["head"] != "dotstate/laptop" || in["base"] != "main" {
+				t.Errorf("request = %v", in)
+			}
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"message":"Validation Failed","errors":[{"message":"A pull request already exists for dnery:dotstate/laptop."}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/dnery/dotfiles/pulls":
+			if r.URL.Query().Get("head") != "dnery:dotstate/laptop" {
+				t.Errorf("query = %v", r.URL.Query())
+			}
+			_, _ = w.Write([]byte(`[{"html_url":"https://github.com/dnery/dotfiles/pull/7"}]`))
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	f, _ := New(Options{Provider: config.ForgeGitHub, APIURL: srv.URL, Token: "tok", Project: "dnery/dotfiles"})
+	url, err := f.OpenPullRequest(context.Background(), "dotstate/laptop", "main", "dot sync from laptop", "")
+	if err != nil || url != "https://github.com/dnery/dotfiles/pull/7" {
+		t.Fatalf("OpenPullRequest() = %q, %v", url, err)
+	}
+}
+
+func TestGitLabMergeRequestAndKeyExists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "tok" {
+			t.Errorf("missing token header")
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.EscapedPath() == "/api/v4/projects/team%2Fdotfiles/merge_requests":
+			_, _ = w.Write([]byte(`{"web_url":"https://gitlab.com/team/dotfiles/-/merge_requests/3"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v4/user/keys":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":{"key":["has already been taken"]}}`))
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	f, _ := New(Options{Provider: config.ForgeGitLab, APIURL: srv.URL + "/api/v4", Token: "tok", Project: "team/dotfiles"})
+	url, err := f.OpenPullRequest(context.Background(), "dotstate/laptop", "main", "t", "b")
+	if err != nil || !strings.HasSuffix(url, "/merge_requests/3") {
+		t.Fatalf("OpenPullRequest() = %q, %v", url, err)
+	}
+	if err := f.AddSSHKey(context.Background(), "laptop", "ssh-ed25519 AAAA"); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("AddSSHKey() error = %v, want ErrKeyExists", err)
+	}
+}
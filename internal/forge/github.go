@@ -0,0 +1,98 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+)
+
+type gitHub struct {
+	opts Options
+}
+
+func (g *gitHub) Provider() string { return config.ForgeGitHub }
+
+func (g *gitHub) call(ctx context.Context, method, path string, in, out any) (http.Header, error) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+g.opts.Token)
+	header.Set("Accept", "application/vnd.github+json")
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	return call(ctx, g.opts.Client, method, strings.TrimRight(g.opts.APIURL, "/")+path, header, in, out)
+}
+
+func (g *gitHub) CurrentUser(ctx context.Context) (*TokenInfo, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	header, err := g.call(ctx, http.MethodGet, "/user", nil, &user)
+	if err != nil {
+		return nil, err
+	}
+	info := &TokenInfo{User: user.Login}
+	// Classic tokens list their scopes; fine-grained tokens send no header.
+	if scopes, ok := header["X-Oauth-Scopes"]; ok {
+		info.ScopesKnown = true
+		for _, s := range strings.Split(strings.Join(scopes, ","), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				info.Scopes = append(info.Scopes, s)
+			}
+		}
+	}
+	return info, nil
+}
+
+func (g *gitHub) CreateRepo(ctx context.Context, name string, private bool) (*Repo, error) {
+	var repo struct {
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+	}
+	in := map[string]any{"name": name, "private": private}
+	if _, err := g.call(ctx, http.MethodPost, "/user/repos", in, &repo); err != nil {
+		return nil, err
+	}
+	return &Repo{Project: repo.FullName, WebURL: repo.HTMLURL, CloneURL: repo.CloneURL, SSHURL: repo.SSHURL}, nil
+}
+
+func (g *gitHub) OpenPullRequest(ctx context.Context, head, base, title, body string) (string, error) {
+	if g.opts.Project == "" {
+		return "", fmt.Errorf("no GitHub repository to open a pull request in")
+	}
+	var pr struct {
+		HTMLURL string `json:"html_url"`
+	}
+	in := map[string]any{"head": head, "base": base, "title": title, "body": body}
+	_, err := g.call(ctx, http.MethodPost, "/repos/"+g.opts.Project+"/pulls", in, &pr)
+	if err == nil {
+		return pr.HTMLURL, nil
+	}
+	if !statusIs(err, http.StatusUnprocessableEntity, "already exists") {
+		return "", err
+	}
+	owner, _, _ := strings.Cut(g.opts.Project, "/")
+	var open []struct {
+		HTMLURL string `json:"html_url"`
+	}
+	query := url.Values{"head": {owner + ":" + head}, "state": {"open"}}
+	if _, err := g.call(ctx, http.MethodGet, "/repos/"+g.opts.Project+"/pulls?"+query.Encode(), nil, &open); err != nil {
+		return "", err
+	}
+	if len(open) == 0 {
+		return "", fmt.Errorf("GitHub reports a pull request for %s exists but none is open", head)
+	}
+	return open[0].HTMLURL, nil
+}
+
+func (g *gitHub) AddSSHKey(ctx context.Context, title, key string) error {
+	in := map[string]any{"title": title, "key": key}
+	_, err := g.call(ctx, http.MethodPost, "/user/keys", in, nil)
+	if statusIs(err, http.StatusUnprocessableEntity, "already in use") {
+		return ErrKeyExists
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+)
+
+type gitLab struct {
+	opts Options
+}
+
+func (g *gitLab) Provider() string { return config.ForgeGitLab }
+
+func (g *gitLab) call(ctx context.Context, method, path string, in, out any) (http.Header, error) {
+	header := http.Header{}
+	header.Set("PRIVATE-TOKEN", g.opts.Token)
+	return call(ctx, g.opts.Client, method, strings.TrimRight(g.opts.APIURL, "/")+path, header, in, out)
+}
+
+func (g *gitLab) CurrentUser(ctx context.Context) (*TokenInfo, error) {
+	var user struct {
+		Username string `json:"username"`
+	}
+	if _, err := g.call(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return nil, err
+	}
+	info := &TokenInfo{User: user.Username}
+	// Only personal, project, and group access tokens can describe
+	// themselves; other token types leave the scopes unknown.
+	var self struct {
+		Scopes []string `json:"scopes"`
+	}
+	_, err := g.call(ctx, http.MethodGet, "/personal_access_tokens/self", nil, &self)
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		info.Scopes, info.ScopesKnown = self.Scopes, true
+	case errors.As(err, &apiErr):
+	default:
+		return nil, err
+	}
+	return info, nil
+}
+
+func (g *gitLab) CreateRepo(ctx context.Context, name string, private bool) (*Repo, error) {
+	var project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		WebURL            string `json:"web_url"`
+		HTTPURL           string `json:"http_url_to_repo"`
+		SSHURL            string `json:"ssh_url_to_repo"`
+	}
+	visibility := "public"
+	if private {
+		visibility = "private"
+	}
+	in := map[string]any{"name": name, "visibility": visibility}
+	if _, err := g.call(ctx, http.MethodPost, "/projects", in, &project); err != nil {
+		return nil, err
+	}
+	return &Repo{Project: project.PathWithNamespace, WebURL: project.WebURL, CloneURL: project.HTTPURL, SSHURL: project.SSHURL}, nil
+}
+
+func (g *gitLab) OpenPullRequest(ctx context.Context, head, base, title, body string) (string, error) {
+	if g.opts.Project == "" {
+		return "", fmt.Errorf("no GitLab project to open a merge request in")
+	}
+	path := "/projects/" + url.PathEscape(g.opts.Project) + "/merge_requests"
+	var mr struct {
+		WebURL string `json:"web_url"`
+	}
+	in := map[string]any{"source_branch": head, "target_branch": base, "title": title, "description": body}
+	_, err := g.call(ctx, http.MethodPost, path, in, &mr)
+	if err == nil {
+		return mr.WebURL, nil
+	}
+	if !statusIs(err, http.StatusConflict, "already exists") {
+		return "", err
+	}
+	var open []struct {
+		WebURL string `json:"web_url"`
+	}
+	query := url.Values{"source_branch": {head}, "state": {"opened"}}
+	if _, err := g.call(ctx, http.MethodGet, path+"?"+query.Encode(), nil, &open); err != nil {
+		return "", err
+	}
+	if len(open) == 0 {
+		return "", fmt.Errorf("GitLab reports a merge request for %s exists but none is open", head)
+	}
+	return open[0].WebURL, nil
+}
+
+func (g *gitLab) AddSSHKey(ctx context.Context, title, key string) error {
+	in := map[string]any{"title": title, "key": key}
+	_, err := g.call(ctx, http.MethodPost, "/user/keys", in, nil)
+	if statusIs(err, http.StatusBadRequest, "has already been taken") {
+		return ErrKeyExists
+	}
+	return err
+}
@@ -3,12 +3,15 @@ package gitx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/dnery/dotstate/dot/internal/diffstat"
 	"github.com/dnery/dotstate/dot/internal/runner"
 )
 
@@ -76,6 +79,17 @@ func (g *Git) EnsureCloned(ctx context.Context, repoURL, repoPath, branch string
 	return nil
 }
 
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
 func isDirEmpty(path string) (bool, error) {
 	entries, err := os.ReadDir(path)
 	if err != nil {
@@ -102,6 +116,23 @@ func (g *Git) HasChanges(ctx context.Context, repoPath string) (bool, error) {
 	return status != "", nil
 }
 
+// LFSAvailable reports whether the git-lfs extension is installed.
+func (g *Git) LFSAvailable(ctx context.Context) bool {
+	_, err := g.R.Run(ctx, "", g.Bin, "lfs", "version")
+	return err == nil
+}
+
+// LFSTrack routes the given repo-relative files through git-lfs by adding
+// literal filename entries to .gitattributes.
+func (g *Git) LFSTrack(ctx context.Context, repoPath string, files ...string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	args := append([]string{"lfs", "track", "--filename", "--"}, files...)
+	_, err := g.R.Run(ctx, repoPath, g.Bin, args...)
+	return err
+}
+
 // AddAll stages all changes.
 func (g *Git) AddAll(ctx context.Context, repoPath string) error {
 	_, err := g.R.Run(ctx, repoPath, g.Bin, "add", "-A")
@@ -129,16 +160,20 @@ func (g *Git) Commit(ctx context.Context, repoPath, message string) (bool, error
 	if !hasChanges {
 		return false, nil
 	}
-
-	if err := g.AddAll(ctx, repoPath); err != nil {
+	if err := g.CommitAll(ctx, repoPath, message); err != nil {
 		return false, err
 	}
+	return true, nil
+}
 
-	_, err = g.R.Run(ctx, repoPath, g.Bin, "commit", "-m", message)
-	if err != nil {
-		return false, err
+// CommitAll stages and commits everything without first checking that
+// there is something to commit.
+func (g *Git) CommitAll(ctx context.Context, repoPath, message string) error {
+	if err := g.AddAll(ctx, repoPath); err != nil {
+		return err
 	}
-	return true, nil
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "commit", "-m", message)
+	return err
 }
 
 // PullRebase pulls and rebases with autostash.
@@ -147,12 +182,245 @@ func (g *Git) PullRebase(ctx context.Context, repoPath string) error {
 	return err
 }
 
+// ConflictedFiles returns repo-relative paths with unresolved merge conflicts.
+func (g *Git) ConflictedFiles(ctx context.Context, repoPath string) ([]string, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(res.Stdout), nil
+}
+
+// CheckoutConflictSide resolves conflicted paths by taking one side of the
+// merge ("ours" or "theirs" in git's terms) and staging the result.
+func (g *Git) CheckoutConflictSide(ctx context.Context, repoPath, side string, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	if side != "ours" && side != "theirs" {
+		return fmt.Errorf("invalid conflict side: %s", side)
+	}
+	args := append([]string{"checkout", "--" + side, "--"}, paths...)
+	if _, err := g.R.Run(ctx, repoPath, g.Bin, args...); err != nil {
+		return err
+	}
+	return g.Add(ctx, repoPath, append([]string{"--"}, paths...)...)
+}
+
+// Conflict is an unmerged path with the two-letter code git status
+// --porcelain gives it: UU when both sides modified it, AA when both added
+// it, and a D on the side that deleted it (DU, UD, DD).
+type Conflict struct {
+	Path string
+	Code string
+}
+
+// Deleted reports whether side ("ours" or "theirs" in git's terms) deleted
+// the path.
+func (c Conflict) Deleted(side string) bool {
+	if len(c.Code) != 2 {
+		return false
+	}
+	if side == "ours" {
+		return c.Code[0] == 'D'
+	}
+	return c.Code[1] == 'D'
+}
+
+// Conflicts lists the unmerged paths with how each side changed them.
+func (g *Git) Conflicts(ctx context.Context, repoPath string) ([]Conflict, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "status", "--porcelain", "-z", "--untracked-files=no")
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []Conflict
+	entries := strings.Split(res.Stdout, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		code := entry[:2]
+		switch {
+		case code[0] == 'R' || code[0] == 'C':
+			// Renames and copies are followed by their source path.
+			i++
+		case strings.Contains(code, "U") || code == "AA" || code == "DD":
+			conflicts = append(conflicts, Conflict{Path: entry[3:], Code: code})
+		}
+	}
+	return conflicts, nil
+}
+
+// RemoveConflicted resolves conflicted paths as deleted.
+func (g *Git) RemoveConflicted(ctx context.Context, repoPath string, paths ...string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	args := append([]string{"rm", "--quiet", "--"}, paths...)
+	_, err := g.R.Run(ctx, repoPath, g.Bin, args...)
+	return err
+}
+
+// RebaseContinue continues an in-progress rebase without opening an editor.
+func (g *Git) RebaseContinue(ctx context.Context, repoPath string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "-c", "core.editor=true", "rebase", "--continue")
+	return err
+}
+
+// RebaseAbort stops an in-progress rebase and restores the branch to where
+// it was before the rebase started.
+func (g *Git) RebaseAbort(ctx context.Context, repoPath string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "rebase", "--abort")
+	return err
+}
+
+// RebaseInProgress reports whether a rebase has stopped in the repo and is
+// waiting to be continued or aborted.
+func (g *Git) RebaseInProgress(ctx context.Context, repoPath string) (bool, error) {
+	dir, err := g.GitDir(ctx, repoPath)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range []string{"rebase-merge", "rebase-apply"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Commit describes a commit in the repo history.
+type Commit struct {
+	Hash    string
+	Subject string
+	// SyncHost is the commit's Sync-Host trailer, if any.
+	SyncHost string
+}
+
+// Log returns up to limit commits reachable from HEAD, newest first.
+func (g *Git) Log(ctx context.Context, repoPath string, limit int) ([]Commit, error) {
+	args := []string{"log", "--format=%H%x1f%s%x1f%(trailers:key=" + TrailerSyncHost + ",valueonly,separator=%x2C)"}
+	if limit > 0 {
+		args = append(args, fmt.Sprintf("-n%d", limit))
+	}
+	res, err := g.R.Run(ctx, repoPath, g.Bin, args...)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, line := range splitLines(res.Stdout) {
+		fields := strings.SplitN(line, "\x1f", 3)
+		c := Commit{Hash: fields[0]}
+		if len(fields) > 1 {
+			c.Subject = fields[1]
+		}
+		if len(fields) > 2 {
+			c.SyncHost = fields[2]
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// Revert creates a new commit that undoes the given commit.
+func (g *Git) Revert(ctx context.Context, repoPath, rev string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "revert", "--no-edit", rev)
+	return err
+}
+
+// RestorePaths makes paths in the index and working tree match rev,
+// removing tracked files rev does not have.
+func (g *Git) RestorePaths(ctx context.Context, repoPath, rev string, paths ...string) error {
+	args := append([]string{"restore", "--source=" + rev, "--staged", "--worktree", "--"}, paths...)
+	_, err := g.R.Run(ctx, repoPath, g.Bin, args...)
+	return err
+}
+
 // Push pushes to the remote.
 func (g *Git) Push(ctx context.Context, repoPath string) error {
 	_, err := g.R.Run(ctx, repoPath, g.Bin, "push")
 	return err
 }
 
+// Fetch updates the remote-tracking branches from the default remote, so
+// AheadBehind counts against the remote's current state.
+func (g *Git) Fetch(ctx context.Context, repoPath string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "fetch", "--quiet")
+	return err
+}
+
+// FastForward moves the current branch to its upstream, failing rather
+// than merging when the two have diverged.
+func (g *Git) FastForward(ctx context.Context, repoPath string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "merge", "--ff-only", "--quiet", "@{upstream}")
+	return err
+}
+
+// Clone clones url into dest with branch checked out, or the remote's
+// default when branch is empty. A positive depth makes the clone shallow.
+func (g *Git) Clone(ctx context.Context, url, dest, branch string, depth int) error {
+	args := []string{"clone"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	args = append(args, url, dest)
+	_, err := g.R.Run(ctx, "", g.Bin, args...)
+	return err
+}
+
+// PushBranch force-pushes HEAD to branch on origin. It is meant for
+// branches only this machine writes to.
+func (g *Git) PushBranch(ctx context.Context, repoPath, branch string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "push", "--force", "origin", "HEAD:refs/heads/"+branch)
+	return err
+}
+
+// protectedPushMarkers are remote messages that mean the push was refused
+// by branch protection or permissions rather than by a stale local branch.
+var protectedPushMarkers = []string{
+	"protected branch",
+	"gh006",
+	"gh013",
+	"not allowed to push",
+	"not allowed to force push",
+	"pre-receive hook declined",
+	"permission to",
+	"the requested url returned error: 403",
+}
+
+// IsProtectedPushError reports whether a failed push was rejected by
+// branch protection or missing write permission. Non-fast-forward
+// rejections are not: those resolve with another pull.
+func IsProtectedPushError(err error) bool {
+	var runErr *runner.RunError
+	if !errors.As(err, &runErr) {
+		return false
+	}
+	stderr := strings.ToLower(runErr.Stderr)
+	for _, marker := range protectedPushMarkers {
+		if strings.Contains(stderr, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// CommitStat returns per-file added/removed counts for a single commit.
+func (g *Git) CommitStat(ctx context.Context, repoPath, rev string) ([]diffstat.FileStat, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "show", "--numstat", "--format=", rev)
+	if err != nil {
+		return nil, err
+	}
+	return diffstat.ParseNumstat(res.Stdout), nil
+}
+
 // CurrentBranch returns the current branch name.
 func (g *Git) CurrentBranch(ctx context.Context, repoPath string) (string, error) {
 	res, err := g.R.Run(ctx, repoPath, g.Bin, "rev-parse", "--abbrev-ref", "HEAD")
@@ -171,11 +439,595 @@ func (g *Git) RemoteURL(ctx context.Context, repoPath string) (string, error) {
 	return strings.TrimSpace(res.Stdout), nil
 }
 
+// IsShallow reports whether the repo is a shallow clone.
+func (g *Git) IsShallow(ctx context.Context, repoPath string) (bool, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(res.Stdout) == "true", nil
+}
+
+// Unshallow fetches the full history of every origin branch into a shallow
+// clone, which also undoes the single-branch setup of a --depth clone.
+func (g *Git) Unshallow(ctx context.Context, repoPath string) error {
+	if _, err := g.R.Run(ctx, repoPath, g.Bin, "remote", "set-branches", "origin", "*"); err != nil {
+		return err
+	}
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "fetch", "--unshallow", "origin")
+	return err
+}
+
+// AheadBehind counts the commits HEAD has that its upstream lacks (ahead)
+// and the reverse (behind), as of the last fetch. ok is false when the
+// current branch tracks no upstream, including on a detached HEAD.
+func (g *Git) AheadBehind(ctx context.Context, repoPath string) (ahead, behind int, ok bool, err error) {
+	if _, err := g.R.Run(ctx, repoPath, g.Bin, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}"); err != nil {
+		return 0, 0, false, nil
+	}
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "rev-list", "--left-right", "--count", "HEAD...@{upstream}")
+	if err != nil {
+		return 0, 0, false, err
+	}
+	fields := strings.Fields(res.Stdout)
+	if len(fields) != 2 {
+		return 0, 0, false, fmt.Errorf("unexpected rev-list --count output %q", strings.TrimSpace(res.Stdout))
+	}
+	if ahead, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, false, err
+	}
+	if behind, err = strconv.Atoi(fields[1]); err != nil {
+		return 0, 0, false, err
+	}
+	return ahead, behind, true, nil
+}
+
+// SubmoduleAdd clones url into path as a submodule of the repo and records
+// it in .gitmodules. A positive depth makes the clone shallow and marks the
+// submodule shallow so later clones of the repo fetch it shallow too.
+func (g *Git) SubmoduleAdd(ctx context.Context, repoPath, url, path, branch string, depth int) error {
+	args := []string{"submodule", "add"}
+	if branch != "" {
+		args = append(args, "-b", branch)
+	}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	args = append(args, "--", url, path)
+	if _, err := g.R.Run(ctx, repoPath, g.Bin, args...); err != nil {
+		return err
+	}
+	if depth > 0 {
+		_, err := g.R.Run(ctx, repoPath, g.Bin, "config", "-f", ".gitmodules", "submodule."+path+".shallow", "true")
+		return err
+	}
+	return nil
+}
+
+// Init creates an empty repository at repoPath with branch checked out.
+func (g *Git) Init(ctx context.Context, repoPath, branch string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "init", "--quiet", "--initial-branch="+branch)
+	return err
+}
+
+// AddRemote adds a remote named name.
+func (g *Git) AddRemote(ctx context.Context, repoPath, name, url string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "remote", "add", name, url)
+	return err
+}
+
+// SetRemoteURL points the existing remote name at url.
+func (g *Git) SetRemoteURL(ctx context.Context, repoPath, name, url string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "remote", "set-url", name, url)
+	return err
+}
+
+// RemoveRemote deletes the remote named name.
+func (g *Git) RemoveRemote(ctx context.Context, repoPath, name string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "remote", "remove", name)
+	return err
+}
+
+// TrackedFile is a path tracked in a repo's index.
+type TrackedFile struct {
+	// Path is slash-separated and relative to the work tree.
+	Path    string
+	Symlink bool
+}
+
+// BareFiles lists the files the repo at gitDir tracks for workTree, as a
+// bare-repo dotfiles setup (or yadm) checks them out into home.
+func (g *Git) BareFiles(ctx context.Context, gitDir, workTree string) ([]TrackedFile, error) {
+	res, err := g.R.Run(ctx, "", g.Bin, "--git-dir", gitDir, "--work-tree", workTree, "ls-files", "--stage", "-z")
+	if err != nil {
+		return nil, err
+	}
+	var files []TrackedFile
+	for _, entry := range strings.Split(res.Stdout, "\x00") {
+		// "<mode> <object> <stage>\t<path>"
+		meta, path, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		files = append(files, TrackedFile{Path: path, Symlink: strings.HasPrefix(meta, "120000 ")})
+	}
+	return files, nil
+}
+
+// BundleCreate writes every ref and its history to a git bundle at file.
+func (g *Git) BundleCreate(ctx context.Context, repoPath, file string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "bundle", "create", file, "--all")
+	return err
+}
+
+// CloneBundle clones branch from the git bundle at file into repoPath,
+// which must not exist or be empty.
+func (g *Git) CloneBundle(ctx context.Context, file, repoPath, branch string) error {
+	_, err := g.R.Run(ctx, "", g.Bin, "clone", "--branch", branch, file, repoPath)
+	return err
+}
+
+// ConfigGet returns the effective value of a git config key in the repo,
+// or "" when it is unset.
+func (g *Git) ConfigGet(ctx context.Context, repoPath, key string) (string, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "config", "--get", key)
+	if err != nil {
+		// git config exits 1 when the key is unset.
+		if res != nil && res.Code == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(res.Stdout), nil
+}
+
+// ConfigSetLocal sets a git config key in the repo's local config.
+func (g *Git) ConfigSetLocal(ctx context.Context, repoPath, key, value string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "config", "--local", key, value)
+	return err
+}
+
+// Identity is the committer identity git resolves for a repo.
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// Complete reports whether both name and email are set.
+func (i Identity) Complete() bool {
+	return i.Name != "" && i.Email != ""
+}
+
+// Identity returns the user.name and user.email git would use in the repo.
+func (g *Git) Identity(ctx context.Context, repoPath string) (Identity, error) {
+	name, err := g.ConfigGet(ctx, repoPath, "user.name")
+	if err != nil {
+		return Identity{}, err
+	}
+	email, err := g.ConfigGet(ctx, repoPath, "user.email")
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{Name: name, Email: email}, nil
+}
+
+// EnsureIdentity sets repo-local user.name and user.email from want for
+// whichever of the two git cannot resolve yet. It returns the resulting
+// identity and whether anything was written; an incomplete result means
+// want lacked the missing values.
+func (g *Git) EnsureIdentity(ctx context.Context, repoPath string, want Identity) (Identity, bool, error) {
+	have, err := g.Identity(ctx, repoPath)
+	if err != nil {
+		return Identity{}, false, err
+	}
+	changed := false
+	if have.Name == "" && want.Name != "" {
+		if err := g.ConfigSetLocal(ctx, repoPath, "user.name", want.Name); err != nil {
+			return have, changed, err
+		}
+		have.Name, changed = want.Name, true
+	}
+	if have.Email == "" && want.Email != "" {
+		if err := g.ConfigSetLocal(ctx, repoPath, "user.email", want.Email); err != nil {
+			return have, changed, err
+		}
+		have.Email, changed = want.Email, true
+	}
+	return have, changed, nil
+}
+
 // DefaultCommitMessage generates a commit message with hostname and timestamp.
 func DefaultCommitMessage(hostname string) string {
 	ts := time.Now().Format(time.RFC3339)
+	return fmt.Sprintf("%s at %s", SyncCommitPrefix(hostname), ts)
+}
+
+// SyncCommitPrefix returns the subject prefix DefaultCommitMessage uses for
+// the given host, so callers can recognize that machine's sync commits.
+func SyncCommitPrefix(hostname string) string {
 	if hostname == "" {
 		hostname = "unknown-host"
 	}
-	return fmt.Sprintf("dot sync from %s at %s", hostname, ts)
+	return SyncSubjectPrefix + hostname
+}
+
+// SyncSubjectPrefix starts the subject of every automated sync commit.
+const SyncSubjectPrefix = "dot sync from "
+
+// IsSyncCommit reports whether subject is an automated sync commit from any
+// host. Sync commits with a custom message are only recognizable by their
+// Sync-Host trailer; see SyncHost.
+func IsSyncCommit(subject string) bool {
+	return strings.HasPrefix(subject, SyncSubjectPrefix)
+}
+
+// SyncHost returns the host a sync commit came from: its Sync-Host trailer
+// value when set, otherwise the host named in a default sync subject. ok is
+// false when the commit is not a sync commit.
+func SyncHost(subject, trailer string) (host string, ok bool) {
+	if trailer != "" {
+		return trailer, true
+	}
+	rest, ok := strings.CutPrefix(subject, SyncSubjectPrefix)
+	if !ok {
+		return "", false
+	}
+	host, _, _ = strings.Cut(rest, " at ")
+	return host, true
+}
+
+// Commit trailer keys dotstate writes so history stays queryable by
+// machine, dot build, and profile however the subject format changes, e.g.
+// `git log --format='%h %(trailers:key=Machine-Id,valueonly)'`.
+const (
+	TrailerMachineID  = "Machine-Id"
+	TrailerDotVersion = "Dot-Version"
+	TrailerProfile    = "Profile"
+	// TrailerSyncHost marks sync commits with the syncing host, so they are
+	// recognized whatever their subject.
+	TrailerSyncHost = "Sync-Host"
+)
+
+// Trailer is one "Key: value" line in a commit message's trailer block.
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// WithTrailers appends a trailer block to msg, skipping trailers with an
+// empty value. With nothing to add msg is returned unchanged.
+func WithTrailers(msg string, trailers ...Trailer) string {
+	var lines []string
+	for _, t := range trailers {
+		if t.Value != "" {
+			lines = append(lines, t.Key+": "+t.Value)
+		}
+	}
+	if len(lines) == 0 {
+		return msg
+	}
+	return msg + "\n\n" + strings.Join(lines, "\n")
+}
+
+// WithMachineTrailer appends a "Machine-Id: <id>" trailer to msg. An empty
+// id leaves msg unchanged.
+func WithMachineTrailer(msg, id string) string {
+	return WithTrailers(msg, Trailer{Key: TrailerMachineID, Value: id})
+}
+
+// HistoryCommitMarker prefixes each commit header in LogPatch output.
+const HistoryCommitMarker = "dotstate-commit "
+
+// LogPatch returns the patches introduced by every commit in revRange (all
+// of HEAD's history when empty), each preceded by a HistoryCommitMarker line.
+func (g *Git) LogPatch(ctx context.Context, repoPath, revRange string) (string, error) {
+	args := []string{"log", "-p", "--no-color", "--no-ext-diff", "--format=" + HistoryCommitMarker + "%H"}
+	if revRange != "" {
+		args = append(args, revRange)
+	}
+	res, err := g.R.Run(ctx, repoPath, g.Bin, args...)
+	if err != nil {
+		return "", err
+	}
+	return res.Stdout, nil
+}
+
+// Blob is a file object with its size in bytes. Path is where the blob
+// appears in a tree (for history blobs, the first path git reports).
+type Blob struct {
+	Hash string
+	Path string
+	Size int64
+}
+
+// TreeBlobs returns every blob in rev's tree (HEAD when empty).
+func (g *Git) TreeBlobs(ctx context.Context, repoPath, rev string) ([]Blob, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "ls-tree", "-r", "-l", "-z", rev)
+	if err != nil {
+		return nil, err
+	}
+	var blobs []Blob
+	for _, entry := range strings.Split(res.Stdout, "\x00") {
+		meta, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 4 || fields[1] != "blob" {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, Blob{Hash: fields[2], Path: path, Size: size})
+	}
+	return blobs, nil
+}
+
+// HistoryBlobs returns every blob reachable from any ref, including ones no
+// longer in HEAD's tree.
+func (g *Git) HistoryBlobs(ctx context.Context, repoPath string) ([]Blob, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "rev-list", "--objects", "--all")
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]string{}
+	for _, line := range splitLines(res.Stdout) {
+		hash, path, ok := strings.Cut(line, " ")
+		if ok && path != "" {
+			if _, seen := paths[hash]; !seen {
+				paths[hash] = path
+			}
+		}
+	}
+
+	res, err = g.R.Run(ctx, repoPath, g.Bin, "cat-file", "--batch-all-objects", "--batch-check=%(objectname) %(objecttype) %(objectsize)")
+	if err != nil {
+		return nil, err
+	}
+	var blobs []Blob
+	for _, line := range splitLines(res.Stdout) {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		path, reachable := paths[fields[0]]
+		if !reachable {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		blobs = append(blobs, Blob{Hash: fields[0], Path: path, Size: size})
+	}
+	return blobs, nil
+}
+
+// RevBefore returns the last commit on HEAD made before t, or "" when HEAD
+// has none that old.
+func (g *Git) RevBefore(ctx context.Context, repoPath string, t time.Time) (string, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "rev-list", "-1", "--before="+t.Format(time.RFC3339), "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res.Stdout), nil
+}
+
+// PackSize returns the on-disk size of the object database in bytes, loose
+// objects and packs combined.
+func (g *Git) PackSize(ctx context.Context, repoPath string) (int64, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "count-objects", "-v")
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, line := range splitLines(res.Stdout) {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || (key != "size" && key != "size-pack") {
+			continue
+		}
+		kib, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse count-objects %s: %w", key, err)
+		}
+		total += kib * 1024
+	}
+	return total, nil
+}
+
+// HistoryEntry is a commit on a first-parent line with what is needed to
+// recreate it elsewhere.
+type HistoryEntry struct {
+	Hash        string
+	Parents     []string
+	Tree        string
+	AuthorName  string
+	AuthorEmail string
+	AuthorDate  time.Time
+	Subject     string
+	Message     string
+	// Machines holds the commit's Machine-Id trailer values.
+	Machines []string
+}
+
+// IsSync reports whether e is an automated sync commit, by its Sync-Host
+// trailer or its subject.
+func (e HistoryEntry) IsSync() bool {
+	_, ok := e.SyncHost()
+	return ok
+}
+
+// SyncHost returns the host e was synced from, as the package-level
+// SyncHost does.
+func (e HistoryEntry) SyncHost() (string, bool) {
+	return SyncHost(e.Subject, messageTrailer(e.Message, TrailerSyncHost))
+}
+
+// messageTrailer returns the value of the first key trailer in the last
+// paragraph of msg, or "".
+func messageTrailer(msg, key string) string {
+	msg = strings.TrimRight(msg, "\n")
+	if i := strings.LastIndex(msg, "\n\n"); i >= 0 {
+		msg = msg[i+2:]
+	} else {
+		return ""
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		if k, v, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(k), key) {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// historyFormat separates fields with US and records with RS so messages
+// may contain newlines.
+const historyFormat = "%H%x1f%P%x1f%T%x1f%an%x1f%ae%x1f%aI%x1f%(trailers:key=" + TrailerMachineID + ",valueonly,separator=%x2C)%x1f%B%x1e"
+
+// FirstParentHistory returns the first-parent history of rev (HEAD when
+// empty), oldest first.
+func (g *Git) FirstParentHistory(ctx context.Context, repoPath, rev string) ([]HistoryEntry, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "log", "--first-parent", "--reverse", "--format="+historyFormat, rev)
+	if err != nil {
+		return nil, err
+	}
+	return parseHistory(res.Stdout)
+}
+
+// History returns up to limit commits reachable from HEAD, newest first,
+// with the same detail as FirstParentHistory.
+func (g *Git) History(ctx context.Context, repoPath string, limit int) ([]HistoryEntry, error) {
+	args := []string{"log", "--format=" + historyFormat}
+	if limit > 0 {
+		args = append(args, fmt.Sprintf("-n%d", limit))
+	}
+	res, err := g.R.Run(ctx, repoPath, g.Bin, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseHistory(res.Stdout)
+}
+
+func parseHistory(out string) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	for _, record := range strings.Split(out, "\x1e") {
+		record = strings.TrimLeft(record, "\n")
+		if record == "" {
+			continue
+		}
+		fields := strings.SplitN(record, "\x1f", 8)
+		if len(fields) != 8 {
+			return nil, fmt.Errorf("parse git log record %q", record)
+		}
+		date, err := time.Parse(time.RFC3339, fields[5])
+		if err != nil {
+			return nil, fmt.Errorf("parse author date of %s: %w", fields[0], err)
+		}
+		subject, _, _ := strings.Cut(fields[7], "\n")
+		entry := HistoryEntry{
+			Hash:        fields[0],
+			Parents:     strings.Fields(fields[1]),
+			Tree:        fields[2],
+			AuthorName:  fields[3],
+			AuthorEmail: fields[4],
+			AuthorDate:  date,
+			Subject:     subject,
+			Message:     fields[7],
+		}
+		for _, id := range strings.Split(fields[6], ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				entry.Machines = append(entry.Machines, id)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// RevParse resolves rev to an object name.
+func (g *Git) RevParse(ctx context.Context, repoPath, rev string) (string, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "rev-parse", "--verify", rev)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res.Stdout), nil
+}
+
+// BranchExists reports whether a local branch exists.
+func (g *Git) BranchExists(ctx context.Context, repoPath, branch string) (bool, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	if err != nil {
+		if res != nil && res.Code == 1 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoteHasBranch asks origin, over the network, whether it has branch. It
+// fails when origin cannot be reached.
+func (g *Git) RemoteHasBranch(ctx context.Context, repoPath, branch string) (bool, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "ls-remote", "--exit-code", "--heads", "origin", "refs/heads/"+branch)
+	if err != nil {
+		if res != nil && res.Code == 2 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// GitDir returns the absolute path of the repo's .git directory.
+func (g *Git) GitDir(ctx context.Context, repoPath string) (string, error) {
+	res, err := g.R.Run(ctx, repoPath, g.Bin, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res.Stdout), nil
+}
+
+// Switch checks out branch, refusing to overwrite local changes.
+func (g *Git) Switch(ctx context.Context, repoPath, branch string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "switch", branch)
+	return err
+}
+
+// CreateBranch creates branch at rev; it fails if the branch exists.
+func (g *Git) CreateBranch(ctx context.Context, repoPath, branch, rev string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "branch", branch, rev)
+	return err
+}
+
+// WorktreeAdd checks rev out, detached, into a new worktree at dir.
+func (g *Git) WorktreeAdd(ctx context.Context, repoPath, dir, rev string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "worktree", "add", "--detach", dir, rev)
+	return err
+}
+
+// WorktreeRemove deletes the worktree at dir, discarding its changes.
+func (g *Git) WorktreeRemove(ctx context.Context, repoPath, dir string) error {
+	_, err := g.R.Run(ctx, repoPath, g.Bin, "worktree", "remove", "--force", dir)
+	return err
+}
+
+// ResetTree makes the index and working tree of the checkout at dir match
+// rev's tree exactly, without moving HEAD.
+func (g *Git) ResetTree(ctx context.Context, dir, rev string) error {
+	_, err := g.R.Run(ctx, dir, g.Bin, "read-tree", "-u", "--reset", rev)
+	return err
+}
+
+// CommitIndex commits the index at dir verbatim with the given author and
+// author date, skipping hooks and signing. Empty commits are allowed so a
+// recreated history keeps every step.
+func (g *Git) CommitIndex(ctx context.Context, dir, message, author string, date time.Time) error {
+	_, err := g.R.Run(ctx, dir, g.Bin, "commit", "-q", "--allow-empty", "--no-verify", "--no-gpg-sign",
+		"--cleanup=verbatim", "--author="+author, "--date="+date.Format(time.RFC3339), "-m", message)
+	return err
 }
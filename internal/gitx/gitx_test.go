@@ -2,11 +2,14 @@ package gitx
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/dnery/dotstate/dot/internal/runner"
 	"github.com/dnery/dotstate/dot/internal/testutil"
 )
 
@@ -272,6 +275,29 @@ func TestPullRebase(t *testing.T) {
 	mock.AssertCalled(testutil.MatchExact("git", "pull", "--rebase", "--autostash"))
 }
 
+func TestConflicts(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "status", "--porcelain", "-z", "--untracked-files=no"),
+		"M  home/dot_bashrc\x00UU home/dot_zshrc\x00UD home/dot config/app.toml\x00AA state/apps.toml\x00")
+
+	conflicts, err := New("git", mock).Conflicts(context.Background(), "/repo")
+	if err != nil {
+		t.Fatalf("Conflicts() error = %v", err)
+	}
+	want := []Conflict{{"home/dot_zshrc", "UU"}, {"home/dot config/app.toml", "UD"}, {"state/apps.toml", "AA"}}
+	if len(conflicts) != len(want) {
+		t.Fatalf("Conflicts() = %+v, want %+v", conflicts, want)
+	}
+	for i := range want {
+		if conflicts[i] != want[i] {
+			t.Errorf("Conflicts()[%d] = %+v, want %+v", i, conflicts[i], want[i])
+		}
+	}
+	if !conflicts[1].Deleted("theirs") || conflicts[1].Deleted("ours") || conflicts[0].Deleted("theirs") {
+		t.Errorf("Deleted() misreads %+v", conflicts[:2])
+	}
+}
+
 func TestPush(t *testing.T) {
 	mock := testutil.NewMockRunner(t)
 	mock.OnCommandSuccess(
@@ -290,6 +316,73 @@ func TestPush(t *testing.T) {
 	mock.AssertCalled(testutil.MatchExact("git", "push"))
 }
 
+func TestCommitStat(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchExact("git", "show", "--numstat", "--format=", "HEAD"),
+		"2\t1\thome/dot_zshrc\n",
+	)
+
+	g := New("git", mock)
+	stats, err := g.CommitStat(context.Background(), "/repo", "")
+	if err != nil {
+		t.Fatalf("CommitStat() error = %v", err)
+	}
+	if len(stats) != 1 || stats[0].Path != "home/dot_zshrc" || stats[0].Added != 2 || stats[0].Removed != 1 {
+		t.Errorf("CommitStat() = %#v", stats)
+	}
+}
+
+func TestLog(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchExact("git", "log", "--format=%H%x1f%s%x1f%(trailers:key=Sync-Host,valueonly,separator=%x2C)", "-n3"),
+		"abc123\x1fdot sync from host at 2026-05-13T00:00:00Z\x1f\nfff999\x1fwip on nvim\x1flaptop\ndef456\x1finitial\x1f\n",
+	)
+
+	g := New("git", mock)
+	commits, err := g.Log(context.Background(), "/repo", 3)
+	if err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+	if len(commits) != 3 || commits[0].Hash != "abc123" || commits[1].SyncHost != "laptop" || commits[2].Subject != "initial" {
+		t.Errorf("Log() = %#v", commits)
+	}
+	for i, want := range []string{"host", "laptop", ""} {
+		if host, ok := SyncHost(commits[i].Subject, commits[i].SyncHost); host != want || ok != (want != "") {
+			t.Errorf("SyncHost(%q) = %q, %v; want %q", commits[i].Subject, host, ok, want)
+		}
+	}
+}
+
+func TestHistoryEntryIsSyncByTrailer(t *testing.T) {
+	custom := HistoryEntry{Subject: "wip on nvim", Message: "wip on nvim\n\nMachine-Id: laptop-01\nSync-Host: laptop\n"}
+	if host, ok := custom.SyncHost(); !ok || host != "laptop" {
+		t.Errorf("SyncHost() = %q, %v; want laptop", host, ok)
+	}
+	rollback := HistoryEntry{Subject: "dot rollback to abc from laptop", Message: "dot rollback to abc from laptop\n\nMachine-Id: laptop-01\n"}
+	if rollback.IsSync() {
+		t.Error("rollback commit counted as a sync commit")
+	}
+}
+
+func TestLogPatch(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchExact("git", "log", "-p", "--no-color", "--no-ext-diff", "--format=dotstate-commit %H", "main~5..main"),
+		"dotstate-commit abc123\n",
+	)
+
+	g := New("git", mock)
+	out, err := g.LogPatch(context.Background(), "/repo", "main~5..main")
+	if err != nil {
+		t.Fatalf("LogPatch() error = %v", err)
+	}
+	if out != "dotstate-commit abc123\n" {
+		t.Errorf("LogPatch() = %q", out)
+	}
+}
+
 func TestCurrentBranch(t *testing.T) {
 	mock := testutil.NewMockRunner(t)
 	mock.OnCommandSuccess(
@@ -309,6 +402,41 @@ func TestCurrentBranch(t *testing.T) {
 	}
 }
 
+func TestUnshallow(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--is-shallow-repository"), "true\n")
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("git", "remote", "set-branches"), "")
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("git", "fetch"), "")
+
+	g := New("git", mock)
+	ctx := context.Background()
+	if shallow, err := g.IsShallow(ctx, "/home/u/.config/nvim"); err != nil || !shallow {
+		t.Fatalf("IsShallow() = %v, %v; want true", shallow, err)
+	}
+	if err := g.Unshallow(ctx, "/home/u/.config/nvim"); err != nil {
+		t.Fatalf("Unshallow() error = %v", err)
+	}
+	mock.AssertCalled(testutil.MatchExact("git", "remote", "set-branches", "origin", "*"))
+	mock.AssertCalled(testutil.MatchExact("git", "fetch", "--unshallow", "origin"))
+}
+
+func TestAheadBehind(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("git", "rev-parse", "--abbrev-ref", "--symbolic-full-name"), "origin/main\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-list", "--left-right", "--count", "HEAD...@{upstream}"), "2\t5\n")
+
+	g := New("git", mock)
+	ahead, behind, ok, err := g.AheadBehind(context.Background(), "/home/u/.config/nvim")
+	if err != nil || !ok || ahead != 2 || behind != 5 {
+		t.Fatalf("AheadBehind() = %d, %d, %v, %v; want 2, 5, true", ahead, behind, ok, err)
+	}
+
+	mock.OnCommandFailure(testutil.MatchCommandPrefix("git", "rev-parse", "--abbrev-ref", "--symbolic-full-name"), "fatal: no upstream configured for branch 'dev'\n", 128)
+	if _, _, ok, err := g.AheadBehind(context.Background(), "/home/u/.config/nvim"); err != nil || ok {
+		t.Fatalf("AheadBehind() without upstream = %v, %v; want not ok and no error", ok, err)
+	}
+}
+
 func TestRemoteURL(t *testing.T) {
 	mock := testutil.NewMockRunner(t)
 	mock.OnCommandSuccess(
@@ -380,3 +508,136 @@ func containsString(s, substr string) bool {
 	}
 	return false
 }
+
+func TestWithMachineTrailer(t *testing.T) {
+	if got := WithMachineTrailer("dot sync from box at now", "laptop-01"); got != "dot sync from box at now\n\nMachine-Id: laptop-01" {
+		t.Fatalf("WithMachineTrailer = %q", got)
+	}
+	if got := WithMachineTrailer("msg", ""); got != "msg" {
+		t.Fatalf("WithMachineTrailer without id = %q", got)
+	}
+}
+
+func TestLFSTrackUsesLiteralFilenames(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.SetFallback("", "", 0)
+
+	g := New("git", mock)
+	if err := g.LFSTrack(context.Background(), "/repo", "home/dot_big[1].db"); err != nil {
+		t.Fatalf("LFSTrack() error = %v", err)
+	}
+	mock.AssertCalled(testutil.MatchExact("git", "lfs", "track", "--filename", "--", "home/dot_big[1].db"))
+
+	mock.Reset()
+	if err := g.LFSTrack(context.Background(), "/repo"); err != nil {
+		t.Fatalf("LFSTrack() with no files error = %v", err)
+	}
+	mock.AssertCallCount(0)
+}
+
+func TestConfigGetUnset(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandFailure(testutil.MatchExact("git", "config", "--get", "user.name"), "", 1)
+
+	got, err := New("git", mock).ConfigGet(context.Background(), "/repo", "user.name")
+	if err != nil {
+		t.Fatalf("ConfigGet() error = %v", err)
+	}
+	if got != "" {
+		t.Errorf("ConfigGet() = %q, want empty", got)
+	}
+}
+
+func TestEnsureIdentitySetsOnlyMissing(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "config", "--get", "user.name"), "Global Name\n")
+	mock.OnCommandFailure(testutil.MatchExact("git", "config", "--get", "user.email"), "", 1)
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("git", "config", "--local"), "")
+
+	got, changed, err := New("git", mock).EnsureIdentity(context.Background(), "/repo", Identity{Name: "Dot", Email: "dot@example.com"})
+	if err != nil {
+		t.Fatalf("EnsureIdentity() error = %v", err)
+	}
+	want := Identity{Name: "Global Name", Email: "dot@example.com"}
+	if got != want || !changed {
+		t.Errorf("EnsureIdentity() = %+v, %v; want %+v, true", got, changed, want)
+	}
+	mock.AssertCalled(testutil.MatchExact("git", "config", "--local", "user.email", "dot@example.com"))
+	mock.AssertNotCalled(testutil.MatchCommandPrefix("git", "config", "--local", "user.name"))
+}
+
+func TestEnsureIdentityIncomplete(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandFailure(testutil.MatchCommandPrefix("git", "config", "--get"), "", 1)
+
+	got, changed, err := New("git", mock).EnsureIdentity(context.Background(), "/repo", Identity{})
+	if err != nil {
+		t.Fatalf("EnsureIdentity() error = %v", err)
+	}
+	if got.Complete() || changed {
+		t.Errorf("EnsureIdentity() = %+v, %v; want incomplete, unchanged", got, changed)
+	}
+}
+
+func TestWithTrailers(t *testing.T) {
+	got := WithTrailers("msg",
+		Trailer{Key: TrailerMachineID, Value: "laptop-01"},
+		Trailer{Key: TrailerDotVersion, Value: "1.2.3"},
+		Trailer{Key: TrailerProfile, Value: ""},
+	)
+	if want := "msg\n\nMachine-Id: laptop-01\nDot-Version: 1.2.3"; got != want {
+		t.Fatalf("WithTrailers = %q, want %q", got, want)
+	}
+	if got := WithTrailers("msg", Trailer{Key: TrailerProfile}); got != "msg" {
+		t.Fatalf("WithTrailers with empty values = %q", got)
+	}
+}
+
+func TestFirstParentHistory(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchCommandPrefix("git", "log", "--first-parent", "--reverse"),
+		"aaa\x1f\x1ft1\x1fAnn\x1fann@example.com\x1f2026-01-01T10:00:00Z\x1f\x1finit\n\x1e\n"+
+			"bbb\x1faaa\x1ft2\x1fAnn\x1fann@example.com\x1f2026-01-02T10:00:00+01:00\x1fm1,m2\x1fdot sync from box\n\nMachine-Id: m1\n\x1e\n",
+	)
+
+	got, err := New("git", mock).FirstParentHistory(context.Background(), "/repo", "")
+	if err != nil {
+		t.Fatalf("FirstParentHistory() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("FirstParentHistory() = %+v, want 2 entries", got)
+	}
+	if got[0].Hash != "aaa" || len(got[0].Parents) != 0 || got[0].Subject != "init" {
+		t.Errorf("root entry = %+v", got[0])
+	}
+	b := got[1]
+	if b.Parents[0] != "aaa" || b.Tree != "t2" || b.Subject != "dot sync from box" || strings.Join(b.Machines, " ") != "m1 m2" {
+		t.Errorf("second entry = %+v", b)
+	}
+	if !b.AuthorDate.Equal(time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("AuthorDate = %v", b.AuthorDate)
+	}
+}
+
+func TestIsProtectedPushError(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   bool
+	}{
+		{"remote: error: GH006: Protected branch update failed for refs/heads/main.", true},
+		{"remote: GitLab: You are not allowed to push code to protected branches on this project.", true},
+		{"remote: Permission to me/dotfiles.git denied to bot.", true},
+		{" ! [rejected]        main -> main (fetch first)", false},
+		{"fatal: unable to access: Could not resolve host", false},
+	}
+	for _, tt := range tests {
+		err := &runner.RunError{Cmd: "git", Args: []string{"push"}, Code: 1, Stderr: tt.stderr}
+		if got := IsProtectedPushError(err); got != tt.want {
+			t.Errorf("IsProtectedPushError(%q) = %v, want %v", tt.stderr, got, tt.want)
+		}
+	}
+	if IsProtectedPushError(errors.New("protected branch")) {
+		t.Error("plain errors must not count as push rejections")
+	}
+}
@@ -0,0 +1,44 @@
+// Package glob matches slash-separated paths against globs where "**"
+// spans any number of path segments.
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether the slash-separated path p matches pattern.
+// Patterns without a slash also match the basename.
+func Match(pattern, p string) bool {
+	pattern = strings.TrimPrefix(strings.ReplaceAll(pattern, `\`, "/"), "./")
+	if !strings.Contains(pattern, "/") {
+		if ok, _ := path.Match(pattern, path.Base(p)); ok {
+			return true
+		}
+	}
+	return MatchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+// MatchSegments matches path segments against glob segments where "**"
+// spans any number of segments.
+func MatchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(parts); i++ {
+				if MatchSegments(rest, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,24 @@
+package glob
+
+import "testing"
+
+func TestMatchDoubleStar(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"home/**", "home", true},
+		{"home/**", "home/a/b/c", true},
+		{"home/**/cache", "home/x/y/cache", true},
+		{"home/**/cache", "home/cache", true},
+		{"home/*", "home/a/b", false},
+		{"state/*.toml", "state/apps.toml", true},
+		{"*.lock", "state/macos/Brewfile.lock", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
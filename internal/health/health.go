@@ -0,0 +1,394 @@
+// Package health runs dot doctor's deeper checks on the repo and its
+// working state: whether the remote answers, the branch and source dir
+// match the config, state dirs are writable, the clock agrees with the
+// forge, and git is not stuck mid-rebase or behind a stale lock.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+// Status is a check's outcome.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	// StatusSkip means the check does not apply, e.g. no remote is set.
+	StatusSkip Status = "skip"
+)
+
+// Check is one check's result.
+type Check struct {
+	ID      string `json:"id"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	// Hint says how to fix a warning or failure.
+	Hint string `json:"hint,omitempty"`
+	// Fix, when set, repairs the problem; dot doctor --fix offers it.
+	Fix *Fix `json:"fix,omitempty"`
+}
+
+// Fix is a repair dot doctor can make itself.
+type Fix struct {
+	// Description says what Run does, e.g. "git remote add origin URL".
+	Description string                          `json:"description"`
+	Run         func(ctx context.Context) error `json:"-"`
+}
+
+// Failed reports whether any check failed.
+func Failed(checks []Check) bool {
+	for _, c := range checks {
+		if c.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// remoteTimeout bounds each network check.
+	remoteTimeout = 15 * time.Second
+	// skewWarn and skewFail are how far the local clock may drift from the
+	// forge's before a warning or failure. Commit times and TLS and
+	// one-time-password checks go wrong with a few minutes of skew.
+	skewWarn = time.Minute
+	skewFail = 5 * time.Minute
+	// staleLockAge is how old a git lock file must be to count as left
+	// behind by a crashed git rather than held by a running one.
+	staleLockAge = 10 * time.Minute
+)
+
+// Env is what the checks inspect.
+type Env struct {
+	Config *config.Config
+	Git    *gitx.Git
+	Now    func() time.Time
+	// ServerTime returns the time a server at url reports; nil uses the
+	// Date header of an HTTPS HEAD request.
+	ServerTime func(ctx context.Context, url string) (time.Time, error)
+}
+
+// Run runs every check in order.
+func Run(ctx context.Context, env Env) []Check {
+	if env.Now == nil {
+		env.Now = time.Now
+	}
+	if env.ServerTime == nil {
+		env.ServerTime = httpDate
+	}
+	return []Check{
+		checkRemote(ctx, env),
+		checkBranch(ctx, env),
+		checkOperation(ctx, env),
+		checkLocks(ctx, env),
+		checkSourceDir(env),
+		checkStateWritable(env),
+		checkClock(ctx, env),
+	}
+}
+
+func checkRemote(ctx context.Context, env Env) Check {
+	c := Check{ID: "repo.reachable"}
+	if _, err := env.Git.RemoteURL(ctx, env.Config.Repo.Path); err != nil {
+		c.Status, c.Message = StatusSkip, "no origin remote"
+		if url := env.Config.Repo.URL; url != "" {
+			c.Status, c.Message = StatusWarn, "no origin remote, so dot sync cannot push or pull"
+			c.Hint = "git remote add origin " + redact.Text(url)
+			c.Fix = &Fix{Description: c.Hint, Run: func(ctx context.Context) error {
+				return env.Git.AddRemote(ctx, env.Config.Repo.Path, "origin", url)
+			}}
+		}
+		return c
+	}
+	ctx, cancel := context.WithTimeout(ctx, remoteTimeout)
+	defer cancel()
+	found, err := env.Git.RemoteHasBranch(ctx, env.Config.Repo.Path, env.Config.Repo.Branch)
+	switch {
+	case err != nil:
+		c.Status, c.Message = StatusFail, "origin is unreachable: "+redact.Text(firstLine(err.Error()))
+		c.Hint = "check the network and your git credentials, then run git ls-remote origin in the repo"
+	case !found:
+		c.Status, c.Message = StatusWarn, fmt.Sprintf("origin is reachable but has no %s branch", env.Config.Repo.Branch)
+		c.Hint = "dot sync pushes it on the next commit"
+	default:
+		c.Status, c.Message = StatusPass, fmt.Sprintf("origin has %s", env.Config.Repo.Branch)
+	}
+	return c
+}
+
+func checkBranch(ctx context.Context, env Env) Check {
+	c := Check{ID: "repo.branch"}
+	branch, err := env.Git.CurrentBranch(ctx, env.Config.Repo.Path)
+	switch {
+	case err != nil:
+		c.Status, c.Message = StatusFail, "cannot read the current branch: "+redact.Text(firstLine(err.Error()))
+		c.Hint = "check that repo.path is a git checkout"
+	case branch == "HEAD":
+		c.Status, c.Message = StatusFail, "HEAD is detached"
+		c.Hint = "git switch " + env.Config.Repo.Branch
+	case branch != env.Config.Repo.Branch:
+		c.Status, c.Message = StatusWarn, fmt.Sprintf("checked out %s, but [repo] branch is %s", branch, env.Config.Repo.Branch)
+		c.Hint = "git switch " + env.Config.Repo.Branch + ", or update [repo] branch"
+	default:
+		c.Status, c.Message = StatusPass, "on "+branch
+		return c
+	}
+	if err == nil {
+		c.Fix = &Fix{Description: "git switch " + env.Config.Repo.Branch, Run: func(ctx context.Context) error {
+			return env.Git.Switch(ctx, env.Config.Repo.Path, env.Config.Repo.Branch)
+		}}
+	}
+	return c
+}
+
+// inProgress maps the files git leaves in its dir during an unfinished
+// operation to that operation and the commands that finish it.
+var inProgress = []struct{ file, operation, hint string }{
+	{"rebase-merge", "rebase", "git rebase --continue or git rebase --abort"},
+	{"rebase-apply", "rebase", "git rebase --continue or git rebase --abort"},
+	{"MERGE_HEAD", "merge", "git merge --continue or git merge --abort"},
+	{"CHERRY_PICK_HEAD", "cherry-pick", "git cherry-pick --continue or git cherry-pick --abort"},
+	{"REVERT_HEAD", "revert", "git revert --continue or git revert --abort"},
+}
+
+func checkOperation(ctx context.Context, env Env) Check {
+	c := Check{ID: "repo.operation"}
+	gitDir, err := env.Git.GitDir(ctx, env.Config.Repo.Path)
+	if err != nil {
+		c.Status, c.Message = StatusSkip, "not a git checkout"
+		return c
+	}
+	for _, op := range inProgress {
+		if _, err := os.Stat(filepath.Join(gitDir, op.file)); err == nil {
+			c.Status, c.Message = StatusFail, "a "+op.operation+" is in progress"
+			c.Hint = "resolve it in the repo with " + op.hint + "; dot sync cannot pull until then"
+			return c
+		}
+	}
+	c.Status, c.Message = StatusPass, "no rebase, merge, or cherry-pick in progress"
+	return c
+}
+
+func checkLocks(ctx context.Context, env Env) Check {
+	c := Check{ID: "repo.locks"}
+	gitDir, err := env.Git.GitDir(ctx, env.Config.Repo.Path)
+	if err != nil {
+		c.Status, c.Message = StatusSkip, "not a git checkout"
+		return c
+	}
+	var stale, paths []string
+	cutoff := env.Now().Add(-staleLockAge)
+	_ = filepath.WalkDir(gitDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		// Objects hold no locks and are most of the tree.
+		if d.IsDir() && d.Name() == "objects" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".lock") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(cutoff) {
+			rel, _ := filepath.Rel(env.Config.Repo.Path, path)
+			stale = append(stale, filepath.ToSlash(rel))
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if len(stale) > 0 {
+		c.Status, c.Message = StatusFail, "stale git lock files: "+strings.Join(stale, ", ")
+		c.Hint = "if no git command is running in the repo, delete them"
+		c.Fix = &Fix{Description: "delete " + strings.Join(stale, ", "), Run: func(context.Context) error {
+			for _, path := range paths {
+				if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+			return nil
+		}}
+		return c
+	}
+	c.Status, c.Message = StatusPass, "no stale git lock files"
+	return c
+}
+
+func checkSourceDir(env Env) Check {
+	c := Check{ID: "source.dir"}
+	dir := env.Config.SourcePath()
+	info, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		c.Status, c.Message = StatusFail, dir+" does not exist"
+		c.Hint = "create it, or point [chex] source_dir at the repo's source state"
+		c.Fix = mkdirFix(dir)
+		return c
+	case err != nil:
+		c.Status, c.Message = StatusFail, redact.Text(err.Error())
+		return c
+	case !info.IsDir():
+		c.Status, c.Message = StatusFail, dir+" is not a directory"
+		c.Hint = "point [chex] source_dir at the repo's source state"
+		return c
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		c.Status, c.Message = StatusFail, redact.Text(err.Error())
+		return c
+	}
+	if len(entries) == 0 {
+		c.Status, c.Message = StatusWarn, dir+" is empty, so nothing is managed"
+		c.Hint = "add files with dot discover"
+		return c
+	}
+	c.Status, c.Message = StatusPass, dir
+	return c
+}
+
+func checkStateWritable(env Env) Check {
+	c := Check{ID: "state.writable"}
+	var denied []string
+	for _, dir := range []string{env.Config.StatePath(), env.Config.BackupPath(), env.Config.LogPath()} {
+		if err := writable(dir); err != nil {
+			denied = append(denied, dir)
+		}
+	}
+	_, statErr := os.Stat(env.Config.StatePath())
+	switch {
+	case len(denied) > 0:
+		c.Status, c.Message = StatusFail, "cannot write to "+strings.Join(denied, ", ")
+		c.Hint = "fix the directory ownership or permissions; captures, backups, and logs are written there"
+	case errors.Is(statErr, os.ErrNotExist):
+		// Backups and logs are created on first use; state/ comes from
+		// dot init and holds captured artifacts.
+		c.Status, c.Message = StatusWarn, env.Config.StatePath()+" does not exist"
+		c.Hint = "dot init creates it"
+		c.Fix = mkdirFix(env.Config.StatePath())
+	default:
+		c.Status, c.Message = StatusPass, "state directories are writable"
+	}
+	return c
+}
+
+// mkdirFix creates dir and its parents.
+func mkdirFix(dir string) *Fix {
+	return &Fix{Description: "create " + dir, Run: func(context.Context) error {
+		return os.MkdirAll(dir, 0o755)
+	}}
+}
+
+// writable creates and removes a file in dir, or in its nearest existing
+// parent when dir has not been created yet.
+func writable(dir string) error {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return os.ErrNotExist
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".dotstate-doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func checkClock(ctx context.Context, env Env) Check {
+	c := Check{ID: "clock.skew"}
+	server := serverURL(env.Config.Repo.URL)
+	if server == "" {
+		c.Status, c.Message = StatusSkip, "[repo] url has no HTTPS or SSH host to compare against"
+		return c
+	}
+	ctx, cancel := context.WithTimeout(ctx, remoteTimeout)
+	defer cancel()
+	before := env.Now()
+	remote, err := env.ServerTime(ctx, server)
+	if err != nil {
+		c.Status, c.Message = StatusSkip, "could not read the time from "+server+": "+redact.Text(firstLine(err.Error()))
+		return c
+	}
+	// Compare against the middle of the request to discount latency.
+	local := before.Add(env.Now().Sub(before) / 2)
+	skew := local.Sub(remote).Round(time.Second)
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+	switch {
+	case abs > skewFail:
+		c.Status, c.Message = StatusFail, fmt.Sprintf("the clock is %s %s %s", abs, direction, server)
+		c.Hint = "turn on automatic time sync in the OS settings"
+	case abs > skewWarn:
+		c.Status, c.Message = StatusWarn, fmt.Sprintf("the clock is %s %s %s", abs, direction, server)
+		c.Hint = "turn on automatic time sync in the OS settings"
+	default:
+		c.Status, c.Message = StatusPass, "the clock agrees with "+server
+	}
+	return c
+}
+
+// serverURL returns the HTTPS root of the host serving repoURL, for
+// https://host/... and both SSH URL forms.
+func serverURL(repoURL string) string {
+	host := ""
+	if u, err := url.Parse(repoURL); err == nil && u.Host != "" && (u.Scheme == "https" || u.Scheme == "ssh") {
+		host = u.Hostname()
+	} else if at := strings.Index(repoURL, "@"); at >= 0 && !strings.Contains(repoURL, "://") {
+		// scp-like user@host:path
+		if rest, _, ok := strings.Cut(repoURL[at+1:], ":"); ok {
+			host = rest
+		}
+	}
+	if host == "" {
+		return ""
+	}
+	return "https://" + host
+}
+
+// httpDate returns the Date header of a HEAD request to url.
+func httpDate(ctx context.Context, url string) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, errors.New("no Date header")
+	}
+	return http.ParseTime(date)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
@@ -0,0 +1,154 @@
+package health
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	repo := testutil.TempDir(t)
+	testutil.TempDotToml(t, repo, strings.ReplaceAll(testutil.MinimalDotToml(), `path = "~/dotstate"`, "path = "+strconv.Quote(repo)))
+	cfg, err := config.Load(filepath.Join(repo, "dot.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func byID(checks []Check) map[string]Check {
+	out := map[string]Check{}
+	for _, c := range checks {
+		out[c.ID] = c
+	}
+	return out
+}
+
+func TestRunReportsEachCheck(t *testing.T) {
+	cfg := loadTestConfig(t)
+	repo := cfg.Repo.Path
+	gitDir := filepath.Join(repo, ".git")
+	testutil.TempFile(t, repo, "home/dot_zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, repo, "state/README.md", "")
+	testutil.TempFile(t, repo, ".git/rebase-merge/head-name", "refs/heads/main\n")
+	lock := testutil.TempFile(t, repo, ".git/index.lock", "")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	testutil.TempFile(t, repo, ".git/refs/heads/main.lock", "")
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "remote", "get-url", "origin"), "https://github.com/test/dotstate\n")
+	mock.OnCommandFailure(testutil.MatchCommandPrefix("git", "ls-remote"), "fatal: unable to access", 128)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--abbrev-ref", "HEAD"), "feature\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--absolute-git-dir"), gitDir+"\n")
+
+	now := time.Now()
+	checks := byID(Run(context.Background(), Env{
+		Config: cfg,
+		Git:    gitx.New("git", mock),
+		Now:    func() time.Time { return now },
+		ServerTime: func(_ context.Context, url string) (time.Time, error) {
+			if url != "https://github.com" {
+				t.Errorf("clock checked against %q", url)
+			}
+			return now.Add(-10 * time.Minute), nil
+		},
+	}))
+
+	want := map[string]Status{
+		"repo.reachable": StatusFail,
+		"repo.branch":    StatusWarn,
+		"repo.operation": StatusFail,
+		"repo.locks":     StatusFail,
+		"source.dir":     StatusPass,
+		"state.writable": StatusPass,
+		"clock.skew":     StatusFail,
+	}
+	for id, status := range want {
+		if got := checks[id]; got.Status != status {
+			t.Errorf("%s = %s (%s), want %s", id, got.Status, got.Message, status)
+		}
+	}
+	if msg := checks["repo.locks"].Message; !strings.Contains(msg, ".git/index.lock") || strings.Contains(msg, "main.lock") {
+		t.Errorf("locks message = %q, want only the old lock", msg)
+	}
+	if msg := checks["clock.skew"].Message; !strings.Contains(msg, "10m0s ahead of") {
+		t.Errorf("clock message = %q", msg)
+	}
+	if !Failed(Run(context.Background(), Env{Config: cfg, Git: gitx.New("git", mock), ServerTime: func(context.Context, string) (time.Time, error) { return time.Now(), nil }})) {
+		t.Error("Failed() = false with failing checks")
+	}
+}
+
+func TestServerURLFromRepoURL(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/me/dots.git":     "https://github.com",
+		"git@gitlab.example.com:me/dots.git": "https://gitlab.example.com",
+		"ssh://git@codeberg.org/me/dots.git": "https://codeberg.org",
+		"/srv/git/dots.git":                  "",
+		"file:///srv/git/dots.git":           "",
+	}
+	for in, want := range tests {
+		if got := serverURL(in); got != want {
+			t.Errorf("serverURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFixesRepairWhatTheyReport(t *testing.T) {
+	cfg := loadTestConfig(t)
+	repo := cfg.Repo.Path
+	gitDir := filepath.Join(repo, ".git")
+	lock := testutil.TempFile(t, repo, ".git/index.lock", "")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandFailure(testutil.MatchExact("git", "remote", "get-url", "origin"), "error: No such remote 'origin'", 2)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "remote", "add", "origin", cfg.Repo.URL), "")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--abbrev-ref", "HEAD"), "HEAD\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "switch", "main"), "")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--absolute-git-dir"), gitDir+"\n")
+
+	checks := byID(Run(context.Background(), Env{
+		Config:     cfg,
+		Git:        gitx.New("git", mock),
+		ServerTime: func(context.Context, string) (time.Time, error) { return time.Now(), nil },
+	}))
+	for _, id := range []string{"repo.reachable", "repo.branch", "repo.locks", "source.dir", "state.writable"} {
+		c := checks[id]
+		if c.Fix == nil {
+			t.Fatalf("%s (%s: %s) has no fix", id, c.Status, c.Message)
+		}
+		if err := c.Fix.Run(context.Background()); err != nil {
+			t.Fatalf("%s fix %q error = %v", id, c.Fix.Description, err)
+		}
+	}
+	if checks["clock.skew"].Fix != nil || checks["repo.operation"].Fix != nil {
+		t.Error("passing checks offered a fix")
+	}
+
+	mock.AssertCalled(testutil.MatchExact("git", "remote", "add", "origin", cfg.Repo.URL))
+	mock.AssertCalled(testutil.MatchExact("git", "switch", "main"))
+	for _, dir := range []string{cfg.SourcePath(), cfg.StatePath()} {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.Errorf("%s was not created", dir)
+		}
+	}
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Errorf("stale lock still present (err = %v)", err)
+	}
+}
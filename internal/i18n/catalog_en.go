@@ -0,0 +1,130 @@
+package i18n
+
+// english is the reference catalog; every message ID must appear here.
+var english = map[string]string{
+	"doctor.system":               "System",
+	"doctor.platform":             "Platform: %s/%s",
+	"doctor.home":                 "Home: %s",
+	"doctor.wsl":                  "WSL: detected",
+	"doctor.machine":              "Machine: %s (%s)",
+	"doctor.machine_missing":      "Machine: no identity file; run dot bootstrap to create one",
+	"doctor.config":               "Config",
+	"doctor.config_not_found":     "Not found: %v",
+	"doctor.config_tip":           "Tip: run from the repo root, or pass --config path/to/dot.toml",
+	"doctor.config_path":          "Path: %s",
+	"doctor.repo_root":            "Repo root: %s",
+	"doctor.repo_url":             "Repo URL: %s",
+	"doctor.branch":               "Branch: %s",
+	"doctor.forge":                "Forge",
+	"doctor.forge_scopes_unknown": "token scopes not reported (fine-grained or non-personal token); cannot verify them",
+	"doctor.forge_scopes_missing": "missing scopes",
+	"doctor.git_identity":         "Git identity",
+	"doctor.exports":              "Exports",
+	"doctor.packages":             "Packages",
+	"doctor.case_collision":       "Case collision",
+	"doctor.health":               "Health",
+	"doctor.prerequisites":        "Prerequisites",
+	"doctor.tool_missing":         "(MISSING)",
+	"doctor.tool_optional":        "not found (optional)",
+	"doctor.status_ok":            "Status: OK",
+	"cli.error":                   "error: %v",
+	"sync.complete":               "Sync complete",
+	"capture.complete":            "Capture complete",
+	"sync.no_operations":          "No module operations recorded.",
+	"discover.nontty_yes":         "Not running in a terminal; auto-accepting recommended files (--non-interactive=yes).",
+	"discover.nontty_report":      "Not running in a terminal; printing the report only. Use --yes or --non-interactive=yes to add recommended files unattended.",
+	"discover.no_candidates":      "No candidates found.",
+	"discover.discovered":         "Discovered %d candidates:",
+	"discover.auto_selecting":     "Auto-selecting %d recommended items.",
+	"discover.command_prompt":     "Selected: %d items. Command: ",
+	"discover.cancelled":          "Cancelled.",
+	"discover.selected_all":       "Selected all %d items.",
+	"discover.cleared":            "Cleared selection.",
+	"discover.invalid_item":       "Invalid item number: %d",
+	"discover.invalid_range":      "Invalid item range: %d-%d",
+	"discover.confirm_add":        "Add %d files (%s) to the repository? [Y/n] ",
+	"discover.confirm_commit":     "Commit the changes? [Y/n] ",
+	"discover.scan_completed":     "Scan completed in %v",
+	"discover.review_title":       "Discovery Review TUI",
+	"discover.review_intro":       "Recommended items are pre-selected; Maybe items need review; Risky items may contain secrets; ignored items are summarized below.",
+	"discover.review_modules":     "Non-file macOS state is better handled by dot macos audit --json and future module capture flows.",
+	"discover.count_recommended":  "  Recommended: %d",
+	"discover.count_maybe":        "  Maybe: %d",
+	"discover.count_risky":        "  Risky: %d",
+	"discover.count_subrepos":     "  Sub-repos: %d",
+	"discover.commands_help": "Discovery review commands:\n" +
+		"  Enter  - Accept current selection\n" +
+		"  a      - Select all\n" +
+		"  n      - Select none\n" +
+		"  1,2,3  - Toggle specific items\n" +
+		"  +5     - Add item 5\n" +
+		"  -5     - Remove item 5\n" +
+		"  3-12   - Toggle items 3 through 12 (+3-12 adds, -3-12 removes)\n" +
+		"  maybe  - Select every Maybe item (also rec, risky; -maybe deselects)\n" +
+		"  sort size - Re-sort within each category by size, path, score, or mtime\n" +
+		"  collapse / expand - Show each directory's files as one item range, or list them all\n" +
+		"  attr 5 private,readonly - Set chezmoi attributes for item 5 (private, readonly, create, symlink, none)\n" +
+		"  q      - Quit without adding",
+	"discover.sort_usage":             "Usage: sort <size|path|score|mtime>",
+	"discover.warning":                "       WARNING: %s",
+	"discover.covered":                "Already covered (%d):",
+	"discover.ignored":                "Ignored by default:",
+	"discover.ignored_tip":            "  Tip: use --deep or --roots for explicit broad scans; non-file macOS state is better handled by dot macos audit --json.",
+	"discover.section_recommended":    "Recommended (pre-selected)",
+	"discover.section_maybe":          "Maybe",
+	"discover.section_risky":          "Risky (may contain secrets)",
+	"discover.collapsed_detail":       "%d items, %s",
+	"discover.collapsed_warnings":     ", %d secret warnings",
+	"discover.added":                  "Added: %s",
+	"discover.removed":                "Removed: %s",
+	"discover.selected_category":      "Selected %d items.",
+	"discover.deselected_category":    "Deselected %d items.",
+	"discover.attr_usage":             "Usage: attr <items> <attributes>, e.g. attr 3 private,readonly",
+	"discover.attr_invalid":           "Invalid attributes: %v",
+	"discover.attr_cleared":           "Cleared attributes: %s",
+	"discover.attr_set":               "Attributes %s: %s",
+	"discover.large_header":           "%d selected files are over %s (%s of %s selected):",
+	"discover.large_auto_yes":         "Skipping large files in auto-yes mode; run dot discover interactively to add them.",
+	"discover.large_choices":          "[s]kip, [k]eep",
+	"discover.large_choices_lfs":      "[l]fs, [s]kip, [k]eep",
+	"discover.lfs_missing":            "git-lfs is not installed; large files can only be skipped or kept.",
+	"discover.large_prompt":           "%s (%s): %s? [s] ",
+	"discover.drift_header":           "=== Changed since managed (%d) ===",
+	"discover.drift_auto_yes":         "Keeping repo versions in auto-yes mode; run dot discover interactively or dot capture to update them.",
+	"discover.drift_legend":           "Lines marked - are on this machine; + is the managed version in the repo.",
+	"discover.drift_prompt":           "[u]pdate managed version, [k]eep repo version? [k] ",
+	"discover.secret_header":          "=== Secret review (%d files) ===",
+	"discover.secret_auto_yes":        "Skipping files with secret findings in auto-yes mode; run dot discover interactively to review them.",
+	"discover.secret_finding":         "  %s (%s confidence, line %d)",
+	"discover.secret_prompt":          "[a]dd anyway, [s]kip file, a[l]lowlist finding? [s] ",
+	"discover.secret_prompt_template": "[a]dd anyway, [t]emplate secrets, [s]kip file, a[l]lowlist finding? [s] ",
+	"discover.scanned":                "Scanned: %d directories, %d files",
+	"discover.diagnostics":            "=== Diagnostics (%d) ===",
+	"discover.remediation":            "       remediation: %s",
+	"discover.category_recommended":   "Recommended",
+	"discover.category_maybe":         "Maybe",
+	"discover.category_risky":         "Risky",
+	"discover.report_section":         "=== %s (%d) ===",
+	"discover.kind_file":              "file",
+	"discover.kind_dir":               "dir",
+	"discover.kind_repo":              "repo",
+	"discover.report_candidate":       "[%s] %s (score=%d, %s)",
+	"discover.reasons":                "       reasons: %s",
+	"discover.attributes":             "       attributes: %s",
+	"discover.remote":                 "       remote: %s",
+	"discover.subrepos":               "=== Sub-repositories (%d) ===",
+	"discover.local_only":             "(local only)",
+	"discover.apps_applied":           "Every installed app with managed configs is applied.",
+	"discover.apps_header":            "=== Installed apps with unapplied configs (%d) ===",
+	"discover.apps_missing_count":     "%d missing",
+	"discover.apps_unapplied_count":   "%d not applied",
+	"discover.apps_missing":           "       missing: %s",
+	"discover.apps_unapplied":         "       not applied: %s",
+	"discover.apps_run":               "       run: %s",
+	"discover.pending_never":          "No scheduled discovery pass has run yet; set [discover] interval_hours to enable one.",
+	"discover.pending_last_run":       "Last scheduled discovery: %s",
+	"discover.pending_empty":          "No pending candidates.",
+	"discover.pending_header":         "=== Pending recommended (%d) ===",
+	"discover.pending_candidate":      "[%s] %s (score=%d, found %s)",
+	"discover.pending_run":            "Run dot discover to review and add them.",
+}
@@ -0,0 +1,130 @@
+package i18n
+
+// portuguese is the Portuguese (pt) catalog.
+var portuguese = map[string]string{
+	"doctor.system":               "Sistema",
+	"doctor.platform":             "Plataforma: %s/%s",
+	"doctor.home":                 "Diretório pessoal: %s",
+	"doctor.wsl":                  "WSL: detectado",
+	"doctor.machine":              "Máquina: %s (%s)",
+	"doctor.machine_missing":      "Máquina: sem arquivo de identidade; execute dot bootstrap para criá-lo",
+	"doctor.config":               "Configuração",
+	"doctor.config_not_found":     "Não encontrada: %v",
+	"doctor.config_tip":           "Dica: execute a partir da raiz do repositório ou passe --config caminho/para/dot.toml",
+	"doctor.config_path":          "Caminho: %s",
+	"doctor.repo_root":            "Raiz do repositório: %s",
+	"doctor.repo_url":             "URL do repositório: %s",
+	"doctor.branch":               "Branch: %s",
+	"doctor.forge":                "Forge",
+	"doctor.forge_scopes_unknown": "escopos do token não informados (token refinado ou não pessoal); não é possível verificá-los",
+	"doctor.forge_scopes_missing": "escopos ausentes",
+	"doctor.git_identity":         "Identidade git",
+	"doctor.exports":              "Exportadores",
+	"doctor.packages":             "Pacotes",
+	"doctor.case_collision":       "Colisão de maiúsculas/minúsculas",
+	"doctor.health":               "Saúde",
+	"doctor.prerequisites":        "Pré-requisitos",
+	"doctor.tool_missing":         "(AUSENTE)",
+	"doctor.tool_optional":        "não encontrado (opcional)",
+	"doctor.status_ok":            "Status: OK",
+	"cli.error":                   "erro: %v",
+	"sync.complete":               "Sincronização concluída",
+	"capture.complete":            "Captura concluída",
+	"sync.no_operations":          "Nenhuma operação de módulo registrada.",
+	"discover.nontty_yes":         "Fora de um terminal; aceitando automaticamente os arquivos recomendados (--non-interactive=yes).",
+	"discover.nontty_report":      "Fora de um terminal; apenas exibindo o relatório. Use --yes ou --non-interactive=yes para adicionar os arquivos recomendados sem supervisão.",
+	"discover.no_candidates":      "Nenhum candidato encontrado.",
+	"discover.discovered":         "%d candidatos descobertos:",
+	"discover.auto_selecting":     "Selecionando automaticamente %d itens recomendados.",
+	"discover.command_prompt":     "Selecionados: %d itens. Comando: ",
+	"discover.cancelled":          "Cancelado.",
+	"discover.selected_all":       "Todos os %d itens selecionados.",
+	"discover.cleared":            "Seleção limpa.",
+	"discover.invalid_item":       "Número de item inválido: %d",
+	"discover.invalid_range":      "Intervalo de itens inválido: %d-%d",
+	"discover.confirm_add":        "Adicionar %d arquivos (%s) ao repositório? [Y/n] ",
+	"discover.confirm_commit":     "Fazer commit das alterações? [Y/n] ",
+	"discover.scan_completed":     "Varredura concluída em %v",
+	"discover.review_title":       "Revisão da descoberta",
+	"discover.review_intro":       "Itens Recomendados vêm pré-selecionados; itens Talvez precisam de revisão; itens Arriscados podem conter segredos; itens ignorados são resumidos abaixo.",
+	"discover.review_modules":     "Estado do macOS que não é arquivo é melhor tratado por dot macos audit --json e pelos futuros fluxos de captura de módulos.",
+	"discover.count_recommended":  "  Recomendados: %d",
+	"discover.count_maybe":        "  Talvez: %d",
+	"discover.count_risky":        "  Arriscados: %d",
+	"discover.count_subrepos":     "  Sub-repositórios: %d",
+	"discover.commands_help": "Comandos da revisão:\n" +
+		"  Enter  - Aceitar a seleção atual\n" +
+		"  a      - Selecionar tudo\n" +
+		"  n      - Limpar a seleção\n" +
+		"  1,2,3  - Alternar itens específicos\n" +
+		"  +5     - Adicionar o item 5\n" +
+		"  -5     - Remover o item 5\n" +
+		"  3-12   - Alternar os itens 3 a 12 (+3-12 adiciona, -3-12 remove)\n" +
+		"  maybe  - Selecionar todos os itens Talvez (também rec, risky; -maybe desmarca)\n" +
+		"  sort size - Reordenar cada categoria por size, path, score ou mtime\n" +
+		"  collapse / expand - Mostrar os arquivos de cada diretório como um intervalo, ou listar todos\n" +
+		"  attr 5 private,readonly - Definir atributos do chezmoi para o item 5 (private, readonly, create, symlink, none)\n" +
+		"  q      - Sair sem adicionar",
+	"discover.sort_usage":             "Uso: sort <size|path|score|mtime>",
+	"discover.warning":                "       AVISO: %s",
+	"discover.covered":                "Já cobertos (%d):",
+	"discover.ignored":                "Ignorados por padrão:",
+	"discover.ignored_tip":            "  Dica: use --deep ou --roots para varreduras amplas explícitas; estado do macOS que não é arquivo é melhor tratado por dot macos audit --json.",
+	"discover.section_recommended":    "Recomendados (pré-selecionados)",
+	"discover.section_maybe":          "Talvez",
+	"discover.section_risky":          "Arriscados (podem conter segredos)",
+	"discover.collapsed_detail":       "%d itens, %s",
+	"discover.collapsed_warnings":     ", %d avisos de segredo",
+	"discover.added":                  "Adicionado: %s",
+	"discover.removed":                "Removido: %s",
+	"discover.selected_category":      "%d itens selecionados.",
+	"discover.deselected_category":    "%d itens desmarcados.",
+	"discover.attr_usage":             "Uso: attr <itens> <atributos>, por exemplo attr 3 private,readonly",
+	"discover.attr_invalid":           "Atributos inválidos: %v",
+	"discover.attr_cleared":           "Atributos removidos: %s",
+	"discover.attr_set":               "Atributos %s: %s",
+	"discover.large_header":           "%d arquivos selecionados passam de %s (%s de %s selecionados):",
+	"discover.large_auto_yes":         "Ignorando arquivos grandes no modo auto-yes; execute dot discover interativamente para adicioná-los.",
+	"discover.large_choices":          "[s] ignorar, [k] manter",
+	"discover.large_choices_lfs":      "[l] lfs, [s] ignorar, [k] manter",
+	"discover.lfs_missing":            "git-lfs não está instalado; arquivos grandes só podem ser ignorados ou mantidos.",
+	"discover.large_prompt":           "%s (%s): %s? [s] ",
+	"discover.drift_header":           "=== Alterados desde o gerenciamento (%d) ===",
+	"discover.drift_auto_yes":         "Mantendo as versões do repositório no modo auto-yes; execute dot discover interativamente ou dot capture para atualizá-las.",
+	"discover.drift_legend":           "Linhas marcadas com - estão nesta máquina; + é a versão gerenciada no repositório.",
+	"discover.drift_prompt":           "[u] atualizar a versão gerenciada, [k] manter a versão do repositório? [k] ",
+	"discover.secret_header":          "=== Revisão de segredos (%d arquivos) ===",
+	"discover.secret_auto_yes":        "Ignorando arquivos com segredos encontrados no modo auto-yes; execute dot discover interativamente para revisá-los.",
+	"discover.secret_finding":         "  %s (confiança %s, linha %d)",
+	"discover.secret_prompt":          "[a] adicionar mesmo assim, [s] ignorar o arquivo, [l] liberar o achado? [s] ",
+	"discover.secret_prompt_template": "[a] adicionar mesmo assim, [t] transformar segredos em template, [s] ignorar o arquivo, [l] liberar o achado? [s] ",
+	"discover.scanned":                "Varridos: %d diretórios, %d arquivos",
+	"discover.diagnostics":            "=== Diagnósticos (%d) ===",
+	"discover.remediation":            "       correção: %s",
+	"discover.category_recommended":   "Recomendados",
+	"discover.category_maybe":         "Talvez",
+	"discover.category_risky":         "Arriscados",
+	"discover.report_section":         "=== %s (%d) ===",
+	"discover.kind_file":              "arquivo",
+	"discover.kind_dir":               "diretório",
+	"discover.kind_repo":              "repositório",
+	"discover.report_candidate":       "[%s] %s (pontuação=%d, %s)",
+	"discover.reasons":                "       motivos: %s",
+	"discover.attributes":             "       atributos: %s",
+	"discover.remote":                 "       remoto: %s",
+	"discover.subrepos":               "=== Sub-repositórios (%d) ===",
+	"discover.local_only":             "(somente local)",
+	"discover.apps_applied":           "Todo aplicativo instalado com configurações gerenciadas está aplicado.",
+	"discover.apps_header":            "=== Aplicativos instalados com configurações não aplicadas (%d) ===",
+	"discover.apps_missing_count":     "%d ausentes",
+	"discover.apps_unapplied_count":   "%d não aplicadas",
+	"discover.apps_missing":           "       ausente: %s",
+	"discover.apps_unapplied":         "       não aplicada: %s",
+	"discover.apps_run":               "       execute: %s",
+	"discover.pending_never":          "Nenhuma descoberta agendada foi executada ainda; defina [discover] interval_hours para habilitá-la.",
+	"discover.pending_last_run":       "Última descoberta agendada: %s",
+	"discover.pending_empty":          "Nenhum candidato pendente.",
+	"discover.pending_header":         "=== Recomendados pendentes (%d) ===",
+	"discover.pending_candidate":      "[%s] %s (pontuação=%d, encontrado em %s)",
+	"discover.pending_run":            "Execute dot discover para revisá-los e adicioná-los.",
+}
@@ -0,0 +1,108 @@
+// Package i18n holds the message catalog for user-facing CLI, doctor, and
+// discover prompt strings. The locale comes from DOTSTATE_LANG, then the
+// POSIX LC_ALL, LC_MESSAGES, and LANG variables; messages missing from a
+// locale's catalog fall back to English.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EnvLang overrides the locale for dotstate only.
+const EnvLang = "DOTSTATE_LANG"
+
+// DefaultLocale is the catalog every message must exist in.
+const DefaultLocale = "en"
+
+// catalogs maps a locale (language, or language_REGION) to message IDs and
+// their fmt format strings.
+var catalogs = map[string]map[string]string{
+	"en": english,
+	"pt": portuguese,
+}
+
+var (
+	localeMu sync.Mutex
+	locale   string
+)
+
+// Locales returns the locales with a catalog, sorted.
+func Locales() []string {
+	out := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		out = append(out, l)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Locale returns the active locale, resolving it from the environment on
+// first use.
+func Locale() string {
+	localeMu.Lock()
+	defer localeMu.Unlock()
+	if locale == "" {
+		locale = FromEnv()
+	}
+	return locale
+}
+
+// SetLocale selects a locale explicitly; an empty value re-reads the
+// environment on next use.
+func SetLocale(l string) {
+	localeMu.Lock()
+	defer localeMu.Unlock()
+	locale = ""
+	if l != "" {
+		locale = Match(l)
+	}
+}
+
+// FromEnv resolves the locale from DOTSTATE_LANG, LC_ALL, LC_MESSAGES,
+// and LANG, in that order.
+func FromEnv() string {
+	for _, name := range []string{EnvLang, "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return Match(value)
+		}
+	}
+	return DefaultLocale
+}
+
+// Match maps a POSIX locale such as "pt_BR.UTF-8" to the closest catalog:
+// the exact language_REGION, then the language, then English.
+func Match(value string) string {
+	value, _, _ = strings.Cut(value, ".")
+	value, _, _ = strings.Cut(value, "@")
+	value = strings.ReplaceAll(value, "-", "_")
+	lang, region, _ := strings.Cut(value, "_")
+	lang = strings.ToLower(lang)
+	if region != "" {
+		if full := lang + "_" + strings.ToUpper(region); catalogs[full] != nil {
+			return full
+		}
+	}
+	if catalogs[lang] != nil {
+		return lang
+	}
+	return DefaultLocale
+}
+
+// T formats message id in the active locale. Unknown IDs render as the ID
+// itself so a missing entry is visible rather than silent.
+func T(id string, args ...any) string {
+	format, ok := catalogs[Locale()][id]
+	if !ok {
+		if format, ok = english[id]; !ok {
+			format = id
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
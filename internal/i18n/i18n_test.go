@@ -0,0 +1,87 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := map[string]string{
+		"pt_BR.UTF-8": "pt",
+		"pt-PT":       "pt",
+		"en_US.UTF-8": "en",
+		"C":           "en",
+		"POSIX":       "en",
+		"de_DE@euro":  "en",
+	}
+	for value, want := range tests {
+		if got := Match(value); got != want {
+			t.Errorf("Match(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestFromEnvPrecedence(t *testing.T) {
+	t.Setenv(EnvLang, "")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "pt_BR.UTF-8")
+	t.Setenv("LANG", "en_US.UTF-8")
+	if got := FromEnv(); got != "pt" {
+		t.Fatalf("FromEnv() = %q, want pt from LC_MESSAGES", got)
+	}
+	t.Setenv(EnvLang, "en")
+	if got := FromEnv(); got != "en" {
+		t.Fatalf("FromEnv() = %q, want en from %s", got, EnvLang)
+	}
+}
+
+func TestTFallsBack(t *testing.T) {
+	SetLocale("pt")
+	t.Cleanup(func() { SetLocale("") })
+	if got := T("doctor.platform", "darwin", "arm64"); got != "Plataforma: darwin/arm64" {
+		t.Errorf("T(doctor.platform) = %q", got)
+	}
+	english["test.only_english"] = "only %s"
+	t.Cleanup(func() { delete(english, "test.only_english") })
+	if got := T("test.only_english", "here"); got != "only here" {
+		t.Errorf("T() English fallback = %q", got)
+	}
+	if got := T("test.unknown"); got != "test.unknown" {
+		t.Errorf("T() unknown = %q", got)
+	}
+}
+
+var verbRE = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestCatalogsMatchEnglish(t *testing.T) {
+	for locale, catalog := range catalogs {
+		for id, format := range catalog {
+			ref, ok := english[id]
+			if !ok {
+				t.Errorf("%s: %q is not in the English catalog", locale, id)
+				continue
+			}
+			got, want := verbRE.FindAllString(format, -1), verbRE.FindAllString(ref, -1)
+			if len(got) != len(want) {
+				t.Errorf("%s: %q has verbs %v, English has %v", locale, id, got, want)
+				continue
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("%s: %q has verbs %v, English has %v", locale, id, got, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestCatalogsAreComplete(t *testing.T) {
+	for locale, catalog := range catalogs {
+		for id := range english {
+			if _, ok := catalog[id]; !ok {
+				t.Errorf("%s: %q is missing; add a translation", locale, id)
+			}
+		}
+	}
+}
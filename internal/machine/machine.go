@@ -0,0 +1,172 @@
+// Package machine owns this machine's dotstate identity: a small local file
+// written at bootstrap that names the machine in commits, templates, and
+// targeting rules, so nothing depends on os.Hostname staying stable.
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// FileName is the identity file name under the dotstate state directory.
+const FileName = "machine.toml"
+
+// Identity describes this machine. It is local state and never committed.
+type Identity struct {
+	// ID is the stable machine name recorded in sync commits.
+	ID string `toml:"id"`
+	// Hostname is the hostname captured when the identity was created.
+	Hostname string `toml:"hostname"`
+	// Profile names this machine's role and overrides [templates].profile.
+	Profile string `toml:"profile,omitempty"`
+	// Tags are free-form labels matched by targeting rules.
+	Tags []string `toml:"tags,omitempty"`
+	// CreatedAt is when the identity file was first written.
+	CreatedAt time.Time `toml:"created_at,omitempty"`
+}
+
+// Path returns the identity file location for plat.
+func Path(plat *platform.Platform) string {
+	return filepath.Join(plat.StateDir, "dotstate", FileName)
+}
+
+// Load reads the identity file at path. A missing file returns an error
+// matching os.ErrNotExist; an ID ValidateID rejects is an error too, since
+// the ID names files in the repo.
+func Load(path string) (*Identity, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read machine identity: %w", err)
+	}
+	var id Identity
+	if err := toml.Unmarshal(b, &id); err != nil {
+		return nil, fmt.Errorf("parse machine identity: %w", err)
+	}
+	if err := ValidateID(id.ID); err != nil {
+		return nil, fmt.Errorf("machine identity %s: %w", path, err)
+	}
+	return &id, nil
+}
+
+// Save writes the identity file, creating its directory.
+func (i *Identity) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create machine identity directory: %w", err)
+	}
+	b, err := toml.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("encode machine identity: %w", err)
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+// Ensure loads the identity at path, creating it from hostname and profile
+// when it does not exist yet. created reports whether a file was written.
+func Ensure(path, hostname, profile string) (id *Identity, created bool, err error) {
+	id, err = Load(path)
+	if err == nil {
+		return id, false, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+	id = FromHostname(hostname)
+	id.Profile = profile
+	id.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := id.Save(path); err != nil {
+		return nil, false, err
+	}
+	return id, true, nil
+}
+
+// Current returns the identity stored for plat, or one derived from the
+// live hostname when no identity file exists yet. It never writes.
+func Current(plat *platform.Platform) *Identity {
+	if id, err := Load(Path(plat)); err == nil {
+		return id
+	}
+	return FromHostname(platform.Hostname())
+}
+
+// FromHostname derives an identity whose ID is a slug of hostname, e.g.
+// "Dans-MacBook-Pro.local" becomes "dans-macbook-pro".
+func FromHostname(hostname string) *Identity {
+	return &Identity{ID: Slug(hostname), Hostname: hostname}
+}
+
+// Slug lowercases s, drops any domain suffix, and collapses everything
+// outside [a-z0-9] into single dashes.
+func Slug(s string) string {
+	s, _, _ = strings.Cut(strings.ToLower(s), ".")
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	out := strings.TrimSuffix(b.String(), "-")
+	if out == "" {
+		return "unknown-host"
+	}
+	return out
+}
+
+// ValidateID reports whether id has the shape Slug gives machine IDs:
+// lowercase letters and digits separated by single dashes. Such an ID is
+// safe to join into a repo path.
+func ValidateID(id string) error {
+	if id == "" || Slug(id) != id {
+		return fmt.Errorf("invalid machine ID %q: use lowercase letters, digits, and dashes", id)
+	}
+	return nil
+}
+
+// Matches reports whether the identity satisfies selector. Selectors are
+// "id:<id>", "host:<hostname>", "profile:<profile>", "tag:<tag>", or a bare
+// value, which matches the ID or any tag. "*" matches every machine.
+func (i *Identity) Matches(selector string) bool {
+	selector = strings.TrimSpace(selector)
+	kind, value, ok := strings.Cut(selector, ":")
+	if !ok {
+		return selector == "*" || selector == i.ID || slices.Contains(i.Tags, selector)
+	}
+	switch kind {
+	case "id":
+		return value == i.ID
+	case "host":
+		return strings.EqualFold(value, i.Hostname)
+	case "profile":
+		return value == i.Profile
+	case "tag":
+		return slices.Contains(i.Tags, value)
+	default:
+		return false
+	}
+}
+
+// MatchesAny reports whether any selector matches. An empty list matches.
+func (i *Identity) MatchesAny(selectors []string) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, s := range selectors {
+		if i.Matches(s) {
+			return true
+		}
+	}
+	return false
+}
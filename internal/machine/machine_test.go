@@ -0,0 +1,88 @@
+package machine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureCreatesOnceThenLoads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dotstate", FileName)
+
+	id, created, err := Ensure(path, "Dans-MacBook-Pro.local", "work")
+	if err != nil {
+		t.Fatalf("Ensure error = %v", err)
+	}
+	if !created || id.ID != "dans-macbook-pro" || id.Hostname != "Dans-MacBook-Pro.local" || id.Profile != "work" {
+		t.Fatalf("created=%v id=%#v", created, id)
+	}
+
+	id.Tags = []string{"laptop"}
+	if err := id.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	again, created, err := Ensure(path, "renamed-host", "")
+	if err != nil {
+		t.Fatalf("second Ensure error = %v", err)
+	}
+	if created || again.ID != "dans-macbook-pro" || len(again.Tags) != 1 {
+		t.Fatalf("created=%v id=%#v, want existing identity", created, again)
+	}
+}
+
+func TestLoadMissingIsNotExist(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), FileName))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Load error = %v, want not exist", err)
+	}
+}
+
+func TestLoadRejectsUnsafeID(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"", "..", "../../etc/passwd", "a/b", `a\b`, "Desk"} {
+		path := filepath.Join(dir, FileName)
+		if err := (&Identity{ID: id, Hostname: "desk"}).Save(path); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Load(id %q) error = %v, want an invalid ID", id, err)
+		}
+	}
+}
+
+func TestSlug(t *testing.T) {
+	for in, want := range map[string]string{
+		"laptop-01":           "laptop-01",
+		"Work Box (2)":        "work-box-2",
+		"build01.example.com": "build01",
+		"":                    "unknown-host",
+	} {
+		if got := Slug(in); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	id := &Identity{ID: "laptop-01", Hostname: "Laptop-01.local", Profile: "work", Tags: []string{"mac", "portable"}}
+	for selector, want := range map[string]bool{
+		"*":                    true,
+		"laptop-01":            true,
+		"mac":                  true,
+		"id:laptop-01":         true,
+		"host:laptop-01.local": true,
+		"profile:work":         true,
+		"profile:home":         false,
+		"tag:portable":         true,
+		"tag:server":           false,
+		"os:darwin":            false,
+	} {
+		if got := id.Matches(selector); got != want {
+			t.Errorf("Matches(%q) = %v, want %v", selector, got, want)
+		}
+	}
+	if !id.MatchesAny(nil) || id.MatchesAny([]string{"tag:server"}) {
+		t.Fatal("MatchesAny mismatch")
+	}
+}
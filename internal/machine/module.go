@@ -0,0 +1,66 @@
+package machine
+
+import (
+	"context"
+
+	"github.com/dnery/dotstate/dot/internal/exporters"
+	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// profileExporter records this machine's profile on capture through the
+// exporter module adapter, so dot capture and dot sync report it under
+// export:machine.
+type profileExporter struct {
+	repoRoot string
+	profile  *Profile
+	collect  func(context.Context, *Profile) error
+}
+
+func (e *profileExporter) Name() string                      { return "machine" }
+func (e *profileExporter) Supported(*platform.Platform) bool { return true }
+
+func (e *profileExporter) Capture(ctx context.Context) (exporters.Result, error) {
+	p, err := e.current(ctx)
+	if err != nil {
+		return exporters.Result{}, err
+	}
+	changed, err := WriteProfile(e.repoRoot, p)
+	if err != nil {
+		return exporters.Result{}, err
+	}
+	return exporters.Result{Changed: changed, Paths: []string{ProfilePath(p.ID)}}, nil
+}
+
+// CaptureChanged reports whether Capture would rewrite the profile.
+func (e *profileExporter) CaptureChanged(ctx context.Context) (bool, error) {
+	p, err := e.current(ctx)
+	if err != nil {
+		return false, err
+	}
+	_, _, changed, err := encodeProfile(e.repoRoot, p)
+	return changed, err
+}
+
+// current is the profile as Capture would write it now.
+func (e *profileExporter) current(ctx context.Context) (*Profile, error) {
+	p := *e.profile
+	if e.collect != nil {
+		if err := e.collect(ctx, &p); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+func (e *profileExporter) Apply(context.Context) (exporters.Result, error) {
+	return exporters.Result{}, nil
+}
+
+// NewProfileModule returns the orchestrator module that keeps id's profile
+// under repoRoot current. collect, when set, fills in the captured state
+// dot drift compares; the module belongs after the package modules, so the
+// package lists it records are the ones just captured.
+func NewProfileModule(repoRoot string, id *Identity, plat *platform.Platform, collect func(context.Context, *Profile) error) modules.Module {
+	return exporters.NewCaptureModule(&profileExporter{repoRoot: repoRoot, profile: NewProfile(id, plat), collect: collect})
+}
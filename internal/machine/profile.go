@@ -0,0 +1,144 @@
+package machine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// ProfilesDir holds one committed profile per machine, relative to the repo
+// root.
+const ProfilesDir = "state/machines"
+
+// Profile is the committed record of one machine. Unlike the local
+// Identity it is shared through the repo, so every machine can see the
+// others, and dot drift can compare what each looked like at its last
+// capture.
+type Profile struct {
+	ID       string   `toml:"id" json:"id"`
+	Hostname string   `toml:"hostname" json:"hostname"`
+	Profile  string   `toml:"profile,omitempty" json:"profile,omitempty"`
+	Tags     []string `toml:"tags,omitempty" json:"tags,omitempty"`
+	OS       string   `toml:"os" json:"os"`
+	Arch     string   `toml:"arch" json:"arch"`
+	// Tools maps a tool to the version this machine runs.
+	Tools map[string]string `toml:"tools,omitempty" json:"tools,omitempty"`
+	// Packages maps a package manager to its captured package list.
+	Packages map[string][]string `toml:"packages,omitempty" json:"packages,omitempty"`
+	// Files maps each managed target, slash-separated and relative to home,
+	// to "sha256:<hex>" of its content or "symlink:<dest>". Targets whose
+	// source entry is a template, private, or encrypted are left out, so
+	// the repo never holds a hash of a secret.
+	Files map[string]string `toml:"files,omitempty" json:"files,omitempty"`
+}
+
+// NewProfile describes the machine id runs on.
+func NewProfile(id *Identity, plat *platform.Platform) *Profile {
+	p := &Profile{
+		ID:       id.ID,
+		Hostname: id.Hostname,
+		Profile:  id.Profile,
+		OS:       string(plat.OS),
+		Arch:     plat.Arch,
+	}
+	if len(id.Tags) > 0 {
+		p.Tags = slices.Sorted(slices.Values(id.Tags))
+	}
+	return p
+}
+
+// ProfilePath returns the repo-relative profile file for machine id.
+func ProfilePath(id string) string {
+	return path.Join(ProfilesDir, id+".toml")
+}
+
+// WriteProfile writes p under repoRoot, leaving the file alone when it
+// already says the same thing. changed reports whether it was written. An
+// ID ValidateID rejects is an error, so it cannot write outside
+// ProfilesDir.
+func WriteProfile(repoRoot string, p *Profile) (changed bool, err error) {
+	file, b, changed, err := encodeProfile(repoRoot, p)
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return false, fmt.Errorf("create machine profile directory: %w", err)
+	}
+	if err := os.WriteFile(file, b, 0o644); err != nil {
+		return false, fmt.Errorf("write machine profile: %w", err)
+	}
+	return true, nil
+}
+
+// encodeProfile returns p's file under repoRoot and its content, and
+// whether that differs from what the file holds now.
+func encodeProfile(repoRoot string, p *Profile) (file string, b []byte, changed bool, err error) {
+	if err := ValidateID(p.ID); err != nil {
+		return "", nil, false, err
+	}
+	b, err = toml.Marshal(p)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("encode machine profile: %w", err)
+	}
+	file = filepath.Join(repoRoot, filepath.FromSlash(ProfilePath(p.ID)))
+	if old, err := os.ReadFile(file); err == nil && bytes.Equal(old, b) {
+		return file, b, false, nil
+	}
+	return file, b, true, nil
+}
+
+// LoadProfile reads machine id's profile from repoRoot. A missing profile
+// returns an error matching os.ErrNotExist; an id ValidateID rejects is an
+// error too, so it cannot reach outside ProfilesDir.
+func LoadProfile(repoRoot, id string) (*Profile, error) {
+	if err := ValidateID(id); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(repoRoot, filepath.FromSlash(ProfilePath(id))))
+	if err != nil {
+		return nil, fmt.Errorf("read machine profile: %w", err)
+	}
+	var p Profile
+	if err := toml.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("parse machine profile %s: %w", id, err)
+	}
+	if p.ID == "" {
+		p.ID = id
+	}
+	return &p, nil
+}
+
+// LoadProfiles reads every profile under repoRoot, sorted by ID. A repo
+// without any returns none.
+func LoadProfiles(repoRoot string) ([]*Profile, error) {
+	entries, err := os.ReadDir(filepath.Join(repoRoot, filepath.FromSlash(ProfilesDir)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read machine profiles: %w", err)
+	}
+	var out []*Profile
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".toml")
+		if !ok || entry.IsDir() || ValidateID(id) != nil {
+			continue
+		}
+		p, err := LoadProfile(repoRoot, id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	slices.SortFunc(out, func(a, b *Profile) int { return strings.Compare(a.ID, b.ID) })
+	return out, nil
+}
@@ -0,0 +1,87 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+func TestWriteProfileOnlyWhenChanged(t *testing.T) {
+	repo := t.TempDir()
+	plat := &platform.Platform{OS: platform.Linux, Arch: "arm64"}
+	id := &Identity{ID: "desk", Hostname: "desk.lan", Profile: "work", Tags: []string{"gpu", "big"}}
+
+	changed, err := WriteProfile(repo, NewProfile(id, plat))
+	if err != nil || !changed {
+		t.Fatalf("first WriteProfile = %v, %v", changed, err)
+	}
+	if changed, err := WriteProfile(repo, NewProfile(id, plat)); err != nil || changed {
+		t.Fatalf("unchanged WriteProfile = %v, %v", changed, err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "state", "machines", "desk.toml")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := WriteProfile(repo, NewProfile(&Identity{ID: "air", Hostname: "air.local"}, &platform.Platform{OS: platform.Darwin, Arch: "arm64"})); err != nil {
+		t.Fatal(err)
+	}
+	profiles, err := LoadProfiles(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles[0].ID != "air" || profiles[1].ID != "desk" {
+		t.Fatalf("profiles = %+v, want air then desk", profiles)
+	}
+	desk := profiles[1]
+	if desk.OS != "linux" || desk.Arch != "arm64" || desk.Profile != "work" || len(desk.Tags) != 2 || desk.Tags[0] != "big" {
+		t.Fatalf("desk = %+v", desk)
+	}
+
+	if _, err := LoadProfile(repo, "gone"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("LoadProfile error = %v, want not exist", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "state", "secret.toml"), []byte("id = \"secret\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"../secret", "../../etc/passwd", "a/b", `..\secret`, "Desk", ""} {
+		if _, err := LoadProfile(repo, id); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("LoadProfile(%q) error = %v, want an invalid ID", id, err)
+		}
+	}
+	for _, id := range []string{"../secret", "a/b", ""} {
+		if _, err := WriteProfile(repo, &Profile{ID: id}); err == nil {
+			t.Errorf("WriteProfile(%q) succeeded, want an invalid ID", id)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(repo, "state", "secret.toml")); err != nil || string(b) != "id = \"secret\"\n" {
+		t.Fatalf("secret.toml = %q, %v; want it untouched", b, err)
+	}
+	if profiles, err := LoadProfiles(t.TempDir()); err != nil || profiles != nil {
+		t.Fatalf("empty repo profiles = %v, %v", profiles, err)
+	}
+}
+
+func TestProfileModuleCapturesCollectedState(t *testing.T) {
+	repo := t.TempDir()
+	mod := NewProfileModule(repo, &Identity{ID: "desk", Hostname: "desk"}, &platform.Platform{OS: platform.Linux, Arch: "amd64"}, func(_ context.Context, p *Profile) error {
+		p.Tools = map[string]string{"dot": "1.2.0"}
+		return nil
+	})
+	orch := modules.NewOrchestrator(mod)
+
+	if _, err := orch.Run(context.Background(), modules.OperationCapture, modules.RunOptions{}); err != nil {
+		t.Fatalf("Capture error = %v", err)
+	}
+	p, err := LoadProfile(repo, "desk")
+	if err != nil {
+		t.Fatalf("profile not captured: %v", err)
+	}
+	if p.Hostname != "desk" || p.Tools["dot"] != "1.2.0" {
+		t.Fatalf("profile = %+v, want the identity and collected tools", p)
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +19,7 @@ import (
 
 	"github.com/dnery/dotstate/dot/internal/config"
 	"github.com/dnery/dotstate/dot/internal/discover"
+	"github.com/dnery/dotstate/dot/internal/gitx"
 	"github.com/dnery/dotstate/dot/internal/modules"
 	"github.com/dnery/dotstate/dot/internal/redact"
 	"github.com/dnery/dotstate/dot/internal/runner"
@@ -26,7 +29,8 @@ const generatedHeader = "# Generated by dotstate. Review before committing.\n"
 
 // NewStateModules returns macOS non-file modules for shared apply/capture/sync
 // orchestration. The modules are capture-first; system mutation is manual except
-// for clone-if-missing subrepos, which are reversible by deleting the cloned path.
+// for clone-if-missing subrepos, which are reversible by deleting the cloned path,
+// and fast-forwards of present ones.
 func NewStateModules(cfg *config.Config, r runner.Runner, home string) []modules.Module {
 	if cfg == nil {
 		return nil
@@ -103,6 +107,15 @@ func newArtifactModule(surface, path string, cache *auditCache, renderer artifac
 
 func (m *artifactModule) Surface() string { return m.surface }
 
+func (m *artifactModule) ApplyStep() string {
+	switch m.surface {
+	case surfaceBrew, surfaceMAS, surfaceApps:
+		return config.ApplyStepPackages
+	default:
+		return config.ApplyStepOS
+	}
+}
+
 func (m *artifactModule) Audit(ctx context.Context) ([]modules.Fact, []modules.Diagnostic, error) {
 	return m.cache.facts(ctx, m.surface), m.cache.diagnostics(ctx, m.surface), nil
 }
@@ -261,12 +274,176 @@ func newSecretsModule(path string, cache *auditCache) *artifactModule {
 
 // SubrepoStatus is the read-only status for one desired subrepo entry.
 type SubrepoStatus struct {
-	Path      string
+	Path string
+	// Dest is Path expanded under home.
+	Dest      string
 	URL       string
 	Branch    string
 	Exists    bool
 	IsGitRepo bool
 	Status    string
+	// Entry is the manifest entry as declared.
+	Entry discover.SubRepoManifest
+
+	// The fields below are set by Inspect for present subrepos.
+
+	// CurrentBranch is the checked-out branch, or "HEAD" when detached.
+	CurrentBranch string
+	Dirty         bool
+	// HasUpstream reports whether CurrentBranch tracks a remote branch;
+	// Ahead and Behind count against it as of the last fetch.
+	HasUpstream bool
+	Ahead       int
+	Behind      int
+}
+
+// Inspect reads the git state of a present subrepo: its branch, uncommitted
+// changes, and position relative to its upstream. It does not fetch.
+func (s *SubrepoStatus) Inspect(ctx context.Context, g *gitx.Git) error {
+	if !s.IsGitRepo {
+		return nil
+	}
+	branch, err := g.CurrentBranch(ctx, s.Dest)
+	if err != nil {
+		return fmt.Errorf("inspect subrepo %s: %w", s.Path, err)
+	}
+	dirty, err := g.HasChanges(ctx, s.Dest)
+	if err != nil {
+		return fmt.Errorf("inspect subrepo %s: %w", s.Path, err)
+	}
+	ahead, behind, tracked, err := g.AheadBehind(ctx, s.Dest)
+	if err != nil {
+		return fmt.Errorf("inspect subrepo %s: %w", s.Path, err)
+	}
+	s.CurrentBranch, s.Dirty = branch, dirty
+	s.HasUpstream, s.Ahead, s.Behind = tracked, ahead, behind
+	return nil
+}
+
+// BranchDrift reports whether the checkout is off the manifest's branch.
+// Entries without a branch follow the remote default and never drift.
+func (s SubrepoStatus) BranchDrift() bool {
+	return s.Branch != "" && s.CurrentBranch != "" && s.CurrentBranch != s.Branch
+}
+
+// Drift describes how an inspected subrepo differs from a clean checkout of
+// its manifest entry, one short phrase per difference.
+func (s SubrepoStatus) Drift() []string {
+	var drift []string
+	switch {
+	case s.CurrentBranch == "HEAD":
+		drift = append(drift, "detached HEAD")
+	case s.BranchDrift():
+		drift = append(drift, fmt.Sprintf("on %s, manifest wants %s", s.CurrentBranch, s.Branch))
+	}
+	if s.Dirty {
+		drift = append(drift, "uncommitted changes")
+	}
+	if s.Ahead > 0 {
+		drift = append(drift, fmt.Sprintf("%d ahead", s.Ahead))
+	}
+	if s.Behind > 0 {
+		drift = append(drift, fmt.Sprintf("%d behind", s.Behind))
+	}
+	if s.CurrentBranch != "" && s.CurrentBranch != "HEAD" && !s.HasUpstream {
+		drift = append(drift, "no upstream")
+	}
+	return drift
+}
+
+// Outcomes of SubrepoStatus.Update.
+const (
+	SubrepoCloned  = "cloned"
+	SubrepoUpdated = "updated"
+	SubrepoCurrent = "current"
+	SubrepoSkipped = "skipped"
+	SubrepoFailed  = "failed"
+)
+
+// SubrepoUpdate is the outcome of cloning or updating one subrepo.
+type SubrepoUpdate struct {
+	Path    string `json:"path"`
+	Outcome string `json:"outcome"`
+	// Detail says what was done, or why nothing was.
+	Detail string `json:"detail,omitempty"`
+	Err    error  `json:"-"`
+}
+
+// Update brings a subrepo in line with its manifest entry. A missing one is
+// cloned. A present one is fetched, switched to the manifest's branch if it
+// is on another, and fast-forwarded to its upstream. Uncommitted changes, a
+// detached HEAD without a pinned branch, a missing upstream, and diverged
+// history are left alone and reported as skipped, so no local work is lost.
+// Update leaves s inspected as of after the update.
+func (s *SubrepoStatus) Update(ctx context.Context, g *gitx.Git) SubrepoUpdate {
+	u := SubrepoUpdate{Path: s.Path}
+	skip := func(detail string) SubrepoUpdate {
+		u.Outcome, u.Detail = SubrepoSkipped, detail
+		return u
+	}
+	fail := func(err error) SubrepoUpdate {
+		u.Outcome, u.Detail, u.Err = SubrepoFailed, redact.Text(err.Error()), err
+		return u
+	}
+	switch {
+	case !s.Exists:
+		url, safe := subrepoRemoteSafety(s.URL)
+		if !safe {
+			return skip("remote is empty or contains credentials")
+		}
+		if err := cloneSubrepo(ctx, g, s.Path, s.Dest, url, s.Branch, s.Entry.CloneDepth()); err != nil {
+			return fail(err)
+		}
+		s.Exists, s.IsGitRepo, s.Status = true, true, "present"
+		u.Outcome = SubrepoCloned
+		return u
+	case !s.IsGitRepo:
+		return skip("destination exists but is not a git repository")
+	}
+	if err := g.Fetch(ctx, s.Dest); err != nil {
+		return fail(fmt.Errorf("fetch subrepo %s: %w", s.Path, err))
+	}
+	if err := s.Inspect(ctx, g); err != nil {
+		return fail(err)
+	}
+	if s.Dirty {
+		return skip("uncommitted changes")
+	}
+	switched := false
+	if s.Branch != "" && s.CurrentBranch != s.Branch {
+		if err := g.Switch(ctx, s.Dest, s.Branch); err != nil {
+			return fail(fmt.Errorf("switch subrepo %s to %s: %w", s.Path, s.Branch, err))
+		}
+		if err := s.Inspect(ctx, g); err != nil {
+			return fail(err)
+		}
+		switched = true
+	}
+	switch {
+	case s.CurrentBranch == "HEAD":
+		return skip("detached HEAD")
+	case !s.HasUpstream:
+		return skip("no upstream")
+	case s.Ahead > 0 && s.Behind > 0:
+		return skip(fmt.Sprintf("diverged from upstream (%d ahead, %d behind)", s.Ahead, s.Behind))
+	}
+	var done []string
+	if switched {
+		done = append(done, "switched to "+s.Branch)
+	}
+	if s.Behind > 0 {
+		if err := g.FastForward(ctx, s.Dest); err != nil {
+			return fail(fmt.Errorf("fast-forward subrepo %s: %w", s.Path, err))
+		}
+		done = append(done, fmt.Sprintf("fast-forwarded %d commit(s)", s.Behind))
+		s.Behind = 0
+	}
+	if len(done) == 0 {
+		u.Outcome = SubrepoCurrent
+		return u
+	}
+	u.Outcome, u.Detail = SubrepoUpdated, strings.Join(done, ", ")
+	return u
 }
 
 // SubrepoStatuses reads state/subrepos.toml and reports clone readiness without mutation.
@@ -288,7 +465,7 @@ func SubrepoStatuses(cfg *config.Config, home string) ([]SubrepoStatus, error) {
 		case exists:
 			status = "blocked_existing_non_git"
 		}
-		statuses = append(statuses, SubrepoStatus{Path: entry.Path, URL: entry.URL, Branch: entry.Branch, Exists: exists, IsGitRepo: isRepo, Status: status})
+		statuses = append(statuses, SubrepoStatus{Path: entry.Path, Dest: path, URL: entry.URL, Branch: entry.Branch, Exists: exists, IsGitRepo: isRepo, Status: status, Entry: entry})
 	}
 	return statuses, nil
 }
@@ -306,6 +483,8 @@ func newSubreposModule(cfg *config.Config, r runner.Runner, home string) *subrep
 
 func (m *subreposModule) Surface() string { return surfaceSubrepos }
 
+func (m *subreposModule) ApplyStep() string { return config.ApplyStepSubrepos }
+
 func (m *subreposModule) manifestPath() string {
 	return filepath.Join(m.cfg.StatePath(), "subrepos.toml")
 }
@@ -375,14 +554,18 @@ func (m *subreposModule) Plan(ctx context.Context, operation modules.Operation)
 				risk = modules.Risk{Level: modules.RiskHigh, Reasons: []string{"subrepo remote is empty or contains credentials"}, RequiresConfirmation: true, Reversible: false}
 				diagnostics = append(diagnostics, unsafeSubrepoRemoteDiagnostic(entry.Path))
 			}
-		} else if !isRepo {
+		} else if isRepo {
+			action = modules.ActionUpdate
+			capabilities = []modules.Capability{modules.CapabilityAutoApply}
+			risk = modules.Risk{Level: modules.RiskLow, Reasons: []string{"fast-forward subrepo"}, RequiresConfirmation: false, Reversible: true}
+		} else {
 			action = modules.ActionManual
 			capabilities = []modules.Capability{modules.CapabilityManual}
 			diagnostics = append(diagnostics, modules.NewDiagnostic(modules.SeverityWarning, "subrepos.destination_exists_not_git", "Subrepo destination exists but is not a git repository; clone is manual.", surfaceSubrepos, "subrepos:path/"+entry.Path))
 		}
 		change := m.baseChange(operation, action, entry)
 		change.Current = map[string]any{"path": entry.Path, "exists": exists, "is_git_repo": isRepo}
-		change.Desired = map[string]any{"path": entry.Path, "url": displayURL, "branch": entry.Branch}
+		change.Desired = map[string]any{"path": entry.Path, "url": displayURL, "branch": entry.Branch, "depth": entry.CloneDepth()}
 		change.Capability = capabilities
 		change.Risk = risk
 		change.Diagnostics = diagnostics
@@ -395,39 +578,143 @@ func (m *subreposModule) Backup(context.Context, []modules.Change, *modules.Plan
 	return nil, nil, nil
 }
 
+// subrepoCloneJobs bounds concurrent subrepo clones.
+const subrepoCloneJobs = 4
+
+// Apply clones missing subrepos and updates present ones, up to
+// subrepoCloneJobs at a time. A subrepo nested inside another one being
+// cloned waits for it. Every job is attempted; failures are reported
+// together.
 func (m *subreposModule) Apply(ctx context.Context, changes []modules.Change, plan *modules.Plan) ([]modules.Result, []modules.Diagnostic, error) {
-	results := make([]modules.Result, 0, len(changes))
-	for _, change := range changes {
+	results := make([]modules.Result, len(changes))
+	errs := make([]error, len(changes))
+	done := make([]chan struct{}, len(changes))
+	var clones, updates []int
+	for i, change := range changes {
+		if change.Action == modules.ActionUpdate {
+			updates = append(updates, i)
+			continue
+		}
 		if change.Action != modules.ActionCreate {
 			status := modules.StatusNoop
 			if change.Action == modules.ActionManual {
 				status = modules.StatusManual
 			}
-			results = append(results, stateResult(plan, change, modules.PhaseApply, status, m.now()))
+			results[i] = stateResult(plan, change, modules.PhaseApply, status, m.now())
 			continue
 		}
-		url, _ := stringFromMap(change.Desired, "url")
-		pathRel, _ := stringFromMap(change.Desired, "path")
-		branch, _ := stringFromMap(change.Desired, "branch")
-		cloneURL, safeRemote := subrepoRemoteSafety(url)
-		if !safeRemote {
-			return results, nil, fmt.Errorf("refusing to clone subrepo %q with unsafe remote; redact credentials in state/subrepos.toml or clone manually", pathRel)
-		}
-		dest := expandHome(pathRel, m.home)
-		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-			return results, nil, fmt.Errorf("create subrepo parent dir: %w", err)
-		}
-		args := []string{"clone"}
-		if branch != "" {
-			args = append(args, "--branch", branch)
-		}
-		args = append(args, cloneURL, dest)
-		if _, err := m.r.Run(ctx, "", "git", args...); err != nil {
-			return results, nil, err
+		done[i] = make(chan struct{})
+		clones = append(clones, i)
+	}
+
+	sem := make(chan struct{}, subrepoCloneJobs)
+	var wg sync.WaitGroup
+	for _, i := range clones {
+		parent := m.enclosingClone(changes, clones, i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+			if parent >= 0 {
+				<-done[parent]
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			status := modules.StatusApplied
+			if errs[i] = m.clone(ctx, changes[i]); errs[i] != nil {
+				status = modules.StatusFailed
+			}
+			results[i] = stateResult(plan, changes[i], modules.PhaseApply, status, m.now())
+			if errs[i] != nil {
+				results[i].Diagnostics = append(results[i].Diagnostics, subrepoFailedDiagnostic(changes[i], errs[i]))
+			}
+		}()
+	}
+	for _, i := range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			status, diag, err := m.update(ctx, changes[i])
+			errs[i] = err
+			results[i] = stateResult(plan, changes[i], modules.PhaseApply, status, m.now())
+			if diag != nil {
+				results[i].Diagnostics = append(results[i].Diagnostics, *diag)
+			}
+			if err != nil {
+				results[i].Diagnostics = append(results[i].Diagnostics, subrepoFailedDiagnostic(changes[i], err))
+			}
+		}()
+	}
+	wg.Wait()
+	return results, nil, errors.Join(errs...)
+}
+
+// Independent reports that a failed clone or update stops no other apply
+// step; each subrepo's failure is reported on its result.
+func (m *subreposModule) Independent() bool { return true }
+
+func subrepoFailedDiagnostic(change modules.Change, err error) modules.Diagnostic {
+	return modules.NewDiagnostic(modules.SeverityError, "subrepos.apply_failed", redact.Text(err.Error()), surfaceSubrepos, change.ID)
+}
+
+// enclosingClone returns the index of the deepest other clone whose
+// destination contains changes[i]'s, or -1.
+func (m *subreposModule) enclosingClone(changes []modules.Change, clones []int, i int) int {
+	path, _ := stringFromMap(changes[i].Desired, "path")
+	dest := expandHome(path, m.home)
+	parent, parentLen := -1, 0
+	for _, j := range clones {
+		other, _ := stringFromMap(changes[j].Desired, "path")
+		otherDest := expandHome(other, m.home)
+		if j != i && len(otherDest) > parentLen && strings.HasPrefix(dest, otherDest+string(filepath.Separator)) {
+			parent, parentLen = j, len(otherDest)
 		}
-		results = append(results, stateResult(plan, change, modules.PhaseApply, modules.StatusApplied, m.now()))
 	}
-	return results, nil, nil
+	return parent
+}
+
+func (m *subreposModule) clone(ctx context.Context, change modules.Change) error {
+	url, _ := stringFromMap(change.Desired, "url")
+	pathRel, _ := stringFromMap(change.Desired, "path")
+	branch, _ := stringFromMap(change.Desired, "branch")
+	depth, _ := stringFromMap(change.Desired, "depth")
+	cloneURL, safeRemote := subrepoRemoteSafety(url)
+	if !safeRemote {
+		return fmt.Errorf("refusing to clone subrepo %q with unsafe remote; redact credentials in state/subrepos.toml or clone manually", pathRel)
+	}
+	n, _ := strconv.Atoi(depth)
+	return cloneSubrepo(ctx, gitx.New("git", m.r), pathRel, expandHome(pathRel, m.home), cloneURL, branch, n)
+}
+
+func cloneSubrepo(ctx context.Context, g *gitx.Git, pathRel, dest, url, branch string, depth int) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("create parent dir for subrepo %s: %w", pathRel, err)
+	}
+	if err := g.Clone(ctx, url, dest, branch, depth); err != nil {
+		return fmt.Errorf("clone subrepo %s: %w", pathRel, err)
+	}
+	return nil
+}
+
+// update fast-forwards a present subrepo, switching it to its manifest
+// branch first, and returns the result status for the outcome.
+func (m *subreposModule) update(ctx context.Context, change modules.Change) (modules.ResultStatus, *modules.Diagnostic, error) {
+	pathRel, _ := stringFromMap(change.Desired, "path")
+	branch, _ := stringFromMap(change.Desired, "branch")
+	status := SubrepoStatus{Path: pathRel, Dest: expandHome(pathRel, m.home), Branch: branch, Exists: true, IsGitRepo: true, Status: "present"}
+	u := status.Update(ctx, gitx.New("git", m.r))
+	switch u.Outcome {
+	case SubrepoUpdated:
+		return modules.StatusApplied, nil, nil
+	case SubrepoCurrent:
+		return modules.StatusNoop, nil, nil
+	case SubrepoSkipped:
+		diag := modules.NewDiagnostic(modules.SeverityWarning, "subrepos.update_skipped", "Subrepo was not updated: "+u.Detail+".", surfaceSubrepos, change.ID)
+		return modules.StatusSkipped, &diag, nil
+	}
+	return modules.StatusFailed, nil, u.Err
 }
 
 func (m *subreposModule) Capture(ctx context.Context, changes []modules.Change, plan *modules.Plan) ([]modules.Result, []modules.Diagnostic, error) {
@@ -3,13 +3,16 @@ package macos
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/gitx"
 	"github.com/dnery/dotstate/dot/internal/modules"
 	"github.com/dnery/dotstate/dot/internal/runner"
 	"github.com/dnery/dotstate/dot/internal/testutil"
@@ -162,6 +165,88 @@ func TestSubreposModuleClonesMissingRepoAndStatusReportsIt(t *testing.T) {
 	}
 }
 
+func TestSubrepoStatusInspectReportsDrift(t *testing.T) {
+	homeDir := testutil.TempDir(t)
+	repoDir := testutil.TempDir(t)
+	cfg := loadMacOSTestConfig(t, repoDir)
+	testutil.TempFile(t, repoDir, "state/subrepos.toml", "[[subrepo]]\npath = \"~/.config/nvim\"\nurl = \"https://github.com/example/nvim.git\"\nbranch = \"main\"\n\n[[subrepo]]\npath = \"~/.config/tmux\"\nurl = \"https://github.com/example/tmux.git\"\n")
+	testutil.TempFile(t, homeDir, ".config/nvim/.git/HEAD", "ref: refs/heads/experiment\n")
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--abbrev-ref", "HEAD"), "experiment\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "status", "--porcelain"), " M init.lua\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}"), "origin/experiment\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-list", "--left-right", "--count", "HEAD...@{upstream}"), "1\t3\n")
+
+	statuses, err := SubrepoStatuses(cfg, homeDir)
+	if err != nil || len(statuses) != 2 {
+		t.Fatalf("SubrepoStatuses() = %#v, %v", statuses, err)
+	}
+	g := gitx.New("git", mock)
+	for i := range statuses {
+		if err := statuses[i].Inspect(context.Background(), g); err != nil {
+			t.Fatalf("Inspect(%s) error = %v", statuses[i].Path, err)
+		}
+	}
+	want := "on experiment, manifest wants main, uncommitted changes, 1 ahead, 3 behind"
+	if got := strings.Join(statuses[0].Drift(), ", "); got != want {
+		t.Fatalf("Drift() = %q, want %q", got, want)
+	}
+	if statuses[1].Status != "missing" || len(statuses[1].Drift()) != 0 {
+		t.Fatalf("missing subrepo = %#v, drift %v; want no git state", statuses[1], statuses[1].Drift())
+	}
+}
+
+func TestSubreposModuleUpdatesPresentClonesOnPinnedBranch(t *testing.T) {
+	ctx := context.Background()
+	upstream := testutil.NewFakeRepo(t)
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadMacOSTestConfig(t, repoDir)
+	url := "file://" + filepath.ToSlash(upstream.Remote)
+	testutil.TempFile(t, repoDir, "state/subrepos.toml", fmt.Sprintf("[[subrepo]]\npath = \"~/.config/nvim\"\nurl = %q\nbranch = \"main\"\n\n[[subrepo]]\npath = \"~/.config/tmux\"\nurl = %q\n", url, url))
+	orch := modules.NewOrchestrator(newSubreposModule(cfg, runner.New(), homeDir))
+	if _, err := orch.Run(ctx, modules.OperationApply, modules.RunOptions{}); err != nil {
+		t.Fatalf("first apply error = %v", err)
+	}
+	nvim := filepath.Join(homeDir, ".config", "nvim")
+	g := gitx.New("git", nil)
+	if err := g.CreateBranch(ctx, nvim, "experiment", "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Switch(ctx, nvim, "experiment"); err != nil {
+		t.Fatal(err)
+	}
+	testutil.TempFile(t, homeDir, ".config/tmux/local.conf", "set -g mouse on\n")
+	upstream.WriteFile("init.lua", "vim.o.number = true\n")
+	upstream.Commit("add init.lua")
+	upstream.Push()
+
+	report, err := orch.Run(ctx, modules.OperationApply, modules.RunOptions{})
+	if err != nil {
+		t.Fatalf("second apply error = %v", err)
+	}
+	statuses := map[string]modules.Result{}
+	for _, result := range report.Results {
+		if result.Phase == modules.PhaseApply {
+			statuses[result.ID] = result
+		}
+	}
+	if got := statuses["subrepos:path/~/.config/nvim"].Status; got != modules.StatusApplied {
+		t.Errorf("nvim status = %s, want applied", got)
+	}
+	tmux := statuses["subrepos:path/~/.config/tmux"]
+	if tmux.Status != modules.StatusSkipped || len(tmux.Diagnostics) != 1 || !strings.Contains(tmux.Diagnostics[0].Message, "uncommitted changes") {
+		t.Errorf("tmux result = %s %+v, want skipped for uncommitted changes", tmux.Status, tmux.Diagnostics)
+	}
+	if branch, _ := g.CurrentBranch(ctx, nvim); branch != "main" {
+		t.Errorf("nvim branch = %s, want the pinned main", branch)
+	}
+	if head, _ := g.RevParse(ctx, nvim, "HEAD"); head != upstream.Head() {
+		t.Errorf("nvim HEAD = %s, want upstream %s", head, upstream.Head())
+	}
+}
+
 func TestSubreposModuleKeepsCredentialedRemoteManual(t *testing.T) {
 	ctx := context.Background()
 	repoDir := testutil.TempDir(t)
@@ -193,6 +278,110 @@ func TestSubreposModuleKeepsCredentialedRemoteManual(t *testing.T) {
 	}
 }
 
+func TestSubreposModuleClonesConcurrentlyAndReportsAllFailures(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadMacOSTestConfig(t, repoDir)
+	var manifest strings.Builder
+	for _, name := range []string{"a", "b", "broken-c", "d", "broken-e", "f"} {
+		fmt.Fprintf(&manifest, "[[subrepo]]\npath = \"~/.config/%s\"\nurl = \"https://github.com/example/%s.git\"\n", name, name)
+	}
+	manifest.WriteString("[[subrepo]]\npath = \"~/.config/a/plugins/z\"\nurl = \"https://github.com/example/z.git\"\n")
+	testutil.TempFile(t, repoDir, "state/subrepos.toml", manifest.String())
+	r := &parallelCloneRunner{}
+	orch := modules.NewOrchestrator(newSubreposModule(cfg, r, homeDir))
+
+	report, err := orch.Run(ctx, modules.OperationApply, modules.RunOptions{})
+	if err == nil || !strings.Contains(err.Error(), "clone subrepo ~/.config/broken-c") || !strings.Contains(err.Error(), "clone subrepo ~/.config/broken-e") {
+		t.Fatalf("Run apply error = %v, want both failed clones", err)
+	}
+	failed, applied := 0, 0
+	for _, result := range report.Results {
+		switch result.Status {
+		case modules.StatusFailed:
+			failed++
+			if len(result.Diagnostics) != 1 || result.Diagnostics[0].Code != "subrepos.apply_failed" {
+				t.Errorf("failed result %s diagnostics = %+v, want the clone error", result.ID, result.Diagnostics)
+			}
+		case modules.StatusApplied:
+			applied++
+		}
+	}
+	if failed != 2 || applied != 5 {
+		t.Fatalf("results: %d failed, %d applied; want 2 and 5", failed, applied)
+	}
+	if r.maxActive < 2 || r.maxActive > subrepoCloneJobs {
+		t.Fatalf("max concurrent clones = %d, want 2..%d", r.maxActive, subrepoCloneJobs)
+	}
+	if !r.nestedAfterParent {
+		t.Fatal("nested subrepo was cloned before its parent finished")
+	}
+}
+
+func TestSubreposModuleClonesShallowByDefault(t *testing.T) {
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadMacOSTestConfig(t, repoDir)
+	testutil.TempFile(t, repoDir, "state/subrepos.toml", `[[subrepo]]
+path = "~/.config/nvim"
+url = "https://github.com/example/nvim.git"
+
+[[subrepo]]
+path = "~/.config/tmux"
+url = "https://github.com/example/tmux.git"
+depth = 50
+
+[[subrepo]]
+path = "~/src/tools"
+url = "https://github.com/example/tools.git"
+shallow = false
+depth = 50
+`)
+	r := &parallelCloneRunner{}
+	if _, err := modules.NewOrchestrator(newSubreposModule(cfg, r, homeDir)).Run(context.Background(), modules.OperationApply, modules.RunOptions{}); err != nil {
+		t.Fatalf("Run apply error = %v", err)
+	}
+	for name, want := range map[string]string{"nvim": "clone --depth 1", "tmux": "clone --depth 50", "tools": "clone https:"} {
+		if got := strings.Join(r.args[name], " "); !strings.HasPrefix(got, want) {
+			t.Errorf("%s clone args = %q, want prefix %q", name, got, want)
+		}
+	}
+}
+
+// parallelCloneRunner fakes slow clones, failing remotes named broken-*.
+type parallelCloneRunner struct {
+	mu                sync.Mutex
+	active, maxActive int
+	cloned            map[string]bool
+	args              map[string][]string
+	nestedAfterParent bool
+}
+
+func (r *parallelCloneRunner) Run(ctx context.Context, dir, name string, args ...string) (*runner.CmdResult, error) {
+	url, dest := args[len(args)-2], args[len(args)-1]
+	r.mu.Lock()
+	r.active++
+	r.maxActive = max(r.maxActive, r.active)
+	if strings.HasSuffix(url, "/z.git") {
+		r.nestedAfterParent = r.cloned["a"]
+	}
+	r.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active--
+	if strings.Contains(url, "broken") {
+		return &runner.CmdResult{Code: 128}, &runner.RunError{Cmd: name, Args: args, Code: 128, Stderr: "fatal: repository not found"}
+	}
+	if r.cloned == nil {
+		r.cloned, r.args = map[string]bool{}, map[string][]string{}
+	}
+	r.cloned[filepath.Base(dest)] = true
+	r.args[filepath.Base(dest)] = args
+	return &runner.CmdResult{}, os.MkdirAll(filepath.Join(dest, ".git"), 0o755)
+}
+
 func loadMacOSTestConfig(t *testing.T, repoDir string) *config.Config {
 	t.Helper()
 	configPath := testutil.TempFile(t, repoDir, config.ConfigFileName, "[repo]\npath = \""+repoDir+"\"\n")
@@ -207,7 +396,7 @@ type cloneRunner struct{ t *testing.T }
 
 func (r *cloneRunner) Run(ctx context.Context, dir, name string, args ...string) (*runner.CmdResult, error) {
 	r.t.Helper()
-	want := []string{"clone", "--branch", "main", "https://github.com/example/nvim.git"}
+	want := []string{"clone", "--branch", "main", "--depth", "1", "https://github.com/example/nvim.git"}
 	if name != "git" || len(args) != len(want)+1 {
 		r.t.Fatalf("unexpected command: %s %v", name, args)
 	}
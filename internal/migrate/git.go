@@ -0,0 +1,184 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// yadmOwn are home paths holding yadm's own bootstrap, encryption list,
+// and encrypted archive rather than dotfiles.
+var yadmOwn = []string{".config/yadm/", ".local/share/yadm/"}
+
+// scanGit plans the files a bare repo, or yadm's, tracks for home. yadm
+// alternates (name##condition) are imported as the copy yadm linked into
+// home for this machine, and its templates are converted when possible.
+func scanGit(ctx context.Context, plan *Plan, opts Options) error {
+	tracked, err := opts.Git.BareFiles(ctx, opts.Path, opts.Home)
+	if err != nil {
+		return fmt.Errorf("list tracked files: %w", err)
+	}
+	alternates := map[string]bool{}
+	for _, f := range tracked {
+		target, suffix, alt := f.Path, "", false
+		if opts.From == FromYadm {
+			target, suffix, alt = strings.Cut(f.Path, "##")
+			if ownedByYadm(target) {
+				plan.Skipped = append(plan.Skipped, Skip{Path: f.Path, Reason: "yadm's own configuration"})
+				continue
+			}
+		}
+		if !alt {
+			if !homeEntry(opts.Home, target, f.Symlink) {
+				plan.Skipped = append(plan.Skipped, Skip{Path: f.Path, Reason: "missing from home"})
+				continue
+			}
+			plan.Files = append(plan.Files, File{Target: target, Origin: f.Path, Symlink: f.Symlink})
+			continue
+		}
+
+		if alternates[target] {
+			continue
+		}
+		if !homeEntry(opts.Home, target, false) {
+			plan.Skipped = append(plan.Skipped, Skip{Path: f.Path, Reason: "no alternate is linked into home on this machine"})
+			continue
+		}
+		file := File{Target: target, Origin: f.Path}
+		if processor, ok := yadmTemplate(suffix); ok {
+			file.Template, err = convertTemplate(opts.Home, f.Path, processor)
+			if err != nil {
+				file.Note = "kept the rendered copy: " + err.Error()
+			}
+		} else {
+			file.Origin = target + "##*"
+			file.Note = "alternates flattened to the copy linked on this machine"
+		}
+		alternates[target] = true
+		plan.Files = append(plan.Files, file)
+	}
+	return nil
+}
+
+func ownedByYadm(target string) bool {
+	for _, prefix := range yadmOwn {
+		if strings.HasPrefix(target, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// yadmTemplate reports whether an alternate suffix marks a template, and
+// with which processor.
+func yadmTemplate(suffix string) (processor string, ok bool) {
+	for _, cond := range strings.Split(suffix, ",") {
+		name, proc, _ := strings.Cut(cond, ".")
+		if name == "t" || name == "template" {
+			if proc == "" {
+				proc = "default"
+			}
+			return proc, true
+		}
+	}
+	return "", false
+}
+
+func convertTemplate(home, origin, processor string) (string, error) {
+	if processor != "default" {
+		return "", fmt.Errorf("the %s template processor cannot be converted", processor)
+	}
+	b, err := os.ReadFile(filepath.Join(home, filepath.FromSlash(origin)))
+	if err != nil {
+		return "", err
+	}
+	return ConvertYadmTemplate(string(b))
+}
+
+// yadmTag matches a yadm default-processor statement or expression.
+var yadmTag = regexp.MustCompile(`\{%-?\s*(.*?)\s*-?%\}|\{\{-?\s*(.*?)\s*-?\}\}`)
+
+// yadmCond matches the conditions ConvertYadmTemplate understands.
+var yadmCond = regexp.MustCompile(`^if\s+yadm\.(\w+)\s*(==|!=)\s*"([^"]*)"$`)
+
+// yadmVars maps yadm variables to dotstate template data.
+var yadmVars = map[string]string{
+	"os":       ".dotstate.machine.os",
+	"arch":     ".dotstate.machine.arch",
+	"hostname": ".dotstate.machine.hostname",
+	"class":    ".dotstate.profile",
+}
+
+// yadmValues maps yadm's uname-style values to dotstate's Go-style ones.
+var yadmValues = map[string]map[string]string{
+	"os":   {"Darwin": "darwin", "Linux": "linux"},
+	"arch": {"x86_64": "amd64", "aarch64": "arm64", "arm64": "arm64"},
+}
+
+// ConvertYadmTemplate rewrites a template for yadm's default processor as
+// a Go template over dotstate's data: yadm.os, yadm.arch, yadm.hostname,
+// and yadm.class in {{ }} expressions and {% if %} equality tests, with
+// {% else %} and {% endif %}. Anything else is an error, as is literal
+// "{{" text, so the caller can keep the rendered copy instead.
+func ConvertYadmTemplate(src string) (string, error) {
+	var b strings.Builder
+	last := 0
+	for _, m := range yadmTag.FindAllStringSubmatchIndex(src, -1) {
+		if err := writeText(&b, src[last:m[0]]); err != nil {
+			return "", err
+		}
+		last = m[1]
+		if m[2] >= 0 {
+			stmt := src[m[2]:m[3]]
+			switch {
+			case stmt == "else":
+				b.WriteString("{{ else }}")
+			case stmt == "endif":
+				b.WriteString("{{ end }}")
+			default:
+				cond := yadmCond.FindStringSubmatch(stmt)
+				if cond == nil {
+					return "", fmt.Errorf("unsupported yadm statement {%% %s %%}", stmt)
+				}
+				field, ok := yadmVars[cond[1]]
+				if !ok {
+					return "", fmt.Errorf("yadm.%s has no dotstate equivalent", cond[1])
+				}
+				value := cond[3]
+				if values, ok := yadmValues[cond[1]]; ok {
+					if value, ok = values[cond[3]]; !ok {
+						return "", fmt.Errorf("yadm.%s value %q has no dotstate equivalent", cond[1], cond[3])
+					}
+				}
+				op := "eq"
+				if cond[2] == "!=" {
+					op = "ne"
+				}
+				fmt.Fprintf(&b, "{{ if %s %s %q }}", op, field, value)
+			}
+			continue
+		}
+		expr := src[m[4]:m[5]]
+		name, ok := strings.CutPrefix(expr, "yadm.")
+		field, known := yadmVars[name]
+		if !ok || !known || yadmValues[name] != nil {
+			return "", fmt.Errorf("unsupported yadm expression {{ %s }}", expr)
+		}
+		fmt.Fprintf(&b, "{{ %s }}", field)
+	}
+	if err := writeText(&b, src[last:]); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func writeText(b *strings.Builder, text string) error {
+	if strings.Contains(text, "{{") || strings.Contains(text, "{%") {
+		return fmt.Errorf("unsupported template syntax")
+	}
+	b.WriteString(text)
+	return nil
+}
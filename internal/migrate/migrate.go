@@ -0,0 +1,157 @@
+// Package migrate moves dotfiles managed by yadm, GNU stow, or a bare git
+// repo into the source state. It reads the old layout to decide which home
+// files to add, then adds them through the engine like dot discover does,
+// so file modes carry over; yadm templates are rewritten for Go templates
+// where their syntax allows.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+)
+
+// Supported source layouts.
+const (
+	FromYadm    = "yadm"
+	FromStow    = "stow"
+	FromBareGit = "bare-git"
+)
+
+// Sources lists the supported layouts.
+var Sources = []string{FromYadm, FromStow, FromBareGit}
+
+// File is one home file to add to the source state.
+type File struct {
+	// Target is slash-separated and relative to home.
+	Target string `json:"target"`
+	// Origin is where the old manager keeps the file, relative to its
+	// repo or stow directory.
+	Origin string `json:"origin"`
+	// Symlink adds the home symlink itself instead of what it points to.
+	Symlink bool `json:"symlink,omitempty"`
+	// Template is a Go template converted from a yadm template, written as
+	// the source in place of the rendered home copy.
+	Template string `json:"-"`
+	// Note explains a lossy import, e.g. flattened yadm alternates.
+	Note string `json:"note,omitempty"`
+}
+
+// Skip is an entry of the old layout that is not imported.
+type Skip struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Plan is what Scan found.
+type Plan struct {
+	From    string `json:"from"`
+	Files   []File `json:"files"`
+	Skipped []Skip `json:"skipped"`
+}
+
+// Options configures Scan.
+type Options struct {
+	From string
+	// Path is the yadm or bare repo's git directory, or the stow directory.
+	Path string
+	Home string
+	Git  *gitx.Git
+}
+
+// Scan reads the old layout at opts.Path and plans the import.
+func Scan(ctx context.Context, opts Options) (*Plan, error) {
+	if info, err := os.Stat(opts.Path); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", opts.Path)
+	}
+	plan := &Plan{From: opts.From, Files: []File{}, Skipped: []Skip{}}
+	var err error
+	switch opts.From {
+	case FromStow:
+		err = scanStow(plan, opts.Path, opts.Home)
+	case FromYadm, FromBareGit:
+		err = scanGit(ctx, plan, opts)
+	default:
+		return nil, fmt.Errorf("unknown source %q; use %s", opts.From, strings.Join(Sources, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(plan.Files, func(a, b File) int { return strings.Compare(a.Target, b.Target) })
+	return plan, nil
+}
+
+// SkipManaged moves files whose target is already in managed, as the engine
+// lists them, to Skipped, so an import never overwrites the source state.
+func (p *Plan) SkipManaged(managed []string) {
+	known := map[string]bool{}
+	for _, target := range managed {
+		known[filepath.ToSlash(target)] = true
+	}
+	files := p.Files[:0]
+	for _, f := range p.Files {
+		if known[f.Target] {
+			p.Skipped = append(p.Skipped, Skip{Path: f.Origin, Reason: "already managed"})
+			continue
+		}
+		files = append(files, f)
+	}
+	p.Files = files
+}
+
+// Add adds the planned files from home to the source state, then replaces
+// the source of each converted template with a .tmpl source holding it.
+// The native engine cannot add templates, so both engines go this way.
+func (p *Plan) Add(ctx context.Context, eng chez.Engine, repoPath, sourceDir, home, secretsMode string) error {
+	groups := map[chez.Attributes][]string{}
+	for _, f := range p.Files {
+		attrs := chez.Attributes{Symlink: f.Symlink}
+		groups[attrs] = append(groups[attrs], filepath.Join(home, filepath.FromSlash(f.Target)))
+	}
+	for _, attrs := range []chez.Attributes{{}, {Symlink: true}} {
+		if len(groups[attrs]) == 0 {
+			continue
+		}
+		if err := eng.AddWithAttributes(ctx, repoPath, sourceDir, groups[attrs], secretsMode, attrs); err != nil {
+			return fmt.Errorf("add %s files: %w", p.From, err)
+		}
+	}
+	for _, f := range p.Files {
+		if f.Template == "" {
+			continue
+		}
+		src, err := eng.SourcePath(ctx, repoPath, sourceDir, filepath.Join(home, filepath.FromSlash(f.Target)))
+		if err != nil {
+			return fmt.Errorf("find source of %s: %w", f.Target, err)
+		}
+		if err := os.WriteFile(src+".tmpl", []byte(f.Template), 0o644); err != nil {
+			return fmt.Errorf("write template %s: %w", f.Target, err)
+		}
+		if err := os.Remove(src); err != nil {
+			return fmt.Errorf("replace %s with its template: %w", f.Target, err)
+		}
+	}
+	return nil
+}
+
+// homeEntry reports whether home has something at target, following
+// symlinks unless link is set.
+func homeEntry(home, target string, link bool) bool {
+	p := filepath.Join(home, filepath.FromSlash(target))
+	var info os.FileInfo
+	var err error
+	if link {
+		info, err = os.Lstat(p)
+	} else {
+		info, err = os.Stat(p)
+	}
+	return err == nil && (link || info.Mode().IsRegular())
+}
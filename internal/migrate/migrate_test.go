@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/native"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestScanStowSkipsIgnoredAndUnstowed(t *testing.T) {
+	stow, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, stow, "zsh/.zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, stow, "zsh/README.md", "my zsh\n")
+	testutil.TempFile(t, stow, "nvim/.config/nvim/init.lua", "vim.o.number = true\n")
+	testutil.TempFile(t, stow, "nvim/.config/nvim/init.lua~", "backup\n")
+	testutil.TempFile(t, stow, "tmux/.tmux.conf", "set -g mouse on\n")
+	testutil.TempFile(t, stow, ".git/HEAD", "ref: refs/heads/main\n")
+	testutil.TempFile(t, home, ".zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, home, ".config/nvim/init.lua", "vim.o.number = true\n")
+
+	plan, err := Scan(context.Background(), Options{From: FromStow, Path: stow, Home: home})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	var targets []string
+	for _, f := range plan.Files {
+		targets = append(targets, f.Target)
+	}
+	if got := strings.Join(targets, ","); got != ".config/nvim/init.lua,.zshrc" {
+		t.Fatalf("targets = %s", got)
+	}
+	if len(plan.Skipped) != 1 || plan.Skipped[0].Path != "tmux/.tmux.conf" {
+		t.Fatalf("skipped = %+v, want only the unstowed tmux config", plan.Skipped)
+	}
+
+	plan.SkipManaged([]string{".zshrc"})
+	if len(plan.Files) != 1 || plan.Files[0].Target != ".config/nvim/init.lua" || len(plan.Skipped) != 2 {
+		t.Fatalf("after SkipManaged = %+v", plan)
+	}
+}
+
+func TestImportYadmKeepsModesAndConvertsTemplates(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executable bits need a Unix home")
+	}
+	testutil.RequireGit(t)
+	ctx := context.Background()
+	home, repo := testutil.TempDir(t), testutil.TempDir(t)
+	gitDir := filepath.Join(home, ".local", "share", "yadm", "repo.git")
+	testutil.TempFile(t, home, ".gitconfig##template", "[user]\n{% if yadm.os == \"Darwin\" %}\n\thelper = osxkeychain\n{% endif %}\n\tname = {{ yadm.class }}\n")
+	testutil.TempFile(t, home, ".gitconfig", "[user]\n\tname = work\n")
+	testutil.TempFile(t, home, ".bashrc##os.Linux", "linux\n")
+	testutil.TempFile(t, home, ".bashrc", "linux\n")
+	testutil.TempFile(t, home, ".local/bin/hello", "#!/bin/sh\n")
+	testutil.TempFile(t, home, ".config/yadm/bootstrap", "#!/bin/sh\n")
+	if err := os.Chmod(filepath.Join(home, ".local", "bin", "hello"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet", "--bare", gitDir},
+		{"--git-dir", gitDir, "--work-tree", home, "add", ".gitconfig##template", ".bashrc##os.Linux", ".local/bin/hello", ".config/yadm/bootstrap"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	plan, err := Scan(ctx, Options{From: FromYadm, Path: gitDir, Home: home, Git: gitx.New("git", nil)})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(plan.Files) != 3 || len(plan.Skipped) != 1 || plan.Skipped[0].Path != ".config/yadm/bootstrap" {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if plan.Files[0].Target != ".bashrc" || plan.Files[0].Note == "" {
+		t.Errorf("alternate = %+v, want .bashrc with a flattening note", plan.Files[0])
+	}
+
+	eng := native.New(home, native.ModeCopy)
+	if err := plan.Add(ctx, eng, repo, "home", home, "warning"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	tmpl, err := os.ReadFile(filepath.Join(repo, "home", "dot_gitconfig.tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[user]\n{{ if eq .dotstate.machine.os \"darwin\" }}\n\thelper = osxkeychain\n{{ end }}\n\tname = {{ .dotstate.profile }}\n"
+	if string(tmpl) != want {
+		t.Errorf("template =\n%s\nwant\n%s", tmpl, want)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "home", "dot_local", "bin", "executable_hello")); err != nil {
+		t.Errorf("executable bit lost: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "home", "dot_bashrc")); err != nil {
+		t.Errorf("flattened alternate not added: %v", err)
+	}
+}
+
+func TestConvertYadmTemplateRejectsUnsupportedSyntax(t *testing.T) {
+	for _, src := range []string{
+		"{{ yadm.user }}\n",
+		"{{ yadm.os }}\n",
+		"{% include \"other\" %}\n",
+		"{% if yadm.os == \"FreeBSD\" %}x{% endif %}\n",
+		"{% if yadm.distro == \"Ubuntu\" %}x{% endif %}\n",
+	} {
+		if _, err := ConvertYadmTemplate(src); err == nil {
+			t.Errorf("ConvertYadmTemplate(%q) succeeded", src)
+		}
+	}
+	got, err := ConvertYadmTemplate("{% if yadm.arch != \"x86_64\" %}arm{% else %}intel{% endif %} on {{ yadm.hostname }}")
+	if err != nil || got != `{{ if ne .dotstate.machine.arch "amd64" }}arm{{ else }}intel{{ end }} on {{ .dotstate.machine.hostname }}` {
+		t.Errorf("ConvertYadmTemplate = %q, %v", got, err)
+	}
+}
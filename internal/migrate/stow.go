@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// stowIgnored matches the names GNU stow skips by default when no
+// .stow-local-ignore overrides them, plus that file itself.
+func stowIgnored(rel string) bool {
+	name := path.Base(rel)
+	switch name {
+	case ".git", ".gitignore", ".gitmodules", ".hg", ".svn", "CVS", "RCS", "_darcs", ".cvsignore", ".stow-local-ignore":
+		return true
+	}
+	if strings.HasSuffix(name, "~") || strings.HasSuffix(name, ",v") || strings.HasPrefix(name, ".#") ||
+		(strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#")) {
+		return true
+	}
+	// README, LICENSE, and COPYING only at the top of a package.
+	if !strings.Contains(rel, "/") {
+		return strings.HasPrefix(name, "README") || strings.HasPrefix(name, "LICENSE") || name == "COPYING"
+	}
+	return false
+}
+
+// scanStow plans every file in each package under dir. A package mirrors
+// home, so its paths are the targets. Files stow has not linked into home
+// are skipped, since the engine adds from home.
+func scanStow(plan *Plan, dir, home string) error {
+	packages, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range packages {
+		if !pkg.IsDir() || stowIgnored(pkg.Name()) {
+			continue
+		}
+		root := filepath.Join(dir, pkg.Name())
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || p == root {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			origin := pkg.Name() + "/" + rel
+			if stowIgnored(rel) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if !homeEntry(home, rel, false) {
+				plan.Skipped = append(plan.Skipped, Skip{Path: origin, Reason: "not stowed into home"})
+				return nil
+			}
+			plan.Files = append(plan.Files, File{Target: rel, Origin: origin})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
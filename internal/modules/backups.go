@@ -0,0 +1,61 @@
+package modules
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// backupManifest names the file, inside a backup set directory, that lists
+// the set's backup records so the set can be restored later.
+const backupManifest = "backups.json"
+
+// writeBackupManifest records backups in the set directory they belong to.
+func writeBackupManifest(root, backupID string, backups []Backup) error {
+	dir := filepath.Join(root, backupID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(backups, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, backupManifest), append(b, '\n'), 0o600)
+}
+
+// LatestBackupSet returns the newest backup set under root that has a
+// manifest, with its records. It returns an empty ID when there is none;
+// sets written before manifests existed are skipped.
+func LatestBackupSet(root string) (string, []Backup, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	var sets []string
+	for _, entry := range entries {
+		if entry.IsDir() && !backupSetTime(entry.Name()).IsZero() {
+			sets = append(sets, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(sets)))
+	for _, id := range sets {
+		b, err := os.ReadFile(filepath.Join(root, id, backupManifest))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		var backups []Backup
+		if err := json.Unmarshal(b, &backups); err != nil {
+			return "", nil, err
+		}
+		return id, backups, nil
+	}
+	return "", nil, nil
+}
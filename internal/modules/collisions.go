@@ -0,0 +1,173 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// CaseCollision is a set of managed paths that differ only in letter case.
+// On a case-insensitive filesystem (macOS, Windows) they name one file or
+// directory, so applying the source state writes one over the other.
+type CaseCollision struct {
+	// Targets are the colliding destination paths, "~/"-relative.
+	Targets []string
+	// Sources are the repo-relative source paths behind each target.
+	Sources []string
+}
+
+// Suggestion proposes renames that keep the first spelling and move the
+// others to distinct names.
+func (c CaseCollision) Suggestion() string {
+	var renames []string
+	for i, src := range c.Sources[1:] {
+		if src == "" {
+			continue
+		}
+		renames = append(renames, fmt.Sprintf("git mv %s %s", src, renamedSource(src, i+2)))
+	}
+	if len(renames) == 0 {
+		return "rename or remove all but one of them in the source state"
+	}
+	return "rename all but one in the repo, e.g. " + strings.Join(renames, "; ")
+}
+
+// renamedSource inserts -n before a source name's extension, keeping a
+// .tmpl suffix last: dot_config/Foo.json.tmpl becomes Foo-2.json.tmpl.
+func renamedSource(src string, n int) string {
+	dir, base := filepath.Split(src)
+	stem, tmpl := strings.CutSuffix(base, ".tmpl")
+	ext := filepath.Ext(stem)
+	if ext == stem {
+		ext = ""
+	}
+	renamed := fmt.Sprintf("%s-%d%s", strings.TrimSuffix(stem, ext), n, ext)
+	if tmpl {
+		renamed += ".tmpl"
+	}
+	return filepath.ToSlash(dir + renamed)
+}
+
+// sourceAttributePrefixes are the chezmoi source name prefixes that set
+// attributes rather than name the target.
+var sourceAttributePrefixes = []string{
+	"after_", "before_", "create_", "empty_", "encrypted_", "exact_",
+	"executable_", "external_", "modify_", "once_", "onchange_", "private_",
+	"readonly_", "remove_", "symlink_",
+}
+
+// sourceTargetName returns the target name a source entry produces, or
+// false for entries that produce none, such as scripts and chezmoi's own
+// files.
+func sourceTargetName(name string) (string, bool) {
+	encrypted := false
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "run_") {
+		return "", false
+	}
+	for stripped := true; stripped; {
+		stripped = false
+		for _, prefix := range sourceAttributePrefixes {
+			if rest, ok := strings.CutPrefix(name, prefix); ok {
+				encrypted = encrypted || prefix == "encrypted_"
+				name, stripped = rest, true
+			}
+		}
+	}
+	if rest, ok := strings.CutPrefix(name, "literal_"); ok {
+		name = rest
+	} else if rest, ok := strings.CutPrefix(name, "dot_"); ok {
+		name = "." + rest
+	}
+	for _, suffix := range []string{".literal", ".tmpl"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	if encrypted {
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".age"), ".asc")
+	}
+	return name, name != ""
+}
+
+// CaseCollisions walks the source state for entries in the same directory
+// whose target names differ only in case. It reads the source directory
+// directly, so it needs no engine call and works with either engine.
+func (m *FilesModule) CaseCollisions() ([]CaseCollision, error) {
+	root := filepath.Join(m.RepoPath, m.SourceDir)
+	var collisions []CaseCollision
+	var walk func(dir, target string) error
+	walk = func(dir, target string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		groups := map[string][]int{}
+		var keys []string
+		var names []string
+		for _, entry := range entries {
+			name, ok := sourceTargetName(entry.Name())
+			if !ok {
+				names = append(names, "")
+				continue
+			}
+			key := strings.ToLower(platform.NormalizeUnicode(name))
+			if groups[key] == nil {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], len(names))
+			names = append(names, name)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if len(groups[key]) < 2 {
+				continue
+			}
+			var c CaseCollision
+			for _, i := range groups[key] {
+				c.Targets = append(c.Targets, target+"/"+names[i])
+				rel, err := filepath.Rel(m.RepoPath, filepath.Join(dir, entries[i].Name()))
+				if err != nil {
+					rel = ""
+				}
+				c.Sources = append(c.Sources, filepath.ToSlash(rel))
+			}
+			collisions = append(collisions, c)
+		}
+		for i, entry := range entries {
+			if names[i] != "" && entry.IsDir() {
+				if err := walk(filepath.Join(dir, entry.Name()), target+"/"+names[i]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(root, "~"); err != nil {
+		return nil, err
+	}
+	return collisions, nil
+}
+
+// caseCollisionDiagnostics warns about each collision when home is on a
+// case-insensitive filesystem, where applying would overwrite files.
+func (m *FilesModule) caseCollisionDiagnostics() []Diagnostic {
+	if !platform.CaseInsensitive(m.Home) {
+		return nil
+	}
+	collisions, err := m.CaseCollisions()
+	if err != nil {
+		return nil
+	}
+	diagnostics := make([]Diagnostic, 0, len(collisions))
+	for _, c := range collisions {
+		d := NewDiagnostic(SeverityWarning, "files.case_collision",
+			fmt.Sprintf("%s differ only in case; this filesystem is case-insensitive, so applying writes one over the other", strings.Join(c.Targets, " and ")),
+			filesSurface, "files:path/"+c.Targets[0])
+		d.Remediation = c.Suggestion()
+		d.Sensitivity = SensitivityLocalPath
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
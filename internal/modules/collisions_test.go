@@ -0,0 +1,66 @@
+package modules
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestFilesModuleCaseCollisionsFindsTargetsDifferingOnlyInCase(t *testing.T) {
+	repoDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	source := filepath.Join(repoDir, "home")
+	testutil.TempFile(t, source, "dot_Xresources", "a")
+	testutil.TempFile(t, source, "private_dot_xresources.tmpl", "b")
+	testutil.TempFile(t, source, "dot_zshrc", "c")
+	testutil.TempFile(t, filepath.Join(source, "dot_config", "App"), "settings.json", "{}")
+	testutil.TempFile(t, filepath.Join(source, "dot_config", "exact_app"), "other.json", "{}")
+	testutil.TempFile(t, source, "run_once_install.sh", "#!/bin/sh")
+
+	files := NewFilesModule(cfg, chez.New("chezmoi", testutil.NewMockRunner(t)), testutil.TempDir(t))
+	collisions, err := files.CaseCollisions()
+	if err != nil {
+		t.Fatalf("CaseCollisions() error = %v", err)
+	}
+	var got []string
+	for _, c := range collisions {
+		got = append(got, strings.Join(c.Targets, ","))
+	}
+	want := []string{"~/.Xresources,~/.xresources", "~/.config/App,~/.config/app"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("CaseCollisions() targets = %v, want %v", got, want)
+	}
+	if s := collisions[0].Suggestion(); !strings.Contains(s, "git mv home/private_dot_xresources.tmpl home/private_dot_xresources-2.tmpl") {
+		t.Fatalf("Suggestion() = %q", s)
+	}
+	if s := collisions[1].Suggestion(); !strings.Contains(s, "git mv home/dot_config/exact_app home/dot_config/exact_app-2") {
+		t.Fatalf("Suggestion() = %q", s)
+	}
+}
+
+func TestSourceTargetName(t *testing.T) {
+	tests := map[string]string{
+		"dot_bashrc":                   ".bashrc",
+		"private_executable_dot_foo":   ".foo",
+		"encrypted_private_key.age":    "key",
+		"literal_dot_keep":             "dot_keep",
+		"symlink_dot_vimrc.tmpl":       ".vimrc",
+		"modify_dot_settings.json":     ".settings.json",
+		"create_empty_dot_hushlogin":   ".hushlogin",
+		"exact_private_dot_ssh":        ".ssh",
+		"readonly_config.toml.literal": "config.toml",
+	}
+	for name, want := range tests {
+		if got, ok := sourceTargetName(name); !ok || got != want {
+			t.Errorf("sourceTargetName(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{".chezmoiignore", "run_onchange_install.sh", ".git"} {
+		if _, ok := sourceTargetName(name); ok {
+			t.Errorf("sourceTargetName(%q) produced a target", name)
+		}
+	}
+}
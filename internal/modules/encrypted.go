@@ -0,0 +1,379 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/agex"
+	"github.com/dnery/dotstate/dot/internal/config"
+)
+
+const encryptedSurface = "encrypted_files"
+
+// EncryptedFilesModule keeps selected home files in the repo as age
+// ciphertext: capture encrypts the local file into StoreDir and apply
+// decrypts it back. Plaintext never enters the repo or any record.
+type EncryptedFilesModule struct {
+	Age        *agex.Age
+	Recipients []string
+	Identity   string
+	Files      []string
+	StoreDir   string
+	Home       string
+	// BackupRoot, BackupKeep, and BackupMaxAge are as for FilesModule; the
+	// two modules share the backup root and its retention.
+	BackupRoot   string
+	BackupKeep   int
+	BackupMaxAge time.Duration
+	now          func() time.Time
+}
+
+func NewEncryptedFilesModule(cfg *config.Config, age *agex.Age, home string) *EncryptedFilesModule {
+	if home == "" {
+		home, _ = os.UserHomeDir()
+	}
+	return &EncryptedFilesModule{
+		Age:          age,
+		Recipients:   append([]string(nil), cfg.Encryption.Recipients...),
+		Identity:     cfg.Encryption.Identity,
+		Files:        append([]string(nil), cfg.Encryption.Files...),
+		StoreDir:     cfg.EncryptedPath(),
+		Home:         home,
+		BackupRoot:   cfg.BackupPath(),
+		BackupKeep:   cfg.Backup.Keep,
+		BackupMaxAge: time.Duration(cfg.Backup.MaxAgeDays) * 24 * time.Hour,
+		now:          time.Now,
+	}
+}
+
+func (m *EncryptedFilesModule) Surface() string { return encryptedSurface }
+
+func (m *EncryptedFilesModule) ApplyStep() string { return config.ApplyStepFiles }
+
+func (m *EncryptedFilesModule) Plan(ctx context.Context, operation Operation) ([]Change, []Diagnostic, error) {
+	changes := make([]Change, 0, len(m.Files))
+	for _, file := range m.Files {
+		change := m.baseChange(operation, file)
+		switch operation {
+		case OperationApply, OperationCapture:
+		default:
+			change.Action = ActionBlocked
+			change.Capability = []Capability{CapabilityUnsupported}
+			change.Diagnostics = []Diagnostic{NewDiagnostic(SeverityError, "encrypted.operation_unsupported", "Encrypted files module does not support this operation.", encryptedSurface, change.ID)}
+			changes = append(changes, change)
+			continue
+		}
+
+		state, err := m.inspect(ctx, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		change.Current = map[string]any{"destination_exists": state.destExists, "stored": state.stored}
+		change.Action = state.action(operation)
+		if operation == OperationApply && !state.stored {
+			change.Diagnostics = append(change.Diagnostics, NewDiagnostic(SeverityInfo, "encrypted.not_captured", "No ciphertext is stored for this file yet; run capture on a machine that has it.", encryptedSurface, change.ID))
+		}
+		if operation == OperationCapture && !state.destExists {
+			change.Diagnostics = append(change.Diagnostics, NewDiagnostic(SeverityWarning, "encrypted.destination_missing", "Encrypted file is listed in dot.toml but missing on this machine.", encryptedSurface, change.ID))
+		}
+		if operation == OperationApply && isMutation(change.Action) {
+			change.BackupRequired = true
+		}
+		if operation == OperationApply && change.Action == ActionUpdate {
+			change.Risk = Risk{Level: RiskMedium, Reasons: []string{"local file will be replaced with the decrypted repo version"}, RequiresConfirmation: false, Reversible: true}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil, nil
+}
+
+// Backup copies each destination apply is about to overwrite into a dated
+// set under BackupRoot, and records the ones it is about to create so
+// restore can remove them again.
+func (m *EncryptedFilesModule) Backup(ctx context.Context, changes []Change, plan *Plan) ([]Backup, []Diagnostic, error) {
+	if !requiresBackup(changes) {
+		return nil, nil, nil
+	}
+	createdAt := m.now().UTC()
+	backupID := newID(createdAt, encryptedSurface)
+	var backups []Backup
+	var diagnostics []Diagnostic
+	for _, change := range changes {
+		if !change.BackupRequired || !isMutation(change.Action) {
+			continue
+		}
+		file := change.Source.Value
+		backup := Backup{
+			SchemaVersion: SchemaBackupV1,
+			BackupID:      backupID,
+			CreatedAt:     Timestamp(createdAt),
+			Surface:       encryptedSurface,
+			ID:            change.ID,
+			Source:        change.Source,
+			Current:       map[string]any{"exists": false},
+			ManagedBy:     change.ManagedBy,
+			Sensitivity:   change.Sensitivity,
+			Confidence:    ConfidenceConfirmed,
+			Capability:    []Capability{CapabilityAutoApply},
+			Risk:          LowRisk(true),
+			Restore:       RestoreInfo{Supported: true, RequiresConfirmation: true},
+		}
+		dest := m.destinationPath(file)
+		info, err := os.Lstat(dest)
+		if os.IsNotExist(err) {
+			backups = append(backups, backup)
+			continue
+		}
+		if err != nil {
+			return backups, diagnostics, fmt.Errorf("stat %s: %w", file, err)
+		}
+		backup.Current["exists"] = true
+		backup.Current["mode"] = fmt.Sprintf("%04o", info.Mode().Perm())
+		backup.Current["type"] = fileType(info)
+		if !info.Mode().IsRegular() {
+			backup.Restore.Supported = false
+			diagnostics = append(diagnostics, NewDiagnostic(SeverityWarning, "encrypted.backup.non_regular", "Encrypted file destination is not a regular file and was not backed up.", encryptedSurface, change.ID))
+			backups = append(backups, backup)
+			continue
+		}
+		payloadPath := filepath.Join(m.BackupRoot, backupID, encryptedSurface, filepath.FromSlash(file))
+		sha, err := copyFileWithSHA(dest, payloadPath, info.Mode().Perm())
+		if err != nil {
+			return backups, diagnostics, fmt.Errorf("back up %s: %w", file, err)
+		}
+		backup.Current["sha256"] = sha
+		backup.PayloadRef = PayloadRef{Kind: "local_file", Path: payloadPath, SHA256: sha}
+		backups = append(backups, backup)
+	}
+
+	if len(backups) > 0 {
+		if err := writeBackupManifest(m.BackupRoot, backupID, backups); err != nil {
+			diagnostics = append(diagnostics, NewDiagnostic(SeverityWarning, "encrypted.backup.manifest_failed", fmt.Sprintf("Could not record backup set %s; dot rollback cannot restore it: %v", backupID, err), encryptedSurface, encryptedSurface))
+		}
+	}
+	for _, err := range pruneBackupSets(m.BackupRoot, backupID, m.BackupKeep, m.BackupMaxAge, m.now()) {
+		diagnostics = append(diagnostics, NewDiagnostic(SeverityWarning, "encrypted.backup.prune_failed", "Could not "+err.Error(), encryptedSurface, encryptedSurface))
+	}
+	return backups, diagnostics, nil
+}
+
+func (m *EncryptedFilesModule) Apply(ctx context.Context, changes []Change, plan *Plan) ([]Result, []Diagnostic, error) {
+	results := make([]Result, 0, len(changes))
+	for _, change := range changes {
+		if !isMutation(change.Action) {
+			results = append(results, m.result(plan, PhaseApply, StatusNoop, change))
+			continue
+		}
+		file := change.Source.Value
+		dest := m.destinationPath(file)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+			results = append(results, m.result(plan, PhaseApply, StatusFailed, change))
+			return results, nil, fmt.Errorf("create parent for %s: %w", file, err)
+		}
+		if err := m.Age.DecryptTo(ctx, m.Identity, m.storePath(file), dest); err != nil {
+			results = append(results, m.result(plan, PhaseApply, StatusFailed, change))
+			return results, nil, fmt.Errorf("decrypt %s: %w", file, err)
+		}
+		if err := os.Chmod(dest, 0o600); err != nil {
+			results = append(results, m.result(plan, PhaseApply, StatusFailed, change))
+			return results, nil, fmt.Errorf("restrict %s: %w", file, err)
+		}
+		results = append(results, m.result(plan, PhaseApply, StatusApplied, change))
+	}
+	return results, nil, nil
+}
+
+func (m *EncryptedFilesModule) Capture(ctx context.Context, changes []Change, plan *Plan) ([]Result, []Diagnostic, error) {
+	results := make([]Result, 0, len(changes))
+	for _, change := range changes {
+		if !isMutation(change.Action) {
+			results = append(results, m.result(plan, PhaseCapture, StatusNoop, change))
+			continue
+		}
+		file := change.Source.Value
+		store := m.storePath(file)
+		if err := os.MkdirAll(filepath.Dir(store), 0o755); err != nil {
+			results = append(results, m.result(plan, PhaseCapture, StatusFailed, change))
+			return results, nil, fmt.Errorf("create parent for %s: %w", file, err)
+		}
+		if err := m.Age.Encrypt(ctx, m.Recipients, m.destinationPath(file), store); err != nil {
+			results = append(results, m.result(plan, PhaseCapture, StatusFailed, change))
+			return results, nil, fmt.Errorf("encrypt %s: %w", file, err)
+		}
+		results = append(results, m.result(plan, PhaseCapture, StatusCaptured, change))
+	}
+	return results, nil, nil
+}
+
+func (m *EncryptedFilesModule) Verify(ctx context.Context, operation Operation, changes []Change, plan *Plan) ([]Result, []Diagnostic, error) {
+	results := make([]Result, 0, len(changes))
+	for _, change := range changes {
+		if !isMutation(change.Action) {
+			continue
+		}
+		state, err := m.inspect(ctx, change.Source.Value)
+		if err != nil {
+			results = append(results, m.result(plan, PhaseVerify, StatusFailed, change))
+			return results, nil, err
+		}
+		if !state.matches {
+			results = append(results, m.result(plan, PhaseVerify, StatusFailed, change))
+			return results, nil, fmt.Errorf("%s still differs from its ciphertext after %s", change.Source.Value, operation)
+		}
+		results = append(results, m.result(plan, PhaseVerify, StatusVerified, change))
+	}
+	return results, nil, nil
+}
+
+// Restore puts backed-up destinations back and removes the ones apply
+// created.
+func (m *EncryptedFilesModule) Restore(ctx context.Context, backups []Backup) ([]Result, []Diagnostic, error) {
+	var results []Result
+	var diagnostics []Diagnostic
+	for _, backup := range backups {
+		started := m.now().UTC()
+		status := StatusRestored
+		dest := m.destinationPath(backup.Source.Value)
+		if !backup.Restore.Supported {
+			status = StatusSkipped
+			diagnostics = append(diagnostics, NewDiagnostic(SeverityWarning, "encrypted.restore.unsupported", "Backup is not restorable automatically.", encryptedSurface, backup.ID))
+		} else if exists, _ := backup.Current["exists"].(bool); !exists {
+			if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+				status = StatusFailed
+			}
+		} else if backup.PayloadRef.Path == "" {
+			status = StatusFailed
+		} else if err := restoreFile(backup.PayloadRef.Path, dest); err != nil {
+			status = StatusFailed
+		}
+		results = append(results, Result{
+			SchemaVersion: SchemaResultV1,
+			RunID:         newID(started, "encrypted-files-restore"),
+			Phase:         PhaseRestore,
+			Surface:       encryptedSurface,
+			ID:            backup.ID,
+			Source:        backup.Source,
+			Current:       backup.Current,
+			Desired:       backup.Desired,
+			ManagedBy:     backup.ManagedBy,
+			Sensitivity:   backup.Sensitivity,
+			Confidence:    backup.Confidence,
+			Capability:    backup.Capability,
+			Risk:          backup.Risk,
+			Status:        status,
+			StartedAt:     Timestamp(started),
+			EndedAt:       Timestamp(m.now().UTC()),
+		})
+	}
+	return results, diagnostics, nil
+}
+
+type encryptedState struct {
+	destExists bool
+	stored     bool
+	matches    bool
+}
+
+func (s encryptedState) action(operation Operation) ChangeAction {
+	switch {
+	case s.destExists && s.stored && s.matches:
+		return ActionNoop
+	case operation == OperationApply && !s.stored:
+		return ActionNoop
+	case operation == OperationApply && !s.destExists:
+		return ActionCreate
+	case operation == OperationCapture && !s.destExists:
+		return ActionNoop
+	case operation == OperationCapture && !s.stored:
+		return ActionCreate
+	default:
+		return ActionUpdate
+	}
+}
+
+// inspect compares the local file with the decrypted ciphertext. Decryption
+// is only attempted when both exist, so a machine without the identity can
+// still capture new files.
+func (m *EncryptedFilesModule) inspect(ctx context.Context, file string) (encryptedState, error) {
+	var state encryptedState
+	local, err := os.ReadFile(m.destinationPath(file))
+	switch {
+	case err == nil:
+		state.destExists = true
+	case !os.IsNotExist(err):
+		return state, fmt.Errorf("read %s: %w", file, err)
+	}
+	if _, err := os.Stat(m.storePath(file)); err == nil {
+		state.stored = true
+	} else if !os.IsNotExist(err) {
+		return state, fmt.Errorf("stat ciphertext for %s: %w", file, err)
+	}
+	if !state.destExists || !state.stored {
+		return state, nil
+	}
+	plaintext, err := m.Age.Decrypt(ctx, m.Identity, m.storePath(file))
+	if err != nil {
+		return state, fmt.Errorf("decrypt %s: %w", file, err)
+	}
+	state.matches = bytes.Equal(plaintext, local)
+	return state, nil
+}
+
+func (m *EncryptedFilesModule) destinationPath(file string) string {
+	return filepath.Join(m.Home, filepath.FromSlash(file))
+}
+
+func (m *EncryptedFilesModule) storePath(file string) string {
+	return filepath.Join(m.StoreDir, filepath.FromSlash(file)+".age")
+}
+
+func (m *EncryptedFilesModule) baseChange(operation Operation, file string) Change {
+	id := "encrypted_files:path/~/" + filepath.ToSlash(file)
+	return Change{
+		ChangeID:       fmt.Sprintf("%s:%s", id, operation),
+		Surface:        encryptedSurface,
+		ID:             id,
+		Action:         ActionNoop,
+		Source:         Source{Kind: "path", Value: file},
+		Current:        nil,
+		Desired:        map[string]any{"store": "state/encrypted/" + filepath.ToSlash(file) + ".age", "encrypted": true},
+		ManagedBy:      []string{"dotstate", "age"},
+		Sensitivity:    SensitivityPersonal,
+		Confidence:     ConfidenceConfirmed,
+		Capability:     []Capability{CapabilityAutoApply},
+		Risk:           LowRisk(true),
+		BackupRequired: false,
+		DependsOn:      []string{},
+		Diagnostics:    []Diagnostic{},
+	}
+}
+
+func (m *EncryptedFilesModule) result(plan *Plan, phase Phase, status ResultStatus, change Change) Result {
+	started := m.now().UTC()
+	ended := m.now().UTC()
+	return Result{
+		SchemaVersion: SchemaResultV1,
+		RunID:         newID(started, string(phase)+"-encrypted-files"),
+		PlanID:        plan.PlanID,
+		Phase:         phase,
+		Surface:       change.Surface,
+		ID:            change.ID,
+		ChangeID:      change.ChangeID,
+		Source:        change.Source,
+		Current:       change.Current,
+		Desired:       change.Desired,
+		ManagedBy:     change.ManagedBy,
+		Sensitivity:   change.Sensitivity,
+		Confidence:    change.Confidence,
+		Capability:    change.Capability,
+		Risk:          change.Risk,
+		Status:        status,
+		StartedAt:     Timestamp(started),
+		EndedAt:       Timestamp(ended),
+		Diagnostics:   change.Diagnostics,
+	}
+}
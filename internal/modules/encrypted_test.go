@@ -0,0 +1,179 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/agex"
+	"github.com/dnery/dotstate/dot/internal/runner"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestEncryptedFilesModuleCaptureThenApplyRoundTrips(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	cfg.Encryption.Recipients = []string{"age1example"}
+	cfg.Encryption.Identity = "/keys/age.txt"
+	cfg.Encryption.Files = []string{".config/vpn/work.conf"}
+	testutil.TempFile(t, homeDir, ".config/vpn/work.conf", "vpn-secret\n")
+
+	age := &fakeAge{}
+	mod := NewEncryptedFilesModule(cfg, agex.New("age", age), homeDir)
+	orch := NewOrchestrator(mod)
+
+	report, err := orch.Run(ctx, OperationCapture, RunOptions{})
+	if err != nil {
+		t.Fatalf("capture error = %v", err)
+	}
+	if report.Plan.Summary.Create != 1 {
+		t.Fatalf("capture summary = %#v, want one create", report.Plan.Summary)
+	}
+	store := filepath.Join(repoDir, "state", "encrypted", ".config", "vpn", "work.conf.age")
+	stored, err := os.ReadFile(store)
+	if err != nil {
+		t.Fatalf("ciphertext not written: %v", err)
+	}
+	if strings.Contains(string(stored), "vpn-secret") {
+		t.Fatal("ciphertext contains plaintext")
+	}
+	raw, _ := json.Marshal(report)
+	if strings.Contains(string(raw), "vpn-secret") {
+		t.Fatalf("report leaked plaintext: %s", raw)
+	}
+
+	report, err = orch.Run(ctx, OperationCapture, RunOptions{})
+	if err != nil {
+		t.Fatalf("second capture error = %v", err)
+	}
+	if report.Plan.Summary.Noop != 1 {
+		t.Fatalf("second capture summary = %#v, want noop", report.Plan.Summary)
+	}
+
+	if err := os.Remove(filepath.Join(homeDir, ".config", "vpn", "work.conf")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = orch.Run(ctx, OperationApply, RunOptions{})
+	if err != nil {
+		t.Fatalf("apply error = %v", err)
+	}
+	if report.Plan.Summary.Create != 1 {
+		t.Fatalf("apply summary = %#v, want one create", report.Plan.Summary)
+	}
+	got, err := os.ReadFile(filepath.Join(homeDir, ".config", "vpn", "work.conf"))
+	if err != nil || string(got) != "vpn-secret\n" {
+		t.Fatalf("decrypted file = %q, %v", got, err)
+	}
+	info, _ := os.Stat(filepath.Join(homeDir, ".config", "vpn", "work.conf"))
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("decrypted file mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestEncryptedFilesModuleApplySkipsUncapturedFiles(t *testing.T) {
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	cfg.Encryption.Files = []string{".netrc"}
+
+	mod := NewEncryptedFilesModule(cfg, agex.New("age", &fakeAge{}), homeDir)
+	changes, _, err := mod.Plan(context.Background(), OperationApply)
+	if err != nil {
+		t.Fatalf("Plan error = %v", err)
+	}
+	if len(changes) != 1 || changes[0].Action != ActionNoop {
+		t.Fatalf("changes = %#v, want one noop", changes)
+	}
+	if len(changes[0].Diagnostics) != 1 || changes[0].Diagnostics[0].Code != "encrypted.not_captured" {
+		t.Fatalf("diagnostics = %#v", changes[0].Diagnostics)
+	}
+}
+
+func TestEncryptedFilesModuleApplyBacksUpLocalEditsAndRestores(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	cfg.Encryption.Recipients = []string{"age1example"}
+	cfg.Encryption.Files = []string{".netrc"}
+	testutil.TempFile(t, homeDir, ".netrc", "machine repo password old\n")
+
+	mod := NewEncryptedFilesModule(cfg, agex.New("age", &fakeAge{}), homeDir)
+	mod.BackupKeep = 1
+	orch := NewOrchestrator(mod)
+	if _, err := orch.Run(ctx, OperationCapture, RunOptions{}); err != nil {
+		t.Fatalf("capture error = %v", err)
+	}
+	stale := filepath.Join(mod.BackupRoot, "20200101T000000Z-files")
+	if err := os.MkdirAll(stale, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	netrc := filepath.Join(homeDir, ".netrc")
+	if err := os.WriteFile(netrc, []byte("machine repo password edited\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := orch.Run(ctx, OperationApply, RunOptions{})
+	if err != nil {
+		t.Fatalf("apply error = %v", err)
+	}
+	if got, _ := os.ReadFile(netrc); string(got) != "machine repo password old\n" {
+		t.Fatalf("applied file = %q", got)
+	}
+	if len(report.Backups) != 1 || report.Backups[0].PayloadRef.Path == "" {
+		t.Fatalf("backups = %#v, want the edited file", report.Backups)
+	}
+	if saved, _ := os.ReadFile(report.Backups[0].PayloadRef.Path); string(saved) != "machine repo password edited\n" {
+		t.Fatalf("backup payload = %q", saved)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("old backup set not pruned: %v", err)
+	}
+
+	id, backups, err := LatestBackupSet(mod.BackupRoot)
+	if err != nil || !strings.HasSuffix(id, "-encrypted-files") {
+		t.Fatalf("LatestBackupSet() = %q, %v", id, err)
+	}
+	if _, err := orch.Restore(ctx, backups); err != nil {
+		t.Fatalf("restore error = %v", err)
+	}
+	if got, _ := os.ReadFile(netrc); string(got) != "machine repo password edited\n" {
+		t.Fatalf("restored file = %q", got)
+	}
+}
+
+// fakeAge stands in for the age binary by reversing bytes, which is enough
+// to prove plaintext never lands in the store.
+type fakeAge struct{}
+
+func (f *fakeAge) Run(ctx context.Context, dir, name string, args ...string) (*runner.CmdResult, error) {
+	out, src := "", args[len(args)-1]
+	for i, arg := range args {
+		if arg == "-o" {
+			out = args[i+1]
+		}
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return &runner.CmdResult{}, fmt.Errorf("fake age: %w", err)
+	}
+	data = reverseBytes(data)
+	if out == "" {
+		return &runner.CmdResult{Stdout: string(data)}, nil
+	}
+	return &runner.CmdResult{}, os.WriteFile(out, data, 0o644)
+}
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
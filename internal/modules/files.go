@@ -8,41 +8,56 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/dnery/dotstate/dot/internal/chez"
 	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/diffstat"
 	"github.com/dnery/dotstate/dot/internal/redact"
+	"github.com/dnery/dotstate/dot/internal/runner"
 )
 
 const filesSurface = "files"
 
 type FilesModule struct {
-	Chez       *chez.Chezmoi
+	Chez       chez.Engine
 	RepoPath   string
 	SourceDir  string
 	Home       string
 	BackupRoot string
-	now        func() time.Time
+	// BackupKeep is the number of dated backup sets retained after a new
+	// backup is written; 0 keeps everything.
+	BackupKeep int
+	// BackupMaxAge prunes backup sets older than this; 0 disables it.
+	BackupMaxAge time.Duration
+	// Only limits apply and capture to these destination paths and
+	// everything below them; empty means every managed file.
+	Only []string
+	now  func() time.Time
 }
 
-func NewFilesModule(cfg *config.Config, ch *chez.Chezmoi, home string) *FilesModule {
+func NewFilesModule(cfg *config.Config, ch chez.Engine, home string) *FilesModule {
 	if home == "" {
 		home, _ = os.UserHomeDir()
 	}
 	return &FilesModule{
-		Chez:       ch,
-		RepoPath:   cfg.Repo.Path,
-		SourceDir:  cfg.Chex.SourceDir,
-		Home:       home,
-		BackupRoot: filepath.Join(cfg.Repo.Path, "state", "backups"),
-		now:        time.Now,
+		Chez:         ch,
+		RepoPath:     cfg.Repo.Path,
+		SourceDir:    cfg.Chex.SourceDir,
+		Home:         home,
+		BackupRoot:   cfg.BackupPath(),
+		BackupKeep:   cfg.Backup.Keep,
+		BackupMaxAge: time.Duration(cfg.Backup.MaxAgeDays) * 24 * time.Hour,
+		now:          time.Now,
 	}
 }
 
 func (m *FilesModule) Surface() string { return filesSurface }
 
+func (m *FilesModule) ApplyStep() string { return config.ApplyStepFiles }
+
 func (m *FilesModule) Discover(ctx context.Context) ([]Fact, []Diagnostic, error) {
 	return []Fact{m.sourceFact(map[string]any{"source_dir": m.SourceDir})}, nil, nil
 }
@@ -94,7 +109,7 @@ func (m *FilesModule) Plan(ctx context.Context, operation Operation) ([]Change,
 	case OperationApply:
 		return m.planApply(ctx)
 	case OperationCapture:
-		return m.planCapture(), nil, nil
+		return m.planCapture(ctx)
 	default:
 		change := m.baseChange(operation)
 		change.Action = ActionBlocked
@@ -114,6 +129,8 @@ func (m *FilesModule) Backup(ctx context.Context, changes []Change, plan *Plan)
 		return nil, nil, err
 	}
 
+	managed = m.differingPaths(managed, changes)
+
 	createdAt := m.now().UTC()
 	backupID := newID(createdAt, "files")
 	var backups []Backup
@@ -190,30 +207,158 @@ func (m *FilesModule) Backup(ctx context.Context, changes []Change, plan *Plan)
 		backups = append(backups, backup)
 	}
 
+	if len(backups) > 0 {
+		if err := writeBackupManifest(m.BackupRoot, backupID, backups); err != nil {
+			diagnostics = append(diagnostics, backupDiagnostic(SeverityWarning, "files.backup.manifest_failed", fmt.Sprintf("Could not record backup set %s; dot rollback cannot restore it: %v", backupID, err), m.BackupRoot))
+		}
+	}
+	diagnostics = append(diagnostics, m.pruneBackups(backupID)...)
 	return backups, diagnostics, nil
 }
 
+// differingPaths narrows managed paths to those the planned diff touches, so
+// apply only backs up destinations it is about to overwrite. It falls back to
+// every managed path when the plan carries no per-file stats or names a path
+// that cannot be matched (for example one redacted during sanitization).
+func (m *FilesModule) differingPaths(managed []string, changes []Change) []string {
+	var stats []diffstat.FileStat
+	for _, change := range changes {
+		stats = append(stats, diffstat.FromRecords(change.Current["diff_stat"])...)
+	}
+	if len(stats) == 0 {
+		return managed
+	}
+
+	byDest := make(map[string]string, len(managed))
+	for _, managedPath := range managed {
+		if dest, err := m.destinationPath(managedPath); err == nil {
+			byDest[dest] = managedPath
+		}
+	}
+	selected := make([]string, 0, len(stats))
+	seen := make(map[string]bool, len(stats))
+	for _, stat := range stats {
+		dest, err := m.destinationPath(stat.Path)
+		if err != nil {
+			return managed
+		}
+		managedPath, ok := byDest[dest]
+		if !ok {
+			return managed
+		}
+		if !seen[managedPath] {
+			seen[managedPath] = true
+			selected = append(selected, managedPath)
+		}
+	}
+	return selected
+}
+
+// pruneBackups enforces the retention policy on dated backup sets, never
+// removing the set that was just written.
+func (m *FilesModule) pruneBackups(currentID string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, err := range pruneBackupSets(m.BackupRoot, currentID, m.BackupKeep, m.BackupMaxAge, m.now()) {
+		diagnostics = append(diagnostics, backupDiagnostic(SeverityWarning, "files.backup.prune_failed", "Could not "+err.Error(), m.BackupRoot))
+	}
+	return diagnostics
+}
+
+// pruneBackupSets removes the dated backup sets under root, of any module,
+// beyond the newest keep or older than maxAge, never currentID. Zero keep
+// or maxAge disables that limit. It returns one error per set it could not
+// remove.
+func pruneBackupSets(root, currentID string, keep int, maxAge time.Duration, now time.Time) []error {
+	if keep <= 0 && maxAge <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+	var sets []string
+	for _, entry := range entries {
+		if entry.IsDir() && backupSetTime(entry.Name()) != (time.Time{}) {
+			sets = append(sets, entry.Name())
+		}
+	}
+	// Backup IDs start with a sortable UTC timestamp; newest first.
+	sort.Sort(sort.Reverse(sort.StringSlice(sets)))
+
+	cutoff := time.Time{}
+	if maxAge > 0 {
+		cutoff = now.UTC().Add(-maxAge)
+	}
+	var errs []error
+	for i, name := range sets {
+		if name == currentID {
+			continue
+		}
+		expired := !cutoff.IsZero() && backupSetTime(name).Before(cutoff)
+		if (keep <= 0 || i < keep) && !expired {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, name)); err != nil {
+			errs = append(errs, fmt.Errorf("remove old backup set %s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+func backupSetTime(name string) time.Time {
+	stamp, _, ok := strings.Cut(name, "-")
+	if !ok {
+		return time.Time{}
+	}
+	t, err := time.Parse("20060102T150405Z", stamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
 func (m *FilesModule) Apply(ctx context.Context, changes []Change, plan *Plan) ([]Result, []Diagnostic, error) {
 	if !hasActionableMutation(changes) {
 		return []Result{m.result(plan, PhaseApply, StatusNoop, firstChange(changes), nil)}, nil, nil
 	}
-	if err := m.Chez.Apply(ctx, m.RepoPath, m.SourceDir); err != nil {
+	if err := m.Chez.Apply(ctx, m.RepoPath, m.SourceDir, m.Only...); err != nil {
 		return []Result{m.result(plan, PhaseApply, StatusFailed, firstChange(changes), nil)}, nil, err
 	}
 	return []Result{m.result(plan, PhaseApply, StatusApplied, firstChange(changes), nil)}, nil, nil
 }
 
 func (m *FilesModule) Capture(ctx context.Context, changes []Change, plan *Plan) ([]Result, []Diagnostic, error) {
-	if err := m.Chez.ReAdd(ctx, m.RepoPath, m.SourceDir); err != nil {
+	if err := m.Chez.ReAdd(ctx, m.RepoPath, m.SourceDir, m.Only...); err != nil {
 		return []Result{m.result(plan, PhaseCapture, StatusFailed, firstChange(changes), nil)}, nil, err
 	}
 	return []Result{m.result(plan, PhaseCapture, StatusCaptured, firstChange(changes), nil)}, nil, nil
 }
 
+// PlanCommands runs, through r, the chezmoi commands Apply or Capture
+// would run. The native engine runs no commands.
+func (m *FilesModule) PlanCommands(ctx context.Context, operation Operation, changes []Change, plan *Plan, r runner.Runner) error {
+	c, ok := m.Chez.(*chez.Chezmoi)
+	if !ok {
+		return nil
+	}
+	planned := *c
+	planned.R, planned.Progress = r, nil
+	switch operation {
+	case OperationApply:
+		if !hasActionableMutation(changes) {
+			return nil
+		}
+		return planned.Apply(ctx, m.RepoPath, m.SourceDir, m.Only...)
+	case OperationCapture:
+		return planned.ReAdd(ctx, m.RepoPath, m.SourceDir, m.Only...)
+	}
+	return nil
+}
+
 func (m *FilesModule) Verify(ctx context.Context, operation Operation, changes []Change, plan *Plan) ([]Result, []Diagnostic, error) {
 	switch operation {
 	case OperationApply:
-		diff, err := m.Chez.Diff(ctx, m.RepoPath, m.SourceDir)
+		diff, err := m.Chez.Diff(ctx, m.RepoPath, m.SourceDir, m.Only...)
 		if err != nil {
 			return []Result{m.result(plan, PhaseVerify, StatusFailed, firstChange(changes), nil)}, nil, err
 		}
@@ -273,11 +418,12 @@ func (m *FilesModule) Restore(ctx context.Context, backups []Backup) ([]Result,
 }
 
 func (m *FilesModule) planApply(ctx context.Context) ([]Change, []Diagnostic, error) {
-	diff, err := m.Chez.Diff(ctx, m.RepoPath, m.SourceDir)
+	diff, err := m.Chez.Diff(ctx, m.RepoPath, m.SourceDir, m.Only...)
 	if err != nil {
 		return nil, nil, err
 	}
 	change := m.baseChange(OperationApply)
+	change.Diagnostics = append(change.Diagnostics, m.caseCollisionDiagnostics()...)
 	if strings.TrimSpace(diff) == "" {
 		change.Action = ActionNoop
 		change.Current = map[string]any{"diff_empty": true}
@@ -287,19 +433,52 @@ func (m *FilesModule) planApply(ctx context.Context) ([]Change, []Diagnostic, er
 	}
 	change.Action = ActionUpdate
 	change.Current = map[string]any{"diff_empty": false, "diff_redacted": true}
+	if stats := diffstat.Parse(diff); len(stats) > 0 {
+		totals := diffstat.Sum(stats)
+		change.Current["diff_stat"] = diffstat.Records(stats)
+		change.Current["diff_files"] = totals.Files
+		change.Current["diff_added"] = totals.Added
+		change.Current["diff_removed"] = totals.Removed
+		if modes := modeChanges(stats); modes > 0 {
+			change.Current["diff_mode_changes"] = modes
+		}
+	}
 	change.Desired = map[string]any{"source_dir": m.SourceDir}
 	change.BackupRequired = true
 	change.Risk = Risk{Level: RiskMedium, Reasons: []string{"managed files will be updated"}, RequiresConfirmation: false, Reversible: true}
 	return []Change{change}, nil, nil
 }
 
-func (m *FilesModule) planCapture() []Change {
+func modeChanges(stats []diffstat.FileStat) int {
+	n := 0
+	for _, stat := range stats {
+		if stat.ModeChanged() {
+			n++
+		}
+	}
+	return n
+}
+
+// planCapture plans an update when home differs from the source state,
+// which is what re-add would copy back; templates it leaves alone still
+// count, so the plan may overstate but never miss a change.
+func (m *FilesModule) planCapture(ctx context.Context) ([]Change, []Diagnostic, error) {
+	diff, err := m.Chez.Diff(ctx, m.RepoPath, m.SourceDir, m.Only...)
+	if err != nil {
+		return nil, nil, err
+	}
 	change := m.baseChange(OperationCapture)
 	change.Action = ActionUpdate
+	if strings.TrimSpace(diff) == "" {
+		change.Action = ActionNoop
+	}
 	change.Current = map[string]any{"managed_by": "chezmoi"}
 	change.Desired = map[string]any{"command": "chezmoi re-add", "source_dir": m.SourceDir}
+	if len(m.Only) > 0 {
+		change.Desired["targets"] = m.Only
+	}
 	change.BackupRequired = false
-	return []Change{change}
+	return []Change{change}, nil, nil
 }
 
 func (m *FilesModule) baseChange(operation Operation) Change {
@@ -9,9 +9,11 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dnery/dotstate/dot/internal/chez"
 	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/diffstat"
 	"github.com/dnery/dotstate/dot/internal/runner"
 	"github.com/dnery/dotstate/dot/internal/testutil"
 )
@@ -48,6 +50,50 @@ func TestFilesModuleApplyDryRunPlansWithoutMutating(t *testing.T) {
 	}
 	mock.AssertNotCalled(testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "apply"))
 	mock.AssertNotCalled(testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "managed"))
+	if len(report.Planned) != 1 || report.Planned[0].Name != "chezmoi" || !strings.HasSuffix(report.Planned[0].String(), " apply") {
+		t.Fatalf("Planned = %+v, want the chezmoi apply", report.Planned)
+	}
+}
+
+func TestFilesModuleCaptureDryRunRecordsReAdd(t *testing.T) {
+	repoDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "diff"), "--- a/.zshrc\n+++ b/.zshrc\n")
+
+	files := NewFilesModule(cfg, chez.New("chezmoi", mock), testutil.TempDir(t))
+	files.Only = []string{"/home/u/.zshrc"}
+	report, err := NewOrchestrator(files).Run(context.Background(), OperationCapture, RunOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Run dry-run error = %v", err)
+	}
+	var planned []string
+	for _, p := range report.Planned {
+		planned = append(planned, p.String())
+	}
+	if len(planned) != 2 || !strings.Contains(planned[0], " diff ") || !strings.HasSuffix(planned[1], " re-add /home/u/.zshrc") {
+		t.Fatalf("Planned = %q, want the mode check and re-add", planned)
+	}
+	mock.AssertNotCalled(testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "re-add"))
+	if sum := report.Plan.Summary; sum.Update != 1 {
+		t.Fatalf("Summary = %+v, want the differing file planned as an update", sum)
+	}
+}
+
+func TestFilesModuleCapturePlansNoopWhenHomeMatchesSource(t *testing.T) {
+	repoDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "diff"), "")
+
+	files := NewFilesModule(cfg, chez.New("chezmoi", mock), testutil.TempDir(t))
+	plan, err := NewOrchestrator(files).Plan(context.Background(), OperationCapture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := plan.Summary; sum.Update != 0 || sum.Noop != 1 {
+		t.Fatalf("Summary = %+v, want a no-op capture", sum)
+	}
 }
 
 func TestFilesModuleApplyBacksUpAppliesAndVerifies(t *testing.T) {
@@ -83,6 +129,33 @@ func TestFilesModuleApplyBacksUpAppliesAndVerifies(t *testing.T) {
 	}
 }
 
+func TestFilesModuleApplyOnlyLimitsChezmoiTargets(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	nvim := filepath.Join(homeDir, ".config", "nvim")
+
+	r := &queuedRunner{t: t}
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff", nvim}, "diff --git a/.config/nvim/init.lua b/.config/nvim/init.lua\nnew file mode 100644\n", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "managed"}, ".config/nvim/init.lua\n.zshrc\n", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "apply", nvim}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff", nvim}, "", "", nil)
+
+	files := NewFilesModule(cfg, chez.New("chezmoi", r), homeDir)
+	files.Only = []string{nvim}
+	report, err := NewOrchestrator(files).Run(ctx, OperationApply, RunOptions{})
+	if err != nil {
+		t.Fatalf("Run apply error = %v", err)
+	}
+	if len(report.Backups) != 1 || !strings.Contains(report.Backups[0].Source.Value, "init.lua") {
+		t.Fatalf("backups = %#v, want only init.lua", report.Backups)
+	}
+	if r.remaining() != 0 {
+		t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+	}
+}
+
 func TestFilesModulePlanNoopWhenDiffEmpty(t *testing.T) {
 	ctx := context.Background()
 	repoDir := testutil.TempDir(t)
@@ -109,6 +182,59 @@ func TestFilesModulePlanNoopWhenDiffEmpty(t *testing.T) {
 	}
 }
 
+func TestFilesModulePlanRecordsDiffStat(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "diff"),
+		"diff --git a/.zshrc b/.zshrc\n--- a/.zshrc\n+++ b/.zshrc\n@@ -1 +1,2 @@\n-old\n+new\n+more\n",
+	)
+
+	files := NewFilesModule(cfg, chez.New("chezmoi", mock), homeDir)
+	plan, err := NewOrchestrator(files).Plan(ctx, OperationApply)
+	if err != nil {
+		t.Fatalf("Plan error = %v", err)
+	}
+	current := plan.Changes[0].Current
+	if current["diff_files"] != int64(1) || current["diff_added"] != int64(2) || current["diff_removed"] != int64(1) {
+		t.Fatalf("unexpected diff totals: %#v", current)
+	}
+	if _, ok := current["diff_stat"].([]any); !ok {
+		t.Fatalf("diff_stat = %#v, want per-file records", current["diff_stat"])
+	}
+}
+
+func TestFilesModulePlanRecordsModeOnlyChanges(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "diff"),
+		"diff --git a/bin/run b/bin/run\nold mode 100755\nnew mode 100644\n",
+	)
+
+	files := NewFilesModule(cfg, chez.New("chezmoi", mock), homeDir)
+	plan, err := NewOrchestrator(files).Plan(ctx, OperationApply)
+	if err != nil {
+		t.Fatalf("Plan error = %v", err)
+	}
+	change := plan.Changes[0]
+	if change.Action != ActionUpdate || change.Current["diff_mode_changes"] != int64(1) {
+		t.Fatalf("mode-only diff should plan an update: %#v", change)
+	}
+	stats := diffstat.FromRecords(change.Current["diff_stat"])
+	if len(stats) != 1 || stats[0].OldMode != "100755" || stats[0].NewMode != "100644" {
+		t.Fatalf("diff_stat = %#v", stats)
+	}
+}
+
 func TestFilesModuleBackupCopiesManagedFiles(t *testing.T) {
 	ctx := context.Background()
 	repoDir := testutil.TempDir(t)
@@ -194,6 +320,128 @@ func TestFilesModuleBackupCopiesManagedFiles(t *testing.T) {
 	testutil.AssertFileContent(t, managedPath, "export PATH=/usr/bin\n")
 }
 
+func TestFilesModuleBackupOnlyCopiesDifferingFiles(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	testutil.TempFile(t, homeDir, ".zshrc", "local tweak\n")
+	testutil.TempFile(t, homeDir, ".gitconfig", "[user]\n")
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "managed"),
+		".zshrc\n.gitconfig\n",
+	)
+
+	files := NewFilesModule(cfg, chez.New("chezmoi", mock), homeDir)
+	change := files.baseChange(OperationApply)
+	change.Action = ActionUpdate
+	change.BackupRequired = true
+	change.Current = map[string]any{"diff_stat": []any{map[string]any{"path": ".zshrc", "added": int64(1), "removed": int64(1)}}}
+	plan := &Plan{SchemaVersion: SchemaPlanV1, PlanID: "test-plan", Operation: OperationApply}
+
+	backups, _, err := files.Backup(ctx, []Change{change}, plan)
+	if err != nil {
+		t.Fatalf("Backup error = %v", err)
+	}
+	if len(backups) != 1 || backups[0].Source.Value != "~/.zshrc" {
+		t.Fatalf("backups = %#v, want only ~/.zshrc", backups)
+	}
+	testutil.AssertFileContent(t, backups[0].PayloadRef.Path, "local tweak\n")
+}
+
+func TestFilesModuleBackupPrunesOldSets(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	testutil.TempFile(t, homeDir, ".zshrc", "x\n")
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "managed"),
+		".zshrc\n",
+	)
+
+	files := NewFilesModule(cfg, chez.New("chezmoi", mock), homeDir)
+	files.BackupKeep = 2
+	files.BackupMaxAge = 0
+	files.now = func() time.Time { return time.Date(2026, 5, 13, 12, 0, 0, 0, time.UTC) }
+	for _, name := range []string{"20260510T000000Z-files", "20260511T000000Z-files", "20260512T000000Z-files", "notes"} {
+		if err := os.MkdirAll(filepath.Join(files.BackupRoot, name), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	change := files.baseChange(OperationApply)
+	change.Action = ActionUpdate
+	change.BackupRequired = true
+	plan := &Plan{SchemaVersion: SchemaPlanV1, PlanID: "test-plan", Operation: OperationApply}
+
+	if _, _, err := files.Backup(ctx, []Change{change}, plan); err != nil {
+		t.Fatalf("Backup error = %v", err)
+	}
+	entries, err := os.ReadDir(files.BackupRoot)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"20260512T000000Z-files", "20260513T120000Z-files", "notes"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("backup sets = %v, want %v", names, want)
+	}
+}
+
+func TestFilesModuleBackupManifestRestoresLatestSet(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadModuleTestConfig(t, repoDir)
+	zshrc := testutil.TempFile(t, homeDir, ".zshrc", "before\n")
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(
+		testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "managed"),
+		".zshrc\n.missing\n",
+	)
+
+	files := NewFilesModule(cfg, chez.New("chezmoi", mock), homeDir)
+	files.now = func() time.Time { return time.Date(2026, 5, 13, 12, 0, 0, 0, time.UTC) }
+	if err := os.MkdirAll(filepath.Join(files.BackupRoot, "20260514T000000Z-files"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	change := files.baseChange(OperationApply)
+	change.Action = ActionUpdate
+	change.BackupRequired = true
+	plan := &Plan{SchemaVersion: SchemaPlanV1, PlanID: "test-plan", Operation: OperationApply}
+	if _, _, err := files.Backup(ctx, []Change{change}, plan); err != nil {
+		t.Fatalf("Backup error = %v", err)
+	}
+
+	id, backups, err := LatestBackupSet(files.BackupRoot)
+	if err != nil {
+		t.Fatalf("LatestBackupSet error = %v", err)
+	}
+	if id != "20260513T120000Z-files" || len(backups) != 2 {
+		t.Fatalf("LatestBackupSet = %q, %d backups; want the set with a manifest", id, len(backups))
+	}
+
+	testutil.TempFile(t, homeDir, ".zshrc", "after\n")
+	missing := testutil.TempFile(t, homeDir, ".missing", "created by apply\n")
+	if _, _, err := files.Restore(ctx, backups); err != nil {
+		t.Fatalf("Restore error = %v", err)
+	}
+	if content, _ := os.ReadFile(zshrc); string(content) != "before\n" {
+		t.Fatalf(".zshrc = %q, want the backed-up content", content)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf(".missing stat err = %v, want it removed", err)
+	}
+}
+
 func TestFilesModuleBackupTaintsSecretPayloadWithoutSerializingIt(t *testing.T) {
 	ctx := context.Background()
 	repoDir := testutil.TempDir(t)
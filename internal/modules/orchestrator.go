@@ -2,11 +2,15 @@ package modules
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/runner"
 )
 
 type Module interface {
@@ -27,6 +31,41 @@ type AuditModule interface {
 	Audit(ctx context.Context) ([]Fact, []Diagnostic, error)
 }
 
+// ApplyStepModule is implemented by modules that belong to an apply step
+// other than config.ApplyStepOS.
+type ApplyStepModule interface {
+	ApplyStep() string
+}
+
+// IndependentModule is implemented by modules whose changes succeed or fail
+// independently, such as clones of separate repositories. When Independent
+// reports true, a failed apply of the module does not stop the run: the
+// modules after it still apply, and Run returns its failures at the end.
+type IndependentModule interface {
+	Independent() bool
+}
+
+func independent(mod Module) bool {
+	ind, ok := mod.(IndependentModule)
+	return ok && ind.Independent()
+}
+
+// ApplyStepOf returns the apply pipeline step mod runs in.
+func ApplyStepOf(mod Module) string {
+	if stepper, ok := mod.(ApplyStepModule); ok {
+		return stepper.ApplyStep()
+	}
+	return config.ApplyStepOS
+}
+
+// CommandPlanModule is implemented by modules whose apply or capture runs
+// external commands. PlanCommands runs, through r, every command Apply or
+// Capture would run for changes; a dry run passes a runner.PlanRunner so
+// they are recorded instead.
+type CommandPlanModule interface {
+	PlanCommands(ctx context.Context, operation Operation, changes []Change, plan *Plan, r runner.Runner) error
+}
+
 type RunOptions struct {
 	DryRun bool
 }
@@ -36,12 +75,17 @@ type RunReport struct {
 	Backups     []Backup     `json:"backups"`
 	Results     []Result     `json:"results"`
 	Diagnostics []Diagnostic `json:"diagnostics"`
+	// Planned lists the commands a dry run would have run, in order.
+	Planned []runner.Planned `json:"planned,omitempty"`
 }
 
 type Orchestrator struct {
 	modules []Module
 	now     func() time.Time
 	target  Target
+	// pipeline orders and selects modules for apply by step; nil applies
+	// every module in registration order.
+	pipeline []string
 }
 
 func NewOrchestrator(mods ...Module) *Orchestrator {
@@ -56,6 +100,19 @@ func NewOrchestrator(mods ...Module) *Orchestrator {
 	}
 }
 
+// SetHost overrides the host recorded in plans and results.
+func (o *Orchestrator) SetHost(host string) {
+	if host != "" {
+		o.target.Host = host
+	}
+}
+
+// SetApplyPipeline sets the apply steps to run, in order. Modules in steps
+// not listed are skipped during apply; other operations are unaffected.
+func (o *Orchestrator) SetApplyPipeline(steps []string) {
+	o.pipeline = append([]string(nil), steps...)
+}
+
 func (o *Orchestrator) Modules() []Module {
 	mods := make([]Module, len(o.modules))
 	copy(mods, o.modules)
@@ -111,7 +168,7 @@ func (o *Orchestrator) Plan(ctx context.Context, operation Operation) (*Plan, er
 	}
 	defer SanitizePlan(plan)
 
-	for _, mod := range o.modules {
+	for _, mod := range o.modulesFor(operation) {
 		changes, diagnostics, err := mod.Plan(ctx, operation)
 		plan.Diagnostics = append(plan.Diagnostics, diagnostics...)
 		if err != nil {
@@ -132,10 +189,12 @@ func (o *Orchestrator) Run(ctx context.Context, operation Operation, opts RunOpt
 		return report, err
 	}
 	if opts.DryRun {
-		return report, nil
+		report.Planned, err = o.planCommands(ctx, operation, plan)
+		return report, err
 	}
 
-	for _, mod := range o.modules {
+	var deferred []error
+	for _, mod := range o.modulesFor(operation) {
 		changes := changesForSurface(plan.Changes, mod.Surface())
 		if len(changes) == 0 {
 			continue
@@ -161,11 +220,17 @@ func (o *Orchestrator) Run(ctx context.Context, operation Operation, opts RunOpt
 			results, diagnostics, err := mod.Apply(ctx, changes, plan)
 			report.Diagnostics = append(report.Diagnostics, diagnostics...)
 			report.Results = append(report.Results, results...)
-			if err != nil {
-				return report, fmt.Errorf("%s apply: %w", mod.Surface(), err)
+			if err == nil {
+				err = failedResultsError(mod.Surface(), PhaseApply, results)
+			} else {
+				err = fmt.Errorf("%s apply: %w", mod.Surface(), err)
 			}
-			if err := failedResultsError(mod.Surface(), PhaseApply, results); err != nil {
-				return report, err
+			if err != nil {
+				if !independent(mod) {
+					return report, err
+				}
+				deferred = append(deferred, err)
+				continue
 			}
 
 			verifyResults, verifyDiagnostics, err := mod.Verify(ctx, operation, changes, plan)
@@ -202,7 +267,27 @@ func (o *Orchestrator) Run(ctx context.Context, operation Operation, opts RunOpt
 		}
 	}
 
-	return report, nil
+	return report, errors.Join(deferred...)
+}
+
+// planCommands records the commands each module would run for its part of
+// plan, skipping modules with nothing to do.
+func (o *Orchestrator) planCommands(ctx context.Context, operation Operation, plan *Plan) ([]runner.Planned, error) {
+	rec := &runner.PlanRunner{}
+	for _, mod := range o.modulesFor(operation) {
+		planner, ok := mod.(CommandPlanModule)
+		if !ok {
+			continue
+		}
+		changes := changesForSurface(plan.Changes, mod.Surface())
+		if len(changes) == 0 || len(blockedMutations(changes)) > 0 {
+			continue
+		}
+		if err := planner.PlanCommands(ctx, operation, changes, plan, rec); err != nil {
+			return rec.Planned(), fmt.Errorf("%s plan commands: %w", mod.Surface(), err)
+		}
+	}
+	return rec.Planned(), nil
 }
 
 func (o *Orchestrator) Restore(ctx context.Context, backups []Backup) (*RunReport, error) {
@@ -226,6 +311,23 @@ func (o *Orchestrator) Restore(ctx context.Context, backups []Backup) (*RunRepor
 	return report, nil
 }
 
+// modulesFor returns the modules operation runs, in order. Apply follows the
+// pipeline when one is set.
+func (o *Orchestrator) modulesFor(operation Operation) []Module {
+	if operation != OperationApply || o.pipeline == nil {
+		return o.modules
+	}
+	var mods []Module
+	for _, step := range o.pipeline {
+		for _, mod := range o.modules {
+			if ApplyStepOf(mod) == step {
+				mods = append(mods, mod)
+			}
+		}
+	}
+	return mods
+}
+
 func changesForSurface(changes []Change, surface string) []Change {
 	selected := make([]Change, 0)
 	for _, change := range changes {
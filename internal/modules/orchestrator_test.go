@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/config"
 )
 
 func TestOrchestratorBlocksMutationsWithoutAutoApply(t *testing.T) {
@@ -231,6 +233,75 @@ func TestOrchestratorFailsOnFailedResultWithoutModuleError(t *testing.T) {
 	}
 }
 
+func TestOrchestratorAppliesInPipelineOrder(t *testing.T) {
+	var order []string
+	step := func(surface, name string) *steppedModule {
+		change := Change{ChangeID: surface + ":apply", Surface: surface, ID: surface, Action: ActionUpdate, Capability: []Capability{CapabilityAutoApply}, Risk: LowRisk(true)}
+		return &steppedModule{stubModule: &stubModule{surface: surface, changes: []Change{change}}, step: name, order: &order}
+	}
+	scripts := step("scripts", config.ApplyStepScripts)
+	defaults := step("defaults", config.ApplyStepOS)
+	brew := step("brew", config.ApplyStepPackages)
+	files := step("files", config.ApplyStepFiles)
+	orch := NewOrchestrator(scripts, defaults, brew, files)
+	orch.SetApplyPipeline([]string{config.ApplyStepFiles, config.ApplyStepPackages, config.ApplyStepOS})
+
+	if _, err := orch.Run(context.Background(), OperationApply, RunOptions{}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := strings.Join(order, ","); got != "files,brew,defaults" {
+		t.Fatalf("apply order = %s, want files,brew,defaults", got)
+	}
+
+	plan, err := orch.Plan(context.Background(), OperationCapture)
+	if err != nil || len(plan.Changes) != 4 {
+		t.Fatalf("capture plan = %d changes, %v; the pipeline only limits apply", len(plan.Changes), err)
+	}
+}
+
+func TestOrchestratorKeepsApplyingAfterIndependentModuleFails(t *testing.T) {
+	var order []string
+	step := func(surface, name string) *steppedModule {
+		change := Change{ChangeID: surface + ":apply", Surface: surface, ID: surface, Action: ActionUpdate, Capability: []Capability{CapabilityAutoApply}, Risk: LowRisk(true)}
+		return &steppedModule{stubModule: &stubModule{surface: surface, changes: []Change{change}}, step: name, order: &order}
+	}
+	subrepos := step("subrepos", config.ApplyStepSubrepos)
+	subrepos.applyResults = []Result{{Surface: "subrepos", ID: "subrepos", Phase: PhaseApply, Status: StatusFailed}}
+	scripts := step("scripts", config.ApplyStepScripts)
+	orch := NewOrchestrator(&independentModule{subrepos}, scripts)
+	orch.SetApplyPipeline([]string{config.ApplyStepSubrepos, config.ApplyStepScripts})
+
+	_, err := orch.Run(context.Background(), OperationApply, RunOptions{})
+	if err == nil || !strings.Contains(err.Error(), "subrepos apply returned 1 failed result") {
+		t.Fatalf("Run() error = %v, want the subrepo failure", err)
+	}
+	if got := strings.Join(order, ","); got != "subrepos,scripts" {
+		t.Fatalf("apply order = %s, want scripts to run after the failure", got)
+	}
+
+	order = nil
+	orch = NewOrchestrator(subrepos, scripts)
+	if _, err := orch.Run(context.Background(), OperationApply, RunOptions{}); err == nil || len(order) != 1 {
+		t.Fatalf("Run() = %v, order %v; a dependent module failure should stop the run", err, order)
+	}
+}
+
+type independentModule struct{ *steppedModule }
+
+func (m *independentModule) Independent() bool { return true }
+
+type steppedModule struct {
+	*stubModule
+	step  string
+	order *[]string
+}
+
+func (m *steppedModule) ApplyStep() string { return m.step }
+func (m *steppedModule) Apply(ctx context.Context, changes []Change, plan *Plan) ([]Result, []Diagnostic, error) {
+	*m.order = append(*m.order, m.surface)
+	return m.stubModule.Apply(ctx, changes, plan)
+}
+
 type stubModule struct {
 	surface       string
 	changes       []Change
@@ -18,6 +18,11 @@ func SanitizeRunReport(report *RunReport) {
 		sanitizeResult(&report.Results[i])
 	}
 	sanitizeDiagnostics(report.Diagnostics)
+	for i := range report.Planned {
+		for j, arg := range report.Planned[i].Args {
+			report.Planned[i].Args[j] = redact.Text(arg)
+		}
+	}
 }
 
 // SanitizeFacts redacts facts in place and promotes sensitivity on each record
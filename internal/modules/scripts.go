@@ -0,0 +1,234 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+const (
+	scriptsSurface = "scripts"
+	// scriptOutputLines is how much of each script's output results keep.
+	scriptOutputLines = 20
+)
+
+var exitStatusRE = regexp.MustCompile(`exit status (\d+)`)
+
+// ScriptsModule runs the source state's chezmoi scripts as their own apply
+// step, after the files and packages they usually depend on, one script at a
+// time so each gets its own result with its exit status and output. Chez must
+// be limited to scripts (Include "scripts"); the files module's engine
+// excludes them. Scripts have no capture side.
+type ScriptsModule struct {
+	Chez      *chez.Chezmoi
+	RepoPath  string
+	SourceDir string
+	now       func() time.Time
+}
+
+func NewScriptsModule(cfg *config.Config, ch *chez.Chezmoi) *ScriptsModule {
+	return &ScriptsModule{
+		Chez:      ch,
+		RepoPath:  cfg.Repo.Path,
+		SourceDir: cfg.Chex.SourceDir,
+		now:       time.Now,
+	}
+}
+
+func (m *ScriptsModule) Surface() string { return scriptsSurface }
+
+func (m *ScriptsModule) ApplyStep() string { return config.ApplyStepScripts }
+
+func (m *ScriptsModule) Plan(ctx context.Context, operation Operation) ([]Change, []Diagnostic, error) {
+	switch operation {
+	case OperationApply:
+	case OperationCapture:
+		return nil, nil, nil
+	default:
+		change := m.baseChange(operation, "")
+		change.Action = ActionBlocked
+		change.Capability = []Capability{CapabilityUnsupported}
+		change.Diagnostics = []Diagnostic{NewDiagnostic(SeverityError, "scripts.operation_unsupported", "Scripts module does not support this operation.", scriptsSurface, change.ID)}
+		return []Change{change}, nil, nil
+	}
+	entries, err := m.Chez.Status(ctx, m.RepoPath, m.SourceDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var changes []Change
+	for _, entry := range entries {
+		if entry.Pending != 'R' {
+			continue
+		}
+		change := m.baseChange(operation, entry.Path)
+		change.Action = ActionUpdate
+		change.Desired = map[string]any{"run": true}
+		change.Risk = Risk{Level: RiskMedium, Reasons: []string{"source state script will run"}, RequiresConfirmation: false, Reversible: false}
+		changes = append(changes, change)
+	}
+	if len(changes) == 0 {
+		change := m.baseChange(operation, "")
+		change.Current = map[string]any{"pending": 0}
+		return []Change{change}, nil, nil
+	}
+	return changes, nil, nil
+}
+
+func (m *ScriptsModule) Backup(context.Context, []Change, *Plan) ([]Backup, []Diagnostic, error) {
+	return nil, nil, nil
+}
+
+// Apply runs each pending script in plan order and stops at the first
+// failure; the scripts after it are reported skipped.
+func (m *ScriptsModule) Apply(ctx context.Context, changes []Change, plan *Plan) ([]Result, []Diagnostic, error) {
+	results := make([]Result, 0, len(changes))
+	var failure error
+	for _, change := range changes {
+		if !isMutation(change.Action) {
+			results = append(results, m.result(plan, PhaseApply, StatusNoop, change, nil))
+			continue
+		}
+		if failure != nil {
+			results = append(results, m.result(plan, PhaseApply, StatusSkipped, change, nil))
+			continue
+		}
+		target, err := m.Chez.TargetPath(change.Source.Value)
+		if err != nil {
+			return results, nil, err
+		}
+		res, err := m.Chez.ApplyOutput(ctx, m.RepoPath, m.SourceDir, target)
+		current := scriptRun(res, err)
+		if err != nil {
+			failure = fmt.Errorf("script %s exited with status %v: %w", change.Source.Value, current["exit_code"], err)
+			results = append(results, m.result(plan, PhaseApply, StatusFailed, change, current))
+			continue
+		}
+		results = append(results, m.result(plan, PhaseApply, StatusApplied, change, current))
+	}
+	return results, nil, failure
+}
+
+// PlanCommands runs, through r, the chezmoi apply Apply would run for each
+// pending script.
+func (m *ScriptsModule) PlanCommands(ctx context.Context, operation Operation, changes []Change, plan *Plan, r runner.Runner) error {
+	if operation != OperationApply {
+		return nil
+	}
+	planned := *m.Chez
+	planned.R, planned.Progress = r, nil
+	for _, change := range changes {
+		if !isMutation(change.Action) {
+			continue
+		}
+		target, err := m.Chez.TargetPath(change.Source.Value)
+		if err != nil {
+			return err
+		}
+		if _, err := planned.ApplyOutput(ctx, m.RepoPath, m.SourceDir, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scriptRun describes one script's run for its result: the exit status and
+// the tail of what it printed.
+func scriptRun(res *runner.CmdResult, err error) map[string]any {
+	var stdout, stderr string
+	code := 0
+	if res != nil {
+		stdout, stderr, code = res.Stdout, res.Stderr, res.Code
+	}
+	var runErr *runner.RunError
+	if errors.As(err, &runErr) {
+		stderr, code = runErr.Stderr, runErr.Code
+	}
+	// chezmoi exits 1 for any failed script and names the script's own
+	// status in its error message.
+	if match := exitStatusRE.FindStringSubmatch(stderr); match != nil {
+		code, _ = strconv.Atoi(match[1])
+	}
+	if err != nil && code == 0 {
+		code = -1
+	}
+	output := strings.TrimSpace(strings.TrimSpace(stdout) + "\n" + strings.TrimSpace(stderr))
+	if lines := strings.Split(output, "\n"); len(lines) > scriptOutputLines {
+		output = strings.Join(lines[len(lines)-scriptOutputLines:], "\n")
+	}
+	return map[string]any{"exit_code": code, "output": output}
+}
+
+func (m *ScriptsModule) Capture(context.Context, []Change, *Plan) ([]Result, []Diagnostic, error) {
+	return nil, nil, nil
+}
+
+// Verify accepts any successful run: run_ scripts are pending on every
+// apply, so checking status afterwards says nothing about whether they
+// worked.
+func (m *ScriptsModule) Verify(context.Context, Operation, []Change, *Plan) ([]Result, []Diagnostic, error) {
+	return nil, nil, nil
+}
+
+func (m *ScriptsModule) Restore(context.Context, []Backup) ([]Result, []Diagnostic, error) {
+	return nil, nil, nil
+}
+
+// baseChange describes script, or the source state's scripts as a whole
+// when script is empty.
+func (m *ScriptsModule) baseChange(operation Operation, script string) Change {
+	id, source := "scripts:source/"+m.SourceDir, Source{Kind: "chezmoi", Value: m.SourceDir}
+	if script != "" {
+		id, source = "scripts:"+script, Source{Kind: "script", Value: script}
+	}
+	return Change{
+		ChangeID:       fmt.Sprintf("%s:%s", id, operation),
+		Surface:        scriptsSurface,
+		ID:             id,
+		Action:         ActionNoop,
+		Source:         source,
+		ManagedBy:      []string{"dotstate", "chezmoi"},
+		Sensitivity:    SensitivityLocalPath,
+		Confidence:     ConfidenceConfirmed,
+		Capability:     []Capability{CapabilityAutoApply},
+		Risk:           LowRisk(true),
+		BackupRequired: false,
+		DependsOn:      []string{},
+		Diagnostics:    []Diagnostic{},
+	}
+}
+
+func (m *ScriptsModule) result(plan *Plan, phase Phase, status ResultStatus, change Change, current map[string]any) Result {
+	now := m.now().UTC()
+	if current == nil {
+		current = change.Current
+	}
+	return Result{
+		SchemaVersion: SchemaResultV1,
+		RunID:         newID(now, string(phase)+"-scripts"),
+		PlanID:        plan.PlanID,
+		Phase:         phase,
+		Surface:       scriptsSurface,
+		ID:            change.ID,
+		ChangeID:      change.ChangeID,
+		Source:        change.Source,
+		Current:       current,
+		Desired:       change.Desired,
+		ManagedBy:     change.ManagedBy,
+		Sensitivity:   change.Sensitivity,
+		Confidence:    change.Confidence,
+		Capability:    change.Capability,
+		Risk:          change.Risk,
+		Status:        status,
+		StartedAt:     Timestamp(now),
+		EndedAt:       Timestamp(now),
+		Diagnostics:   change.Diagnostics,
+	}
+}
@@ -0,0 +1,99 @@
+package modules
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/runner"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestScriptsModuleRunsEachScriptAndStopsAtFailure(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	base := []string{"--source", "/repo/home"}
+	run := func(args ...string) testutil.CommandMatcher {
+		return testutil.MatchExact("chezmoi", append(append([]string{}, base...), args...)...)
+	}
+	mock.OnCommandSuccess(run("status", "--include", "scripts"), " R install-packages.sh\n R setup-shell.sh\n R finish.sh\n")
+	mock.OnCommandSuccess(run("apply", "--include", "scripts", "/home/u/install-packages.sh"), "installed 3 packages\n")
+	mock.OnCommand(run("apply", "--include", "scripts", "/home/u/setup-shell.sh"), "changing shell\n", "chezmoi: setup-shell.sh: exit status 3\n", 1,
+		&runner.RunError{Cmd: "chezmoi", Code: 1, Stderr: "chezmoi: setup-shell.sh: exit status 3\n"})
+
+	ch := chez.New("chezmoi", mock)
+	ch.Include, ch.DestDir = "scripts", "/home/u"
+	cfg := config.Default()
+	cfg.Repo.Path = "/repo"
+	m := NewScriptsModule(cfg, ch)
+
+	changes, _, err := m.Plan(context.Background(), OperationApply)
+	if err != nil || len(changes) != 3 || changes[0].ID != "scripts:install-packages.sh" {
+		t.Fatalf("Plan() = %+v, %v", changes, err)
+	}
+	plan := &Plan{SchemaVersion: SchemaPlanV1, PlanID: "test-plan", Operation: OperationApply}
+	results, _, err := m.Apply(context.Background(), changes, plan)
+	if err == nil || !strings.Contains(err.Error(), "setup-shell.sh exited with status 3") {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Apply() results = %d, want 3", len(results))
+	}
+	want := []struct {
+		status ResultStatus
+		code   any
+		output string
+	}{
+		{StatusApplied, 0, "installed 3 packages"},
+		{StatusFailed, 3, "changing shell\nchezmoi: setup-shell.sh: exit status 3"},
+		{StatusSkipped, nil, ""},
+	}
+	for i, w := range want {
+		got := results[i]
+		output, _ := got.Current["output"].(string)
+		if got.Status != w.status || got.Current["exit_code"] != w.code || output != w.output {
+			t.Errorf("result %d = %s exit %v %q; want %s exit %v %q", i, got.Status, got.Current["exit_code"], output, w.status, w.code, w.output)
+		}
+	}
+	mock.AssertNotCalled(run("apply", "--include", "scripts", "/home/u/finish.sh"))
+}
+
+func TestScriptsModulePlansNoopWithoutPendingScripts(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("chezmoi"), "")
+	cfg := config.Default()
+	cfg.Repo.Path = "/repo"
+	m := NewScriptsModule(cfg, chez.New("chezmoi", mock))
+
+	changes, _, err := m.Plan(context.Background(), OperationApply)
+	if err != nil || len(changes) != 1 || changes[0].Action != ActionNoop {
+		t.Fatalf("Plan() = %+v, %v; want one noop change", changes, err)
+	}
+	if changes, _, _ := m.Plan(context.Background(), OperationCapture); len(changes) != 0 {
+		t.Fatalf("capture Plan() = %+v; scripts have nothing to capture", changes)
+	}
+}
+
+func TestScriptsModuleDryRunRecordsEachScript(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", "/repo/home", "status", "--include", "scripts"), " R install-packages.sh\n R finish.sh\n")
+
+	ch := chez.New("chezmoi", mock)
+	ch.Include, ch.DestDir = "scripts", "/home/u"
+	cfg := config.Default()
+	cfg.Repo.Path = "/repo"
+	report, err := NewOrchestrator(NewScriptsModule(cfg, ch)).Run(context.Background(), OperationApply, RunOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Run dry-run error = %v", err)
+	}
+	var planned []string
+	for _, p := range report.Planned {
+		planned = append(planned, p.String())
+	}
+	want := "chezmoi --source /repo/home apply --include scripts /home/u/install-packages.sh,chezmoi --source /repo/home apply --include scripts /home/u/finish.sh"
+	if got := strings.Join(planned, ","); got != want {
+		t.Fatalf("Planned = %s, want %s", got, want)
+	}
+	mock.AssertNotCalled(testutil.MatchCommandPrefix("chezmoi", "--source", "/repo/home", "apply"))
+}
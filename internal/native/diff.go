@@ -0,0 +1,123 @@
+package native
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// maxDiffCells bounds the LCS table; larger files diff as full replacements.
+const maxDiffCells = 4_000_000
+
+// fileDiff renders a git-style diff for target from have to want. haveMode
+// and wantMode are 0 when the file is absent on that side.
+func fileDiff(target string, have, want []byte, haveMode, wantMode fs.FileMode) string {
+	if haveMode == wantMode && bytes.Equal(have, want) {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n", target, target)
+	oldName, newName := "a/"+target, "b/"+target
+	switch {
+	case haveMode == 0:
+		fmt.Fprintf(&b, "new file mode %s\n", gitMode(wantMode))
+		oldName = "/dev/null"
+	case wantMode == 0:
+		fmt.Fprintf(&b, "deleted file mode %s\n", gitMode(haveMode))
+		newName = "/dev/null"
+	case haveMode != wantMode:
+		fmt.Fprintf(&b, "old mode %s\nnew mode %s\n", gitMode(haveMode), gitMode(wantMode))
+	}
+	if bytes.Equal(have, want) {
+		return b.String()
+	}
+	if bytes.IndexByte(have, 0) >= 0 || bytes.IndexByte(want, 0) >= 0 {
+		fmt.Fprintf(&b, "Binary files %s and %s differ\n", oldName, newName)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	oldLines, newLines := splitLines(have), splitLines(want)
+	fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(len(oldLines)), hunkRange(len(newLines)))
+	for _, op := range diffLines(oldLines, newLines) {
+		b.WriteString(op)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func gitMode(mode fs.FileMode) string {
+	if mode&fs.ModeSymlink != 0 {
+		return "120000"
+	}
+	if mode.Perm()&0o111 != 0 {
+		return "100755"
+	}
+	return "100644"
+}
+
+func hunkRange(n int) string {
+	if n == 0 {
+		return "0,0"
+	}
+	return fmt.Sprintf("1,%d", n)
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+// diffLines returns one " ", "-", or "+" prefixed line per input line,
+// following the longest common subsequence of a and b.
+func diffLines(a, b []string) []string {
+	if len(a)*len(b) > maxDiffCells {
+		out := make([]string, 0, len(a)+len(b))
+		for _, line := range a {
+			out = append(out, "-"+line)
+		}
+		for _, line := range b {
+			out = append(out, "+"+line)
+		}
+		return out
+	}
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	out := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+"+b[j])
+	}
+	return out
+}
@@ -0,0 +1,523 @@
+// Package native is a chezmoi-free apply engine. It reads the same
+// chezmoi-style source directory (dot_, private_, executable_, readonly_,
+// empty_, literal_, and .tmpl names) and either copies files into home or
+// symlinks them back to the repo, so dotstate's sync, discover, and secrets
+// flows work without a chezmoi binary.
+package native
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+)
+
+// Mode selects how non-template files reach home.
+type Mode string
+
+const (
+	// ModeCopy writes a copy of each source file into home.
+	ModeCopy Mode = "copy"
+	// ModeSymlink links each home file to its source file, so edits land
+	// in the repo directly. Templates are always rendered copies.
+	ModeSymlink Mode = "symlink"
+)
+
+// Engine applies a chezmoi-style source directory without chezmoi.
+type Engine struct {
+	Home string
+	Mode Mode
+	// Data is the template root, normally tmpldata.Registry.Build output,
+	// so templates read {{ .dotstate.profile }} as they would under chezmoi.
+	Data map[string]any
+	// Progress, when set, is called for each entry apply handles.
+	Progress func(chez.FileProgress)
+}
+
+var (
+	_ chez.Engine   = (*Engine)(nil)
+	_ chez.Verifier = (*Engine)(nil)
+)
+
+// New returns a native engine for home. An empty mode means copy.
+func New(home string, mode Mode) *Engine {
+	if mode == "" {
+		mode = ModeCopy
+	}
+	return &Engine{Home: home, Mode: mode}
+}
+
+// Managed returns the managed target files relative to home.
+func (e *Engine) Managed(ctx context.Context, repoPath, sourceDir string) ([]string, error) {
+	entries, err := readSource(filepath.Join(repoPath, sourceDir))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(entries))
+	for _, ent := range entries {
+		out = append(out, ent.Target)
+	}
+	return out, nil
+}
+
+// SourcePath returns the source file managing target, an absolute or
+// home-relative path.
+func (e *Engine) SourcePath(ctx context.Context, repoPath, sourceDir, target string) (string, error) {
+	target, err := e.relTarget(target)
+	if err != nil {
+		return "", fmt.Errorf("native source-path %w", err)
+	}
+	entries, err := readSource(filepath.Join(repoPath, sourceDir))
+	if err != nil {
+		return "", err
+	}
+	for _, ent := range entries {
+		if ent.Target == target {
+			return ent.Source, nil
+		}
+	}
+	return "", fmt.Errorf("native source-path %s: not managed", target)
+}
+
+// Forget removes the source files managing targets, and every managed
+// file below a target directory, leaving home untouched. Source
+// directories left empty are removed too.
+func (e *Engine) Forget(ctx context.Context, repoPath, sourceDir string, targets ...string) error {
+	root := filepath.Join(repoPath, sourceDir)
+	entries, err := readSource(root)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		rel, err := e.relTarget(target)
+		if err != nil {
+			return fmt.Errorf("native forget %w", err)
+		}
+		var sources []string
+		for _, ent := range entries {
+			if ent.Target == rel || strings.HasPrefix(ent.Target, rel+"/") {
+				sources = append(sources, ent.Source)
+			}
+		}
+		if len(sources) == 0 {
+			return fmt.Errorf("native forget %s: not managed", rel)
+		}
+		for _, src := range sources {
+			if err := os.Remove(src); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			for dir := filepath.Dir(src); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+				if os.Remove(dir) != nil {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Apply makes home match the source state, limited to targets when any
+// are given.
+func (e *Engine) Apply(ctx context.Context, repoPath, sourceDir string, targets ...string) error {
+	entries, err := e.readTargets(filepath.Join(repoPath, sourceDir), targets)
+	if err != nil {
+		return err
+	}
+	for i, ent := range entries {
+		if err := ctx.Err(); err != nil {
+			e.skipRest(entries, i)
+			return err
+		}
+		action, err := e.applyEntry(ent)
+		if err != nil {
+			e.skipRest(entries, i)
+			return fmt.Errorf("native apply %s: %w", ent.Target, err)
+		}
+		e.report(ent, action, i, len(entries))
+	}
+	return nil
+}
+
+// report passes entries[i]'s action to Progress.
+func (e *Engine) report(ent entry, action string, i, total int) {
+	if e.Progress != nil {
+		e.Progress(chez.FileProgress{Path: ent.Target, Action: action, Done: i + 1, Total: total})
+	}
+}
+
+// skipRest reports entries from index i on as skipped after a failure, so
+// progress still ends with Done == Total.
+func (e *Engine) skipRest(entries []entry, i int) {
+	for ; i < len(entries); i++ {
+		e.report(entries[i], chez.ProgressSkipped, i, len(entries))
+	}
+}
+
+// ReAdd copies edited home files back into the source and renames source
+// files whose home permissions drifted (chmod +x, chmod 600), limited to
+// targets when any are given. Templates and symlinked files are skipped:
+// the former cannot be reversed and the latter already live in the repo.
+func (e *Engine) ReAdd(ctx context.Context, repoPath, sourceDir string, targets ...string) error {
+	entries, err := e.readTargets(filepath.Join(repoPath, sourceDir), targets)
+	if err != nil {
+		return err
+	}
+	for _, ent := range entries {
+		if ent.Template || e.Mode == ModeSymlink {
+			continue
+		}
+		dest := e.target(ent)
+		info, err := os.Lstat(dest)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if ent, err = e.captureMode(ent, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("native re-add %s: %w", ent.Target, err)
+		}
+		have, err := os.ReadFile(dest)
+		if err != nil {
+			return fmt.Errorf("native re-add %s: %w", ent.Target, err)
+		}
+		src, err := os.ReadFile(ent.Source)
+		if err != nil {
+			return fmt.Errorf("native re-add %s: %w", ent.Target, err)
+		}
+		if bytes.Equal(have, src) {
+			continue
+		}
+		if err := writeFileAtomic(ent.Source, have, 0o644); err != nil {
+			return fmt.Errorf("native re-add %s: %w", ent.Target, err)
+		}
+	}
+	return nil
+}
+
+// captureMode renames ent's source file when the private, readonly, or
+// executable attribute implied by perm differs from the source name.
+func (e *Engine) captureMode(ent entry, perm fs.FileMode) (entry, error) {
+	if modeAttrs(perm) == modeAttrs(ent.Perm) {
+		return ent, nil
+	}
+	name := sourceName(path.Base(ent.Target), perm, false, ent.Empty)
+	renamed := filepath.Join(filepath.Dir(ent.Source), name)
+	if err := os.Rename(ent.Source, renamed); err != nil {
+		return ent, err
+	}
+	ent.Source, ent.Perm = renamed, perm
+	return ent, nil
+}
+
+// modeAttrs reduces perm to the bits source names can express.
+func modeAttrs(perm fs.FileMode) [3]bool {
+	return [3]bool{perm&0o077 == 0, perm&0o222 == 0, perm&0o111 != 0}
+}
+
+// Diff renders a git-style diff from home to the source state, limited to
+// targets when any are given.
+func (e *Engine) Diff(ctx context.Context, repoPath, sourceDir string, targets ...string) (string, error) {
+	entries, err := e.readTargets(filepath.Join(repoPath, sourceDir), targets)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, ent := range entries {
+		want, wantMode, err := e.desired(ent)
+		if err != nil {
+			return "", fmt.Errorf("native diff %s: %w", ent.Target, err)
+		}
+		have, haveMode, err := current(e.target(ent))
+		if err != nil {
+			return "", fmt.Errorf("native diff %s: %w", ent.Target, err)
+		}
+		b.WriteString(fileDiff(ent.Target, have, want, haveMode, wantMode))
+	}
+	return b.String(), nil
+}
+
+// TargetState returns what apply would leave in home for each managed file,
+// limited to targets when any are given. Files that render empty, and so
+// should not exist, are left out.
+func (e *Engine) TargetState(ctx context.Context, repoPath, sourceDir string, targets ...string) ([]chez.TargetEntry, error) {
+	entries, err := e.readTargets(filepath.Join(repoPath, sourceDir), targets)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]chez.TargetEntry, 0, len(entries))
+	for _, ent := range entries {
+		want, wantMode, err := e.desired(ent)
+		if err != nil {
+			return nil, fmt.Errorf("native target state %s: %w", ent.Target, err)
+		}
+		switch {
+		case wantMode == 0:
+			continue
+		case wantMode&fs.ModeSymlink != 0:
+			out = append(out, chez.TargetEntry{Path: ent.Target, Type: chez.TargetSymlink, Contents: want})
+		default:
+			out = append(out, chez.TargetEntry{Path: ent.Target, Type: chez.TargetFile, Perm: wantMode, Contents: want})
+		}
+	}
+	return out, nil
+}
+
+// Add copies home files into the source with chezmoi-style names. secrets
+// mode is accepted for interface parity; discover runs its own secret scan
+// before adding.
+func (e *Engine) Add(ctx context.Context, repoPath, sourceDir string, files []string, secretsMode string) error {
+	return e.AddWithAttributes(ctx, repoPath, sourceDir, files, secretsMode, chez.Attributes{})
+}
+
+// AddWithAttributes is Add with private/readonly forced onto the source
+// names. create and symlink are not supported by the native engine.
+func (e *Engine) AddWithAttributes(ctx context.Context, repoPath, sourceDir string, files []string, secretsMode string, attrs chez.Attributes) error {
+	if attrs.Create || attrs.Symlink || attrs.Template {
+		return fmt.Errorf("native add: attributes %q are not supported by the native engine", attrs.String())
+	}
+	root := filepath.Join(repoPath, sourceDir)
+	for _, file := range files {
+		abs := file
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(e.Home, file)
+		}
+		rel, err := filepath.Rel(e.Home, abs)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("native add %s: not under home", file)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return fmt.Errorf("native add %s: %w", file, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("native add %s: only regular files are supported", file)
+		}
+		content, err := os.ReadFile(abs)
+		if err != nil {
+			return fmt.Errorf("native add %s: %w", file, err)
+		}
+		rel = filepath.ToSlash(rel)
+		dir, err := sourceDirFor(root, e.Home, path.Dir(rel))
+		if err != nil {
+			return fmt.Errorf("native add %s: %w", file, err)
+		}
+		perm := info.Mode().Perm()
+		if attrs.Private {
+			perm &^= 0o077
+		}
+		if attrs.ReadOnly {
+			perm &^= 0o222
+		}
+		name := sourceName(path.Base(rel), perm, false, len(content) == 0)
+		if err := writeFileAtomic(filepath.Join(dir, name), content, 0o644); err != nil {
+			return fmt.Errorf("native add %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// readTargets reads the source entries at or below targets, absolute or
+// home-relative paths; no targets selects every entry.
+func (e *Engine) readTargets(root string, targets []string) ([]entry, error) {
+	entries, err := readSource(root)
+	if err != nil || len(targets) == 0 {
+		return entries, err
+	}
+	prefixes := make([]string, 0, len(targets))
+	for _, target := range targets {
+		rel, err := e.relTarget(target)
+		if err != nil {
+			return nil, fmt.Errorf("native target %w", err)
+		}
+		prefixes = append(prefixes, rel)
+	}
+	var selected []entry
+	for _, ent := range entries {
+		for _, prefix := range prefixes {
+			if ent.Target == prefix || strings.HasPrefix(ent.Target, prefix+"/") {
+				selected = append(selected, ent)
+				break
+			}
+		}
+	}
+	return selected, nil
+}
+
+// relTarget converts an absolute or home-relative target to the
+// slash-separated form entries use.
+func (e *Engine) relTarget(target string) (string, error) {
+	if filepath.IsAbs(target) {
+		rel, err := filepath.Rel(e.Home, target)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return "", fmt.Errorf("%s: not under home", target)
+		}
+		target = rel
+	}
+	return filepath.ToSlash(filepath.Clean(target)), nil
+}
+
+func (e *Engine) target(ent entry) string {
+	return filepath.Join(e.Home, filepath.FromSlash(ent.Target))
+}
+
+func (e *Engine) linked(ent entry) bool {
+	return e.Mode == ModeSymlink && !ent.Template
+}
+
+// desired returns the target content and mode. Symlinked entries are
+// described by their link destination, as git does; mode 0 means the target
+// should not exist.
+func (e *Engine) desired(ent entry) ([]byte, fs.FileMode, error) {
+	if e.linked(ent) {
+		return []byte(ent.Source), fs.ModeSymlink, nil
+	}
+	content, err := os.ReadFile(ent.Source)
+	if err != nil {
+		return nil, 0, err
+	}
+	if ent.Template {
+		content, err = e.render(ent, content)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if len(content) == 0 && !ent.Empty {
+		return nil, 0, nil
+	}
+	return content, ent.Perm, nil
+}
+
+func (e *Engine) render(ent entry, content []byte) ([]byte, error) {
+	tmpl, err := template.New(ent.Target).Option("missingkey=error").Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, e.Data); err != nil {
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// applyEntry writes ent to its target and returns what it did as a chez
+// progress action.
+func (e *Engine) applyEntry(ent entry) (string, error) {
+	dest := e.target(ent)
+	want, wantMode, err := e.desired(ent)
+	if err != nil {
+		return "", err
+	}
+	have, haveMode, err := current(dest)
+	if err != nil {
+		return "", err
+	}
+	if haveMode == wantMode && bytes.Equal(have, want) {
+		return chez.ProgressSkipped, nil
+	}
+	if wantMode == 0 {
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		return chez.ProgressRemoved, nil
+	}
+	action := chez.ProgressModified
+	if haveMode == 0 {
+		action = chez.ProgressCreated
+	}
+	if err := e.ensureDirs(ent); err != nil {
+		return "", err
+	}
+	if wantMode&fs.ModeSymlink != 0 {
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		return action, os.Symlink(ent.Source, dest)
+	}
+	if haveMode&fs.ModeSymlink != 0 {
+		if err := os.Remove(dest); err != nil {
+			return "", err
+		}
+	}
+	return action, writeFileAtomic(dest, want, wantMode)
+}
+
+func (e *Engine) ensureDirs(ent entry) error {
+	if err := os.MkdirAll(filepath.Dir(e.target(ent)), 0o755); err != nil {
+		return err
+	}
+	for _, dir := range ent.PrivateDirs {
+		if err := os.Chmod(filepath.Join(e.Home, filepath.FromSlash(dir)), 0o700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// current returns what is at dest: file content and permissions, a link
+// destination with ModeSymlink, or mode 0 when nothing is there.
+func current(dest string) ([]byte, fs.FileMode, error) {
+	info, err := os.Lstat(dest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		link, err := os.Readlink(dest)
+		return []byte(link), fs.ModeSymlink, err
+	}
+	if info.IsDir() {
+		return nil, 0, fmt.Errorf("%s is a directory", dest)
+	}
+	content, err := os.ReadFile(dest)
+	return content, info.Mode().Perm(), err
+}
+
+func writeFileAtomic(dest string, content []byte, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".dotstate-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// templateFuncs is the small function set native templates get. chezmoi's
+// sprig and password-manager functions are not available.
+var templateFuncs = template.FuncMap{
+	"env":       os.Getenv,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"trim":      strings.TrimSpace,
+	"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"join":      func(sep string, elems []string) string { return strings.Join(elems, sep) },
+	"default": func(def, value any) any {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+}
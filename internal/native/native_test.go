@@ -0,0 +1,309 @@
+package native
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/diffstat"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestApplyCopiesSourceWithAttributes(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/dot_zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, repo, "home/private_dot_ssh/config", "Host *\n")
+	testutil.TempFile(t, repo, "home/dot_local/bin/executable_hello", "#!/bin/sh\n")
+	testutil.TempFile(t, repo, "home/dot_gitconfig.tmpl", "[user]\n\temail = {{ .dotstate.data.email }}\n")
+	testutil.TempFile(t, repo, "home/.chezmoiignore", "ignored\n")
+
+	e := New(home, ModeCopy)
+	e.Data = map[string]any{"dotstate": map[string]any{"data": map[string]any{"email": "me@example.com"}}}
+
+	managed, err := e.Managed(ctx, repo, "home")
+	if err != nil {
+		t.Fatalf("Managed error = %v", err)
+	}
+	if strings.Join(managed, ",") != ".gitconfig,.local/bin/hello,.ssh/config,.zshrc" {
+		t.Fatalf("managed = %v", managed)
+	}
+
+	diff, err := e.Diff(ctx, repo, "home")
+	if err != nil {
+		t.Fatalf("Diff error = %v", err)
+	}
+	if stats := diffstat.Parse(diff); len(stats) != 4 {
+		t.Fatalf("diff stats = %#v\n%s", stats, diff)
+	}
+
+	if err := e.Apply(ctx, repo, "home"); err != nil {
+		t.Fatalf("Apply error = %v", err)
+	}
+	assertFile(t, filepath.Join(home, ".gitconfig"), "[user]\n\temail = me@example.com\n", 0o644)
+	assertFile(t, filepath.Join(home, ".local", "bin", "hello"), "#!/bin/sh\n", 0o755)
+	assertFile(t, filepath.Join(home, ".ssh", "config"), "Host *\n", 0o644)
+	if info, _ := os.Stat(filepath.Join(home, ".ssh")); info.Mode().Perm() != 0o700 {
+		t.Fatalf(".ssh mode = %v, want 0700", info.Mode().Perm())
+	}
+
+	diff, err = e.Diff(ctx, repo, "home")
+	if err != nil || diff != "" {
+		t.Fatalf("diff after apply = %q, %v", diff, err)
+	}
+}
+
+func TestApplyTargetsLimitsEntries(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/dot_zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, repo, "home/dot_config/nvim/init.lua", "vim.o.number = true\n")
+	testutil.TempFile(t, repo, "home/dot_config/nvim/lua/plugins.lua", "return {}\n")
+
+	e := New(home, ModeCopy)
+	diff, err := e.Diff(ctx, repo, "home", ".config/nvim")
+	if err != nil {
+		t.Fatalf("Diff error = %v", err)
+	}
+	if stats := diffstat.Parse(diff); len(stats) != 2 {
+		t.Fatalf("diff stats = %#v, want the two nvim files", stats)
+	}
+
+	if err := e.Apply(ctx, repo, "home", filepath.Join(home, ".config", "nvim")); err != nil {
+		t.Fatalf("Apply error = %v", err)
+	}
+	assertFile(t, filepath.Join(home, ".config", "nvim", "lua", "plugins.lua"), "return {}\n", 0o644)
+	if _, err := os.Stat(filepath.Join(home, ".zshrc")); !os.IsNotExist(err) {
+		t.Fatalf(".zshrc applied outside targets: %v", err)
+	}
+
+	if err := e.Apply(ctx, repo, "home", "/elsewhere"); err == nil {
+		t.Fatal("Apply outside home succeeded, want error")
+	}
+}
+
+func TestApplyReportsProgress(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/dot_bashrc", "same\n")
+	testutil.TempFile(t, repo, "home/dot_vimrc", "new\n")
+	testutil.TempFile(t, repo, "home/dot_zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, home, ".bashrc", "same\n")
+	testutil.TempFile(t, home, ".zshrc", "export EDITOR=nano\n")
+
+	e := New(home, ModeCopy)
+	var got []string
+	e.Progress = func(p chez.FileProgress) {
+		got = append(got, fmt.Sprintf("%d/%d %s %s", p.Done, p.Total, p.Action, p.Path))
+	}
+	if err := e.Apply(ctx, repo, "home"); err != nil {
+		t.Fatalf("Apply error = %v", err)
+	}
+	want := "1/3 skipped .bashrc,2/3 created .vimrc,3/3 modified .zshrc"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("progress = %q, want %q", got, want)
+	}
+}
+
+func TestReAddCopiesEditsBackExceptTemplates(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/dot_zshrc", "old\n")
+	testutil.TempFile(t, repo, "home/dot_profile.tmpl", "static\n")
+	testutil.TempFile(t, home, ".zshrc", "new\n")
+	testutil.TempFile(t, home, ".profile", "edited\n")
+
+	e := New(home, ModeCopy)
+	if err := e.ReAdd(ctx, repo, "home"); err != nil {
+		t.Fatalf("ReAdd error = %v", err)
+	}
+	assertFile(t, filepath.Join(repo, "home", "dot_zshrc"), "new\n", 0o644)
+	assertFile(t, filepath.Join(repo, "home", "dot_profile.tmpl"), "static\n", 0o644)
+}
+
+func TestReAddLimitsToTargets(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/dot_zshrc", "old\n")
+	testutil.TempFile(t, repo, "home/dot_config/nvim/init.lua", "old\n")
+	testutil.TempFile(t, home, ".zshrc", "new\n")
+	testutil.TempFile(t, home, ".config/nvim/init.lua", "new\n")
+
+	e := New(home, ModeCopy)
+	if err := e.ReAdd(ctx, repo, "home", filepath.Join(home, ".config", "nvim")); err != nil {
+		t.Fatalf("ReAdd error = %v", err)
+	}
+	assertFile(t, filepath.Join(repo, "home", "dot_config", "nvim", "init.lua"), "new\n", 0o644)
+	assertFile(t, filepath.Join(repo, "home", "dot_zshrc"), "old\n", 0o644)
+}
+
+func TestReAddCapturesModeOnlyChanges(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/bin/run", "#!/bin/sh\n")
+	script := testutil.TempFile(t, home, "bin/run", "#!/bin/sh\n")
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	e := New(home, ModeCopy)
+	diff, err := e.Diff(ctx, repo, "home")
+	if err != nil {
+		t.Fatalf("Diff error = %v", err)
+	}
+	if stats := diffstat.Parse(diff); len(stats) != 1 || !stats[0].ModeChanged() {
+		t.Fatalf("diff stats = %#v\n%s", stats, diff)
+	}
+
+	if err := e.ReAdd(ctx, repo, "home"); err != nil {
+		t.Fatalf("ReAdd error = %v", err)
+	}
+	assertFile(t, filepath.Join(repo, "home", "bin", "executable_run"), "#!/bin/sh\n", 0o644)
+	if diff, err := e.Diff(ctx, repo, "home"); err != nil || diff != "" {
+		t.Fatalf("diff after re-add = %q, %v", diff, err)
+	}
+}
+
+func TestSymlinkModeLinksFilesAndCopiesTemplates(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/dot_vimrc", "set nu\n")
+	testutil.TempFile(t, repo, "home/dot_hostrc.tmpl", "{{ \"rendered\" }}\n")
+	testutil.TempFile(t, home, ".vimrc", "local copy\n")
+
+	e := New(home, ModeSymlink)
+	if err := e.Apply(ctx, repo, "home"); err != nil {
+		t.Fatalf("Apply error = %v", err)
+	}
+	link, err := os.Readlink(filepath.Join(home, ".vimrc"))
+	if err != nil || link != filepath.Join(repo, "home", "dot_vimrc") {
+		t.Fatalf("link = %q, %v", link, err)
+	}
+	assertFile(t, filepath.Join(home, ".hostrc"), "rendered\n", 0o644)
+	if diff, err := e.Diff(ctx, repo, "home"); err != nil || diff != "" {
+		t.Fatalf("diff after apply = %q, %v", diff, err)
+	}
+
+	state, err := e.TargetState(ctx, repo, "home")
+	if err != nil {
+		t.Fatalf("TargetState error = %v", err)
+	}
+	if len(state) != 2 || state[0].Type != chez.TargetFile || string(state[0].Contents) != "rendered\n" ||
+		state[1].Type != chez.TargetSymlink || string(state[1].Contents) != filepath.Join(repo, "home", "dot_vimrc") {
+		t.Fatalf("target state = %+v", state)
+	}
+}
+
+func TestAddUsesChezmoiNames(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/private_dot_ssh/config", "Host *\n")
+	key := testutil.TempFile(t, home, ".ssh/known_hosts", "github.com ssh-ed25519 AAAA\n")
+	if err := os.Chmod(key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	script := testutil.TempFile(t, home, "bin/run", "#!/bin/sh\n")
+	if err := os.Chmod(script, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	empty := testutil.TempFile(t, home, ".hushlogin", "")
+
+	e := New(home, ModeCopy)
+	if err := e.Add(ctx, repo, "home", []string{key, script, empty}, "error"); err != nil {
+		t.Fatalf("Add error = %v", err)
+	}
+	for _, want := range []string{
+		"home/private_dot_ssh/private_known_hosts",
+		"home/bin/executable_run",
+		"home/empty_dot_hushlogin",
+	} {
+		if _, err := os.Stat(filepath.Join(repo, want)); err != nil {
+			t.Errorf("missing %s: %v", want, err)
+		}
+	}
+	managed, _ := e.Managed(ctx, repo, "home")
+	if strings.Join(managed, ",") != ".hushlogin,.ssh/config,.ssh/known_hosts,bin/run" {
+		t.Fatalf("managed after add = %v", managed)
+	}
+	src, err := e.SourcePath(ctx, repo, "home", script)
+	if err != nil || src != filepath.Join(repo, "home", "bin", "executable_run") {
+		t.Fatalf("SourcePath = %q, %v", src, err)
+	}
+}
+
+func TestAddWithAttributesForcesPrivateReadonly(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	file := testutil.TempFile(t, home, ".netrc", "machine example.com\n")
+
+	e := New(home, ModeCopy)
+	if err := e.AddWithAttributes(ctx, repo, "home", []string{file}, "error", chez.Attributes{Private: true, ReadOnly: true}); err != nil {
+		t.Fatalf("AddWithAttributes error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "home", "private_readonly_dot_netrc")); err != nil {
+		t.Fatalf("missing private_readonly_dot_netrc: %v", err)
+	}
+	if err := e.AddWithAttributes(ctx, repo, "home", []string{file}, "error", chez.Attributes{Create: true}); err == nil {
+		t.Fatal("AddWithAttributes with create should fail on the native engine")
+	}
+}
+
+func TestUnsupportedAttributeFails(t *testing.T) {
+	repo := testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/run_once_install.sh", "echo hi\n")
+
+	_, err := New(testutil.TempDir(t), ModeCopy).Managed(context.Background(), repo, "home")
+	if err == nil || !strings.Contains(err.Error(), `"run"`) {
+		t.Fatalf("Managed error = %v, want unsupported run attribute", err)
+	}
+}
+
+func TestDiffLinesFollowsCommonSubsequence(t *testing.T) {
+	got := strings.Join(diffLines([]string{"a", "b", "c"}, []string{"a", "x", "c"}), "|")
+	if got != " a|-b|+x| c" {
+		t.Fatalf("diffLines = %q", got)
+	}
+}
+
+func assertFile(t *testing.T, path, content string, perm os.FileMode) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil || string(b) != content {
+		t.Fatalf("%s = %q, %v; want %q", path, b, err, content)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != perm {
+		t.Fatalf("%s mode = %v, want %v", path, info.Mode().Perm(), perm)
+	}
+}
+
+func TestForgetRemovesSourcesAndLeavesHome(t *testing.T) {
+	ctx := context.Background()
+	repo, home := testutil.TempDir(t), testutil.TempDir(t)
+	testutil.TempFile(t, repo, "home/dot_zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, repo, "home/dot_config/nvim/init.lua", "-- nvim\n")
+	testutil.TempFile(t, repo, "home/dot_config/nvim/lua/plugins.lua", "return {}\n")
+	testutil.TempFile(t, repo, "home/dot_config/git/config", "[core]\n")
+	testutil.TempFile(t, home, ".zshrc", "export EDITOR=vim\n")
+
+	e := New(home, ModeCopy)
+	if err := e.Forget(ctx, repo, "home", filepath.Join(home, ".zshrc"), ".config/nvim"); err != nil {
+		t.Fatalf("Forget error = %v", err)
+	}
+	managed, err := e.Managed(ctx, repo, "home")
+	if err != nil || strings.Join(managed, ",") != ".config/git/config" {
+		t.Fatalf("managed = %v, %v", managed, err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "home", "dot_config", "nvim")); !os.IsNotExist(err) {
+		t.Fatalf("empty source dir left behind: %v", err)
+	}
+	assertFile(t, filepath.Join(home, ".zshrc"), "export EDITOR=vim\n", 0o644)
+
+	if err := e.Forget(ctx, repo, "home", ".bashrc"); err == nil || !strings.Contains(err.Error(), "not managed") {
+		t.Fatalf("Forget unmanaged error = %v", err)
+	}
+}
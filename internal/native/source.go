@@ -0,0 +1,263 @@
+package native
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// entry is one managed file parsed from a chezmoi-style source name.
+type entry struct {
+	// Source is the absolute path of the source file.
+	Source string
+	// Target is the slash-separated path relative to home.
+	Target   string
+	Perm     fs.FileMode
+	Template bool
+	Empty    bool
+	// PrivateDirs lists target directories (relative to home) that carry
+	// the private_ attribute.
+	PrivateDirs []string
+}
+
+// unsupportedPrefixes are chezmoi source attributes the native engine does
+// not implement; hitting one is an error rather than a silent misapply.
+var unsupportedPrefixes = []string{"create_", "modify_", "remove_", "run_", "symlink_", "encrypted_", "exact_", "external_"}
+
+// readSource walks root and returns the managed entries sorted by target.
+// Names starting with "." (.git, .chezmoiignore, ...) are skipped, like
+// chezmoi does.
+func readSource(root string) ([]entry, error) {
+	var entries []entry
+	privateDirs := map[string]bool{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		targetParts := make([]string, len(parts))
+		for i, part := range parts[:len(parts)-1] {
+			name, private, err := parseDirName(part)
+			if err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+			targetParts[i] = name
+			if private {
+				privateDirs[path.Join(targetParts[:i+1]...)] = true
+			}
+		}
+		last := parts[len(parts)-1]
+		if d.IsDir() {
+			name, private, err := parseDirName(last)
+			if err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+			targetParts[len(parts)-1] = name
+			if private {
+				privateDirs[path.Join(targetParts...)] = true
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		e, err := parseFileName(last)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		targetParts[len(parts)-1] = e.Target
+		e.Source = p
+		e.Target = path.Join(targetParts...)
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		for dir := path.Dir(entries[i].Target); dir != "."; dir = path.Dir(dir) {
+			if privateDirs[dir] {
+				entries[i].PrivateDirs = append(entries[i].PrivateDirs, dir)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Target < entries[j].Target })
+	return entries, nil
+}
+
+func parseDirName(name string) (target string, private bool, err error) {
+	if err := checkSupported(name); err != nil {
+		return "", false, err
+	}
+	if rest, ok := strings.CutPrefix(name, "private_"); ok {
+		name, private = rest, true
+	}
+	name = strings.TrimPrefix(name, "readonly_")
+	return applyDot(name), private, nil
+}
+
+func parseFileName(name string) (entry, error) {
+	e := entry{Perm: 0o644}
+	if rest, ok := strings.CutSuffix(name, ".literal"); ok {
+		name = rest
+	} else if rest, ok := strings.CutSuffix(name, ".tmpl"); ok {
+		name, e.Template = rest, true
+	}
+	if err := checkSupported(name); err != nil {
+		return e, err
+	}
+	if rest, ok := strings.CutPrefix(name, "literal_"); ok {
+		e.Target = rest
+		return e, nil
+	}
+	if rest, ok := strings.CutPrefix(name, "private_"); ok {
+		name, e.Perm = rest, e.Perm&^0o077
+	}
+	if rest, ok := strings.CutPrefix(name, "readonly_"); ok {
+		name, e.Perm = rest, e.Perm&^0o222
+	}
+	if rest, ok := strings.CutPrefix(name, "empty_"); ok {
+		name, e.Empty = rest, true
+	}
+	if rest, ok := strings.CutPrefix(name, "executable_"); ok {
+		name, e.Perm = rest, e.Perm|(e.Perm&0o444)>>2
+	}
+	e.Target = applyDot(name)
+	return e, nil
+}
+
+func applyDot(name string) string {
+	if rest, ok := strings.CutPrefix(name, "dot_"); ok {
+		return "." + rest
+	}
+	if rest, ok := strings.CutPrefix(name, "literal_"); ok {
+		return rest
+	}
+	return name
+}
+
+func checkSupported(name string) error {
+	for _, prefix := range unsupportedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("source attribute %q is not supported by the native engine", strings.TrimSuffix(prefix, "_"))
+		}
+	}
+	return nil
+}
+
+// sourceName returns the chezmoi-style source name for a target file or
+// directory name with the given permissions. empty marks a zero-length file
+// that should still exist.
+func sourceName(name string, perm fs.FileMode, dir, empty bool) string {
+	prefix := ""
+	if perm&0o077 == 0 {
+		prefix += "private_"
+	}
+	if !dir && perm&0o222 == 0 {
+		prefix += "readonly_"
+	}
+	if !dir && empty {
+		prefix += "empty_"
+	}
+	if !dir && perm&0o111 != 0 {
+		prefix += "executable_"
+	}
+	if rest, ok := strings.CutPrefix(name, "."); ok {
+		return prefix + "dot_" + rest
+	}
+	for _, attr := range append([]string{"dot_", "private_", "readonly_", "empty_", "executable_", "literal_"}, unsupportedPrefixes...) {
+		if strings.HasPrefix(name, attr) {
+			return prefix + "literal_" + name
+		}
+	}
+	if strings.HasSuffix(name, ".tmpl") || strings.HasSuffix(name, ".literal") {
+		return prefix + name + ".literal"
+	}
+	return prefix + name
+}
+
+// sourceDirFor finds or creates the source directory holding targetDir,
+// reusing existing entries such as private_dot_ssh for .ssh.
+func sourceDirFor(root, home, targetDir string) (string, error) {
+	dir := root
+	if targetDir == "." || targetDir == "" {
+		return dir, nil
+	}
+	targetPath := home
+	for _, part := range strings.Split(targetDir, "/") {
+		targetPath = filepath.Join(targetPath, part)
+		existing, err := findSourceDir(dir, part)
+		if err != nil {
+			return "", err
+		}
+		if existing == "" {
+			perm := fs.FileMode(0o755)
+			if info, err := os.Stat(targetPath); err == nil {
+				perm = info.Mode().Perm()
+			}
+			existing = sourceName(part, perm, true, false)
+			if err := os.MkdirAll(filepath.Join(dir, existing), 0o755); err != nil {
+				return "", err
+			}
+		}
+		dir = filepath.Join(dir, existing)
+	}
+	return dir, nil
+}
+
+// SourceDirPath returns the source directory for the target directory rel
+// (slash-separated, relative to home) under root. Existing entries are
+// reused and missing parents are created; the directory itself is not, so
+// callers can tell whether it is already part of the source state.
+func SourceDirPath(root, home, rel string) (string, error) {
+	parent, err := sourceDirFor(root, home, path.Dir(rel))
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(rel)
+	existing, err := findSourceDir(parent, name)
+	if err != nil {
+		return "", err
+	}
+	if existing == "" {
+		perm := fs.FileMode(0o755)
+		if info, err := os.Stat(filepath.Join(home, filepath.FromSlash(rel))); err == nil {
+			perm = info.Mode().Perm()
+		}
+		existing = sourceName(name, perm, true, false)
+	}
+	return filepath.Join(parent, existing), nil
+}
+
+func findSourceDir(dir, target string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if name, _, err := parseDirName(e.Name()); err == nil && name == target {
+			return e.Name(), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,175 @@
+package packages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/platform"
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+// InstallPlan is what installing from one manager's manifest would do.
+type InstallPlan struct {
+	Manager string `json:"manager"`
+	// Path is the manifest, relative to the repo root.
+	Path string `json:"path"`
+	// Install lists the manifest entries this machine does not have.
+	Install []string `json:"install"`
+	// Skipped lists entries that cannot be installed on this platform,
+	// such as Homebrew casks outside macOS.
+	Skipped []string `json:"skipped,omitempty"`
+	// Missing is set when the manager is not installed; nothing can be.
+	Missing bool `json:"missing,omitempty"`
+	// Commands are the commands Install would run, set by PlanCommands.
+	Commands []string `json:"commands,omitempty"`
+}
+
+// Captured returns the managers supported on this platform that have a
+// manifest in the repo, in name order.
+func (c *Manifests) Captured() []Manager {
+	var out []Manager
+	for _, m := range managers {
+		if !m.Supported(c.Platform) {
+			continue
+		}
+		if _, err := os.Stat(c.manifestFile(m)); err == nil {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Listed returns the packages in m's manifest, or none when it has none.
+func (c *Manifests) Listed(m Manager) ([]string, error) {
+	b, err := os.ReadFile(c.manifestFile(m))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s manifest: %w", m.Name, err)
+	}
+	return lines(string(b)), nil
+}
+
+// Plan compares m's manifest with what m reports installed. A missing
+// manifest plans nothing.
+func (c *Manifests) Plan(ctx context.Context, m Manager) (InstallPlan, error) {
+	plan := InstallPlan{Manager: m.Name, Path: ManifestPath(m.Name), Install: []string{}}
+	b, err := os.ReadFile(c.manifestFile(m))
+	if errors.Is(err, os.ErrNotExist) {
+		return plan, nil
+	}
+	if err != nil {
+		return plan, fmt.Errorf("read %s manifest: %w", m.Name, err)
+	}
+	if !c.installed(m) {
+		plan.Missing = true
+		return plan, nil
+	}
+	current, err := m.list(ctx, c.Runner)
+	if err != nil {
+		return plan, fmt.Errorf("list %s packages: %w", m.Name, err)
+	}
+	have := map[string]bool{}
+	for _, pkg := range current {
+		have[pkg] = true
+	}
+	for _, pkg := range lines(string(b)) {
+		switch {
+		case have[pkg]:
+		case strings.HasPrefix(pkg, brewCaskPrefix) && c.Platform.OS != platform.Darwin:
+			plan.Skipped = append(plan.Skipped, pkg)
+		default:
+			plan.Install = append(plan.Install, pkg)
+		}
+	}
+	return plan, nil
+}
+
+// Install installs plan's packages with m.
+func (c *Manifests) Install(ctx context.Context, m Manager, plan InstallPlan) error {
+	if plan.Missing || len(plan.Install) == 0 {
+		return nil
+	}
+	if err := m.install(ctx, c.Runner, plan.Install); err != nil {
+		return fmt.Errorf("install %s packages: %w", m.Name, err)
+	}
+	return nil
+}
+
+// PlanCommands sets plan.Commands to the commands Install would run,
+// without running them.
+func (c *Manifests) PlanCommands(ctx context.Context, m Manager, plan *InstallPlan) error {
+	rec := &runner.PlanRunner{}
+	dry := *c
+	dry.Runner = rec
+	if err := dry.Install(ctx, m, *plan); err != nil {
+		return err
+	}
+	plan.Commands = nil
+	for _, p := range rec.Planned() {
+		plan.Commands = append(plan.Commands, p.String())
+	}
+	return nil
+}
+
+func (c *Manifests) manifestFile(m Manager) string {
+	return filepath.Join(c.RepoRoot, filepath.FromSlash(ManifestPath(m.Name)))
+}
+
+// needsSudo reports whether system package managers must run through sudo.
+var needsSudo = func() bool { return os.Geteuid() != 0 }
+
+// installAll installs every package with one name args... pkgs command,
+// through sudo when root is set and dot is not already root.
+func installAll(root bool, name string, args ...string) func(context.Context, runner.Runner, []string) error {
+	return func(ctx context.Context, r runner.Runner, pkgs []string) error {
+		argv := append(append([]string{name}, args...), pkgs...)
+		if root && needsSudo() {
+			argv = append([]string{"sudo"}, argv...)
+		}
+		_, err := r.Run(ctx, "", argv[0], argv[1:]...)
+		return err
+	}
+}
+
+const brewCaskPrefix = "--cask "
+
+// installBrew installs formulae and casks with one brew install each.
+func installBrew(ctx context.Context, r runner.Runner, pkgs []string) error {
+	var formulae, casks []string
+	for _, pkg := range pkgs {
+		if cask, ok := strings.CutPrefix(pkg, brewCaskPrefix); ok {
+			casks = append(casks, cask)
+		} else {
+			formulae = append(formulae, pkg)
+		}
+	}
+	if len(formulae) > 0 {
+		if _, err := r.Run(ctx, "", "brew", append([]string{"install"}, formulae...)...); err != nil {
+			return err
+		}
+	}
+	if len(casks) > 0 {
+		if _, err := r.Run(ctx, "", "brew", append([]string{"install", "--cask"}, casks...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installWinget installs one identifier at a time, since winget install
+// takes a single package.
+func installWinget(ctx context.Context, r runner.Runner, pkgs []string) error {
+	for _, id := range pkgs {
+		if _, err := r.Run(ctx, "", "winget", "install", "--id", id, "--exact", "--silent",
+			"--accept-package-agreements", "--accept-source-agreements", "--disable-interactivity"); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+	}
+	return nil
+}
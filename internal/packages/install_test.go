@@ -0,0 +1,91 @@
+package packages
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/platform"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestPlanInstallsOnlyMissingPackages(t *testing.T) {
+	repo := testutil.TempDir(t)
+	testutil.TempFile(t, repo, "state/packages/brew.txt", "--cask iterm2\ngit\nripgrep\n")
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("brew", "leaves", "--installed-on-request"), "git\n")
+	mock.OnCommandSuccess(testutil.MatchExact("brew", "list", "--cask", "-1"), "")
+	mock.OnCommandSuccess(testutil.MatchExact("brew", "install", "ripgrep"), "")
+	c := &Manifests{Runner: mock, Platform: &platform.Platform{OS: platform.Linux}, RepoRoot: repo, LookPath: found}
+	brew, _ := Lookup("brew")
+
+	plan, err := c.Plan(context.Background(), brew)
+	if err != nil {
+		t.Fatalf("Plan error = %v", err)
+	}
+	if !slices.Equal(plan.Install, []string{"ripgrep"}) || !slices.Equal(plan.Skipped, []string{"--cask iterm2"}) {
+		t.Fatalf("plan = %#v", plan)
+	}
+	if err := c.Install(context.Background(), brew, plan); err != nil {
+		t.Fatalf("Install error = %v", err)
+	}
+	mock.AssertNotCalled(testutil.MatchCommandPrefix("brew", "install", "--cask"))
+
+	if listed, err := c.Listed(brew); err != nil || !slices.Equal(listed, []string{"--cask iterm2", "git", "ripgrep"}) {
+		t.Errorf("Listed() = %v, %v", listed, err)
+	}
+	apt, _ := Lookup("apt")
+	if listed, err := c.Listed(apt); err != nil || listed != nil {
+		t.Errorf("Listed(no manifest) = %v, %v", listed, err)
+	}
+}
+
+func TestInstallRunsSystemManagersThroughSudo(t *testing.T) {
+	orig := needsSudo
+	needsSudo = func() bool { return true }
+	t.Cleanup(func() { needsSudo = orig })
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("sudo", "apt-get", "install", "-y", "jq", "tmux"), "")
+	c := &Manifests{Runner: mock, Platform: &platform.Platform{OS: platform.Linux}, LookPath: found}
+	apt, _ := Lookup("apt")
+	if err := c.Install(context.Background(), apt, InstallPlan{Manager: "apt", Install: []string{"jq", "tmux"}}); err != nil {
+		t.Fatalf("Install error = %v", err)
+	}
+}
+
+func TestPlanCommandsListsInstallsWithoutRunningThem(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	c := &Manifests{Runner: mock, Platform: &platform.Platform{OS: platform.Darwin}, LookPath: found}
+	brew, _ := Lookup("brew")
+	plan := InstallPlan{Manager: "brew", Install: []string{"ripgrep", "--cask iterm2"}}
+	if err := c.PlanCommands(context.Background(), brew, &plan); err != nil {
+		t.Fatalf("PlanCommands error = %v", err)
+	}
+	if want := []string{"brew install ripgrep", "brew install --cask iterm2"}; !slices.Equal(plan.Commands, want) {
+		t.Fatalf("Commands = %q, want %q", plan.Commands, want)
+	}
+	mock.AssertNotCalled(testutil.MatchCommandPrefix("brew"))
+}
+
+func TestModulesInstallFromCapturedManifestsWhenEnabled(t *testing.T) {
+	repo := testutil.TempDir(t)
+	testutil.TempDotToml(t, repo, testutil.MinimalDotToml())
+	cfg, err := config.Load(repo + "/dot.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.TempFile(t, cfg.RepoRoot(), "state/packages/flatpak.txt", "org.gimp.GIMP\n")
+	testutil.TempFile(t, cfg.RepoRoot(), "state/packages/winget.txt", "Git.Git\n")
+	plat := &platform.Platform{OS: platform.Linux}
+
+	if mods := Modules(cfg, plat, testutil.NewMockRunner(t)); len(mods) != 0 {
+		t.Fatalf("modules without install_packages = %v", mods)
+	}
+	cfg.Apply.InstallPackages = true
+	mods := Modules(cfg, plat, testutil.NewMockRunner(t))
+	if len(mods) != 1 || mods[0].Surface() != "export:packages/flatpak" {
+		t.Fatalf("modules = %v", mods)
+	}
+}
@@ -0,0 +1,104 @@
+package packages
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/exporters"
+	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/platform"
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+// exporter runs one manager through the exporter module adapter, so dot
+// capture, dot apply, and dot sync report it under export:packages/<name>.
+type exporter struct {
+	manager   Manager
+	manifests *Manifests
+	// capture and install say which halves [packages] and [apply]
+	// install_packages switched on.
+	capture, install bool
+}
+
+func (e *exporter) Name() string                        { return "packages/" + e.manager.Name }
+func (e *exporter) Supported(p *platform.Platform) bool { return e.manager.Supported(p) }
+
+func (e *exporter) Capture(ctx context.Context) (exporters.Result, error) {
+	if !e.capture {
+		return exporters.Result{Message: "capture is not enabled in [packages]"}, nil
+	}
+	res, err := e.manifests.Capture(ctx, e.manager)
+	if err != nil {
+		return exporters.Result{}, err
+	}
+	out := exporters.Result{Changed: res.Changed, Paths: []string{res.Path}}
+	if res.Missing {
+		out.Paths = nil
+		out.Message = e.manager.Bin + " is not installed"
+	}
+	return out, nil
+}
+
+// CaptureChanged reports whether Capture would rewrite the manifest.
+func (e *exporter) CaptureChanged(ctx context.Context) (bool, error) {
+	if !e.capture {
+		return false, nil
+	}
+	return e.manifests.CaptureChanged(ctx, e.manager)
+}
+
+// Apply installs the manifest's missing packages when [apply]
+// install_packages is set.
+func (e *exporter) Apply(ctx context.Context) (exporters.Result, error) {
+	if !e.install {
+		return exporters.Result{Message: "package installs are not enabled; set [apply] install_packages"}, nil
+	}
+	plan, err := e.manifests.Plan(ctx, e.manager)
+	if err != nil {
+		return exporters.Result{}, err
+	}
+	if plan.Missing {
+		return exporters.Result{Message: e.manager.Bin + " is not installed"}, nil
+	}
+	if err := e.manifests.Install(ctx, e.manager, plan); err != nil {
+		return exporters.Result{}, err
+	}
+	out := exporters.Result{Changed: len(plan.Install) > 0}
+	if out.Changed {
+		out.Message = fmt.Sprintf("installed %s", strings.Join(plan.Install, ", "))
+	}
+	return out, nil
+}
+
+// module runs a manager in the packages apply step.
+type module struct{ *exporters.Module }
+
+func (module) ApplyStep() string { return config.ApplyStepPackages }
+
+// Modules wraps, as orchestrator modules, every manager for plat that is
+// enabled in [packages] and, with [apply] install_packages, every one with
+// a manifest to install from.
+func Modules(cfg *config.Config, plat *platform.Platform, r runner.Runner) []modules.Module {
+	c := NewManifests(cfg, plat, r)
+	exps := map[string]*exporter{}
+	for _, m := range c.Enabled(cfg) {
+		exps[m.Name] = &exporter{manager: m, manifests: c, capture: true}
+	}
+	if cfg.Apply.InstallPackages {
+		for _, m := range c.Captured() {
+			if exps[m.Name] == nil {
+				exps[m.Name] = &exporter{manager: m, manifests: c}
+			}
+			exps[m.Name].install = true
+		}
+	}
+	var mods []modules.Module
+	for _, name := range Names() {
+		if exp := exps[name]; exp != nil {
+			mods = append(mods, module{exporters.NewModule(exp)})
+		}
+	}
+	return mods
+}
@@ -0,0 +1,360 @@
+// Package packages captures the packages installed through each detected
+// package manager into sorted manifests under state/packages, one file per
+// manager, so a machine's software list is versioned alongside its
+// dotfiles, and installs what a manifest lists but a machine lacks.
+package packages
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/platform"
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+// Manager describes how to list the packages one package manager
+// installed on request, leaving out dependencies where it can tell.
+type Manager struct {
+	Name string
+	// Bin is the executable whose presence on PATH means the manager is
+	// installed.
+	Bin string
+	OS  []platform.OS
+	// list returns the manifest lines, in any order.
+	list func(ctx context.Context, r runner.Runner) ([]string, error)
+	// install installs manifest lines.
+	install func(ctx context.Context, r runner.Runner, pkgs []string) error
+}
+
+// Supported reports whether the manager runs on p.
+func (m Manager) Supported(p *platform.Platform) bool {
+	return p != nil && slices.Contains(m.OS, p.OS)
+}
+
+var (
+	linux   = []platform.OS{platform.Linux}
+	windows = []platform.OS{platform.Windows}
+)
+
+var managers = []Manager{
+	{Name: "apt", Bin: "apt-mark", OS: linux,
+		list:    command("apt-mark", "showmanual"),
+		install: installAll(true, "apt-get", "install", "-y")},
+	{Name: "brew", Bin: "brew", OS: []platform.OS{platform.Darwin, platform.Linux},
+		list:    listBrew,
+		install: installBrew},
+	{Name: "choco", Bin: "choco", OS: windows,
+		list:    listChoco,
+		install: installAll(false, "choco", "install", "-y")},
+	{Name: "dnf", Bin: "dnf", OS: linux,
+		list:    command("dnf", "repoquery", "--userinstalled", "--queryformat", `%{name}\n`),
+		install: installAll(true, "dnf", "install", "-y")},
+	{Name: "flatpak", Bin: "flatpak", OS: linux,
+		list:    command("flatpak", "list", "--app", "--columns=application"),
+		install: installAll(false, "flatpak", "install", "-y", "--noninteractive")},
+	{Name: "pacman", Bin: "pacman", OS: linux,
+		list:    command("pacman", "-Qqe"),
+		install: installAll(true, "pacman", "-S", "--needed", "--noconfirm")},
+	{Name: "scoop", Bin: "scoop", OS: windows,
+		list:    listScoop,
+		install: installAll(false, "scoop", "install")},
+	{Name: "snap", Bin: "snap", OS: linux,
+		list:    listSnap,
+		install: installAll(true, "snap", "install")},
+	{Name: "winget", Bin: "winget", OS: windows,
+		list:    listWinget,
+		install: installWinget},
+}
+
+// Names returns every known manager name in sorted order.
+func Names() []string {
+	names := make([]string, len(managers))
+	for i, m := range managers {
+		names[i] = m.Name
+	}
+	return names
+}
+
+// Lookup returns the manager called name.
+func Lookup(name string) (Manager, bool) {
+	for _, m := range managers {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Manager{}, false
+}
+
+// ValidateConfig reports [packages] keys that name no known manager.
+func ValidateConfig(cfg *config.Config) error {
+	var unknown []string
+	for name := range cfg.Packages {
+		if _, ok := Lookup(name); !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown package manager(s) in [packages]: %v (available: %v)", unknown, Names())
+}
+
+// Result describes one manager's capture.
+type Result struct {
+	Manager string `json:"manager"`
+	// Path is the manifest, relative to the repo root.
+	Path     string `json:"path"`
+	Packages int    `json:"packages"`
+	Changed  bool   `json:"changed"`
+	// Missing is set when the manager is not installed; nothing is written.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Manifests writes package manifests for one machine.
+type Manifests struct {
+	Runner   runner.Runner
+	Platform *platform.Platform
+	// RepoRoot is the repo the manifests are written into.
+	RepoRoot string
+	// LookPath finds a manager's executable, normally exec.LookPath.
+	LookPath func(file string) (string, error)
+}
+
+// NewManifests returns a Manifests writing into cfg's repo.
+func NewManifests(cfg *config.Config, plat *platform.Platform, r runner.Runner) *Manifests {
+	return &Manifests{Runner: r, Platform: plat, RepoRoot: cfg.RepoRoot(), LookPath: exec.LookPath}
+}
+
+// ManifestPath returns the repo-relative manifest path for a manager.
+func ManifestPath(name string) string {
+	return filepath.ToSlash(filepath.Join("state", "packages", name+".txt"))
+}
+
+// Detected returns the managers supported on this platform whose
+// executable is on PATH.
+func (c *Manifests) Detected() []Manager {
+	var out []Manager
+	for _, m := range managers {
+		if m.Supported(c.Platform) && c.installed(m) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Enabled returns the managers switched on in cfg's [packages] that run on
+// this platform, in name order, whether or not they are installed.
+func (c *Manifests) Enabled(cfg *config.Config) []Manager {
+	var out []Manager
+	for _, m := range managers {
+		if cfg.Packages[m.Name] && m.Supported(c.Platform) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Capture lists m's packages and writes them, sorted and deduplicated, to
+// its manifest. The file is left alone when the list is unchanged, and a
+// manager that is not installed is reported as missing rather than failing.
+func (c *Manifests) Capture(ctx context.Context, m Manager) (Result, error) {
+	res, content, err := c.render(ctx, m)
+	if err != nil || res.Missing {
+		return res, err
+	}
+	path := filepath.Join(c.RepoRoot, filepath.FromSlash(res.Path))
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, content) {
+		return res, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return res, fmt.Errorf("create packages directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return res, fmt.Errorf("write %s manifest: %w", m.Name, err)
+	}
+	res.Changed = true
+	return res, nil
+}
+
+// CaptureChanged reports whether Capture would rewrite m's manifest,
+// without writing it. A manager that is not installed changes nothing.
+func (c *Manifests) CaptureChanged(ctx context.Context, m Manager) (bool, error) {
+	res, content, err := c.render(ctx, m)
+	if err != nil || res.Missing {
+		return false, err
+	}
+	existing, err := os.ReadFile(filepath.Join(c.RepoRoot, filepath.FromSlash(res.Path)))
+	return err != nil || !bytes.Equal(existing, content), nil
+}
+
+// render lists m's packages as the content of its manifest.
+func (c *Manifests) render(ctx context.Context, m Manager) (Result, []byte, error) {
+	res := Result{Manager: m.Name, Path: ManifestPath(m.Name)}
+	if !c.installed(m) {
+		res.Missing = true
+		return res, nil, nil
+	}
+	pkgs, err := m.list(ctx, c.Runner)
+	if err != nil {
+		return res, nil, fmt.Errorf("list %s packages: %w", m.Name, err)
+	}
+	sort.Strings(pkgs)
+	pkgs = slices.Compact(pkgs)
+	res.Packages = len(pkgs)
+
+	content := []byte(strings.Join(pkgs, "\n"))
+	if len(pkgs) > 0 {
+		content = append(content, '\n')
+	}
+	return res, content, nil
+}
+
+func (c *Manifests) installed(m Manager) bool {
+	lookPath := c.LookPath
+	if lookPath == nil {
+		lookPath = exec.LookPath
+	}
+	_, err := lookPath(m.Bin)
+	return err == nil
+}
+
+// command lists packages printed one per line by name args.
+func command(name string, args ...string) func(context.Context, runner.Runner) ([]string, error) {
+	return func(ctx context.Context, r runner.Runner) ([]string, error) {
+		res, err := r.Run(ctx, "", name, args...)
+		if err != nil {
+			return nil, err
+		}
+		return lines(res.Stdout), nil
+	}
+}
+
+// listBrew lists formulae installed on request and every cask. Casks are
+// written as "--cask <name>" so each line is the argument list brew
+// install takes.
+func listBrew(ctx context.Context, r runner.Runner) ([]string, error) {
+	formulae, err := r.Run(ctx, "", "brew", "leaves", "--installed-on-request")
+	if err != nil {
+		return nil, err
+	}
+	casks, err := r.Run(ctx, "", "brew", "list", "--cask", "-1")
+	if err != nil {
+		return nil, err
+	}
+	pkgs := lines(formulae.Stdout)
+	for _, cask := range lines(casks.Stdout) {
+		pkgs = append(pkgs, brewCaskPrefix+cask)
+	}
+	return pkgs, nil
+}
+
+// listChoco parses the name|version lines of choco list --limit-output.
+func listChoco(ctx context.Context, r runner.Runner) ([]string, error) {
+	res, err := r.Run(ctx, "", "choco", "list", "--limit-output")
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []string
+	for _, line := range lines(res.Stdout) {
+		name, _, _ := strings.Cut(line, "|")
+		pkgs = append(pkgs, name)
+	}
+	return pkgs, nil
+}
+
+// listScoop reads scoop export, which prints JSON in current releases and
+// "name (v:version) [bucket]" lines in older ones.
+func listScoop(ctx context.Context, r runner.Runner) ([]string, error) {
+	res, err := r.Run(ctx, "", "scoop", "export")
+	if err != nil {
+		return nil, err
+	}
+	var export struct {
+		Apps []struct {
+			Name string `json:"Name"`
+		} `json:"apps"`
+	}
+	var pkgs []string
+	if json.Unmarshal([]byte(res.Stdout), &export) == nil {
+		for _, app := range export.Apps {
+			pkgs = append(pkgs, app.Name)
+		}
+		return pkgs, nil
+	}
+	for _, line := range lines(res.Stdout) {
+		pkgs = append(pkgs, strings.Fields(line)[0])
+	}
+	return pkgs, nil
+}
+
+// listSnap reads the Name column of snap list, skipping its header.
+func listSnap(ctx context.Context, r runner.Runner) ([]string, error) {
+	res, err := r.Run(ctx, "", "snap", "list")
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []string
+	for i, line := range lines(res.Stdout) {
+		if i == 0 && strings.HasPrefix(line, "Name") {
+			continue
+		}
+		pkgs = append(pkgs, strings.Fields(line)[0])
+	}
+	return pkgs, nil
+}
+
+// listWinget reads the package identifiers from winget export, whose table
+// output from winget list truncates long names.
+func listWinget(ctx context.Context, r runner.Runner) ([]string, error) {
+	dir, err := os.MkdirTemp("", "dotstate-winget-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "export.json")
+	if _, err := r.Run(ctx, "", "winget", "export", "--output", path, "--accept-source-agreements", "--disable-interactivity"); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read winget export: %w", err)
+	}
+	var export struct {
+		Sources []struct {
+			Packages []struct {
+				PackageIdentifier string `json:"PackageIdentifier"`
+			} `json:"Packages"`
+		} `json:"Sources"`
+	}
+	if err := json.Unmarshal(b, &export); err != nil {
+		return nil, fmt.Errorf("parse winget export: %w", err)
+	}
+	var pkgs []string
+	for _, source := range export.Sources {
+		for _, pkg := range source.Packages {
+			pkgs = append(pkgs, pkg.PackageIdentifier)
+		}
+	}
+	return pkgs, nil
+}
+
+// lines returns the non-empty trimmed lines of out.
+func lines(out string) []string {
+	var pkgs []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			pkgs = append(pkgs, line)
+		}
+	}
+	return pkgs
+}
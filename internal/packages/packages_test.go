@@ -0,0 +1,95 @@
+package packages
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/platform"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func found(string) (string, error) { return "/usr/bin/tool", nil }
+
+func TestCaptureWritesSortedManifestOnlyWhenChanged(t *testing.T) {
+	repo := testutil.TempDir(t)
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("brew", "leaves", "--installed-on-request"), "ripgrep\ngit\n\ngit\n")
+	mock.OnCommandSuccess(testutil.MatchExact("brew", "list", "--cask", "-1"), "iterm2\n")
+	c := &Manifests{Runner: mock, Platform: &platform.Platform{OS: platform.Darwin}, RepoRoot: repo, LookPath: found}
+	brew, _ := Lookup("brew")
+
+	if changed, err := c.CaptureChanged(context.Background(), brew); err != nil || !changed {
+		t.Fatalf("CaptureChanged before capture = %v, %v", changed, err)
+	}
+	res, err := c.Capture(context.Background(), brew)
+	if err != nil {
+		t.Fatalf("Capture error = %v", err)
+	}
+	if !res.Changed || res.Packages != 3 || res.Path != "state/packages/brew.txt" {
+		t.Fatalf("result = %#v", res)
+	}
+	b, err := os.ReadFile(filepath.Join(repo, "state", "packages", "brew.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != "--cask iterm2\ngit\nripgrep\n" {
+		t.Fatalf("manifest = %q", got)
+	}
+
+	res, err = c.Capture(context.Background(), brew)
+	if err != nil || res.Changed {
+		t.Fatalf("second capture = %#v, %v; want unchanged", res, err)
+	}
+	if changed, err := c.CaptureChanged(context.Background(), brew); err != nil || changed {
+		t.Fatalf("CaptureChanged after capture = %v, %v", changed, err)
+	}
+}
+
+func TestCaptureReportsMissingManager(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	c := &Manifests{Runner: mock, Platform: &platform.Platform{OS: platform.Linux}, RepoRoot: testutil.TempDir(t),
+		LookPath: func(string) (string, error) { return "", errors.New("not found") }}
+	pacman, _ := Lookup("pacman")
+
+	res, err := c.Capture(context.Background(), pacman)
+	if err != nil || !res.Missing || res.Changed {
+		t.Fatalf("Capture = %#v, %v; want missing", res, err)
+	}
+	mock.AssertNotCalled(testutil.MatchCommand("pacman"))
+}
+
+func TestTableManagersKeepOnlyNames(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("snap", "list"), "Name    Version  Rev  Tracking  Publisher  Notes\ncore22  2024     1    latest    canonical  base\nfirefox 130.0    4    latest    mozilla    -\n")
+	mock.OnCommandSuccess(testutil.MatchExact("choco", "list", "--limit-output"), "git|2.46.0\n7zip|24.8.0\n")
+
+	snap, err := listSnap(context.Background(), mock)
+	if err != nil || len(snap) != 2 || snap[0] != "core22" || snap[1] != "firefox" {
+		t.Fatalf("snap = %v, %v", snap, err)
+	}
+	choco, err := listChoco(context.Background(), mock)
+	if err != nil || len(choco) != 2 || choco[0] != "git" || choco[1] != "7zip" {
+		t.Fatalf("choco = %v, %v", choco, err)
+	}
+}
+
+func TestModulesFollowConfigAndPlatform(t *testing.T) {
+	cfg := &config.Config{Packages: map[string]bool{"apt": true, "winget": true, "pacman": false}}
+	mods := Modules(cfg, &platform.Platform{OS: platform.Linux}, testutil.NewMockRunner(t))
+	if len(mods) != 1 || mods[0].Surface() != "export:packages/apt" {
+		t.Fatalf("modules = %v", mods)
+	}
+}
+
+func TestValidateConfigRejectsUnknownManagers(t *testing.T) {
+	if err := ValidateConfig(&config.Config{Packages: map[string]bool{"brew": true, "npm": true}}); err == nil {
+		t.Fatal("expected npm to be rejected")
+	}
+	if err := ValidateConfig(&config.Config{Packages: map[string]bool{"brew": true}}); err != nil {
+		t.Fatalf("ValidateConfig error = %v", err)
+	}
+}
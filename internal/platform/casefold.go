@@ -0,0 +1,41 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// CaseInsensitive reports whether names in dir are matched without regard
+// to case, as on default macOS and Windows volumes. It looks up an entry of
+// dir under its case-swapped name; when dir has no entry to try it falls
+// back to the platform default.
+func CaseInsensitive(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err == nil {
+		for _, entry := range entries {
+			swapped := swapCase(entry.Name())
+			if swapped == entry.Name() {
+				continue
+			}
+			info, err := os.Lstat(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			other, err := os.Lstat(filepath.Join(dir, swapped))
+			return err == nil && os.SameFile(info, other)
+		}
+	}
+	return runtime.GOOS == string(Darwin) || runtime.GOOS == string(Windows)
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
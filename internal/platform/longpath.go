@@ -0,0 +1,69 @@
+package platform
+
+import (
+	"runtime"
+	"strings"
+)
+
+// MaxPath is the Windows MAX_PATH limit, in characters, including the
+// terminating NUL. Longer paths need the \\?\ prefix for Win32 APIs.
+const MaxPath = 260
+
+const (
+	longPathPrefix    = `\\?\`
+	longUNCPathPrefix = `\\?\UNC\`
+)
+
+// reservedNames are the Windows device names no file may be opened as, in
+// any directory and with any extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// LongPath returns path in extended-length form (\\?\C:\... or
+// \\?\UNC\server\share\...) on Windows, so deep trees such as AppData can
+// be walked past MAX_PATH. Relative and already-prefixed paths, and every
+// path on other systems, are returned unchanged.
+func LongPath(path string) string {
+	if runtime.GOOS != string(Windows) {
+		return path
+	}
+	return longPath(path)
+}
+
+func longPath(path string) string {
+	path = strings.ReplaceAll(path, "/", `\`)
+	switch {
+	case strings.HasPrefix(path, longPathPrefix):
+		return path
+	case strings.HasPrefix(path, `\\`):
+		return longUNCPathPrefix + path[2:]
+	case len(path) >= 3 && path[1] == ':' && path[2] == '\\':
+		return longPathPrefix + path
+	}
+	return path
+}
+
+// StripLongPath removes an extended-length prefix added by LongPath.
+func StripLongPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, longUNCPathPrefix); ok {
+		return `\\` + rest
+	}
+	return strings.TrimPrefix(path, longPathPrefix)
+}
+
+// IsReservedName reports whether name is a Windows device name such as
+// CON, NUL, or COM1, with or without an extension ("nul.txt"). Windows
+// ignores trailing dots and spaces, so "aux. " is reserved too. Opening
+// such a file opens the device instead.
+func IsReservedName(name string) bool {
+	name = strings.TrimRight(name, ". ")
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	return reservedNames[strings.ToUpper(strings.TrimRight(name, " "))]
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 )
@@ -179,6 +180,44 @@ func (p *Platform) ExpandPath(path string) string {
 	return filepath.Clean(path)
 }
 
+// placeholderPattern matches {name} placeholders in config values.
+var placeholderPattern = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// Placeholders returns the values {name} placeholders expand to, so one
+// committed config can name platform directories on every OS.
+func (p *Platform) Placeholders() map[string]string {
+	return map[string]string{
+		"home":      p.Home,
+		"configdir": p.ConfigDir,
+		"datadir":   p.DataDir,
+		"cachedir":  p.CacheDir,
+		"statedir":  p.StateDir,
+		"os":        string(p.OS),
+		"arch":      p.Arch,
+	}
+}
+
+// ExpandPlaceholders replaces {home}, {configdir}, {datadir}, {cachedir},
+// {statedir}, {os}, and {arch} in s. Unknown placeholders are an error so
+// typos do not silently become literal directory names.
+func (p *Platform) ExpandPlaceholders(s string) (string, error) {
+	values := p.Placeholders()
+	var unknown []string
+	out := placeholderPattern.ReplaceAllStringFunc(s, func(m string) string {
+		name := m[1 : len(m)-1]
+		value, ok := values[name]
+		if !ok {
+			unknown = append(unknown, m)
+			return m
+		}
+		return value
+	})
+	if len(unknown) > 0 {
+		return s, fmt.Errorf("unknown placeholder %s (known: {home}, {configdir}, {datadir}, {cachedir}, {statedir}, {os}, {arch})", strings.Join(unknown, ", "))
+	}
+	return out, nil
+}
+
 // NormalizePath converts a path to the native format for the current OS.
 func (p *Platform) NormalizePath(path string) string {
 	// Convert forward slashes to backslashes on Windows
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -304,3 +305,73 @@ func containsString(s, substr string) bool {
 	}
 	return false
 }
+
+func TestExpandPlaceholders(t *testing.T) {
+	p := &Platform{OS: Windows, Arch: "amd64", Home: `C:\Users\u`, ConfigDir: `C:\Users\u\AppData\Roaming`}
+
+	got, err := p.ExpandPlaceholders("{configdir}/dotstate-{os}-{arch}")
+	if err != nil {
+		t.Fatalf("ExpandPlaceholders() error = %v", err)
+	}
+	if want := `C:\Users\u\AppData\Roaming/dotstate-windows-amd64`; got != want {
+		t.Errorf("ExpandPlaceholders() = %q, want %q", got, want)
+	}
+	if got, err := p.ExpandPlaceholders("no placeholders {A}"); err != nil || got != "no placeholders {A}" {
+		t.Errorf("ExpandPlaceholders() = %q, %v; want input unchanged", got, err)
+	}
+	if _, err := p.ExpandPlaceholders("{home}/{nope}"); err == nil {
+		t.Error("ExpandPlaceholders() expected unknown placeholder error")
+	}
+}
+
+func TestLongPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`C:\Users\me\AppData\Local`, `\\?\C:\Users\me\AppData\Local`},
+		{`C:/Users/me/AppData`, `\\?\C:\Users\me\AppData`},
+		{`\\server\share\dir`, `\\?\UNC\server\share\dir`},
+		{`\\?\C:\already`, `\\?\C:\already`},
+		{`relative\dir`, `relative\dir`},
+	}
+	for _, tt := range tests {
+		got := longPath(tt.path)
+		if got != tt.want {
+			t.Errorf("longPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+		if tt.path != got && StripLongPath(got) != strings.ReplaceAll(tt.path, "/", `\`) {
+			t.Errorf("StripLongPath(%q) = %q, want %q", got, StripLongPath(got), tt.path)
+		}
+	}
+	if runtime.GOOS != "windows" && LongPath(`C:\x`) != `C:\x` {
+		t.Error("LongPath() changed a path on a non-Windows system")
+	}
+}
+
+func TestIsReservedName(t *testing.T) {
+	for _, name := range []string{"CON", "nul", "aux.txt", "Com1", "lpt9.log", "prn. ", "con.tar.gz"} {
+		if !IsReservedName(name) {
+			t.Errorf("IsReservedName(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"console", "com10", "lpt0", "nullable.txt", ".con", "config"} {
+		if IsReservedName(name) {
+			t.Errorf("IsReservedName(%q) = true, want false", name)
+		}
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Probe"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := os.Stat(filepath.Join(dir, "pROBE"))
+	if got, want := CaseInsensitive(dir), err == nil; got != want {
+		t.Fatalf("CaseInsensitive() = %v, want %v", got, want)
+	}
+	if runtime.GOOS == "linux" && CaseInsensitive(dir) {
+		t.Fatal("CaseInsensitive() = true on a Linux temp directory")
+	}
+}
@@ -0,0 +1,12 @@
+package platform
+
+import "golang.org/x/text/unicode/norm"
+
+// NormalizeUnicode returns s in Unicode normalization form C. macOS can
+// hand back file names in decomposed form (NFD: "e" followed by a combining
+// accent), while Linux and config files mostly use the composed form (NFC:
+// a single "é"). Comparing paths through NormalizeUnicode treats both
+// spellings as the same file.
+func NormalizeUnicode(s string) string {
+	return norm.NFC.String(s)
+}
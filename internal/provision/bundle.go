@@ -0,0 +1,102 @@
+package provision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// BundledChezmoiVersion is the chezmoi release this dot build ships with,
+// set at build time with
+// -X github.com/dnery/dotstate/dot/internal/provision.BundledChezmoiVersion=<version>.
+// Builds tagged embedchezmoi carry the binary itself; other builds download
+// that release on first run. Empty means the build bundles no chezmoi.
+var BundledChezmoiVersion string
+
+// Source says where the active chezmoi binary came from.
+type Source string
+
+const (
+	SourceConfigured Source = "configured"
+	SourcePinned     Source = "pinned"
+	SourceSystem     Source = "system"
+	SourceEmbedded   Source = "embedded"
+	SourceDownloaded Source = "downloaded"
+)
+
+// ErrNotProvisioned reports a pinned or bundled chezmoi that an offline
+// resolve could not use because it has not been downloaded yet.
+var ErrNotProvisioned = errors.New("chezmoi not downloaded yet")
+
+// Resolution is the chezmoi binary dotstate will run.
+type Resolution struct {
+	Path    string
+	Source  Source
+	Version string
+}
+
+// ResolveOptions configures ResolveChezmoi.
+type ResolveOptions struct {
+	// Configured is tools.chezmoi.
+	Configured string
+	// Pinned is tools.chezmoi_version.
+	Pinned string
+	// LookPath finds chezmoi on PATH, normally exec.LookPath.
+	LookPath func(string) (string, error)
+	// Offline never downloads; missing releases return ErrNotProvisioned.
+	Offline bool
+}
+
+// ResolveChezmoi picks the chezmoi binary in order: tools.chezmoi, the
+// pinned tools.chezmoi_version, chezmoi on PATH, then the release bundled
+// with this build. With none available it returns plain "chezmoi" so the
+// usual not-found errors surface when it is run.
+func (p *Provisioner) ResolveChezmoi(ctx context.Context, opts ResolveOptions) (Resolution, error) {
+	if opts.Configured != "" {
+		return Resolution{Path: opts.Configured, Source: SourceConfigured}, nil
+	}
+	if opts.Pinned != "" {
+		return p.release(ctx, NormalizeVersion(opts.Pinned), SourcePinned, opts.Offline)
+	}
+	if opts.LookPath != nil {
+		if path, err := opts.LookPath("chezmoi"); err == nil {
+			return Resolution{Path: path, Source: SourceSystem}, nil
+		}
+	}
+	if version := NormalizeVersion(BundledChezmoiVersion); version != "" {
+		if len(bundledChezmoi) > 0 {
+			return p.extractBundled(version)
+		}
+		return p.release(ctx, version, SourceDownloaded, opts.Offline)
+	}
+	return Resolution{Path: "chezmoi", Source: SourceSystem}, nil
+}
+
+func (p *Provisioner) release(ctx context.Context, version string, source Source, offline bool) (Resolution, error) {
+	res := Resolution{Path: p.ChezmoiPath(version), Source: source, Version: version}
+	if _, ok := p.Cached(version); ok {
+		return res, nil
+	}
+	if offline {
+		return res, ErrNotProvisioned
+	}
+	path, err := p.Chezmoi(ctx, version)
+	if err != nil {
+		return res, err
+	}
+	res.Path = path
+	return res, nil
+}
+
+// extractBundled writes the embedded binary into the cache once so it can
+// be executed like any other release.
+func (p *Provisioner) extractBundled(version string) (Resolution, error) {
+	res := Resolution{Path: p.ChezmoiPath(version), Source: SourceEmbedded, Version: version}
+	if _, ok := p.Cached(version); ok {
+		return res, nil
+	}
+	if _, err := p.install(res.Path, bundledChezmoi); err != nil {
+		return res, fmt.Errorf("extract embedded chezmoi: %w", err)
+	}
+	return res, nil
+}
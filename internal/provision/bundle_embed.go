@@ -0,0 +1,10 @@
+//go:build embedchezmoi
+
+package provision
+
+import _ "embed"
+
+// bundledChezmoi is placed in bundled/ by `make build-embedded`.
+//
+//go:embed bundled/chezmoi
+var bundledChezmoi []byte
@@ -0,0 +1,6 @@
+//go:build !embedchezmoi
+
+package provision
+
+// bundledChezmoi is empty unless dot is built with -tags embedchezmoi.
+var bundledChezmoi []byte
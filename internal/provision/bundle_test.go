@@ -0,0 +1,67 @@
+package provision
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestResolveChezmoiOrder(t *testing.T) {
+	p := New(t.TempDir(), "linux", "amd64")
+	onPath := func(string) (string, error) { return "/usr/bin/chezmoi", nil }
+	notOnPath := func(string) (string, error) { return "", errors.New("not found") }
+	ctx := context.Background()
+
+	res, err := p.ResolveChezmoi(ctx, ResolveOptions{Configured: "/opt/chezmoi", LookPath: onPath})
+	if err != nil || res.Source != SourceConfigured || res.Path != "/opt/chezmoi" {
+		t.Fatalf("configured: %#v, %v", res, err)
+	}
+	res, err = p.ResolveChezmoi(ctx, ResolveOptions{Pinned: "v2.52.1", LookPath: onPath, Offline: true})
+	if !errors.Is(err, ErrNotProvisioned) || res.Source != SourcePinned || res.Version != "2.52.1" {
+		t.Fatalf("pinned offline: %#v, %v", res, err)
+	}
+	res, err = p.ResolveChezmoi(ctx, ResolveOptions{LookPath: onPath})
+	if err != nil || res.Source != SourceSystem || res.Path != "/usr/bin/chezmoi" {
+		t.Fatalf("system: %#v, %v", res, err)
+	}
+	res, err = p.ResolveChezmoi(ctx, ResolveOptions{LookPath: notOnPath})
+	if err != nil || res.Path != "chezmoi" {
+		t.Fatalf("nothing available: %#v, %v", res, err)
+	}
+}
+
+func TestResolveChezmoiUsesBundledRelease(t *testing.T) {
+	stubBundle(t, "2.52.1", []byte("embedded-binary"))
+	p := New(t.TempDir(), "darwin", "arm64")
+	notOnPath := func(string) (string, error) { return "", errors.New("not found") }
+
+	res, err := p.ResolveChezmoi(context.Background(), ResolveOptions{LookPath: notOnPath, Offline: true})
+	if err != nil {
+		t.Fatalf("ResolveChezmoi error = %v", err)
+	}
+	if res.Source != SourceEmbedded || res.Version != "2.52.1" {
+		t.Fatalf("resolution = %#v", res)
+	}
+	if got, err := os.ReadFile(res.Path); err != nil || string(got) != "embedded-binary" {
+		t.Fatalf("extracted binary = %q, %v", got, err)
+	}
+}
+
+func TestResolveChezmoiBundledVersionWithoutEmbedDownloads(t *testing.T) {
+	stubBundle(t, "2.52.1", nil)
+	p := New(t.TempDir(), "linux", "amd64")
+	notOnPath := func(string) (string, error) { return "", errors.New("not found") }
+
+	res, err := p.ResolveChezmoi(context.Background(), ResolveOptions{LookPath: notOnPath, Offline: true})
+	if !errors.Is(err, ErrNotProvisioned) || res.Source != SourceDownloaded {
+		t.Fatalf("resolution = %#v, %v", res, err)
+	}
+}
+
+func stubBundle(t *testing.T, version string, binary []byte) {
+	t.Helper()
+	oldVersion, oldBinary := BundledChezmoiVersion, bundledChezmoi
+	BundledChezmoiVersion, bundledChezmoi = version, binary
+	t.Cleanup(func() { BundledChezmoiVersion, bundledChezmoi = oldVersion, oldBinary })
+}
@@ -0,0 +1,233 @@
+// Package provision downloads pinned tool releases into the dotstate cache,
+// verified against the release checksums, so every machine runs the same
+// tool version regardless of what is on PATH.
+package provision
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ChezmoiReleaseURL is where chezmoi publishes release assets.
+const ChezmoiReleaseURL = "https://github.com/twpayne/chezmoi/releases/download"
+
+// maxAssetSize bounds downloads so a bad URL cannot fill the disk.
+const maxAssetSize = 256 << 20
+
+// Provisioner fetches and caches tool binaries for one platform.
+type Provisioner struct {
+	// CacheDir holds binaries as <tool>/<version>/<os>-<arch>/<binary>.
+	CacheDir string
+	OS       string
+	Arch     string
+	// BaseURL overrides ChezmoiReleaseURL, e.g. for a mirror.
+	BaseURL string
+	// DotReleaseAPI overrides DotLatestReleaseURL.
+	DotReleaseAPI string
+	Client        *http.Client
+}
+
+// New returns a provisioner caching under cacheDir for goos/arch.
+func New(cacheDir, goos, arch string) *Provisioner {
+	return &Provisioner{CacheDir: cacheDir, OS: goos, Arch: arch}
+}
+
+// NormalizeVersion strips a leading "v" so "v2.52.1" and "2.52.1" agree.
+func NormalizeVersion(version string) string {
+	return strings.TrimPrefix(strings.TrimSpace(version), "v")
+}
+
+// ChezmoiPath returns where the pinned chezmoi binary lives in the cache.
+func (p *Provisioner) ChezmoiPath(version string) string {
+	bin := "chezmoi"
+	if p.OS == "windows" {
+		bin += ".exe"
+	}
+	return filepath.Join(p.CacheDir, "chezmoi", NormalizeVersion(version), p.OS+"-"+p.Arch, bin)
+}
+
+// Cached reports whether the pinned chezmoi binary is already in the cache.
+func (p *Provisioner) Cached(version string) (string, bool) {
+	bin := p.ChezmoiPath(version)
+	info, err := os.Stat(bin)
+	return bin, err == nil && info.Mode().IsRegular()
+}
+
+// Chezmoi returns the cached chezmoi binary for version, downloading and
+// verifying it first when needed.
+func (p *Provisioner) Chezmoi(ctx context.Context, version string) (string, error) {
+	version = NormalizeVersion(version)
+	if version == "" {
+		return "", fmt.Errorf("chezmoi version is empty")
+	}
+	if bin, ok := p.Cached(version); ok {
+		return bin, nil
+	}
+
+	base := strings.TrimSuffix(p.BaseURL, "/")
+	if base == "" {
+		base = ChezmoiReleaseURL
+	}
+	asset := p.chezmoiAsset(version)
+	releaseURL := fmt.Sprintf("%s/v%s", base, version)
+
+	sums, err := p.fetch(ctx, fmt.Sprintf("%s/chezmoi_%s_checksums.txt", releaseURL, version))
+	if err != nil {
+		return "", fmt.Errorf("download chezmoi %s checksums: %w", version, err)
+	}
+	want, err := checksumFor(sums, asset)
+	if err != nil {
+		return "", fmt.Errorf("chezmoi %s: %w", version, err)
+	}
+	archive, err := p.fetch(ctx, releaseURL+"/"+asset)
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", asset, err)
+	}
+	sum := sha256.Sum256(archive)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return "", fmt.Errorf("checksum mismatch for %s: got %s, want %s", asset, got, want)
+	}
+
+	binName := filepath.Base(p.ChezmoiPath(version))
+	var binary []byte
+	if strings.HasSuffix(asset, ".zip") {
+		binary, err = extractZip(archive, binName)
+	} else {
+		binary, err = extractTarGz(archive, binName)
+	}
+	if err != nil {
+		return "", fmt.Errorf("extract %s: %w", asset, err)
+	}
+	return p.install(p.ChezmoiPath(version), binary)
+}
+
+func (p *Provisioner) chezmoiAsset(version string) string {
+	ext := ".tar.gz"
+	if p.OS == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf("chezmoi_%s_%s_%s%s", version, p.OS, p.Arch, ext)
+}
+
+func (p *Provisioner) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxAssetSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxAssetSize {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", url, maxAssetSize)
+	}
+	return b, nil
+}
+
+// install writes binary to dst atomically so a crashed download never
+// leaves a truncated executable in the cache.
+func (p *Provisioner) install(dst string, binary []byte) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", fmt.Errorf("create tool cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".download-*")
+	if err != nil {
+		return "", fmt.Errorf("create tool cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("write tool cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", fmt.Errorf("install %s: %w", dst, err)
+	}
+	return dst, nil
+}
+
+// checksumFor finds asset in a sha256sum-style checksums file. Names are
+// compared by base name, since sums generated from outside the asset
+// directory record it as e.g. dist/<asset>.
+func checksumFor(sums []byte, asset string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && path.Base(strings.TrimPrefix(fields[1], "*")) == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s (unsupported platform?)", asset)
+}
+
+func extractTarGz(archive []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s not found in archive", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == name {
+			return io.ReadAll(io.LimitReader(tr, maxAssetSize))
+		}
+	}
+}
+
+func extractZip(archive []byte, name string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if path.Base(f.Name) != name || f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, maxAssetSize))
+	}
+	return nil, fmt.Errorf("%s not found in archive", name)
+}
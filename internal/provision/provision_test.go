@@ -0,0 +1,125 @@
+package provision
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestChezmoiDownloadsVerifiesAndCaches(t *testing.T) {
+	archive := tarGz(t, "chezmoi", "#!/bin/sh\necho chezmoi\n")
+	requests := 0
+	srv := releaseServer(t, "2.52.1", "chezmoi_2.52.1_linux_amd64.tar.gz", archive, &requests)
+
+	p := New(t.TempDir(), "linux", "amd64")
+	p.BaseURL = srv.URL
+
+	bin, err := p.Chezmoi(context.Background(), "v2.52.1")
+	if err != nil {
+		t.Fatalf("Chezmoi error = %v", err)
+	}
+	if bin != p.ChezmoiPath("2.52.1") {
+		t.Fatalf("bin = %s, want %s", bin, p.ChezmoiPath("2.52.1"))
+	}
+	got, err := os.ReadFile(bin)
+	if err != nil || !strings.Contains(string(got), "echo chezmoi") {
+		t.Fatalf("binary = %q, %v", got, err)
+	}
+	info, _ := os.Stat(bin)
+	if info.Mode().Perm()&0o100 == 0 {
+		t.Fatalf("binary mode = %v, want executable", info.Mode())
+	}
+
+	if _, err := p.Chezmoi(context.Background(), "2.52.1"); err != nil {
+		t.Fatalf("cached Chezmoi error = %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("requests = %d, want 2 (second call served from cache)", requests)
+	}
+}
+
+func TestChezmoiRejectsChecksumMismatch(t *testing.T) {
+	archive := tarGz(t, "chezmoi", "tampered")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "checksums.txt") {
+			fmt.Fprintf(w, "%s  chezmoi_2.52.1_linux_amd64.tar.gz\n", strings.Repeat("0", 64))
+			return
+		}
+		w.Write(archive)
+	}))
+	t.Cleanup(srv.Close)
+
+	p := New(t.TempDir(), "linux", "amd64")
+	p.BaseURL = srv.URL
+	_, err := p.Chezmoi(context.Background(), "2.52.1")
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Chezmoi error = %v, want checksum mismatch", err)
+	}
+	if _, ok := p.Cached("2.52.1"); ok {
+		t.Fatal("unverified binary was cached")
+	}
+}
+
+func TestChezmoiWindowsUsesZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("chezmoi.exe")
+	w.Write([]byte("MZ"))
+	zw.Close()
+	requests := 0
+	srv := releaseServer(t, "2.52.1", "chezmoi_2.52.1_windows_arm64.zip", buf.Bytes(), &requests)
+
+	p := New(t.TempDir(), "windows", "arm64")
+	p.BaseURL = srv.URL
+	bin, err := p.Chezmoi(context.Background(), "2.52.1")
+	if err != nil {
+		t.Fatalf("Chezmoi error = %v", err)
+	}
+	if !strings.HasSuffix(bin, "chezmoi.exe") {
+		t.Fatalf("bin = %s", bin)
+	}
+}
+
+func releaseServer(t *testing.T, version, asset string, archive []byte, requests *int) *httptest.Server {
+	t.Helper()
+	sum := sha256.Sum256(archive)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		switch r.URL.Path {
+		case "/v" + version + "/chezmoi_" + version + "_checksums.txt":
+			fmt.Fprintf(w, "%s  other_asset.tar.gz\n%s  %s\n", strings.Repeat("a", 64), hex.EncodeToString(sum[:]), asset)
+		case "/v" + version + "/" + asset:
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func tarGz(t *testing.T, name, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range []struct{ name, body string }{{"README.md", "docs"}, {name, content}} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o755, Size: int64(len(f.body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(f.body))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
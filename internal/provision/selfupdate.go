@@ -0,0 +1,191 @@
+package provision
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DotLatestReleaseURL is the GitHub API endpoint describing dotstate's
+// latest release.
+const DotLatestReleaseURL = "https://api.github.com/repos/dnery/dotstate/releases/latest"
+
+// DotChecksumsAsset is the sha256sum-style file every release carries.
+const DotChecksumsAsset = "SHA256SUMS"
+
+// DotRelease is a published dot release and its assets for one platform.
+type DotRelease struct {
+	Version string `json:"version"`
+	URL     string `json:"url,omitempty"`
+	// Asset is this platform's archive, e.g. dot-darwin-arm64.tar.gz.
+	Asset    string `json:"asset"`
+	AssetURL string `json:"asset_url"`
+	// Digest is the sha256 GitHub records for the asset, when it does.
+	Digest       string `json:"-"`
+	ChecksumsURL string `json:"-"`
+}
+
+// DotAsset returns the release archive name for this platform.
+func (p *Provisioner) DotAsset() string {
+	ext := ".tar.gz"
+	if p.OS == "windows" {
+		ext = ".zip"
+	}
+	return "dot-" + p.OS + "-" + p.Arch + ext
+}
+
+// LatestDot looks up the latest dot release and this platform's asset in
+// it.
+func (p *Provisioner) LatestDot(ctx context.Context) (*DotRelease, error) {
+	url := p.DotReleaseAPI
+	if url == "" {
+		url = DotLatestReleaseURL
+	}
+	b, err := p.fetch(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("look up the latest dot release: %w", err)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+		Assets  []struct {
+			Name               string `json:"name"`
+			BrowserDownloadURL string `json:"browser_download_url"`
+			Digest             string `json:"digest"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(b, &release); err != nil {
+		return nil, fmt.Errorf("parse the latest dot release: %w", err)
+	}
+	rel := &DotRelease{Version: release.TagName, URL: release.HTMLURL, Asset: p.DotAsset()}
+	for _, asset := range release.Assets {
+		switch asset.Name {
+		case rel.Asset:
+			rel.AssetURL = asset.BrowserDownloadURL
+			rel.Digest = strings.TrimPrefix(asset.Digest, "sha256:")
+		case DotChecksumsAsset:
+			rel.ChecksumsURL = asset.BrowserDownloadURL
+		}
+	}
+	if rel.AssetURL == "" {
+		return rel, fmt.Errorf("dot %s has no %s asset for %s/%s", rel.Version, rel.Asset, p.OS, p.Arch)
+	}
+	if rel.ChecksumsURL == "" {
+		return rel, fmt.Errorf("dot %s has no %s asset to verify against", rel.Version, DotChecksumsAsset)
+	}
+	return rel, nil
+}
+
+// DownloadDot downloads rel's archive, verifies it against the release's
+// SHA256SUMS and, when GitHub records one, the asset digest, and returns
+// the dot binary inside it.
+func (p *Provisioner) DownloadDot(ctx context.Context, rel *DotRelease) ([]byte, error) {
+	sums, err := p.fetch(ctx, rel.ChecksumsURL)
+	if err != nil {
+		return nil, fmt.Errorf("download dot %s checksums: %w", rel.Version, err)
+	}
+	want, err := checksumFor(sums, rel.Asset)
+	if err != nil {
+		return nil, fmt.Errorf("dot %s: %w", rel.Version, err)
+	}
+	archive, err := p.fetch(ctx, rel.AssetURL)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", rel.Asset, err)
+	}
+	sum := sha256.Sum256(archive)
+	got := hex.EncodeToString(sum[:])
+	if got != want {
+		return nil, fmt.Errorf("checksum mismatch for %s: got %s, want %s", rel.Asset, got, want)
+	}
+	if rel.Digest != "" && !strings.EqualFold(rel.Digest, got) {
+		return nil, fmt.Errorf("checksum mismatch for %s: got %s, GitHub recorded %s", rel.Asset, got, rel.Digest)
+	}
+
+	bin := "dot"
+	if p.OS == "windows" {
+		bin += ".exe"
+	}
+	var binary []byte
+	if strings.HasSuffix(rel.Asset, ".zip") {
+		binary, err = extractZip(archive, bin)
+	} else {
+		binary, err = extractTarGz(archive, bin)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("extract %s: %w", rel.Asset, err)
+	}
+	return binary, nil
+}
+
+// ReplaceExecutable swaps the executable at exe for binary. The new file is
+// written next to exe and renamed over it, so a failure leaves the old one
+// in place. Windows cannot replace a running executable, so the old one is
+// first renamed to exe.old, which the next update removes.
+func ReplaceExecutable(exe string, binary []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(exe)
+	tmp, err := os.CreateTemp(dir, ".dot-update-*")
+	if err != nil {
+		return fmt.Errorf("cannot write next to %s: %w", exe, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+	if filepath.Ext(exe) == ".exe" {
+		old := exe + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("move the running executable aside: %w", err)
+		}
+		if err := os.Rename(tmp.Name(), exe); err != nil {
+			_ = os.Rename(old, exe)
+			return fmt.Errorf("install %s: %w", exe, err)
+		}
+		return nil
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return fmt.Errorf("install %s: %w", exe, err)
+	}
+	return nil
+}
+
+var versionNumber = regexp.MustCompile(`\d+`)
+
+// NewerVersion reports whether latest is a later release than current.
+// Versions compare by their runs of digits, so v1.10.0 is after v1.9.2 and
+// release-2026-06-01 after release-2026-05-13.
+func NewerVersion(current, latest string) bool {
+	a := versionNumber.FindAllString(current, -1)
+	b := versionNumber.FindAllString(latest, -1)
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x, _ = strconv.Atoi(a[i])
+		}
+		if i < len(b) {
+			y, _ = strconv.Atoi(b[i])
+		}
+		if x != y {
+			return y > x
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package provision
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func dotReleaseServer(t *testing.T, tag, asset string, archive []byte, sum string) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/latest":
+			fmt.Fprintf(w, `{"tag_name": %q, "assets": [
+				{"name": "dot-darwin-arm64.tar.gz", "browser_download_url": "%s/dl/dot-darwin-arm64.tar.gz"},
+				{"name": %q, "browser_download_url": "%s/dl/%s"},
+				{"name": "SHA256SUMS", "browser_download_url": "%s/dl/SHA256SUMS"}]}`,
+				tag, srv.URL, asset, srv.URL, asset, srv.URL)
+		case "/dl/SHA256SUMS":
+			fmt.Fprintf(w, "%s  dot-darwin-arm64.tar.gz\n%s  %s\n", strings.Repeat("a", 64), sum, asset)
+		case "/dl/" + asset:
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSelfUpdateDownloadsVerifiedRelease(t *testing.T) {
+	archive := tarGz(t, "dot-linux-amd64/dot", "#!/bin/sh\necho new\n")
+	sum := sha256.Sum256(archive)
+	srv := dotReleaseServer(t, "v1.3.0", "dot-linux-amd64.tar.gz", archive, hex.EncodeToString(sum[:]))
+
+	p := New(t.TempDir(), "linux", "amd64")
+	p.DotReleaseAPI = srv.URL + "/releases/latest"
+	rel, err := p.LatestDot(context.Background())
+	if err != nil {
+		t.Fatalf("LatestDot error = %v", err)
+	}
+	if rel.Version != "v1.3.0" || rel.Asset != "dot-linux-amd64.tar.gz" {
+		t.Fatalf("release = %+v", rel)
+	}
+	binary, err := p.DownloadDot(context.Background(), rel)
+	if err != nil {
+		t.Fatalf("DownloadDot error = %v", err)
+	}
+
+	exe := filepath.Join(t.TempDir(), "dot")
+	if err := os.WriteFile(exe, []byte("old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaceExecutable(exe, binary); err != nil {
+		t.Fatalf("ReplaceExecutable error = %v", err)
+	}
+	got, _ := os.ReadFile(exe)
+	if string(got) != "#!/bin/sh\necho new\n" {
+		t.Fatalf("executable = %q", got)
+	}
+	if info, _ := os.Stat(exe); info.Mode().Perm()&0o100 == 0 {
+		t.Fatalf("mode = %v, want executable", info.Mode())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(exe))
+	if len(entries) != 1 {
+		t.Fatalf("left %d files behind", len(entries))
+	}
+}
+
+func TestSelfUpdateRejectsChecksumMismatch(t *testing.T) {
+	archive := tarGz(t, "dot", "tampered")
+	srv := dotReleaseServer(t, "v1.3.0", "dot-linux-amd64.tar.gz", archive, strings.Repeat("0", 64))
+
+	p := New(t.TempDir(), "linux", "amd64")
+	p.DotReleaseAPI = srv.URL + "/releases/latest"
+	rel, err := p.LatestDot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DownloadDot(context.Background(), rel); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("DownloadDot error = %v, want checksum mismatch", err)
+	}
+}
+
+func TestSelfUpdateReportsMissingPlatformAsset(t *testing.T) {
+	srv := dotReleaseServer(t, "v1.3.0", "dot-linux-amd64.tar.gz", nil, "")
+	p := New(t.TempDir(), "windows", "amd64")
+	p.DotReleaseAPI = srv.URL + "/releases/latest"
+	rel, err := p.LatestDot(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "dot-windows-amd64.zip") {
+		t.Fatalf("LatestDot error = %v, want missing asset", err)
+	}
+	if rel == nil || rel.Version != "v1.3.0" {
+		t.Fatalf("release = %+v, want the version still reported", rel)
+	}
+}
+
+func TestChecksumForReleaseWorkflowSums(t *testing.T) {
+	// shasum -a 256 dist/dot-darwin-arm64.tar.gz > dist/SHA256SUMS
+	sums := []byte(strings.Repeat("b", 64) + "  dist/dot-darwin-arm64.tar.gz\n" +
+		strings.Repeat("C", 64) + " *dist/dot-linux-amd64.tar.gz\n")
+	if got, err := checksumFor(sums, "dot-darwin-arm64.tar.gz"); err != nil || got != strings.Repeat("b", 64) {
+		t.Errorf("checksumFor(darwin) = %q, %v", got, err)
+	}
+	if got, err := checksumFor(sums, "dot-linux-amd64.tar.gz"); err != nil || got != strings.Repeat("c", 64) {
+		t.Errorf("checksumFor(binary mode) = %q, %v", got, err)
+	}
+	if _, err := checksumFor(sums, "dot-windows-amd64.zip"); err == nil {
+		t.Error("checksumFor(missing) succeeded")
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		current, latest string
+		want            bool
+	}{
+		{"v1.9.2", "v1.10.0", true},
+		{"1.10.0", "v1.10.0", false},
+		{"v1.10.0", "v1.9.2", false},
+		{"v1.2", "v1.2.1", true},
+		{"release-2026-05-13", "release-2026-06-01", true},
+		{"release-2026-06-01", "release-2026-06-01", false},
+	}
+	for _, tt := range tests {
+		if got := NewerVersion(tt.current, tt.latest); got != tt.want {
+			t.Errorf("NewerVersion(%q, %q) = %v, want %v", tt.current, tt.latest, got, tt.want)
+		}
+	}
+}
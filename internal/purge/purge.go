@@ -0,0 +1,138 @@
+// Package purge removes what dotstate put on a machine outside its repo:
+// the managed files in home and the local-only state and caches. The repo,
+// including its tracked state, is never touched, so dot bootstrap or dot
+// apply can bring everything back.
+package purge
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// Plan is what purging removes, as absolute paths.
+type Plan struct {
+	// Files are managed files and symlinks in home.
+	Files []string `json:"files"`
+	// Dirs are managed directories, deepest first. They are removed only
+	// once removing Files leaves them empty.
+	Dirs []string `json:"dirs"`
+	// Local are local-only state and cache directories, removed with
+	// everything in them.
+	Local []string `json:"local"`
+}
+
+// Result is what Remove did.
+type Result struct {
+	Removed []string `json:"removed"`
+	// Kept are managed directories left in place because they still hold
+	// unmanaged files.
+	Kept []string `json:"kept,omitempty"`
+}
+
+// LocalDirs returns the untracked directories dotstate keeps for cfg's repo
+// and plat: logs and the daemon's state, backups, audit state, and the
+// dotstate cache and state directories outside the repo.
+func LocalDirs(cfg *config.Config, plat *platform.Platform) []string {
+	return []string{
+		cfg.LogPath(),
+		cfg.BackupPath(),
+		filepath.Dir(cfg.AuditStatePath()),
+		plat.Paths().CacheDir,
+		filepath.Join(plat.StateDir, "dotstate"),
+	}
+}
+
+// NewPlan sorts managed, the home-relative targets an engine reports, into
+// files and directories that exist under home, and keeps the local
+// directories that exist. Targets inside repoRoot are left out, so a repo
+// kept under home is never purged.
+func NewPlan(home, repoRoot string, managed, local []string) (*Plan, error) {
+	plan := &Plan{Files: []string{}, Dirs: []string{}, Local: []string{}}
+	for _, rel := range managed {
+		target := filepath.Join(home, filepath.FromSlash(rel))
+		if !within(home, target) || target == home || within(repoRoot, target) {
+			continue
+		}
+		info, err := os.Lstat(target)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			plan.Dirs = append(plan.Dirs, target)
+		} else {
+			plan.Files = append(plan.Files, target)
+		}
+	}
+	slices.Sort(plan.Files)
+	// Reverse lexical order puts every directory before its parent.
+	slices.Sort(plan.Dirs)
+	slices.Reverse(plan.Dirs)
+
+	for _, dir := range local {
+		if dir == "" || dir == home || within(dir, repoRoot) {
+			continue
+		}
+		if _, err := os.Lstat(dir); err == nil {
+			plan.Local = append(plan.Local, dir)
+		}
+	}
+	return plan, nil
+}
+
+// Empty reports whether there is nothing to remove.
+func (p *Plan) Empty() bool {
+	return len(p.Files) == 0 && len(p.Dirs) == 0 && len(p.Local) == 0
+}
+
+// Remove deletes the plan's files, then the directories they leave empty,
+// then the local directories. It stops at the first error, returning what
+// it removed so far.
+func (p *Plan) Remove() (*Result, error) {
+	res := &Result{Removed: []string{}}
+	for _, path := range p.Files {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return res, fmt.Errorf("remove %s: %w", path, err)
+		}
+		res.Removed = append(res.Removed, path)
+	}
+	for _, dir := range p.Dirs {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return res, fmt.Errorf("read %s: %w", dir, err)
+		}
+		if len(entries) > 0 {
+			res.Kept = append(res.Kept, dir)
+			continue
+		}
+		if err := os.Remove(dir); err != nil {
+			return res, fmt.Errorf("remove %s: %w", dir, err)
+		}
+		res.Removed = append(res.Removed, dir)
+	}
+	for _, dir := range p.Local {
+		if err := os.RemoveAll(dir); err != nil {
+			return res, fmt.Errorf("remove %s: %w", dir, err)
+		}
+		res.Removed = append(res.Removed, dir)
+	}
+	return res, nil
+}
+
+// within reports whether path is dir or inside it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
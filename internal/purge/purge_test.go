@@ -0,0 +1,68 @@
+package purge
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestPurgeRemovesManagedFilesAndLocalState(t *testing.T) {
+	home := testutil.TempDir(t)
+	repo := filepath.Join(home, "dotstate")
+	testutil.TempFile(t, home, ".zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, home, ".config/nvim/init.lua", "-- managed\n")
+	testutil.TempFile(t, home, ".config/git/config", "[user]\n")
+	testutil.TempFile(t, home, ".config/git/local", "unmanaged\n")
+	testutil.TempFile(t, repo, "home/dot_zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, repo, "state/logs/dot.log", "log\n")
+	testutil.TempFile(t, repo, "state/packages/brew.txt", "git\n")
+	if err := os.Symlink(filepath.Join(repo, "home/dot_zshrc"), filepath.Join(home, ".zprofile")); err != nil {
+		t.Fatal(err)
+	}
+
+	managed := []string{".config", ".config/git", ".config/git/config", ".config/nvim", ".config/nvim/init.lua", ".zprofile", ".zshrc", ".missing", "dotstate/home/dot_zshrc", "../outside"}
+	local := []string{filepath.Join(repo, "state", "logs"), filepath.Join(repo, "state", "backups"), repo, home}
+	plan, err := NewPlan(home, repo, managed, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFiles := []string{
+		filepath.Join(home, ".config/git/config"),
+		filepath.Join(home, ".config/nvim/init.lua"),
+		filepath.Join(home, ".zprofile"),
+		filepath.Join(home, ".zshrc"),
+	}
+	if !slices.Equal(plan.Files, wantFiles) {
+		t.Errorf("Files = %v, want %v", plan.Files, wantFiles)
+	}
+	wantDirs := []string{filepath.Join(home, ".config/nvim"), filepath.Join(home, ".config/git"), filepath.Join(home, ".config")}
+	if !slices.Equal(plan.Dirs, wantDirs) {
+		t.Errorf("Dirs = %v, want %v", plan.Dirs, wantDirs)
+	}
+	if want := []string{filepath.Join(repo, "state", "logs")}; !slices.Equal(plan.Local, want) {
+		t.Errorf("Local = %v, want %v", plan.Local, want)
+	}
+
+	res, err := plan.Remove()
+	if err != nil {
+		t.Fatalf("Remove error = %v", err)
+	}
+	wantKept := []string{filepath.Join(home, ".config/git"), filepath.Join(home, ".config")}
+	if !slices.Equal(res.Kept, wantKept) {
+		t.Errorf("Kept = %v, want %v", res.Kept, wantKept)
+	}
+	for _, gone := range []string{".zshrc", ".zprofile", ".config/nvim", "dotstate/state/logs"} {
+		if _, err := os.Lstat(filepath.Join(home, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s still exists (err = %v)", gone, err)
+		}
+	}
+	for _, kept := range []string{".config/git/local", "dotstate/home/dot_zshrc", "dotstate/state/packages/brew.txt"} {
+		if _, err := os.Stat(filepath.Join(home, kept)); err != nil {
+			t.Errorf("%s was removed: %v", kept, err)
+		}
+	}
+}
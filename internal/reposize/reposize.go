@@ -0,0 +1,266 @@
+// Package reposize reports what makes the dotfiles repo large: the biggest
+// tracked files and history-only blobs, how the tracked tree grew, and how
+// much each state/ area contributes, with suggestions for shrinking it.
+package reposize
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+)
+
+// Suggestion kinds.
+const (
+	SuggestLFS     = "lfs"
+	SuggestPrune   = "prune"
+	SuggestExclude = "exclude"
+)
+
+// Defaults for Options.
+const (
+	DefaultTop          = 10
+	DefaultMonths       = 6
+	DefaultLFSThreshold = 512 * 1024
+)
+
+// stateAreaShare is the fraction of tracked bytes above which a state/ area
+// is worth excluding.
+const stateAreaShare = 0.25
+
+// Options configures Analyze.
+type Options struct {
+	// Top is how many files to list in each ranking.
+	Top int
+	// Months is how many month-end samples of the tracked tree to take.
+	Months int
+	// LFSThreshold is the size at which a file is worth routing to git-lfs
+	// or pruning from history.
+	LFSThreshold int64
+	// Now anchors the growth samples; zero uses time.Now.
+	Now time.Time
+}
+
+// File is a blob ranked by size.
+type File struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Area totals the tracked files under one state/ subdirectory.
+type Area struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Point is the tracked tree size at the end of a month.
+type Point struct {
+	Month string `json:"month"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Suggestion is one way to shrink the repo.
+type Suggestion struct {
+	Kind    string `json:"kind"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Report is the result of Analyze.
+type Report struct {
+	PackBytes    int64        `json:"pack_bytes"`
+	TrackedFiles int          `json:"tracked_files"`
+	TrackedBytes int64        `json:"tracked_bytes"`
+	Largest      []File       `json:"largest"`
+	HistoryOnly  []File       `json:"history_only"`
+	StateAreas   []Area       `json:"state_areas"`
+	Growth       []Point      `json:"growth"`
+	Suggestions  []Suggestion `json:"suggestions"`
+}
+
+// Analyze inspects the repo at repoPath.
+func Analyze(ctx context.Context, g *gitx.Git, repoPath string, opts Options) (*Report, error) {
+	if opts.Top <= 0 {
+		opts.Top = DefaultTop
+	}
+	if opts.Months <= 0 {
+		opts.Months = DefaultMonths
+	}
+	if opts.LFSThreshold <= 0 {
+		opts.LFSThreshold = DefaultLFSThreshold
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	report := &Report{}
+	var err error
+	if report.PackBytes, err = g.PackSize(ctx, repoPath); err != nil {
+		return nil, fmt.Errorf("measure object database: %w", err)
+	}
+
+	tree, err := g.TreeBlobs(ctx, repoPath, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("list tracked files: %w", err)
+	}
+	inTree := make(map[string]bool, len(tree))
+	areas := map[string]*Area{}
+	for _, blob := range tree {
+		inTree[blob.Hash] = true
+		report.TrackedFiles++
+		report.TrackedBytes += blob.Size
+		if name := stateArea(blob.Path); name != "" {
+			area := areas[name]
+			if area == nil {
+				area = &Area{Name: name}
+				areas[name] = area
+			}
+			area.Files++
+			area.Bytes += blob.Size
+		}
+	}
+	report.Largest = largest(tree, opts.Top)
+	for _, area := range areas {
+		report.StateAreas = append(report.StateAreas, *area)
+	}
+	sort.Slice(report.StateAreas, func(i, j int) bool {
+		a, b := report.StateAreas[i], report.StateAreas[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Name < b.Name
+	})
+
+	history, err := g.HistoryBlobs(ctx, repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("list history objects: %w", err)
+	}
+	var removed []gitx.Blob
+	for _, blob := range history {
+		if !inTree[blob.Hash] {
+			removed = append(removed, blob)
+		}
+	}
+	report.HistoryOnly = largest(removed, opts.Top)
+
+	if report.Growth, err = growth(ctx, g, repoPath, opts); err != nil {
+		return nil, err
+	}
+
+	report.Suggestions = suggest(report, opts.LFSThreshold)
+	return report, nil
+}
+
+// stateArea returns the state/ subdirectory a tracked path lives in.
+func stateArea(p string) string {
+	rest, ok := strings.CutPrefix(p, "state/")
+	if !ok {
+		return ""
+	}
+	name, _, nested := strings.Cut(rest, "/")
+	if !nested {
+		return ""
+	}
+	return name
+}
+
+// largest returns up to n blobs by descending size, one entry per path.
+func largest(blobs []gitx.Blob, n int) []File {
+	bySize := make(map[string]int64, len(blobs))
+	for _, blob := range blobs {
+		if blob.Size > bySize[blob.Path] {
+			bySize[blob.Path] = blob.Size
+		}
+	}
+	files := make([]File, 0, len(bySize))
+	for p, size := range bySize {
+		files = append(files, File{Path: p, Size: size})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+	if len(files) > n {
+		files = files[:n]
+	}
+	return files
+}
+
+// growth samples the tracked tree at the end of each of the last
+// opts.Months months, oldest first, skipping months before the first commit.
+func growth(ctx context.Context, g *gitx.Git, repoPath string, opts Options) ([]Point, error) {
+	first := time.Date(opts.Now.Year(), opts.Now.Month(), 1, 0, 0, 0, 0, opts.Now.Location())
+	sizes := map[string]Point{}
+	var points []Point
+	for i := opts.Months - 1; i >= 0; i-- {
+		start := first.AddDate(0, -i, 0)
+		end := start.AddDate(0, 1, 0)
+		if end.After(opts.Now) {
+			end = opts.Now
+		}
+		rev, err := g.RevBefore(ctx, repoPath, end)
+		if err != nil {
+			return nil, fmt.Errorf("find commit before %s: %w", end.Format("2006-01-02"), err)
+		}
+		if rev == "" {
+			continue
+		}
+		point, ok := sizes[rev]
+		if !ok {
+			blobs, err := g.TreeBlobs(ctx, repoPath, rev)
+			if err != nil {
+				return nil, fmt.Errorf("list files at %s: %w", rev, err)
+			}
+			for _, blob := range blobs {
+				point.Files++
+				point.Bytes += blob.Size
+			}
+			sizes[rev] = point
+		}
+		point.Month = start.Format("2006-01")
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// suggest proposes git-lfs for large tracked files, pruning for large
+// history-only blobs, and excluding state/ areas that dominate the tree.
+func suggest(report *Report, threshold int64) []Suggestion {
+	var out []Suggestion
+	for _, f := range report.Largest {
+		if f.Size >= threshold {
+			out = append(out, Suggestion{
+				Kind:    SuggestLFS,
+				Path:    f.Path,
+				Message: fmt.Sprintf("track with git-lfs (git lfs track %q) so its versions stay out of the pack", f.Path),
+			})
+		}
+	}
+	for _, f := range report.HistoryOnly {
+		if f.Size >= threshold {
+			out = append(out, Suggestion{
+				Kind:    SuggestPrune,
+				Path:    f.Path,
+				Message: "old versions remain in history; prune them with git filter-repo if they are no longer needed",
+			})
+		}
+	}
+	for _, area := range report.StateAreas {
+		if area.Bytes >= threshold && float64(area.Bytes) >= stateAreaShare*float64(report.TrackedBytes) {
+			out = append(out, Suggestion{
+				Kind:    SuggestExclude,
+				Path:    path.Join("state", area.Name),
+				Message: "holds a large share of the tree; disable its exporter in [exports] or gitignore what it does not need",
+			})
+		}
+	}
+	return out
+}
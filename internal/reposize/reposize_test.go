@@ -0,0 +1,96 @@
+package reposize
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func revListBefore(date string) testutil.CommandMatcher {
+	return func(c testutil.CommandCall) bool {
+		return c.Name == "git" && len(c.Args) == 4 && c.Args[0] == "rev-list" && strings.HasPrefix(c.Args[2], "--before="+date)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "count-objects", "-v"), "count: 2\nsize: 8\nin-pack: 10\nsize-pack: 2048\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "ls-tree", "-r", "-l", "-z", "HEAD"),
+		"100644 blob aaa 2000000\thome/dot_wallpaper.png\x00"+
+			"100644 blob bbb     300\thome/dot_zshrc\x00"+
+			"100644 blob ccc  700000\tstate/brew/Brewfile.lock\x00"+
+			"100644 blob ddd     100\tstate/README.md\x00")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "ls-tree", "-r", "-l", "-z", "old"),
+		"100644 blob bbb     300\thome/dot_zshrc\x00")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-list", "--objects", "--all"),
+		"c1\nt1 \naaa home/dot_wallpaper.png\nbbb home/dot_zshrc\nccc state/brew/Brewfile.lock\nddd state/README.md\neee home/dot_old.tar\n")
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("git", "cat-file"),
+		"c1 commit 200\nt1 tree 90\naaa blob 2000000\nbbb blob 300\nccc blob 700000\nddd blob 100\neee blob 900000\nfff blob 5\n")
+	mock.OnCommandSuccess(revListBefore("2026-02-01"), "")
+	mock.OnCommandSuccess(revListBefore("2026-03-01"), "old\n")
+	mock.OnCommandSuccess(revListBefore("2026-03-15"), "new\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "ls-tree", "-r", "-l", "-z", "new"),
+		"100644 blob bbb     300\thome/dot_zshrc\x00100644 blob aaa 2000000\thome/dot_wallpaper.png\x00")
+
+	report, err := Analyze(context.Background(), gitx.New("git", mock), "/repo", Options{
+		Top:    2,
+		Months: 3,
+		Now:    time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+
+	if report.PackBytes != (8+2048)*1024 {
+		t.Errorf("PackBytes = %d", report.PackBytes)
+	}
+	if report.TrackedFiles != 4 || report.TrackedBytes != 2700400 {
+		t.Errorf("tracked = %d files, %d bytes", report.TrackedFiles, report.TrackedBytes)
+	}
+	if len(report.Largest) != 2 || report.Largest[0].Path != "home/dot_wallpaper.png" || report.Largest[1].Path != "state/brew/Brewfile.lock" {
+		t.Errorf("Largest = %#v", report.Largest)
+	}
+	if len(report.HistoryOnly) != 1 || report.HistoryOnly[0].Path != "home/dot_old.tar" {
+		t.Errorf("HistoryOnly = %#v", report.HistoryOnly)
+	}
+	if len(report.StateAreas) != 1 || report.StateAreas[0] != (Area{Name: "brew", Files: 1, Bytes: 700000}) {
+		t.Errorf("StateAreas = %#v", report.StateAreas)
+	}
+
+	wantGrowth := []Point{{Month: "2026-02", Files: 1, Bytes: 300}, {Month: "2026-03", Files: 2, Bytes: 2000300}}
+	if len(report.Growth) != len(wantGrowth) {
+		t.Fatalf("Growth = %#v", report.Growth)
+	}
+	for i, p := range wantGrowth {
+		if report.Growth[i] != p {
+			t.Errorf("Growth[%d] = %#v, want %#v", i, report.Growth[i], p)
+		}
+	}
+
+	var kinds []string
+	for _, s := range report.Suggestions {
+		kinds = append(kinds, s.Kind+":"+s.Path)
+	}
+	want := "lfs:home/dot_wallpaper.png,lfs:state/brew/Brewfile.lock,prune:home/dot_old.tar,exclude:state/brew"
+	if strings.Join(kinds, ",") != want {
+		t.Errorf("Suggestions = %v, want %s", kinds, want)
+	}
+}
+
+func TestStateArea(t *testing.T) {
+	tests := map[string]string{
+		"state/brew/Brewfile": "brew",
+		"state/macos/a/b":     "macos",
+		"state/README.md":     "",
+		"home/state/x/y":      "",
+	}
+	for p, want := range tests {
+		if got := stateArea(p); got != want {
+			t.Errorf("stateArea(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
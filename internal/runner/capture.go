@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultMaxOutput is how many bytes of each stream a command's result
+// keeps by default.
+const DefaultMaxOutput = 10 << 20
+
+// MaxOutput is the per-stream capture limit New and NewWithTimeout give
+// their runners. dotstate sets it from [tools] max_output.
+var MaxOutput int64 = DefaultMaxOutput
+
+// captureBuffer keeps the first limit bytes written to it and streams the
+// rest to a spill file, so a runaway command cannot exhaust memory.
+type captureBuffer struct {
+	limit    int64
+	spillDir string
+	pattern  string
+
+	buf       bytes.Buffer
+	spill     *os.File
+	spillPath string
+	spillErr  error
+	dropped   int64
+}
+
+func newCaptureBuffer(limit int64, spillDir, name, stream string) *captureBuffer {
+	return &captureBuffer{
+		limit:    limit,
+		spillDir: spillDir,
+		pattern:  fmt.Sprintf("dotstate-%s-%s-*.log", filepath.Base(name), stream),
+	}
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit <= 0 {
+		b.buf.Write(p)
+		return n, nil
+	}
+	if room := b.limit - int64(b.buf.Len()); room > 0 {
+		if int64(len(p)) <= room {
+			b.buf.Write(p)
+			return n, nil
+		}
+		b.buf.Write(p[:room])
+		p = p[room:]
+	}
+	b.dropped += int64(len(p))
+	if b.spill == nil && b.spillErr == nil {
+		b.spill, b.spillErr = os.CreateTemp(b.spillDir, b.pattern)
+		if b.spill != nil {
+			b.spillPath = b.spill.Name()
+		}
+	}
+	if b.spill != nil && b.spillErr == nil {
+		_, b.spillErr = b.spill.Write(p)
+	}
+	// Never fail the command over its own output.
+	return n, nil
+}
+
+// close finishes the spill file, if any.
+func (b *captureBuffer) close() {
+	if b.spill != nil {
+		_ = b.spill.Close()
+	}
+}
+
+// String returns the captured output, ending in a truncation marker that
+// names the spill file when the limit was hit.
+func (b *captureBuffer) String() string {
+	if b.dropped == 0 {
+		return b.buf.String()
+	}
+	where := "discarded"
+	if b.spillPath != "" {
+		where = "written to " + b.spillPath
+		if b.spillErr != nil {
+			where = "partly " + where
+		}
+	}
+	return fmt.Sprintf("%s\n[output truncated at %d bytes; %d more bytes %s]\n", b.buf.String(), b.limit, b.dropped, where)
+}
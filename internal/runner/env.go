@@ -0,0 +1,19 @@
+package runner
+
+import "context"
+
+// EnvRunner is implemented by runners that can add variables to a command's
+// environment.
+type EnvRunner interface {
+	RunEnv(ctx context.Context, dir, name string, env []string, args ...string) (*CmdResult, error)
+}
+
+// RunEnv runs the command with r, adding env ("KEY=value" entries) to the
+// environment it inherits. Runners that are not EnvRunners run the command
+// without them.
+func RunEnv(ctx context.Context, r Runner, dir, name string, env []string, args ...string) (*CmdResult, error) {
+	if er, ok := r.(EnvRunner); ok {
+		return er.RunEnv(ctx, dir, name, env, args...)
+	}
+	return r.Run(ctx, dir, name, args...)
+}
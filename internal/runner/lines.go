@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"strings"
+)
+
+// LineRunner is implemented by runners that can report stdout line by line
+// while the command runs.
+type LineRunner interface {
+	RunLines(ctx context.Context, dir, name string, onLine func(string), args ...string) (*CmdResult, error)
+}
+
+// RunLines runs the command with r, calling onLine for each line of stdout:
+// as it is printed when r is a LineRunner, otherwise once the command exits.
+func RunLines(ctx context.Context, r Runner, dir, name string, onLine func(string), args ...string) (*CmdResult, error) {
+	if lr, ok := r.(LineRunner); ok {
+		return lr.RunLines(ctx, dir, name, onLine, args...)
+	}
+	res, err := r.Run(ctx, dir, name, args...)
+	if res != nil {
+		lw := &lineWriter{onLine: onLine}
+		_, _ = lw.Write([]byte(res.Stdout))
+		lw.flush()
+	}
+	return res, err
+}
+
+// lineWriter calls onLine for each complete line written to it.
+type lineWriter struct {
+	onLine func(string)
+	buf    bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(w.buf.Next(i + 1))
+		w.onLine(strings.TrimSuffix(line, "\n"))
+	}
+}
+
+// flush reports a final line that has no trailing newline.
+func (w *lineWriter) flush() {
+	if w.buf.Len() > 0 {
+		w.onLine(w.buf.String())
+		w.buf.Reset()
+	}
+}
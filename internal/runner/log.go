@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+// Logger is the logger New and NewWithTimeout give their runners. dotstate
+// sets it in verbose mode so every external command is recorded.
+var Logger *slog.Logger
+
+// logOutputLimit is how much of each stream a log record keeps.
+const logOutputLimit = 64 << 10
+
+// logCommand records a finished command and its redacted output at debug
+// level. The output of a sensitive command is not recorded at all, since
+// redaction cannot recognize arbitrary plaintext.
+func (r *ExecRunner) logCommand(ctx context.Context, dir, name string, args []string, res *CmdResult, elapsed time.Duration, sensitive bool) {
+	if r.Logger == nil || !r.Logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	safeArgs := make([]string, len(args))
+	for i, arg := range args {
+		safeArgs[i] = redact.Text(arg)
+	}
+	attrs := []any{
+		"cmd", redact.Text(name),
+		"args", safeArgs,
+		"dir", dir,
+		"exit_code", res.Code,
+		"duration_ms", elapsed.Milliseconds(),
+	}
+	if sensitive {
+		r.Logger.DebugContext(ctx, "external command", append(attrs, "output", "not logged (sensitive)")...)
+		return
+	}
+	attrs = append(attrs, "stdout", logOutput(res.Stdout), "stderr", logOutput(res.Stderr))
+	if res.StdoutSpill != "" {
+		attrs = append(attrs, "stdout_spill", res.StdoutSpill)
+	}
+	if res.StderrSpill != "" {
+		attrs = append(attrs, "stderr_spill", res.StderrSpill)
+	}
+	r.Logger.DebugContext(ctx, "external command", attrs...)
+}
+
+func logOutput(s string) string {
+	if len(s) > logOutputLimit {
+		s = fmt.Sprintf("%s\n[%d more bytes not logged]", s[:logOutputLimit], len(s)-logOutputLimit)
+	}
+	return redact.Text(s)
+}
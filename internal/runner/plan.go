@@ -0,0 +1,52 @@
+package runner
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Planned is a command a PlanRunner recorded instead of running.
+type Planned struct {
+	Dir  string   `json:"dir,omitempty"`
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+}
+
+var plainArg = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// String renders the command as a shell would take it, quoting arguments
+// that need it.
+func (p Planned) String() string {
+	parts := make([]string, 0, len(p.Args)+1)
+	for _, arg := range append([]string{p.Name}, p.Args...) {
+		if !plainArg.MatchString(arg) {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// PlanRunner is a Runner for dry runs: it records every command and returns
+// an empty, successful result without running anything.
+type PlanRunner struct {
+	mu      sync.Mutex
+	planned []Planned
+}
+
+// Run records the command.
+func (r *PlanRunner) Run(ctx context.Context, dir, name string, args ...string) (*CmdResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.planned = append(r.planned, Planned{Dir: dir, Name: name, Args: append([]string(nil), args...)})
+	return &CmdResult{}, nil
+}
+
+// Planned returns the recorded commands in the order they were given.
+func (r *PlanRunner) Planned() []Planned {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Planned(nil), r.planned...)
+}
@@ -2,9 +2,11 @@
 package runner
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
 	"os/exec"
 	"strings"
 	"time"
@@ -17,6 +19,10 @@ type CmdResult struct {
 	Stdout string
 	Stderr string
 	Code   int
+	// StdoutSpill and StderrSpill name the files holding output past the
+	// runner's MaxOutput, when a stream was truncated.
+	StdoutSpill string
+	StderrSpill string
 }
 
 // Runner defines the interface for executing external commands.
@@ -37,20 +43,63 @@ type ExecRunner struct {
 	// Timeout is the maximum duration for command execution.
 	// Zero means no timeout.
 	Timeout time.Duration
+	// MaxOutput is how many bytes of stdout and of stderr a result keeps;
+	// the rest goes to a spill file. Zero means no limit.
+	MaxOutput int64
+	// SpillDir holds spill files; empty means the system temp directory.
+	SpillDir string
+	// Logger, when set, records each command and its output at debug level.
+	Logger *slog.Logger
 }
 
-// New creates a new ExecRunner with the default timeout.
+// New creates a new ExecRunner with the default timeout and MaxOutput.
 func New() *ExecRunner {
-	return &ExecRunner{Timeout: DefaultTimeout}
+	return &ExecRunner{Timeout: DefaultTimeout, MaxOutput: MaxOutput, Logger: Logger}
 }
 
 // NewWithTimeout creates a new ExecRunner with a custom timeout.
 func NewWithTimeout(timeout time.Duration) *ExecRunner {
-	return &ExecRunner{Timeout: timeout}
+	return &ExecRunner{Timeout: timeout, MaxOutput: MaxOutput, Logger: Logger}
 }
 
 // Run executes a command and returns its result.
 func (r *ExecRunner) Run(ctx context.Context, dir, name string, args ...string) (*CmdResult, error) {
+	return r.run(ctx, dir, name, runOptions{}, args...)
+}
+
+// RunEnv is Run with env added to the command's inherited environment.
+func (r *ExecRunner) RunEnv(ctx context.Context, dir, name string, env []string, args ...string) (*CmdResult, error) {
+	return r.run(ctx, dir, name, runOptions{env: env}, args...)
+}
+
+// RunSensitive is Run for a command whose output is secret: the output is
+// kept in memory in full, never spilled to a file, and left out of the
+// command's log record.
+func (r *ExecRunner) RunSensitive(ctx context.Context, dir, name string, args ...string) (*CmdResult, error) {
+	return r.run(ctx, dir, name, runOptions{sensitive: true}, args...)
+}
+
+// RunLines is Run that also calls onLine with each line of stdout as the
+// command prints it.
+func (r *ExecRunner) RunLines(ctx context.Context, dir, name string, onLine func(string), args ...string) (*CmdResult, error) {
+	lw := &lineWriter{onLine: onLine}
+	res, err := r.run(ctx, dir, name, runOptions{tee: lw}, args...)
+	lw.flush()
+	return res, err
+}
+
+// runOptions are the per-call variations of run.
+type runOptions struct {
+	// tee also receives stdout when non-nil.
+	tee io.Writer
+	// env is added to the inherited environment.
+	env []string
+	// sensitive keeps output out of spill files and logs.
+	sensitive bool
+}
+
+// run executes the command as opts describe.
+func (r *ExecRunner) run(ctx context.Context, dir, name string, opts runOptions, args ...string) (*CmdResult, error) {
 	if r.Timeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
@@ -61,30 +110,47 @@ func (r *ExecRunner) Run(ctx context.Context, dir, name string, args ...string)
 	if dir != "" {
 		cmd.Dir = dir
 	}
+	if len(opts.env) > 0 {
+		cmd.Env = append(os.Environ(), opts.env...)
+	}
 
-	var outBuf, errBuf bytes.Buffer
-	cmd.Stdout = &outBuf
-	cmd.Stderr = &errBuf
+	limit := r.MaxOutput
+	if opts.sensitive {
+		limit = 0
+	}
+	outBuf := newCaptureBuffer(limit, r.SpillDir, name, "stdout")
+	errBuf := newCaptureBuffer(limit, r.SpillDir, name, "stderr")
+	cmd.Stdout = outBuf
+	if opts.tee != nil {
+		cmd.Stdout = io.MultiWriter(outBuf, opts.tee)
+	}
+	cmd.Stderr = errBuf
 
+	start := time.Now()
 	err := cmd.Run()
+	outBuf.close()
+	errBuf.close()
 
 	res := &CmdResult{
-		Stdout: outBuf.String(),
-		Stderr: errBuf.String(),
-		Code:   0,
+		Stdout:      outBuf.String(),
+		Stderr:      errBuf.String(),
+		Code:        0,
+		StdoutSpill: outBuf.spillPath,
+		StderrSpill: errBuf.spillPath,
 	}
 
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			res.Code = ee.ExitCode()
+		} else {
+			res.Code = -1
+		}
+	}
+	r.logCommand(ctx, dir, name, args, res, time.Since(start), opts.sensitive)
 	if err == nil {
 		return res, nil
 	}
 
-	// Extract exit code if available
-	if ee, ok := err.(*exec.ExitError); ok {
-		res.Code = ee.ExitCode()
-	} else {
-		res.Code = -1
-	}
-
 	// Build a helpful error message
 	msg := strings.TrimSpace(res.Stderr)
 	if msg == "" {
@@ -92,12 +158,14 @@ func (r *ExecRunner) Run(ctx context.Context, dir, name string, args ...string)
 	}
 
 	return res, &RunError{
-		Cmd:    name,
-		Args:   args,
-		Dir:    dir,
-		Code:   res.Code,
-		Stderr: res.Stderr,
-		Err:    err,
+		Cmd:         name,
+		Args:        args,
+		Dir:         dir,
+		Code:        res.Code,
+		Stderr:      res.Stderr,
+		Err:         err,
+		StdoutSpill: res.StdoutSpill,
+		StderrSpill: res.StderrSpill,
 	}
 }
 
@@ -109,9 +177,21 @@ type RunError struct {
 	Code   int
 	Stderr string
 	Err    error
+	// StdoutSpill and StderrSpill name the files holding output that did
+	// not fit in the result.
+	StdoutSpill string
+	StderrSpill string
 }
 
 func (e *RunError) Error() string {
+	// A truncated stderr already ends in a marker naming its spill file.
+	if e.StdoutSpill != "" {
+		return fmt.Sprintf("%s (stdout truncated; the rest is in %s)", e.message(), e.StdoutSpill)
+	}
+	return e.message()
+}
+
+func (e *RunError) message() string {
 	stderr := redact.Text(strings.TrimSpace(e.Stderr))
 	args := make([]string, len(e.Args))
 	for i, arg := range e.Args {
@@ -135,5 +215,11 @@ func ExitCode(err error) int {
 	return -1
 }
 
-// Compile-time check that ExecRunner implements Runner.
-var _ Runner = (*ExecRunner)(nil)
+// Compile-time checks that ExecRunner implements Runner, LineRunner,
+// EnvRunner, and SensitiveRunner.
+var (
+	_ Runner          = (*ExecRunner)(nil)
+	_ LineRunner      = (*ExecRunner)(nil)
+	_ EnvRunner       = (*ExecRunner)(nil)
+	_ SensitiveRunner = (*ExecRunner)(nil)
+)
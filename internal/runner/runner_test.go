@@ -1,7 +1,14 @@
 package runner
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -32,3 +39,128 @@ func TestRunErrorRedactsWrappedErrorWhenStderrEmpty(t *testing.T) {
 		t.Fatalf("RunError leaked sentinel: %q", got)
 	}
 }
+
+func TestRunLinesReportsEachStdoutLine(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	var lines []string
+	res, err := RunLines(context.Background(), New(), "", "sh", func(line string) {
+		lines = append(lines, line)
+	}, "-c", `printf 'one\n\ntwo\nthree'`)
+	if err != nil {
+		t.Fatalf("RunLines() error = %v", err)
+	}
+	if got := strings.Join(lines, "|"); got != "one||two|three" {
+		t.Fatalf("lines = %q", got)
+	}
+	if res.Stdout != "one\n\ntwo\nthree" {
+		t.Fatalf("Stdout = %q", res.Stdout)
+	}
+}
+
+func TestRunEnvAddsToInheritedEnvironment(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	t.Setenv("DOTSTATE_TEST_INHERITED", "kept")
+	res, err := RunEnv(context.Background(), New(), "", "sh", []string{"DOTSTATE_TEST_ADDED=added"},
+		"-c", `printf '%s %s' "$DOTSTATE_TEST_INHERITED" "$DOTSTATE_TEST_ADDED"`)
+	if err != nil {
+		t.Fatalf("RunEnv() error = %v", err)
+	}
+	if res.Stdout != "kept added" {
+		t.Fatalf("Stdout = %q, want both variables", res.Stdout)
+	}
+}
+
+func TestRunTruncatesOutputAndSpillsTheRest(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	r := &ExecRunner{MaxOutput: 8, SpillDir: t.TempDir()}
+	res, err := r.Run(context.Background(), "", "sh", "-c", `printf '0123456789abcdef'; printf 'oops, a long failure' >&2; exit 3`)
+	var runErr *RunError
+	if !errors.As(err, &runErr) || runErr.Code != 3 {
+		t.Fatalf("Run() error = %v, want exit 3", err)
+	}
+	if !strings.HasPrefix(res.Stdout, "01234567\n[output truncated at 8 bytes; 8 more bytes written to ") {
+		t.Fatalf("Stdout = %q", res.Stdout)
+	}
+	spilled, err := os.ReadFile(res.StdoutSpill)
+	if err != nil || string(spilled) != "89abcdef" {
+		t.Fatalf("stdout spill = %q, %v", spilled, err)
+	}
+	if runErr.StderrSpill == "" || !strings.Contains(runErr.Error(), res.StdoutSpill) || !strings.Contains(runErr.Error(), runErr.StderrSpill) {
+		t.Fatalf("RunError = %q; want both spill files referenced", runErr.Error())
+	}
+}
+
+func TestRunLogsCommandOutputAtDebugLevel(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	const sentinel = "DOTSTATE_TEST_SECRET_DO_NOT_PRINT"
+	var buf bytes.Buffer
+	r := New()
+	r.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	_, _ = r.Run(context.Background(), "", "sh", "-c", `echo "token=`+sentinel+`"; echo broken >&2; exit 2`)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log = %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "external command" || record["cmd"] != "sh" || record["exit_code"] != float64(2) || record["stderr"] != "broken\n" {
+		t.Fatalf("record = %v", record)
+	}
+	if strings.Contains(buf.String(), sentinel) || !strings.Contains(record["stdout"].(string), "<redacted:") {
+		t.Fatalf("stdout not redacted: %q", record["stdout"])
+	}
+
+	buf.Reset()
+	r.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	_, _ = r.Run(context.Background(), "", "sh", "-c", "true")
+	if buf.Len() != 0 {
+		t.Fatalf("info-level logger recorded %q", buf.String())
+	}
+}
+
+func TestRunSensitiveKeepsOutputOutOfLogsAndSpills(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat not available")
+	}
+	const plaintext = "wifi passphrase: correct horse battery staple"
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte(plaintext), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	spills := t.TempDir()
+	r := &ExecRunner{MaxOutput: 8, SpillDir: spills}
+	r.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	res, err := RunSensitive(context.Background(), r, "", "cat", secret)
+	if err != nil || res.Stdout != plaintext {
+		t.Fatalf("RunSensitive() = %+v, %v; want the full plaintext", res, err)
+	}
+	if strings.Contains(buf.String(), "correct horse") || !strings.Contains(buf.String(), "not logged (sensitive)") {
+		t.Fatalf("log = %q", buf.String())
+	}
+	if entries, _ := os.ReadDir(spills); len(entries) != 0 || res.StdoutSpill != "" {
+		t.Fatalf("spilled %d files", len(entries))
+	}
+}
+
+func TestPlanRunnerRecordsWithoutRunning(t *testing.T) {
+	r := &PlanRunner{}
+	res, err := r.Run(context.Background(), t.TempDir(), "definitely-not-a-command", "commit", "-m", "it's done")
+	if err != nil || res.Code != 0 {
+		t.Fatalf("Run() = %+v, %v; want an empty success", res, err)
+	}
+	planned := r.Planned()
+	if len(planned) != 1 {
+		t.Fatalf("Planned() = %+v", planned)
+	}
+	if got, want := planned[0].String(), `definitely-not-a-command commit -m 'it'\''s done'`; got != want {
+		t.Fatalf("String() = %s, want %s", got, want)
+	}
+}
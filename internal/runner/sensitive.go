@@ -0,0 +1,20 @@
+package runner
+
+import "context"
+
+// SensitiveRunner is implemented by runners that can run a command whose
+// output must never be recorded, such as a decryption that prints
+// plaintext.
+type SensitiveRunner interface {
+	RunSensitive(ctx context.Context, dir, name string, args ...string) (*CmdResult, error)
+}
+
+// RunSensitive runs the command with r, keeping its output out of logs and
+// spill files. Runners that are not SensitiveRunners record nothing and run
+// the command as usual.
+func RunSensitive(ctx context.Context, r Runner, dir, name string, args ...string) (*CmdResult, error) {
+	if sr, ok := r.(SensitiveRunner); ok {
+		return sr.RunSensitive(ctx, dir, name, args...)
+	}
+	return r.Run(ctx, dir, name, args...)
+}
@@ -186,9 +186,133 @@ func TestOptionsFromConfigMakesConfigPathAbsolute(t *testing.T) {
 }
 
 func TestUnsupportedPlatform(t *testing.T) {
-	m := &Manager{Home: testutil.TempDir(t), OS: "linux", UID: "501"}
+	m := &Manager{Home: testutil.TempDir(t), OS: "plan9", UID: "501"}
 	_, err := m.Inspect(context.Background())
 	if err != ErrUnsupported {
 		t.Fatalf("Inspect error = %v, want ErrUnsupported", err)
 	}
 }
+
+func TestRenderSystemdUnitsQuoteArgumentsAndRunEveryInterval(t *testing.T) {
+	opts := InstallOptions{
+		DotBin:          "/home/test/bin/dot",
+		ConfigPath:      "/home/test/my dots/dot.toml",
+		RepoRoot:        "/home/test/my dots",
+		LogDir:          "/home/test/my dots/state/logs",
+		IntervalMinutes: 45,
+	}
+	service := RenderSystemdService(opts)
+	for _, want := range []string{
+		"Type=oneshot",
+		"Environment=DOTSTATE_SCHEDULED=1",
+		`ExecStart="/home/test/bin/dot" "--config" "/home/test/my dots/dot.toml" "sync"`,
+		"WorkingDirectory=/home/test/my dots",
+		"StandardOutput=append:/home/test/my dots/state/logs/schedule.out.log",
+		Label,
+	} {
+		if !strings.Contains(service, want) {
+			t.Fatalf("service missing %q:\n%s", want, service)
+		}
+	}
+	timer := RenderSystemdTimer(opts)
+	for _, want := range []string{"OnUnitActiveSec=45min", "Unit=dotstate-sync.service", "WantedBy=timers.target", Label} {
+		if !strings.Contains(timer, want) {
+			t.Fatalf("timer missing %q:\n%s", want, timer)
+		}
+	}
+	if got := systemdQuote(`50% $HOME "x"`); got != `"50%% $$HOME \"x\""` {
+		t.Fatalf("systemdQuote = %s", got)
+	}
+}
+
+func TestInstallWritesSystemdUnitsAndEnablesTimer(t *testing.T) {
+	ctx := context.Background()
+	home := testutil.TempDir(t)
+	r := testutil.NewMockRunner(t)
+	r.OnCommandSuccess(testutil.MatchExact("systemctl", "--user", "daemon-reload"), "")
+	r.OnCommandSuccess(testutil.MatchExact("systemctl", "--user", "enable", "--now", "dotstate-sync.timer"), "")
+	r.OnCommandSuccess(testutil.MatchExact("systemctl", "--user", "is-active", "dotstate-sync.timer"), "active\n")
+	r.OnCommandSuccess(testutil.MatchExact("systemctl", "--user", "disable", "--now", "dotstate-sync.timer"), "")
+
+	m := &Manager{Home: home, OS: "linux", Runner: r}
+	status, err := m.Install(ctx, InstallOptions{
+		DotBin:          "/bin/dot",
+		ConfigPath:      filepath.Join(home, "repo", "dot.toml"),
+		RepoRoot:        filepath.Join(home, "repo"),
+		LogDir:          filepath.Join(home, "repo", "state", "logs"),
+		IntervalMinutes: 30,
+	})
+	if err != nil {
+		t.Fatalf("Install error = %v", err)
+	}
+	if !status.Installed || !status.Loaded || status.Path != SystemdTimerPath(home) {
+		t.Fatalf("unexpected status: %#v", status)
+	}
+	for _, path := range []string{SystemdTimerPath(home), SystemdServicePath(home)} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("unit not written: %v", err)
+		}
+	}
+
+	status, err = m.Inspect(ctx)
+	if err != nil || !status.Installed || !status.Loaded {
+		t.Fatalf("Inspect = %#v, %v", status, err)
+	}
+	if _, err := m.Remove(ctx); err != nil {
+		t.Fatalf("Remove error = %v", err)
+	}
+	for _, path := range []string{SystemdTimerPath(home), SystemdServicePath(home)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("unit still present after Remove: %v", err)
+		}
+	}
+}
+
+func TestRemoveRefusesNonDotstateSystemdUnit(t *testing.T) {
+	home := testutil.TempDir(t)
+	testutil.TempFile(t, home, ".config/systemd/user/dotstate-sync.timer", "[Timer]\nOnCalendar=daily\n")
+	m := &Manager{Home: home, OS: "linux", Runner: testutil.NewMockRunner(t)}
+	if _, err := m.Remove(context.Background()); err == nil || !strings.Contains(err.Error(), "non-dotstate") {
+		t.Fatalf("Remove error = %v, want refusal", err)
+	}
+}
+
+func TestInstallWritesTaskScriptAndRegistersTask(t *testing.T) {
+	ctx := context.Background()
+	home := testutil.TempDir(t)
+	r := testutil.NewMockRunner(t)
+	r.OnCommandSuccess(testutil.MatchExact("schtasks", "/Create", "/F", "/TN", "dotstate-sync", "/SC", "MINUTE", "/MO", "30", "/TR", `"`+TaskScriptPath(home)+`"`), "")
+
+	m := &Manager{Home: home, OS: "windows", Runner: r}
+	status, err := m.Install(ctx, InstallOptions{
+		DotBin:          `C:\Tools\dot.exe`,
+		ConfigPath:      `C:\Users\test\dots\dot.toml`,
+		RepoRoot:        `C:\Users\test\dots`,
+		LogDir:          filepath.Join(home, "logs"),
+		IntervalMinutes: 30,
+	})
+	if err != nil {
+		t.Fatalf("Install error = %v", err)
+	}
+	if !status.Installed || !status.Loaded {
+		t.Fatalf("unexpected status: %#v", status)
+	}
+	content, err := os.ReadFile(TaskScriptPath(home))
+	if err != nil {
+		t.Fatalf("task script not written: %v", err)
+	}
+	for _, want := range []string{"set DOTSTATE_SCHEDULED=1\r\n", `"C:\Tools\dot.exe" "--config" "C:\Users\test\dots\dot.toml" "sync" >> `, Label} {
+		if !strings.Contains(string(content), want) {
+			t.Fatalf("task script missing %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestTaskScheduleUsesDaysBeyondMinuteLimit(t *testing.T) {
+	if got, err := taskSchedule(2880); err != nil || strings.Join(got, " ") != "/SC DAILY /MO 2" {
+		t.Fatalf("taskSchedule(2880) = %v, %v", got, err)
+	}
+	if _, err := taskSchedule(1500); err == nil {
+		t.Fatal("taskSchedule(1500) succeeded, want an error for a partial day")
+	}
+}
@@ -0,0 +1,164 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const taskScriptRelPath = "AppData/Local/dotstate/" + TaskName + ".cmd"
+
+// TaskScriptPath returns the script the Windows Scheduled Task runs. A
+// script carries the environment and log redirection that a task's command
+// line cannot hold within its length limit.
+func TaskScriptPath(home string) string {
+	return filepath.Join(home, filepath.FromSlash(taskScriptRelPath))
+}
+
+// installTask writes the task script and registers it with schtasks unless
+// NoLoad is set.
+func (m *Manager) installTask(ctx context.Context, opts InstallOptions) (*Status, error) {
+	schedule, err := taskSchedule(normalizedInterval(opts.IntervalMinutes))
+	if err != nil {
+		return nil, err
+	}
+	path := TaskScriptPath(m.Home)
+	owned, err := ownedByDotstate(path, "task script")
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, fmt.Errorf("refusing to overwrite non-dotstate task script at %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create task script directory: %w", err)
+	}
+	if err := os.MkdirAll(opts.LogDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create schedule log directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(RenderTaskScript(opts)), 0o644); err != nil {
+		return nil, fmt.Errorf("write task script: %w", err)
+	}
+
+	status := &Status{
+		Label:           TaskName,
+		Path:            path,
+		Installed:       true,
+		IntervalMinutes: normalizedInterval(opts.IntervalMinutes),
+		ProgramArgs:     programArgs(opts),
+		Message:         "Task script written but not registered (--no-load).",
+	}
+	if opts.NoLoad {
+		return status, nil
+	}
+	if m.Runner == nil {
+		return nil, errors.New("schedule install requires a command runner")
+	}
+	args := append([]string{"/Create", "/F", "/TN", TaskName}, schedule...)
+	args = append(args, "/TR", `"`+path+`"`)
+	if _, err := m.Runner.Run(ctx, "", "schtasks", args...); err != nil {
+		return nil, fmt.Errorf("register Scheduled Task: %w", err)
+	}
+	status.Loaded = true
+	status.Message = "Scheduled Task registered. It runs `dot sync` every interval while you are logged on."
+	return status, nil
+}
+
+// inspectTask reports whether the task script exists and whether the Task
+// Scheduler knows the task.
+func (m *Manager) inspectTask(ctx context.Context) (*Status, error) {
+	path := TaskScriptPath(m.Home)
+	status := &Status{Label: TaskName, Path: path}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			status.Message = "Scheduled Task is not installed."
+			return status, nil
+		}
+		return nil, fmt.Errorf("stat task script: %w", err)
+	}
+	status.Installed = true
+	if m.Runner == nil {
+		status.Message = "Task script exists; registration was not checked."
+		return status, nil
+	}
+	res, err := m.Runner.Run(ctx, "", "schtasks", "/Query", "/TN", TaskName)
+	if err != nil {
+		msg := ""
+		if res != nil {
+			msg = strings.TrimSpace(res.Stderr)
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		status.Message = "Task script exists but the Scheduled Task is not registered: " + msg
+		return status, nil
+	}
+	status.Loaded = true
+	status.Message = "Scheduled Task is installed and registered."
+	return status, nil
+}
+
+// removeTask deletes the Scheduled Task best-effort and removes the script.
+func (m *Manager) removeTask(ctx context.Context) (*Status, error) {
+	path := TaskScriptPath(m.Home)
+	owned, err := ownedByDotstate(path, "task script")
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, fmt.Errorf("refusing to remove non-dotstate task script at %s", path)
+	}
+	if m.Runner != nil {
+		_, _ = m.Runner.Run(ctx, "", "schtasks", "/Delete", "/TN", TaskName, "/F")
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("remove task script: %w", err)
+	}
+	return &Status{
+		Label:   TaskName,
+		Path:    path,
+		Message: "Scheduled Task and its script removed.",
+	}, nil
+}
+
+// RenderTaskScript renders the batch script the Scheduled Task runs.
+func RenderTaskScript(opts InstallOptions) string {
+	args := programArgs(opts)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = batchQuote(arg)
+	}
+	lines := []string{
+		"@echo off",
+		"rem Managed by dotstate (" + Label + ").",
+		"set " + EnvScheduled + "=1",
+		"cd /d " + batchQuote(opts.RepoRoot),
+		strings.Join(quoted, " ") +
+			" >> " + batchQuote(filepath.Join(opts.LogDir, "schedule.out.log")) +
+			" 2>> " + batchQuote(filepath.Join(opts.LogDir, "schedule.err.log")),
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// taskSchedule returns the schtasks /SC and /MO arguments for an interval.
+// MINUTE schedules stop at 1439 minutes; longer intervals must be whole
+// days.
+func taskSchedule(minutes int) ([]string, error) {
+	if minutes < 1440 {
+		return []string{"/SC", "MINUTE", "/MO", strconv.Itoa(minutes)}, nil
+	}
+	if minutes%1440 != 0 {
+		return nil, fmt.Errorf("scheduled task interval must be under 1440 minutes or a whole number of days, got %d minutes", minutes)
+	}
+	return []string{"/SC", "DAILY", "/MO", strconv.Itoa(minutes / 1440)}, nil
+}
+
+// batchQuote quotes one word for a cmd.exe batch file, where % starts a
+// variable reference.
+func batchQuote(value string) string {
+	return `"` + strings.ReplaceAll(value, "%", "%%") + `"`
+}
@@ -0,0 +1,188 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const systemdUserRelDir = ".config/systemd/user"
+
+// SystemdTimerPath returns the systemd user timer path for a home
+// directory.
+func SystemdTimerPath(home string) string {
+	return filepath.Join(home, systemdUserRelDir, TaskName+".timer")
+}
+
+// SystemdServicePath returns the systemd user service the timer starts.
+func SystemdServicePath(home string) string {
+	return filepath.Join(home, systemdUserRelDir, TaskName+".service")
+}
+
+// installSystemd writes a oneshot user service and a timer that starts it
+// every interval, then enables the timer unless NoLoad is set.
+func (m *Manager) installSystemd(ctx context.Context, opts InstallOptions) (*Status, error) {
+	timerPath, servicePath := SystemdTimerPath(m.Home), SystemdServicePath(m.Home)
+	for _, path := range []string{timerPath, servicePath} {
+		owned, err := ownedByDotstate(path, "systemd unit")
+		if err != nil {
+			return nil, err
+		}
+		if !owned {
+			return nil, fmt.Errorf("refusing to overwrite non-dotstate systemd unit at %s", path)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(timerPath), 0o755); err != nil {
+		return nil, fmt.Errorf("create systemd user directory: %w", err)
+	}
+	if err := os.MkdirAll(opts.LogDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create schedule log directory: %w", err)
+	}
+	if err := os.WriteFile(servicePath, []byte(RenderSystemdService(opts)), 0o644); err != nil {
+		return nil, fmt.Errorf("write systemd service: %w", err)
+	}
+	if err := os.WriteFile(timerPath, []byte(RenderSystemdTimer(opts)), 0o644); err != nil {
+		return nil, fmt.Errorf("write systemd timer: %w", err)
+	}
+
+	status := &Status{
+		Label:           TaskName + ".timer",
+		Path:            timerPath,
+		Installed:       true,
+		IntervalMinutes: normalizedInterval(opts.IntervalMinutes),
+		ProgramArgs:     programArgs(opts),
+		Message:         "systemd user timer written but not enabled (--no-load).",
+	}
+	if opts.NoLoad {
+		return status, nil
+	}
+	if m.Runner == nil {
+		return nil, errors.New("schedule install requires a command runner")
+	}
+	if _, err := m.Runner.Run(ctx, "", "systemctl", "--user", "daemon-reload"); err != nil {
+		return nil, fmt.Errorf("reload systemd user units: %w", err)
+	}
+	if _, err := m.Runner.Run(ctx, "", "systemctl", "--user", "enable", "--now", TaskName+".timer"); err != nil {
+		return nil, fmt.Errorf("enable systemd timer: %w", err)
+	}
+	status.Loaded = true
+	status.Message = "systemd user timer installed and enabled. It runs `dot sync` every interval while you are logged in; `loginctl enable-linger` keeps it running after logout."
+	return status, nil
+}
+
+// inspectSystemd reports whether the timer unit exists and whether systemd
+// reports it active.
+func (m *Manager) inspectSystemd(ctx context.Context) (*Status, error) {
+	path := SystemdTimerPath(m.Home)
+	status := &Status{Label: TaskName + ".timer", Path: path}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			status.Message = "systemd user timer is not installed."
+			return status, nil
+		}
+		return nil, fmt.Errorf("stat systemd timer: %w", err)
+	}
+	status.Installed = true
+	if m.Runner == nil {
+		status.Message = "systemd user timer exists; its state was not checked."
+		return status, nil
+	}
+	res, err := m.Runner.Run(ctx, "", "systemctl", "--user", "is-active", TaskName+".timer")
+	if err != nil {
+		state := ""
+		if res != nil {
+			state = strings.TrimSpace(res.Stdout)
+		}
+		if state == "" {
+			state = err.Error()
+		}
+		status.Message = "systemd user timer exists but is not active: " + state
+		return status, nil
+	}
+	status.Loaded = true
+	status.Message = "systemd user timer is installed and active."
+	return status, nil
+}
+
+// removeSystemd disables the timer best-effort and removes both units.
+func (m *Manager) removeSystemd(ctx context.Context) (*Status, error) {
+	timerPath, servicePath := SystemdTimerPath(m.Home), SystemdServicePath(m.Home)
+	for _, path := range []string{timerPath, servicePath} {
+		owned, err := ownedByDotstate(path, "systemd unit")
+		if err != nil {
+			return nil, err
+		}
+		if !owned {
+			return nil, fmt.Errorf("refusing to remove non-dotstate systemd unit at %s", path)
+		}
+	}
+	if m.Runner != nil {
+		_, _ = m.Runner.Run(ctx, "", "systemctl", "--user", "disable", "--now", TaskName+".timer")
+	}
+	for _, path := range []string{timerPath, servicePath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("remove systemd unit: %w", err)
+		}
+	}
+	if m.Runner != nil {
+		_, _ = m.Runner.Run(ctx, "", "systemctl", "--user", "daemon-reload")
+	}
+	return &Status{
+		Label:   TaskName + ".timer",
+		Path:    timerPath,
+		Message: "systemd user timer and service removed.",
+	}, nil
+}
+
+// RenderSystemdService renders the oneshot service that runs one sync.
+func RenderSystemdService(opts InstallOptions) string {
+	args := programArgs(opts)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = systemdQuote(arg)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Managed by dotstate (" + Label + ").\n")
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=dotstate sync\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=oneshot\n")
+	b.WriteString("WorkingDirectory=" + systemdEscape(opts.RepoRoot) + "\n")
+	b.WriteString("Environment=" + EnvScheduled + "=1\n")
+	b.WriteString("ExecStart=" + strings.Join(quoted, " ") + "\n")
+	b.WriteString("StandardOutput=append:" + systemdEscape(filepath.Join(opts.LogDir, "schedule.out.log")) + "\n")
+	b.WriteString("StandardError=append:" + systemdEscape(filepath.Join(opts.LogDir, "schedule.err.log")) + "\n")
+	return b.String()
+}
+
+// RenderSystemdTimer renders the timer that starts the service shortly
+// after login and then every interval.
+func RenderSystemdTimer(opts InstallOptions) string {
+	var b strings.Builder
+	b.WriteString("# Managed by dotstate (" + Label + ").\n")
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=Run dotstate sync every %d minutes\n\n", normalizedInterval(opts.IntervalMinutes))
+	b.WriteString("[Timer]\n")
+	b.WriteString("OnStartupSec=1min\n")
+	fmt.Fprintf(&b, "OnUnitActiveSec=%dmin\n", normalizedInterval(opts.IntervalMinutes))
+	b.WriteString("Unit=" + TaskName + ".service\n\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=timers.target\n")
+	return b.String()
+}
+
+// systemdEscape doubles the % that starts a systemd specifier.
+func systemdEscape(value string) string {
+	return strings.ReplaceAll(value, "%", "%%")
+}
+
+// systemdQuote quotes one ExecStart word, which systemd also scans for
+// $VARIABLE references.
+func systemdQuote(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$").Replace(systemdEscape(value))
+	return `"` + value + `"`
+}
@@ -0,0 +1,68 @@
+package secretaudit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/redact"
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+// WebhookNotifier posts the alert as JSON. The payload carries a Slack-style
+// "text" field alongside the structured alert.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	payload := struct {
+		Text string `json:"text"`
+		Alert
+	}{Text: alert.Message, Alert: alert}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %s", redact.Text(err.Error()))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// DesktopNotifier shows a macOS notification through osascript. Other
+// platforms are a no-op.
+type DesktopNotifier struct {
+	OS     string
+	Runner runner.Runner
+}
+
+func (n *DesktopNotifier) Notify(ctx context.Context, alert Alert) error {
+	if n.OS != "darwin" {
+		return nil
+	}
+	script := "display notification " + strconv.Quote(alert.Message) + " with title " + strconv.Quote(alert.Title)
+	if _, err := n.Runner.Run(ctx, "", "osascript", "-e", script); err != nil {
+		return fmt.Errorf("desktop notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package secretaudit runs the repo secret scan on a cadence and raises
+// notifications when findings appear that earlier audits had not seen.
+package secretaudit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/discover"
+)
+
+// State is the local record of previous scheduled audits.
+type State struct {
+	LastRun time.Time `json:"last_run"`
+	// Known holds fingerprints of findings already reported.
+	Known []string `json:"known"`
+}
+
+// LoadState reads the audit state; a missing file yields an empty state.
+func LoadState(path string) (*State, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read audit state: %w", err)
+	}
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("parse audit state: %w", err)
+	}
+	return &state, nil
+}
+
+// Save writes the audit state, creating its directory.
+func (s *State) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create audit state directory: %w", err)
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// Due reports whether an audit should run at now for the given interval.
+func (s *State) Due(interval time.Duration, now time.Time) bool {
+	if interval <= 0 {
+		return false
+	}
+	return s.LastRun.IsZero() || !now.Before(s.LastRun.Add(interval))
+}
+
+// Fingerprint identifies a finding across audits. Working-tree findings omit
+// the line so edits elsewhere in the file do not re-raise them.
+func Fingerprint(f discover.SecretFinding) string {
+	if f.Commit == "" {
+		return fmt.Sprintf("tree:%s:%s", f.File, f.PatternID)
+	}
+	return fmt.Sprintf("commit:%s:%s:%d:%s", f.Commit, f.File, f.Line, f.PatternID)
+}
+
+// Notifier delivers a new-findings alert.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Alert describes findings that earlier audits had not reported, or the
+// files a scheduled discovery pass recorded.
+type Alert struct {
+	Title      string                      `json:"title"`
+	Message    string                      `json:"message"`
+	Findings   []discover.SecretFinding    `json:"findings,omitempty"`
+	Candidates []discover.PendingCandidate `json:"candidates,omitempty"`
+}
+
+// Scanner runs one repo audit.
+type Scanner func(ctx context.Context) (*discover.ScanReport, error)
+
+// Options configures Run.
+type Options struct {
+	StatePath string
+	Interval  time.Duration
+	// Force runs even when the interval has not elapsed.
+	Force     bool
+	Scan      Scanner
+	Notifiers []Notifier
+	Now       func() time.Time
+}
+
+// Result reports what a scheduled audit did.
+type Result struct {
+	Ran         bool
+	Report      *discover.ScanReport
+	NewFindings []discover.SecretFinding
+	// NotifyErrors holds delivery failures; they do not fail the audit.
+	NotifyErrors []error
+}
+
+// Run audits the repo when due, alerts on new findings, and records state.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	result := &Result{}
+	state, err := LoadState(opts.StatePath)
+	if err != nil {
+		return result, err
+	}
+	if !opts.Force && !state.Due(opts.Interval, now()) {
+		return result, nil
+	}
+
+	report, err := opts.Scan(ctx)
+	if err != nil {
+		return result, fmt.Errorf("secret audit: %w", err)
+	}
+	result.Ran = true
+	result.Report = report
+
+	known := make(map[string]bool, len(state.Known))
+	for _, fp := range state.Known {
+		known[fp] = true
+	}
+	current := make([]string, 0, len(report.Findings))
+	for _, finding := range report.Findings {
+		fp := Fingerprint(finding)
+		current = append(current, fp)
+		if !known[fp] {
+			result.NewFindings = append(result.NewFindings, finding)
+		}
+	}
+
+	if len(result.NewFindings) > 0 {
+		alert := Alert{
+			Title:    "dotstate secret audit",
+			Message:  fmt.Sprintf("%d new potential secret(s) found in the dotstate repo; run dot scan --history for details.", len(result.NewFindings)),
+			Findings: result.NewFindings,
+		}
+		for _, notifier := range opts.Notifiers {
+			if err := notifier.Notify(ctx, alert); err != nil {
+				result.NotifyErrors = append(result.NotifyErrors, err)
+			}
+		}
+	}
+
+	// Only remember findings once every notifier delivered, so a failed
+	// webhook is retried on the next audit.
+	if len(result.NotifyErrors) == 0 {
+		sort.Strings(current)
+		state.Known = current
+	}
+	state.LastRun = now().UTC()
+	if err := state.Save(opts.StatePath); err != nil {
+		return result, err
+	}
+	return result, nil
+}
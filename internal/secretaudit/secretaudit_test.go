@@ -0,0 +1,124 @@
+package secretaudit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/discover"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+type recordingNotifier struct {
+	alerts []Alert
+	err    error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert Alert) error {
+	n.alerts = append(n.alerts, alert)
+	return n.err
+}
+
+func staticScan(findings ...discover.SecretFinding) Scanner {
+	return func(context.Context) (*discover.ScanReport, error) {
+		return &discover.ScanReport{Findings: findings}, nil
+	}
+}
+
+func TestRunAlertsOnlyOnNewFindings(t *testing.T) {
+	statePath := filepath.Join(testutil.TempDir(t), "audit", "secrets.json")
+	now := time.Date(2026, 5, 13, 0, 0, 0, 0, time.UTC)
+	first := discover.SecretFinding{File: "home/dot_netrc", Line: 3, PatternID: "github-token"}
+	second := discover.SecretFinding{File: "home/dot_zshrc", Line: 9, PatternID: "aws-access-key", Commit: "abc"}
+	notifier := &recordingNotifier{}
+
+	opts := Options{StatePath: statePath, Interval: 24 * time.Hour, Scan: staticScan(first), Notifiers: []Notifier{notifier}, Now: func() time.Time { return now }}
+	result, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Run error = %v", err)
+	}
+	if !result.Ran || len(result.NewFindings) != 1 || len(notifier.alerts) != 1 {
+		t.Fatalf("first run = %#v, alerts %d", result, len(notifier.alerts))
+	}
+
+	// Not due yet.
+	now = now.Add(time.Hour)
+	result, err = Run(context.Background(), opts)
+	if err != nil || result.Ran {
+		t.Fatalf("expected skipped run, got %#v, %v", result, err)
+	}
+
+	// Due again; the known finding moved lines and a new one appeared.
+	now = now.Add(24 * time.Hour)
+	first.Line = 5
+	opts.Scan = staticScan(first, second)
+	result, err = Run(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Run error = %v", err)
+	}
+	if len(result.NewFindings) != 1 || result.NewFindings[0].Commit != "abc" || len(notifier.alerts) != 2 {
+		t.Fatalf("third run new findings = %#v", result.NewFindings)
+	}
+}
+
+func TestRunRetriesAfterNotifierFailure(t *testing.T) {
+	statePath := filepath.Join(testutil.TempDir(t), "secrets.json")
+	finding := discover.SecretFinding{File: "a", Line: 1, PatternID: "jwt-token"}
+	notifier := &recordingNotifier{err: errors.New("offline")}
+	opts := Options{StatePath: statePath, Force: true, Scan: staticScan(finding), Notifiers: []Notifier{notifier}}
+
+	result, err := Run(context.Background(), opts)
+	if err != nil || len(result.NotifyErrors) != 1 {
+		t.Fatalf("Run = %#v, %v", result, err)
+	}
+	notifier.err = nil
+	result, err = Run(context.Background(), opts)
+	if err != nil || len(result.NewFindings) != 1 {
+		t.Fatalf("expected finding to be re-raised, got %#v, %v", result, err)
+	}
+}
+
+func TestDueDisabledWithoutInterval(t *testing.T) {
+	if (&State{}).Due(0, time.Now()) {
+		t.Fatal("zero interval should never be due")
+	}
+}
+
+func TestWebhookNotifierPostsJSON(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n := &WebhookNotifier{URL: server.URL}
+	alert := Alert{Title: "t", Message: "1 new potential secret(s)", Findings: []discover.SecretFinding{{File: "a", Line: 1, PatternID: "p", Match: "<redacted:secret>"}}}
+	if err := n.Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Notify error = %v", err)
+	}
+	if got["text"] != alert.Message || len(got["findings"].([]any)) != 1 {
+		t.Fatalf("payload = %#v", got)
+	}
+}
+
+func TestDesktopNotifierUsesOsascriptOnDarwin(t *testing.T) {
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("osascript", "-e"), "")
+	n := &DesktopNotifier{OS: "darwin", Runner: mock}
+	if err := n.Notify(context.Background(), Alert{Title: "dotstate", Message: "hi"}); err != nil {
+		t.Fatalf("Notify error = %v", err)
+	}
+	call := mock.LastCall()
+	if call == nil || !strings.Contains(call.Args[1], `display notification "hi"`) {
+		t.Fatalf("unexpected call %#v", call)
+	}
+}
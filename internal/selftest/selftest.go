@@ -0,0 +1,220 @@
+// Package selftest runs dotstate's file pipeline end to end against a
+// disposable repo and home, using the real git and apply engine, so a
+// broken install shows up as a failed stage rather than a failed sync.
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+)
+
+// Stages, in the order Run performs them.
+const (
+	StageInit    = "init"
+	StageAdd     = "add"
+	StageCapture = "capture"
+	StageCommit  = "commit"
+	StageApply   = "apply"
+)
+
+// Stage statuses.
+const (
+	StatusPass    = "pass"
+	StatusFail    = "fail"
+	StatusSkipped = "skipped"
+)
+
+// sourceDir is the source state directory inside the temp repo.
+const sourceDir = "home"
+
+// Env is the sandbox Run works in and the tools it drives.
+type Env struct {
+	// Dir holds the temp repo (Dir/repo) and home (Dir/home).
+	Dir string
+	Git *gitx.Git
+	// Engine must apply to Home, never the real home directory.
+	Engine chez.Engine
+}
+
+// Repo returns the temp repo path.
+func (e Env) Repo() string { return filepath.Join(e.Dir, "repo") }
+
+// Home returns the temp home path.
+func (e Env) Home() string { return filepath.Join(e.Dir, "home") }
+
+// StageResult is one stage's outcome.
+type StageResult struct {
+	Name     string
+	Status   string
+	Detail   string
+	Duration time.Duration
+}
+
+// Report lists every stage in order.
+type Report struct {
+	Stages []StageResult
+}
+
+// OK reports whether every stage passed.
+func (r *Report) OK() bool {
+	for _, stage := range r.Stages {
+		if stage.Status != StatusPass {
+			return false
+		}
+	}
+	return true
+}
+
+// Run initializes a repo, adds a home file to its source state, captures an
+// edit to it, commits, and applies a source change back to home, checking
+// the result of each step. After the first failure the remaining stages
+// are skipped.
+func Run(ctx context.Context, env Env) *Report {
+	target := filepath.Join(env.Home(), ".dotstate-selftest")
+	stages := []struct {
+		name string
+		run  func() (string, error)
+	}{
+		{StageInit, func() (string, error) { return initRepo(ctx, env) }},
+		{StageAdd, func() (string, error) {
+			if err := os.WriteFile(target, []byte("added\n"), 0o644); err != nil {
+				return "", err
+			}
+			if err := env.Engine.Add(ctx, env.Repo(), sourceDir, []string{target}, "error"); err != nil {
+				return "", err
+			}
+			return expectSource(ctx, env, target, "added\n")
+		}},
+		{StageCapture, func() (string, error) {
+			if err := os.WriteFile(target, []byte("captured\n"), 0o644); err != nil {
+				return "", err
+			}
+			if err := env.Engine.ReAdd(ctx, env.Repo(), sourceDir); err != nil {
+				return "", err
+			}
+			return expectSource(ctx, env, target, "captured\n")
+		}},
+		{StageCommit, func() (string, error) {
+			committed, err := env.Git.Commit(ctx, env.Repo(), "selftest: capture")
+			if err != nil {
+				return "", err
+			}
+			if !committed {
+				return "", fmt.Errorf("nothing was committed")
+			}
+			head, err := env.Git.RevParse(ctx, env.Repo(), "HEAD")
+			if err != nil {
+				return "", err
+			}
+			return "committed " + shortHash(head), nil
+		}},
+		{StageApply, func() (string, error) {
+			src, err := env.Engine.SourcePath(ctx, env.Repo(), sourceDir, target)
+			if err != nil {
+				return "", err
+			}
+			if err := os.WriteFile(src, []byte("applied\n"), 0o644); err != nil {
+				return "", err
+			}
+			if err := env.Engine.Apply(ctx, env.Repo(), sourceDir); err != nil {
+				return "", err
+			}
+			got, err := os.ReadFile(target)
+			if err != nil {
+				return "", err
+			}
+			if !bytes.Equal(got, []byte("applied\n")) {
+				return "", fmt.Errorf("home file has %q after apply, want %q", got, "applied\n")
+			}
+			return "source change reached home", nil
+		}},
+	}
+
+	report := &Report{}
+	failed := false
+	for _, stage := range stages {
+		if failed {
+			report.Stages = append(report.Stages, StageResult{Name: stage.name, Status: StatusSkipped})
+			continue
+		}
+		start := time.Now()
+		detail, err := stage.run()
+		result := StageResult{Name: stage.name, Status: StatusPass, Detail: detail, Duration: time.Since(start)}
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			result.Status, result.Detail = StatusFail, err.Error()
+			failed = true
+		}
+		report.Stages = append(report.Stages, result)
+	}
+	return report
+}
+
+// initRepo creates the repo with a dot.toml that loads, and the home.
+func initRepo(ctx context.Context, env Env) (string, error) {
+	for _, dir := range []string{filepath.Join(env.Repo(), sourceDir), env.Home()} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+	}
+	dotToml := fmt.Sprintf("[repo]\npath = %q\nbranch = \"main\"\n\n[chex]\nsource_dir = %q\n", env.Repo(), sourceDir)
+	cfgPath := filepath.Join(env.Repo(), "dot.toml")
+	if err := os.WriteFile(cfgPath, []byte(dotToml), 0o644); err != nil {
+		return "", err
+	}
+	if _, err := config.Load(cfgPath); err != nil {
+		return "", err
+	}
+	if _, err := env.Git.R.Run(ctx, env.Repo(), env.Git.Bin, "init", "--quiet"); err != nil {
+		return "", err
+	}
+	// A repo-local identity keeps the commit stage independent of the
+	// user's git config; doctor checks that separately.
+	if err := env.Git.ConfigSetLocal(ctx, env.Repo(), "user.name", "dotstate selftest"); err != nil {
+		return "", err
+	}
+	if err := env.Git.ConfigSetLocal(ctx, env.Repo(), "user.email", "selftest@dotstate.invalid"); err != nil {
+		return "", err
+	}
+	if err := env.Git.ConfigSetLocal(ctx, env.Repo(), "commit.gpgsign", "false"); err != nil {
+		return "", err
+	}
+	return env.Repo(), nil
+}
+
+// expectSource checks that target's source state holds want.
+func expectSource(ctx context.Context, env Env, target, want string) (string, error) {
+	src, err := env.Engine.SourcePath(ctx, env.Repo(), sourceDir, target)
+	if err != nil {
+		return "", err
+	}
+	got, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	if string(got) != want {
+		return "", fmt.Errorf("source %s has %q, want %q", filepath.Base(src), got, want)
+	}
+	rel, err := filepath.Rel(env.Repo(), src)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
@@ -0,0 +1,56 @@
+package selftest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/native"
+	"github.com/dnery/dotstate/dot/internal/runner"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestRunPassesEveryStageWithNativeEngine(t *testing.T) {
+	testutil.RequireGit(t)
+	t.Setenv("GIT_CONFIG_GLOBAL", "/dev/null")
+	env := Env{Dir: t.TempDir(), Git: gitx.New("git", runner.New())}
+	env.Engine = native.New(env.Home(), native.ModeCopy)
+
+	report := Run(context.Background(), env)
+	if !report.OK() {
+		t.Fatalf("Run() stages = %+v, want all passed", report.Stages)
+	}
+	want := []string{StageInit, StageAdd, StageCapture, StageCommit, StageApply}
+	if len(report.Stages) != len(want) {
+		t.Fatalf("Run() ran %d stages, want %d", len(report.Stages), len(want))
+	}
+	for i, stage := range report.Stages {
+		if stage.Name != want[i] {
+			t.Errorf("stage %d = %q, want %q", i, stage.Name, want[i])
+		}
+	}
+	if got := report.Stages[1].Detail; got != filepath.ToSlash(filepath.Join(sourceDir, "dot_dotstate-selftest")) {
+		t.Errorf("add detail = %q, want the source path", got)
+	}
+}
+
+func TestRunSkipsStagesAfterAFailure(t *testing.T) {
+	dir := t.TempDir()
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandFailure(testutil.MatchCommandPrefix("git", "init"), "git: broken", 1)
+	env := Env{Dir: dir, Git: gitx.New("git", mock), Engine: native.New(filepath.Join(dir, "home"), native.ModeCopy)}
+
+	report := Run(context.Background(), env)
+	if report.OK() {
+		t.Fatal("Run() reported OK with git init failing")
+	}
+	if report.Stages[0].Status != StatusFail {
+		t.Fatalf("init status = %q, want %q", report.Stages[0].Status, StatusFail)
+	}
+	for _, stage := range report.Stages[1:] {
+		if stage.Status != StatusSkipped {
+			t.Errorf("%s status = %q, want %q", stage.Name, stage.Status, StatusSkipped)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Package supportbundle builds the diagnostic archive users attach to bug
+// reports: version info, doctor output, a scrubbed copy of dot.toml, the
+// tails of the dotstate logs, and the last recorded sync error. Every file
+// passes through redaction before it is written to the archive.
+package supportbundle
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	toml "github.com/pelletier/go-toml/v2"
+
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+// DefaultMaxLogBytes is how much of the end of each log file is included.
+const DefaultMaxLogBytes = 256 * 1024
+
+// SyncFailedMessage is the log message recorded when dot sync fails; the
+// newest such entry becomes last-sync-error.txt.
+const SyncFailedMessage = "sync failed"
+
+// scrubbed replaces config values that may be sensitive.
+const scrubbed = "<scrubbed>"
+
+// Options describes what goes into the bundle.
+type Options struct {
+	// Output is the archive path to write.
+	Output string
+	// Version is the `dot version` text.
+	Version string
+	// Doctor is the captured `dot doctor` output.
+	Doctor string
+	// ConfigPath is dot.toml; empty when no config was found.
+	ConfigPath string
+	// LogDir holds dot.log and the schedule logs.
+	LogDir string
+	// MaxLogBytes bounds each included log; 0 uses DefaultMaxLogBytes.
+	MaxLogBytes int64
+	// Now stamps the manifest; zero uses time.Now.
+	Now time.Time
+}
+
+// Result lists the archive and the files written into it.
+type Result struct {
+	Path  string
+	Files []string
+}
+
+// Write builds the archive at opts.Output. Missing inputs are noted in the
+// bundle's manifest rather than failing it.
+func Write(opts Options) (*Result, error) {
+	if opts.MaxLogBytes <= 0 {
+		opts.MaxLogBytes = DefaultMaxLogBytes
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	files := map[string]string{}
+	var notes []string
+	files["version.txt"] = opts.Version
+	files["doctor.txt"] = opts.Doctor
+
+	if opts.ConfigPath == "" {
+		notes = append(notes, "config: not found")
+	} else if cfg, err := ScrubConfig(opts.ConfigPath); err != nil {
+		notes = append(notes, "config: "+err.Error())
+	} else {
+		files["config/dot.toml"] = cfg
+	}
+
+	if opts.LogDir != "" {
+		logs, err := filepath.Glob(filepath.Join(opts.LogDir, "*.log"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range logs {
+			tail, err := readTail(path, opts.MaxLogBytes)
+			if err != nil {
+				notes = append(notes, fmt.Sprintf("log %s: %v", filepath.Base(path), err))
+				continue
+			}
+			files["logs/"+filepath.Base(path)] = tail
+		}
+		if entry, err := LastSyncError(filepath.Join(opts.LogDir, "dot.log")); err != nil {
+			notes = append(notes, "last sync error: "+err.Error())
+		} else if entry != "" {
+			files["last-sync-error.txt"] = entry
+		}
+	}
+	if _, ok := files["last-sync-error.txt"]; !ok {
+		notes = append(notes, "last sync error: none recorded")
+	}
+
+	names := make([]string, 0, len(files)+1)
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	manifest := fmt.Sprintf("dotstate support bundle\ncreated: %s\nfiles:\n", opts.Now.UTC().Format(time.RFC3339))
+	for _, name := range names {
+		manifest += "  " + name + "\n"
+	}
+	for _, note := range notes {
+		manifest += "note: " + note + "\n"
+	}
+	files["MANIFEST.txt"] = manifest
+	names = append([]string{"MANIFEST.txt"}, names...)
+
+	if err := os.MkdirAll(filepath.Dir(opts.Output), 0o755); err != nil {
+		return nil, fmt.Errorf("create bundle directory: %w", err)
+	}
+	f, err := os.OpenFile(opts.Output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create bundle: %w", err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range names {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: opts.Now})
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("write bundle: %w", err)
+		}
+		if _, err := io.WriteString(w, redact.Text(files[name])); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("write bundle: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("write bundle: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("write bundle: %w", err)
+	}
+	return &Result{Path: opts.Output, Files: names}, nil
+}
+
+// ScrubConfig returns dot.toml with sensitive values replaced: webhook
+// URLs, template data and secret references, and any key that names a
+// token, secret, password, or key.
+func ScrubConfig(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read config: %w", err)
+	}
+	var doc map[string]any
+	if err := toml.Unmarshal(b, &doc); err != nil {
+		return "", fmt.Errorf("parse config: %w", err)
+	}
+	scrubTable(doc, "")
+	out, err := toml.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("encode config: %w", err)
+	}
+	return string(out), nil
+}
+
+func scrubTable(table map[string]any, prefix string) {
+	for key, value := range table {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		if sensitiveKey(name) {
+			table[key] = scrubbed
+			continue
+		}
+		if sub, ok := value.(map[string]any); ok {
+			scrubTable(sub, name)
+		}
+	}
+}
+
+// sensitiveKey reports whether a dotted config key may hold a secret.
+func sensitiveKey(name string) bool {
+	switch {
+	case strings.HasPrefix(name, "templates.data."), strings.HasPrefix(name, "templates.secrets."):
+		return true
+	}
+	key := strings.ToLower(name[strings.LastIndex(name, ".")+1:])
+	if key == "webhook_url" {
+		return true
+	}
+	for _, word := range []string{"token", "secret", "password", "passwd", "apikey", "api_key", "private_key"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// LastSyncError returns the newest SyncFailedMessage entry in the JSON log
+// at path, or "" when there is none.
+func LastSyncError(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var last string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry struct {
+			Msg string `json:"msg"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Msg == SyncFailedMessage {
+			last = scanner.Text()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if last == "" {
+		return "", nil
+	}
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, []byte(last), "", "  ") != nil {
+		return last + "\n", nil
+	}
+	return pretty.String() + "\n", nil
+}
+
+// readTail returns up to max bytes from the end of path, starting at a line
+// boundary when truncated.
+func readTail(path string, max int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := info.Size() - max
+	if offset < 0 {
+		offset = 0
+	}
+	b := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(b, offset); err != nil && err != io.EOF {
+		return "", err
+	}
+	if offset > 0 {
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			b = b[i+1:]
+		}
+		return fmt.Sprintf("[truncated to the last %d bytes]\n%s", len(b), b), nil
+	}
+	return string(b), nil
+}
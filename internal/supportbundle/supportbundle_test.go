@@ -0,0 +1,120 @@
+package supportbundle
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteRedactsAndScrubs(t *testing.T) {
+	const sentinel = "DOTSTATE_TEST_SECRET_DO_NOT_PRINT"
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "dot.toml")
+	cfg := `[repo]
+path = "~/dotstate"
+
+[audit]
+webhook_url = "https://hooks.example.com/T000/B000/abcdef"
+
+[templates.data]
+email = "me@example.com"
+`
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logDir := filepath.Join(dir, "state", "logs")
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	log := `{"time":"2026-01-01T00:00:00Z","level":"ERROR","msg":"sync failed","error":"first"}
+{"time":"2026-01-02T00:00:00Z","level":"INFO","msg":"syncing"}
+{"time":"2026-01-03T00:00:00Z","level":"ERROR","msg":"sync failed","error":"push rejected ` + sentinel + `"}
+`
+	if err := os.WriteFile(filepath.Join(logDir, "dot.log"), []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "bundle.zip")
+	result, err := Write(Options{
+		Output:     out,
+		Version:    "dot test\n",
+		Doctor:     "token=" + sentinel + "\n",
+		ConfigPath: cfgPath,
+		LogDir:     logDir,
+		Now:        time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	files := readZip(t, result.Path)
+	for _, name := range []string{"MANIFEST.txt", "version.txt", "doctor.txt", "config/dot.toml", "logs/dot.log", "last-sync-error.txt"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle missing %s; have %v", name, result.Files)
+		}
+	}
+	for name, content := range files {
+		if strings.Contains(content, sentinel) {
+			t.Errorf("%s leaked sentinel:\n%s", name, content)
+		}
+	}
+	if c := files["config/dot.toml"]; strings.Contains(c, "hooks.example.com") || strings.Contains(c, "me@example.com") || !strings.Contains(c, "~/dotstate") {
+		t.Errorf("config not scrubbed as expected:\n%s", c)
+	}
+	if e := files["last-sync-error.txt"]; !strings.Contains(e, "push rejected") || strings.Contains(e, "first") {
+		t.Errorf("last-sync-error.txt = %q, want newest sync failure", e)
+	}
+}
+
+func TestWriteWithoutConfig(t *testing.T) {
+	dir := t.TempDir()
+	result, err := Write(Options{Output: filepath.Join(dir, "b.zip"), Version: "v", Doctor: "d"})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	manifest := readZip(t, result.Path)["MANIFEST.txt"]
+	if !strings.Contains(manifest, "config: not found") || !strings.Contains(manifest, "last sync error: none recorded") {
+		t.Fatalf("manifest = %q", manifest)
+	}
+}
+
+func TestReadTailTruncatesAtLineBoundary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.log")
+	if err := os.WriteFile(path, []byte("aaaa\nbbbb\ncccc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readTail(path, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(got, "\ncccc\n") || strings.Contains(got, "bbbb") {
+		t.Fatalf("readTail() = %q", got)
+	}
+}
+
+func readZip(t *testing.T, path string) map[string]string {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("open bundle: %v", err)
+	}
+	defer zr.Close()
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+	}
+	return files
+}
@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	doterrors "github.com/dnery/dotstate/dot/internal/errors"
+	"github.com/dnery/dotstate/dot/internal/glob"
+)
+
+// ResolvedConflict records a rebase conflict settled by a [sync.conflicts]
+// policy, or by hand through Syncer.ResolveConflicts with Policy manual.
+type ResolvedConflict struct {
+	Path   string `json:"path"`
+	Policy string `json:"policy"`
+}
+
+// ErrConflictAborted is returned by Syncer.ResolveConflicts when the user
+// gives up on resolving; the sync then aborts the rebase.
+var ErrConflictAborted = errors.New("conflict resolution aborted")
+
+// maxRebaseSteps bounds how many conflicting commits we try to replay
+// automatically before giving up and handing control back to the user.
+const maxRebaseSteps = 50
+
+// ConflictPolicy returns the configured policy for a repo-relative path. Paths
+// with no matching rule are manual.
+func ConflictPolicy(cfg *config.Config, p string) string {
+	p = strings.TrimPrefix(path.Clean(strings.ReplaceAll(p, `\`, "/")), "./")
+	for _, pattern := range cfg.ConflictPatterns() {
+		if glob.Match(pattern, p) {
+			return cfg.Sync.Conflicts[pattern]
+		}
+	}
+	return config.ConflictManual
+}
+
+// resolveRebaseConflicts applies [sync.conflicts] policies to a failed
+// pull/rebase and hands the rest to ResolveConflicts, step by step. It
+// returns nil once the rebase has completed, or an error describing what
+// still needs a human. When the user aborts, the rebase is rolled back and
+// a conflict error returned.
+func (s *Syncer) resolveRebaseConflicts(ctx context.Context, report *SyncReport, pullErr error) error {
+	if len(s.Cfg.Sync.Conflicts) == 0 && s.ResolveConflicts == nil {
+		return s.pullError(ctx, pullErr)
+	}
+
+	repo := s.Cfg.Repo.Path
+	lastErr := pullErr
+	for step := 0; step < maxRebaseSteps; step++ {
+		files, err := s.Git.ConflictedFiles(ctx, repo)
+		if err != nil {
+			return fmt.Errorf("list conflicts: %w", err)
+		}
+		if len(files) == 0 {
+			return s.pullError(ctx, lastErr)
+		}
+
+		var ours, theirs, manual []string
+		for _, file := range files {
+			switch ConflictPolicy(s.Cfg, file) {
+			case config.ConflictOurs:
+				ours = append(ours, file)
+			case config.ConflictTheirs:
+				theirs = append(theirs, file)
+			default:
+				manual = append(manual, file)
+			}
+		}
+		if len(manual) > 0 && s.ResolveConflicts == nil {
+			status, _ := s.Git.PorcelainStatus(ctx, repo)
+			return doterrors.NewConflictError(
+				"git pull/rebase produced conflicts that require manual resolution",
+				"manual paths:\n  "+strings.Join(manual, "\n  ")+"\n"+formatStatusDetails(status)+
+					"\nResolve conflicts in the repo, then run git rebase --continue or abort and retry dot sync.",
+			)
+		}
+
+		// During a rebase git's sides are inverted: "ours" is the upstream
+		// being rebased onto and "theirs" is the local commit being replayed.
+		if err := s.Git.CheckoutConflictSide(ctx, repo, "theirs", ours...); err != nil {
+			return fmt.Errorf("resolve conflicts with local version: %w", err)
+		}
+		if err := s.Git.CheckoutConflictSide(ctx, repo, "ours", theirs...); err != nil {
+			return fmt.Errorf("resolve conflicts with remote version: %w", err)
+		}
+		for _, file := range ours {
+			report.ResolvedConflicts = append(report.ResolvedConflicts, ResolvedConflict{Path: file, Policy: config.ConflictOurs})
+		}
+		for _, file := range theirs {
+			report.ResolvedConflicts = append(report.ResolvedConflicts, ResolvedConflict{Path: file, Policy: config.ConflictTheirs})
+		}
+		if len(manual) > 0 {
+			if err := s.ResolveConflicts(ctx, manual); err != nil {
+				if abortErr := s.Git.RebaseAbort(ctx, repo); abortErr != nil {
+					return fmt.Errorf("%w; aborting the rebase also failed: %v", err, abortErr)
+				}
+				report.ResolvedConflicts = nil
+				if errors.Is(err, ErrConflictAborted) {
+					return doterrors.NewConflictError(
+						"sync stopped at conflicts; the pull/rebase was rolled back",
+						"Local commits are intact. Run dot sync again to retry, or resolve with git pull --rebase in the repo.",
+					)
+				}
+				return fmt.Errorf("resolve conflicts: %w", err)
+			}
+			for _, file := range manual {
+				report.ResolvedConflicts = append(report.ResolvedConflicts, ResolvedConflict{Path: file, Policy: config.ConflictManual})
+			}
+		}
+
+		lastErr = s.Git.RebaseContinue(ctx, repo)
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return s.pullError(ctx, fmt.Errorf("gave up after %d automatically resolved rebase steps: %w", maxRebaseSteps, lastErr))
+}
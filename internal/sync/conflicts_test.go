@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/config"
+	doterrors "github.com/dnery/dotstate/dot/internal/errors"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestConflictPolicyPrefersMostSpecificPattern(t *testing.T) {
+	cfg := config.Default()
+	cfg.Sync.Conflicts = map[string]string{
+		"home/**":                 config.ConflictOurs,
+		"home/dot_cache/**":       config.ConflictTheirs,
+		"*.lock":                  config.ConflictTheirs,
+		"home/dot_config/app.tml": config.ConflictManual,
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"home/dot_cache/zsh/compdump", config.ConflictTheirs},
+		{"home/dot_zshrc", config.ConflictOurs},
+		{"home/dot_config/app.tml", config.ConflictManual},
+		{"state/macos/Brewfile.lock", config.ConflictTheirs},
+		{"state/macos/apps.toml", config.ConflictManual},
+	}
+	for _, tt := range tests {
+		if got := ConflictPolicy(cfg, tt.path); got != tt.want {
+			t.Errorf("ConflictPolicy(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSyncResolvesConflictsByPolicy(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	cfg.Sync.Conflicts = map[string]string{
+		"home/dot_cache/**": config.ConflictTheirs,
+		"home/dot_zshrc":    config.ConflictOurs,
+	}
+
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "re-add"}, "", "", nil)
+	r.Expect("git", []string{"status", "--porcelain"}, " M home/dot_zshrc\n", "", nil)
+	r.Expect("git", []string{"add", "-A"}, "", "", nil)
+	r.Expect("git", []string{"commit", "-m", "dot sync from test-host at 2026-05-13T00:00:00Z"}, "", "", nil)
+	r.Expect("git", []string{"pull", "--rebase", "--autostash"}, "", "conflict", fmt.Errorf("pull failed"))
+	r.Expect("git", []string{"diff", "--name-only", "--diff-filter=U"}, "home/dot_cache/compdump\nhome/dot_zshrc\n", "", nil)
+	r.Expect("git", []string{"checkout", "--theirs", "--", "home/dot_zshrc"}, "", "", nil)
+	r.Expect("git", []string{"add", "--", "home/dot_zshrc"}, "", "", nil)
+	r.Expect("git", []string{"checkout", "--ours", "--", "home/dot_cache/compdump"}, "", "", nil)
+	r.Expect("git", []string{"add", "--", "home/dot_cache/compdump"}, "", "", nil)
+	r.Expect("git", []string{"-c", "core.editor=true", "rebase", "--continue"}, "", "", nil)
+	r.Expect("git", []string{"show", "--numstat", "--format=", "HEAD"}, "", "", nil)
+
+	oldDefaultCommitMessage := defaultCommitMessage
+	defaultCommitMessage = func(host string) string { return "dot sync from test-host at 2026-05-13T00:00:00Z" }
+	t.Cleanup(func() { defaultCommitMessage = oldDefaultCommitMessage })
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	report, err := s.SyncWithReport(ctx, Options{NoApply: true, NoPush: true})
+	if err != nil {
+		t.Fatalf("SyncWithReport error = %v", err)
+	}
+	if len(report.ResolvedConflicts) != 2 {
+		t.Fatalf("ResolvedConflicts = %#v, want 2", report.ResolvedConflicts)
+	}
+	if r.remaining() != 0 {
+		t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+	}
+}
+
+func TestSyncStopsOnManualConflictPolicy(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	cfg.Sync.Conflicts = map[string]string{"home/dot_cache/**": config.ConflictTheirs}
+
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "re-add"}, "", "", nil)
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"pull", "--rebase", "--autostash"}, "", "conflict", fmt.Errorf("pull failed"))
+	r.Expect("git", []string{"diff", "--name-only", "--diff-filter=U"}, "home/dot_cache/compdump\nhome/dot_gitconfig\n", "", nil)
+	r.Expect("git", []string{"status", "--porcelain"}, "UU home/dot_cache/compdump\nUU home/dot_gitconfig\n", "", nil)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	err := s.Sync(ctx, Options{NoPush: true})
+	if err == nil {
+		t.Fatal("expected manual conflict error")
+	}
+	if !strings.Contains(err.Error(), "manual paths:\n  home/dot_gitconfig") || strings.Contains(err.Error(), "manual paths:\n  home/dot_cache") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.remaining() != 0 {
+		t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+	}
+}
+
+func TestSyncHandsUnresolvedConflictsToResolver(t *testing.T) {
+	for _, abort := range []bool{false, true} {
+		t.Run(fmt.Sprintf("abort=%v", abort), func(t *testing.T) {
+			ctx := context.Background()
+			local := testutil.NewFakeRepo(t)
+			other := local.Clone()
+			other.WriteFile("home/dot_zshrc", "remote\n")
+			other.Commit("remote edit")
+			other.Push()
+			local.WriteFile("home/dot_zshrc", "local\n")
+			local.Commit("local edit")
+			before := local.Head()
+			local.UseHome()
+			cfg, err := config.Load(local.ConfigPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			g := gitx.New("git", nil)
+			s := NewWithModules(cfg, g, nil, modules.NewOrchestrator())
+			var asked []string
+			s.ResolveConflicts = func(ctx context.Context, paths []string) error {
+				asked = paths
+				if abort {
+					return ErrConflictAborted
+				}
+				return g.CheckoutConflictSide(ctx, local.Root, "theirs", paths...)
+			}
+			report, err := s.SyncWithReport(ctx, Options{NoApply: true, NoPush: true})
+			if strings.Join(asked, ",") != "home/dot_zshrc" {
+				t.Fatalf("resolver asked about %v", asked)
+			}
+			if inRebase, _ := g.RebaseInProgress(ctx, local.Root); inRebase {
+				t.Fatal("rebase left in progress")
+			}
+			if abort {
+				if doterrors.Exit(err) != doterrors.ExitConflict {
+					t.Fatalf("SyncWithReport() error = %v, want a conflict exit", err)
+				}
+				if local.Head() != before {
+					t.Fatalf("HEAD moved to %s after abort, want %s", local.Head(), before)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SyncWithReport() error = %v", err)
+			}
+			if len(report.ResolvedConflicts) != 1 || report.ResolvedConflicts[0].Policy != config.ConflictManual {
+				t.Fatalf("ResolvedConflicts = %+v", report.ResolvedConflicts)
+			}
+			if got := local.Git("show", "HEAD:home/dot_zshrc"); got != "local" {
+				t.Fatalf("resolved content = %q, want the local side", got)
+			}
+			if parent := local.Git("rev-parse", "HEAD~1"); parent != other.Head() {
+				t.Fatalf("local commit not replayed onto the remote: parent %s, want %s", parent, other.Head())
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/diffstat"
+)
+
+// historySearchDepth bounds how many commits History reads to find each
+// machine's last sync and the dotstate commits to show.
+const historySearchDepth = 500
+
+// HistoryCommit is one dotstate-generated commit.
+type HistoryCommit struct {
+	Hash    string    `json:"hash"`
+	Time    time.Time `json:"time"`
+	Subject string    `json:"subject"`
+	// Machine is the commit's Machine-Id trailer, when it has one.
+	Machine string              `json:"machine,omitempty"`
+	Files   []diffstat.FileStat `json:"files"`
+}
+
+// MachineSync is the most recent sync commit from one machine.
+type MachineSync struct {
+	// Machine is the Machine-Id trailer, or the host named in the subject
+	// for sync commits made without a machine identity.
+	Machine string    `json:"machine"`
+	Host    string    `json:"host,omitempty"`
+	Time    time.Time `json:"time"`
+	Commit  string    `json:"commit"`
+}
+
+// History is the sync history dot log shows.
+type History struct {
+	// Machines lists each machine's last sync, most recent first.
+	Machines []MachineSync `json:"machines"`
+	// Commits are dotstate-generated commits, newest first.
+	Commits []HistoryCommit `json:"commits"`
+	// Journal is this machine's run journal, newest first.
+	Journal []JournalEntry `json:"journal"`
+}
+
+// History reads up to limit dotstate commits from the repo's git log and
+// the latest limit journal entries. Commits count as dotstate's when they
+// are sync commits or carry a Machine-Id trailer.
+func (s *Syncer) History(ctx context.Context, limit int) (*History, error) {
+	repoPath := s.Cfg.Repo.Path
+	entries, err := s.Git.History(ctx, repoPath, historySearchDepth)
+	if err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+
+	history := &History{Machines: []MachineSync{}, Commits: []HistoryCommit{}, Journal: []JournalEntry{}}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		host, isSync := entry.SyncHost()
+		if !isSync && len(entry.Machines) == 0 {
+			continue
+		}
+		machine := ""
+		if len(entry.Machines) > 0 {
+			machine = entry.Machines[0]
+		}
+		if isSync {
+			key := machine
+			if key == "" {
+				key = host
+			}
+			if !seen[key] {
+				seen[key] = true
+				history.Machines = append(history.Machines, MachineSync{Machine: key, Host: host, Time: entry.AuthorDate, Commit: entry.Hash})
+			}
+		}
+		if len(history.Commits) < limit {
+			files, err := s.Git.CommitStat(ctx, repoPath, entry.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("stat %s: %w", shortHash(entry.Hash), err)
+			}
+			if files == nil {
+				files = []diffstat.FileStat{}
+			}
+			history.Commits = append(history.Commits, HistoryCommit{
+				Hash:    entry.Hash,
+				Time:    entry.AuthorDate,
+				Subject: entry.Subject,
+				Machine: machine,
+				Files:   files,
+			})
+		}
+	}
+	sort.SliceStable(history.Machines, func(i, j int) bool {
+		return history.Machines[i].Time.After(history.Machines[j].Time)
+	})
+
+	if s.Journal != nil {
+		journal, err := s.Journal.Entries()
+		if err != nil {
+			return nil, fmt.Errorf("journal: %w", err)
+		}
+		for i := len(journal) - 1; i >= 0 && len(history.Journal) < limit; i-- {
+			history.Journal = append(history.Journal, journal[i])
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func logRecord(hash, date, machine, message string) string {
+	return strings.Join([]string{hash, "", "tree", "Dot", "dot@example.com", date, machine, message}, "\x1f") + "\x1e\n"
+}
+
+func TestJournalRoundTripSkipsTornLines(t *testing.T) {
+	dir := testutil.TempDir(t)
+	journal := &Journal{Path: filepath.Join(dir, "logs", "journal.jsonl")}
+	s := &Syncer{Journal: journal}
+	s.record(JournalEntry{Operation: OpSync, Commit: "abc"}, nil)
+	s.record(JournalEntry{Operation: OpApply}, errors.New("apply failed"))
+	testutil.TempFile(t, dir, "torn/journal.jsonl", "{\"operation\":\"sync\"}\n{\"oper")
+
+	entries, err := journal.Entries()
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Operation != OpSync || entries[1].Error != "apply failed" {
+		t.Fatalf("entries = %#v", entries)
+	}
+	if entries[0].Time.IsZero() || entries[0].Host == "" {
+		t.Fatalf("entry missing time or host: %#v", entries[0])
+	}
+
+	torn, err := (&Journal{Path: filepath.Join(dir, "torn", "journal.jsonl")}).Entries()
+	if err != nil || len(torn) != 1 {
+		t.Fatalf("torn Entries() = %#v, %v; want the one complete line", torn, err)
+	}
+	missing, err := (&Journal{Path: filepath.Join(dir, "missing.jsonl")}).Entries()
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("missing Entries() = %#v, %v", missing, err)
+	}
+}
+
+func TestHistoryFindsLastSyncPerMachine(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	mock := testutil.NewMockRunner(t)
+	log := logRecord("c3", "2026-03-03T10:00:00Z", "laptop", "dot sync from laptop at 2026-03-03T10:00:00Z\n") +
+		logRecord("c2", "2026-03-02T10:00:00Z", "", "Hand-written change\n") +
+		logRecord("c1", "2026-03-01T10:00:00Z", "desktop", "dot sync from desktop at 2026-03-01T10:00:00Z\n") +
+		logRecord("c0", "2026-02-28T10:00:00Z", "laptop", "dot sync from laptop at 2026-02-28T10:00:00Z\n")
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("git", "log"), log)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "show", "--numstat", "--format=", "c3"), "2\t1\thome/dot_zshrc\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "show", "--numstat", "--format=", "c1"), "")
+
+	s := New(cfg, gitx.New("git", mock), nil)
+	s.Journal = &Journal{Path: filepath.Join(repoDir, "state", "logs", "journal.jsonl")}
+	s.record(JournalEntry{Operation: OpCapture}, nil)
+	s.record(JournalEntry{Operation: OpSync, Commit: "c3"}, nil)
+
+	history, err := s.History(ctx, 2)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(history.Machines) != 2 || history.Machines[0].Machine != "laptop" || history.Machines[0].Commit != "c3" ||
+		history.Machines[1].Machine != "desktop" || history.Machines[1].Host != "desktop" {
+		t.Fatalf("Machines = %#v", history.Machines)
+	}
+	if len(history.Commits) != 2 || history.Commits[0].Hash != "c3" || history.Commits[1].Hash != "c1" {
+		t.Fatalf("Commits = %#v, want c3 and c1 without the hand-written commit", history.Commits)
+	}
+	if files := history.Commits[0].Files; len(files) != 1 || files[0].Path != "home/dot_zshrc" || files[0].Added != 2 {
+		t.Fatalf("Commits[0].Files = %#v", files)
+	}
+	if len(history.Journal) != 2 || history.Journal[0].Operation != OpSync || history.Journal[1].Operation != OpCapture {
+		t.Fatalf("Journal = %#v, want newest first", history.Journal)
+	}
+	mock.AssertNotCalled(testutil.MatchExact("git", "show", "--numstat", "--format=", "c0"))
+}
@@ -0,0 +1,53 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+
+	"github.com/dnery/dotstate/dot/internal/runner"
+)
+
+// Environment variables describing the operation to [hooks] commands.
+// EnvRepoRoot and EnvSourceDir are the names dot exec exports too.
+const (
+	EnvHook      = "DOTSTATE_HOOK"
+	EnvOperation = "DOTSTATE_OPERATION"
+	EnvRepoRoot  = "DOT_REPO_ROOT"
+	EnvSourceDir = "DOT_SOURCE_DIR"
+)
+
+// runHooks runs the [hooks] commands for stage in order, stopping at the
+// first failure. Dry runs never reach here.
+func (s *Syncer) runHooks(ctx context.Context, stage, operation string) error {
+	commands := s.Cfg.HookCommands(stage)
+	if len(commands) == 0 {
+		return nil
+	}
+	repo := s.Cfg.Repo.Path
+	env := []string{
+		EnvHook + "=" + stage,
+		EnvOperation + "=" + operation,
+		EnvRepoRoot + "=" + repo,
+		EnvSourceDir + "=" + filepath.Join(repo, s.Cfg.Chex.SourceDir),
+	}
+	for i, command := range commands {
+		shell, args := "sh", []string{"-c", command}
+		if runtime.GOOS == "windows" {
+			shell, args = "cmd", []string{"/C", command}
+		}
+		res, err := runner.RunEnv(ctx, s.Git.R, repo, shell, env, args...)
+		if res != nil && s.HookOutput != nil {
+			_, _ = io.WriteString(s.HookOutput, res.Stdout)
+			if err == nil {
+				_, _ = io.WriteString(s.HookOutput, res.Stderr)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("hooks.%s[%d]: %w", stage, i, err)
+		}
+	}
+	return nil
+}
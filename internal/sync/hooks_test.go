@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestSyncRunsHooksAroundEachStage(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	cfg.Hooks.PreSync = []string{"echo pre-sync"}
+	cfg.Hooks.PreCapture = []string{"echo pre-capture"}
+	cfg.Hooks.PostCapture = []string{"echo post-capture"}
+	cfg.Hooks.PreApply = []string{"echo pre-apply"}
+	cfg.Hooks.PostApply = []string{"exec zsh", "brew bundle"}
+	cfg.Hooks.PostSync = []string{"echo post-sync"}
+	source := filepath.Join(repoDir, "home")
+
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("sh", []string{"-c", "echo pre-sync"}, "", "", nil)
+	r.Expect("sh", []string{"-c", "echo pre-capture"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", source, "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", source, "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", source, "re-add"}, "", "", nil)
+	r.Expect("sh", []string{"-c", "echo post-capture"}, "", "", nil)
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"pull", "--rebase", "--autostash"}, "", "", nil)
+	r.Expect("sh", []string{"-c", "echo pre-apply"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", source, "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", source, "diff"}, "", "", nil)
+	r.Expect("sh", []string{"-c", "exec zsh"}, "", "", nil)
+	r.Expect("sh", []string{"-c", "brew bundle"}, "", "", nil)
+	r.Expect("sh", []string{"-c", "echo post-sync"}, "", "", nil)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	if err := s.Sync(ctx, Options{NoPush: true}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if r.remaining() != 0 {
+		t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+	}
+}
+
+func TestHooksReceiveOperationEnvironment(t *testing.T) {
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	cfg.Hooks.PostApply = []string{"reload"}
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchCommand("chezmoi"), "")
+	mock.OnCommandSuccess(testutil.MatchCommand("sh"), "reloaded\n")
+
+	var out strings.Builder
+	s := New(cfg, gitx.New("git", mock), chez.New("chezmoi", mock))
+	s.HookOutput = &out
+	if err := s.Apply(context.Background()); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	call := mock.LastCall()
+	if call == nil || call.Name != "sh" || call.Dir != repoDir {
+		t.Fatalf("last call = %v, want the hook in the repo", call)
+	}
+	for _, want := range []string{
+		"DOTSTATE_HOOK=post_apply",
+		"DOTSTATE_OPERATION=apply",
+		"DOT_REPO_ROOT=" + repoDir,
+		"DOT_SOURCE_DIR=" + filepath.Join(repoDir, "home"),
+	} {
+		if !slices.Contains(call.Env, want) {
+			t.Errorf("hook env = %v, missing %s", call.Env, want)
+		}
+	}
+	if out.String() != "reloaded\n" {
+		t.Errorf("hook output = %q, want what the hook printed", out.String())
+	}
+}
+
+func TestFailingPreHookStopsCapture(t *testing.T) {
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	cfg.Hooks.PreCapture = []string{"true", "false"}
+	cfg.Hooks.PostCapture = []string{"never"}
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("sh", "-c", "true"), "")
+	mock.OnCommand(testutil.MatchExact("sh", "-c", "false"), "checking\n", "nope", 1, errors.New("exit status 1: nope"))
+
+	var out strings.Builder
+	s := New(cfg, gitx.New("git", mock), chez.New("chezmoi", mock))
+	s.HookOutput = &out
+	err := s.Capture(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "hooks.pre_capture[1]") || !strings.Contains(err.Error(), "nope") {
+		t.Fatalf("Capture() error = %v, want the failing hook and its stderr", err)
+	}
+	if out.String() != "checking\n" {
+		t.Errorf("hook output = %q, want the failing hook's stdout", out.String())
+	}
+	mock.AssertNotCalled(testutil.MatchCommand("chezmoi"))
+	mock.AssertNotCalled(testutil.MatchExact("sh", "-c", "never"))
+}
@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dnery/dotstate/dot/internal/diffstat"
+	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+// Journal operations.
+const (
+	OpSync     = "sync"
+	OpCapture  = "capture"
+	OpApply    = "apply"
+	OpUndo     = "undo"
+	OpRollback = "rollback"
+)
+
+// JournalEntry records one sync, capture, apply, undo, or rollback run on
+// this machine.
+type JournalEntry struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Machine   string    `json:"machine,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	// Commit is the commit the run made: the sync commit, undo's revert, or
+	// rollback's restore commit.
+	Commit string `json:"commit,omitempty"`
+	// Files lists what changed: the sync commit's files, or the files
+	// capture or apply planned to change.
+	Files []diffstat.FileStat `json:"files,omitempty"`
+	Error string              `json:"error,omitempty"`
+}
+
+// Journal is an append-only JSON Lines file of this machine's runs. It is
+// local state, like the logs it sits beside; git history carries what
+// other machines did.
+type Journal struct {
+	Path string
+}
+
+// Append adds entry to the journal, creating it if needed.
+func (j *Journal) Append(entry JournalEntry) error {
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Entries returns the journal oldest first. A missing journal is empty,
+// and lines that do not parse are skipped so one torn write does not hide
+// the rest.
+func (j *Journal) Entries() ([]JournalEntry, error) {
+	f, err := os.Open(j.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// record appends a run to the journal, if one is configured. Journaling is
+// best effort: a run that already changed the machine must not fail
+// because its record could not be written.
+func (s *Syncer) record(entry JournalEntry, err error) {
+	if s.Journal == nil {
+		return
+	}
+	entry.Time = time.Now().UTC()
+	entry.Host = s.hostname()
+	if s.Machine != nil {
+		entry.Machine = s.Machine.ID
+	}
+	if err != nil {
+		entry.Error = redact.Text(err.Error())
+	}
+	_ = s.Journal.Append(entry)
+}
+
+// plannedFiles collects the per-file stats the files module attached to a
+// run's plan.
+func plannedFiles(report *modules.RunReport) []diffstat.FileStat {
+	if report == nil || report.Plan == nil {
+		return nil
+	}
+	var files []diffstat.FileStat
+	for _, change := range report.Plan.Changes {
+		files = append(files, diffstat.FromRecords(change.Current["diff_stat"])...)
+	}
+	return files
+}
@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dnery/dotstate/dot/internal/diffstat"
+	"github.com/dnery/dotstate/dot/internal/glob"
+)
+
+// Managed file states reported by List.
+const (
+	FileInSync   = "in_sync"
+	FileModified = "modified"
+	FileMissing  = "missing"
+)
+
+// ListOptions configures List.
+type ListOptions struct {
+	// Home is the destination directory managed paths are relative to.
+	Home string
+	// Globs keep only targets matching at least one pattern, with the same
+	// syntax as [sync.conflicts]: "**" spans directories, and a pattern
+	// without a slash also matches the base name.
+	Globs []string
+	// ModifiedOnly keeps only targets whose home copy differs from the
+	// source state.
+	ModifiedOnly bool
+}
+
+// ManagedFile is one managed target and how its home copy compares to the
+// source state.
+type ManagedFile struct {
+	// Path is slash-separated and relative to home.
+	Path  string `json:"path"`
+	State string `json:"state"`
+	// Added and Removed count the lines apply would change, for modified
+	// files.
+	Added   int `json:"added,omitempty"`
+	Removed int `json:"removed,omitempty"`
+}
+
+// List reports every managed target with its state, in the engine's order.
+// It reads home and the source state without changing either.
+func (s *Syncer) List(ctx context.Context, opts ListOptions) ([]ManagedFile, error) {
+	repoPath, sourceDir := s.Cfg.Repo.Path, s.Cfg.Chex.SourceDir
+	managed, err := s.Chez.Managed(ctx, repoPath, sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("managed: %w", err)
+	}
+	diff, err := s.Chez.Diff(ctx, repoPath, sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("diff: %w", err)
+	}
+	changed := map[string]diffstat.FileStat{}
+	for _, stat := range diffstat.Parse(diff) {
+		changed[stat.Path] = stat
+	}
+
+	files := make([]ManagedFile, 0, len(managed))
+	for _, target := range managed {
+		target = filepath.ToSlash(target)
+		if len(opts.Globs) > 0 && !matchAnyGlob(opts.Globs, target) {
+			continue
+		}
+		file := ManagedFile{Path: target, State: FileInSync}
+		if _, err := os.Lstat(filepath.Join(opts.Home, filepath.FromSlash(target))); os.IsNotExist(err) {
+			file.State = FileMissing
+		} else if stat, ok := changed[target]; ok {
+			file.State, file.Added, file.Removed = FileModified, stat.Added, stat.Removed
+		}
+		if opts.ModifiedOnly && file.State != FileModified {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func matchAnyGlob(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if glob.Match(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
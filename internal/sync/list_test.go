@@ -0,0 +1,52 @@
+package sync
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestListReportsStateAndFilters(t *testing.T) {
+	ctx := context.Background()
+	repoDir, home := testutil.TempDir(t), testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	testutil.TempFile(t, home, ".zshrc", "export EDITOR=nano\n")
+	testutil.TempFile(t, home, ".config/git/config", "[core]\n")
+	mock := testutil.NewMockRunner(t)
+	source := filepath.Join(repoDir, "home")
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", source, "managed"), ".bashrc\n.config/git/config\n.zshrc\n")
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("chezmoi", "--source", source, "diff"),
+		"diff --git a/.zshrc b/.zshrc\n--- a/.zshrc\n+++ b/.zshrc\n@@ -1 +1 @@\n-export EDITOR=nano\n+export EDITOR=vim\n")
+
+	s := New(cfg, gitx.New("git", mock), chez.New("chezmoi", mock))
+	files, err := s.List(ctx, ListOptions{Home: home})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := []ManagedFile{
+		{Path: ".bashrc", State: FileMissing},
+		{Path: ".config/git/config", State: FileInSync},
+		{Path: ".zshrc", State: FileModified, Added: 1, Removed: 1},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("List() = %#v, want %#v", files, want)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("files[%d] = %#v, want %#v", i, files[i], want[i])
+		}
+	}
+
+	files, err = s.List(ctx, ListOptions{Home: home, Globs: []string{".config/**"}})
+	if err != nil || len(files) != 1 || files[0].Path != ".config/git/config" {
+		t.Fatalf("List(.config/**) = %#v, %v", files, err)
+	}
+	files, err = s.List(ctx, ListOptions{Home: home, Globs: []string{"*rc"}, ModifiedOnly: true})
+	if err != nil || len(files) != 1 || files[0].Path != ".zshrc" {
+		t.Fatalf("List(*rc, modified only) = %#v, %v", files, err)
+	}
+}
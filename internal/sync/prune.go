@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+)
+
+// Stale returns the managed targets whose destination no longer exists in
+// home, slash-separated and relative to it. A missing directory stands in
+// for everything under it. Scripts are never stale. When nothing managed
+// exists in home at all, apply has most likely not run yet, so Stale
+// returns an error instead of offering to forget everything.
+func (s *Syncer) Stale(ctx context.Context, home string) ([]string, error) {
+	verifier, ok := s.Chez.(chez.Verifier)
+	if !ok {
+		return nil, fmt.Errorf("the %T engine cannot report its target state", s.Chez)
+	}
+	entries, err := verifier.TargetState(ctx, s.Cfg.Repo.Path, s.Cfg.Chex.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("target state: %w", err)
+	}
+
+	missing := map[string]bool{}
+	var stale []string
+	for _, ent := range entries {
+		_, err := os.Lstat(filepath.Join(home, filepath.FromSlash(ent.Path)))
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		missing[ent.Path] = true
+		if !underMissing(missing, ent.Path) {
+			stale = append(stale, ent.Path)
+		}
+	}
+	if len(entries) > 0 && len(missing) == len(entries) {
+		return nil, fmt.Errorf("none of the %d managed targets exist in home; run dot apply first", len(entries))
+	}
+	return stale, nil
+}
+
+// underMissing reports whether a parent directory of p is in missing.
+func underMissing(missing map[string]bool, p string) bool {
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if missing[dir] {
+			return true
+		}
+	}
+	return false
+}
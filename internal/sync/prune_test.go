@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestStaleCollapsesMissingDirectories(t *testing.T) {
+	ctx := context.Background()
+	repoDir, home := testutil.TempDir(t), testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	testutil.TempFile(t, home, ".zshrc", "export EDITOR=vim\n")
+	testutil.TempFile(t, home, ".config/git/config", "[core]\n")
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", filepath.Join(repoDir, "home"), "dump", "--format", "json"), `{
+  ".config": {"type": "dir", "perm": 493},
+  ".config/git/config": {"type": "file", "contents": "[core]\n", "perm": 420},
+  ".config/oldapp": {"type": "dir", "perm": 493},
+  ".config/oldapp/settings.json": {"type": "file", "contents": "{}", "perm": 420},
+  ".oldapprc": {"type": "file", "contents": "x", "perm": 420},
+  ".zshrc": {"type": "file", "contents": "export EDITOR=vim\n", "perm": 420},
+  "run_once_install.sh": {"type": "script", "contents": "echo hi\n"}
+}`)
+
+	s := New(cfg, gitx.New("git", mock), chez.New("chezmoi", mock))
+	stale, err := s.Stale(ctx, home)
+	if err != nil {
+		t.Fatalf("Stale() error = %v", err)
+	}
+	if got := strings.Join(stale, ","); got != ".config/oldapp,.oldapprc" {
+		t.Fatalf("Stale() = %v, want .config/oldapp and .oldapprc", stale)
+	}
+
+	if _, err := s.Stale(ctx, testutil.TempDir(t)); err == nil || !strings.Contains(err.Error(), "dot apply") {
+		t.Fatalf("Stale() on an unapplied home error = %v, want a hint to apply", err)
+	}
+}
@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	doterrors "github.com/dnery/dotstate/dot/internal/errors"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/modules"
+)
+
+// RollbackOptions configures Rollback.
+type RollbackOptions struct {
+	// Commit rolls the source state back to this revision and re-applies it.
+	// Empty restores the newest pre-apply backup set instead.
+	Commit string
+	NoPush bool
+	DryRun bool
+}
+
+// RollbackReport describes what Rollback restored.
+type RollbackReport struct {
+	// BackupID and Backups name the restored backup set, when restoring one.
+	BackupID      string
+	Backups       []modules.Backup
+	RestoreReport *modules.RunReport
+	// Commit is the revision the source state was rolled back to.
+	Commit      string
+	Committed   bool
+	Pushed      bool
+	ApplyReport *modules.RunReport
+}
+
+// Rollback undoes a bad apply. Without a commit it puts back the
+// destination files saved by the newest backup set. With one, it commits
+// the source state as of that commit, applies it, then pushes.
+func (s *Syncer) Rollback(ctx context.Context, opts RollbackOptions) (*RollbackReport, error) {
+	report, err := s.rollback(ctx, opts)
+	if !opts.DryRun && s.Journal != nil && (report.Committed || report.RestoreReport != nil || err != nil) {
+		entry := JournalEntry{Operation: OpRollback}
+		if report.Committed {
+			entry.Commit, _ = s.Git.RevParse(ctx, s.Cfg.Repo.Path, "HEAD")
+			entry.Files, _ = s.Git.CommitStat(ctx, s.Cfg.Repo.Path, entry.Commit)
+		}
+		s.record(entry, err)
+	}
+	return report, err
+}
+
+func (s *Syncer) rollback(ctx context.Context, opts RollbackOptions) (*RollbackReport, error) {
+	if opts.Commit == "" {
+		return s.restoreLatestBackup(ctx, opts)
+	}
+
+	report := &RollbackReport{}
+	repo := s.Cfg.Repo.Path
+	if err := s.ensureCleanBeforeSync(ctx); err != nil {
+		return report, err
+	}
+	commit, err := s.Git.RevParse(ctx, repo, opts.Commit+"^{commit}")
+	if err != nil {
+		return report, doterrors.NewUserError(fmt.Sprintf("unknown commit %q", opts.Commit))
+	}
+	report.Commit = commit
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if err := s.Git.RestorePaths(ctx, repo, commit, s.Cfg.Chex.SourceDir); err != nil {
+		return report, fmt.Errorf("restore %s: %w", shortHash(commit), err)
+	}
+	msg := gitx.WithTrailers(fmt.Sprintf("dot rollback to %s from %s", shortHash(commit), s.hostname()), s.commitTrailers()...)
+	committed, err := s.Git.Commit(ctx, repo, msg)
+	if err != nil {
+		return report, fmt.Errorf("commit: %w", err)
+	}
+	report.Committed = committed
+
+	applyReport, err := s.apply(ctx, RunOptions{})
+	report.ApplyReport = applyReport
+	if err != nil {
+		return report, fmt.Errorf("apply: %w", err)
+	}
+
+	if committed && !opts.NoPush {
+		if err := s.Git.Push(ctx, repo); err != nil {
+			return report, fmt.Errorf("push: %w", err)
+		}
+		report.Pushed = true
+	}
+	return report, nil
+}
+
+func (s *Syncer) restoreLatestBackup(ctx context.Context, opts RollbackOptions) (*RollbackReport, error) {
+	report := &RollbackReport{}
+	id, backups, err := modules.LatestBackupSet(s.Cfg.BackupPath())
+	if err != nil {
+		return report, fmt.Errorf("read backups: %w", err)
+	}
+	if id == "" {
+		return report, doterrors.NewUserError("no backup set to restore; backups are taken when apply changes files")
+	}
+	report.BackupID, report.Backups = id, backups
+	if opts.DryRun {
+		return report, nil
+	}
+	restoreReport, err := s.Modules.Restore(ctx, backups)
+	report.RestoreReport = restoreReport
+	if err != nil {
+		return report, fmt.Errorf("restore %s: %w", id, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestRollbackToCommitRestoresSourceAppliesAndPushes(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	stubHostname(t, "test-host")
+
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"rev-parse", "--verify", "abc123^{commit}"}, "abc123def456789\n", "", nil)
+	r.Expect("git", []string{"restore", "--source=abc123def456789", "--staged", "--worktree", "--", "home"}, "", "", nil)
+	r.Expect("git", []string{"status", "--porcelain"}, "M  home/dot_zshrc\n", "", nil)
+	r.Expect("git", []string{"add", "-A"}, "", "", nil)
+	r.Expect("git", []string{"commit", "-m", "dot rollback to abc123def456 from test-host"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("git", []string{"push"}, "", "", nil)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	report, err := s.Rollback(ctx, RollbackOptions{Commit: "abc123"})
+	if err != nil {
+		t.Fatalf("Rollback error = %v", err)
+	}
+	if report.Commit != "abc123def456789" || !report.Committed || !report.Pushed || report.ApplyReport == nil {
+		t.Fatalf("unexpected report: %#v", report)
+	}
+	if r.remaining() != 0 {
+		t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+	}
+}
+
+func TestRollbackRejectsUnknownCommit(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "status", "--porcelain"), "")
+	mock.OnCommandFailure(testutil.MatchExact("git", "rev-parse", "--verify", "nope^{commit}"), "fatal: Needed a single revision", 128)
+
+	s := New(cfg, gitx.New("git", mock), chez.New("chezmoi", mock))
+	_, err := s.Rollback(ctx, RollbackOptions{Commit: "nope"})
+	if err == nil || !strings.Contains(err.Error(), `unknown commit "nope"`) {
+		t.Fatalf("Rollback error = %v, want unknown commit", err)
+	}
+	mock.AssertNotCalled(testutil.MatchCommandPrefix("git", "restore"))
+}
+
+func TestRollbackRestoresLatestBackupSet(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	homeDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	dest := testutil.TempFile(t, homeDir, ".zshrc", "broken\n")
+	setDir := filepath.Join(cfg.BackupPath(), "20260513T120000Z-files")
+	payload := testutil.TempFile(t, setDir, "files/.zshrc", "working\n")
+	backups := []modules.Backup{{
+		BackupID:   "20260513T120000Z-files",
+		Surface:    "files",
+		ID:         "files:path/" + dest,
+		Source:     modules.Source{Kind: "path", Value: dest},
+		Current:    map[string]any{"exists": true},
+		PayloadRef: modules.PayloadRef{Kind: "local_file", Path: payload},
+		Restore:    modules.RestoreInfo{Supported: true},
+	}}
+	b, err := json.Marshal(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.TempFile(t, setDir, "backups.json", string(b))
+
+	mock := testutil.NewMockRunner(t)
+	files := modules.NewFilesModule(cfg, chez.New("chezmoi", mock), homeDir)
+	s := NewWithModules(cfg, gitx.New("git", mock), chez.New("chezmoi", mock), modules.NewOrchestrator(files))
+
+	report, err := s.Rollback(ctx, RollbackOptions{DryRun: true})
+	if err != nil || report.BackupID != "20260513T120000Z-files" || len(report.Backups) != 1 || report.RestoreReport != nil {
+		t.Fatalf("dry run = %#v, %v", report, err)
+	}
+	if content, _ := os.ReadFile(dest); string(content) != "broken\n" {
+		t.Fatalf("dry run changed %s to %q", dest, content)
+	}
+
+	if _, err := s.Rollback(ctx, RollbackOptions{}); err != nil {
+		t.Fatalf("Rollback error = %v", err)
+	}
+	if content, _ := os.ReadFile(dest); string(content) != "working\n" {
+		t.Fatalf("%s = %q, want the backed-up content", dest, content)
+	}
+	if len(mock.Calls()) != 0 {
+		t.Fatalf("restoring a backup ran commands: %#v", mock.Calls())
+	}
+}
@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dnery/dotstate/dot/internal/diffstat"
+)
+
+// StatusOptions configures Status.
+type StatusOptions struct {
+	// Fetch updates remote-tracking branches first, so Ahead and Behind
+	// reflect the remote now rather than as of the last fetch.
+	Fetch bool
+	// Subrepos is the drift of each subrepo declared in state/subrepos.toml,
+	// as reported by dot subrepo status. Entries without drift are dropped.
+	Subrepos []SubrepoDrift
+}
+
+// SubrepoDrift is how one subrepo differs from a clean checkout of its
+// manifest entry, one short phrase per difference.
+type SubrepoDrift struct {
+	Path  string   `json:"path"`
+	Drift []string `json:"drift"`
+}
+
+// StatusReport summarizes everything a sync would act on: uncommitted repo
+// changes, home files that differ from the source state, commits not yet
+// pushed or pulled, and subrepo drift.
+type StatusReport struct {
+	Branch string `json:"branch"`
+	// Uncommitted holds git status --porcelain lines for the repo.
+	Uncommitted []string `json:"uncommitted"`
+	// Pending holds per-file counts for home files that differ from the
+	// source state, as dot diff --stat shows them.
+	Pending []diffstat.FileStat `json:"pending"`
+	// HasUpstream reports whether Branch tracks a remote branch; Ahead and
+	// Behind count against it.
+	HasUpstream bool `json:"has_upstream"`
+	Ahead       int  `json:"ahead"`
+	Behind      int  `json:"behind"`
+	// Fetched reports whether the remote was fetched before counting.
+	Fetched  bool           `json:"fetched"`
+	Subrepos []SubrepoDrift `json:"subrepos"`
+	// InSync is true when there is nothing to commit, capture, apply, push,
+	// or pull, and no subrepo drifted.
+	InSync bool `json:"in_sync"`
+}
+
+// Actions lists what it takes to bring this machine in sync, one short
+// phrase per kind of drift, in the order dot sync handles them.
+func (r *StatusReport) Actions() []string {
+	var actions []string
+	if len(r.Uncommitted) > 0 {
+		actions = append(actions, fmt.Sprintf("commit %d uncommitted repo change(s)", len(r.Uncommitted)))
+	}
+	if len(r.Pending) > 0 {
+		actions = append(actions, fmt.Sprintf("capture or apply %d file(s) that differ from the source state", len(r.Pending)))
+	}
+	if r.Behind > 0 {
+		actions = append(actions, fmt.Sprintf("pull %d commit(s)", r.Behind))
+	}
+	if r.Ahead > 0 {
+		actions = append(actions, fmt.Sprintf("push %d commit(s)", r.Ahead))
+	}
+	if len(r.Subrepos) > 0 {
+		actions = append(actions, fmt.Sprintf("reconcile %d drifted subrepo(s)", len(r.Subrepos)))
+	}
+	return actions
+}
+
+// Status reports pending local and remote changes without modifying the
+// repo or home. Only a requested fetch touches the network.
+func (s *Syncer) Status(ctx context.Context, opts StatusOptions) (*StatusReport, error) {
+	repoPath := s.Cfg.Repo.Path
+	report := &StatusReport{Uncommitted: []string{}, Pending: []diffstat.FileStat{}, Subrepos: []SubrepoDrift{}}
+
+	branch, err := s.Git.CurrentBranch(ctx, repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("branch: %w", err)
+	}
+	report.Branch = branch
+
+	status, err := s.Git.PorcelainStatus(ctx, repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("status: %w", err)
+	}
+	for _, line := range strings.Split(status, "\n") {
+		if strings.TrimSpace(line) != "" {
+			report.Uncommitted = append(report.Uncommitted, line)
+		}
+	}
+
+	diff, err := s.Chez.Diff(ctx, repoPath, s.Cfg.Chex.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("diff: %w", err)
+	}
+	if stats := diffstat.Parse(diff); len(stats) > 0 {
+		report.Pending = stats
+	}
+
+	if opts.Fetch {
+		if err := s.Git.Fetch(ctx, repoPath); err != nil {
+			return nil, fmt.Errorf("fetch: %w", err)
+		}
+		report.Fetched = true
+	}
+	report.Ahead, report.Behind, report.HasUpstream, err = s.Git.AheadBehind(ctx, repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("ahead/behind: %w", err)
+	}
+
+	for _, sub := range opts.Subrepos {
+		if len(sub.Drift) > 0 {
+			report.Subrepos = append(report.Subrepos, sub)
+		}
+	}
+	report.InSync = len(report.Actions()) == 0
+	return report, nil
+}
@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestStatusCombinesRepoHomeAndRemoteDrift(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--abbrev-ref", "HEAD"), "main\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "status", "--porcelain"), "M  home/dot_zshrc\n")
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "diff"),
+		"diff --git a/.gitconfig b/.gitconfig\n--- a/.gitconfig\n+++ b/.gitconfig\n@@ -1 +1 @@\n-old\n+new\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "fetch", "--quiet"), "")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}"), "origin/main\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-list", "--left-right", "--count", "HEAD...@{upstream}"), "1\t2\n")
+
+	s := New(cfg, gitx.New("git", mock), chez.New("chezmoi", mock))
+	report, err := s.Status(ctx, StatusOptions{
+		Fetch: true,
+		Subrepos: []SubrepoDrift{
+			{Path: "~/src/clean"},
+			{Path: "~/src/notes", Drift: []string{"uncommitted changes"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if report.Branch != "main" || !report.Fetched || !report.HasUpstream || report.Ahead != 1 || report.Behind != 2 {
+		t.Fatalf("unexpected remote state: %#v", report)
+	}
+	if len(report.Uncommitted) != 1 || report.Uncommitted[0] != "M  home/dot_zshrc" {
+		t.Fatalf("Uncommitted = %q", report.Uncommitted)
+	}
+	if len(report.Pending) != 1 || report.Pending[0].Path != ".gitconfig" {
+		t.Fatalf("Pending = %#v", report.Pending)
+	}
+	if len(report.Subrepos) != 1 || report.Subrepos[0].Path != "~/src/notes" {
+		t.Fatalf("Subrepos = %#v, want only the drifted one", report.Subrepos)
+	}
+	if report.InSync {
+		t.Fatal("InSync = true, want false")
+	}
+	actions := strings.Join(report.Actions(), "; ")
+	for _, want := range []string{"commit 1", "capture or apply 1", "pull 2", "push 1", "reconcile 1"} {
+		if !strings.Contains(actions, want) {
+			t.Errorf("Actions() = %q, missing %q", actions, want)
+		}
+	}
+	mock.AssertNotCalled(testutil.MatchCommandPrefix("git", "pull"))
+	mock.AssertNotCalled(testutil.MatchCommandPrefix("git", "push"))
+}
+
+func TestStatusInSyncWithoutFetch(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--abbrev-ref", "HEAD"), "main\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "status", "--porcelain"), "")
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "diff"), "")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}"), "origin/main\n")
+	mock.OnCommandSuccess(testutil.MatchExact("git", "rev-list", "--left-right", "--count", "HEAD...@{upstream}"), "0\t0\n")
+
+	s := New(cfg, gitx.New("git", mock), chez.New("chezmoi", mock))
+	report, err := s.Status(ctx, StatusOptions{})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !report.InSync || report.Fetched || len(report.Actions()) != 0 {
+		t.Fatalf("report = %#v, want in sync without fetch", report)
+	}
+	mock.AssertNotCalled(testutil.MatchCommandPrefix("git", "fetch"))
+}
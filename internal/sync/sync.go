@@ -2,28 +2,57 @@ package sync
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/dnery/dotstate/dot/internal/chez"
 	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/diffstat"
 	doterrors "github.com/dnery/dotstate/dot/internal/errors"
 	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/machine"
 	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/runner"
 )
 
 type Syncer struct {
 	Cfg     *config.Config
 	Git     *gitx.Git
-	Chez    *chez.Chezmoi
+	Chez    chez.Engine
 	Modules *modules.Orchestrator
+	// Machine names this machine in sync commits. When nil, the live
+	// hostname is used and no machine trailer is written.
+	Machine *machine.Identity
+	// Version is the dot build recorded in the Dot-Version trailer of sync
+	// commits; empty omits it.
+	Version string
+	// OpenPR opens a pull request from head into base and returns its URL.
+	// It is used after a fallback push when [sync] push_fallback_pr is set.
+	OpenPR func(ctx context.Context, head, base, title string) (string, error)
+	// Journal records each sync, capture, apply, undo, and rollback run that
+	// is not a dry run; nil records nothing.
+	Journal *Journal
+	// ResolveConflicts settles the rebase conflicts no [sync.conflicts]
+	// policy covers, given their repo-relative paths, by resolving and
+	// staging each one. Returning ErrConflictAborted aborts the rebase.
+	// When nil, such conflicts fail the sync.
+	ResolveConflicts func(ctx context.Context, paths []string) error
+	// HookOutput receives what each [hooks] command prints; nil drops it.
+	// A failing hook's stderr is in the returned error either way.
+	HookOutput io.Writer
 }
 
 type Options struct {
 	NoApply bool
 	NoPush  bool
 	DryRun  bool
+	// Message replaces the commit subject, taking precedence over [sync]
+	// commit_template. It expands the same placeholders.
+	Message string
 }
 
 type RunOptions struct {
@@ -31,12 +60,44 @@ type RunOptions struct {
 }
 
 type SyncReport struct {
-	Operations []*modules.RunReport
+	Operations []*modules.RunReport `json:"operations"`
+	// Committed reports whether capture produced a local sync commit.
+	Committed bool `json:"committed"`
+	// CommitStat holds per-file counts for the sync commit, when one was made.
+	CommitStat []diffstat.FileStat `json:"commit_stat,omitempty"`
+	// ResolvedConflicts lists rebase conflicts settled by [sync.conflicts]
+	// or by ResolveConflicts.
+	ResolvedConflicts []ResolvedConflict `json:"resolved_conflicts,omitempty"`
+	// FallbackBranch is set when the configured branch refused the push and
+	// the commits went to this per-machine branch instead.
+	FallbackBranch string `json:"fallback_branch,omitempty"`
+	// PullRequestURL is the pull request opened from FallbackBranch.
+	PullRequestURL string `json:"pull_request_url,omitempty"`
+	// PullRequestError records why no pull request could be opened.
+	PullRequestError error `json:"-"`
+	// Planned lists the git commands a dry run would have run after
+	// capture, in order.
+	Planned []runner.Planned `json:"planned,omitempty"`
+}
+
+// MarshalJSON adds PullRequestError as a message, since errors do not
+// marshal on their own.
+func (r SyncReport) MarshalJSON() ([]byte, error) {
+	type report SyncReport
+	out := struct {
+		report
+		PullRequestError string `json:"pull_request_error,omitempty"`
+	}{report: report(r)}
+	if r.PullRequestError != nil {
+		out.PullRequestError = r.PullRequestError.Error()
+	}
+	return json.Marshal(out)
 }
 
 var (
 	osHostname           = os.Hostname
 	defaultCommitMessage = gitx.DefaultCommitMessage
+	timeNow              = time.Now
 )
 
 func New(cfg *config.Config, g *gitx.Git, ch *chez.Chezmoi) *Syncer {
@@ -45,17 +106,137 @@ func New(cfg *config.Config, g *gitx.Git, ch *chez.Chezmoi) *Syncer {
 	return NewWithModules(cfg, g, ch, modules.NewOrchestrator(files))
 }
 
-func NewWithModules(cfg *config.Config, g *gitx.Git, ch *chez.Chezmoi, orchestrator *modules.Orchestrator) *Syncer {
+func NewWithModules(cfg *config.Config, g *gitx.Git, ch chez.Engine, orchestrator *modules.Orchestrator) *Syncer {
 	return &Syncer{Cfg: cfg, Git: g, Chez: ch, Modules: orchestrator}
 }
 
+// hostname returns the host named in sync commit subjects. The identity's
+// recorded hostname wins so renaming the machine does not orphan its
+// earlier sync commits.
+func (s *Syncer) hostname() string {
+	if s.Machine != nil && s.Machine.Hostname != "" {
+		return s.Machine.Hostname
+	}
+	host, _ := osHostname()
+	return host
+}
+
+// commitTrailers returns the Machine-Id, Dot-Version, and Profile trailers
+// for sync commits. The identity file's profile wins over
+// [templates].profile, as it does for template data.
+func (s *Syncer) commitTrailers() []gitx.Trailer {
+	var id, profile string
+	if s.Cfg != nil {
+		profile = s.Cfg.Templates.Profile
+	}
+	if s.Machine != nil {
+		id = s.Machine.ID
+		if s.Machine.Profile != "" {
+			profile = s.Machine.Profile
+		}
+	}
+	return []gitx.Trailer{
+		{Key: gitx.TrailerMachineID, Value: id},
+		{Key: gitx.TrailerDotVersion, Value: s.Version},
+		{Key: gitx.TrailerProfile, Value: profile},
+	}
+}
+
+// commitMessage returns the sync commit message with its trailers. The
+// subject is custom when given, else [sync] commit_template, else the
+// default. A custom subject no longer names the host, so it gets a
+// Sync-Host trailer that undo and history recognize instead.
+func (s *Syncer) commitMessage(ctx context.Context, custom string) (string, error) {
+	host := s.hostname()
+	trailers := s.commitTrailers()
+	if custom == "" {
+		custom = s.Cfg.Sync.CommitTemplate
+	}
+	if strings.TrimSpace(custom) == "" {
+		return gitx.WithTrailers(defaultCommitMessage(host), trailers...), nil
+	}
+	if host == "" {
+		host = "unknown-host"
+	}
+	subject, err := s.expandCommitTemplate(ctx, custom, host)
+	if err != nil {
+		return "", err
+	}
+	return gitx.WithTrailers(subject, append(trailers, gitx.Trailer{Key: gitx.TrailerSyncHost, Value: host})...), nil
+}
+
+// expandCommitTemplate fills in config.CommitTemplateFields. The changed
+// files are read from git status only when the template asks for them.
+func (s *Syncer) expandCommitTemplate(ctx context.Context, tmpl, host string) (string, error) {
+	id, profile := host, ""
+	for _, t := range s.commitTrailers() {
+		switch {
+		case t.Key == gitx.TrailerMachineID && t.Value != "":
+			id = t.Value
+		case t.Key == gitx.TrailerProfile:
+			profile = t.Value
+		}
+	}
+	var changed string
+	if strings.Contains(tmpl, "{{changed_files}}") {
+		status, err := s.Git.PorcelainStatus(ctx, s.Cfg.Repo.Path)
+		if err != nil {
+			return "", fmt.Errorf("status: %w", err)
+		}
+		changed = strings.Join(statusPaths(status), ", ")
+	}
+	return strings.NewReplacer(
+		"{{hostname}}", host,
+		"{{machine}}", id,
+		"{{profile}}", profile,
+		"{{date}}", timeNow().Format(time.RFC3339),
+		"{{changed_files}}", changed,
+	).Replace(tmpl), nil
+}
+
+// statusPaths returns the paths in porcelain status output, taking the new
+// name of a rename. PorcelainStatus trims the first line's leading space,
+// so the status code is cut at the first blank rather than by column.
+func statusPaths(status string) []string {
+	var paths []string
+	for _, line := range strings.Split(status, "\n") {
+		_, p, ok := strings.Cut(strings.TrimLeft(line, " "), " ")
+		if p = strings.TrimLeft(p, " "); !ok || p == "" {
+			continue
+		}
+		if _, to, ok := strings.Cut(p, " -> "); ok {
+			p = to
+		}
+		paths = append(paths, strings.Trim(p, `"`))
+	}
+	return paths
+}
+
 func (s *Syncer) Capture(ctx context.Context) error {
 	_, err := s.CaptureWithOptions(ctx, RunOptions{})
 	return err
 }
 
 func (s *Syncer) CaptureWithOptions(ctx context.Context, opts RunOptions) (*modules.RunReport, error) {
-	return s.Modules.Run(ctx, modules.OperationCapture, modules.RunOptions{DryRun: opts.DryRun})
+	report, err := s.capture(ctx, opts)
+	if !opts.DryRun {
+		s.record(JournalEntry{Operation: OpCapture, Files: plannedFiles(report)}, err)
+	}
+	return report, err
+}
+
+func (s *Syncer) capture(ctx context.Context, opts RunOptions) (*modules.RunReport, error) {
+	if opts.DryRun {
+		return s.Modules.Run(ctx, modules.OperationCapture, modules.RunOptions{DryRun: true})
+	}
+	if err := s.runHooks(ctx, config.HookPreCapture, OpCapture); err != nil {
+		return nil, err
+	}
+	report, err := s.Modules.Run(ctx, modules.OperationCapture, modules.RunOptions{})
+	if err != nil {
+		return report, err
+	}
+	return report, s.runHooks(ctx, config.HookPostCapture, OpCapture)
 }
 
 func (s *Syncer) Apply(ctx context.Context) error {
@@ -64,7 +245,25 @@ func (s *Syncer) Apply(ctx context.Context) error {
 }
 
 func (s *Syncer) ApplyWithOptions(ctx context.Context, opts RunOptions) (*modules.RunReport, error) {
-	return s.Modules.Run(ctx, modules.OperationApply, modules.RunOptions{DryRun: opts.DryRun})
+	report, err := s.apply(ctx, opts)
+	if !opts.DryRun {
+		s.record(JournalEntry{Operation: OpApply, Files: plannedFiles(report)}, err)
+	}
+	return report, err
+}
+
+func (s *Syncer) apply(ctx context.Context, opts RunOptions) (*modules.RunReport, error) {
+	if opts.DryRun {
+		return s.Modules.Run(ctx, modules.OperationApply, modules.RunOptions{DryRun: true})
+	}
+	if err := s.runHooks(ctx, config.HookPreApply, OpApply); err != nil {
+		return nil, err
+	}
+	report, err := s.Modules.Run(ctx, modules.OperationApply, modules.RunOptions{})
+	if err != nil {
+		return report, err
+	}
+	return report, s.runHooks(ctx, config.HookPostApply, OpApply)
 }
 
 func (s *Syncer) PlanApply(ctx context.Context) (*modules.Plan, error) {
@@ -81,45 +280,66 @@ func (s *Syncer) Sync(ctx context.Context, opts Options) error {
 }
 
 func (s *Syncer) SyncWithReport(ctx context.Context, opts Options) (*SyncReport, error) {
+	report, err := s.sync(ctx, opts)
+	if !opts.DryRun && s.Journal != nil {
+		entry := JournalEntry{Operation: OpSync, Files: report.CommitStat}
+		if report.Committed && err == nil {
+			entry.Commit, _ = s.Git.RevParse(ctx, s.Cfg.Repo.Path, "HEAD")
+		}
+		s.record(entry, err)
+	}
+	return report, err
+}
+
+func (s *Syncer) sync(ctx context.Context, opts Options) (*SyncReport, error) {
 	report := &SyncReport{}
 
 	if err := s.ensureCleanBeforeSync(ctx); err != nil {
 		return report, err
 	}
+	if !opts.DryRun {
+		if err := s.runHooks(ctx, config.HookPreSync, OpSync); err != nil {
+			return report, err
+		}
+	}
 
-	captureReport, err := s.CaptureWithOptions(ctx, RunOptions{DryRun: opts.DryRun})
+	captureReport, err := s.capture(ctx, RunOptions{DryRun: opts.DryRun})
 	report.Operations = append(report.Operations, captureReport)
 	if err != nil {
 		return report, fmt.Errorf("capture: %w", err)
 	}
 
+	msg, err := s.commitMessage(ctx, opts.Message)
+	if err != nil {
+		return report, err
+	}
 	if opts.DryRun {
 		if !opts.NoApply {
-			applyReport, err := s.ApplyWithOptions(ctx, RunOptions{DryRun: true})
+			applyReport, err := s.apply(ctx, RunOptions{DryRun: true})
 			report.Operations = append(report.Operations, applyReport)
 			if err != nil {
 				return report, fmt.Errorf("apply plan: %w", err)
 			}
 		}
+		report.Planned = s.planGit(ctx, captureReport, msg, opts)
 		return report, nil
 	}
 
-	host, _ := osHostname()
-	msg := defaultCommitMessage(host)
-
 	committed, err := s.Git.Commit(ctx, s.Cfg.Repo.Path, msg)
 	if err != nil {
 		return report, fmt.Errorf("commit: %w", err)
 	}
-	_ = committed // kept for future UX reporting.
+	report.Committed = committed
 
 	// Pull/rebase before apply so we converge on the canonical remote state.
 	if err := s.Git.PullRebase(ctx, s.Cfg.Repo.Path); err != nil {
-		return report, s.pullError(ctx, err)
+		if err := s.resolveRebaseConflicts(ctx, report, err); err != nil {
+			return report, err
+		}
 	}
 
 	if !opts.NoApply {
-		applyReport, err := s.ApplyWithOptions(ctx, RunOptions{})
+		applyReport, err := s.apply(ctx, RunOptions{})
 		report.Operations = append(report.Operations, applyReport)
 		if err != nil {
 			return report, fmt.Errorf("apply: %w", err)
@@ -128,11 +348,76 @@ func (s *Syncer) SyncWithReport(ctx context.Context, opts Options) (*SyncReport,
 
 	if !opts.NoPush {
 		if err := s.Git.Push(ctx, s.Cfg.Repo.Path); err != nil {
-			return report, fmt.Errorf("push: %w", err)
+			if err := s.pushFallback(ctx, report, err); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if committed {
+		// Best effort: the summary is informational and must not fail a sync
+		// that already pushed.
+		if stats, err := s.Git.CommitStat(ctx, s.Cfg.Repo.Path, "HEAD"); err == nil {
+			report.CommitStat = stats
 		}
 	}
 
-	return report, nil
+	return report, s.runHooks(ctx, config.HookPostSync, OpSync)
+}
+
+// planGit records, without running them, the git commands a real sync
+// would run around apply. The repo is clean before capture, so the commit
+// is planned when the capture plan would change the source state.
+func (s *Syncer) planGit(ctx context.Context, capture *modules.RunReport, msg string, opts Options) []runner.Planned {
+	rec := &runner.PlanRunner{}
+	g := gitx.New(s.Git.Bin, rec)
+	repo := s.Cfg.Repo.Path
+	if capture != nil && capture.Plan != nil {
+		if sum := capture.Plan.Summary; sum.Create+sum.Update+sum.Delete > 0 {
+			_ = g.CommitAll(ctx, repo, msg)
+		}
+	}
+	_ = g.PullRebase(ctx, repo)
+	if !opts.NoPush {
+		_ = g.Push(ctx, repo)
+	}
+	return rec.Planned()
+}
+
+// pushFallback handles a failed push. When the remote refused it as
+// protected or forbidden and [sync] push_fallback_branch is set, the
+// commits go to the per-machine fallback branch instead, optionally with a
+// pull request, so the sync still completes; other failures are returned.
+func (s *Syncer) pushFallback(ctx context.Context, report *SyncReport, pushErr error) error {
+	branch := s.fallbackBranch()
+	if branch == "" || !gitx.IsProtectedPushError(pushErr) {
+		return fmt.Errorf("push: %w", pushErr)
+	}
+	if err := s.Git.PushBranch(ctx, s.Cfg.Repo.Path, branch); err != nil {
+		return fmt.Errorf("push: %w; fallback push to %s also failed: %v", pushErr, branch, err)
+	}
+	report.FallbackBranch = branch
+	if s.Cfg.Sync.PushFallbackPR {
+		if s.OpenPR == nil {
+			report.PullRequestError = fmt.Errorf("no pull request provider configured")
+			return nil
+		}
+		url, err := s.OpenPR(ctx, branch, s.Cfg.Repo.Branch, gitx.SyncCommitPrefix(s.hostname()))
+		report.PullRequestURL, report.PullRequestError = url, err
+	}
+	return nil
+}
+
+// fallbackBranch expands [sync] push_fallback_branch for this machine.
+func (s *Syncer) fallbackBranch() string {
+	id := s.hostname()
+	if s.Machine != nil && s.Machine.ID != "" {
+		id = s.Machine.ID
+	}
+	if id == "" {
+		id = "unknown-host"
+	}
+	return strings.ReplaceAll(s.Cfg.Sync.PushFallbackBranch, "{machine}", id)
 }
 
 func (s *Syncer) ensureCleanBeforeSync(ctx context.Context) error {
@@ -2,16 +2,22 @@ package sync
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dnery/dotstate/dot/internal/chez"
 	"github.com/dnery/dotstate/dot/internal/config"
 	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/machine"
+	"github.com/dnery/dotstate/dot/internal/modules"
+	"github.com/dnery/dotstate/dot/internal/platform"
 	"github.com/dnery/dotstate/dot/internal/runner"
 	"github.com/dnery/dotstate/dot/internal/testutil"
 )
@@ -60,6 +66,45 @@ func TestSyncDryRunPlansWithoutMutating(t *testing.T) {
 	mock.AssertNotCalled(testutil.MatchCommandPrefix("git", "commit"))
 	mock.AssertNotCalled(testutil.MatchCommandPrefix("git", "pull"))
 	mock.AssertNotCalled(testutil.MatchCommandPrefix("git", "push"))
+
+	var planned []string
+	for _, p := range report.Planned {
+		planned = append(planned, p.Name+" "+p.Args[0])
+	}
+	if got := strings.Join(planned, ","); got != "git add,git commit,git pull,git push" {
+		t.Fatalf("planned commands = %s", got)
+	}
+}
+
+func TestSyncDryRunPlansNoCommitWhenCaptureChangesNothing(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandSuccess(testutil.MatchExact("git", "status", "--porcelain"), "")
+	mock.OnCommandSuccess(testutil.MatchCommandPrefix("chezmoi", "--source", filepath.Join(repoDir, "home"), "diff"), "")
+
+	id := &machine.Identity{ID: "desk", Hostname: "desk"}
+	plat := &platform.Platform{OS: platform.Linux, Arch: "amd64"}
+	if _, err := machine.WriteProfile(cfg.RepoRoot(), machine.NewProfile(id, plat)); err != nil {
+		t.Fatal(err)
+	}
+	ch := chez.New("chezmoi", mock)
+	home, _ := os.UserHomeDir()
+	orch := modules.NewOrchestrator(modules.NewFilesModule(cfg, ch, home), machine.NewProfileModule(cfg.RepoRoot(), id, plat, nil))
+	s := NewWithModules(cfg, gitx.New("git", mock), ch, orch)
+	report, err := s.SyncWithReport(ctx, Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("SyncWithReport dry-run error = %v", err)
+	}
+
+	var planned []string
+	for _, p := range report.Planned {
+		planned = append(planned, p.Name+" "+p.Args[0])
+	}
+	if got := strings.Join(planned, ","); got != "git pull,git push" {
+		t.Fatalf("planned commands = %s, want no commit", got)
+	}
 }
 
 func TestSyncReportsPullRebaseConflicts(t *testing.T) {
@@ -68,6 +113,8 @@ func TestSyncReportsPullRebaseConflicts(t *testing.T) {
 	cfg := loadSyncTestConfig(t, repoDir)
 	r := &queuedRunner{t: t}
 	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
 	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "re-add"}, "", "", nil)
 	r.Expect("git", []string{"status", "--porcelain"}, " M home/.zshrc\n", "", nil)
 	r.Expect("git", []string{"add", "-A"}, "", "", nil)
@@ -95,6 +142,200 @@ func TestSyncReportsPullRebaseConflicts(t *testing.T) {
 	}
 }
 
+func TestSyncReportsCommitStat(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "re-add"}, "", "", nil)
+	r.Expect("git", []string{"status", "--porcelain"}, " M home/dot_zshrc\n", "", nil)
+	r.Expect("git", []string{"add", "-A"}, "", "", nil)
+	r.Expect("git", []string{"commit", "-m", "dot sync from test-host at 2026-05-13T00:00:00Z"}, "", "", nil)
+	r.Expect("git", []string{"pull", "--rebase", "--autostash"}, "", "", nil)
+	r.Expect("git", []string{"show", "--numstat", "--format=", "HEAD"}, "4\t2\thome/dot_zshrc\n", "", nil)
+
+	oldDefaultCommitMessage := defaultCommitMessage
+	defaultCommitMessage = func(host string) string { return "dot sync from test-host at 2026-05-13T00:00:00Z" }
+	t.Cleanup(func() { defaultCommitMessage = oldDefaultCommitMessage })
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	report, err := s.SyncWithReport(ctx, Options{NoApply: true, NoPush: true})
+	if err != nil {
+		t.Fatalf("SyncWithReport error = %v", err)
+	}
+	if !report.Committed {
+		t.Fatal("expected Committed = true")
+	}
+	if len(report.CommitStat) != 1 || report.CommitStat[0].Added != 4 || report.CommitStat[0].Removed != 2 {
+		t.Fatalf("CommitStat = %#v", report.CommitStat)
+	}
+	if r.remaining() != 0 {
+		t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+	}
+}
+
+func TestSyncCommitTrailers(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	cfg.Templates.Profile = "personal"
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "re-add"}, "", "", nil)
+	r.Expect("git", []string{"status", "--porcelain"}, " M home/dot_zshrc\n", "", nil)
+	r.Expect("git", []string{"add", "-A"}, "", "", nil)
+	r.Expect("git", []string{"commit", "-m", "dot sync from test-host at 2026-05-13T00:00:00Z\n\nMachine-Id: laptop-01\nDot-Version: 1.2.3\nProfile: work"}, "", "", nil)
+	r.Expect("git", []string{"pull", "--rebase", "--autostash"}, "", "", nil)
+	r.Expect("git", []string{"show", "--numstat", "--format=", "HEAD"}, "1\t0\thome/dot_zshrc\n", "", nil)
+
+	oldDefaultCommitMessage := defaultCommitMessage
+	defaultCommitMessage = func(host string) string { return "dot sync from test-host at 2026-05-13T00:00:00Z" }
+	t.Cleanup(func() { defaultCommitMessage = oldDefaultCommitMessage })
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	s.Machine = &machine.Identity{ID: "laptop-01", Hostname: "test-host", Profile: "work"}
+	s.Version = "1.2.3"
+	if _, err := s.SyncWithReport(ctx, Options{NoApply: true, NoPush: true}); err != nil {
+		t.Fatalf("SyncWithReport error = %v", err)
+	}
+	if r.remaining() != 0 {
+		t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+	}
+}
+
+func TestSyncCommitTemplateAndMessage(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	cfg.Sync.CommitTemplate = "{{machine}}@{{hostname}} {{date}}: {{changed_files}}"
+	stubHostname(t, "test-host")
+	oldNow := timeNow
+	timeNow = func() time.Time { return time.Date(2026, 5, 13, 0, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { timeNow = oldNow })
+	status := " M home/dot_zshrc\nR  home/dot_a -> home/dot_b\n?? home/dot_new\n"
+
+	for _, tc := range []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"template", "", "laptop-01@test-host 2026-05-13T00:00:00Z: home/dot_zshrc, home/dot_b, home/dot_new"},
+		{"message", "tweak prompt on {{hostname}}", "tweak prompt on test-host"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &queuedRunner{t: t}
+			r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+			r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+			r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+			r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "re-add"}, "", "", nil)
+			if tc.message == "" {
+				r.Expect("git", []string{"status", "--porcelain"}, status, "", nil)
+			}
+			r.Expect("git", []string{"status", "--porcelain"}, status, "", nil)
+			r.Expect("git", []string{"add", "-A"}, "", "", nil)
+			r.Expect("git", []string{"commit", "-m", tc.want + "\n\nMachine-Id: laptop-01\nSync-Host: test-host"}, "", "", nil)
+			r.Expect("git", []string{"pull", "--rebase", "--autostash"}, "", "", nil)
+			r.Expect("git", []string{"show", "--numstat", "--format=", "HEAD"}, "", "", nil)
+
+			s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+			s.Machine = &machine.Identity{ID: "laptop-01"}
+			if _, err := s.SyncWithReport(ctx, Options{NoApply: true, NoPush: true, Message: tc.message}); err != nil {
+				t.Fatalf("SyncWithReport error = %v", err)
+			}
+			if r.remaining() != 0 {
+				t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+			}
+		})
+	}
+}
+
+func TestSyncFallsBackToMachineBranchWhenPushIsProtected(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	cfg.Sync.PushFallbackBranch = "dotstate/{machine}"
+	cfg.Sync.PushFallbackPR = true
+	protected := &runner.RunError{Cmd: "git", Args: []string{"push"}, Code: 1,
+		Stderr: "remote: error: GH006: Protected branch update failed for refs/heads/main.\n ! [remote rejected] main -> main (protected branch hook declined)"}
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "re-add"}, "", "", nil)
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"pull", "--rebase", "--autostash"}, "", "", nil)
+	r.Expect("git", []string{"push"}, "", protected.Stderr, protected)
+	r.Expect("git", []string{"push", "--force", "origin", "HEAD:refs/heads/dotstate/laptop-01"}, "", "", nil)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	s.Machine = &machine.Identity{ID: "laptop-01", Hostname: "test-host"}
+	var gotHead, gotBase string
+	s.OpenPR = func(ctx context.Context, head, base, title string) (string, error) {
+		gotHead, gotBase = head, base
+		return "https://example.com/pr/1", nil
+	}
+	report, err := s.SyncWithReport(ctx, Options{NoApply: true})
+	if err != nil {
+		t.Fatalf("SyncWithReport error = %v", err)
+	}
+	if report.FallbackBranch != "dotstate/laptop-01" || report.PullRequestURL != "https://example.com/pr/1" {
+		t.Fatalf("report = %+v", report)
+	}
+	if gotHead != "dotstate/laptop-01" || gotBase != cfg.Repo.Branch {
+		t.Fatalf("OpenPR(%q, %q)", gotHead, gotBase)
+	}
+	if r.remaining() != 0 {
+		t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+	}
+}
+
+func TestSyncReportJSONCarriesPullRequestError(t *testing.T) {
+	report := SyncReport{
+		Operations:       []*modules.RunReport{},
+		FallbackBranch:   "dotstate/laptop-01",
+		PullRequestError: errors.New("no forge token"),
+	}
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{"operations":[],"committed":false,"fallback_branch":"dotstate/laptop-01","pull_request_error":"no forge token"}`
+	if string(b) != want {
+		t.Fatalf("JSON = %s\nwant %s", b, want)
+	}
+}
+
+func TestSyncNonFastForwardPushIsNotFallback(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	cfg.Sync.PushFallbackBranch = "dotstate/{machine}"
+	stale := &runner.RunError{Cmd: "git", Args: []string{"push"}, Code: 1,
+		Stderr: " ! [rejected]        main -> main (fetch first)\nerror: failed to push some refs"}
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "diff"}, "", "", nil)
+	r.Expect("chezmoi", []string{"--source", filepath.Join(repoDir, "home"), "re-add"}, "", "", nil)
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"pull", "--rebase", "--autostash"}, "", "", nil)
+	r.Expect("git", []string{"push"}, "", stale.Stderr, stale)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	report, err := s.SyncWithReport(ctx, Options{NoApply: true})
+	if err == nil || !strings.Contains(err.Error(), "push:") {
+		t.Fatalf("SyncWithReport error = %v, want push error", err)
+	}
+	if report.FallbackBranch != "" {
+		t.Fatalf("FallbackBranch = %q, want none", report.FallbackBranch)
+	}
+}
+
 func loadSyncTestConfig(t *testing.T, repoDir string) *config.Config {
 	t.Helper()
 	content := strings.ReplaceAll(
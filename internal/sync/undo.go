@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	doterrors "github.com/dnery/dotstate/dot/internal/errors"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/modules"
+)
+
+// undoSearchDepth bounds how far back undo looks for this machine's last
+// sync commit.
+const undoSearchDepth = 200
+
+// UndoOptions configures Undo.
+type UndoOptions struct {
+	// Apply force-applies the reverted state to this machine afterwards.
+	Apply  bool
+	NoPush bool
+	DryRun bool
+}
+
+// UndoReport describes what Undo reverted.
+type UndoReport struct {
+	Commit      gitx.Commit
+	Reverted    bool
+	Pushed      bool
+	ApplyReport *modules.RunReport
+}
+
+// Undo reverts the most recent sync commit made by this machine with a new
+// revert commit, optionally applies the reverted state, then pushes.
+func (s *Syncer) Undo(ctx context.Context, opts UndoOptions) (*UndoReport, error) {
+	report, err := s.undo(ctx, opts)
+	if !opts.DryRun && s.Journal != nil && (report.Reverted || err != nil) {
+		entry := JournalEntry{Operation: OpUndo}
+		if report.Reverted {
+			entry.Commit, _ = s.Git.RevParse(ctx, s.Cfg.Repo.Path, "HEAD")
+			entry.Files, _ = s.Git.CommitStat(ctx, s.Cfg.Repo.Path, entry.Commit)
+		}
+		s.record(entry, err)
+	}
+	return report, err
+}
+
+func (s *Syncer) undo(ctx context.Context, opts UndoOptions) (*UndoReport, error) {
+	report := &UndoReport{}
+	repo := s.Cfg.Repo.Path
+
+	if err := s.ensureCleanBeforeSync(ctx); err != nil {
+		return report, err
+	}
+
+	commit, err := s.lastSyncCommit(ctx, s.hostname())
+	if err != nil {
+		return report, err
+	}
+	report.Commit = commit
+
+	if opts.DryRun {
+		if opts.Apply {
+			applyReport, err := s.apply(ctx, RunOptions{DryRun: true})
+			report.ApplyReport = applyReport
+			if err != nil {
+				return report, fmt.Errorf("apply plan: %w", err)
+			}
+		}
+		return report, nil
+	}
+
+	if err := s.Git.Revert(ctx, repo, commit.Hash); err != nil {
+		return report, fmt.Errorf("revert %s: %w", shortHash(commit.Hash), err)
+	}
+	report.Reverted = true
+
+	if opts.Apply {
+		applyReport, err := s.apply(ctx, RunOptions{})
+		report.ApplyReport = applyReport
+		if err != nil {
+			return report, fmt.Errorf("apply: %w", err)
+		}
+	}
+
+	if !opts.NoPush {
+		if err := s.Git.Push(ctx, repo); err != nil {
+			return report, fmt.Errorf("push: %w", err)
+		}
+		report.Pushed = true
+	}
+	return report, nil
+}
+
+func (s *Syncer) lastSyncCommit(ctx context.Context, host string) (gitx.Commit, error) {
+	commits, err := s.Git.Log(ctx, s.Cfg.Repo.Path, undoSearchDepth)
+	if err != nil {
+		return gitx.Commit{}, fmt.Errorf("log: %w", err)
+	}
+	if host == "" {
+		host = "unknown-host"
+	}
+	for _, commit := range commits {
+		if from, ok := gitx.SyncHost(commit.Subject, commit.SyncHost); ok && from == host {
+			return commit, nil
+		}
+	}
+	return gitx.Commit{}, doterrors.NewUserError(fmt.Sprintf("no sync commit from this machine found in the last %d commits", undoSearchDepth))
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/machine"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestUndoRevertsLastSyncCommitFromThisHost(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	stubHostname(t, "test-host")
+
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"log", "--format=%H%x1f%s%x1f%(trailers:key=Sync-Host,valueonly,separator=%x2C)", "-n200"},
+		"aaa\x1fdot sync from other-host at 2026-05-14T00:00:00Z\n"+
+			"bbb\x1fdot sync from test-host at 2026-05-13T00:00:00Z\n"+
+			"ccc\x1fdot sync from test-host at 2026-05-12T00:00:00Z\n", "", nil)
+	r.Expect("git", []string{"revert", "--no-edit", "bbb"}, "", "", nil)
+	r.Expect("git", []string{"push"}, "", "", nil)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	report, err := s.Undo(ctx, UndoOptions{})
+	if err != nil {
+		t.Fatalf("Undo error = %v", err)
+	}
+	if report.Commit.Hash != "bbb" || !report.Reverted || !report.Pushed {
+		t.Fatalf("unexpected report: %#v", report)
+	}
+	if r.remaining() != 0 {
+		t.Fatalf("not all expected commands were consumed: %d", r.remaining())
+	}
+}
+
+func TestUndoDryRunDoesNotRevert(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	stubHostname(t, "test-host")
+
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"log", "--format=%H%x1f%s%x1f%(trailers:key=Sync-Host,valueonly,separator=%x2C)", "-n200"}, "bbb\x1fdot sync from test-host at 2026-05-13T00:00:00Z\n", "", nil)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	report, err := s.Undo(ctx, UndoOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Undo error = %v", err)
+	}
+	if report.Commit.Hash != "bbb" || report.Reverted {
+		t.Fatalf("unexpected report: %#v", report)
+	}
+}
+
+func TestUndoWithoutSyncCommitFails(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	stubHostname(t, "test-host")
+
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"log", "--format=%H%x1f%s%x1f%(trailers:key=Sync-Host,valueonly,separator=%x2C)", "-n200"}, "aaa\x1fmanual edit\n", "", nil)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	_, err := s.Undo(ctx, UndoOptions{})
+	if err == nil || !strings.Contains(err.Error(), "no sync commit from this machine") {
+		t.Fatalf("Undo error = %v, want missing sync commit", err)
+	}
+}
+
+func TestUndoUsesMachineIdentityHostname(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	stubHostname(t, "renamed-host")
+
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"log", "--format=%H%x1f%s%x1f%(trailers:key=Sync-Host,valueonly,separator=%x2C)", "-n200"}, "bbb\x1fdot sync from test-host at 2026-05-13T00:00:00Z\n", "", nil)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	s.Machine = &machine.Identity{ID: "test-host", Hostname: "test-host"}
+	report, err := s.Undo(ctx, UndoOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Undo error = %v", err)
+	}
+	if report.Commit.Hash != "bbb" {
+		t.Fatalf("unexpected report: %#v", report)
+	}
+}
+
+func TestUndoFindsCustomMessageSyncCommitByTrailer(t *testing.T) {
+	ctx := context.Background()
+	repoDir := testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	stubHostname(t, "test-host")
+
+	r := &queuedRunner{t: t}
+	r.Expect("git", []string{"status", "--porcelain"}, "", "", nil)
+	r.Expect("git", []string{"log", "--format=%H%x1f%s%x1f%(trailers:key=Sync-Host,valueonly,separator=%x2C)", "-n200"},
+		"aaa\x1fwip from the other laptop\x1fother-host\n"+
+			"bbb\x1fwip on nvim\x1ftest-host\n"+
+			"ccc\x1fdot sync from test-host at 2026-05-12T00:00:00Z\x1f\n", "", nil)
+
+	s := New(cfg, gitx.New("git", r), chez.New("chezmoi", r))
+	report, err := s.Undo(ctx, UndoOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Undo error = %v", err)
+	}
+	if report.Commit.Hash != "bbb" {
+		t.Fatalf("unexpected report: %#v", report)
+	}
+}
+
+func stubHostname(t *testing.T, host string) {
+	t.Helper()
+	old := osHostname
+	osHostname = func() (string, error) { return host, nil }
+	t.Cleanup(func() { osHostname = old })
+}
@@ -0,0 +1,164 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+)
+
+// Verify mismatch kinds.
+const (
+	MismatchMissing = "missing"
+	MismatchType    = "type"
+	MismatchContent = "content"
+	MismatchMode    = "mode"
+	MismatchLink    = "link"
+)
+
+// Engine verdicts reported by Verify.
+const (
+	EngineVerified = "ok"
+	EngineDiffers  = "differs"
+)
+
+// VerifyOptions configures Verify.
+type VerifyOptions struct {
+	// Home is the destination directory target paths are relative to.
+	Home string
+	// Targets limits the check to these managed paths; empty checks all.
+	Targets []string
+}
+
+// Mismatch is one target whose home copy does not match the source state.
+// Want and Have are SHA-256 checksums for content, octal permissions for
+// mode, link destinations for link, and entry types for type.
+type Mismatch struct {
+	// Path is slash-separated and relative to home.
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	Want string `json:"want,omitempty"`
+	Have string `json:"have,omitempty"`
+}
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+	OK bool `json:"ok"`
+	// Checked counts the target entries compared with home.
+	Checked int `json:"checked"`
+	// Engine is chezmoi verify's verdict, or empty when the engine has no
+	// verify of its own.
+	Engine     string     `json:"engine,omitempty"`
+	Mismatches []Mismatch `json:"mismatches"`
+}
+
+// engineVerifier is an engine with its own integrity check, as chezmoi
+// verify is.
+type engineVerifier interface {
+	Verify(ctx context.Context, repoPath, sourceDir string, targets ...string) (bool, error)
+}
+
+// Verify checks home against the source state without changing either:
+// it runs the engine's own verify, when it has one, then compares every
+// target entry's type, permissions, and SHA-256 checksum with home.
+func (s *Syncer) Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	verifier, ok := s.Chez.(chez.Verifier)
+	if !ok {
+		return nil, fmt.Errorf("the %T engine cannot report its target state", s.Chez)
+	}
+	repoPath, sourceDir := s.Cfg.Repo.Path, s.Cfg.Chex.SourceDir
+	report := &VerifyReport{Mismatches: []Mismatch{}}
+	if ev, ok := s.Chez.(engineVerifier); ok {
+		verified, err := ev.Verify(ctx, repoPath, sourceDir, opts.Targets...)
+		if err != nil {
+			return nil, fmt.Errorf("verify: %w", err)
+		}
+		report.Engine = EngineDiffers
+		if verified {
+			report.Engine = EngineVerified
+		}
+	}
+
+	entries, err := verifier.TargetState(ctx, repoPath, sourceDir, opts.Targets...)
+	if err != nil {
+		return nil, fmt.Errorf("target state: %w", err)
+	}
+	for _, ent := range entries {
+		mismatch, err := checkEntry(opts.Home, ent)
+		if err != nil {
+			return nil, fmt.Errorf("verify %s: %w", ent.Path, err)
+		}
+		if mismatch != nil {
+			report.Mismatches = append(report.Mismatches, *mismatch)
+		}
+	}
+	report.Checked = len(entries)
+	report.OK = len(report.Mismatches) == 0 && report.Engine != EngineDiffers
+	return report, nil
+}
+
+// checkEntry compares ent with what is in home, returning nil when they
+// match.
+func checkEntry(home string, ent chez.TargetEntry) (*Mismatch, error) {
+	dest := filepath.Join(home, filepath.FromSlash(ent.Path))
+	info, err := os.Lstat(dest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Mismatch{Path: ent.Path, Kind: MismatchMissing}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if have := entryType(info); have != ent.Type {
+		return &Mismatch{Path: ent.Path, Kind: MismatchType, Want: ent.Type, Have: have}, nil
+	}
+
+	switch ent.Type {
+	case chez.TargetSymlink:
+		link, err := os.Readlink(dest)
+		if err != nil {
+			return nil, err
+		}
+		if link != string(ent.Contents) {
+			return &Mismatch{Path: ent.Path, Kind: MismatchLink, Want: string(ent.Contents), Have: link}, nil
+		}
+		return nil, nil
+	case chez.TargetFile:
+		content, err := os.ReadFile(dest)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(content, ent.Contents) {
+			return &Mismatch{Path: ent.Path, Kind: MismatchContent, Want: checksum(ent.Contents), Have: checksum(content)}, nil
+		}
+	}
+	// Windows has no permission bits to compare.
+	if runtime.GOOS != "windows" && ent.Perm != 0 && info.Mode().Perm() != ent.Perm {
+		return &Mismatch{Path: ent.Path, Kind: MismatchMode, Want: fmt.Sprintf("%04o", ent.Perm), Have: fmt.Sprintf("%04o", info.Mode().Perm())}, nil
+	}
+	return nil, nil
+}
+
+func entryType(info fs.FileInfo) string {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		return chez.TargetSymlink
+	case info.IsDir():
+		return chez.TargetDir
+	case info.Mode().IsRegular():
+		return chez.TargetFile
+	}
+	return info.Mode().Type().String()
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
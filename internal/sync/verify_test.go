@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/chez"
+	"github.com/dnery/dotstate/dot/internal/gitx"
+	"github.com/dnery/dotstate/dot/internal/testutil"
+)
+
+func TestVerifyReportsChecksumMismatches(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks and permissions need a Unix home")
+	}
+	ctx := context.Background()
+	repoDir, home := testutil.TempDir(t), testutil.TempDir(t)
+	cfg := loadSyncTestConfig(t, repoDir)
+	testutil.TempFile(t, home, ".zshrc", "export EDITOR=nano\n")
+	testutil.TempFile(t, home, ".config/git/config", "[core]\n")
+	testutil.TempFile(t, home, ".local/bin/hello", "#!/bin/sh\n")
+	if err := os.Symlink("/elsewhere", filepath.Join(home, ".vimrc")); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := testutil.NewMockRunner(t)
+	source := filepath.Join(repoDir, "home")
+	mock.OnCommandFailure(testutil.MatchExact("chezmoi", "--source", source, "verify"), "", 1)
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", source, "dump", "--format", "json"), `{
+  ".bashrc": {"type": "file", "name": ".bashrc", "contents": "set -o vi\n", "perm": 420},
+  ".config": {"type": "dir", "name": ".config", "perm": 493},
+  ".config/git/config": {"type": "file", "name": ".config/git/config", "contents": "[core]\n", "perm": 420},
+  ".local/bin/hello": {"type": "file", "name": ".local/bin/hello", "contents": "#!/bin/sh\n", "perm": 493},
+  ".vimrc": {"type": "symlink", "name": ".vimrc", "linkname": "/repo/vimrc"},
+  ".zshrc": {"type": "file", "name": ".zshrc", "contents": "export EDITOR=vim\n", "perm": 420},
+  "install.sh": {"type": "script", "name": "install.sh", "contents": "echo hi\n"}
+}`)
+
+	s := New(cfg, gitx.New("git", mock), chez.New("chezmoi", mock))
+	report, err := s.Verify(ctx, VerifyOptions{Home: home})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if report.OK || report.Engine != EngineDiffers || report.Checked != 6 {
+		t.Fatalf("report = %+v, want 6 checked and chezmoi differing", report)
+	}
+	want := []Mismatch{
+		{Path: ".bashrc", Kind: MismatchMissing},
+		{Path: ".local/bin/hello", Kind: MismatchMode, Want: "0755", Have: "0644"},
+		{Path: ".vimrc", Kind: MismatchLink, Want: "/repo/vimrc", Have: "/elsewhere"},
+		{Path: ".zshrc", Kind: MismatchContent, Want: checksum([]byte("export EDITOR=vim\n")), Have: checksum([]byte("export EDITOR=nano\n"))},
+	}
+	if len(report.Mismatches) != len(want) {
+		t.Fatalf("mismatches = %#v, want %#v", report.Mismatches, want)
+	}
+	for i := range want {
+		if report.Mismatches[i] != want[i] {
+			t.Errorf("mismatches[%d] = %#v, want %#v", i, report.Mismatches[i], want[i])
+		}
+	}
+
+	target := filepath.Join(home, ".config", "git", "config")
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", source, "verify", target), "")
+	mock.OnCommandSuccess(testutil.MatchExact("chezmoi", "--source", source, "dump", "--format", "json", target),
+		`{".config/git/config": {"type": "file", "name": ".config/git/config", "contents": "[core]\n", "perm": 420}}`)
+	report, err = s.Verify(ctx, VerifyOptions{Home: home, Targets: []string{target}})
+	if err != nil || !report.OK || report.Engine != EngineVerified || len(report.Mismatches) != 0 {
+		t.Fatalf("Verify(target) = %+v, %v, want ok", report, err)
+	}
+}
+
+func TestVerifyFailsWhenChezmoiVerifyErrors(t *testing.T) {
+	repoDir := testutil.TempDir(t)
+	mock := testutil.NewMockRunner(t)
+	mock.OnCommandFailure(testutil.MatchCommandPrefix("chezmoi"), "chezmoi: invalid config", 2)
+
+	s := New(loadSyncTestConfig(t, repoDir), gitx.New("git", mock), chez.New("chezmoi", mock))
+	if _, err := s.Verify(context.Background(), VerifyOptions{Home: testutil.TempDir(t)}); err == nil {
+		t.Fatal("Verify() succeeded despite chezmoi failing")
+	}
+}
@@ -0,0 +1,152 @@
+// Package telemetry keeps strictly opt-in, anonymized usage counters:
+// which commands run, on which OS, and which error categories they end in.
+// Nothing is recorded until the user enables it, counters never include
+// paths, arguments, hostnames, or error text, and they accumulate in a
+// local queue file that the user can inspect or discard at any time.
+package telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	doterrors "github.com/dnery/dotstate/dot/internal/errors"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// FileName is the telemetry queue file under the dotstate state directory.
+const FileName = "telemetry.json"
+
+// Environment variables that veto recording even when enabled.
+const (
+	EnvDisable = "DOTSTATE_TELEMETRY" // "0", "false", or "off" disables
+	EnvDNT     = "DO_NOT_TRACK"       // any non-empty value but "0" disables
+)
+
+// State is the local opt-in flag and the queued counters.
+type State struct {
+	Enabled   bool      `json:"enabled"`
+	EnabledAt time.Time `json:"enabled_at,omitzero"`
+	// Counters maps "<kind>:<value>" keys (command, os, error) to counts.
+	Counters map[string]int64 `json:"counters,omitempty"`
+}
+
+// Event is one command invocation.
+type Event struct {
+	// Command is the cobra command path without the binary name, e.g.
+	// "sync now".
+	Command string
+	OS      platform.OS
+	// ExitCode is mapped to a coarse error category.
+	ExitCode int
+}
+
+// Path returns the queue file location for plat.
+func Path(plat *platform.Platform) string {
+	return filepath.Join(plat.StateDir, "dotstate", FileName)
+}
+
+// Load reads the state at path; a missing file means telemetry is off.
+func Load(path string) (*State, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read telemetry state: %w", err)
+	}
+	var s State
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parse telemetry state: %w", err)
+	}
+	return &s, nil
+}
+
+// Save writes the state, creating its directory.
+func (s *State) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create telemetry directory: %w", err)
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// Enable opts in, starting an empty queue if none exists.
+func (s *State) Enable(now time.Time) {
+	if !s.Enabled {
+		s.Enabled = true
+		s.EnabledAt = now
+	}
+}
+
+// Record counts ev when telemetry is enabled and not vetoed by the
+// environment. It reports whether anything was recorded.
+func (s *State) Record(ev Event) bool {
+	if !s.Enabled || EnvVetoed() {
+		return false
+	}
+	if s.Counters == nil {
+		s.Counters = map[string]int64{}
+	}
+	if ev.Command != "" {
+		s.Counters["command:"+ev.Command]++
+	}
+	if ev.OS != "" {
+		s.Counters["os:"+string(ev.OS)]++
+	}
+	if category := ErrorCategory(ev.ExitCode); category != "" {
+		s.Counters["error:"+category]++
+	}
+	return true
+}
+
+// Keys returns the counter keys in sorted order.
+func (s *State) Keys() []string {
+	keys := make([]string, 0, len(s.Counters))
+	for key := range s.Counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ErrorCategory maps an exit code to an anonymized category; success maps
+// to "".
+func ErrorCategory(code int) string {
+	switch code {
+	case doterrors.ExitOK:
+		return ""
+	case doterrors.ExitUsage:
+		return "usage"
+	case doterrors.ExitConfig:
+		return "config"
+	case doterrors.ExitUnavailable:
+		return "unavailable"
+	case doterrors.ExitConflict:
+		return "conflict"
+	case doterrors.ExitPermission:
+		return "permission"
+	case doterrors.ExitCanceled:
+		return "canceled"
+	default:
+		return "error"
+	}
+}
+
+// EnvVetoed reports whether DOTSTATE_TELEMETRY or DO_NOT_TRACK forbids
+// recording.
+func EnvVetoed() bool {
+	switch strings.ToLower(os.Getenv(EnvDisable)) {
+	case "0", "false", "off":
+		return true
+	}
+	dnt := os.Getenv(EnvDNT)
+	return dnt != "" && dnt != "0"
+}
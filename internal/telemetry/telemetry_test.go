@@ -0,0 +1,94 @@
+package telemetry
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	doterrors "github.com/dnery/dotstate/dot/internal/errors"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+func TestRecordRequiresOptIn(t *testing.T) {
+	t.Setenv(EnvDisable, "")
+	t.Setenv(EnvDNT, "")
+	s := &State{}
+	if s.Record(Event{Command: "sync", OS: platform.Darwin}) {
+		t.Fatal("Record() counted while disabled")
+	}
+	if len(s.Counters) != 0 {
+		t.Fatalf("Counters = %v, want none", s.Counters)
+	}
+}
+
+func TestRecordCountsAnonymizedEvents(t *testing.T) {
+	t.Setenv(EnvDisable, "")
+	t.Setenv(EnvDNT, "")
+	s := &State{}
+	s.Enable(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	s.Record(Event{Command: "sync now", OS: platform.Darwin})
+	s.Record(Event{Command: "sync now", OS: platform.Darwin, ExitCode: doterrors.ExitConflict})
+	s.Record(Event{Command: "apply", OS: platform.Linux, ExitCode: 1})
+
+	want := map[string]int64{
+		"command:sync now": 2,
+		"command:apply":    1,
+		"os:darwin":        2,
+		"os:linux":         1,
+		"error:conflict":   1,
+		"error:error":      1,
+	}
+	if len(s.Counters) != len(want) {
+		t.Fatalf("Counters = %v, want %v", s.Counters, want)
+	}
+	for key, n := range want {
+		if s.Counters[key] != n {
+			t.Errorf("Counters[%q] = %d, want %d", key, s.Counters[key], n)
+		}
+	}
+}
+
+func TestRecordHonorsEnvironmentVeto(t *testing.T) {
+	tests := []struct {
+		name, disable, dnt string
+		vetoed             bool
+	}{
+		{"unset", "", "", false},
+		{"dotstate off", "off", "", true},
+		{"do not track", "", "1", true},
+		{"do not track zero", "", "0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvDisable, tt.disable)
+			t.Setenv(EnvDNT, tt.dnt)
+			s := &State{Enabled: true}
+			if got := s.Record(Event{Command: "sync"}); got == tt.vetoed {
+				t.Fatalf("Record() = %v, want %v", got, !tt.vetoed)
+			}
+		})
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dotstate", FileName)
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() missing error = %v", err)
+	}
+	if s.Enabled {
+		t.Fatal("missing state should be disabled")
+	}
+	s.Enable(time.Now())
+	s.Counters = map[string]int64{"command:scan": 3}
+	if err := s.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !got.Enabled || got.Counters["command:scan"] != 3 {
+		t.Fatalf("Load() = %#v", got)
+	}
+}
@@ -15,6 +15,8 @@ type CommandCall struct {
 	Dir  string
 	Name string
 	Args []string
+	// Env holds the variables added through RunEnv.
+	Env []string
 }
 
 // String returns a human-readable representation of the command.
@@ -136,10 +138,16 @@ func (m *MockRunner) SetFallback(stdout, stderr string, code int) *MockRunner {
 
 // Run implements the runner.Runner interface for testing.
 func (m *MockRunner) Run(ctx context.Context, dir, name string, args ...string) (*runner.CmdResult, error) {
+	return m.RunEnv(ctx, dir, name, nil, args...)
+}
+
+// RunEnv implements the runner.EnvRunner interface, recording env with the
+// call.
+func (m *MockRunner) RunEnv(ctx context.Context, dir, name string, env []string, args ...string) (*runner.CmdResult, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	call := CommandCall{Dir: dir, Name: name, Args: args}
+	call := CommandCall{Dir: dir, Name: name, Args: args, Env: env}
 	m.calls = append(m.calls, call)
 
 	// Search responses in reverse order (later registrations take precedence)
@@ -243,4 +251,7 @@ func (m *MockRunner) AssertCallCount(expected int) {
 }
 
 // Compile-time check that MockRunner implements runner.Runner.
-var _ runner.Runner = (*MockRunner)(nil)
+var (
+	_ runner.Runner    = (*MockRunner)(nil)
+	_ runner.EnvRunner = (*MockRunner)(nil)
+)
@@ -0,0 +1,190 @@
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// FakeRepo is a real temporary dotfiles repo for integration-style tests: a
+// git repo with dot.toml and a chezmoi-style source state at ~/dotstate in a
+// fake home directory, pushing to a local bare "remote". dot.toml names the
+// repo path as ~/dotstate, so call UseHome before loading it. Everything
+// lives under temp directories removed when the test ends.
+type FakeRepo struct {
+	// Root is the repo working tree, Home/dotstate, holding dot.toml.
+	Root string
+	// Source is the chezmoi source directory, Root/home.
+	Source string
+	// Home is the fake home directory the source state applies to.
+	Home string
+	// Remote is the bare repo Root pushes to as origin.
+	Remote string
+	// ConfigPath is Root/dot.toml.
+	ConfigPath string
+
+	t testing.TB
+}
+
+// RequireGit skips the test when git is not installed.
+func RequireGit(t testing.TB) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+}
+
+// NewFakeRepo creates a bare remote and a repo with dot.toml and an empty
+// source state committed and pushed on main. It skips the test when git is
+// not installed.
+func NewFakeRepo(t testing.TB) *FakeRepo {
+	t.Helper()
+	RequireGit(t)
+	base := t.TempDir()
+	r := newFakeRepo(t, filepath.Join(base, "remote.git"))
+	if err := os.MkdirAll(r.Source, 0o755); err != nil {
+		t.Fatalf("create %s: %v", r.Source, err)
+	}
+	gitIn(t, base, "init", "--quiet", "--bare", "--initial-branch=main", r.Remote)
+	r.Git("init", "--quiet", "--initial-branch=main")
+	r.configureIdentity()
+	r.Git("remote", "add", "origin", r.Remote)
+	r.WriteFile("dot.toml", FakeRepoDotToml(r.Remote))
+	r.WriteFile("home/.keep", "")
+	r.Commit("init")
+	r.Git("push", "--quiet", "-u", "origin", "main")
+	return r
+}
+
+// newFakeRepo lays out a repo pushing to remote in a fresh fake home.
+func newFakeRepo(t testing.TB, remote string) *FakeRepo {
+	t.Helper()
+	home := filepath.Join(t.TempDir(), "home")
+	if err := os.MkdirAll(home, 0o755); err != nil {
+		t.Fatalf("create %s: %v", home, err)
+	}
+	root := filepath.Join(home, "dotstate")
+	return &FakeRepo{
+		Root:       root,
+		Source:     filepath.Join(root, "home"),
+		Home:       home,
+		Remote:     remote,
+		ConfigPath: filepath.Join(root, "dot.toml"),
+		t:          t,
+	}
+}
+
+// FakeRepoDotToml returns a dot.toml for a repo at ~/dotstate cloned from
+// url, with the source state in home/.
+func FakeRepoDotToml(url string) string {
+	return fmt.Sprintf(`[repo]
+url = %q
+path = "~/dotstate"
+branch = "main"
+
+[chex]
+source_dir = "home"
+`, url)
+}
+
+// Clone returns a second machine's view of the repo: a fresh clone of the
+// same remote with its own fake home, for tests of pulls and conflicts.
+func (r *FakeRepo) Clone() *FakeRepo {
+	r.t.Helper()
+	c := newFakeRepo(r.t, r.Remote)
+	gitIn(r.t, c.Home, "clone", "--quiet", r.Remote, c.Root)
+	c.configureIdentity()
+	return c
+}
+
+func (r *FakeRepo) configureIdentity() {
+	r.Git("config", "user.name", "dotstate test")
+	r.Git("config", "user.email", "test@dotstate.invalid")
+	r.Git("config", "commit.gpgsign", "false")
+}
+
+// Git runs git in the repo and returns its trimmed stdout, failing the
+// test on error.
+func (r *FakeRepo) Git(args ...string) string {
+	r.t.Helper()
+	return gitIn(r.t, r.Root, args...)
+}
+
+func gitIn(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	// Keep the user's global config and hooks out of the test.
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// WriteFile writes a file at rel inside the repo.
+func (r *FakeRepo) WriteFile(rel, content string) string {
+	r.t.Helper()
+	return writeFile(r.t, filepath.Join(r.Root, filepath.FromSlash(rel)), content)
+}
+
+// AddSource writes the source state entry for target, a path relative to
+// home such as ".config/nvim/init.lua", naming each leading-dot component
+// chezmoi-style (dot_config/nvim/init.lua). It returns the source path.
+func (r *FakeRepo) AddSource(target, content string) string {
+	r.t.Helper()
+	parts := strings.Split(filepath.ToSlash(target), "/")
+	for i, part := range parts {
+		if rest, ok := strings.CutPrefix(part, "."); ok {
+			parts[i] = "dot_" + rest
+		}
+	}
+	return writeFile(r.t, filepath.Join(r.Source, filepath.Join(parts...)), content)
+}
+
+// AddHomeFile seeds the fake home with a file at rel and returns its path.
+func (r *FakeRepo) AddHomeFile(rel, content string) string {
+	r.t.Helper()
+	return writeFile(r.t, filepath.Join(r.Home, filepath.FromSlash(rel)), content)
+}
+
+// Commit stages everything and commits it.
+func (r *FakeRepo) Commit(message string) {
+	r.t.Helper()
+	r.Git("add", "-A")
+	r.Git("commit", "--quiet", "--allow-empty", "-m", message)
+}
+
+// Push pushes main to the remote.
+func (r *FakeRepo) Push() {
+	r.t.Helper()
+	r.Git("push", "--quiet", "origin", "main")
+}
+
+// Head returns the current commit hash.
+func (r *FakeRepo) Head() string {
+	r.t.Helper()
+	return r.Git("rev-parse", "HEAD")
+}
+
+// UseHome points HOME (and USERPROFILE on Windows) at the fake home for the
+// rest of the test.
+func (r *FakeRepo) UseHome() {
+	r.t.Setenv("HOME", r.Home)
+	r.t.Setenv("USERPROFILE", r.Home)
+}
+
+func writeFile(t testing.TB, path, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create parent dirs: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
@@ -0,0 +1,40 @@
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+)
+
+func TestFakeRepoSharesCommitsBetweenClones(t *testing.T) {
+	repo := NewFakeRepo(t)
+	src := repo.AddSource(".config/nvim/init.lua", "set number\n")
+	if want := filepath.Join(repo.Source, "dot_config", "nvim", "init.lua"); src != want {
+		t.Fatalf("AddSource() = %q, want %q", src, want)
+	}
+	repo.Commit("add nvim")
+	repo.Push()
+
+	other := repo.Clone()
+	if other.Head() != repo.Head() {
+		t.Fatalf("clone HEAD = %s, want %s", other.Head(), repo.Head())
+	}
+	AssertFileContent(t, filepath.Join(other.Source, "dot_config", "nvim", "init.lua"), "set number\n")
+	if status := other.Git("status", "--porcelain"); status != "" {
+		t.Fatalf("clone is dirty: %q", status)
+	}
+
+	other.UseHome()
+	cfg, err := config.Load(other.ConfigPath)
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	if cfg.Repo.Path != other.Root || cfg.SourcePath() != other.Source {
+		t.Fatalf("config repo %q source %q; want %q and %q", cfg.Repo.Path, cfg.SourcePath(), other.Root, other.Source)
+	}
+	if _, err := os.Stat(repo.AddHomeFile(".zshrc", "export EDITOR=nvim\n")); err != nil {
+		t.Fatal(err)
+	}
+}
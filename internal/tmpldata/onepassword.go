@@ -0,0 +1,27 @@
+package tmpldata
+
+import "sort"
+
+// OnePassword is a SecretProvider for op:// references, resolved in templates
+// with chezmoi's onepasswordRead.
+type OnePassword struct {
+	Refs map[string]string
+}
+
+func (p *OnePassword) Name() string { return "1password" }
+
+func (p *OnePassword) TemplateFunc() string { return "onepasswordRead" }
+
+func (p *OnePassword) Names() []string {
+	names := make([]string, 0, len(p.Refs))
+	for name := range p.Refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *OnePassword) Reference(name string) (string, bool) {
+	ref, ok := p.Refs[name]
+	return ref, ok
+}
@@ -0,0 +1,199 @@
+// Package tmpldata builds the dotstate-provided template vocabulary that
+// chezmoi source templates see under .dotstate.
+package tmpldata
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/machine"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+// Namespace is the top-level template data key dotstate owns.
+const Namespace = "dotstate"
+
+// Env is the machine context helpers read from.
+type Env struct {
+	Config   *config.Config
+	Platform *platform.Platform
+	Machine  *machine.Identity
+	Secrets  SecretProvider
+}
+
+// Helper contributes one key under .dotstate.
+type Helper struct {
+	Name        string
+	Description string
+	Data        func(env Env) (any, error)
+}
+
+// SecretProvider maps logical secret names to references that chezmoi
+// resolves at render time. dotstate never resolves the values itself, so
+// secrets stay out of the generated template data.
+type SecretProvider interface {
+	Name() string
+	// TemplateFunc is the chezmoi template function that resolves a reference.
+	TemplateFunc() string
+	Names() []string
+	Reference(name string) (string, bool)
+}
+
+// Registry holds the helpers exposed to templates.
+type Registry struct {
+	helpers map[string]Helper
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{helpers: map[string]Helper{}}
+}
+
+// Default returns a registry with the built-in machine, paths, profile,
+// secrets, and user data helpers.
+func Default() *Registry {
+	r := NewRegistry()
+	for _, h := range builtins() {
+		_ = r.Register(h)
+	}
+	return r
+}
+
+// Register adds a helper. Names must be unique.
+func (r *Registry) Register(h Helper) error {
+	if h.Name == "" || h.Data == nil {
+		return fmt.Errorf("template helper needs a name and data function")
+	}
+	if _, exists := r.helpers[h.Name]; exists {
+		return fmt.Errorf("template helper %q already registered", h.Name)
+	}
+	r.helpers[h.Name] = h
+	return nil
+}
+
+// Helpers returns the registered helpers sorted by name.
+func (r *Registry) Helpers() []Helper {
+	helpers := make([]Helper, 0, len(r.helpers))
+	for _, h := range r.helpers {
+		helpers = append(helpers, h)
+	}
+	sort.Slice(helpers, func(i, j int) bool { return helpers[i].Name < helpers[j].Name })
+	return helpers
+}
+
+// Build evaluates every helper and returns template data rooted at Namespace.
+func (r *Registry) Build(env Env) (map[string]any, error) {
+	data := map[string]any{}
+	for _, h := range r.Helpers() {
+		value, err := h.Data(env)
+		if err != nil {
+			return nil, fmt.Errorf("template helper %s: %w", h.Name, err)
+		}
+		data[h.Name] = value
+	}
+	return map[string]any{Namespace: data}, nil
+}
+
+// JSON returns Build's result encoded for chezmoi --override-data.
+func (r *Registry) JSON(env Env) (string, error) {
+	data, err := r.Build(env)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("encode template data: %w", err)
+	}
+	return string(b), nil
+}
+
+func builtins() []Helper {
+	return []Helper{
+		{
+			Name:        "machine",
+			Description: "id, hostname, tags, os, arch, and wsl for this machine",
+			Data: func(env Env) (any, error) {
+				m := map[string]any{"id": "", "hostname": "", "tags": []string{}}
+				if env.Machine != nil {
+					m["id"] = env.Machine.ID
+					m["hostname"] = env.Machine.Hostname
+					if env.Machine.Tags != nil {
+						m["tags"] = env.Machine.Tags
+					}
+				}
+				if env.Platform != nil {
+					m["os"] = string(env.Platform.OS)
+					m["arch"] = env.Platform.Arch
+					m["wsl"] = env.Platform.IsWSL()
+				}
+				return m, nil
+			},
+		},
+		{
+			Name:        "paths",
+			Description: "platform home, config, data, cache, and state directories",
+			Data: func(env Env) (any, error) {
+				if env.Platform == nil {
+					return map[string]any{}, nil
+				}
+				return map[string]any{
+					"home":   env.Platform.Home,
+					"config": env.Platform.ConfigDir,
+					"data":   env.Platform.DataDir,
+					"cache":  env.Platform.CacheDir,
+					"state":  env.Platform.StateDir,
+				}, nil
+			},
+		},
+		{
+			Name:        "profile",
+			Description: "machine profile from the identity file, else [templates].profile",
+			Data: func(env Env) (any, error) {
+				if env.Machine != nil && env.Machine.Profile != "" {
+					return env.Machine.Profile, nil
+				}
+				if env.Config == nil {
+					return "", nil
+				}
+				return env.Config.Templates.Profile, nil
+			},
+		},
+		{
+			Name:        "secrets",
+			Description: "secret references and the chezmoi function that resolves them",
+			Data: func(env Env) (any, error) {
+				refs := map[string]any{}
+				if env.Secrets == nil {
+					return map[string]any{"provider": "", "func": "", "refs": refs}, nil
+				}
+				for _, name := range env.Secrets.Names() {
+					ref, _ := env.Secrets.Reference(name)
+					refs[name] = ref
+				}
+				return map[string]any{"provider": env.Secrets.Name(), "func": env.Secrets.TemplateFunc(), "refs": refs}, nil
+			},
+		},
+		{
+			Name:        "data",
+			Description: "free-form values from [templates.data]",
+			Data: func(env Env) (any, error) {
+				if env.Config == nil || env.Config.Templates.Data == nil {
+					return map[string]any{}, nil
+				}
+				return env.Config.Templates.Data, nil
+			},
+		},
+	}
+}
+
+// NewEnv builds the helper environment for cfg on this platform, using the
+// 1Password provider for [templates.secrets].
+func NewEnv(cfg *config.Config, plat *platform.Platform, id *machine.Identity) Env {
+	env := Env{Config: cfg, Platform: plat, Machine: id}
+	if cfg != nil && len(cfg.Templates.Secrets) > 0 {
+		env.Secrets = &OnePassword{Refs: cfg.Templates.Secrets}
+	}
+	return env
+}
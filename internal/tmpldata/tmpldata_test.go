@@ -0,0 +1,78 @@
+package tmpldata
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dnery/dotstate/dot/internal/config"
+	"github.com/dnery/dotstate/dot/internal/machine"
+	"github.com/dnery/dotstate/dot/internal/platform"
+)
+
+func TestDefaultRegistryBuildsNamespacedData(t *testing.T) {
+	cfg := config.Default()
+	cfg.Templates.Profile = "work"
+	cfg.Templates.Data = map[string]any{"email": "me@example.com"}
+	cfg.Templates.Secrets = map[string]string{"github_token": "op://Private/GitHub/token"}
+	plat := &platform.Platform{OS: platform.Linux, Arch: "amd64", Home: "/home/u", ConfigDir: "/home/u/.config"}
+
+	data, err := Default().Build(NewEnv(cfg, plat, &machine.Identity{ID: "box-01", Hostname: "box", Tags: []string{"lab"}}))
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	root := data[Namespace].(map[string]any)
+	if root["profile"] != "work" {
+		t.Errorf("profile = %v", root["profile"])
+	}
+	m := root["machine"].(map[string]any)
+	if m["id"] != "box-01" || m["hostname"] != "box" || m["os"] != "linux" || len(m["tags"].([]string)) != 1 {
+		t.Errorf("machine = %v", m)
+	}
+	if root["paths"].(map[string]any)["config"] != "/home/u/.config" {
+		t.Errorf("paths = %v", root["paths"])
+	}
+	secrets := root["secrets"].(map[string]any)
+	if secrets["func"] != "onepasswordRead" || secrets["refs"].(map[string]any)["github_token"] != "op://Private/GitHub/token" {
+		t.Errorf("secrets = %v", secrets)
+	}
+	if root["data"].(map[string]any)["email"] != "me@example.com" {
+		t.Errorf("data = %v", root["data"])
+	}
+}
+
+func TestProfilePrefersMachineIdentity(t *testing.T) {
+	cfg := config.Default()
+	cfg.Templates.Profile = "work"
+
+	data, err := Default().Build(NewEnv(cfg, nil, &machine.Identity{ID: "box", Profile: "personal"}))
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if got := data[Namespace].(map[string]any)["profile"]; got != "personal" {
+		t.Fatalf("profile = %v, want identity profile", got)
+	}
+}
+
+func TestRegistryRejectsDuplicateHelpers(t *testing.T) {
+	r := Default()
+	err := r.Register(Helper{Name: "machine", Data: func(Env) (any, error) { return nil, nil }})
+	if err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Fatalf("Register() error = %v, want duplicate error", err)
+	}
+}
+
+func TestRegistryJSONIncludesCustomHelper(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(Helper{Name: "answer", Data: func(Env) (any, error) { return 42, nil }}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := r.JSON(Env{})
+	if err != nil {
+		t.Fatalf("JSON() error = %v", err)
+	}
+	var decoded map[string]map[string]int
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil || decoded[Namespace]["answer"] != 42 {
+		t.Fatalf("JSON() = %s, %v", out, err)
+	}
+}
@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"os"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// color reports whether Title, Key, and Err style their text. It is off
+// until SetColor turns it on, so output is plain unless the CLI decided
+// the terminal wants styles.
+var color bool
+
+// SetColor turns styled output on or off. On overrides lipgloss's own
+// terminal detection, so CLICOLOR_FORCE styles piped output too.
+func SetColor(on bool) {
+	color = on
+	if on {
+		lipgloss.SetColorProfile(termenv.ANSI)
+	}
+}
+
+func render(style lipgloss.Style, s string) string {
+	if !color {
+		return s
+	}
+	return style.Render(s)
+}
+
+// ColorEnabled decides whether output to f should be styled, following the
+// NO_COLOR and CLICOLOR conventions: never with noColor or a non-empty
+// NO_COLOR, always with CLICOLOR_FORCE set to anything but "0", never with
+// CLICOLOR=0, and otherwise only on a terminal whose TERM is not "dumb".
+func ColorEnabled(f *os.File, noColor bool, getenv func(string) string) bool {
+	switch {
+	case noColor, getenv("NO_COLOR") != "":
+		return false
+	case getenv("CLICOLOR_FORCE") != "" && getenv("CLICOLOR_FORCE") != "0":
+		return true
+	case getenv("CLICOLOR") == "0", getenv("TERM") == "dumb":
+		return false
+	}
+	return IsTerminal(f)
+}
+
+// IsTerminal reports whether f is a character device such as a terminal.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,46 @@
+package ui
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestColorEnabledFollowsFlagsAndEnvironment(t *testing.T) {
+	pipe, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pipe.Close(); w.Close() })
+
+	for _, tc := range []struct {
+		name    string
+		noColor bool
+		env     map[string]string
+		want    bool
+	}{
+		{name: "pipe", want: false},
+		{name: "forced on a pipe", env: map[string]string{"CLICOLOR_FORCE": "1"}, want: true},
+		{name: "force of 0 is not forcing", env: map[string]string{"CLICOLOR_FORCE": "0"}, want: false},
+		{name: "NO_COLOR beats force", env: map[string]string{"NO_COLOR": "1", "CLICOLOR_FORCE": "1"}, want: false},
+		{name: "--no-color beats force", noColor: true, env: map[string]string{"CLICOLOR_FORCE": "1"}, want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			getenv := func(key string) string { return tc.env[key] }
+			if got := ColorEnabled(w, tc.noColor, getenv); got != tc.want {
+				t.Fatalf("ColorEnabled() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestQuietPrinterKeepsResultsOnly(t *testing.T) {
+	var out bytes.Buffer
+	p := &Printer{W: &out, Quiet: true}
+	p.Title("Sync result")
+	p.Infoln("Next steps:")
+	p.Println("modified ~/.zshrc")
+	if got := out.String(); got != "modified ~/.zshrc\n" {
+		t.Fatalf("quiet output = %q", got)
+	}
+}
@@ -0,0 +1,20 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+// JSON writes v to w as indented JSON, redacted like the text output. Every
+// command's --json mode goes through it so scripts see one format.
+func JSON(w io.Writer, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, redact.Text(string(b)))
+	return err
+}
@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Printer writes command output. Results always print; with Quiet set,
+// headings and other informational lines are dropped so only results,
+// warnings, and errors remain.
+type Printer struct {
+	// W receives the output; nil writes to the current os.Stdout.
+	W     io.Writer
+	Quiet bool
+}
+
+// Out is the printer the CLI writes command output through, configured
+// from the global --quiet flag.
+var Out = &Printer{}
+
+func (p *Printer) writer() io.Writer {
+	if p.W == nil {
+		return os.Stdout
+	}
+	return p.W
+}
+
+func (p *Printer) Print(a ...any)                 { fmt.Fprint(p.writer(), a...) }
+func (p *Printer) Printf(format string, a ...any) { fmt.Fprintf(p.writer(), format, a...) }
+func (p *Printer) Println(a ...any)               { fmt.Fprintln(p.writer(), a...) }
+
+// Infof is Printf for informational output that Quiet drops.
+func (p *Printer) Infof(format string, a ...any) {
+	if !p.Quiet {
+		p.Printf(format, a...)
+	}
+}
+
+// Infoln is Println for informational output that Quiet drops.
+func (p *Printer) Infoln(a ...any) {
+	if !p.Quiet {
+		p.Println(a...)
+	}
+}
+
+// Title prints s as a heading, unless Quiet is set.
+func (p *Printer) Title(s string) {
+	p.Infoln(Title(s))
+}
@@ -0,0 +1,36 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Progress renders per-file apply progress. On a terminal it rewrites one
+// status line and clears it after the last file; otherwise it prints a line
+// per file.
+type Progress struct {
+	w   io.Writer
+	tty bool
+}
+
+// NewProgress returns a Progress writing to f, detecting whether f is a
+// terminal.
+func NewProgress(f *os.File) *Progress {
+	return &Progress{w: f, tty: IsTerminal(f)}
+}
+
+// File reports that apply handled path, the done-th of total files.
+// Transient reports (files left alone) only show on a terminal.
+func (p *Progress) File(action, path string, done, total int, transient bool) {
+	if !p.tty {
+		if !transient {
+			fmt.Fprintf(p.w, "[%d/%d] %s %s\n", done, total, action, path)
+		}
+		return
+	}
+	fmt.Fprintf(p.w, "\r\033[K[%d/%d] %s %s", done, total, Key(action), path)
+	if done >= total {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+}
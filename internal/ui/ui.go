@@ -3,11 +3,11 @@ package ui
 import "github.com/charmbracelet/lipgloss"
 
 var (
-    TitleStyle = lipgloss.NewStyle().Bold(true)
-    KeyStyle   = lipgloss.NewStyle().Bold(true)
-    ErrStyle   = lipgloss.NewStyle().Bold(true)
+	TitleStyle = lipgloss.NewStyle().Bold(true)
+	KeyStyle   = lipgloss.NewStyle().Bold(true)
+	ErrStyle   = lipgloss.NewStyle().Bold(true)
 )
 
-func Title(s string) string { return TitleStyle.Render(s) }
-func Key(s string) string   { return KeyStyle.Render(s) }
-func Err(s string) string   { return ErrStyle.Render(s) }
+func Title(s string) string { return render(TitleStyle, s) }
+func Key(s string) string   { return render(KeyStyle, s) }
+func Err(s string) string   { return render(ErrStyle, s) }
@@ -0,0 +1,142 @@
+// Package watch reports edits to managed destination files as they happen,
+// so dot watch can capture them without waiting for the next sync.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/dnery/dotstate/dot/internal/redact"
+)
+
+// DefaultDebounce is how long the watched files must stay quiet before a
+// batch of changes is handled, so an editor's save sequence counts once.
+const DefaultDebounce = 2 * time.Second
+
+// settleTime is how long events are ignored after a batch is handled, so
+// the writes a sync's apply makes to managed files do not start another.
+const settleTime = time.Second
+
+// Watcher calls OnChange with the managed files that changed after each
+// quiet period.
+type Watcher struct {
+	// Targets returns the absolute paths to watch. It is called at start
+	// and after every handled batch, so newly managed files are picked up.
+	Targets func(ctx context.Context) ([]string, error)
+	// OnChange handles one batch of changed paths. An error is logged and
+	// watching continues.
+	OnChange func(ctx context.Context, changed []string) error
+	Debounce time.Duration
+	Logger   *slog.Logger
+}
+
+// Run watches until ctx is done.
+//
+// It watches the directories holding the targets rather than the files,
+// because editors that save by writing a new file and renaming it over the
+// old one would otherwise end the watch. Events for other files in those
+// directories, and those right after OnChange returns, are ignored.
+func (w *Watcher) Run(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("start file watcher: %w", err)
+	}
+	defer fsw.Close()
+
+	debounce := w.Debounce
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	targets, err := w.watch(ctx, fsw, nil)
+	if err != nil {
+		return err
+	}
+
+	changed := map[string]bool{}
+	var settled time.Time
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			w.log().Warn("file watcher error", "error", redact.Text(err.Error()))
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			path := filepath.Clean(event.Name)
+			if !targets[path] || event.Op == fsnotify.Chmod || time.Now().Before(settled) {
+				continue
+			}
+			changed[path] = true
+			timer.Reset(debounce)
+		case <-timer.C:
+			batch := make([]string, 0, len(changed))
+			for path := range changed {
+				batch = append(batch, path)
+			}
+			sort.Strings(batch)
+			clear(changed)
+
+			w.log().Info("managed files changed", "count", len(batch))
+			if err := w.OnChange(ctx, batch); err != nil {
+				w.log().Error("watch handler failed", "error", redact.Text(err.Error()))
+			}
+			settled = time.Now().Add(settleTime)
+			if targets, err = w.watch(ctx, fsw, targets); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// watch adds the directories of the current targets to fsw, drops those
+// no longer needed, and returns the target set.
+func (w *Watcher) watch(ctx context.Context, fsw *fsnotify.Watcher, previous map[string]bool) (map[string]bool, error) {
+	paths, err := w.Targets(ctx)
+	if err != nil {
+		if previous != nil {
+			w.log().Warn("could not refresh watched files; keeping the previous set", "error", redact.Text(err.Error()))
+			return previous, nil
+		}
+		return nil, fmt.Errorf("list managed files: %w", err)
+	}
+	targets := make(map[string]bool, len(paths))
+	dirs := map[string]bool{}
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		targets[path] = true
+		dirs[filepath.Dir(path)] = true
+	}
+	for _, dir := range fsw.WatchList() {
+		if !dirs[dir] {
+			_ = fsw.Remove(dir)
+		}
+	}
+	for dir := range dirs {
+		// A directory that does not exist yet holds only missing targets;
+		// apply creates it, and the next refresh watches it.
+		if err := fsw.Add(dir); err != nil {
+			w.log().Debug("not watching directory", "dir", redact.Text(dir), "error", redact.Text(err.Error()))
+		}
+	}
+	return targets, nil
+}
+
+func (w *Watcher) log() *slog.Logger {
+	if w.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return w.Logger
+}
@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatcherBatchesEditsToManagedFiles(t *testing.T) {
+	dir := t.TempDir()
+	managed := filepath.Join(dir, ".zshrc")
+	other := filepath.Join(dir, ".zsh_history")
+	for _, path := range []string{managed, other} {
+		if err := os.WriteFile(path, []byte("v1\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	batches := make(chan []string, 4)
+	w := &Watcher{
+		Debounce: 100 * time.Millisecond,
+		Targets: func(context.Context) ([]string, error) {
+			return []string{managed}, nil
+		},
+		OnChange: func(_ context.Context, changed []string) error {
+			batches <- changed
+			return nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}()
+
+	// Give the watcher time to register before writing.
+	time.Sleep(100 * time.Millisecond)
+	for _, content := range []string{"v2\n", "v3\n"} {
+		if err := os.WriteFile(managed, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(other, []byte("ls\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-batches:
+		if !slices.Equal(got, []string{managed}) {
+			t.Fatalf("batch = %v, want only %s", got, managed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch after editing a managed file")
+	}
+	select {
+	case got := <-batches:
+		t.Fatalf("unexpected second batch %v", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestWatcherFailsWhenTargetsCannotBeListed(t *testing.T) {
+	w := &Watcher{
+		Targets: func(context.Context) ([]string, error) {
+			return nil, os.ErrPermission
+		},
+		OnChange: func(context.Context, []string) error { return nil },
+	}
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("Run() succeeded without a target list")
+	}
+}
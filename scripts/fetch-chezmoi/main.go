@@ -0,0 +1,48 @@
+// Command fetch-chezmoi downloads a checksum-verified chezmoi release binary
+// for `make build-embedded`.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/dnery/dotstate/dot/internal/provision"
+)
+
+func main() {
+	version := flag.String("version", "", "chezmoi release version, e.g. 2.52.1")
+	goos := flag.String("os", runtime.GOOS, "target GOOS")
+	arch := flag.String("arch", runtime.GOARCH, "target GOARCH")
+	out := flag.String("out", "", "where to write the binary")
+	flag.Parse()
+
+	if *version == "" || *out == "" {
+		fmt.Fprintln(os.Stderr, "usage: fetch-chezmoi -version X.Y.Z -out PATH [-os GOOS] [-arch GOARCH]")
+		os.Exit(64)
+	}
+	if err := run(*version, *goos, *arch, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "fetch-chezmoi:", err)
+		os.Exit(1)
+	}
+}
+
+func run(version, goos, arch, out string) error {
+	cache, err := os.MkdirTemp("", "fetch-chezmoi-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(cache)
+
+	bin, err := provision.New(cache, goos, arch).Chezmoi(context.Background(), version)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(bin)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, b, 0o755)
+}